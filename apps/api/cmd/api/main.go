@@ -5,17 +5,21 @@ import (
 	"fmt"
 	"github.com/unkeyed/unkey/apps/api/pkg/cache"
 	cacheMiddleware "github.com/unkeyed/unkey/apps/api/pkg/cache/middleware"
+	"github.com/unkeyed/unkey/apps/api/pkg/config"
 	"github.com/unkeyed/unkey/apps/api/pkg/database"
 	databaseMiddleware "github.com/unkeyed/unkey/apps/api/pkg/database/middleware"
 	"github.com/unkeyed/unkey/apps/api/pkg/entities"
-	"github.com/unkeyed/unkey/apps/api/pkg/env"
 	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
 	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/metrics"
 	"github.com/unkeyed/unkey/apps/api/pkg/ratelimit"
 	"github.com/unkeyed/unkey/apps/api/pkg/server"
 	"github.com/unkeyed/unkey/apps/api/pkg/tinybird"
 	"github.com/unkeyed/unkey/apps/api/pkg/tracing"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+	"github.com/unkeyed/unkey/apps/api/pkg/usage"
 	"github.com/unkeyed/unkey/apps/api/pkg/version"
+	"github.com/unkeyed/unkey/apps/api/pkg/webhooks"
 	"go.uber.org/zap"
 	"os"
 	"os/signal"
@@ -32,34 +36,37 @@ func main() {
 	}()
 	logger.Info("Starting Unkey API Server")
 
-	e := env.Env{
-		ErrorHandler: func(err error) { logger.Fatal("unable to load environment variable", zap.Error(err)) },
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		logger.Fatal("unable to load config", zap.Error(err))
 	}
-	region := e.String("FLY_REGION", "local")
-	logger = logger.With(zap.String("region", region))
+	region := cfg.Region
 
-	axiomOrgId := e.String("AXIOM_ORG_ID", "")
-	axiomToken := e.String("AXIOM_TOKEN", "")
+	// before anything generates an id
+	err = uid.Configure(cfg.Ids)
+	if err != nil {
+		logger.Fatal("invalid id config", zap.Error(err))
+	}
+	logger = logger.With(zap.String("region", region))
 
 	var tb *tinybird.Tinybird
-	tinybirdToken := e.String("TINYBIRD_TOKEN", "")
-	if tinybirdToken != "" {
+	if cfg.Tinybird.Token != "" {
 		tb = tinybird.New(tinybird.Config{
-			Token:  tinybirdToken,
+			Token:  cfg.Tinybird.Token,
 			Logger: logger,
 		})
 		defer tb.Close()
 	}
 
 	var tracer tracing.Tracer
-	if axiomOrgId != "" && axiomToken != "" {
+	if cfg.Tracing.AxiomOrgId != "" && cfg.Tracing.AxiomToken != "" {
 
 		t, closeTracer, err := tracing.New(context.Background(), tracing.Config{
 			Dataset:    "tracing",
 			Service:    "api",
 			Version:    version.Version,
-			AxiomOrgId: e.String("AXIOM_ORG_ID"),
-			AxiomToken: e.String("AXIOM_TOKEN"),
+			AxiomOrgId: cfg.Tracing.AxiomOrgId,
+			AxiomToken: cfg.Tracing.AxiomToken,
 		})
 		if err != nil {
 			logger.Fatal("unable to start tracer", zap.Error(err))
@@ -78,43 +85,69 @@ func main() {
 
 	k, err := kafka.New(kafka.Config{
 		Logger:   logger,
-		GroupId:  e.String("FLY_ALLOC_ID", "local"),
-		Broker:   e.String("KAFKA_BROKER"),
-		Username: e.String("KAFKA_USERNAME"),
-		Password: e.String("KAFKA_PASSWORD"),
+		GroupId:  cfg.Kafka.GroupId,
+		Brokers:  cfg.Kafka.Brokers,
+		Username: cfg.Kafka.Username,
+		Password: cfg.Kafka.Password,
+		// during a rollout, set the version the oldest consumer understands
+		SchemaVersion: cfg.Kafka.SchemaVersion,
 	})
 	if err != nil {
 		logger.Fatal("unable to start kafka", zap.Error(err))
 	}
 
 	go k.Start()
-	defer k.Close()
 
 	fastRatelimit := ratelimit.NewInMemory()
 	var consistentRatelimit ratelimit.Ratelimiter
-	redisUrl := e.String("REDIS_URL", "")
-	if redisUrl != "" {
+	if cfg.Ratelimit.Backend == config.RatelimitBackendRedis {
 		consistentRatelimit, err = ratelimit.NewRedis(ratelimit.RedisConfig{
-			RedisUrl: redisUrl,
+			RedisUrl: cfg.Ratelimit.RedisUrl,
+			Logger:   logger,
 		})
 		if err != nil {
 			logger.Fatal("unable to start redis ratelimiting", zap.Error(err))
 		}
 	}
 
+	// recoverable keys are only available with a keyring, the config is validated so this can not fail
+	keyring, err := cfg.Encryption.Keyring()
+	if err != nil {
+		logger.Fatal("invalid encryption keyring", zap.Error(err))
+	}
+
 	db, err := database.New(database.Config{
 		Logger:           logger,
-		PrimaryUs:        e.String("DATABASE_DSN"),
-		ReplicaEu:        e.String("DATABASE_DSN_EU", ""),
-		ReplicaAsia:      e.String("DATABASE_DSN_ASIA", ""),
+		PrimaryUs:        cfg.Database.Primary,
+		ReplicaEu:        cfg.Database.ReplicaEu,
+		ReplicaAsia:      cfg.Database.ReplicaAsia,
 		FlyRegion:        region,
-		PlanetscaleBoost: e.Bool("PLANETSCALE_BOOST", false),
+		PlanetscaleBoost: cfg.Database.PlanetscaleBoost,
+		KeyStartChars:    cfg.Server.KeyStartChars,
+		Keyring:          keyring,
+		Pool:             cfg.Database.Pool,
+		StrictMeta:       cfg.Database.StrictMeta,
 	})
 	if err != nil {
 		logger.Fatal("Failed to connect to database", zap.Error(err))
 	}
+	m := metrics.New()
+	m.SetMaxApiLabels(cfg.Metrics.MaxApiLabels)
+	m.RegisterDatabaseStats(db.Stats)
+
 	db = databaseMiddleware.WithTracing(db, tracer)
+	db = databaseMiddleware.WithSlowQueryLogging(db, logger, cfg.Database.SlowQueryThreshold)
 	db = databaseMiddleware.WithLogging(db, logger)
+	db = databaseMiddleware.WithMetrics(db, m)
+
+	// one-time copy of ratelimits from the old columns, keys are read from them until it has run
+	if cfg.Database.MigrateRatelimits {
+		migrated, err := db.MigrateRatelimits(context.Background(), 1000)
+		if err != nil {
+			logger.Fatal("unable to migrate ratelimits", zap.Error(err))
+		}
+		logger.Info("migrated ratelimits", zap.Int("keys", migrated))
+	}
 
 	keyCache := cache.New[entities.Key](cache.Config[entities.Key]{
 		Fresh:             time.Minute,
@@ -134,6 +167,36 @@ func main() {
 	apiCache = cacheMiddleware.WithTracing[entities.Api](apiCache, tracer)
 	apiCache = cacheMiddleware.WithLogging[entities.Api](apiCache, logger)
 
+	workspaceCache := cache.New[entities.Workspace](cache.Config[entities.Workspace]{
+		Fresh:             time.Minute,
+		Stale:             time.Minute * 15,
+		RefreshFromOrigin: db.GetWorkspace,
+		Logger:            logger,
+	})
+	workspaceCache = cacheMiddleware.WithTracing[entities.Workspace](workspaceCache, tracer)
+	workspaceCache = cacheMiddleware.WithLogging[entities.Workspace](workspaceCache, logger)
+
+	webhookCache := cache.New[[]webhooks.Endpoint](cache.Config[[]webhooks.Endpoint]{
+		Fresh:             time.Minute,
+		Stale:             time.Minute * 15,
+		RefreshFromOrigin: db.ListWebhooks,
+		Logger:            logger,
+	})
+	webhookDispatcher := webhooks.New(webhooks.Config{
+		Database:       db,
+		Cache:          webhookCache,
+		Logger:         logger,
+		MaxAttempts:    cfg.Webhooks.MaxAttempts,
+		InitialBackoff: cfg.Webhooks.InitialBackoff,
+	})
+
+	usageBuffer := usage.NewBuffer(usage.BufferConfig{
+		Store:         db,
+		Logger:        logger,
+		FlushInterval: cfg.Usage.FlushInterval,
+		FlushJitter:   &cfg.Usage.FlushJitter,
+	})
+
 	k.RegisterOnKeyEvent(func(ctx context.Context, e kafka.KeyEvent) error {
 		logger.Info("evicting key from cache", zap.String("keyId", e.Key.Id), zap.String("keyHash", e.Key.Hash))
 		keyCache.Remove(context.Background(), e.Key.Hash)
@@ -150,33 +213,42 @@ func main() {
 		return nil
 	})
 
-	port := e.String("PORT", "8080")
-
-	srv := server.New(server.Config{
-		Logger:            logger,
-		KeyCache:          keyCache,
-		ApiCache:          apiCache,
-		Database:          db,
-		Ratelimit:         fastRatelimit,
-		GlobalRatelimit:   consistentRatelimit,
-		Tracer:            tracer,
-		Tinybird:          tb,
-		UnkeyAppAuthToken: e.String("UNKEY_APP_AUTH_TOKEN"),
-		UnkeyWorkspaceId:  e.String("UNKEY_WORKSPACE_ID"),
-		UnkeyApiId:        e.String("UNKEY_API_ID"),
-		UnkeyKeyAuthId:    e.String("UNKEY_KEY_AUTH_ID"),
-		Region:            region,
-		Kafka:             k,
-		Version:           version.Version,
+	srv, err := server.NewFromConfig(cfg, server.Config{
+		Logger:          logger,
+		KeyCache:        keyCache,
+		ApiCache:        apiCache,
+		WorkspaceCache:  workspaceCache,
+		Database:        db,
+		Ratelimit:       fastRatelimit,
+		GlobalRatelimit: consistentRatelimit,
+		Tracer:          tracer,
+		Tinybird:        tb,
+		Kafka:           k,
+		Webhooks:        webhookDispatcher,
+		Usage:           usageBuffer,
+		Version:         version.Version,
+		Metrics:         m,
 	})
+	if err != nil {
+		logger.Fatal("unable to create server", zap.Error(err))
+	}
 
 	go func() {
-		err = srv.Start(fmt.Sprintf("0.0.0.0:%s", port))
+		err = srv.Start(fmt.Sprintf("0.0.0.0:%s", cfg.Port))
 		if err != nil {
 			logger.Fatal("Failed to run service", zap.Error(err))
 		}
 	}()
-	defer srv.Close()
+
+	// grpc is only served for internal services that ask for it
+	if cfg.GrpcPort != "" {
+		go func() {
+			err := srv.StartGRPC(fmt.Sprintf("0.0.0.0:%s", cfg.GrpcPort))
+			if err != nil {
+				logger.Fatal("Failed to run grpc service", zap.Error(err))
+			}
+		}()
+	}
 
 	cShutdown := make(chan os.Signal, 1)
 	signal.Notify(cShutdown, os.Interrupt, syscall.SIGTERM)
@@ -184,4 +256,13 @@ func main() {
 	// wait for signal
 	sig := <-cShutdown
 	logger.Warn("Caught signal", zap.Any("sig", sig))
+
+	// Shutting down the server also flushes kafka and closes the database
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	err = srv.Shutdown(ctx)
+	if err != nil {
+		logger.Error("unable to shut down gracefully", zap.Error(err))
+	}
+	logger.Info("shutdown complete")
 }
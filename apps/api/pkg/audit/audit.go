@@ -0,0 +1,54 @@
+// Package audit describes the immutable record of changes to keys and denied verifications.
+// Entries are only ever appended, never updated or deleted.
+package audit
+
+import (
+	"time"
+)
+
+type Action string
+
+const (
+	KeyCreated      Action = "key.created"
+	KeyUpdated      Action = "key.updated"
+	KeyDeleted      Action = "key.deleted"
+	KeyVerifyDenied Action = "key.verify_denied"
+)
+
+// Actions returns all known actions
+func Actions() []Action {
+	return []Action{KeyCreated, KeyUpdated, KeyDeleted, KeyVerifyDenied}
+}
+
+func (a Action) Valid() bool {
+	for _, known := range Actions() {
+		if a == known {
+			return true
+		}
+	}
+	return false
+}
+
+type Entry struct {
+	Id          string
+	WorkspaceId string
+	// ActorKeyId is the root key that performed the action.
+	// Empty for verifications, which do not require a root key.
+	ActorKeyId  string
+	Action      Action
+	TargetKeyId string
+	Time        time.Time
+	Ip          string
+	// Reason holds additional context, such as why a verification was denied
+	Reason string
+}
+
+// Filter narrows down which entries are listed, zero values do not filter.
+type Filter struct {
+	// Start and End limit the entries to [Start, End)
+	Start   time.Time
+	End     time.Time
+	Actions []Action
+	// Limit is the maximum number of entries returned, newest first
+	Limit int
+}
@@ -0,0 +1,15 @@
+package audit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAction_Valid(t *testing.T) {
+	for _, a := range Actions() {
+		require.True(t, a.Valid(), a)
+	}
+	require.False(t, Action("key.renamed").Valid())
+	require.False(t, Action("").Valid())
+}
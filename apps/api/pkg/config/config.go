@@ -0,0 +1,677 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	databaseMiddleware "github.com/unkeyed/unkey/apps/api/pkg/database/middleware"
+	"github.com/unkeyed/unkey/apps/api/pkg/encryption"
+	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
+	"github.com/unkeyed/unkey/apps/api/pkg/keys"
+	"github.com/unkeyed/unkey/apps/api/pkg/metrics"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+	"github.com/unkeyed/unkey/apps/api/pkg/usage"
+	"github.com/unkeyed/unkey/apps/api/pkg/webhooks"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	RatelimitBackendNone  = "none"
+	RatelimitBackendRedis = "redis"
+)
+
+// Config is everything the api needs to start, loaded once at startup.
+type Config struct {
+	Port string
+	// Optional, grpc is only served if it is set
+	GrpcPort   string
+	Region     string
+	Database   Database
+	Kafka      Kafka
+	Ratelimit  Ratelimit
+	Encryption Encryption
+	Hashing    Hashing
+	Unkey      Unkey
+	Ids        uid.Config
+	Tracing    Tracing
+	Tinybird   Tinybird
+	Metrics    Metrics
+	Webhooks   Webhooks
+	Usage      Usage
+	Server     Server
+	// How long a shutdown waits for requests and background work to finish
+	ShutdownTimeout time.Duration
+}
+
+type Database struct {
+	Primary string
+	// Optional, reads in these regions go to the replica
+	ReplicaEu        string
+	ReplicaAsia      string
+	PlanetscaleBoost bool
+	Pool             database.PoolConfig
+	// Fail to load keys with invalid meta instead of dropping their meta
+	StrictMeta bool
+	// Queries that take longer are logged as slow
+	SlowQueryThreshold time.Duration
+	// Copy the ratelimits of keys from the old columns at startup, see database.MigrateRatelimits
+	MigrateRatelimits bool
+}
+
+type Kafka struct {
+	Brokers  []string
+	Username string
+	Password string
+	GroupId  string
+	// The schema version events are produced in, see kafka.LatestSchemaVersion
+	SchemaVersion int
+}
+
+type Ratelimit struct {
+	// Where consistent ratelimits are counted, RatelimitBackendNone does not enforce them
+	Backend  string
+	RedisUrl string
+}
+
+type Encryption struct {
+	// Optional, comma separated `<version>:<base64 key>` pairs, recoverable keys are disabled without them
+	Keys string
+	// The version new secrets are encrypted with, required if Keys is set
+	KeyVersion int
+}
+
+type Hashing struct {
+	// Optional, comma separated `<version>:<base64 pepper>` pairs, hashes of keys are not peppered without them
+	Peppers string
+	// The version new keys are peppered with, required if Peppers is set
+	PepperVersion int
+}
+
+// Tracing sends traces to axiom, it is disabled unless both are set
+type Tracing struct {
+	AxiomOrgId string
+	AxiomToken string
+}
+
+// Tinybird receives the key verifications for analytics, they are not recorded if the token is not set
+type Tinybird struct {
+	Token string
+}
+
+type Metrics struct {
+	// How many apis are counted on their own in the verifications by api, see metrics.SetMaxApiLabels
+	MaxApiLabels int
+}
+
+type Webhooks struct {
+	// How often a delivery is attempted before it is given up
+	MaxAttempts int
+	// The backoff before the first retry, it doubles with every attempt
+	InitialBackoff time.Duration
+}
+
+type Usage struct {
+	FlushInterval time.Duration
+	// Spreads the flushes of the nodes, 0 flushes exactly every FlushInterval
+	FlushJitter time.Duration
+}
+
+// Server are the settings of the api handlers. Zero values use the defaults of the server package,
+// unless their comment says otherwise.
+type Server struct {
+	// How many characters of the secret new keys reveal in their start, nil uses keys.DefaultStartChars
+	// and 0 only reveals the prefix
+	KeyStartChars   *int
+	MaxMetaBytes    int
+	MaxMetaDepth    int
+	MaxScopesPerKey int
+	MaxBodyBytes    int
+	RequestTimeout  time.Duration
+	// How fast a single root key can create keys, each setting defaults on its own
+	CreateKeyRatelimit CreateKeyRatelimit
+	IdempotencyTTL     time.Duration
+	// How far in the future keys may expire, 0 means unlimited
+	MaxKeyLifetime time.Duration
+	// Proxies whose forwarding headers are trusted, see ParseTrustedProxies
+	TrustedProxies []netip.Prefix
+	// Only enable it if every caller is trusted, see server.Config.DetailedVerifyErrors
+	DetailedVerifyErrors       bool
+	DeniedVerificationLogLevel zapcore.Level
+	ReservedKeyPrefixes        []string
+	MaxOwnerIdLength           int
+	// Optional, see ParseOwnerIdPattern
+	OwnerIdPattern *regexp.Regexp
+	// nil uses the default, 0 makes expiries exact
+	ClockSkewTolerance *time.Duration
+	// nil uses the default, 0 never sends reads to the primary after a create
+	ReadYourWritesWindow *time.Duration
+	Cors                 Cors
+}
+
+type CreateKeyRatelimit struct {
+	// A negative limit disables the ratelimit
+	Limit          int64
+	RefillRate     int64
+	RefillInterval time.Duration
+}
+
+type Cors struct {
+	// No origin is allowed unless it is listed, `*` allows every origin
+	AllowOrigins []string
+	AllowMethods []string
+	AllowHeaders []string
+	// 0 lets browsers decide how long they cache a preflight response
+	MaxAge time.Duration
+}
+
+// Unkey is the workspace and api our own root keys belong to
+type Unkey struct {
+	AppAuthToken string
+	WorkspaceId  string
+	ApiId        string
+	KeyAuthId    string
+}
+
+// Error lists every setting that is missing or invalid, so all of them can be fixed at once.
+// Settings are named by their environment variable.
+type Error struct {
+	Missing []string
+	Invalid []string
+}
+
+func (e *Error) Error() string {
+	problems := []string{}
+	if len(e.Missing) > 0 {
+		problems = append(problems, fmt.Sprintf("missing %s", strings.Join(e.Missing, ", ")))
+	}
+	if len(e.Invalid) > 0 {
+		problems = append(problems, fmt.Sprintf("invalid %s", strings.Join(e.Invalid, "; ")))
+	}
+	return fmt.Sprintf("invalid config: %s", strings.Join(problems, "; "))
+}
+
+func (e *Error) missing(name string) {
+	e.Missing = append(e.Missing, name)
+}
+
+func (e *Error) invalid(name string, err error) {
+	e.Invalid = append(e.Invalid, fmt.Sprintf("%s: %s", name, err.Error()))
+}
+
+func (e *Error) empty() bool {
+	return len(e.Missing) == 0 && len(e.Invalid) == 0
+}
+
+// Load reads the config from the environment and validates it.
+//
+// If path is not empty, it is read first. It must be a json object of environment variable names
+// to string values, variables that are set in the environment take precedence over the file.
+// The returned error is an *Error unless the file could not be read.
+func Load(path string) (Config, error) {
+	l := loader{
+		file:     map[string]string{},
+		problems: &Error{},
+	}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("unable to read config file: %w", err)
+		}
+		err = json.Unmarshal(b, &l.file)
+		if err != nil {
+			return Config{}, fmt.Errorf("unable to parse config file %s: %w", path, err)
+		}
+	}
+
+	redisUrl := l.string("REDIS_URL", "")
+	defaultRatelimitBackend := RatelimitBackendNone
+	if redisUrl != "" {
+		defaultRatelimitBackend = RatelimitBackendRedis
+	}
+
+	c := Config{
+		Port:     l.string("PORT", "8080"),
+		GrpcPort: l.string("GRPC_PORT", ""),
+		Region:   l.string("FLY_REGION", "local"),
+		Database: Database{
+			Primary:          l.string("DATABASE_DSN", ""),
+			ReplicaEu:        l.string("DATABASE_DSN_EU", ""),
+			ReplicaAsia:      l.string("DATABASE_DSN_ASIA", ""),
+			PlanetscaleBoost: l.bool("PLANETSCALE_BOOST", false),
+			StrictMeta:       l.bool("DATABASE_STRICT_META", false),
+			Pool: database.PoolConfig{
+				// 0 uses the defaults of the database package
+				MaxOpenConns:    l.int("DATABASE_MAX_OPEN_CONNS", 0),
+				MaxIdleConns:    l.int("DATABASE_MAX_IDLE_CONNS", 0),
+				ConnMaxLifetime: l.duration("DATABASE_CONN_MAX_LIFETIME", 0),
+			},
+		},
+		Kafka: Kafka{
+			Brokers:       l.strings("KAFKA_BROKER"),
+			Username:      l.string("KAFKA_USERNAME", ""),
+			Password:      l.string("KAFKA_PASSWORD", ""),
+			GroupId:       l.string("FLY_ALLOC_ID", "local"),
+			SchemaVersion: l.int("KAFKA_EVENT_SCHEMA_VERSION", kafka.LatestSchemaVersion),
+		},
+		Ratelimit: Ratelimit{
+			Backend:  l.string("RATELIMIT_BACKEND", defaultRatelimitBackend),
+			RedisUrl: redisUrl,
+		},
+		Encryption: Encryption{
+			Keys:       l.string("ENCRYPTION_KEYS", ""),
+			KeyVersion: l.int("ENCRYPTION_KEY_VERSION", 0),
+		},
+		Hashing: Hashing{
+			Peppers:       l.string("HASH_PEPPERS", ""),
+			PepperVersion: l.int("HASH_PEPPER_VERSION", 0),
+		},
+		Unkey: Unkey{
+			AppAuthToken: l.string("UNKEY_APP_AUTH_TOKEN", ""),
+			WorkspaceId:  l.string("UNKEY_WORKSPACE_ID", ""),
+			ApiId:        l.string("UNKEY_API_ID", ""),
+			KeyAuthId:    l.string("UNKEY_KEY_AUTH_ID", ""),
+		},
+		Ids: uid.Config{
+			ByteLength: l.int("ID_BYTE_LENGTH", uid.DefaultByteLength),
+			Prefixes:   l.idPrefixes("ID_PREFIXES"),
+		},
+		Tracing: Tracing{
+			AxiomOrgId: l.string("AXIOM_ORG_ID", ""),
+			AxiomToken: l.string("AXIOM_TOKEN", ""),
+		},
+		Tinybird: Tinybird{
+			Token: l.string("TINYBIRD_TOKEN", ""),
+		},
+		Metrics: Metrics{
+			MaxApiLabels: l.int("METRICS_MAX_API_LABELS", metrics.DefaultMaxApiLabels),
+		},
+		Webhooks: Webhooks{
+			MaxAttempts:    l.int("WEBHOOK_MAX_ATTEMPTS", webhooks.DefaultMaxAttempts),
+			InitialBackoff: l.duration("WEBHOOK_INITIAL_BACKOFF", webhooks.DefaultInitialBackoff),
+		},
+		Usage: Usage{
+			FlushInterval: l.duration("USAGE_FLUSH_INTERVAL", usage.DefaultFlushInterval),
+			FlushJitter:   l.duration("USAGE_FLUSH_JITTER", usage.DefaultFlushJitter),
+		},
+		Server: Server{
+			KeyStartChars:   l.optionalInt("KEY_START_CHARS"),
+			MaxMetaBytes:    l.int("MAX_META_BYTES", 0),
+			MaxMetaDepth:    l.int("MAX_META_DEPTH", 0),
+			MaxScopesPerKey: l.int("MAX_SCOPES_PER_KEY", 0),
+			MaxBodyBytes:    l.int("MAX_BODY_BYTES", 0),
+			RequestTimeout:  l.duration("REQUEST_TIMEOUT", 0),
+			CreateKeyRatelimit: CreateKeyRatelimit{
+				Limit:          int64(l.int("CREATE_KEY_RATELIMIT_LIMIT", 0)),
+				RefillRate:     int64(l.int("CREATE_KEY_RATELIMIT_REFILL_RATE", 0)),
+				RefillInterval: l.duration("CREATE_KEY_RATELIMIT_REFILL_INTERVAL", 0),
+			},
+			IdempotencyTTL:             l.duration("IDEMPOTENCY_TTL", 0),
+			MaxKeyLifetime:             l.duration("MAX_KEY_LIFETIME", 0),
+			TrustedProxies:             l.trustedProxies("TRUSTED_PROXIES"),
+			DetailedVerifyErrors:       l.bool("VERIFY_DETAILED_ERRORS", false),
+			DeniedVerificationLogLevel: l.logLevel("VERIFY_DENIED_LOG_LEVEL", zapcore.InfoLevel),
+			ReservedKeyPrefixes:        l.strings("RESERVED_KEY_PREFIXES"),
+			MaxOwnerIdLength:           l.int("OWNER_ID_MAX_LENGTH", 0),
+			OwnerIdPattern:             l.ownerIdPattern("OWNER_ID_PATTERN"),
+			ClockSkewTolerance:         l.optionalDuration("CLOCK_SKEW_TOLERANCE"),
+			ReadYourWritesWindow:       l.optionalDuration("READ_YOUR_WRITES_WINDOW"),
+			Cors: Cors{
+				AllowOrigins: l.strings("CORS_ALLOW_ORIGINS"),
+				AllowMethods: l.strings("CORS_ALLOW_METHODS"),
+				AllowHeaders: l.strings("CORS_ALLOW_HEADERS"),
+				MaxAge:       l.duration("CORS_MAX_AGE", 0),
+			},
+		},
+		ShutdownTimeout: l.duration("SHUTDOWN_TIMEOUT", 30*time.Second),
+	}
+	c.Database.SlowQueryThreshold = l.duration("DATABASE_SLOW_QUERY_THRESHOLD", databaseMiddleware.DefaultSlowQueryThreshold)
+	c.Database.MigrateRatelimits = l.bool("MIGRATE_RATELIMITS", false)
+
+	c.validate(l.problems)
+	if !l.problems.empty() {
+		return Config{}, l.problems
+	}
+	return c, nil
+}
+
+// Validate returns an *Error listing every required setting that is missing and every value that is invalid.
+func (c Config) Validate() error {
+	problems := &Error{}
+	c.validate(problems)
+	if !problems.empty() {
+		return problems
+	}
+	return nil
+}
+
+func (c Config) validate(problems *Error) {
+	validatePort(problems, "PORT", c.Port, true)
+	validatePort(problems, "GRPC_PORT", c.GrpcPort, false)
+
+	if c.Database.Primary == "" {
+		problems.missing("DATABASE_DSN")
+	}
+	err := c.Database.Pool.Validate()
+	if err != nil {
+		problems.invalid("DATABASE_MAX_OPEN_CONNS, DATABASE_MAX_IDLE_CONNS, DATABASE_CONN_MAX_LIFETIME", err)
+	}
+
+	if len(c.Kafka.Brokers) == 0 {
+		problems.missing("KAFKA_BROKER")
+	}
+	if c.Kafka.Username == "" {
+		problems.missing("KAFKA_USERNAME")
+	}
+	if c.Kafka.Password == "" {
+		problems.missing("KAFKA_PASSWORD")
+	}
+	// 0 uses the latest version
+	if c.Kafka.SchemaVersion < 0 || c.Kafka.SchemaVersion > kafka.LatestSchemaVersion {
+		problems.invalid("KAFKA_EVENT_SCHEMA_VERSION", fmt.Errorf("must be at most %d, got %d", kafka.LatestSchemaVersion, c.Kafka.SchemaVersion))
+	}
+
+	switch c.Ratelimit.Backend {
+	case RatelimitBackendNone:
+	case RatelimitBackendRedis:
+		if c.Ratelimit.RedisUrl == "" {
+			problems.missing("REDIS_URL")
+		}
+	default:
+		problems.invalid("RATELIMIT_BACKEND", fmt.Errorf("must be %q or %q, got %q", RatelimitBackendNone, RatelimitBackendRedis, c.Ratelimit.Backend))
+	}
+
+	if c.Encryption.Keys != "" {
+		if c.Encryption.KeyVersion == 0 {
+			problems.missing("ENCRYPTION_KEY_VERSION")
+		} else if _, err := c.Encryption.Keyring(); err != nil {
+			problems.invalid("ENCRYPTION_KEYS", err)
+		}
+	}
+
+	if c.Hashing.Peppers != "" {
+		if c.Hashing.PepperVersion == 0 {
+			problems.missing("HASH_PEPPER_VERSION")
+		} else if _, err := c.Hashing.Hasher(); err != nil {
+			problems.invalid("HASH_PEPPERS", err)
+		}
+	}
+
+	if c.Unkey.AppAuthToken == "" {
+		problems.missing("UNKEY_APP_AUTH_TOKEN")
+	}
+	if c.Unkey.WorkspaceId == "" {
+		problems.missing("UNKEY_WORKSPACE_ID")
+	}
+	if c.Unkey.ApiId == "" {
+		problems.missing("UNKEY_API_ID")
+	}
+	if c.Unkey.KeyAuthId == "" {
+		problems.missing("UNKEY_KEY_AUTH_ID")
+	}
+
+	err = c.Ids.Validate()
+	if err != nil {
+		problems.invalid("ID_BYTE_LENGTH, ID_PREFIXES", err)
+	}
+
+	// a tracer needs both, one of them alone is most likely a typo
+	if c.Tracing.AxiomOrgId != "" && c.Tracing.AxiomToken == "" {
+		problems.missing("AXIOM_TOKEN")
+	}
+	if c.Tracing.AxiomToken != "" && c.Tracing.AxiomOrgId == "" {
+		problems.missing("AXIOM_ORG_ID")
+	}
+
+	if n := c.Server.KeyStartChars; n != nil && (*n < 0 || *n > keys.MaxStartChars) {
+		problems.invalid("KEY_START_CHARS", fmt.Errorf("must be between 0 and %d, got %d", keys.MaxStartChars, *n))
+	}
+
+	validateNotNegative(problems, "DATABASE_SLOW_QUERY_THRESHOLD", int64(c.Database.SlowQueryThreshold))
+	validateNotNegative(problems, "METRICS_MAX_API_LABELS", int64(c.Metrics.MaxApiLabels))
+	validateNotNegative(problems, "WEBHOOK_MAX_ATTEMPTS", int64(c.Webhooks.MaxAttempts))
+	validateNotNegative(problems, "WEBHOOK_INITIAL_BACKOFF", int64(c.Webhooks.InitialBackoff))
+	validateNotNegative(problems, "USAGE_FLUSH_INTERVAL", int64(c.Usage.FlushInterval))
+	validateNotNegative(problems, "USAGE_FLUSH_JITTER", int64(c.Usage.FlushJitter))
+	validateNotNegative(problems, "MAX_META_BYTES", int64(c.Server.MaxMetaBytes))
+	validateNotNegative(problems, "MAX_META_DEPTH", int64(c.Server.MaxMetaDepth))
+	validateNotNegative(problems, "MAX_SCOPES_PER_KEY", int64(c.Server.MaxScopesPerKey))
+	validateNotNegative(problems, "MAX_BODY_BYTES", int64(c.Server.MaxBodyBytes))
+	validateNotNegative(problems, "REQUEST_TIMEOUT", int64(c.Server.RequestTimeout))
+	validateNotNegative(problems, "CREATE_KEY_RATELIMIT_REFILL_RATE", c.Server.CreateKeyRatelimit.RefillRate)
+	validateNotNegative(problems, "CREATE_KEY_RATELIMIT_REFILL_INTERVAL", int64(c.Server.CreateKeyRatelimit.RefillInterval))
+	validateNotNegative(problems, "IDEMPOTENCY_TTL", int64(c.Server.IdempotencyTTL))
+	validateNotNegative(problems, "MAX_KEY_LIFETIME", int64(c.Server.MaxKeyLifetime))
+	validateNotNegative(problems, "OWNER_ID_MAX_LENGTH", int64(c.Server.MaxOwnerIdLength))
+	if c.Server.ClockSkewTolerance != nil {
+		validateNotNegative(problems, "CLOCK_SKEW_TOLERANCE", int64(*c.Server.ClockSkewTolerance))
+	}
+	if c.Server.ReadYourWritesWindow != nil {
+		validateNotNegative(problems, "READ_YOUR_WRITES_WINDOW", int64(*c.Server.ReadYourWritesWindow))
+	}
+	validateNotNegative(problems, "CORS_MAX_AGE", int64(c.Server.Cors.MaxAge))
+	validateNotNegative(problems, "SHUTDOWN_TIMEOUT", int64(c.ShutdownTimeout))
+}
+
+func validateNotNegative(problems *Error, name string, value int64) {
+	if value < 0 {
+		problems.invalid(name, fmt.Errorf("must not be negative"))
+	}
+}
+
+func validatePort(problems *Error, name string, port string, required bool) {
+	if port == "" {
+		if required {
+			problems.missing(name)
+		}
+		return
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 1 || p > 65535 {
+		problems.invalid(name, fmt.Errorf("must be a port between 1 and 65535, got %q", port))
+	}
+}
+
+// ParseTrustedProxies parses a list of CIDRs, single addresses are treated as a prefix of their full length.
+func ParseTrustedProxies(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// ParseOwnerIdPattern compiles the pattern owner ids must match, it is anchored so the whole id has to match.
+// An empty pattern allows every owner id.
+func ParseOwnerIdPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", pattern))
+	if err != nil {
+		return nil, fmt.Errorf("invalid owner id pattern %q: %w", pattern, err)
+	}
+	return re, nil
+}
+
+// Keyring builds the keyring for recoverable keys, it is nil if no keys are configured.
+func (c Encryption) Keyring() (*encryption.Keyring, error) {
+	if c.Keys == "" {
+		return nil, nil
+	}
+	keys, err := encryption.ParseKeys(c.Keys)
+	if err != nil {
+		return nil, err
+	}
+	return encryption.NewKeyring(keys, c.KeyVersion)
+}
+
+// Hasher builds the hasher for the hashes of keys, it is nil if no peppers are configured.
+func (c Hashing) Hasher() (*hash.Hasher, error) {
+	if c.Peppers == "" {
+		return nil, nil
+	}
+	peppers, err := hash.ParsePeppers(c.Peppers)
+	if err != nil {
+		return nil, err
+	}
+	return hash.NewHasher(peppers, c.PepperVersion)
+}
+
+// loader looks up settings in the environment and then in the config file.
+// Values that can not be parsed are collected in problems and the fallback is used.
+type loader struct {
+	file     map[string]string
+	problems *Error
+}
+
+func (l *loader) lookup(name string) (string, bool) {
+	if value := os.Getenv(name); value != "" {
+		return value, true
+	}
+	value, ok := l.file[name]
+	return value, ok && value != ""
+}
+
+func (l *loader) string(name string, fallback string) string {
+	if value, ok := l.lookup(name); ok {
+		return value
+	}
+	return fallback
+}
+
+// strings parses a comma separated list, empty entries are dropped
+func (l *loader) strings(name string) []string {
+	value, ok := l.lookup(name)
+	if !ok {
+		return nil
+	}
+	list := []string{}
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+func (l *loader) int(name string, fallback int) int {
+	value, ok := l.lookup(name)
+	if !ok {
+		return fallback
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		l.problems.invalid(name, fmt.Errorf("must be an integer, got %q", value))
+		return fallback
+	}
+	return i
+}
+
+func (l *loader) bool(name string, fallback bool) bool {
+	value, ok := l.lookup(name)
+	if !ok {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		l.problems.invalid(name, fmt.Errorf("must be a boolean, got %q", value))
+		return fallback
+	}
+	return b
+}
+
+// optionalInt is nil if the setting is not set, so a default can be told apart from 0
+func (l *loader) optionalInt(name string) *int {
+	if _, ok := l.lookup(name); !ok {
+		return nil
+	}
+	n := l.int(name, 0)
+	return &n
+}
+
+// optionalDuration is nil if the setting is not set, so a default can be told apart from 0
+func (l *loader) optionalDuration(name string) *time.Duration {
+	if _, ok := l.lookup(name); !ok {
+		return nil
+	}
+	d := l.duration(name, 0)
+	return &d
+}
+
+func (l *loader) idPrefixes(name string) map[uid.Prefix]string {
+	prefixes, err := uid.ParsePrefixes(l.strings(name))
+	if err != nil {
+		l.problems.invalid(name, err)
+		return nil
+	}
+	return prefixes
+}
+
+func (l *loader) trustedProxies(name string) []netip.Prefix {
+	prefixes, err := ParseTrustedProxies(l.strings(name))
+	if err != nil {
+		l.problems.invalid(name, err)
+		return nil
+	}
+	return prefixes
+}
+
+func (l *loader) ownerIdPattern(name string) *regexp.Regexp {
+	re, err := ParseOwnerIdPattern(l.string(name, ""))
+	if err != nil {
+		l.problems.invalid(name, err)
+		return nil
+	}
+	return re
+}
+
+func (l *loader) logLevel(name string, fallback zapcore.Level) zapcore.Level {
+	value, ok := l.lookup(name)
+	if !ok {
+		return fallback
+	}
+	level, err := zapcore.ParseLevel(value)
+	if err != nil {
+		l.problems.invalid(name, fmt.Errorf("must be a log level like info, got %q", value))
+		return fallback
+	}
+	return level
+}
+
+func (l *loader) duration(name string, fallback time.Duration) time.Duration {
+	value, ok := l.lookup(name)
+	if !ok {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		l.problems.invalid(name, fmt.Errorf("must be a duration like 5m, got %q", value))
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,309 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	databaseMiddleware "github.com/unkeyed/unkey/apps/api/pkg/database/middleware"
+	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
+	"github.com/unkeyed/unkey/apps/api/pkg/metrics"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+	"github.com/unkeyed/unkey/apps/api/pkg/usage"
+	"github.com/unkeyed/unkey/apps/api/pkg/webhooks"
+	"go.uber.org/zap/zapcore"
+)
+
+var allVariables = []string{
+	"PORT", "GRPC_PORT", "FLY_REGION",
+	"DATABASE_DSN", "DATABASE_DSN_EU", "DATABASE_DSN_ASIA", "PLANETSCALE_BOOST",
+	"DATABASE_MAX_OPEN_CONNS", "DATABASE_MAX_IDLE_CONNS", "DATABASE_CONN_MAX_LIFETIME", "DATABASE_STRICT_META",
+	"KAFKA_BROKER", "KAFKA_USERNAME", "KAFKA_PASSWORD", "FLY_ALLOC_ID", "KAFKA_EVENT_SCHEMA_VERSION",
+	"RATELIMIT_BACKEND", "REDIS_URL",
+	"ENCRYPTION_KEYS", "ENCRYPTION_KEY_VERSION",
+	"HASH_PEPPERS", "HASH_PEPPER_VERSION",
+	"UNKEY_APP_AUTH_TOKEN", "UNKEY_WORKSPACE_ID", "UNKEY_API_ID", "UNKEY_KEY_AUTH_ID",
+	"ID_PREFIXES", "ID_BYTE_LENGTH", "AXIOM_ORG_ID", "AXIOM_TOKEN", "TINYBIRD_TOKEN",
+	"METRICS_MAX_API_LABELS", "DATABASE_SLOW_QUERY_THRESHOLD", "MIGRATE_RATELIMITS",
+	"WEBHOOK_MAX_ATTEMPTS", "WEBHOOK_INITIAL_BACKOFF", "USAGE_FLUSH_INTERVAL", "USAGE_FLUSH_JITTER",
+	"KEY_START_CHARS", "MAX_META_BYTES", "MAX_META_DEPTH", "MAX_SCOPES_PER_KEY", "MAX_BODY_BYTES", "REQUEST_TIMEOUT",
+	"CREATE_KEY_RATELIMIT_LIMIT", "CREATE_KEY_RATELIMIT_REFILL_RATE", "CREATE_KEY_RATELIMIT_REFILL_INTERVAL",
+	"IDEMPOTENCY_TTL", "MAX_KEY_LIFETIME", "TRUSTED_PROXIES", "VERIFY_DETAILED_ERRORS", "VERIFY_DENIED_LOG_LEVEL",
+	"RESERVED_KEY_PREFIXES", "OWNER_ID_MAX_LENGTH", "OWNER_ID_PATTERN", "CLOCK_SKEW_TOLERANCE", "READ_YOUR_WRITES_WINDOW",
+	"CORS_ALLOW_ORIGINS", "CORS_ALLOW_METHODS", "CORS_ALLOW_HEADERS", "CORS_MAX_AGE",
+	"SHUTDOWN_TIMEOUT",
+}
+
+// setEnv clears every variable the config reads and sets the given ones
+func setEnv(t *testing.T, vars map[string]string) {
+	for _, name := range allVariables {
+		t.Setenv(name, vars[name])
+	}
+}
+
+func required() map[string]string {
+	return map[string]string{
+		"DATABASE_DSN":         "user:pass@tcp(localhost:3306)/unkey",
+		"KAFKA_BROKER":         "kafka-1:9092, kafka-2:9092",
+		"KAFKA_USERNAME":       "user",
+		"KAFKA_PASSWORD":       "pass",
+		"UNKEY_APP_AUTH_TOKEN": "token",
+		"UNKEY_WORKSPACE_ID":   "ws_1",
+		"UNKEY_API_ID":         "api_1",
+		"UNKEY_KEY_AUTH_ID":    "key_auth_1",
+	}
+}
+
+func requireConfigError(t *testing.T, err error) *Error {
+	t.Helper()
+	var configErr *Error
+	require.True(t, errors.As(err, &configErr), "expected *Error, got %v", err)
+	return configErr
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	setEnv(t, required())
+
+	c, err := Load("")
+	require.NoError(t, err)
+	require.Equal(t, "8080", c.Port)
+	require.Equal(t, "", c.GrpcPort)
+	require.Equal(t, "local", c.Region)
+	require.Equal(t, []string{"kafka-1:9092", "kafka-2:9092"}, c.Kafka.Brokers)
+	require.Equal(t, "local", c.Kafka.GroupId)
+	require.Equal(t, kafka.LatestSchemaVersion, c.Kafka.SchemaVersion)
+	require.Equal(t, RatelimitBackendNone, c.Ratelimit.Backend)
+
+	keyring, err := c.Encryption.Keyring()
+	require.NoError(t, err)
+	require.Nil(t, keyring)
+
+	hasher, err := c.Hashing.Hasher()
+	require.NoError(t, err)
+	require.Nil(t, hasher)
+
+	require.Equal(t, uid.DefaultByteLength, c.Ids.ByteLength)
+	require.Equal(t, metrics.DefaultMaxApiLabels, c.Metrics.MaxApiLabels)
+	require.Equal(t, databaseMiddleware.DefaultSlowQueryThreshold, c.Database.SlowQueryThreshold)
+	require.False(t, c.Database.MigrateRatelimits)
+	require.Equal(t, webhooks.DefaultMaxAttempts, c.Webhooks.MaxAttempts)
+	require.Equal(t, usage.DefaultFlushJitter, c.Usage.FlushJitter)
+	require.Equal(t, 30*time.Second, c.ShutdownTimeout)
+	require.Equal(t, zapcore.InfoLevel, c.Server.DeniedVerificationLogLevel)
+	// left to the defaults of the server
+	require.Nil(t, c.Server.KeyStartChars)
+	require.Nil(t, c.Server.ClockSkewTolerance)
+	require.Nil(t, c.Server.ReadYourWritesWindow)
+	require.Nil(t, c.Server.OwnerIdPattern)
+	require.Empty(t, c.Server.TrustedProxies)
+	require.Zero(t, c.Server.MaxMetaBytes)
+}
+
+func TestLoad_ServerSettings(t *testing.T) {
+	vars := required()
+	vars["ID_PREFIXES"] = "key=k"
+	vars["KEY_START_CHARS"] = "0"
+	vars["CLOCK_SKEW_TOLERANCE"] = "0s"
+	vars["TRUSTED_PROXIES"] = "10.0.0.0/8, 192.168.1.1"
+	vars["OWNER_ID_PATTERN"] = "user_[0-9]+"
+	vars["VERIFY_DENIED_LOG_LEVEL"] = "debug"
+	vars["CORS_ALLOW_ORIGINS"] = "https://app.unkey.dev"
+	vars["CREATE_KEY_RATELIMIT_LIMIT"] = "-1"
+	setEnv(t, vars)
+
+	c, err := Load("")
+	require.NoError(t, err)
+	require.Equal(t, map[uid.Prefix]string{uid.KeyPrefix: "k"}, c.Ids.Prefixes)
+	// set to 0 instead of unset
+	require.NotNil(t, c.Server.KeyStartChars)
+	require.Equal(t, 0, *c.Server.KeyStartChars)
+	require.NotNil(t, c.Server.ClockSkewTolerance)
+	require.Equal(t, time.Duration(0), *c.Server.ClockSkewTolerance)
+	require.Len(t, c.Server.TrustedProxies, 2)
+	require.True(t, c.Server.OwnerIdPattern.MatchString("user_1"))
+	require.False(t, c.Server.OwnerIdPattern.MatchString("admin_user_1"))
+	require.Equal(t, zapcore.DebugLevel, c.Server.DeniedVerificationLogLevel)
+	require.Equal(t, []string{"https://app.unkey.dev"}, c.Server.Cors.AllowOrigins)
+	require.Equal(t, int64(-1), c.Server.CreateKeyRatelimit.Limit)
+}
+
+func TestLoad_InvalidServerValues(t *testing.T) {
+	vars := required()
+	vars["ID_PREFIXES"] = "unknown=u"
+	vars["KEY_START_CHARS"] = "9"
+	vars["TRUSTED_PROXIES"] = "not-an-ip"
+	vars["OWNER_ID_PATTERN"] = "[a-z"
+	vars["VERIFY_DENIED_LOG_LEVEL"] = "loud"
+	vars["MAX_META_BYTES"] = "-1"
+	vars["READ_YOUR_WRITES_WINDOW"] = "-1s"
+	vars["SHUTDOWN_TIMEOUT"] = "soon"
+	setEnv(t, vars)
+
+	_, err := Load("")
+	configErr := requireConfigError(t, err)
+	require.Empty(t, configErr.Missing)
+	require.Len(t, configErr.Invalid, 8)
+	for _, name := range []string{"ID_PREFIXES", "KEY_START_CHARS", "TRUSTED_PROXIES", "OWNER_ID_PATTERN", "VERIFY_DENIED_LOG_LEVEL", "MAX_META_BYTES", "READ_YOUR_WRITES_WINDOW", "SHUTDOWN_TIMEOUT"} {
+		require.Contains(t, err.Error(), name)
+	}
+
+	// prefixes that parse can still be rejected by uid
+	vars = required()
+	vars["ID_PREFIXES"] = "key=Key"
+	vars["ID_BYTE_LENGTH"] = "4"
+	setEnv(t, vars)
+	_, err = Load("")
+	configErr = requireConfigError(t, err)
+	require.Equal(t, []string{"ID_BYTE_LENGTH, ID_PREFIXES: ids need at least 12 random bytes, got 4"}, configErr.Invalid)
+}
+
+func TestLoad_AxiomTogether(t *testing.T) {
+	vars := required()
+	vars["AXIOM_TOKEN"] = "token"
+	setEnv(t, vars)
+
+	_, err := Load("")
+	configErr := requireConfigError(t, err)
+	require.Equal(t, []string{"AXIOM_ORG_ID"}, configErr.Missing)
+}
+
+func TestLoad_MissingRequired(t *testing.T) {
+	setEnv(t, map[string]string{})
+
+	_, err := Load("")
+	configErr := requireConfigError(t, err)
+	require.Equal(t, []string{
+		"DATABASE_DSN",
+		"KAFKA_BROKER",
+		"KAFKA_USERNAME",
+		"KAFKA_PASSWORD",
+		"UNKEY_APP_AUTH_TOKEN",
+		"UNKEY_WORKSPACE_ID",
+		"UNKEY_API_ID",
+		"UNKEY_KEY_AUTH_ID",
+	}, configErr.Missing)
+	require.Empty(t, configErr.Invalid)
+	require.Contains(t, err.Error(), "missing DATABASE_DSN, KAFKA_BROKER")
+}
+
+func TestLoad_RequiredTogether(t *testing.T) {
+	vars := required()
+	vars["RATELIMIT_BACKEND"] = "redis"
+	vars["ENCRYPTION_KEYS"] = "1:" + base64.StdEncoding.EncodeToString(make([]byte, 32))
+	vars["HASH_PEPPERS"] = "1:" + base64.StdEncoding.EncodeToString(make([]byte, 32))
+	setEnv(t, vars)
+
+	_, err := Load("")
+	configErr := requireConfigError(t, err)
+	require.Equal(t, []string{"REDIS_URL", "ENCRYPTION_KEY_VERSION", "HASH_PEPPER_VERSION"}, configErr.Missing)
+}
+
+func TestLoad_Peppers(t *testing.T) {
+	vars := required()
+	vars["HASH_PEPPERS"] = "1:" + base64.StdEncoding.EncodeToString(make([]byte, 32))
+	vars["HASH_PEPPER_VERSION"] = "1"
+	setEnv(t, vars)
+
+	c, err := Load("")
+	require.NoError(t, err)
+	hasher, err := c.Hashing.Hasher()
+	require.NoError(t, err)
+	require.NotNil(t, hasher)
+
+	// too short to be a pepper
+	vars["HASH_PEPPERS"] = "1:" + base64.StdEncoding.EncodeToString(make([]byte, 8))
+	setEnv(t, vars)
+	_, err = Load("")
+	configErr := requireConfigError(t, err)
+	require.Len(t, configErr.Invalid, 1)
+	require.Contains(t, err.Error(), "HASH_PEPPERS")
+}
+
+func TestLoad_InvalidValues(t *testing.T) {
+	vars := required()
+	vars["PORT"] = "http"
+	vars["GRPC_PORT"] = "70000"
+	vars["PLANETSCALE_BOOST"] = "maybe"
+	vars["DATABASE_MAX_OPEN_CONNS"] = "ten"
+	vars["DATABASE_MAX_IDLE_CONNS"] = "-1"
+	vars["DATABASE_CONN_MAX_LIFETIME"] = "5"
+	vars["KAFKA_EVENT_SCHEMA_VERSION"] = "99"
+	vars["RATELIMIT_BACKEND"] = "memcached"
+	vars["ENCRYPTION_KEYS"] = "1:not-base64"
+	vars["ENCRYPTION_KEY_VERSION"] = "1"
+	setEnv(t, vars)
+
+	_, err := Load("")
+	configErr := requireConfigError(t, err)
+	require.Empty(t, configErr.Missing)
+	require.Len(t, configErr.Invalid, 9)
+	for _, name := range []string{"PORT", "GRPC_PORT", "PLANETSCALE_BOOST", "DATABASE_MAX_OPEN_CONNS", "DATABASE_CONN_MAX_LIFETIME", "KAFKA_EVENT_SCHEMA_VERSION", "RATELIMIT_BACKEND", "ENCRYPTION_KEYS"} {
+		require.Contains(t, err.Error(), name)
+	}
+	require.Contains(t, err.Error(), "max idle connections must not be negative")
+}
+
+func TestLoad_RedisUrlSelectsRedis(t *testing.T) {
+	vars := required()
+	vars["REDIS_URL"] = "redis://localhost:6379"
+	setEnv(t, vars)
+
+	c, err := Load("")
+	require.NoError(t, err)
+	require.Equal(t, RatelimitBackendRedis, c.Ratelimit.Backend)
+}
+
+func TestLoad_File(t *testing.T) {
+	vars := required()
+	delete(vars, "DATABASE_DSN")
+	vars["PORT"] = "9000"
+	setEnv(t, vars)
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(`{
+		"DATABASE_DSN": "from-file",
+		"PORT": "7000",
+		"DATABASE_CONN_MAX_LIFETIME": "1m",
+		"TRUSTED_PROXIES": "10.0.0.0/8",
+		"SHUTDOWN_TIMEOUT": "10s"
+	}`), 0o600)
+	require.NoError(t, err)
+
+	c, err := Load(path)
+	require.NoError(t, err)
+	require.Equal(t, "from-file", c.Database.Primary)
+	// the environment takes precedence
+	require.Equal(t, "9000", c.Port)
+	require.Equal(t, time.Minute, c.Database.Pool.ConnMaxLifetime)
+	require.Equal(t, "10.0.0.0/8", c.Server.TrustedProxies[0].String())
+	require.Equal(t, 10*time.Second, c.ShutdownTimeout)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.json"))
+	require.Error(t, err)
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	prefixes, err := ParseTrustedProxies([]string{"10.0.0.0/8", " 192.168.1.1 ", "", "fdaa::/16", "10.1.2.3/8"})
+	require.NoError(t, err)
+	require.Len(t, prefixes, 4)
+	require.Equal(t, "192.168.1.1/32", prefixes[1].String())
+	require.Equal(t, "10.0.0.0/8", prefixes[3].String())
+
+	_, err = ParseTrustedProxies([]string{"not-an-ip"})
+	require.Error(t, err)
+	_, err = ParseTrustedProxies([]string{"10.0.0.0/33"})
+	require.Error(t, err)
+}
+
+func TestParseOwnerIdPattern(t *testing.T) {
+	re, err := ParseOwnerIdPattern("")
+	require.NoError(t, err)
+	require.Nil(t, re)
+
+	_, err = ParseOwnerIdPattern("[a-z")
+	require.Error(t, err)
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+// CreateApiWithKeyAuth inserts the keyAuth and the api that uses it in one transaction,
+// so an api is never left without the keyAuth it points to.
+func (db *database) CreateApiWithKeyAuth(ctx context.Context, newApi entities.Api, newKeyAuth entities.KeyAuth) error {
+	if newApi.KeyAuthId != newKeyAuth.Id {
+		return fmt.Errorf("api %s does not reference keyAuth %s", newApi.Id, newKeyAuth.Id)
+	}
+	if newApi.WorkspaceId != newKeyAuth.WorkspaceId {
+		return fmt.Errorf("api %s and keyAuth %s belong to different workspaces", newApi.Id, newKeyAuth.Id)
+	}
+
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %w", err)
+	}
+	// a no-op after commit
+	defer func() { _ = tx.Rollback() }()
+
+	err = keyAuthEntityToModel(newKeyAuth).Insert(ctx, tx)
+	if err != nil {
+		return fmt.Errorf("unable to insert keyAuth, %w", err)
+	}
+	err = apiEntityToModel(newApi).Insert(ctx, tx)
+	if err != nil {
+		return fmt.Errorf("unable to insert api, %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("unable to commit transaction: %w", err)
+	}
+	return nil
+}
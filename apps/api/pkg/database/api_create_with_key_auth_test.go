@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+func TestCreateApiWithKeyAuth(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(t, err)
+
+	workspaceId := uid.Workspace()
+	keyAuth := entities.KeyAuth{Id: uid.KeyAuth(), WorkspaceId: workspaceId}
+	api := entities.Api{
+		Id:          uid.Api(),
+		Name:        "test",
+		WorkspaceId: workspaceId,
+		AuthType:    entities.AuthTypeKey,
+		KeyAuthId:   keyAuth.Id,
+	}
+
+	err = db.CreateApiWithKeyAuth(ctx, api, keyAuth)
+	require.NoError(t, err)
+
+	found, err := db.GetApiByKeyAuthId(ctx, keyAuth.Id)
+	require.NoError(t, err)
+	require.Equal(t, api.Id, found.Id)
+
+	// the api id is taken, so the new keyAuth must be rolled back
+	orphan := entities.KeyAuth{Id: uid.KeyAuth(), WorkspaceId: workspaceId}
+	api.KeyAuthId = orphan.Id
+	err = db.CreateApiWithKeyAuth(ctx, api, orphan)
+	require.Error(t, err)
+
+	_, err = db.GetKeyAuth(ctx, orphan.Id)
+	require.ErrorIs(t, err, ErrNotFound)
+}
@@ -11,7 +11,7 @@ import (
 
 func (db *database) GetApi(ctx context.Context, apiId string) (entities.Api, error) {
 
-	api, err := models.APIByID(ctx, db.read(), apiId)
+	api, err := models.APIByID(ctx, db.read(ctx), apiId)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return entities.Api{}, ErrNotFound
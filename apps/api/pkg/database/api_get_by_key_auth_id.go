@@ -11,7 +11,7 @@ import (
 
 func (db *database) GetApiByKeyAuthId(ctx context.Context, keyAuthId string) (entities.Api, error) {
 
-	api, err := models.APIByKeyAuthID(ctx, db.read(), sql.NullString{String: keyAuthId, Valid: true})
+	api, err := models.APIByKeyAuthID(ctx, db.read(ctx), sql.NullString{String: keyAuthId, Valid: true})
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return entities.Api{}, ErrNotFound
@@ -0,0 +1,20 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// SetApiAllowedMetaKeys stores the top level keys the meta of the api's keys may have, no keys remove the restriction.
+// The keys are stored as is, they must be validated by the caller.
+func (db *database) SetApiAllowedMetaKeys(ctx context.Context, apiId string, keys []string) error {
+	allowedMetaKeys := sql.NullString{String: strings.Join(keys, ","), Valid: len(keys) > 0}
+
+	_, err := db.write().ExecContext(ctx, `UPDATE unkey.apis SET allowed_meta_keys = ? WHERE id = ?`, allowedMetaKeys, apiId)
+	if err != nil {
+		return fmt.Errorf("unable to set allowed meta keys of api %s: %w", apiId, err)
+	}
+	return nil
+}
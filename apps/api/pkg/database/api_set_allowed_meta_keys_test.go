@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+func TestSetApiAllowedMetaKeys(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(t, err)
+
+	api := entities.Api{
+		Id:              uid.Api(),
+		Name:            "test",
+		WorkspaceId:     uid.Workspace(),
+		AllowedMetaKeys: []string{"plan"},
+	}
+	require.NoError(t, db.CreateApi(ctx, api))
+
+	found, err := db.GetApi(ctx, api.Id)
+	require.NoError(t, err)
+	require.Equal(t, api.AllowedMetaKeys, found.AllowedMetaKeys)
+
+	require.NoError(t, db.SetApiAllowedMetaKeys(ctx, api.Id, []string{"plan", "seats"}))
+	found, err = db.GetApi(ctx, api.Id)
+	require.NoError(t, err)
+	require.Equal(t, []string{"plan", "seats"}, found.AllowedMetaKeys)
+
+	require.NoError(t, db.SetApiAllowedMetaKeys(ctx, api.Id, nil))
+	found, err = db.GetApi(ctx, api.Id)
+	require.NoError(t, err)
+	require.Empty(t, found.AllowedMetaKeys)
+}
@@ -0,0 +1,19 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// SetApiMetaSchema stores the JSON Schema the meta of the api's keys must match, an empty schema removes it.
+// The schema is stored as is, it must be validated by the caller.
+func (db *database) SetApiMetaSchema(ctx context.Context, apiId string, schema string) error {
+	metaSchema := sql.NullString{String: schema, Valid: schema != ""}
+
+	_, err := db.write().ExecContext(ctx, `UPDATE unkey.apis SET meta_schema = ? WHERE id = ?`, metaSchema, apiId)
+	if err != nil {
+		return fmt.Errorf("unable to set meta schema of api %s: %w", apiId, err)
+	}
+	return nil
+}
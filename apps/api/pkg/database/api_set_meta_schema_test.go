@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+func TestSetApiMetaSchema(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(t, err)
+
+	api := entities.Api{
+		Id:          uid.Api(),
+		Name:        "test",
+		WorkspaceId: uid.Workspace(),
+		MetaSchema:  `{"type":"object"}`,
+	}
+	require.NoError(t, db.CreateApi(ctx, api))
+
+	found, err := db.GetApi(ctx, api.Id)
+	require.NoError(t, err)
+	require.Equal(t, api.MetaSchema, found.MetaSchema)
+
+	schema := `{"type":"object","required":["plan"]}`
+	require.NoError(t, db.SetApiMetaSchema(ctx, api.Id, schema))
+	found, err = db.GetApi(ctx, api.Id)
+	require.NoError(t, err)
+	require.JSONEq(t, schema, found.MetaSchema)
+
+	require.NoError(t, db.SetApiMetaSchema(ctx, api.Id, ""))
+	found, err = db.GetApi(ctx, api.Id)
+	require.NoError(t, err)
+	require.Equal(t, "", found.MetaSchema)
+}
@@ -0,0 +1,19 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+func (db *database) CountApisByWorkspace(ctx context.Context, workspaceId string) (int, error) {
+
+	const query = "SELECT count(*) FROM unkey.apis WHERE workspace_id = ?"
+	row := db.read(ctx).QueryRowContext(ctx, query, workspaceId)
+
+	count := 0
+	err := row.Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("unable to count apis of workspace: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,33 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
+)
+
+// AppendAuditLog stores a new entry, entries are never updated or deleted
+func (db *database) AppendAuditLog(ctx context.Context, entry audit.Entry) error {
+	const query = `INSERT INTO unkey.audit_logs (` +
+		`id, workspace_id, actor_key_id, action, target_key_id, time, ip, reason` +
+		`) VALUES (` +
+		`?, ?, ?, ?, ?, ?, ?, ?` +
+		`)`
+
+	_, err := db.write().ExecContext(ctx, query,
+		entry.Id,
+		entry.WorkspaceId,
+		sql.NullString{String: entry.ActorKeyId, Valid: entry.ActorKeyId != ""},
+		string(entry.Action),
+		sql.NullString{String: entry.TargetKeyId, Valid: entry.TargetKeyId != ""},
+		entry.Time,
+		sql.NullString{String: entry.Ip, Valid: entry.Ip != ""},
+		sql.NullString{String: entry.Reason, Valid: entry.Reason != ""},
+	)
+	if err != nil {
+		return fmt.Errorf("unable to append audit log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
+)
+
+// ListAuditLogs returns the entries of a workspace matching the filter, newest first.
+func (db *database) ListAuditLogs(ctx context.Context, workspaceId string, filter audit.Filter) ([]audit.Entry, error) {
+	query := `SELECT ` +
+		`id, workspace_id, actor_key_id, action, target_key_id, time, ip, reason ` +
+		`FROM unkey.audit_logs ` +
+		`WHERE workspace_id = ?`
+	args := []any{workspaceId}
+
+	if !filter.Start.IsZero() {
+		query += " AND time >= ?"
+		args = append(args, filter.Start)
+	}
+	if !filter.End.IsZero() {
+		query += " AND time < ?"
+		args = append(args, filter.End)
+	}
+	if len(filter.Actions) > 0 {
+		query += fmt.Sprintf(" AND action IN (%s)", strings.TrimSuffix(strings.Repeat("?,", len(filter.Actions)), ","))
+		for _, action := range filter.Actions {
+			args = append(args, string(action))
+		}
+	}
+	query += " ORDER BY time DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := db.read(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list audit logs: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []audit.Entry{}
+	for rows.Next() {
+		var (
+			e                                   audit.Entry
+			action                              string
+			actorKeyId, targetKeyId, ip, reason sql.NullString
+		)
+		err := rows.Scan(&e.Id, &e.WorkspaceId, &actorKeyId, &action, &targetKeyId, &e.Time, &ip, &reason)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+		e.Action = audit.Action(action)
+		e.ActorKeyId = actorKeyId.String
+		e.TargetKeyId = targetKeyId.String
+		e.Ip = ip.String
+		e.Reason = reason.String
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to list audit logs: %w", err)
+	}
+	return entries, nil
+}
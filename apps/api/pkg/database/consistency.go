@@ -0,0 +1,20 @@
+package database
+
+import "context"
+
+type readPrimaryKey struct{}
+
+// WithPrimary returns a context whose reads go to the primary instead of the read replica.
+//
+// Replicas lag behind the primary, so a client that just created a key might not find it
+// when it lists or gets its keys right after, from the replica of its region. Reads of such
+// a client are sent to the primary for a short while, the server decides for how long.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readPrimaryKey{}, true)
+}
+
+// ReadsPrimary reports whether reads with this context go to the primary, see WithPrimary
+func ReadsPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(readPrimaryKey{}).(bool)
+	return primary
+}
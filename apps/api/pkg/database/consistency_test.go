@@ -0,0 +1,30 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRead_WithPrimary(t *testing.T) {
+	// opening does not connect, the handles are only compared
+	primary, err := sql.Open("mysql", "user:pass@tcp(primary:3306)/unkey")
+	require.NoError(t, err)
+	replica, err := sql.Open("mysql", "user:pass@tcp(replica:3306)/unkey")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	db := &database{primary: primary}
+	require.Same(t, primary, db.read(ctx))
+
+	db.readReplica = replica
+	require.Same(t, replica, db.read(ctx))
+	require.False(t, ReadsPrimary(ctx))
+
+	ctx = WithPrimary(ctx)
+	require.True(t, ReadsPrimary(ctx))
+	require.Same(t, primary, db.read(ctx))
+	require.Same(t, primary, db.write())
+}
@@ -3,13 +3,32 @@ package database
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/unkeyed/unkey/apps/api/pkg/database/models"
 	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"go.uber.org/zap"
 )
 
+var errInvalidMeta = errors.New("unable to unmarshal meta")
+
+// keyEntity converts a key read from the database. A key whose meta is not valid json is returned
+// without meta and the error is logged, so a single bad row does not break verifications.
+// Updating such a key replaces its meta. With strictMeta the key fails to load instead.
+func (db *database) keyEntity(model *models.Key) (entities.Key, error) {
+	key, err := keyModelToEntity(model)
+	if err == nil || db.strictMeta || !errors.Is(err, errInvalidMeta) {
+		return key, err
+	}
+	db.logger.Error("ignoring invalid meta of key", zap.String("keyId", model.ID), zap.Error(err))
+	withoutMeta := *model
+	withoutMeta.Meta = sql.NullString{}
+	return keyModelToEntity(&withoutMeta)
+}
+
 func keyModelToEntity(model *models.Key) (entities.Key, error) {
 
 	key := entities.Key{}
@@ -43,30 +62,105 @@ func keyModelToEntity(model *models.Key) (entities.Key, error) {
 	if model.Meta.Valid {
 		err := json.Unmarshal([]byte(model.Meta.String), &key.Meta)
 		if err != nil {
-			return entities.Key{}, fmt.Errorf("unable to unmarshal meta: %w", err)
+			return entities.Key{}, fmt.Errorf("%w: %s", errInvalidMeta, err.Error())
+		}
+		// older rows stored empty meta as "null" or "{}"
+		if len(key.Meta) == 0 {
+			key.Meta = nil
 		}
 	}
 
-	if model.RatelimitType.Valid {
-		key.Ratelimit = &entities.Ratelimit{
-			Type:           model.RatelimitType.String,
-			Limit:          model.RatelimitLimit.Int64,
-			RefillRate:     model.RatelimitRefillRate.Int64,
-			RefillInterval: model.RatelimitRefillInterval.Int64,
-		}
+	ratelimit, err := unmarshalRatelimit(model.Ratelimit)
+	if err != nil {
+		return entities.Key{}, err
 	}
+	// keys that MigrateRatelimits has not copied yet still have their ratelimit in the old columns
+	if !model.Ratelimit.Valid {
+		ratelimit = ratelimitFromColumns(model.RatelimitType, model.RatelimitLimit, model.RatelimitRefillRate, model.RatelimitRefillInterval)
+	}
+	key.Ratelimit = ratelimit
 
 	if model.RemainingRequests.Valid {
 		key.Remaining.Enabled = true
 		key.Remaining.Remaining = model.RemainingRequests.Int64
 	}
+	key.DisableOnDepletion = model.DisableOnDepletion
+	if model.RemainingWarnThreshold.Valid {
+		threshold := model.RemainingWarnThreshold.Int64
+		key.RemainingWarnThreshold = &threshold
+	}
+
+	if model.SuspendedAt.Valid {
+		key.SuspendedAt = model.SuspendedAt.Time
+	}
+
+	if model.PreviousHash.Valid {
+		key.PreviousHash = model.PreviousHash.String
+		key.PreviousHashExpires = model.PreviousHashExpires.Time
+	}
+
+	if model.Encrypted.Valid {
+		key.Encrypted = model.Encrypted.String
+	}
+
+	if model.LastUsedAt.Valid {
+		key.LastUsedAt = model.LastUsedAt.Time
+	}
+
+	if model.ParentKeyID.Valid {
+		key.ParentKeyId = model.ParentKeyID.String
+	}
+
+	if model.Scopes.Valid {
+		err := json.Unmarshal([]byte(model.Scopes.String), &key.Scopes)
+		if err != nil {
+			return entities.Key{}, fmt.Errorf("unable to unmarshal scopes: %w", err)
+		}
+	}
+
+	if model.Format.Valid {
+		f := keyFormatColumn{}
+		err := json.Unmarshal([]byte(model.Format.String), &f)
+		if err != nil {
+			return entities.Key{}, fmt.Errorf("unable to unmarshal format: %w", err)
+		}
+		key.Format = &entities.KeyFormat{ByteLength: f.ByteLength, Encoding: f.Encoding, Checksum: f.Checksum}
+	}
 	return key, nil
 }
 
 func keyEntityToModel(e entities.Key) (*models.Key, error) {
-	metaBuf, err := json.Marshal(e.Meta)
+	// nil and empty meta are stored as NULL, not as the string "null" or "{}"
+	meta := sql.NullString{}
+	if len(e.Meta) > 0 {
+		metaBuf, err := json.Marshal(e.Meta)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal meta: %w", err)
+		}
+		meta = sql.NullString{String: string(metaBuf), Valid: true}
+	}
+
+	scopes := sql.NullString{}
+	if len(e.Scopes) > 0 {
+		scopesBuf, err := json.Marshal(e.Scopes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal scopes: %w", err)
+		}
+		scopes = sql.NullString{String: string(scopesBuf), Valid: true}
+	}
+
+	ratelimit, err := marshalRatelimit(e.Ratelimit)
 	if err != nil {
-		return nil, fmt.Errorf("unable to marshal meta: %w", err)
+		return nil, err
+	}
+
+	format := sql.NullString{}
+	if e.Format != nil {
+		formatBuf, err := json.Marshal(keyFormatColumn{ByteLength: e.Format.ByteLength, Encoding: e.Format.Encoding, Checksum: e.Format.Checksum})
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal format: %w", err)
+		}
+		format = sql.NullString{String: string(formatBuf), Valid: true}
 	}
 
 	key := &models.Key{
@@ -83,7 +177,7 @@ func keyEntityToModel(e entities.Key) (*models.Key, error) {
 			String: e.Name,
 			Valid:  e.Name != "",
 		},
-		Meta:      sql.NullString{String: string(metaBuf), Valid: len(metaBuf) > 0},
+		Meta:      meta,
 		CreatedAt: e.CreatedAt,
 		Expires: sql.NullTime{
 			Time:  e.Expires,
@@ -91,22 +185,99 @@ func keyEntityToModel(e entities.Key) (*models.Key, error) {
 		},
 
 		ForWorkspaceID: sql.NullString{String: e.ForWorkspaceId, Valid: e.ForWorkspaceId != ""},
+		SuspendedAt:    sql.NullTime{Time: e.SuspendedAt, Valid: !e.SuspendedAt.IsZero()},
+
+		PreviousHash:        sql.NullString{String: e.PreviousHash, Valid: e.PreviousHash != ""},
+		PreviousHashExpires: sql.NullTime{Time: e.PreviousHashExpires, Valid: e.PreviousHash != ""},
+
+		Ratelimit:          ratelimit,
+		Scopes:             scopes,
+		Encrypted:          sql.NullString{String: e.Encrypted, Valid: e.Encrypted != ""},
+		LastUsedAt:         sql.NullTime{Time: e.LastUsedAt, Valid: !e.LastUsedAt.IsZero()},
+		DisableOnDepletion: e.DisableOnDepletion,
+		ParentKeyID:        sql.NullString{String: e.ParentKeyId, Valid: e.ParentKeyId != ""},
+		Format:             format,
 	}
-	if e.Ratelimit != nil {
-		key.RatelimitType = sql.NullString{String: e.Ratelimit.Type, Valid: e.Ratelimit.Type != ""}
-		key.RatelimitLimit = sql.NullInt64{Int64: e.Ratelimit.Limit, Valid: e.Ratelimit.Limit > 0}
-		key.RatelimitRefillRate = sql.NullInt64{Int64: e.Ratelimit.RefillRate, Valid: e.Ratelimit.RefillRate > 0}
-		key.RatelimitRefillInterval = sql.NullInt64{Int64: e.Ratelimit.RefillInterval, Valid: e.Ratelimit.RefillRate > 0}
-	}
-
 	if e.Remaining.Enabled {
 		key.RemainingRequests = sql.NullInt64{Int64: e.Remaining.Remaining, Valid: true}
 	}
+	if e.RemainingWarnThreshold != nil {
+		key.RemainingWarnThreshold = sql.NullInt64{Int64: *e.RemainingWarnThreshold, Valid: true}
+	}
 
 	return key, nil
 
 }
 
+// keyFormatColumn is the shape of the json stored in the format column of a key.
+type keyFormatColumn struct {
+	ByteLength int    `json:"byteLength"`
+	Encoding   string `json:"encoding"`
+	Checksum   bool   `json:"checksum,omitempty"`
+}
+
+// ratelimitColumn is the shape of the json stored in the ratelimit column of a key.
+type ratelimitColumn struct {
+	Type           string `json:"type"`
+	Limit          int64  `json:"limit"`
+	RefillRate     int64  `json:"refillRate"`
+	RefillInterval int64  `json:"refillInterval"`
+	CheckOrder     string `json:"checkOrder,omitempty"`
+}
+
+// marshalRatelimit encodes a ratelimit for the ratelimit column, keys without a type are not limited
+func marshalRatelimit(r *entities.Ratelimit) (sql.NullString, error) {
+	if r == nil || r.Type == "" {
+		return sql.NullString{}, nil
+	}
+	buf, err := json.Marshal(ratelimitColumn{
+		Type:           r.Type,
+		Limit:          r.Limit,
+		RefillRate:     r.RefillRate,
+		RefillInterval: r.RefillInterval,
+		CheckOrder:     r.CheckOrder,
+	})
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("unable to marshal ratelimit: %w", err)
+	}
+	return sql.NullString{String: string(buf), Valid: true}, nil
+}
+
+func unmarshalRatelimit(column sql.NullString) (*entities.Ratelimit, error) {
+	if !column.Valid {
+		return nil, nil
+	}
+	r := ratelimitColumn{}
+	err := json.Unmarshal([]byte(column.String), &r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal ratelimit: %w", err)
+	}
+	if r.Type == "" {
+		return nil, nil
+	}
+	return &entities.Ratelimit{
+		Type:           r.Type,
+		Limit:          r.Limit,
+		RefillRate:     r.RefillRate,
+		RefillInterval: r.RefillInterval,
+		CheckOrder:     r.CheckOrder,
+	}, nil
+}
+
+// ratelimitFromColumns reads a ratelimit from the columns that were used before the ratelimit
+// column, only the type decided whether a key was limited.
+func ratelimitFromColumns(ratelimitType sql.NullString, limit, refillRate, refillInterval sql.NullInt64) *entities.Ratelimit {
+	if !ratelimitType.Valid {
+		return nil
+	}
+	return &entities.Ratelimit{
+		Type:           ratelimitType.String,
+		Limit:          limit.Int64,
+		RefillRate:     refillRate.Int64,
+		RefillInterval: refillInterval.Int64,
+	}
+}
+
 func workspaceEntityToModel(w entities.Workspace) *models.Workspace {
 
 	return &models.Workspace{
@@ -115,19 +286,39 @@ func workspaceEntityToModel(w entities.Workspace) *models.Workspace {
 		Slug:     w.Slug,
 		TenantID: w.TenantId,
 		Internal: w.Internal,
+		MaxKeys:  sql.NullInt64{Int64: int64(w.MaxKeys), Valid: w.MaxKeys > 0},
+		MaxKeyLifetime: sql.NullInt64{
+			Int64: w.MaxKeyLifetime.Milliseconds(),
+			Valid: w.MaxKeyLifetime > 0,
+		},
+		SuspendedAt: sql.NullTime{
+			Time:  w.SuspendedAt,
+			Valid: !w.SuspendedAt.IsZero(),
+		},
+		HideKeyStart: w.HideKeyStart,
+		OmitKeyStart: w.OmitKeyStart,
 	}
 
 }
 
 func workspaceModelToEntity(model *models.Workspace) entities.Workspace {
-	return entities.Workspace{
-		Id:       model.ID,
-		Name:     model.Name,
-		Slug:     model.Slug,
-		TenantId: model.TenantID,
-		Internal: model.Internal,
+	w := entities.Workspace{
+		Id:           model.ID,
+		Name:         model.Name,
+		Slug:         model.Slug,
+		TenantId:     model.TenantID,
+		Internal:     model.Internal,
+		MaxKeys:      int(model.MaxKeys.Int64),
+		HideKeyStart: model.HideKeyStart,
+		OmitKeyStart: model.OmitKeyStart,
 	}
-
+	if model.MaxKeyLifetime.Valid {
+		w.MaxKeyLifetime = time.Duration(model.MaxKeyLifetime.Int64) * time.Millisecond
+	}
+	if model.SuspendedAt.Valid {
+		w.SuspendedAt = model.SuspendedAt.Time
+	}
+	return w
 }
 
 func apiEntityToModel(a entities.Api) *models.API {
@@ -139,6 +330,10 @@ func apiEntityToModel(a entities.Api) *models.API {
 		IPWhitelist: sql.NullString{String: strings.Join(a.IpWhitelist, ","), Valid: len(a.IpWhitelist) > 0},
 		AuthType:    models.NullAuthType{AuthType: 1, Valid: true},
 		KeyAuthID:   sql.NullString{String: a.KeyAuthId, Valid: a.KeyAuthId != ""},
+		MetaSchema:  sql.NullString{String: a.MetaSchema, Valid: a.MetaSchema != ""},
+		// meta keys can not contain commas, see service.ParseAllowedMetaKeys
+		AllowedMetaKeys: sql.NullString{String: strings.Join(a.AllowedMetaKeys, ","), Valid: len(a.AllowedMetaKeys) > 0},
+		Prefix:          sql.NullString{String: a.Prefix, Valid: a.Prefix != ""},
 	}
 
 }
@@ -149,12 +344,18 @@ func apiModelToEntity(model *models.API) entities.Api {
 		Name:        model.Name,
 		WorkspaceId: model.WorkspaceID,
 		KeyAuthId:   model.KeyAuthID.String,
+		MetaSchema:  model.MetaSchema.String,
+		Prefix:      model.Prefix.String,
 	}
 
 	if model.IPWhitelist.Valid {
 		a.IpWhitelist = strings.Split(model.IPWhitelist.String, ",")
 	}
 
+	if model.AllowedMetaKeys.Valid && model.AllowedMetaKeys.String != "" {
+		a.AllowedMetaKeys = strings.Split(model.AllowedMetaKeys.String, ",")
+	}
+
 	if model.AuthType.Valid {
 		switch model.AuthType.AuthType.String() {
 		case "key":
@@ -9,6 +9,7 @@ import (
 	"github.com/unkeyed/unkey/apps/api/pkg/database/models"
 	"github.com/unkeyed/unkey/apps/api/pkg/entities"
 	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+	"go.uber.org/zap"
 )
 
 func Test_apiEntityToModel(t *testing.T) {
@@ -112,17 +113,14 @@ func Test_keyModelToEntity(t *testing.T) {
 func Test_keyModelToEntity_WithNullFields(t *testing.T) {
 
 	m := &models.Key{
-		ID:                      uid.Key(),
-		KeyAuthID:               sql.NullString{String: uid.KeyAuth(), Valid: true},
-		WorkspaceID:             uid.Workspace(),
-		Hash:                    "abc",
-		Start:                   "abc",
-		CreatedAt:               time.Now(),
-		RemainingRequests:       sql.NullInt64{Int64: 99, Valid: true},
-		RatelimitType:           sql.NullString{String: "fast", Valid: true},
-		RatelimitLimit:          sql.NullInt64{Int64: 10, Valid: true},
-		RatelimitRefillRate:     sql.NullInt64{Int64: 1, Valid: true},
-		RatelimitRefillInterval: sql.NullInt64{Int64: 1000, Valid: true},
+		ID:                uid.Key(),
+		KeyAuthID:         sql.NullString{String: uid.KeyAuth(), Valid: true},
+		WorkspaceID:       uid.Workspace(),
+		Hash:              "abc",
+		Start:             "abc",
+		CreatedAt:         time.Now(),
+		RemainingRequests: sql.NullInt64{Int64: 99, Valid: true},
+		Ratelimit:         sql.NullString{String: `{"type":"fast","limit":10,"refillRate":1,"refillInterval":1000}`, Valid: true},
 	}
 
 	e, err := keyModelToEntity(m)
@@ -140,3 +138,262 @@ func Test_keyModelToEntity_WithNullFields(t *testing.T) {
 	require.Equal(t, int64(1), e.Ratelimit.RefillRate)
 	require.Equal(t, int64(1000), e.Ratelimit.RefillInterval)
 }
+
+func Test_keyConversion_RoundTrip(t *testing.T) {
+	full := entities.Key{
+		Id:             uid.Key(),
+		KeyAuthId:      uid.KeyAuth(),
+		WorkspaceId:    uid.Workspace(),
+		Name:           "name",
+		Hash:           "abc",
+		Start:          "abc",
+		OwnerId:        "chronark",
+		Meta:           map[string]any{"plan": "pro"},
+		CreatedAt:      time.UnixMilli(1686941966471),
+		Expires:        time.UnixMilli(1686941999999),
+		ForWorkspaceId: uid.Workspace(),
+		Ratelimit: &entities.Ratelimit{
+			Type:           "fast",
+			Limit:          10,
+			RefillRate:     1,
+			RefillInterval: 1000,
+		},
+		SuspendedAt:         time.UnixMilli(1686941977777),
+		PreviousHash:        "def",
+		PreviousHashExpires: time.UnixMilli(1686941988888),
+		Format:              &entities.KeyFormat{ByteLength: 32, Encoding: "base64url", Checksum: true},
+	}
+	full.Remaining.Enabled = true
+	full.Remaining.Remaining = 5
+	threshold := int64(2)
+	full.RemainingWarnThreshold = &threshold
+
+	testCases := []struct {
+		name string
+		key  entities.Key
+	}{
+		{
+			name: "minimal",
+			key: entities.Key{
+				Id:          uid.Key(),
+				KeyAuthId:   uid.KeyAuth(),
+				WorkspaceId: uid.Workspace(),
+				Hash:        "abc",
+				Start:       "abc",
+				CreatedAt:   time.UnixMilli(1686941966471),
+			},
+		},
+		{name: "all fields", key: full},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := keyEntityToModel(tc.key)
+			require.NoError(t, err)
+
+			e, err := keyModelToEntity(m)
+			require.NoError(t, err)
+			require.Equal(t, tc.key, e)
+		})
+	}
+}
+
+func Test_keyEntityToModel_Ratelimit(t *testing.T) {
+	m, err := keyEntityToModel(entities.Key{
+		Id:        uid.Key(),
+		CreatedAt: time.Now(),
+		Ratelimit: &entities.Ratelimit{
+			Type:           "fast",
+			Limit:          10,
+			RefillRate:     0,
+			RefillInterval: 1000,
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, m.Ratelimit.Valid)
+	require.JSONEq(t, `{"type":"fast","limit":10,"refillRate":0,"refillInterval":1000}`, m.Ratelimit.String)
+
+	m, err = keyEntityToModel(entities.Key{Id: uid.Key(), CreatedAt: time.Now(), Ratelimit: &entities.Ratelimit{Type: "fast", Limit: 10, RefillRate: 1, RefillInterval: 1000, CheckOrder: entities.CheckRatelimitFirst}})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"type":"fast","limit":10,"refillRate":1,"refillInterval":1000,"checkOrder":"ratelimitFirst"}`, m.Ratelimit.String)
+	e, err := keyModelToEntity(m)
+	require.NoError(t, err)
+	require.Equal(t, entities.CheckRatelimitFirst, e.Ratelimit.CheckOrder)
+
+	// a ratelimit without a type never limited anything
+	m, err = keyEntityToModel(entities.Key{Id: uid.Key(), CreatedAt: time.Now(), Ratelimit: &entities.Ratelimit{Limit: 10}})
+	require.NoError(t, err)
+	require.False(t, m.Ratelimit.Valid)
+}
+
+func Test_keyModelToEntity_InvalidRatelimit(t *testing.T) {
+	_, err := keyModelToEntity(&models.Key{
+		ID:        uid.Key(),
+		Ratelimit: sql.NullString{String: "not json", Valid: true},
+	})
+	require.Error(t, err)
+}
+
+func Test_keyModelToEntity_UnmigratedRatelimit(t *testing.T) {
+	legacy := &models.Key{
+		ID:                      uid.Key(),
+		RatelimitType:           sql.NullString{String: "fast", Valid: true},
+		RatelimitLimit:          sql.NullInt64{Int64: 10, Valid: true},
+		RatelimitRefillRate:     sql.NullInt64{Int64: 1, Valid: true},
+		RatelimitRefillInterval: sql.NullInt64{Int64: 1000, Valid: true},
+	}
+	e, err := keyModelToEntity(legacy)
+	require.NoError(t, err)
+	require.Equal(t, &entities.Ratelimit{Type: "fast", Limit: 10, RefillRate: 1, RefillInterval: 1000}, e.Ratelimit)
+
+	// once migrated, the ratelimit column wins over the old columns
+	legacy.Ratelimit = sql.NullString{String: `{"type":"consistent","limit":5,"refillRate":5,"refillInterval":60000}`, Valid: true}
+	e, err = keyModelToEntity(legacy)
+	require.NoError(t, err)
+	require.Equal(t, &entities.Ratelimit{Type: "consistent", Limit: 5, RefillRate: 5, RefillInterval: 60000}, e.Ratelimit)
+}
+
+func Test_ratelimitFromColumns(t *testing.T) {
+	testCases := []struct {
+		name           string
+		ratelimitType  sql.NullString
+		limit          sql.NullInt64
+		refillRate     sql.NullInt64
+		refillInterval sql.NullInt64
+		want           *entities.Ratelimit
+	}{
+		{
+			name: "not limited",
+			want: nil,
+		},
+		{
+			name:       "limit without a type",
+			limit:      sql.NullInt64{Int64: 10, Valid: true},
+			refillRate: sql.NullInt64{Int64: 1, Valid: true},
+			want:       nil,
+		},
+		{
+			name:           "all columns",
+			ratelimitType:  sql.NullString{String: "consistent", Valid: true},
+			limit:          sql.NullInt64{Int64: 10, Valid: true},
+			refillRate:     sql.NullInt64{Int64: 1, Valid: true},
+			refillInterval: sql.NullInt64{Int64: 1000, Valid: true},
+			want:           &entities.Ratelimit{Type: "consistent", Limit: 10, RefillRate: 1, RefillInterval: 1000},
+		},
+		{
+			// zero values were written as NULL
+			name:           "null refill rate",
+			ratelimitType:  sql.NullString{String: "fast", Valid: true},
+			limit:          sql.NullInt64{Int64: 10, Valid: true},
+			refillInterval: sql.NullInt64{Int64: 1000, Valid: true},
+			want:           &entities.Ratelimit{Type: "fast", Limit: 10, RefillInterval: 1000},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ratelimit := ratelimitFromColumns(tc.ratelimitType, tc.limit, tc.refillRate, tc.refillInterval)
+			require.Equal(t, tc.want, ratelimit)
+
+			// the migrated value reads back as the same ratelimit
+			column, err := marshalRatelimit(ratelimit)
+			require.NoError(t, err)
+			require.Equal(t, tc.want != nil, column.Valid)
+			roundTripped, err := unmarshalRatelimit(column)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, roundTripped)
+		})
+	}
+}
+
+func Test_keyConversion_Meta(t *testing.T) {
+	testCases := []struct {
+		name  string
+		meta  map[string]any
+		valid bool
+		want  map[string]any
+	}{
+		{name: "nil", meta: nil, valid: false, want: nil},
+		{name: "empty", meta: map[string]any{}, valid: false, want: nil},
+		{name: "populated", meta: map[string]any{"plan": "pro", "seats": float64(5)}, valid: true, want: map[string]any{"plan": "pro", "seats": float64(5)}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := keyEntityToModel(entities.Key{Id: uid.Key(), CreatedAt: time.Now(), Meta: tc.meta})
+			require.NoError(t, err)
+			require.Equal(t, tc.valid, m.Meta.Valid)
+
+			e, err := keyModelToEntity(m)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, e.Meta)
+		})
+	}
+}
+
+func Test_keyModelToEntity_LegacyEmptyMeta(t *testing.T) {
+	for _, stored := range []string{"null", "{}"} {
+		e, err := keyModelToEntity(&models.Key{ID: uid.Key(), Meta: sql.NullString{String: stored, Valid: true}})
+		require.NoError(t, err)
+		require.Nil(t, e.Meta, stored)
+	}
+}
+
+func Test_keyConversion_Scopes(t *testing.T) {
+	m, err := keyEntityToModel(entities.Key{Id: uid.Key(), CreatedAt: time.Now()})
+	require.NoError(t, err)
+	require.False(t, m.Scopes.Valid)
+
+	m, err = keyEntityToModel(entities.Key{Id: uid.Key(), CreatedAt: time.Now(), Scopes: []string{entities.ScopeKeysRead, entities.ScopeKeysCreate}})
+	require.NoError(t, err)
+	require.True(t, m.Scopes.Valid)
+	require.Equal(t, `["keys.read","keys.create"]`, m.Scopes.String)
+
+	e, err := keyModelToEntity(m)
+	require.NoError(t, err)
+	require.Equal(t, []string{entities.ScopeKeysRead, entities.ScopeKeysCreate}, e.Scopes)
+}
+
+func Test_keyConversion_Encrypted(t *testing.T) {
+	m, err := keyEntityToModel(entities.Key{Id: uid.Key(), CreatedAt: time.Now()})
+	require.NoError(t, err)
+	require.False(t, m.Encrypted.Valid)
+
+	m, err = keyEntityToModel(entities.Key{Id: uid.Key(), CreatedAt: time.Now(), Encrypted: "v1.abc"})
+	require.NoError(t, err)
+	require.Equal(t, sql.NullString{String: "v1.abc", Valid: true}, m.Encrypted)
+
+	e, err := keyModelToEntity(m)
+	require.NoError(t, err)
+	require.Equal(t, "v1.abc", e.Encrypted)
+}
+
+func Test_keyEntity_InvalidMeta(t *testing.T) {
+	m := &models.Key{
+		ID:          uid.Key(),
+		Hash:        "hash",
+		WorkspaceID: uid.Workspace(),
+		Meta:        sql.NullString{String: `{"plan": "pro"`, Valid: true},
+	}
+
+	_, err := keyModelToEntity(m)
+	require.ErrorIs(t, err, errInvalidMeta)
+
+	lenient := &database{logger: zap.NewNop()}
+	e, err := lenient.keyEntity(m)
+	require.NoError(t, err)
+	require.Equal(t, m.ID, e.Id)
+	require.Equal(t, "hash", e.Hash)
+	require.Nil(t, e.Meta)
+	// the row itself is left alone
+	require.Equal(t, `{"plan": "pro"`, m.Meta.String)
+
+	strict := &database{logger: zap.NewNop(), strictMeta: true}
+	_, err = strict.keyEntity(m)
+	require.ErrorIs(t, err, errInvalidMeta)
+
+	// other errors still fail the key
+	m.Ratelimit = sql.NullString{String: "not json", Valid: true}
+	_, err = lenient.keyEntity(m)
+	require.Error(t, err)
+}
@@ -1,8 +1,20 @@
 package database
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+)
 
 var (
 	ErrNotFound  = errors.New("not found")
 	ErrNotUnique = errors.New("not unique")
 )
+
+// mysqlDuplicateEntry is the error number of inserts that violate a primary or unique key
+const mysqlDuplicateEntry = 1062
+
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry
+}
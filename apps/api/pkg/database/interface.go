@@ -2,28 +2,106 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
 	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/usage"
+	"github.com/unkeyed/unkey/apps/api/pkg/webhooks"
 )
 
 type Database interface {
 	CreateApi(ctx context.Context, newApi entities.Api) error
+	// CreateApiWithKeyAuth creates an api together with the keyAuth it references, atomically
+	CreateApiWithKeyAuth(ctx context.Context, newApi entities.Api, newKeyAuth entities.KeyAuth) error
 	GetApi(ctx context.Context, apiId string) (entities.Api, error)
+	// SetApiMetaSchema replaces the JSON Schema of the meta of the api's keys, an empty schema removes it
+	SetApiMetaSchema(ctx context.Context, apiId string, schema string) error
+	// SetApiAllowedMetaKeys replaces the top level keys the meta of the api's keys may have, no keys remove the restriction
+	SetApiAllowedMetaKeys(ctx context.Context, apiId string, keys []string) error
 	GetApiByKeyAuthId(ctx context.Context, keyAuthId string) (entities.Api, error)
 
 	CreateKey(ctx context.Context, newKey entities.Key) error
+	// CreateKeys inserts multiple keys atomically
+	CreateKeys(ctx context.Context, newKeys []entities.Key) error
 	UpdateKey(ctx context.Context, key entities.Key) error
+	// UpdateKeySecret writes only the hash, start, previous hash and encrypted secret of the key
+	UpdateKeySecret(ctx context.Context, key entities.Key) error
+	UpdateKeyMeta(ctx context.Context, keyId string, meta map[string]any) error
+	SetKeyEnabled(ctx context.Context, keyId string, enabled bool) error
+	// TouchKeyLastUsed sets when the key was last used, unless a later time is already stored
+	TouchKeyLastUsed(ctx context.Context, keyId string, ts time.Time) error
+	// SetKeysEnabled suspends or re-enables keys in one statement and returns how many changed
+	SetKeysEnabled(ctx context.Context, keyIds []string, enabled bool) (int, error)
 
 	DeleteKey(ctx context.Context, keyId string) error
+	// DeleteKeysByPrefix deletes all keys of a keyAuth created with the prefix and returns how many were deleted
+	DeleteKeysByPrefix(ctx context.Context, keyAuthId string, prefix string) (int, error)
+	// ReEncryptKeys migrates the secrets of recoverable keys to the active encryption key and returns how many were migrated
+	ReEncryptKeys(ctx context.Context, batchSize int) (int, error)
+	// RecomputeKeyStarts recomputes the start of recoverable keys, it returns how many were updated and skipped
+	RecomputeKeyStarts(ctx context.Context, batchSize int) (int, int, error)
+	// MigrateRatelimits copies ratelimits from the old ratelimit_* columns into the ratelimit column and returns how many were migrated
+	MigrateRatelimits(ctx context.Context, batchSize int) (int, error)
 	GetKeyByHash(ctx context.Context, hash string) (entities.Key, error)
+	// GetKeysByHashes loads many keys with a single query, hashes without a key are missing from the result
+	GetKeysByHashes(ctx context.Context, hashes []string) (map[string]entities.Key, error)
+	// GetKeyAndApiByHash loads a key and the api it belongs to with a single query
+	GetKeyAndApiByHash(ctx context.Context, hash string) (entities.Key, entities.Api, error)
 	GetKeyById(ctx context.Context, keyId string) (entities.Key, error)
 	CountKeys(ctx context.Context, keyAuthId string) (int, error)
-	ListKeysByKeyAuthId(ctx context.Context, keyAuthId string, limit int, offset int, ownerId string) ([]entities.Key, error)
+	CountKeysByWorkspace(ctx context.Context, workspaceId string) (int, error)
+	// CountKeysExpiringBetween counts the keys of a workspace that expire in (from, to]
+	CountKeysExpiringBetween(ctx context.Context, workspaceId string, from time.Time, to time.Time) (int, error)
+	CountApisByWorkspace(ctx context.Context, workspaceId string) (int, error)
+	// ListKeysByKeyAuthId returns a page of keys and the total number of keys matching the filter
+	ListKeysByKeyAuthId(ctx context.Context, keyAuthId string, limit int, offset int, ownerId string) ([]entities.Key, int, error)
+	ListKeysByOwnerId(ctx context.Context, workspaceId string, ownerId string) ([]entities.Key, error)
+	// SearchKeys matches the start of keys by prefix and their name by substring, never their hash
+	SearchKeys(ctx context.Context, keyAuthId string, query string, limit int) ([]entities.Key, error)
+	// ListKeysByWorkspaceId pages through all keys of a workspace by id, never their hash
+	ListKeysByWorkspaceId(ctx context.Context, workspaceId string, afterId string, limit int) ([]entities.Key, error)
+	ListKeysExpiringBetween(ctx context.Context, keyAuthId string, from time.Time, to time.Time, limit int, offset int) ([]entities.Key, error)
+	ListKeysByPrefix(ctx context.Context, keyAuthId string, prefix string) ([]entities.Key, error)
+	// TransferKeysOwner moves all keys in a workspace from one owner to another and returns the moved keys
+	TransferKeysOwner(ctx context.Context, workspaceId, fromOwnerId, toOwnerId string) ([]entities.Key, error)
 	CreateWorkspace(ctx context.Context, newWorkspace entities.Workspace) error
 
 	CreateKeyAuth(ctx context.Context, newKeyAuth entities.KeyAuth) error
 	GetKeyAuth(ctx context.Context, keyAuthId string) (entities.KeyAuth, error)
 
 	GetWorkspace(ctx context.Context, workspaceId string) (entities.Workspace, error)
-	DecrementRemainingKeyUsage(ctx context.Context, keyId string) (int64, error)
+	SetWorkspaceEnabled(ctx context.Context, workspaceId string, enabled bool) error
+	// SetWorkspaceHideKeyStart decides if the start of keys is omitted when they are listed or fetched
+	SetWorkspaceHideKeyStart(ctx context.Context, workspaceId string, hide bool) error
+	// SetWorkspaceOmitKeyStart decides if new keys of the workspace are stored without their start
+	SetWorkspaceOmitKeyStart(ctx context.Context, workspaceId string, omit bool) error
+	// DecrementRemainingKeyUsage uses up cost remaining verifications, it reports false if fewer were left
+	DecrementRemainingKeyUsage(ctx context.Context, keyId string, cost int64) (int64, bool, error)
+	// VerifyAndConsume loads a key by hash and atomically uses up cost of its remaining verifications
+	VerifyAndConsume(ctx context.Context, hash string, cost int64) (entities.Key, int64, bool, error)
+
+	// AppendAuditLog stores an entry, the audit log is append only
+	AppendAuditLog(ctx context.Context, entry audit.Entry) error
+	ListAuditLogs(ctx context.Context, workspaceId string, filter audit.Filter) ([]audit.Entry, error)
+
+	// IncrementKeyUsage counts a successful verification in the hourly bucket of ts
+	IncrementKeyUsage(ctx context.Context, keyId string, ts time.Time) error
+	AddKeyUsage(ctx context.Context, counts []usage.Count) error
+	GetKeyUsage(ctx context.Context, keyId string, from, to time.Time, granularity usage.Granularity) ([]usage.Bucket, error)
+
+	CreateWebhook(ctx context.Context, endpoint webhooks.Endpoint) error
+	ListWebhooks(ctx context.Context, workspaceId string) ([]webhooks.Endpoint, error)
+	DeleteWebhook(ctx context.Context, workspaceId, webhookId string) error
+
+	// WithTx runs fn in a transaction, everything done with tx is rolled back if fn returns an error
+	WithTx(ctx context.Context, fn func(tx Database) error) error
+
+	// Ping checks whether the database can serve queries
+	Ping(ctx context.Context) error
+	// Stats returns the statistics of the connection pools by name, see PoolConfig
+	Stats() map[string]sql.DBStats
+	// Close closes all connections, the database must not be used afterwards
+	Close() error
 }
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/database/models"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+const apiColumns = `id, name, workspace_id, ip_whitelist, auth_type, key_auth_id, meta_schema, allowed_meta_keys, prefix`
+
+// keyAndApiQuery selects a key together with the api of its keyAuth, the WHERE clause is appended
+var keyAndApiQuery = `SELECT ` + qualifyColumns("k", keyColumns) + `, ` + qualifyColumns("a", apiColumns) + ` ` +
+	`FROM unkey.keys k ` +
+	`JOIN unkey.key_auth ka ON ka.id = k.key_auth_id ` +
+	`JOIN unkey.apis a ON a.key_auth_id = ka.id `
+
+// GetKeyAndApiByHash loads a key and its api in a single round trip, it behaves like GetKeyByHash
+// followed by GetApiByKeyAuthId and returns ErrNotFound if either of them does not exist.
+func (db *database) GetKeyAndApiByHash(ctx context.Context, hash string) (entities.Key, entities.Api, error) {
+	foundKey, foundApi, err := scanKeyAndApi(db.read(ctx).QueryRowContext(ctx, keyAndApiQuery+`WHERE k.hash = ?`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		foundKey, foundApi, err = scanKeyAndApi(db.read(ctx).QueryRowContext(ctx, keyAndApiQuery+`WHERE k.previous_hash = ? AND k.previous_hash_expires > ?`, hash, time.Now()))
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entities.Key{}, entities.Api{}, ErrNotFound
+		}
+		return entities.Key{}, entities.Api{}, fmt.Errorf("unable to load key and api by hash %s from db: %w", hash, err)
+	}
+
+	key, err := db.keyEntity(foundKey)
+	if err != nil {
+		return entities.Key{}, entities.Api{}, err
+	}
+	return key, apiModelToEntity(foundApi), nil
+}
+
+// scanKeyAndApi reads a row selected with keyAndApiQuery
+func scanKeyAndApi(row *sql.Row) (*models.Key, *models.API, error) {
+	k := &models.Key{}
+	a := &models.API{}
+	err := row.Scan(
+		&k.ID, &k.Hash, &k.Start, &k.OwnerID, &k.Meta, &k.CreatedAt, &k.Expires, &k.Ratelimit, &k.RatelimitType, &k.RatelimitLimit, &k.RatelimitRefillRate, &k.RatelimitRefillInterval, &k.WorkspaceID, &k.ForWorkspaceID, &k.Name, &k.RemainingRequests, &k.KeyAuthID, &k.SuspendedAt, &k.PreviousHash, &k.PreviousHashExpires, &k.Scopes, &k.Encrypted, &k.LastUsedAt, &k.DisableOnDepletion, &k.ParentKeyID, &k.RemainingWarnThreshold, &k.Format,
+		&a.ID, &a.Name, &a.WorkspaceID, &a.IPWhitelist, &a.AuthType, &a.KeyAuthID, &a.MetaSchema, &a.AllowedMetaKeys, &a.Prefix,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	return k, a, nil
+}
+
+// qualifyColumns prefixes every column of a comma separated list with the table alias
+func qualifyColumns(alias string, columns string) string {
+	qualified := strings.Split(columns, ", ")
+	for i, column := range qualified {
+		qualified[i] = alias + "." + column
+	}
+	return strings.Join(qualified, ", ")
+}
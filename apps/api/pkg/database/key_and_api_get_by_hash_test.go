@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+// createKeyWithApi stores a key in a new api and returns the hash of the key
+func createKeyWithApi(t testing.TB, db Database) (string, entities.Api) {
+	ctx := context.Background()
+	workspaceId := uid.Workspace()
+	keyAuth := entities.KeyAuth{Id: uid.KeyAuth(), WorkspaceId: workspaceId}
+	api := entities.Api{
+		Id:          uid.Api(),
+		Name:        "test",
+		WorkspaceId: workspaceId,
+		IpWhitelist: []string{"1.1.1.1"},
+		AuthType:    entities.AuthTypeKey,
+		KeyAuthId:   keyAuth.Id,
+	}
+	require.NoError(t, db.CreateApiWithKeyAuth(ctx, api, keyAuth))
+
+	keyHash := hash.Sha256(uid.New("test"))
+	err := db.CreateKey(ctx, entities.Key{
+		Id:          uid.Key(),
+		KeyAuthId:   keyAuth.Id,
+		WorkspaceId: workspaceId,
+		Hash:        keyHash,
+		CreatedAt:   time.Now(),
+	})
+	require.NoError(t, err)
+	return keyHash, api
+}
+
+func TestGetKeyAndApiByHash(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(t, err)
+
+	keyHash, api := createKeyWithApi(t, db)
+
+	key, found, err := db.GetKeyAndApiByHash(ctx, keyHash)
+	require.NoError(t, err)
+	require.Equal(t, keyHash, key.Hash)
+	require.Equal(t, api.Id, found.Id)
+	require.Equal(t, api.IpWhitelist, found.IpWhitelist)
+	require.Equal(t, entities.AuthTypeKey, found.AuthType)
+
+	_, _, err = db.GetKeyAndApiByHash(ctx, hash.Sha256(uid.New("test")))
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestQualifyColumns(t *testing.T) {
+	require.Equal(t, "a.id, a.name", qualifyColumns("a", "id, name"))
+}
+
+// BenchmarkGetKeyAndApiByHash compares the joined query with the separate lookups verify used before
+func BenchmarkGetKeyAndApiByHash(b *testing.B) {
+	ctx := context.Background()
+	db, err := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(b, err)
+
+	keyHash, _ := createKeyWithApi(b, db)
+
+	b.Run("join", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _, err := db.GetKeyAndApiByHash(ctx, keyHash)
+			require.NoError(b, err)
+		}
+	})
+
+	b.Run("separate queries", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			key, err := db.GetKeyByHash(ctx, keyHash)
+			require.NoError(b, err)
+			keyAuth, err := db.GetKeyAuth(ctx, key.KeyAuthId)
+			require.NoError(b, err)
+			_, err = db.GetApiByKeyAuthId(ctx, keyAuth.Id)
+			require.NoError(b, err)
+		}
+	})
+}
@@ -11,7 +11,7 @@ import (
 
 func (db *database) GetKeyAuth(ctx context.Context, keyAuthId string) (entities.KeyAuth, error) {
 
-	keyAuth, err := models.KeyAuthByID(ctx, db.read(), keyAuthId)
+	keyAuth, err := models.KeyAuthByID(ctx, db.read(ctx), keyAuthId)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return entities.KeyAuth{}, ErrNotFound
@@ -3,50 +3,83 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 )
 
-// Decrement the `remaining` field and return the new value
-// The returned value is the number of remaining verifications after the current one.
-// This means the returned value can be negative, for example when the remaining is 0 and we call this function.
-func (db *database) DecrementRemainingKeyUsage(ctx context.Context, keyId string) (int64, error) {
-	tx, err := db.write().BeginTx(ctx, nil)
+// DecrementRemainingKeyUsage uses up cost of the remaining verifications of a key and returns how many are left.
+//
+// The remaining verifications never go below 0. The returned bool is false if there were fewer than cost left,
+// the key is not changed then. Retrying after an error is safe, a failed call never decrements.
+// Keys with DisableOnDepletion are suspended together with using up their last verification.
+func (db *database) DecrementRemainingKeyUsage(ctx context.Context, keyId string, cost int64) (int64, bool, error) {
+	tx, err := db.begin(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("unable to start transaction: %w", err)
+		return 0, false, fmt.Errorf("unable to start transaction: %w", err)
 	}
+	// a no-op after commit
+	defer func() { _ = tx.Rollback() }()
 
-	_, err = tx.Exec(`UPDATE unkey.keys SET remaining_requests = remaining_requests - 1 WHERE id = ?`, keyId)
+	decremented, err := decrementRemaining(ctx, tx, keyId, cost)
 	if err != nil {
-		rollbackErr := tx.Rollback()
-		if rollbackErr != nil {
-			return 0, fmt.Errorf("unable to roll back: %w", rollbackErr)
-		}
-		return 0, fmt.Errorf("unable to decrement: %w", err)
+		return 0, false, err
 	}
 
-	row := tx.QueryRow(`SELECT remaining_requests FROM unkey.keys WHERE id = ?`, keyId)
-	if err != nil {
-		rollbackErr := tx.Rollback()
-		if rollbackErr != nil {
-			return 0, fmt.Errorf("unable to roll back: %w", rollbackErr)
-		}
-		return 0, fmt.Errorf("unable to query: %w", err)
-	}
 	var remainingAfter sql.NullInt64
-	err = row.Scan(&remainingAfter)
-
+	err = tx.QueryRowContext(ctx, `SELECT remaining_requests FROM unkey.keys WHERE id = ? FOR UPDATE`, keyId).Scan(&remainingAfter)
 	if err != nil {
-		return 0, fmt.Errorf("unable to scan result: %w", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, ErrNotFound
+		}
+		return 0, false, fmt.Errorf("unable to scan result: %w", err)
 	}
 	if !remainingAfter.Valid {
-		return 0, fmt.Errorf("this key did not have a remaining config")
+		return 0, false, fmt.Errorf("key %s does not have a remaining config", keyId)
+	}
+	if decremented && remainingAfter.Int64 == 0 {
+		_, _, err = suspendDepleted(ctx, tx, keyId)
+		if err != nil {
+			return 0, false, err
+		}
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		return 0, fmt.Errorf("unable to commit transaction: %w", err)
+		return 0, false, fmt.Errorf("unable to commit transaction: %w", err)
 	}
+	return remainingAfter.Int64, decremented, nil
+}
 
-	return remainingAfter.Int64, err
+// decrementRemaining takes cost verifications from the key, all of them or none, and reports
+// whether there were enough to take. The row stays locked until the transaction ends.
+func decrementRemaining(ctx context.Context, tx querier, keyId string, cost int64) (bool, error) {
+	if cost < 1 {
+		return false, fmt.Errorf("cost must be at least 1, got %d", cost)
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE unkey.keys SET remaining_requests = remaining_requests - ? WHERE id = ? AND remaining_requests >= ?`, cost, keyId, cost)
+	if err != nil {
+		return false, fmt.Errorf("unable to decrement: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("unable to count decremented keys: %w", err)
+	}
+	return rows == 1, nil
+}
 
+// suspendDepleted suspends a key that has DisableOnDepletion set and no verifications left.
+// Keys that are already suspended keep their original suspension time.
+// It reports whether the key was suspended by this call.
+func suspendDepleted(ctx context.Context, tx querier, keyId string) (time.Time, bool, error) {
+	now := time.Now()
+	res, err := tx.ExecContext(ctx, `UPDATE unkey.keys SET suspended_at = ? WHERE id = ? AND disable_on_depletion = TRUE AND remaining_requests = 0 AND suspended_at IS NULL`, now, keyId)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("unable to suspend depleted key %s: %w", keyId, err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("unable to count suspended keys: %w", err)
+	}
+	return now, rows == 1, nil
 }
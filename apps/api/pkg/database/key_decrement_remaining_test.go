@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+func TestDecrementRemainingKeyUsage_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(t, err)
+
+	key := entities.Key{
+		Id:          uid.Key(),
+		KeyAuthId:   uid.KeyAuth(),
+		WorkspaceId: uid.Workspace(),
+		Hash:        hash.Sha256(uid.New("test")),
+		CreatedAt:   time.Now(),
+	}
+	key.Remaining.Enabled = true
+	key.Remaining.Remaining = 5
+	require.NoError(t, db.CreateKey(ctx, key))
+
+	const concurrency = 20
+	var granted atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			remaining, decremented, err := db.DecrementRemainingKeyUsage(ctx, key.Id, 1)
+			require.NoError(t, err)
+			require.GreaterOrEqual(t, remaining, int64(0))
+			if decremented {
+				granted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int64(5), granted.Load())
+
+	found, err := db.GetKeyById(ctx, key.Id)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), found.Remaining.Remaining)
+
+	// at zero nothing changes
+	remaining, decremented, err := db.DecrementRemainingKeyUsage(ctx, key.Id, 1)
+	require.NoError(t, err)
+	require.False(t, decremented)
+	require.Equal(t, int64(0), remaining)
+
+	_, _, err = db.DecrementRemainingKeyUsage(ctx, uid.Key(), 1)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestDecrementRemainingKeyUsage_Cost(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(t, err)
+
+	key := entities.Key{
+		Id:          uid.Key(),
+		KeyAuthId:   uid.KeyAuth(),
+		WorkspaceId: uid.Workspace(),
+		Hash:        hash.Sha256(uid.New("test")),
+		CreatedAt:   time.Now(),
+	}
+	key.Remaining.Enabled = true
+	key.Remaining.Remaining = 5
+	require.NoError(t, db.CreateKey(ctx, key))
+
+	remaining, decremented, err := db.DecrementRemainingKeyUsage(ctx, key.Id, 3)
+	require.NoError(t, err)
+	require.True(t, decremented)
+	require.Equal(t, int64(2), remaining)
+
+	// all or nothing, a cost above what is left changes nothing
+	remaining, decremented, err = db.DecrementRemainingKeyUsage(ctx, key.Id, 3)
+	require.NoError(t, err)
+	require.False(t, decremented)
+	require.Equal(t, int64(2), remaining)
+
+	remaining, decremented, err = db.DecrementRemainingKeyUsage(ctx, key.Id, 2)
+	require.NoError(t, err)
+	require.True(t, decremented)
+	require.Equal(t, int64(0), remaining)
+}
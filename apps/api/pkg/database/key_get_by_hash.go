@@ -5,13 +5,18 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/unkeyed/unkey/apps/api/pkg/database/models"
 	"github.com/unkeyed/unkey/apps/api/pkg/entities"
 )
 
+// GetKeyByHash also finds rerolled keys by the hash of their previous secret, until its grace period expires.
 func (db *database) GetKeyByHash(ctx context.Context, hash string) (entities.Key, error) {
-	found, err := models.KeyByHash(ctx, db.read(), hash)
+	found, err := models.KeyByHash(ctx, db.read(ctx), hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		found, err = db.keyByPreviousHash(ctx, hash)
+	}
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return entities.Key{}, ErrNotFound
@@ -22,6 +27,31 @@ func (db *database) GetKeyByHash(ctx context.Context, hash string) (entities.Key
 		return entities.Key{}, ErrNotFound
 	}
 
-	return keyModelToEntity(found)
+	return db.keyEntity(found)
+
+}
+
+func (db *database) keyByPreviousHash(ctx context.Context, hash string) (*models.Key, error) {
+	const query = `SELECT ` + keyColumns + ` ` +
+		`FROM unkey.keys ` +
+		`WHERE previous_hash = ? AND previous_hash_expires > ?`
+
+	return scanKey(db.read(ctx).QueryRowContext(ctx, query, hash, time.Now()))
+}
 
+const keyColumns = `id, hash, start, owner_id, meta, created_at, expires, ratelimit, ratelimit_type, ratelimit_limit, ratelimit_refill_rate, ratelimit_refill_interval, workspace_id, for_workspace_id, name, remaining_requests, key_auth_id, suspended_at, previous_hash, previous_hash_expires, scopes, encrypted, last_used_at, disable_on_depletion, parent_key_id, remaining_warn_threshold, format`
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanKey reads a row selected with keyColumns
+func scanKey(row scanner) (*models.Key, error) {
+	k := &models.Key{}
+	err := row.Scan(&k.ID, &k.Hash, &k.Start, &k.OwnerID, &k.Meta, &k.CreatedAt, &k.Expires, &k.Ratelimit, &k.RatelimitType, &k.RatelimitLimit, &k.RatelimitRefillRate, &k.RatelimitRefillInterval, &k.WorkspaceID, &k.ForWorkspaceID, &k.Name, &k.RemainingRequests, &k.KeyAuthID, &k.SuspendedAt, &k.PreviousHash, &k.PreviousHashExpires, &k.Scopes, &k.Encrypted, &k.LastUsedAt, &k.DisableOnDepletion, &k.ParentKeyID, &k.RemainingWarnThreshold, &k.Format)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
 }
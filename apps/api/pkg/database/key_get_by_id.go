@@ -11,7 +11,7 @@ import (
 )
 
 func (db *database) GetKeyById(ctx context.Context, keyId string) (entities.Key, error) {
-	found, err := models.KeyByID(ctx, db.read(), keyId)
+	found, err := models.KeyByID(ctx, db.read(ctx), keyId)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return entities.Key{}, ErrNotFound
@@ -22,6 +22,6 @@ func (db *database) GetKeyById(ctx context.Context, keyId string) (entities.Key,
 		return entities.Key{}, ErrNotFound
 	}
 
-	return keyModelToEntity(found)
+	return db.keyEntity(found)
 
 }
@@ -0,0 +1,19 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SetKeyEnabled suspends or re-enables a key without deleting it
+func (db *database) SetKeyEnabled(ctx context.Context, keyId string, enabled bool) error {
+	suspendedAt := sql.NullTime{Time: time.Now(), Valid: !enabled}
+
+	_, err := db.write().ExecContext(ctx, `UPDATE unkey.keys SET suspended_at = ? WHERE id = ?`, suspendedAt, keyId)
+	if err != nil {
+		return fmt.Errorf("unable to set enabled of key %s: %w", keyId, err)
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TouchKeyLastUsed records that the key was used at ts. Older timestamps never overwrite newer ones,
+// verifications on different nodes may finish out of order.
+func (db *database) TouchKeyLastUsed(ctx context.Context, keyId string, ts time.Time) error {
+	_, err := db.write().ExecContext(ctx, `UPDATE unkey.keys SET last_used_at = ? WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)`, ts, keyId, ts)
+	if err != nil {
+		return fmt.Errorf("unable to touch last used of key %s: %w", keyId, err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+func TestTouchKeyLastUsed(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(t, err)
+
+	key := entities.Key{
+		Id:          uid.Key(),
+		KeyAuthId:   uid.KeyAuth(),
+		WorkspaceId: uid.Workspace(),
+		Hash:        uid.New("test"),
+		CreatedAt:   time.Now(),
+	}
+	require.NoError(t, db.CreateKey(ctx, key))
+
+	found, err := db.GetKeyById(ctx, key.Id)
+	require.NoError(t, err)
+	require.True(t, found.LastUsedAt.IsZero())
+
+	now := time.Now().Truncate(time.Second)
+	require.NoError(t, db.TouchKeyLastUsed(ctx, key.Id, now))
+	found, err = db.GetKeyById(ctx, key.Id)
+	require.NoError(t, err)
+	require.Equal(t, now.UnixMilli(), found.LastUsedAt.UnixMilli())
+
+	// a verification that finished late does not move it back
+	require.NoError(t, db.TouchKeyLastUsed(ctx, key.Id, now.Add(-time.Minute)))
+	found, err = db.GetKeyById(ctx, key.Id)
+	require.NoError(t, err)
+	require.Equal(t, now.UnixMilli(), found.LastUsedAt.UnixMilli())
+
+	// updating the key does not reset it
+	found.Name = "renamed"
+	require.NoError(t, db.UpdateKey(ctx, found))
+	found, err = db.GetKeyById(ctx, key.Id)
+	require.NoError(t, err)
+	require.Equal(t, now.UnixMilli(), found.LastUsedAt.UnixMilli())
+}
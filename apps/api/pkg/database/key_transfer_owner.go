@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+// TransferKeysOwner moves all keys of a workspace from one owner to another.
+// Returns the moved keys as they are after the transfer.
+//
+// The keys are locked while they are read, so the returned keys are exactly the ones that were moved,
+// even if keys of the owner are created or changed concurrently.
+func (db *database) TransferKeysOwner(ctx context.Context, workspaceId, fromOwnerId, toOwnerId string) ([]entities.Key, error) {
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to start transaction: %w", err)
+	}
+	// a no-op after commit
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+keyColumns+` FROM unkey.keys WHERE workspace_id = ? AND owner_id = ? FOR UPDATE`, workspaceId, fromOwnerId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load keys to transfer: %w", err)
+	}
+	moved := []entities.Key{}
+	for rows.Next() {
+		k, err := scanKey(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+		e, err := db.keyEntity(k)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("unable to convert key: %w", err)
+		}
+		e.OwnerId = toOwnerId
+		moved = append(moved, e)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to load keys to transfer: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE unkey.keys SET owner_id = ? WHERE workspace_id = ? AND owner_id = ?`, toOwnerId, workspaceId, fromOwnerId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to transfer keys: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("unable to commit transaction: %w", err)
+	}
+	return moved, nil
+}
@@ -17,9 +17,9 @@ func (db *database) UpdateKey(ctx context.Context, key entities.Key) error {
 	db.logger.Info("db Update key", zap.Any("m", m))
 
 	const sqlstr = `UPDATE unkey.keys SET ` +
-		`key_auth_id = ?, hash = ?, start = ?, owner_id = ?, meta = ?, created_at = ?, expires = ?, ratelimit_type = ?, ratelimit_limit = ?, ratelimit_refill_rate = ?, ratelimit_refill_interval = ?, workspace_id = ?, for_workspace_id = ?, name = ?, remaining_requests = ? ` +
+		`key_auth_id = ?, hash = ?, start = ?, owner_id = ?, meta = ?, created_at = ?, expires = ?, ratelimit = ?, workspace_id = ?, for_workspace_id = ?, name = ?, remaining_requests = ?, previous_hash = ?, previous_hash_expires = ?, encrypted = ?, remaining_warn_threshold = ? ` +
 		`WHERE id = ?`
-	_, err = db.write().ExecContext(ctx, sqlstr, m.KeyAuthID.String, m.Hash, m.Start, m.OwnerID, m.Meta, m.CreatedAt, m.Expires, m.RatelimitType, m.RatelimitLimit, m.RatelimitRefillRate, m.RatelimitRefillInterval, m.WorkspaceID, m.ForWorkspaceID, m.Name, m.RemainingRequests, m.ID)
+	_, err = db.write().ExecContext(ctx, sqlstr, m.KeyAuthID.String, m.Hash, m.Start, m.OwnerID, m.Meta, m.CreatedAt, m.Expires, m.Ratelimit, m.WorkspaceID, m.ForWorkspaceID, m.Name, m.RemainingRequests, m.PreviousHash, m.PreviousHashExpires, m.Encrypted, m.RemainingWarnThreshold, m.ID)
 	if err != nil {
 		return fmt.Errorf("unable to update key, %w", err)
 	}
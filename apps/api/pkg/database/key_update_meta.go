@@ -0,0 +1,26 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// UpdateKeyMeta only overwrites the meta column of a key, a nil meta is stored as NULL
+func (db *database) UpdateKeyMeta(ctx context.Context, keyId string, meta map[string]any) error {
+	value := sql.NullString{}
+	if meta != nil {
+		buf, err := json.Marshal(meta)
+		if err != nil {
+			return fmt.Errorf("unable to marshal meta: %w", err)
+		}
+		value = sql.NullString{String: string(buf), Valid: true}
+	}
+
+	_, err := db.write().ExecContext(ctx, `UPDATE unkey.keys SET meta = ? WHERE id = ?`, value, keyId)
+	if err != nil {
+		return fmt.Errorf("unable to update meta of key %s: %w", keyId, err)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+// UpdateKeySecret replaces the secret of a key, the other columns may have changed concurrently
+// and are left alone, unlike UpdateKey which writes the whole row
+func (db *database) UpdateKeySecret(ctx context.Context, key entities.Key) error {
+	m, err := keyEntityToModel(key)
+	if err != nil {
+		return fmt.Errorf("unable to convert key: %w", err)
+	}
+
+	_, err = db.write().ExecContext(ctx,
+		`UPDATE unkey.keys SET hash = ?, start = ?, previous_hash = ?, previous_hash_expires = ?, encrypted = ? WHERE id = ?`,
+		m.Hash, m.Start, m.PreviousHash, m.PreviousHashExpires, m.Encrypted, m.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("unable to update secret of key %s: %w", key.Id, err)
+	}
+	return nil
+}
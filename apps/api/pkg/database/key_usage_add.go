@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/usage"
+)
+
+// IncrementKeyUsage counts a single verification, use AddKeyUsage to write many at once
+func (db *database) IncrementKeyUsage(ctx context.Context, keyId string, ts time.Time) error {
+	return db.AddKeyUsage(ctx, []usage.Count{{KeyId: keyId, Hour: usage.Hour.Truncate(ts), Count: 1}})
+}
+
+// AddKeyUsage adds the counts to their hourly buckets in a single statement
+func (db *database) AddKeyUsage(ctx context.Context, counts []usage.Count) error {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	query := `INSERT INTO unkey.key_usage (key_id, time, count) VALUES ` +
+		strings.TrimSuffix(strings.Repeat("(?, ?, ?),", len(counts)), ",") +
+		` ON DUPLICATE KEY UPDATE count = count + VALUES(count)`
+	args := make([]any, 0, 3*len(counts))
+	for _, c := range counts {
+		args = append(args, c.KeyId, usage.Hour.Truncate(c.Hour), c.Count)
+	}
+
+	_, err := db.write().ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("unable to add key usage: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/usage"
+)
+
+// GetKeyUsage returns the buckets in [from, to) that have at least one verification, oldest first.
+// Days are summed up from the hours, the times of all buckets are in UTC.
+func (db *database) GetKeyUsage(ctx context.Context, keyId string, from, to time.Time, granularity usage.Granularity) ([]usage.Bucket, error) {
+	var query string
+	switch granularity {
+	case usage.Hour:
+		query = `SELECT time, count FROM unkey.key_usage ` +
+			`WHERE key_id = ? AND time >= ? AND time < ? ` +
+			`ORDER BY time`
+	case usage.Day:
+		query = `SELECT DATE(time) AS day, SUM(count) FROM unkey.key_usage ` +
+			`WHERE key_id = ? AND time >= ? AND time < ? ` +
+			`GROUP BY day ORDER BY day`
+	default:
+		return nil, fmt.Errorf("unknown granularity: %s", granularity)
+	}
+
+	rows, err := db.read(ctx).QueryContext(ctx, query, keyId, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("unable to get key usage: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := []usage.Bucket{}
+	for rows.Next() {
+		var b usage.Bucket
+		err := rows.Scan(&b.Time, &b.Count)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+		b.Time = b.Time.UTC()
+		buckets = append(buckets, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to get key usage: %w", err)
+	}
+	return buckets, nil
+}
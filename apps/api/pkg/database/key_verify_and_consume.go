@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/database/models"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+// VerifyAndConsume loads a key by its hash and uses up cost of its remaining verifications in the same transaction.
+//
+// The row is locked while it is read, so concurrent calls can never both consume the last verification.
+// The returned value is the number of remaining verifications after the current one, it never goes below 0.
+// The returned bool is false if there were fewer than cost left and the key was not changed.
+// Keys without a remaining limit are returned unchanged with 0 and false.
+// Keys with DisableOnDepletion are returned suspended when this call used up their last verification.
+func (db *database) VerifyAndConsume(ctx context.Context, hash string, cost int64) (entities.Key, int64, bool, error) {
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return entities.Key{}, 0, false, fmt.Errorf("unable to start transaction: %w", err)
+	}
+	// a no-op after commit
+	defer func() { _ = tx.Rollback() }()
+
+	found, err := scanKey(tx.QueryRowContext(ctx, `SELECT `+keyColumns+` FROM unkey.keys WHERE hash = ? FOR UPDATE`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		found, err = scanKey(tx.QueryRowContext(ctx, `SELECT `+keyColumns+` FROM unkey.keys WHERE previous_hash = ? AND previous_hash_expires > ? FOR UPDATE`, hash, time.Now()))
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entities.Key{}, 0, false, ErrNotFound
+		}
+		return entities.Key{}, 0, false, fmt.Errorf("unable to load key by hash %s from db: %w", hash, err)
+	}
+
+	remainingAfter, consumed, err := consumeRemaining(ctx, tx, found, cost)
+	if err != nil {
+		return entities.Key{}, 0, false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return entities.Key{}, 0, false, fmt.Errorf("unable to commit transaction: %w", err)
+	}
+
+	key, err := db.keyEntity(found)
+	if err != nil {
+		return entities.Key{}, 0, false, err
+	}
+	return key, remainingAfter, consumed, nil
+}
+
+// consumeRemaining decrements the remaining verifications of a locked key, without ever going below 0.
+// Keys with DisableOnDepletion are suspended when the last verification is used up.
+func consumeRemaining(ctx context.Context, tx querier, found *models.Key, cost int64) (int64, bool, error) {
+	if !found.RemainingRequests.Valid {
+		return 0, false, nil
+	}
+
+	consumed, err := decrementRemaining(ctx, tx, found.ID, cost)
+	if err != nil {
+		return 0, false, err
+	}
+	if consumed {
+		found.RemainingRequests.Int64 -= cost
+	}
+	if found.RemainingRequests.Int64 < 0 {
+		found.RemainingRequests.Int64 = 0
+	}
+	if consumed && found.RemainingRequests.Int64 == 0 {
+		suspendedAt, suspended, err := suspendDepleted(ctx, tx, found.ID)
+		if err != nil {
+			return 0, false, err
+		}
+		if suspended {
+			found.SuspendedAt = sql.NullTime{Time: suspendedAt, Valid: true}
+		}
+	}
+	return found.RemainingRequests.Int64, consumed, nil
+}
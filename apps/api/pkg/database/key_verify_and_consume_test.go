@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+func TestVerifyAndConsume_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(t, err)
+
+	key := uid.New("test")
+	keyHash := hash.Sha256(key)
+	err = db.CreateKey(ctx, entities.Key{
+		Id:          uid.Key(),
+		KeyAuthId:   uid.KeyAuth(),
+		WorkspaceId: uid.Workspace(),
+		Hash:        keyHash,
+		CreatedAt:   time.Now(),
+		Remaining: struct {
+			Enabled   bool
+			Remaining int64
+		}{Enabled: true, Remaining: 5},
+	})
+	require.NoError(t, err)
+
+	// more verifications than there are left, all racing for the last one
+	const concurrency = 20
+	type result struct {
+		remaining int64
+		consumed  bool
+	}
+	results := make(chan result, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, remaining, consumed, err := db.VerifyAndConsume(ctx, keyHash, 1)
+			require.NoError(t, err)
+			results <- result{remaining, consumed}
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	consumed := map[int64]bool{}
+	exhausted := 0
+	for r := range results {
+		if !r.consumed {
+			require.Equal(t, int64(0), r.remaining)
+			exhausted++
+			continue
+		}
+		remaining := r.remaining
+		require.False(t, consumed[remaining], "remaining %d was returned twice", remaining)
+		consumed[remaining] = true
+	}
+	require.Len(t, consumed, 5)
+	require.Equal(t, concurrency-5, exhausted)
+
+	found, err := db.GetKeyByHash(ctx, keyHash)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), found.Remaining.Remaining)
+}
+
+func TestVerifyAndConsume_WithoutRemaining(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(t, err)
+
+	key := uid.New("test")
+	err = db.CreateKey(ctx, entities.Key{
+		Id:          uid.Key(),
+		KeyAuthId:   uid.KeyAuth(),
+		WorkspaceId: uid.Workspace(),
+		Hash:        hash.Sha256(key),
+		CreatedAt:   time.Now(),
+	})
+	require.NoError(t, err)
+
+	found, remaining, consumed, err := db.VerifyAndConsume(ctx, hash.Sha256(key), 1)
+	require.NoError(t, err)
+	require.False(t, found.Remaining.Enabled)
+	require.Equal(t, int64(0), remaining)
+	require.False(t, consumed)
+
+	_, _, _, err = db.VerifyAndConsume(ctx, hash.Sha256(uid.New("test")), 1)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestVerifyAndConsume_DisableOnDepletion(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(t, err)
+
+	key := uid.New("test")
+	keyHash := hash.Sha256(key)
+	newKey := entities.Key{
+		Id:                 uid.Key(),
+		KeyAuthId:          uid.KeyAuth(),
+		WorkspaceId:        uid.Workspace(),
+		Hash:               keyHash,
+		CreatedAt:          time.Now(),
+		DisableOnDepletion: true,
+	}
+	newKey.Remaining.Enabled = true
+	newKey.Remaining.Remaining = 2
+	err = db.CreateKey(ctx, newKey)
+	require.NoError(t, err)
+
+	consumed, remaining, ok, err := db.VerifyAndConsume(ctx, keyHash, 1)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(1), remaining)
+	require.True(t, consumed.SuspendedAt.IsZero())
+
+	// the last verification disables the key
+	consumed, remaining, ok, err = db.VerifyAndConsume(ctx, keyHash, 1)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(0), remaining)
+	require.False(t, consumed.SuspendedAt.IsZero())
+
+	found, err := db.GetKeyById(ctx, newKey.Id)
+	require.NoError(t, err)
+	require.True(t, found.DisableOnDepletion)
+	require.Equal(t, int64(0), found.Remaining.Remaining)
+	require.False(t, found.SuspendedAt.IsZero())
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/database/models"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/keys"
+)
+
+// The stored start of a key is its prefix, the separator and the first characters of the random part, see keys.StartLength.
+// Matching on the exact length makes sure "acme" does not match keys with the prefix "acme_internal".
+// Keys created before the number of revealed characters was configured have the default length, so both are matched.
+// Unless they are equal, a prefix that is longer by exactly their difference can not be told apart.
+const prefixMatch = `start LIKE ? ESCAPE '\\' AND CHAR_LENGTH(start) IN (?, ?)`
+
+// escapeLike escapes the wildcards of a LIKE pattern, so they match literally
+var escapeLike = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace
+
+func prefixMatchArgs(prefix string, startChars int) []any {
+	// CHAR_LENGTH counts characters, the prefix may contain multibyte characters but the rest of the start is ascii
+	length := func(startChars int) int {
+		return utf8.RuneCountInString(prefix) + keys.StartLength(prefix, startChars) - len(prefix)
+	}
+	return []any{escapeLike(prefix) + escapeLike(keys.Separator) + `%`, length(startChars), length(keys.DefaultStartChars)}
+}
+
+// ListKeysByPrefix returns all keys of a keyAuth that were created with the given prefix.
+func (db *database) ListKeysByPrefix(ctx context.Context, keyAuthId string, prefix string) ([]entities.Key, error) {
+	query := `SELECT ` +
+		`id, hash, start, owner_id, meta, created_at, expires, ratelimit, ratelimit_type, ratelimit_limit, ratelimit_refill_rate, ratelimit_refill_interval, workspace_id, for_workspace_id, key_auth_id, name, remaining_requests, suspended_at, parent_key_id ` +
+		`FROM unkey.keys ` +
+		`WHERE key_auth_id = ? AND ` + prefixMatch
+
+	rows, err := db.read(ctx).QueryContext(ctx, query, append([]any{keyAuthId}, prefixMatchArgs(prefix, db.keyStartChars)...)...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list keys from db: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []entities.Key{}
+	for rows.Next() {
+		k := &models.Key{}
+		err := rows.Scan(&k.ID, &k.Hash, &k.Start, &k.OwnerID, &k.Meta, &k.CreatedAt, &k.Expires, &k.Ratelimit, &k.RatelimitType, &k.RatelimitLimit, &k.RatelimitRefillRate, &k.RatelimitRefillInterval, &k.WorkspaceID, &k.ForWorkspaceID, &k.KeyAuthID, &k.Name, &k.RemainingRequests, &k.SuspendedAt, &k.ParentKeyID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+
+		e, err := db.keyEntity(k)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert key: %w", err)
+		}
+
+		keys = append(keys, e)
+	}
+
+	return keys, rows.Err()
+}
+
+// DeleteKeysByPrefix deletes all keys of a keyAuth that were created with the given prefix.
+// Returns the number of deleted keys.
+func (db *database) DeleteKeysByPrefix(ctx context.Context, keyAuthId string, prefix string) (int, error) {
+	query := `DELETE FROM unkey.keys WHERE key_auth_id = ? AND ` + prefixMatch
+
+	res, err := db.write().ExecContext(ctx, query, append([]any{keyAuthId}, prefixMatchArgs(prefix, db.keyStartChars)...)...)
+	if err != nil {
+		return 0, fmt.Errorf("unable to delete keys: %w", err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("unable to count deleted keys: %w", err)
+	}
+	return int(deleted), nil
+}
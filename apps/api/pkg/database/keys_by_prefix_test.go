@@ -0,0 +1,19 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/keys"
+)
+
+func TestPrefixMatchArgs(t *testing.T) {
+	require.Equal(t, []any{`acme\_%`, 9, 9}, prefixMatchArgs("acme", keys.DefaultStartChars))
+	// wildcards in the prefix must match literally
+	require.Equal(t, []any{`a\%b\_c\_%`, 10, 10}, prefixMatchArgs("a%b_c", keys.DefaultStartChars))
+	require.Equal(t, []any{`a\\b\_%`, 8, 8}, prefixMatchArgs(`a\b`, keys.DefaultStartChars))
+	// CHAR_LENGTH counts characters, not bytes
+	require.Equal(t, []any{`schlüssel\_%`, 14, 14}, prefixMatchArgs("schlüssel", keys.DefaultStartChars))
+	// keys that reveal nothing and keys created with the default
+	require.Equal(t, []any{`acme\_%`, 5, 9}, prefixMatchArgs("acme", 0))
+}
@@ -8,7 +8,7 @@ import (
 func (db *database) CountKeys(ctx context.Context, keyAuthId string) (int, error) {
 
 	const query = "SELECT count(*) FROM unkey.keys WHERE key_auth_id = ? "
-	row := db.read().QueryRow(query, keyAuthId)
+	row := db.read(ctx).QueryRowContext(ctx, query, keyAuthId)
 
 	count := 0
 	err := row.Scan(&count)
@@ -0,0 +1,23 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// CountKeysExpiringBetween counts the keys of a workspace that expire after `from` and no later than `to`.
+// Keys without an expiry are never counted.
+func (db *database) CountKeysExpiringBetween(ctx context.Context, workspaceId string, from time.Time, to time.Time) (int, error) {
+
+	// workspace_id_expires_idx covers the filter
+	const query = "SELECT count(*) FROM unkey.keys WHERE workspace_id = ? AND expires > ? AND expires <= ?"
+	row := db.read(ctx).QueryRowContext(ctx, query, workspaceId, from, to)
+
+	count := 0
+	err := row.Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("unable to count expiring keys of workspace: %w", err)
+	}
+	return count, nil
+}
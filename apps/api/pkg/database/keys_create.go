@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+// CreateKeys inserts all keys in a single transaction, either all keys are created or none.
+// The error wraps ErrNotUnique if the id or hash of a key is taken.
+func (db *database) CreateKeys(ctx context.Context, newKeys []entities.Key) error {
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %w", err)
+	}
+
+	for _, newKey := range newKeys {
+		key, err := keyEntityToModel(newKey)
+		if err != nil {
+			rollbackErr := tx.Rollback()
+			if rollbackErr != nil {
+				return fmt.Errorf("unable to roll back: %w", rollbackErr)
+			}
+			return fmt.Errorf("unable to convert key: %w", err)
+		}
+
+		err = key.Insert(ctx, tx)
+		if err != nil {
+			rollbackErr := tx.Rollback()
+			if rollbackErr != nil {
+				return fmt.Errorf("unable to roll back: %w", rollbackErr)
+			}
+			if isDuplicateEntry(err) {
+				err = ErrNotUnique
+			}
+			return fmt.Errorf("unable to insert key %s: %w", newKey.Id, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("unable to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+func TestCreateKeys_NotUnique(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(t, err)
+
+	key := entities.Key{
+		Id:          uid.Key(),
+		KeyAuthId:   uid.KeyAuth(),
+		WorkspaceId: uid.Workspace(),
+		Hash:        hash.Sha256(uid.New("test")),
+		CreatedAt:   time.Now(),
+	}
+	require.NoError(t, db.CreateKeys(ctx, []entities.Key{key}))
+
+	// same id, new hash
+	taken := key
+	taken.Hash = hash.Sha256(uid.New("test"))
+	err = db.CreateKeys(ctx, []entities.Key{taken})
+	require.ErrorIs(t, err, ErrNotUnique)
+}
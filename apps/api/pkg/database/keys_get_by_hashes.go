@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+// GetKeysByHashes loads many keys in a single query, keyed by the requested hash.
+// Like GetKeyByHash it also finds rerolled keys by the hash of their previous secret.
+// Hashes that match no key are missing from the result.
+func (db *database) GetKeysByHashes(ctx context.Context, hashes []string) (map[string]entities.Key, error) {
+	found := map[string]entities.Key{}
+	if len(hashes) == 0 {
+		return found, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(hashes)), ",")
+	query := `SELECT ` + keyColumns + ` ` +
+		`FROM unkey.keys ` +
+		fmt.Sprintf(`WHERE hash IN (%s) OR (previous_hash IN (%s) AND previous_hash_expires > ?)`, placeholders, placeholders)
+
+	args := make([]any, 0, 2*len(hashes)+1)
+	for _, h := range hashes {
+		args = append(args, h)
+	}
+	for _, h := range hashes {
+		args = append(args, h)
+	}
+	args = append(args, time.Now())
+
+	rows, err := db.read(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load %d keys by hash from db: %w", len(hashes), err)
+	}
+	defer rows.Close()
+
+	requested := make(map[string]bool, len(hashes))
+	for _, h := range hashes {
+		requested[h] = true
+	}
+	for rows.Next() {
+		k, err := scanKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+		e, err := db.keyEntity(k)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert key: %w", err)
+		}
+		if requested[e.Hash] {
+			found[e.Hash] = e
+		}
+		if e.PreviousHash != "" && requested[e.PreviousHash] {
+			found[e.PreviousHash] = e
+		}
+	}
+	return found, rows.Err()
+}
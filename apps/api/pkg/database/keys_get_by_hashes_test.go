@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+func TestGetKeysByHashes(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(t, err)
+
+	keyAuthId := uid.KeyAuth()
+	workspaceId := uid.Workspace()
+	hashes := []string{}
+	for i := 0; i < 2; i++ {
+		key := entities.Key{
+			Id:          uid.Key(),
+			KeyAuthId:   keyAuthId,
+			WorkspaceId: workspaceId,
+			Hash:        hash.Sha256(uid.New("test")),
+			CreatedAt:   time.Now(),
+		}
+		require.NoError(t, db.CreateKey(ctx, key))
+		hashes = append(hashes, key.Hash)
+	}
+	unknown := hash.Sha256(uid.New("test"))
+
+	found, err := db.GetKeysByHashes(ctx, append(hashes, unknown))
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	for _, h := range hashes {
+		require.Equal(t, h, found[h].Hash)
+	}
+	require.NotContains(t, found, unknown)
+
+	found, err = db.GetKeysByHashes(ctx, []string{})
+	require.NoError(t, err)
+	require.Empty(t, found)
+}
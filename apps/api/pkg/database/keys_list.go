@@ -7,10 +7,12 @@ import (
 	"github.com/unkeyed/unkey/apps/api/pkg/entities"
 )
 
-func (db *database) ListKeysByKeyAuthId(ctx context.Context, keyAuthId string, limit int, offset int, ownerId string) ([]entities.Key, error) {
+// ListKeysByKeyAuthId returns a page of keys and how many keys match the filter in total.
+func (db *database) ListKeysByKeyAuthId(ctx context.Context, keyAuthId string, limit int, offset int, ownerId string) ([]entities.Key, int, error) {
 
+	// The window is computed before LIMIT and OFFSET are applied, so we get the total in the same round trip
 	query := `SELECT ` +
-		`id, hash, start, owner_id, meta, created_at, expires, ratelimit_type, ratelimit_limit, ratelimit_refill_rate, ratelimit_refill_interval, workspace_id, for_workspace_id, key_auth_id ` +
+		`id, hash, start, owner_id, meta, created_at, expires, ratelimit, ratelimit_type, ratelimit_limit, ratelimit_refill_rate, ratelimit_refill_interval, workspace_id, for_workspace_id, key_auth_id, suspended_at, parent_key_id, COUNT(*) OVER () ` +
 		`FROM unkey.keys ` +
 		`WHERE key_auth_id = ?`
 	if ownerId != "" {
@@ -27,29 +29,58 @@ func (db *database) ListKeysByKeyAuthId(ctx context.Context, keyAuthId string, l
 	}
 	args = append(args, limit, offset)
 
-	rows, err := db.read().Query(query, args...)
+	rows, err := db.read(ctx).QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("unable to list keys from db: %w", err)
+		return nil, 0, fmt.Errorf("unable to list keys from db: %w", err)
 	}
 	defer rows.Close()
 
 	keys := []entities.Key{}
+	total := 0
 	for rows.Next() {
 
 		k := &models.Key{}
-		err := rows.Scan(&k.ID, &k.Hash, &k.Start, &k.OwnerID, &k.Meta, &k.CreatedAt, &k.Expires, &k.RatelimitType, &k.RatelimitLimit, &k.RatelimitRefillRate, &k.RatelimitRefillInterval, &k.WorkspaceID, &k.ForWorkspaceID, &k.KeyAuthID)
+		err := rows.Scan(&k.ID, &k.Hash, &k.Start, &k.OwnerID, &k.Meta, &k.CreatedAt, &k.Expires, &k.Ratelimit, &k.RatelimitType, &k.RatelimitLimit, &k.RatelimitRefillRate, &k.RatelimitRefillInterval, &k.WorkspaceID, &k.ForWorkspaceID, &k.KeyAuthID, &k.SuspendedAt, &k.ParentKeyID, &total)
 		if err != nil {
-			return nil, fmt.Errorf("unable to scan row: %w", err)
+			return nil, 0, fmt.Errorf("unable to scan row: %w", err)
 		}
 
-		e, err := keyModelToEntity(k)
+		e, err := db.keyEntity(k)
 		if err != nil {
-			return nil, fmt.Errorf("unable to convert key: %w", err)
+			return nil, 0, fmt.Errorf("unable to convert key: %w", err)
 		}
 
 		keys = append(keys, e)
 	}
+	err = rows.Err()
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to list keys from db: %w", err)
+	}
+
+	// A page past the end has no rows to carry the total
+	if len(keys) == 0 && offset > 0 {
+		total, err = db.countKeysByOwner(ctx, keyAuthId, ownerId)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
 
-	return keys, nil
+	return keys, total, nil
+
+}
 
+func (db *database) countKeysByOwner(ctx context.Context, keyAuthId string, ownerId string) (int, error) {
+	query := "SELECT count(*) FROM unkey.keys WHERE key_auth_id = ?"
+	args := []any{keyAuthId}
+	if ownerId != "" {
+		query += " AND owner_id = ?"
+		args = append(args, ownerId)
+	}
+
+	count := 0
+	err := db.read(ctx).QueryRowContext(ctx, query, args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("unable to count keys: %w", err)
+	}
+	return count, nil
 }
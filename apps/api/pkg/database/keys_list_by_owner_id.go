@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/database/models"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+// ListKeysByOwnerId returns all keys of a workspace that belong to the given owner.
+func (db *database) ListKeysByOwnerId(ctx context.Context, workspaceId string, ownerId string) ([]entities.Key, error) {
+
+	const query = `SELECT ` +
+		`id, hash, start, owner_id, meta, created_at, expires, ratelimit, ratelimit_type, ratelimit_limit, ratelimit_refill_rate, ratelimit_refill_interval, workspace_id, for_workspace_id, key_auth_id, name, remaining_requests, suspended_at, parent_key_id ` +
+		`FROM unkey.keys ` +
+		`WHERE workspace_id = ? AND owner_id = ? ` +
+		`ORDER BY created_at ASC`
+
+	rows, err := db.read(ctx).QueryContext(ctx, query, workspaceId, ownerId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list keys from db: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []entities.Key{}
+	for rows.Next() {
+		k := &models.Key{}
+		err := rows.Scan(&k.ID, &k.Hash, &k.Start, &k.OwnerID, &k.Meta, &k.CreatedAt, &k.Expires, &k.Ratelimit, &k.RatelimitType, &k.RatelimitLimit, &k.RatelimitRefillRate, &k.RatelimitRefillInterval, &k.WorkspaceID, &k.ForWorkspaceID, &k.KeyAuthID, &k.Name, &k.RemainingRequests, &k.SuspendedAt, &k.ParentKeyID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+
+		e, err := db.keyEntity(k)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert key: %w", err)
+		}
+
+		keys = append(keys, e)
+	}
+
+	return keys, rows.Err()
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/database/models"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+// ListKeysByWorkspaceId returns up to limit keys of a workspace with an id greater than afterId,
+// ordered by id. Pass the id of the last key of a page to get the next one, an empty afterId starts
+// at the beginning. Unlike an offset, the cursor stays cheap on the last page of a large workspace.
+// Secrets are never selected, the hash of the returned keys is empty.
+func (db *database) ListKeysByWorkspaceId(ctx context.Context, workspaceId string, afterId string, limit int) ([]entities.Key, error) {
+
+	// workspace_id_id_idx serves the filter and the order
+	const sqlstr = `SELECT ` +
+		`id, start, owner_id, meta, created_at, expires, ratelimit, ratelimit_type, ratelimit_limit, ratelimit_refill_rate, ratelimit_refill_interval, workspace_id, for_workspace_id, key_auth_id, name, remaining_requests, suspended_at, parent_key_id ` +
+		`FROM unkey.keys ` +
+		`WHERE workspace_id = ? AND id > ? ` +
+		`ORDER BY id ASC LIMIT ?`
+
+	rows, err := db.read(ctx).QueryContext(ctx, sqlstr, workspaceId, afterId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list keys of workspace from db: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []entities.Key{}
+	for rows.Next() {
+		k := &models.Key{}
+		err := rows.Scan(&k.ID, &k.Start, &k.OwnerID, &k.Meta, &k.CreatedAt, &k.Expires, &k.Ratelimit, &k.RatelimitType, &k.RatelimitLimit, &k.RatelimitRefillRate, &k.RatelimitRefillInterval, &k.WorkspaceID, &k.ForWorkspaceID, &k.KeyAuthID, &k.Name, &k.RemainingRequests, &k.SuspendedAt, &k.ParentKeyID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+
+		e, err := db.keyEntity(k)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert key: %w", err)
+		}
+
+		keys = append(keys, e)
+	}
+
+	return keys, rows.Err()
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+func TestListKeysByWorkspaceId(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(t, err)
+
+	workspaceId := uid.Workspace()
+	created := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		k := entities.Key{
+			Id:          uid.Key(),
+			KeyAuthId:   uid.KeyAuth(),
+			WorkspaceId: workspaceId,
+			Hash:        uid.NewWithByteLength("", 32),
+			CreatedAt:   time.Now(),
+		}
+		require.NoError(t, db.CreateKey(ctx, k))
+		created[k.Id] = true
+	}
+
+	found := map[string]bool{}
+	afterId := ""
+	pages := 0
+	for {
+		page, err := db.ListKeysByWorkspaceId(ctx, workspaceId, afterId, 2)
+		require.NoError(t, err)
+		if len(page) == 0 {
+			break
+		}
+		pages++
+		for _, k := range page {
+			require.Greater(t, k.Id, afterId)
+			require.Empty(t, k.Hash)
+			require.Equal(t, workspaceId, k.WorkspaceId)
+			found[k.Id] = true
+			afterId = k.Id
+		}
+	}
+	require.Equal(t, 3, pages)
+	require.Equal(t, created, found)
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/database/models"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+// ListKeysExpiringBetween returns a page of keys that expire after `from` and no later than `to`, soonest first.
+// Keys without an expiry are never returned.
+func (db *database) ListKeysExpiringBetween(ctx context.Context, keyAuthId string, from time.Time, to time.Time, limit int, offset int) ([]entities.Key, error) {
+
+	// key_auth_id_expires_idx covers both the filter and the order
+	const query = `SELECT ` +
+		`id, hash, start, owner_id, meta, created_at, expires, ratelimit, ratelimit_type, ratelimit_limit, ratelimit_refill_rate, ratelimit_refill_interval, workspace_id, for_workspace_id, key_auth_id, name, remaining_requests, suspended_at, parent_key_id ` +
+		`FROM unkey.keys ` +
+		`WHERE key_auth_id = ? AND expires > ? AND expires <= ? ` +
+		`ORDER BY expires ASC, id ASC LIMIT ? OFFSET ?`
+
+	rows, err := db.read(ctx).QueryContext(ctx, query, keyAuthId, from, to, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list expiring keys from db: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []entities.Key{}
+	for rows.Next() {
+		k := &models.Key{}
+		err := rows.Scan(&k.ID, &k.Hash, &k.Start, &k.OwnerID, &k.Meta, &k.CreatedAt, &k.Expires, &k.Ratelimit, &k.RatelimitType, &k.RatelimitLimit, &k.RatelimitRefillRate, &k.RatelimitRefillInterval, &k.WorkspaceID, &k.ForWorkspaceID, &k.KeyAuthID, &k.Name, &k.RemainingRequests, &k.SuspendedAt, &k.ParentKeyID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+
+		e, err := db.keyEntity(k)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert key: %w", err)
+		}
+
+		keys = append(keys, e)
+	}
+
+	return keys, rows.Err()
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// MigrateRatelimits copies the ratelimits of keys from the old ratelimit_* columns into the
+// ratelimit json column, batchSize keys at a time, and returns how many keys were migrated.
+// It is idempotent, keys that already have a ratelimit are left alone. Until then keys are read with
+// the ratelimit of the old columns, once it returns without an error they can be dropped from the
+// queries and the table.
+func (db *database) MigrateRatelimits(ctx context.Context, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		return 0, fmt.Errorf("batchSize must be positive, got %d", batchSize)
+	}
+
+	migrated := 0
+	// paging by id visits every key once, even if the replica has not seen our updates yet
+	lastId := ""
+	for {
+		const query = `SELECT id, ratelimit_type, ratelimit_limit, ratelimit_refill_rate, ratelimit_refill_interval FROM unkey.keys ` +
+			`WHERE ratelimit IS NULL AND ratelimit_type IS NOT NULL AND id > ? ` +
+			`ORDER BY id LIMIT ?`
+		rows, err := db.read(ctx).QueryContext(ctx, query, lastId, batchSize)
+		if err != nil {
+			return migrated, fmt.Errorf("unable to load keys to migrate: %w", err)
+		}
+		type legacyRatelimit struct {
+			id                                string
+			ratelimitType                     sql.NullString
+			limit, refillRate, refillInterval sql.NullInt64
+		}
+		batch := []legacyRatelimit{}
+		for rows.Next() {
+			k := legacyRatelimit{}
+			err = rows.Scan(&k.id, &k.ratelimitType, &k.limit, &k.refillRate, &k.refillInterval)
+			if err != nil {
+				rows.Close()
+				return migrated, fmt.Errorf("unable to scan key: %w", err)
+			}
+			batch = append(batch, k)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return migrated, fmt.Errorf("unable to load keys to migrate: %w", err)
+		}
+
+		for _, k := range batch {
+			lastId = k.id
+			ratelimit, err := marshalRatelimit(ratelimitFromColumns(k.ratelimitType, k.limit, k.refillRate, k.refillInterval))
+			if err != nil {
+				return migrated, fmt.Errorf("unable to convert ratelimit of key %s: %w", k.id, err)
+			}
+			if !ratelimit.Valid {
+				continue
+			}
+			// the key may have been updated since it was read, that value is already current
+			res, err := db.write().ExecContext(ctx, `UPDATE unkey.keys SET ratelimit = ? WHERE id = ? AND ratelimit IS NULL`, ratelimit, k.id)
+			if err != nil {
+				return migrated, fmt.Errorf("unable to update key %s: %w", k.id, err)
+			}
+			updated, err := res.RowsAffected()
+			if err != nil {
+				return migrated, fmt.Errorf("unable to update key %s: %w", k.id, err)
+			}
+			migrated += int(updated)
+		}
+
+		if len(batch) < batchSize {
+			return migrated, nil
+		}
+	}
+}
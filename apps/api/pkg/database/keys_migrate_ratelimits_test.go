@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+func TestMigrateRatelimits(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(t, err)
+
+	newKey := func(ratelimit *entities.Ratelimit) entities.Key {
+		key := entities.Key{
+			Id:          uid.Key(),
+			KeyAuthId:   uid.KeyAuth(),
+			WorkspaceId: uid.Workspace(),
+			Hash:        uid.New("test"),
+			CreatedAt:   time.Now(),
+			Ratelimit:   ratelimit,
+		}
+		require.NoError(t, db.CreateKey(ctx, key))
+		return key
+	}
+
+	// written before the ratelimit column existed
+	legacy := newKey(nil)
+	_, err = db.(*database).write().ExecContext(ctx,
+		`UPDATE unkey.keys SET ratelimit_type = ?, ratelimit_limit = ?, ratelimit_refill_rate = NULL, ratelimit_refill_interval = ? WHERE id = ?`,
+		"fast", 10, 1000, legacy.Id,
+	)
+	require.NoError(t, err)
+
+	// updated after the ratelimit column existed, the old columns are stale
+	current := newKey(&entities.Ratelimit{Type: "consistent", Limit: 5, RefillRate: 5, RefillInterval: 60000})
+	_, err = db.(*database).write().ExecContext(ctx,
+		`UPDATE unkey.keys SET ratelimit_type = ?, ratelimit_limit = ? WHERE id = ?`,
+		"fast", 100, current.Id,
+	)
+	require.NoError(t, err)
+
+	found, err := db.GetKeyById(ctx, legacy.Id)
+	require.NoError(t, err)
+	require.Nil(t, found.Ratelimit)
+
+	migrated, err := db.MigrateRatelimits(ctx, 1)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, migrated, 1)
+
+	found, err = db.GetKeyById(ctx, legacy.Id)
+	require.NoError(t, err)
+	require.Equal(t, &entities.Ratelimit{Type: "fast", Limit: 10, RefillInterval: 1000}, found.Ratelimit)
+
+	found, err = db.GetKeyById(ctx, current.Id)
+	require.NoError(t, err)
+	require.Equal(t, current.Ratelimit, found.Ratelimit)
+
+	// the migrated value survives an update
+	require.NoError(t, db.UpdateKey(ctx, found))
+	found, err = db.GetKeyById(ctx, current.Id)
+	require.NoError(t, err)
+	require.Equal(t, current.Ratelimit, found.Ratelimit)
+
+	// nothing left to migrate
+	migrated, err = db.MigrateRatelimits(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, 0, migrated)
+}
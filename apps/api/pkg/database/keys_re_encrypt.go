@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/encryption"
+)
+
+// ReEncryptKeys encrypts the secrets of recoverable keys with the active version of the keyring,
+// batchSize keys at a time, and returns how many keys were migrated. Once it returns without an
+// error, older versions can be removed from the keyring.
+func (db *database) ReEncryptKeys(ctx context.Context, batchSize int) (int, error) {
+	if db.keyring == nil {
+		return 0, errors.New("no keyring configured")
+	}
+	if batchSize <= 0 {
+		return 0, fmt.Errorf("batchSize must be positive, got %d", batchSize)
+	}
+	activePrefix := fmt.Sprintf("v%d.%%", db.keyring.ActiveVersion())
+
+	migrated := 0
+	// paging by id visits every key once, even if the replica has not seen our updates yet
+	lastId := ""
+	for {
+		const query = `SELECT id, workspace_id, encrypted FROM unkey.keys ` +
+			`WHERE encrypted IS NOT NULL AND encrypted NOT LIKE ? AND id > ? ` +
+			`ORDER BY id LIMIT ?`
+		rows, err := db.read(ctx).QueryContext(ctx, query, activePrefix, lastId, batchSize)
+		if err != nil {
+			return migrated, fmt.Errorf("unable to load keys to re-encrypt: %w", err)
+		}
+		type encryptedKey struct {
+			id, workspaceId, encrypted string
+		}
+		batch := []encryptedKey{}
+		for rows.Next() {
+			k := encryptedKey{}
+			err = rows.Scan(&k.id, &k.workspaceId, &k.encrypted)
+			if err != nil {
+				rows.Close()
+				return migrated, fmt.Errorf("unable to scan key: %w", err)
+			}
+			batch = append(batch, k)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return migrated, fmt.Errorf("unable to load keys to re-encrypt: %w", err)
+		}
+
+		for _, k := range batch {
+			lastId = k.id
+			plaintext, err := db.keyring.Decrypt(k.workspaceId, k.encrypted)
+			if err != nil {
+				if errors.Is(err, encryption.ErrUnknownVersion) {
+					return migrated, fmt.Errorf("key %s was encrypted with a version that is no longer in the keyring: %w", k.id, err)
+				}
+				return migrated, fmt.Errorf("unable to decrypt key %s: %w", k.id, err)
+			}
+			reEncrypted, err := db.keyring.Encrypt(k.workspaceId, plaintext)
+			if err != nil {
+				return migrated, fmt.Errorf("unable to encrypt key %s: %w", k.id, err)
+			}
+			// the key may have been rerolled since it was read, that value is already current
+			res, err := db.write().ExecContext(ctx, `UPDATE unkey.keys SET encrypted = ? WHERE id = ? AND encrypted = ?`, reEncrypted, k.id, k.encrypted)
+			if err != nil {
+				return migrated, fmt.Errorf("unable to update key %s: %w", k.id, err)
+			}
+			updated, err := res.RowsAffected()
+			if err != nil {
+				return migrated, fmt.Errorf("unable to update key %s: %w", k.id, err)
+			}
+			migrated += int(updated)
+		}
+
+		if len(batch) < batchSize {
+			return migrated, nil
+		}
+	}
+}
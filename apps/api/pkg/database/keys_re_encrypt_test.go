@@ -0,0 +1,71 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/encryption"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+func TestReEncryptKeys(t *testing.T) {
+	ctx := context.Background()
+	v1Key := bytes.Repeat([]byte{1}, encryption.KeySize)
+	v2Key := bytes.Repeat([]byte{2}, encryption.KeySize)
+
+	v1, err := encryption.NewKeyring(map[int][]byte{1: v1Key}, 1)
+	require.NoError(t, err)
+	v2, err := encryption.NewKeyring(map[int][]byte{1: v1Key, 2: v2Key}, 2)
+	require.NoError(t, err)
+
+	db, err := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+		Keyring:   v2,
+	})
+	require.NoError(t, err)
+
+	workspaceId := uid.Workspace()
+	plaintext := uid.New("test")
+	encrypted, err := v1.Encrypt(workspaceId, plaintext)
+	require.NoError(t, err)
+	key := entities.Key{
+		Id:          uid.Key(),
+		KeyAuthId:   uid.KeyAuth(),
+		WorkspaceId: workspaceId,
+		Hash:        hash.Sha256(plaintext),
+		CreatedAt:   time.Now(),
+		Encrypted:   encrypted,
+	}
+	require.NoError(t, db.CreateKey(ctx, key))
+
+	// v2 is active, but v1 values still decrypt
+	recovered, err := v2.Decrypt(workspaceId, encrypted)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, recovered)
+
+	migrated, err := db.ReEncryptKeys(ctx, 1)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, migrated, 1)
+
+	found, err := db.GetKeyById(ctx, key.Id)
+	require.NoError(t, err)
+	version, err := encryption.Version(found.Encrypted)
+	require.NoError(t, err)
+	require.Equal(t, 2, version)
+	recovered, err = v2.Decrypt(workspaceId, found.Encrypted)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, recovered)
+
+	// nothing left to migrate
+	migrated, err = db.ReEncryptKeys(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, 0, migrated)
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/encryption"
+	"github.com/unkeyed/unkey/apps/api/pkg/keys"
+)
+
+// RecomputeKeyStarts recomputes the start of recoverable keys with the current start chars,
+// batchSize keys at a time. Only recoverable keys can be recomputed, because we need their secret.
+// It returns how many keys were updated, and how many were skipped because they are not recoverable,
+// their secret is not in a format we know, or their start is already current.
+func (db *database) RecomputeKeyStarts(ctx context.Context, batchSize int) (updated int, skipped int, err error) {
+	if db.keyring == nil {
+		return 0, 0, errors.New("no keyring configured")
+	}
+	if batchSize <= 0 {
+		return 0, 0, fmt.Errorf("batchSize must be positive, got %d", batchSize)
+	}
+
+	// paging by id visits every key once, even if the replica has not seen our updates yet
+	lastId := ""
+	for {
+		const query = `SELECT id, workspace_id, start, encrypted FROM unkey.keys WHERE id > ? ORDER BY id LIMIT ?`
+		rows, err := db.read(ctx).QueryContext(ctx, query, lastId, batchSize)
+		if err != nil {
+			return updated, skipped, fmt.Errorf("unable to load keys to recompute: %w", err)
+		}
+		type startKey struct {
+			id, workspaceId, start string
+			encrypted              sql.NullString
+		}
+		batch := []startKey{}
+		for rows.Next() {
+			k := startKey{}
+			err = rows.Scan(&k.id, &k.workspaceId, &k.start, &k.encrypted)
+			if err != nil {
+				rows.Close()
+				return updated, skipped, fmt.Errorf("unable to scan key: %w", err)
+			}
+			batch = append(batch, k)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return updated, skipped, fmt.Errorf("unable to load keys to recompute: %w", err)
+		}
+
+		for _, k := range batch {
+			lastId = k.id
+			start, changed, err := recomputeStart(db.keyring, db.keyStartChars, k.workspaceId, k.encrypted.String, k.start)
+			if err != nil {
+				return updated, skipped, fmt.Errorf("unable to recompute start of key %s: %w", k.id, err)
+			}
+			if !changed {
+				skipped++
+				continue
+			}
+			// the key may have been rerolled since it was read, its start is already current
+			res, err := db.write().ExecContext(ctx, `UPDATE unkey.keys SET start = ? WHERE id = ? AND encrypted = ?`, start, k.id, k.encrypted.String)
+			if err != nil {
+				return updated, skipped, fmt.Errorf("unable to update key %s: %w", k.id, err)
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return updated, skipped, fmt.Errorf("unable to update key %s: %w", k.id, err)
+			}
+			updated += int(n)
+			skipped += 1 - int(n)
+		}
+
+		if len(batch) < batchSize {
+			return updated, skipped, nil
+		}
+	}
+}
+
+// recomputeStart returns the start a key should have and whether it differs from the stored one.
+// Keys without a secret, or with a secret created outside the keys package, keep their start.
+// Keys stored without a start, see entities.Workspace.OmitKeyStart, keep not having one.
+func recomputeStart(keyring *encryption.Keyring, startChars int, workspaceId, encrypted, start string) (string, bool, error) {
+	if encrypted == "" || start == "" {
+		return start, false, nil
+	}
+	plaintext, err := keyring.Decrypt(workspaceId, encrypted)
+	if err != nil {
+		if errors.Is(err, encryption.ErrUnknownVersion) {
+			return "", false, fmt.Errorf("the key was encrypted with a version that is no longer in the keyring: %w", err)
+		}
+		return "", false, fmt.Errorf("unable to decrypt key: %w", err)
+	}
+	recomputed, err := keys.Start(plaintext, startChars)
+	if err != nil {
+		return start, false, nil
+	}
+	return recomputed, recomputed != start, nil
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/encryption"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/keys"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+func TestRecomputeStart(t *testing.T) {
+	keyring, err := encryption.NewKeyring(map[int][]byte{1: bytes.Repeat([]byte{1}, encryption.KeySize)}, 1)
+	require.NoError(t, err)
+	workspaceId := uid.Workspace()
+
+	created, oldStart, err := keys.NewV1Key("sk", 16, keys.WithStartChars(4))
+	require.NoError(t, err)
+	encrypted, err := keyring.Encrypt(workspaceId, created)
+	require.NoError(t, err)
+	imported, err := keyring.Encrypt(workspaceId, "imported_from_elsewhere")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		encrypted string
+		start     string
+		want      string
+		changed   bool
+	}{
+		{name: "recoverable", encrypted: encrypted, start: oldStart, want: created[:len("sk_")+2], changed: true},
+		{name: "already current", encrypted: encrypted, start: created[:len("sk_")+2], want: created[:len("sk_")+2], changed: false},
+		{name: "not recoverable", encrypted: "", start: "sk_abcd", want: "sk_abcd", changed: false},
+		{name: "unknown format", encrypted: imported, start: "impo", want: "impo", changed: false},
+		{name: "stored without start", encrypted: encrypted, start: "", want: "", changed: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			start, changed, err := recomputeStart(keyring, 2, workspaceId, tc.encrypted, tc.start)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, start)
+			require.Equal(t, tc.changed, changed)
+		})
+	}
+
+	other, err := encryption.NewKeyring(map[int][]byte{2: bytes.Repeat([]byte{2}, encryption.KeySize)}, 2)
+	require.NoError(t, err)
+	_, _, err = recomputeStart(other, 2, workspaceId, encrypted, oldStart)
+	require.ErrorContains(t, err, "no longer in the keyring")
+}
+
+func TestRecomputeKeyStarts(t *testing.T) {
+	ctx := context.Background()
+	// the keys of TestReEncryptKeys, so the keys it left behind can be decrypted too
+	keyring, err := encryption.NewKeyring(map[int][]byte{
+		1: bytes.Repeat([]byte{1}, encryption.KeySize),
+		2: bytes.Repeat([]byte{2}, encryption.KeySize),
+	}, 2)
+	require.NoError(t, err)
+	startChars := 2
+	db, err := New(Config{
+		Logger:        logging.NewNoopLogger(),
+		PrimaryUs:     os.Getenv("DATABASE_DSN"),
+		Keyring:       keyring,
+		KeyStartChars: &startChars,
+	})
+	require.NoError(t, err)
+
+	workspaceId := uid.Workspace()
+	newKey := func(recoverable bool) (entities.Key, string) {
+		plaintext, start, err := keys.NewV1Key("sk", 16, keys.WithStartChars(4))
+		require.NoError(t, err)
+		key := entities.Key{
+			Id:          uid.Key(),
+			KeyAuthId:   uid.KeyAuth(),
+			WorkspaceId: workspaceId,
+			Hash:        hash.Sha256(plaintext),
+			Start:       start,
+			CreatedAt:   time.Now(),
+		}
+		if recoverable {
+			key.Encrypted, err = keyring.Encrypt(workspaceId, plaintext)
+			require.NoError(t, err)
+		}
+		require.NoError(t, db.CreateKey(ctx, key))
+		return key, plaintext
+	}
+	recoverable, plaintext := newKey(true)
+	notRecoverable, _ := newKey(false)
+
+	updated, skipped, err := db.RecomputeKeyStarts(ctx, 1)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, updated, 1)
+	require.GreaterOrEqual(t, skipped, 1)
+
+	found, err := db.GetKeyById(ctx, recoverable.Id)
+	require.NoError(t, err)
+	require.Equal(t, plaintext[:len("sk_")+2], found.Start)
+
+	found, err = db.GetKeyById(ctx, notRecoverable.Id)
+	require.NoError(t, err)
+	require.Equal(t, notRecoverable.Start, found.Start)
+
+	// every start is current now
+	updated, _, err = db.RecomputeKeyStarts(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, 0, updated)
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/database/models"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+// SearchKeys returns up to limit keys of a keyAuth whose start begins with the query or whose name contains it.
+// Secrets are never selected, the hash of the returned keys is empty.
+func (db *database) SearchKeys(ctx context.Context, keyAuthId string, query string, limit int) ([]entities.Key, error) {
+
+	// key_auth_id_start_idx serves the start, names are only scanned within the keyAuth
+	const sqlstr = `SELECT ` +
+		`id, start, owner_id, meta, created_at, expires, ratelimit, ratelimit_type, ratelimit_limit, ratelimit_refill_rate, ratelimit_refill_interval, workspace_id, for_workspace_id, key_auth_id, name, remaining_requests, suspended_at, parent_key_id ` +
+		`FROM unkey.keys ` +
+		`WHERE key_auth_id = ? AND (start LIKE ? ESCAPE '\\' OR name LIKE ? ESCAPE '\\') ` +
+		`ORDER BY id ASC LIMIT ?`
+
+	startPattern, namePattern := searchPatterns(query)
+	rows, err := db.read(ctx).QueryContext(ctx, sqlstr, keyAuthId, startPattern, namePattern, limit)
+	if err != nil {
+		return nil, fmt.Errorf("unable to search keys in db: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []entities.Key{}
+	for rows.Next() {
+		k := &models.Key{}
+		err := rows.Scan(&k.ID, &k.Start, &k.OwnerID, &k.Meta, &k.CreatedAt, &k.Expires, &k.Ratelimit, &k.RatelimitType, &k.RatelimitLimit, &k.RatelimitRefillRate, &k.RatelimitRefillInterval, &k.WorkspaceID, &k.ForWorkspaceID, &k.KeyAuthID, &k.Name, &k.RemainingRequests, &k.SuspendedAt, &k.ParentKeyID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+
+		e, err := db.keyEntity(k)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert key: %w", err)
+		}
+
+		keys = append(keys, e)
+	}
+
+	return keys, rows.Err()
+}
+
+// searchPatterns returns the LIKE patterns for the start and the name of a key
+func searchPatterns(query string) (string, string) {
+	escaped := escapeLike(query)
+	return escaped + `%`, `%` + escaped + `%`
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+func TestSearchPatterns(t *testing.T) {
+	start, name := searchPatterns("sk_ab")
+	require.Equal(t, `sk\_ab%`, start)
+	require.Equal(t, `%sk\_ab%`, name)
+
+	// wildcards in the query must match literally
+	start, name = searchPatterns("100%")
+	require.Equal(t, `100\%%`, start)
+	require.Equal(t, `%100\%%`, name)
+}
+
+func TestSearchKeys(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(t, err)
+
+	keyAuthId := uid.KeyAuth()
+	workspaceId := uid.Workspace()
+	for _, k := range []entities.Key{
+		{Start: "sk_abcd", Name: "production"},
+		{Start: "sk_efgh", Name: "my staging key"},
+		{Start: "pk_abcd", Name: "frontend"},
+	} {
+		k.Id = uid.Key()
+		k.KeyAuthId = keyAuthId
+		k.WorkspaceId = workspaceId
+		k.Hash = uid.NewWithByteLength("", 32)
+		k.CreatedAt = time.Now()
+		require.NoError(t, db.CreateKey(ctx, k))
+	}
+
+	found, err := db.SearchKeys(ctx, keyAuthId, "sk_", 10)
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	for _, k := range found {
+		require.Empty(t, k.Hash)
+	}
+
+	found, err = db.SearchKeys(ctx, keyAuthId, "staging", 10)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, "sk_efgh", found[0].Start)
+
+	found, err = db.SearchKeys(ctx, keyAuthId, "abcd", 10)
+	require.NoError(t, err)
+	require.Len(t, found, 0, "start is only matched by prefix")
+
+	found, err = db.SearchKeys(ctx, keyAuthId, "", 1)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+
+	found, err = db.SearchKeys(ctx, uid.KeyAuth(), "sk_", 10)
+	require.NoError(t, err)
+	require.Len(t, found, 0)
+}
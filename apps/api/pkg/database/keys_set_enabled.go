@@ -0,0 +1,40 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SetKeysEnabled suspends or re-enables many keys in a single statement and returns how many
+// changed, keys that already are in the requested state are not counted.
+func (db *database) SetKeysEnabled(ctx context.Context, keyIds []string, enabled bool) (int, error) {
+	if len(keyIds) == 0 {
+		return 0, nil
+	}
+	suspendedAt := sql.NullTime{Time: time.Now(), Valid: !enabled}
+
+	// only keys in the other state change, suspending a key again must not move its suspended_at
+	changes := "suspended_at IS NULL"
+	if enabled {
+		changes = "suspended_at IS NOT NULL"
+	}
+	query := fmt.Sprintf(`UPDATE unkey.keys SET suspended_at = ? WHERE id IN (%s) AND %s`, strings.TrimSuffix(strings.Repeat("?,", len(keyIds)), ","), changes)
+
+	args := make([]any, 0, len(keyIds)+1)
+	args = append(args, suspendedAt)
+	for _, keyId := range keyIds {
+		args = append(args, keyId)
+	}
+	res, err := db.write().ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("unable to set enabled of %d keys: %w", len(keyIds), err)
+	}
+	changed, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("unable to set enabled of %d keys: %w", len(keyIds), err)
+	}
+	return int(changed), nil
+}
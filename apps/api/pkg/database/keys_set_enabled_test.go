@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+func TestSetKeysEnabled(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(t, err)
+
+	keyAuthId := uid.KeyAuth()
+	workspaceId := uid.Workspace()
+	keyIds := []string{}
+	for i := 0; i < 3; i++ {
+		key := entities.Key{
+			Id:          uid.Key(),
+			KeyAuthId:   keyAuthId,
+			WorkspaceId: workspaceId,
+			Hash:        uid.New("test"),
+			CreatedAt:   time.Now(),
+		}
+		require.NoError(t, db.CreateKey(ctx, key))
+		keyIds = append(keyIds, key.Id)
+	}
+	require.NoError(t, db.SetKeyEnabled(ctx, keyIds[2], false))
+	suspended, err := db.GetKeyById(ctx, keyIds[2])
+	require.NoError(t, err)
+
+	changed, err := db.SetKeysEnabled(ctx, keyIds, false)
+	require.NoError(t, err)
+	require.Equal(t, 2, changed)
+
+	for _, keyId := range keyIds {
+		found, err := db.GetKeyById(ctx, keyId)
+		require.NoError(t, err)
+		require.False(t, found.SuspendedAt.IsZero())
+	}
+	// already suspended keys keep their time
+	found, err := db.GetKeyById(ctx, keyIds[2])
+	require.NoError(t, err)
+	require.Equal(t, suspended.SuspendedAt, found.SuspendedAt)
+
+	changed, err = db.SetKeysEnabled(ctx, keyIds[:2], true)
+	require.NoError(t, err)
+	require.Equal(t, 2, changed)
+
+	changed, err = db.SetKeysEnabled(ctx, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, 0, changed)
+}
@@ -2,10 +2,15 @@ package middleware
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
 	"github.com/unkeyed/unkey/apps/api/pkg/database"
 	"github.com/unkeyed/unkey/apps/api/pkg/entities"
 	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/usage"
+	"github.com/unkeyed/unkey/apps/api/pkg/webhooks"
 	"go.uber.org/zap"
 )
 
@@ -24,6 +29,12 @@ func (mw *loggingMiddleware) CreateApi(ctx context.Context, newApi entities.Api)
 	return mw.next.CreateApi(ctx, newApi)
 
 }
+func (mw *loggingMiddleware) CreateApiWithKeyAuth(ctx context.Context, newApi entities.Api, newKeyAuth entities.KeyAuth) (err error) {
+	defer func() {
+		mw.l.Info("database.createApiWithKeyAuth", zap.Any("api", newApi), zap.Any("keyAuth", newKeyAuth), zap.Error(err))
+	}()
+	return mw.next.CreateApiWithKeyAuth(ctx, newApi, newKeyAuth)
+}
 func (mw *loggingMiddleware) GetApi(ctx context.Context, apiId string) (api entities.Api, err error) {
 
 	defer mw.l.Info("database.getApi", zap.Any("req", apiId), zap.Any("res", api), zap.Error(err))
@@ -50,6 +61,18 @@ func (mw *loggingMiddleware) GetKeyByHash(ctx context.Context, hash string) (key
 	key, err = mw.next.GetKeyByHash(ctx, hash)
 	return key, err
 }
+func (mw *loggingMiddleware) GetKeysByHashes(ctx context.Context, hashes []string) (keys map[string]entities.Key, err error) {
+	defer mw.l.Info("database.getKeysByHashes", zap.Strings("req", hashes), zap.Int("found", len(keys)), zap.Error(err))
+
+	keys, err = mw.next.GetKeysByHashes(ctx, hashes)
+	return keys, err
+}
+func (mw *loggingMiddleware) GetKeyAndApiByHash(ctx context.Context, hash string) (key entities.Key, api entities.Api, err error) {
+	defer mw.l.Info("database.getKeyAndApiByHash", zap.Any("req", hash), zap.Any("key", key), zap.Any("api", api), zap.Error(err))
+
+	key, api, err = mw.next.GetKeyAndApiByHash(ctx, hash)
+	return key, api, err
+}
 func (mw *loggingMiddleware) GetKeyById(ctx context.Context, keyId string) (key entities.Key, err error) {
 	defer mw.l.Info("database.getKeyById", zap.Any("req", keyId), zap.Any("res", key), zap.Error(err))
 
@@ -64,11 +87,11 @@ func (mw *loggingMiddleware) CountKeys(ctx context.Context, apiId string) (count
 
 	return count, err
 }
-func (mw *loggingMiddleware) ListKeysByKeyAuthId(ctx context.Context, keyAuthId string, limit int, offset int, ownerId string) (keys []entities.Key, err error) {
-	defer mw.l.Info("database.listKeysByKeyAuthId", zap.String("req.keyAuthId", keyAuthId), zap.Int("req.limit", limit), zap.Int("req.offset", offset), zap.String("req.ownerId", ownerId), zap.Error(err))
+func (mw *loggingMiddleware) ListKeysByKeyAuthId(ctx context.Context, keyAuthId string, limit int, offset int, ownerId string) (keys []entities.Key, total int, err error) {
+	defer mw.l.Info("database.listKeysByKeyAuthId", zap.String("req.keyAuthId", keyAuthId), zap.Int("req.limit", limit), zap.Int("req.offset", offset), zap.String("req.ownerId", ownerId), zap.Int("res.total", total), zap.Error(err))
 
-	keys, err = mw.next.ListKeysByKeyAuthId(ctx, keyAuthId, limit, offset, ownerId)
-	return keys, err
+	keys, total, err = mw.next.ListKeysByKeyAuthId(ctx, keyAuthId, limit, offset, ownerId)
+	return keys, total, err
 }
 
 func (mw *loggingMiddleware) CreateWorkspace(ctx context.Context, newWorkspace entities.Workspace) (err error) {
@@ -85,12 +108,19 @@ func (mw *loggingMiddleware) GetWorkspace(ctx context.Context, workspaceId strin
 	return workspace, err
 }
 
-func (mw *loggingMiddleware) DecrementRemainingKeyUsage(ctx context.Context, keyId string) (remaining int64, err error) {
-	defer mw.l.Info("database.decrementRemainingKeyUsage", zap.Any("req", keyId), zap.Any("res", remaining), zap.Error(err))
+func (mw *loggingMiddleware) DecrementRemainingKeyUsage(ctx context.Context, keyId string, cost int64) (remaining int64, decremented bool, err error) {
+	defer mw.l.Info("database.decrementRemainingKeyUsage", zap.Any("req", keyId), zap.Int64("cost", cost), zap.Any("res", remaining), zap.Bool("decremented", decremented), zap.Error(err))
+
+	remaining, decremented, err = mw.next.DecrementRemainingKeyUsage(ctx, keyId, cost)
+
+	return remaining, decremented, err
+}
 
-	remaining, err = mw.next.DecrementRemainingKeyUsage(ctx, keyId)
+func (mw *loggingMiddleware) VerifyAndConsume(ctx context.Context, hash string, cost int64) (key entities.Key, remaining int64, consumed bool, err error) {
+	defer mw.l.Info("database.verifyAndConsume", zap.Any("req", hash), zap.Int64("cost", cost), zap.Any("res", key), zap.Int64("remaining", remaining), zap.Bool("consumed", consumed), zap.Error(err))
 
-	return remaining, err
+	key, remaining, consumed, err = mw.next.VerifyAndConsume(ctx, hash, cost)
+	return key, remaining, consumed, err
 }
 
 func (mw *loggingMiddleware) UpdateKey(ctx context.Context, key entities.Key) (err error) {
@@ -100,6 +130,13 @@ func (mw *loggingMiddleware) UpdateKey(ctx context.Context, key entities.Key) (e
 	return err
 }
 
+func (mw *loggingMiddleware) UpdateKeySecret(ctx context.Context, key entities.Key) (err error) {
+	defer mw.l.Info("database.updateKeySecret", zap.String("req.keyId", key.Id), zap.Error(err))
+
+	err = mw.next.UpdateKeySecret(ctx, key)
+	return err
+}
+
 func (mw *loggingMiddleware) CreateKeyAuth(ctx context.Context, keyAuth entities.KeyAuth) (err error) {
 	defer mw.l.Info("database.createKeyAuth", zap.Any("req", keyAuth), zap.Error(err))
 
@@ -120,3 +157,252 @@ func (mw *loggingMiddleware) GetApiByKeyAuthId(ctx context.Context, keyAuthId st
 	api, err = mw.next.GetApiByKeyAuthId(ctx, keyAuthId)
 	return api, err
 }
+
+// the calls fn makes with tx are logged one by one
+func (mw *loggingMiddleware) WithTx(ctx context.Context, fn func(tx database.Database) error) (err error) {
+	defer mw.l.Info("database.withTx", zap.Error(err))
+
+	err = mw.next.WithTx(ctx, func(tx database.Database) error {
+		return fn(&loggingMiddleware{next: tx, l: mw.l})
+	})
+	return err
+}
+
+func (mw *loggingMiddleware) Ping(ctx context.Context) (err error) {
+	defer mw.l.Info("database.ping", zap.Error(err))
+
+	err = mw.next.Ping(ctx)
+	return err
+}
+
+// Stats is not logged, it is read on every metrics scrape
+func (mw *loggingMiddleware) Stats() map[string]sql.DBStats {
+	return mw.next.Stats()
+}
+
+func (mw *loggingMiddleware) Close() (err error) {
+	defer mw.l.Info("database.close", zap.Error(err))
+
+	err = mw.next.Close()
+	return err
+}
+
+func (mw *loggingMiddleware) ListKeysByOwnerId(ctx context.Context, workspaceId string, ownerId string) (res []entities.Key, err error) {
+	defer mw.l.Info("database.listKeysByOwnerId", zap.String("req.workspaceId", workspaceId), zap.String("req.ownerId", ownerId), zap.Any("res", res), zap.Error(err))
+
+	res, err = mw.next.ListKeysByOwnerId(ctx, workspaceId, ownerId)
+	return res, err
+}
+
+func (mw *loggingMiddleware) TransferKeysOwner(ctx context.Context, workspaceId, fromOwnerId, toOwnerId string) (res []entities.Key, err error) {
+	defer mw.l.Info("database.transferKeysOwner", zap.String("req.workspaceId", workspaceId), zap.String("req.fromOwnerId", fromOwnerId), zap.String("req.toOwnerId", toOwnerId), zap.Int("res.moved", len(res)), zap.Error(err))
+
+	res, err = mw.next.TransferKeysOwner(ctx, workspaceId, fromOwnerId, toOwnerId)
+	return res, err
+}
+
+func (mw *loggingMiddleware) UpdateKeyMeta(ctx context.Context, keyId string, meta map[string]any) (err error) {
+	defer mw.l.Info("database.updateKeyMeta", zap.String("req.keyId", keyId), zap.Any("req.meta", meta), zap.Error(err))
+
+	err = mw.next.UpdateKeyMeta(ctx, keyId, meta)
+	return err
+}
+
+func (mw *loggingMiddleware) CountKeysByWorkspace(ctx context.Context, workspaceId string) (count int, err error) {
+	defer mw.l.Info("database.countKeysByWorkspace", zap.Any("req", workspaceId), zap.Any("res", count), zap.Error(err))
+
+	count, err = mw.next.CountKeysByWorkspace(ctx, workspaceId)
+	return count, err
+}
+
+func (mw *loggingMiddleware) CountKeysExpiringBetween(ctx context.Context, workspaceId string, from time.Time, to time.Time) (count int, err error) {
+	defer mw.l.Info("database.countKeysExpiringBetween", zap.String("req.workspaceId", workspaceId), zap.Time("req.from", from), zap.Time("req.to", to), zap.Int("res", count), zap.Error(err))
+
+	count, err = mw.next.CountKeysExpiringBetween(ctx, workspaceId, from, to)
+	return count, err
+}
+
+func (mw *loggingMiddleware) CountApisByWorkspace(ctx context.Context, workspaceId string) (count int, err error) {
+	defer mw.l.Info("database.countApisByWorkspace", zap.Any("req", workspaceId), zap.Any("res", count), zap.Error(err))
+
+	count, err = mw.next.CountApisByWorkspace(ctx, workspaceId)
+	return count, err
+}
+
+func (mw *loggingMiddleware) SetKeyEnabled(ctx context.Context, keyId string, enabled bool) (err error) {
+	defer mw.l.Info("database.setKeyEnabled", zap.String("req.keyId", keyId), zap.Bool("req.enabled", enabled), zap.Error(err))
+
+	err = mw.next.SetKeyEnabled(ctx, keyId, enabled)
+	return err
+}
+
+func (mw *loggingMiddleware) TouchKeyLastUsed(ctx context.Context, keyId string, ts time.Time) (err error) {
+	defer mw.l.Info("database.touchKeyLastUsed", zap.String("req.keyId", keyId), zap.Time("req.ts", ts), zap.Error(err))
+
+	err = mw.next.TouchKeyLastUsed(ctx, keyId, ts)
+	return err
+}
+
+func (mw *loggingMiddleware) SetKeysEnabled(ctx context.Context, keyIds []string, enabled bool) (res int, err error) {
+	defer mw.l.Info("database.setKeysEnabled", zap.Strings("req.keyIds", keyIds), zap.Bool("req.enabled", enabled), zap.Int("res", res), zap.Error(err))
+
+	res, err = mw.next.SetKeysEnabled(ctx, keyIds, enabled)
+	return res, err
+}
+
+func (mw *loggingMiddleware) SetApiMetaSchema(ctx context.Context, apiId string, schema string) (err error) {
+	defer mw.l.Info("database.setApiMetaSchema", zap.String("req.apiId", apiId), zap.String("req.schema", schema), zap.Error(err))
+
+	err = mw.next.SetApiMetaSchema(ctx, apiId, schema)
+	return err
+}
+
+func (mw *loggingMiddleware) SetApiAllowedMetaKeys(ctx context.Context, apiId string, keys []string) (err error) {
+	defer mw.l.Info("database.setApiAllowedMetaKeys", zap.String("req.apiId", apiId), zap.Strings("req.keys", keys), zap.Error(err))
+
+	err = mw.next.SetApiAllowedMetaKeys(ctx, apiId, keys)
+	return err
+}
+
+func (mw *loggingMiddleware) SetWorkspaceEnabled(ctx context.Context, workspaceId string, enabled bool) (err error) {
+	defer mw.l.Info("database.setWorkspaceEnabled", zap.String("req.workspaceId", workspaceId), zap.Bool("req.enabled", enabled), zap.Error(err))
+
+	err = mw.next.SetWorkspaceEnabled(ctx, workspaceId, enabled)
+	return err
+}
+
+func (mw *loggingMiddleware) SetWorkspaceHideKeyStart(ctx context.Context, workspaceId string, hide bool) (err error) {
+	defer mw.l.Info("database.setWorkspaceHideKeyStart", zap.String("req.workspaceId", workspaceId), zap.Bool("req.hide", hide), zap.Error(err))
+
+	err = mw.next.SetWorkspaceHideKeyStart(ctx, workspaceId, hide)
+	return err
+}
+
+func (mw *loggingMiddleware) SetWorkspaceOmitKeyStart(ctx context.Context, workspaceId string, omit bool) (err error) {
+	defer mw.l.Info("database.setWorkspaceOmitKeyStart", zap.String("req.workspaceId", workspaceId), zap.Bool("req.omit", omit), zap.Error(err))
+
+	err = mw.next.SetWorkspaceOmitKeyStart(ctx, workspaceId, omit)
+	return err
+}
+
+func (mw *loggingMiddleware) AppendAuditLog(ctx context.Context, entry audit.Entry) (err error) {
+	defer mw.l.Info("database.appendAuditLog", zap.Any("req", entry), zap.Error(err))
+
+	err = mw.next.AppendAuditLog(ctx, entry)
+	return err
+}
+
+func (mw *loggingMiddleware) ListAuditLogs(ctx context.Context, workspaceId string, filter audit.Filter) (res []audit.Entry, err error) {
+	defer mw.l.Info("database.listAuditLogs", zap.String("req.workspaceId", workspaceId), zap.Any("req.filter", filter), zap.Any("res", res), zap.Error(err))
+
+	res, err = mw.next.ListAuditLogs(ctx, workspaceId, filter)
+	return res, err
+}
+
+func (mw *loggingMiddleware) DeleteKeysByPrefix(ctx context.Context, keyAuthId string, prefix string) (res int, err error) {
+	defer mw.l.Info("database.deleteKeysByPrefix", zap.String("req.keyAuthId", keyAuthId), zap.String("req.prefix", prefix), zap.Any("res", res), zap.Error(err))
+
+	res, err = mw.next.DeleteKeysByPrefix(ctx, keyAuthId, prefix)
+	return res, err
+}
+
+func (mw *loggingMiddleware) ReEncryptKeys(ctx context.Context, batchSize int) (res int, err error) {
+	defer mw.l.Info("database.reEncryptKeys", zap.Int("req.batchSize", batchSize), zap.Int("res", res), zap.Error(err))
+
+	res, err = mw.next.ReEncryptKeys(ctx, batchSize)
+	return res, err
+}
+
+func (mw *loggingMiddleware) RecomputeKeyStarts(ctx context.Context, batchSize int) (updated int, skipped int, err error) {
+	defer mw.l.Info("database.recomputeKeyStarts", zap.Int("req.batchSize", batchSize), zap.Int("res.updated", updated), zap.Int("res.skipped", skipped), zap.Error(err))
+
+	updated, skipped, err = mw.next.RecomputeKeyStarts(ctx, batchSize)
+	return updated, skipped, err
+}
+
+func (mw *loggingMiddleware) MigrateRatelimits(ctx context.Context, batchSize int) (res int, err error) {
+	defer mw.l.Info("database.migrateRatelimits", zap.Int("req.batchSize", batchSize), zap.Int("res", res), zap.Error(err))
+
+	res, err = mw.next.MigrateRatelimits(ctx, batchSize)
+	return res, err
+}
+
+func (mw *loggingMiddleware) SearchKeys(ctx context.Context, keyAuthId string, query string, limit int) (res []entities.Key, err error) {
+	defer mw.l.Info("database.searchKeys", zap.String("req.keyAuthId", keyAuthId), zap.String("req.query", query), zap.Int("req.limit", limit), zap.Int("res", len(res)), zap.Error(err))
+
+	res, err = mw.next.SearchKeys(ctx, keyAuthId, query, limit)
+	return res, err
+}
+
+func (mw *loggingMiddleware) ListKeysByWorkspaceId(ctx context.Context, workspaceId string, afterId string, limit int) (res []entities.Key, err error) {
+	defer mw.l.Info("database.listKeysByWorkspaceId", zap.String("req.workspaceId", workspaceId), zap.String("req.afterId", afterId), zap.Int("req.limit", limit), zap.Int("res", len(res)), zap.Error(err))
+
+	res, err = mw.next.ListKeysByWorkspaceId(ctx, workspaceId, afterId, limit)
+	return res, err
+}
+
+func (mw *loggingMiddleware) ListKeysByPrefix(ctx context.Context, keyAuthId string, prefix string) (res []entities.Key, err error) {
+	defer mw.l.Info("database.listKeysByPrefix", zap.String("req.keyAuthId", keyAuthId), zap.String("req.prefix", prefix), zap.Any("res", res), zap.Error(err))
+
+	res, err = mw.next.ListKeysByPrefix(ctx, keyAuthId, prefix)
+	return res, err
+}
+
+func (mw *loggingMiddleware) CreateKeys(ctx context.Context, newKeys []entities.Key) (err error) {
+	defer mw.l.Info("database.createKeys", zap.Any("req", newKeys), zap.Error(err))
+
+	err = mw.next.CreateKeys(ctx, newKeys)
+	return err
+}
+
+func (mw *loggingMiddleware) ListKeysExpiringBetween(ctx context.Context, keyAuthId string, from time.Time, to time.Time, limit int, offset int) (res []entities.Key, err error) {
+	defer mw.l.Info("database.listKeysExpiringBetween", zap.String("req.keyAuthId", keyAuthId), zap.Any("req.from", from), zap.Any("req.to", to), zap.Int("req.limit", limit), zap.Int("req.offset", offset), zap.Any("res", res), zap.Error(err))
+
+	res, err = mw.next.ListKeysExpiringBetween(ctx, keyAuthId, from, to, limit, offset)
+	return res, err
+}
+
+// the secret of an endpoint must never be logged
+func (mw *loggingMiddleware) CreateWebhook(ctx context.Context, endpoint webhooks.Endpoint) (err error) {
+	defer mw.l.Info("database.createWebhook", zap.String("req.id", endpoint.Id), zap.String("req.workspaceId", endpoint.WorkspaceId), zap.String("req.url", endpoint.Url), zap.Error(err))
+
+	err = mw.next.CreateWebhook(ctx, endpoint)
+	return err
+}
+
+func (mw *loggingMiddleware) ListWebhooks(ctx context.Context, workspaceId string) (res []webhooks.Endpoint, err error) {
+	defer func() {
+		mw.l.Info("database.listWebhooks", zap.Any("req", workspaceId), zap.Int("res.count", len(res)), zap.Error(err))
+	}()
+
+	res, err = mw.next.ListWebhooks(ctx, workspaceId)
+	return res, err
+}
+
+func (mw *loggingMiddleware) DeleteWebhook(ctx context.Context, workspaceId, webhookId string) (err error) {
+	defer mw.l.Info("database.deleteWebhook", zap.String("req.workspaceId", workspaceId), zap.String("req.webhookId", webhookId), zap.Error(err))
+
+	err = mw.next.DeleteWebhook(ctx, workspaceId, webhookId)
+	return err
+}
+
+func (mw *loggingMiddleware) IncrementKeyUsage(ctx context.Context, keyId string, ts time.Time) (err error) {
+	defer mw.l.Info("database.incrementKeyUsage", zap.String("req.keyId", keyId), zap.Any("req.ts", ts), zap.Error(err))
+
+	err = mw.next.IncrementKeyUsage(ctx, keyId, ts)
+	return err
+}
+
+func (mw *loggingMiddleware) AddKeyUsage(ctx context.Context, counts []usage.Count) (err error) {
+	defer mw.l.Info("database.addKeyUsage", zap.Int("req.count", len(counts)), zap.Error(err))
+
+	err = mw.next.AddKeyUsage(ctx, counts)
+	return err
+}
+
+func (mw *loggingMiddleware) GetKeyUsage(ctx context.Context, keyId string, from, to time.Time, granularity usage.Granularity) (res []usage.Bucket, err error) {
+	defer mw.l.Info("database.getKeyUsage", zap.String("req.keyId", keyId), zap.Any("req.from", from), zap.Any("req.to", to), zap.Any("req.granularity", granularity), zap.Any("res", res), zap.Error(err))
+
+	res, err = mw.next.GetKeyUsage(ctx, keyId, from, to, granularity)
+	return res, err
+}
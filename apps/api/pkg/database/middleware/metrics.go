@@ -0,0 +1,304 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/metrics"
+	"github.com/unkeyed/unkey/apps/api/pkg/usage"
+	"github.com/unkeyed/unkey/apps/api/pkg/webhooks"
+)
+
+type metricsMiddleware struct {
+	next    database.Database
+	metrics *metrics.Metrics
+}
+
+// WithMetrics records the latency of every database call
+func WithMetrics(next database.Database, m *metrics.Metrics) database.Database {
+	return &metricsMiddleware{next: next, metrics: m}
+}
+
+func (mw *metricsMiddleware) observe(method string, start time.Time) {
+	mw.metrics.DatabaseLatency.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+func (mw *metricsMiddleware) CreateApi(ctx context.Context, newApi entities.Api) error {
+	defer mw.observe("createApi", time.Now())
+	return mw.next.CreateApi(ctx, newApi)
+}
+
+func (mw *metricsMiddleware) CreateApiWithKeyAuth(ctx context.Context, newApi entities.Api, newKeyAuth entities.KeyAuth) error {
+	defer mw.observe("createApiWithKeyAuth", time.Now())
+	return mw.next.CreateApiWithKeyAuth(ctx, newApi, newKeyAuth)
+}
+
+func (mw *metricsMiddleware) GetApi(ctx context.Context, apiId string) (entities.Api, error) {
+	defer mw.observe("getApi", time.Now())
+	return mw.next.GetApi(ctx, apiId)
+}
+
+func (mw *metricsMiddleware) GetApiByKeyAuthId(ctx context.Context, keyAuthId string) (entities.Api, error) {
+	defer mw.observe("getApiByKeyAuthId", time.Now())
+	return mw.next.GetApiByKeyAuthId(ctx, keyAuthId)
+}
+
+func (mw *metricsMiddleware) CreateKey(ctx context.Context, newKey entities.Key) error {
+	defer mw.observe("createKey", time.Now())
+	return mw.next.CreateKey(ctx, newKey)
+}
+
+func (mw *metricsMiddleware) UpdateKey(ctx context.Context, key entities.Key) error {
+	defer mw.observe("updateKey", time.Now())
+	return mw.next.UpdateKey(ctx, key)
+}
+
+func (mw *metricsMiddleware) UpdateKeySecret(ctx context.Context, key entities.Key) error {
+	defer mw.observe("updateKeySecret", time.Now())
+	return mw.next.UpdateKeySecret(ctx, key)
+}
+
+func (mw *metricsMiddleware) DeleteKey(ctx context.Context, keyId string) error {
+	defer mw.observe("deleteKey", time.Now())
+	return mw.next.DeleteKey(ctx, keyId)
+}
+
+func (mw *metricsMiddleware) GetKeysByHashes(ctx context.Context, hashes []string) (map[string]entities.Key, error) {
+	defer mw.observe("getKeysByHashes", time.Now())
+	return mw.next.GetKeysByHashes(ctx, hashes)
+}
+
+func (mw *metricsMiddleware) GetKeyByHash(ctx context.Context, hash string) (entities.Key, error) {
+	defer mw.observe("getKeyByHash", time.Now())
+	return mw.next.GetKeyByHash(ctx, hash)
+}
+
+func (mw *metricsMiddleware) GetKeyAndApiByHash(ctx context.Context, hash string) (entities.Key, entities.Api, error) {
+	defer mw.observe("getKeyAndApiByHash", time.Now())
+	return mw.next.GetKeyAndApiByHash(ctx, hash)
+}
+
+func (mw *metricsMiddleware) GetKeyById(ctx context.Context, keyId string) (entities.Key, error) {
+	defer mw.observe("getKeyById", time.Now())
+	return mw.next.GetKeyById(ctx, keyId)
+}
+
+func (mw *metricsMiddleware) CountKeys(ctx context.Context, keyAuthId string) (int, error) {
+	defer mw.observe("countKeys", time.Now())
+	return mw.next.CountKeys(ctx, keyAuthId)
+}
+
+func (mw *metricsMiddleware) ListKeysByKeyAuthId(ctx context.Context, keyAuthId string, limit int, offset int, ownerId string) ([]entities.Key, int, error) {
+	defer mw.observe("listKeysByKeyAuthId", time.Now())
+	return mw.next.ListKeysByKeyAuthId(ctx, keyAuthId, limit, offset, ownerId)
+}
+
+func (mw *metricsMiddleware) CreateWorkspace(ctx context.Context, newWorkspace entities.Workspace) error {
+	defer mw.observe("createWorkspace", time.Now())
+	return mw.next.CreateWorkspace(ctx, newWorkspace)
+}
+
+func (mw *metricsMiddleware) CreateKeyAuth(ctx context.Context, newKeyAuth entities.KeyAuth) error {
+	defer mw.observe("createKeyAuth", time.Now())
+	return mw.next.CreateKeyAuth(ctx, newKeyAuth)
+}
+
+func (mw *metricsMiddleware) GetKeyAuth(ctx context.Context, keyAuthId string) (entities.KeyAuth, error) {
+	defer mw.observe("getKeyAuth", time.Now())
+	return mw.next.GetKeyAuth(ctx, keyAuthId)
+}
+
+func (mw *metricsMiddleware) GetWorkspace(ctx context.Context, workspaceId string) (entities.Workspace, error) {
+	defer mw.observe("getWorkspace", time.Now())
+	return mw.next.GetWorkspace(ctx, workspaceId)
+}
+
+func (mw *metricsMiddleware) DecrementRemainingKeyUsage(ctx context.Context, keyId string, cost int64) (int64, bool, error) {
+	defer mw.observe("decrementRemainingKeyUsage", time.Now())
+	return mw.next.DecrementRemainingKeyUsage(ctx, keyId, cost)
+}
+
+func (mw *metricsMiddleware) VerifyAndConsume(ctx context.Context, hash string, cost int64) (entities.Key, int64, bool, error) {
+	defer mw.observe("verifyAndConsume", time.Now())
+	return mw.next.VerifyAndConsume(ctx, hash, cost)
+}
+
+func (mw *metricsMiddleware) Ping(ctx context.Context) error {
+	defer mw.observe("ping", time.Now())
+	return mw.next.Ping(ctx)
+}
+
+func (mw *metricsMiddleware) Stats() map[string]sql.DBStats {
+	return mw.next.Stats()
+}
+
+func (mw *metricsMiddleware) Close() error {
+	return mw.next.Close()
+}
+
+func (mw *metricsMiddleware) ListKeysByOwnerId(ctx context.Context, workspaceId string, ownerId string) ([]entities.Key, error) {
+	defer mw.observe("listKeysByOwnerId", time.Now())
+	return mw.next.ListKeysByOwnerId(ctx, workspaceId, ownerId)
+}
+
+func (mw *metricsMiddleware) TransferKeysOwner(ctx context.Context, workspaceId, fromOwnerId, toOwnerId string) ([]entities.Key, error) {
+	defer mw.observe("transferKeysOwner", time.Now())
+	return mw.next.TransferKeysOwner(ctx, workspaceId, fromOwnerId, toOwnerId)
+}
+
+func (mw *metricsMiddleware) UpdateKeyMeta(ctx context.Context, keyId string, meta map[string]any) error {
+	defer mw.observe("updateKeyMeta", time.Now())
+	return mw.next.UpdateKeyMeta(ctx, keyId, meta)
+}
+
+func (mw *metricsMiddleware) CountKeysByWorkspace(ctx context.Context, workspaceId string) (int, error) {
+	defer mw.observe("countKeysByWorkspace", time.Now())
+	return mw.next.CountKeysByWorkspace(ctx, workspaceId)
+}
+
+func (mw *metricsMiddleware) CountKeysExpiringBetween(ctx context.Context, workspaceId string, from time.Time, to time.Time) (int, error) {
+	defer mw.observe("countKeysExpiringBetween", time.Now())
+	return mw.next.CountKeysExpiringBetween(ctx, workspaceId, from, to)
+}
+
+func (mw *metricsMiddleware) CountApisByWorkspace(ctx context.Context, workspaceId string) (int, error) {
+	defer mw.observe("countApisByWorkspace", time.Now())
+	return mw.next.CountApisByWorkspace(ctx, workspaceId)
+}
+
+func (mw *metricsMiddleware) SetKeyEnabled(ctx context.Context, keyId string, enabled bool) error {
+	defer mw.observe("setKeyEnabled", time.Now())
+	return mw.next.SetKeyEnabled(ctx, keyId, enabled)
+}
+
+func (mw *metricsMiddleware) TouchKeyLastUsed(ctx context.Context, keyId string, ts time.Time) error {
+	defer mw.observe("touchKeyLastUsed", time.Now())
+	return mw.next.TouchKeyLastUsed(ctx, keyId, ts)
+}
+
+func (mw *metricsMiddleware) SetKeysEnabled(ctx context.Context, keyIds []string, enabled bool) (int, error) {
+	defer mw.observe("setKeysEnabled", time.Now())
+	return mw.next.SetKeysEnabled(ctx, keyIds, enabled)
+}
+
+func (mw *metricsMiddleware) SetApiMetaSchema(ctx context.Context, apiId string, schema string) error {
+	defer mw.observe("setApiMetaSchema", time.Now())
+	return mw.next.SetApiMetaSchema(ctx, apiId, schema)
+}
+
+func (mw *metricsMiddleware) SetApiAllowedMetaKeys(ctx context.Context, apiId string, keys []string) error {
+	defer mw.observe("setApiAllowedMetaKeys", time.Now())
+	return mw.next.SetApiAllowedMetaKeys(ctx, apiId, keys)
+}
+
+func (mw *metricsMiddleware) SetWorkspaceEnabled(ctx context.Context, workspaceId string, enabled bool) error {
+	defer mw.observe("setWorkspaceEnabled", time.Now())
+	return mw.next.SetWorkspaceEnabled(ctx, workspaceId, enabled)
+}
+
+func (mw *metricsMiddleware) SetWorkspaceHideKeyStart(ctx context.Context, workspaceId string, hide bool) error {
+	defer mw.observe("setWorkspaceHideKeyStart", time.Now())
+	return mw.next.SetWorkspaceHideKeyStart(ctx, workspaceId, hide)
+}
+
+func (mw *metricsMiddleware) SetWorkspaceOmitKeyStart(ctx context.Context, workspaceId string, omit bool) error {
+	defer mw.observe("setWorkspaceOmitKeyStart", time.Now())
+	return mw.next.SetWorkspaceOmitKeyStart(ctx, workspaceId, omit)
+}
+
+func (mw *metricsMiddleware) AppendAuditLog(ctx context.Context, entry audit.Entry) error {
+	defer mw.observe("appendAuditLog", time.Now())
+	return mw.next.AppendAuditLog(ctx, entry)
+}
+
+func (mw *metricsMiddleware) ListAuditLogs(ctx context.Context, workspaceId string, filter audit.Filter) ([]audit.Entry, error) {
+	defer mw.observe("listAuditLogs", time.Now())
+	return mw.next.ListAuditLogs(ctx, workspaceId, filter)
+}
+
+func (mw *metricsMiddleware) DeleteKeysByPrefix(ctx context.Context, keyAuthId string, prefix string) (int, error) {
+	defer mw.observe("deleteKeysByPrefix", time.Now())
+	return mw.next.DeleteKeysByPrefix(ctx, keyAuthId, prefix)
+}
+
+func (mw *metricsMiddleware) ReEncryptKeys(ctx context.Context, batchSize int) (int, error) {
+	defer mw.observe("reEncryptKeys", time.Now())
+	return mw.next.ReEncryptKeys(ctx, batchSize)
+}
+
+func (mw *metricsMiddleware) RecomputeKeyStarts(ctx context.Context, batchSize int) (int, int, error) {
+	defer mw.observe("recomputeKeyStarts", time.Now())
+	return mw.next.RecomputeKeyStarts(ctx, batchSize)
+}
+
+func (mw *metricsMiddleware) MigrateRatelimits(ctx context.Context, batchSize int) (int, error) {
+	defer mw.observe("migrateRatelimits", time.Now())
+	return mw.next.MigrateRatelimits(ctx, batchSize)
+}
+
+func (mw *metricsMiddleware) SearchKeys(ctx context.Context, keyAuthId string, query string, limit int) ([]entities.Key, error) {
+	defer mw.observe("searchKeys", time.Now())
+	return mw.next.SearchKeys(ctx, keyAuthId, query, limit)
+}
+
+func (mw *metricsMiddleware) ListKeysByWorkspaceId(ctx context.Context, workspaceId string, afterId string, limit int) ([]entities.Key, error) {
+	defer mw.observe("listKeysByWorkspaceId", time.Now())
+	return mw.next.ListKeysByWorkspaceId(ctx, workspaceId, afterId, limit)
+}
+
+func (mw *metricsMiddleware) ListKeysByPrefix(ctx context.Context, keyAuthId string, prefix string) ([]entities.Key, error) {
+	defer mw.observe("listKeysByPrefix", time.Now())
+	return mw.next.ListKeysByPrefix(ctx, keyAuthId, prefix)
+}
+
+// the latency covers fn, the calls it makes with tx are observed on their own too
+func (mw *metricsMiddleware) WithTx(ctx context.Context, fn func(tx database.Database) error) error {
+	defer mw.observe("withTx", time.Now())
+	return mw.next.WithTx(ctx, func(tx database.Database) error {
+		return fn(&metricsMiddleware{next: tx, metrics: mw.metrics})
+	})
+}
+
+func (mw *metricsMiddleware) CreateKeys(ctx context.Context, newKeys []entities.Key) error {
+	defer mw.observe("createKeys", time.Now())
+	return mw.next.CreateKeys(ctx, newKeys)
+}
+
+func (mw *metricsMiddleware) ListKeysExpiringBetween(ctx context.Context, keyAuthId string, from time.Time, to time.Time, limit int, offset int) ([]entities.Key, error) {
+	defer mw.observe("listKeysExpiringBetween", time.Now())
+	return mw.next.ListKeysExpiringBetween(ctx, keyAuthId, from, to, limit, offset)
+}
+
+func (mw *metricsMiddleware) CreateWebhook(ctx context.Context, endpoint webhooks.Endpoint) error {
+	defer mw.observe("createWebhook", time.Now())
+	return mw.next.CreateWebhook(ctx, endpoint)
+}
+
+func (mw *metricsMiddleware) ListWebhooks(ctx context.Context, workspaceId string) ([]webhooks.Endpoint, error) {
+	defer mw.observe("listWebhooks", time.Now())
+	return mw.next.ListWebhooks(ctx, workspaceId)
+}
+
+func (mw *metricsMiddleware) DeleteWebhook(ctx context.Context, workspaceId, webhookId string) error {
+	defer mw.observe("deleteWebhook", time.Now())
+	return mw.next.DeleteWebhook(ctx, workspaceId, webhookId)
+}
+
+func (mw *metricsMiddleware) IncrementKeyUsage(ctx context.Context, keyId string, ts time.Time) error {
+	defer mw.observe("incrementKeyUsage", time.Now())
+	return mw.next.IncrementKeyUsage(ctx, keyId, ts)
+}
+
+func (mw *metricsMiddleware) AddKeyUsage(ctx context.Context, counts []usage.Count) error {
+	defer mw.observe("addKeyUsage", time.Now())
+	return mw.next.AddKeyUsage(ctx, counts)
+}
+
+func (mw *metricsMiddleware) GetKeyUsage(ctx context.Context, keyId string, from, to time.Time, granularity usage.Granularity) ([]usage.Bucket, error) {
+	defer mw.observe("getKeyUsage", time.Now())
+	return mw.next.GetKeyUsage(ctx, keyId, from, to, granularity)
+}
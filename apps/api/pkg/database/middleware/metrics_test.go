@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/metrics"
+)
+
+type fakeDatabase struct {
+	database.Database
+}
+
+func (db *fakeDatabase) GetKeyByHash(ctx context.Context, hash string) (entities.Key, error) {
+	return entities.Key{Hash: hash}, nil
+}
+
+func TestWithMetrics_ObservesLatency(t *testing.T) {
+	m := metrics.New()
+	db := WithMetrics(&fakeDatabase{}, m)
+
+	for i := 0; i < 5; i++ {
+		_, err := db.GetKeyByHash(context.Background(), "hash")
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, 1, promtestutil.CollectAndCount(m.DatabaseLatency))
+}
+
+func (db *fakeDatabase) WithTx(ctx context.Context, fn func(tx database.Database) error) error {
+	return fn(db)
+}
+
+func TestWithMetrics_ObservesCallsInTransaction(t *testing.T) {
+	m := metrics.New()
+	db := WithMetrics(&fakeDatabase{}, m)
+
+	err := db.WithTx(context.Background(), func(tx database.Database) error {
+		_, err := tx.GetKeyByHash(context.Background(), "hash")
+		return err
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, 2, promtestutil.CollectAndCount(m.DatabaseLatency))
+}
@@ -0,0 +1,317 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/usage"
+	"github.com/unkeyed/unkey/apps/api/pkg/webhooks"
+	"go.uber.org/zap"
+)
+
+// DefaultSlowQueryThreshold is used when WithSlowQueryLogging gets a threshold of 0
+const DefaultSlowQueryThreshold = 100 * time.Millisecond
+
+type slowQueryMiddleware struct {
+	next      database.Database
+	logger    logging.Logger
+	threshold time.Duration
+}
+
+// WithSlowQueryLogging logs every database call that takes longer than threshold as a warning.
+// Unlike WithLogging it stays silent for fast calls, so it can be enabled in production.
+func WithSlowQueryLogging(next database.Database, logger logging.Logger, threshold time.Duration) database.Database {
+	if threshold <= 0 {
+		threshold = DefaultSlowQueryThreshold
+	}
+	return &slowQueryMiddleware{next: next, logger: logger.With(zap.String("pkg", "database")), threshold: threshold}
+}
+
+func (mw *slowQueryMiddleware) check(method string, start time.Time) {
+	latency := time.Since(start)
+	if latency < mw.threshold {
+		return
+	}
+	mw.logger.Warn("database.slow", zap.String("method", method), zap.Duration("latency", latency), zap.Duration("threshold", mw.threshold))
+}
+
+func (mw *slowQueryMiddleware) CreateApi(ctx context.Context, newApi entities.Api) error {
+	defer mw.check("createApi", time.Now())
+	return mw.next.CreateApi(ctx, newApi)
+}
+
+func (mw *slowQueryMiddleware) CreateApiWithKeyAuth(ctx context.Context, newApi entities.Api, newKeyAuth entities.KeyAuth) error {
+	defer mw.check("createApiWithKeyAuth", time.Now())
+	return mw.next.CreateApiWithKeyAuth(ctx, newApi, newKeyAuth)
+}
+
+func (mw *slowQueryMiddleware) GetApi(ctx context.Context, apiId string) (entities.Api, error) {
+	defer mw.check("getApi", time.Now())
+	return mw.next.GetApi(ctx, apiId)
+}
+
+func (mw *slowQueryMiddleware) GetApiByKeyAuthId(ctx context.Context, keyAuthId string) (entities.Api, error) {
+	defer mw.check("getApiByKeyAuthId", time.Now())
+	return mw.next.GetApiByKeyAuthId(ctx, keyAuthId)
+}
+
+func (mw *slowQueryMiddleware) CreateKey(ctx context.Context, newKey entities.Key) error {
+	defer mw.check("createKey", time.Now())
+	return mw.next.CreateKey(ctx, newKey)
+}
+
+func (mw *slowQueryMiddleware) UpdateKey(ctx context.Context, key entities.Key) error {
+	defer mw.check("updateKey", time.Now())
+	return mw.next.UpdateKey(ctx, key)
+}
+
+func (mw *slowQueryMiddleware) UpdateKeySecret(ctx context.Context, key entities.Key) error {
+	defer mw.check("updateKeySecret", time.Now())
+	return mw.next.UpdateKeySecret(ctx, key)
+}
+
+func (mw *slowQueryMiddleware) DeleteKey(ctx context.Context, keyId string) error {
+	defer mw.check("deleteKey", time.Now())
+	return mw.next.DeleteKey(ctx, keyId)
+}
+
+func (mw *slowQueryMiddleware) GetKeysByHashes(ctx context.Context, hashes []string) (map[string]entities.Key, error) {
+	defer mw.check("getKeysByHashes", time.Now())
+	return mw.next.GetKeysByHashes(ctx, hashes)
+}
+
+func (mw *slowQueryMiddleware) GetKeyByHash(ctx context.Context, hash string) (entities.Key, error) {
+	defer mw.check("getKeyByHash", time.Now())
+	return mw.next.GetKeyByHash(ctx, hash)
+}
+
+func (mw *slowQueryMiddleware) GetKeyAndApiByHash(ctx context.Context, hash string) (entities.Key, entities.Api, error) {
+	defer mw.check("getKeyAndApiByHash", time.Now())
+	return mw.next.GetKeyAndApiByHash(ctx, hash)
+}
+
+func (mw *slowQueryMiddleware) GetKeyById(ctx context.Context, keyId string) (entities.Key, error) {
+	defer mw.check("getKeyById", time.Now())
+	return mw.next.GetKeyById(ctx, keyId)
+}
+
+func (mw *slowQueryMiddleware) CountKeys(ctx context.Context, keyAuthId string) (int, error) {
+	defer mw.check("countKeys", time.Now())
+	return mw.next.CountKeys(ctx, keyAuthId)
+}
+
+func (mw *slowQueryMiddleware) ListKeysByKeyAuthId(ctx context.Context, keyAuthId string, limit int, offset int, ownerId string) ([]entities.Key, int, error) {
+	defer mw.check("listKeysByKeyAuthId", time.Now())
+	return mw.next.ListKeysByKeyAuthId(ctx, keyAuthId, limit, offset, ownerId)
+}
+
+func (mw *slowQueryMiddleware) CreateWorkspace(ctx context.Context, newWorkspace entities.Workspace) error {
+	defer mw.check("createWorkspace", time.Now())
+	return mw.next.CreateWorkspace(ctx, newWorkspace)
+}
+
+func (mw *slowQueryMiddleware) CreateKeyAuth(ctx context.Context, newKeyAuth entities.KeyAuth) error {
+	defer mw.check("createKeyAuth", time.Now())
+	return mw.next.CreateKeyAuth(ctx, newKeyAuth)
+}
+
+func (mw *slowQueryMiddleware) GetKeyAuth(ctx context.Context, keyAuthId string) (entities.KeyAuth, error) {
+	defer mw.check("getKeyAuth", time.Now())
+	return mw.next.GetKeyAuth(ctx, keyAuthId)
+}
+
+func (mw *slowQueryMiddleware) GetWorkspace(ctx context.Context, workspaceId string) (entities.Workspace, error) {
+	defer mw.check("getWorkspace", time.Now())
+	return mw.next.GetWorkspace(ctx, workspaceId)
+}
+
+func (mw *slowQueryMiddleware) DecrementRemainingKeyUsage(ctx context.Context, keyId string, cost int64) (int64, bool, error) {
+	defer mw.check("decrementRemainingKeyUsage", time.Now())
+	return mw.next.DecrementRemainingKeyUsage(ctx, keyId, cost)
+}
+
+func (mw *slowQueryMiddleware) VerifyAndConsume(ctx context.Context, hash string, cost int64) (entities.Key, int64, bool, error) {
+	defer mw.check("verifyAndConsume", time.Now())
+	return mw.next.VerifyAndConsume(ctx, hash, cost)
+}
+
+func (mw *slowQueryMiddleware) Ping(ctx context.Context) error {
+	defer mw.check("ping", time.Now())
+	return mw.next.Ping(ctx)
+}
+
+func (mw *slowQueryMiddleware) Stats() map[string]sql.DBStats {
+	return mw.next.Stats()
+}
+
+func (mw *slowQueryMiddleware) Close() error {
+	return mw.next.Close()
+}
+
+func (mw *slowQueryMiddleware) ListKeysByOwnerId(ctx context.Context, workspaceId string, ownerId string) ([]entities.Key, error) {
+	defer mw.check("listKeysByOwnerId", time.Now())
+	return mw.next.ListKeysByOwnerId(ctx, workspaceId, ownerId)
+}
+
+func (mw *slowQueryMiddleware) TransferKeysOwner(ctx context.Context, workspaceId, fromOwnerId, toOwnerId string) ([]entities.Key, error) {
+	defer mw.check("transferKeysOwner", time.Now())
+	return mw.next.TransferKeysOwner(ctx, workspaceId, fromOwnerId, toOwnerId)
+}
+
+func (mw *slowQueryMiddleware) UpdateKeyMeta(ctx context.Context, keyId string, meta map[string]any) error {
+	defer mw.check("updateKeyMeta", time.Now())
+	return mw.next.UpdateKeyMeta(ctx, keyId, meta)
+}
+
+func (mw *slowQueryMiddleware) CountKeysByWorkspace(ctx context.Context, workspaceId string) (int, error) {
+	defer mw.check("countKeysByWorkspace", time.Now())
+	return mw.next.CountKeysByWorkspace(ctx, workspaceId)
+}
+
+func (mw *slowQueryMiddleware) CountKeysExpiringBetween(ctx context.Context, workspaceId string, from time.Time, to time.Time) (int, error) {
+	defer mw.check("countKeysExpiringBetween", time.Now())
+	return mw.next.CountKeysExpiringBetween(ctx, workspaceId, from, to)
+}
+
+func (mw *slowQueryMiddleware) CountApisByWorkspace(ctx context.Context, workspaceId string) (int, error) {
+	defer mw.check("countApisByWorkspace", time.Now())
+	return mw.next.CountApisByWorkspace(ctx, workspaceId)
+}
+
+func (mw *slowQueryMiddleware) SetKeyEnabled(ctx context.Context, keyId string, enabled bool) error {
+	defer mw.check("setKeyEnabled", time.Now())
+	return mw.next.SetKeyEnabled(ctx, keyId, enabled)
+}
+
+func (mw *slowQueryMiddleware) TouchKeyLastUsed(ctx context.Context, keyId string, ts time.Time) error {
+	defer mw.check("touchKeyLastUsed", time.Now())
+	return mw.next.TouchKeyLastUsed(ctx, keyId, ts)
+}
+
+func (mw *slowQueryMiddleware) SetKeysEnabled(ctx context.Context, keyIds []string, enabled bool) (int, error) {
+	defer mw.check("setKeysEnabled", time.Now())
+	return mw.next.SetKeysEnabled(ctx, keyIds, enabled)
+}
+
+func (mw *slowQueryMiddleware) SetApiMetaSchema(ctx context.Context, apiId string, schema string) error {
+	defer mw.check("setApiMetaSchema", time.Now())
+	return mw.next.SetApiMetaSchema(ctx, apiId, schema)
+}
+
+func (mw *slowQueryMiddleware) SetApiAllowedMetaKeys(ctx context.Context, apiId string, keys []string) error {
+	defer mw.check("setApiAllowedMetaKeys", time.Now())
+	return mw.next.SetApiAllowedMetaKeys(ctx, apiId, keys)
+}
+
+func (mw *slowQueryMiddleware) SetWorkspaceEnabled(ctx context.Context, workspaceId string, enabled bool) error {
+	defer mw.check("setWorkspaceEnabled", time.Now())
+	return mw.next.SetWorkspaceEnabled(ctx, workspaceId, enabled)
+}
+
+func (mw *slowQueryMiddleware) SetWorkspaceHideKeyStart(ctx context.Context, workspaceId string, hide bool) error {
+	defer mw.check("setWorkspaceHideKeyStart", time.Now())
+	return mw.next.SetWorkspaceHideKeyStart(ctx, workspaceId, hide)
+}
+
+func (mw *slowQueryMiddleware) SetWorkspaceOmitKeyStart(ctx context.Context, workspaceId string, omit bool) error {
+	defer mw.check("setWorkspaceOmitKeyStart", time.Now())
+	return mw.next.SetWorkspaceOmitKeyStart(ctx, workspaceId, omit)
+}
+
+func (mw *slowQueryMiddleware) AppendAuditLog(ctx context.Context, entry audit.Entry) error {
+	defer mw.check("appendAuditLog", time.Now())
+	return mw.next.AppendAuditLog(ctx, entry)
+}
+
+func (mw *slowQueryMiddleware) ListAuditLogs(ctx context.Context, workspaceId string, filter audit.Filter) ([]audit.Entry, error) {
+	defer mw.check("listAuditLogs", time.Now())
+	return mw.next.ListAuditLogs(ctx, workspaceId, filter)
+}
+
+func (mw *slowQueryMiddleware) DeleteKeysByPrefix(ctx context.Context, keyAuthId string, prefix string) (int, error) {
+	defer mw.check("deleteKeysByPrefix", time.Now())
+	return mw.next.DeleteKeysByPrefix(ctx, keyAuthId, prefix)
+}
+
+func (mw *slowQueryMiddleware) ReEncryptKeys(ctx context.Context, batchSize int) (int, error) {
+	defer mw.check("reEncryptKeys", time.Now())
+	return mw.next.ReEncryptKeys(ctx, batchSize)
+}
+
+func (mw *slowQueryMiddleware) RecomputeKeyStarts(ctx context.Context, batchSize int) (int, int, error) {
+	defer mw.check("recomputeKeyStarts", time.Now())
+	return mw.next.RecomputeKeyStarts(ctx, batchSize)
+}
+
+func (mw *slowQueryMiddleware) MigrateRatelimits(ctx context.Context, batchSize int) (int, error) {
+	defer mw.check("migrateRatelimits", time.Now())
+	return mw.next.MigrateRatelimits(ctx, batchSize)
+}
+
+func (mw *slowQueryMiddleware) SearchKeys(ctx context.Context, keyAuthId string, query string, limit int) ([]entities.Key, error) {
+	defer mw.check("searchKeys", time.Now())
+	return mw.next.SearchKeys(ctx, keyAuthId, query, limit)
+}
+
+func (mw *slowQueryMiddleware) ListKeysByWorkspaceId(ctx context.Context, workspaceId string, afterId string, limit int) ([]entities.Key, error) {
+	defer mw.check("listKeysByWorkspaceId", time.Now())
+	return mw.next.ListKeysByWorkspaceId(ctx, workspaceId, afterId, limit)
+}
+
+func (mw *slowQueryMiddleware) ListKeysByPrefix(ctx context.Context, keyAuthId string, prefix string) ([]entities.Key, error) {
+	defer mw.check("listKeysByPrefix", time.Now())
+	return mw.next.ListKeysByPrefix(ctx, keyAuthId, prefix)
+}
+
+// a slow transaction may be a slow fn, the calls it makes with tx are checked on their own too
+func (mw *slowQueryMiddleware) WithTx(ctx context.Context, fn func(tx database.Database) error) error {
+	defer mw.check("withTx", time.Now())
+	return mw.next.WithTx(ctx, func(tx database.Database) error {
+		return fn(&slowQueryMiddleware{next: tx, logger: mw.logger, threshold: mw.threshold})
+	})
+}
+
+func (mw *slowQueryMiddleware) CreateKeys(ctx context.Context, newKeys []entities.Key) error {
+	defer mw.check("createKeys", time.Now())
+	return mw.next.CreateKeys(ctx, newKeys)
+}
+
+func (mw *slowQueryMiddleware) ListKeysExpiringBetween(ctx context.Context, keyAuthId string, from time.Time, to time.Time, limit int, offset int) ([]entities.Key, error) {
+	defer mw.check("listKeysExpiringBetween", time.Now())
+	return mw.next.ListKeysExpiringBetween(ctx, keyAuthId, from, to, limit, offset)
+}
+
+func (mw *slowQueryMiddleware) CreateWebhook(ctx context.Context, endpoint webhooks.Endpoint) error {
+	defer mw.check("createWebhook", time.Now())
+	return mw.next.CreateWebhook(ctx, endpoint)
+}
+
+func (mw *slowQueryMiddleware) ListWebhooks(ctx context.Context, workspaceId string) ([]webhooks.Endpoint, error) {
+	defer mw.check("listWebhooks", time.Now())
+	return mw.next.ListWebhooks(ctx, workspaceId)
+}
+
+func (mw *slowQueryMiddleware) DeleteWebhook(ctx context.Context, workspaceId, webhookId string) error {
+	defer mw.check("deleteWebhook", time.Now())
+	return mw.next.DeleteWebhook(ctx, workspaceId, webhookId)
+}
+
+func (mw *slowQueryMiddleware) IncrementKeyUsage(ctx context.Context, keyId string, ts time.Time) error {
+	defer mw.check("incrementKeyUsage", time.Now())
+	return mw.next.IncrementKeyUsage(ctx, keyId, ts)
+}
+
+func (mw *slowQueryMiddleware) AddKeyUsage(ctx context.Context, counts []usage.Count) error {
+	defer mw.check("addKeyUsage", time.Now())
+	return mw.next.AddKeyUsage(ctx, counts)
+}
+
+func (mw *slowQueryMiddleware) GetKeyUsage(ctx context.Context, keyId string, from, to time.Time, granularity usage.Granularity) ([]usage.Bucket, error) {
+	defer mw.check("getKeyUsage", time.Now())
+	return mw.next.GetKeyUsage(ctx, keyId, from, to, granularity)
+}
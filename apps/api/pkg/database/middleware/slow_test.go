@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/metrics"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// slowDatabase takes delay to look up a key
+type slowDatabase struct {
+	database.Database
+	delay time.Duration
+}
+
+func (db *slowDatabase) GetKeyByHash(ctx context.Context, hash string) (entities.Key, error) {
+	time.Sleep(db.delay)
+	return entities.Key{Hash: hash}, nil
+}
+
+func TestWithSlowQueryLogging(t *testing.T) {
+	testCases := []struct {
+		name  string
+		delay time.Duration
+		slow  bool
+	}{
+		{name: "fast", delay: 0},
+		{name: "slow", delay: 20 * time.Millisecond, slow: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			m := metrics.New()
+			// composes with the other decorators in the same order as in main
+			db := WithMetrics(WithSlowQueryLogging(&slowDatabase{delay: tc.delay}, zap.New(core), 10*time.Millisecond), m)
+
+			key, err := db.GetKeyByHash(context.Background(), "hash")
+			require.NoError(t, err)
+			require.Equal(t, "hash", key.Hash)
+			require.Equal(t, 1, promtestutil.CollectAndCount(m.DatabaseLatency))
+
+			if !tc.slow {
+				require.Equal(t, 0, logs.Len())
+				return
+			}
+			entries := logs.FilterMessage("database.slow").All()
+			require.Len(t, entries, 1)
+			require.Equal(t, zapcore.WarnLevel, entries[0].Level)
+			fields := entries[0].ContextMap()
+			require.Equal(t, "getKeyByHash", fields["method"])
+			require.Equal(t, "database", fields["pkg"])
+			require.GreaterOrEqual(t, fields["latency"], tc.delay)
+		})
+	}
+}
@@ -2,11 +2,16 @@ package middleware
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"time"
 
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
 	"github.com/unkeyed/unkey/apps/api/pkg/database"
 	"github.com/unkeyed/unkey/apps/api/pkg/entities"
 	"github.com/unkeyed/unkey/apps/api/pkg/tracing"
+	"github.com/unkeyed/unkey/apps/api/pkg/usage"
+	"github.com/unkeyed/unkey/apps/api/pkg/webhooks"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -36,6 +41,20 @@ func (mw *tracingMiddleware) CreateApi(ctx context.Context, newApi entities.Api)
 	return err
 
 }
+func (mw *tracingMiddleware) CreateApiWithKeyAuth(ctx context.Context, newApi entities.Api, newKeyAuth entities.KeyAuth) error {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.createApiWithKeyAuth", mw.pkg), trace.WithAttributes(
+		attribute.String("workspaceId", newApi.WorkspaceId),
+		attribute.String("apiId", newApi.Id),
+		attribute.String("keyAuthId", newKeyAuth.Id),
+	))
+	defer span.End()
+
+	err := mw.next.CreateApiWithKeyAuth(ctx, newApi, newKeyAuth)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
 func (mw *tracingMiddleware) GetApi(ctx context.Context, apiId string) (entities.Api, error) {
 
 	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.getApi", mw.pkg), trace.WithAttributes(attribute.String("apiId", apiId)))
@@ -74,6 +93,21 @@ func (mw *tracingMiddleware) DeleteKey(ctx context.Context, keyId string) error
 	}
 	return err
 }
+func (mw *tracingMiddleware) GetKeysByHashes(ctx context.Context, hashes []string) (map[string]entities.Key, error) {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.getKeysByHashes", mw.pkg), trace.WithAttributes(
+		attribute.Int("hashes", len(hashes)),
+	))
+	defer span.End()
+
+	keys, err := mw.next.GetKeysByHashes(ctx, hashes)
+	if err != nil {
+		span.RecordError(err)
+	} else {
+		span.SetAttributes(attribute.Int("found", len(keys)))
+	}
+	return keys, err
+}
+
 func (mw *tracingMiddleware) GetKeyByHash(ctx context.Context, hash string) (entities.Key, error) {
 	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.getKeyByHash", mw.pkg), trace.WithAttributes(
 		attribute.String("hash", hash),
@@ -92,6 +126,25 @@ func (mw *tracingMiddleware) GetKeyByHash(ctx context.Context, hash string) (ent
 	}
 	return key, err
 }
+func (mw *tracingMiddleware) GetKeyAndApiByHash(ctx context.Context, hash string) (entities.Key, entities.Api, error) {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.getKeyAndApiByHash", mw.pkg), trace.WithAttributes(
+		attribute.String("hash", hash),
+	))
+	defer span.End()
+
+	key, api, err := mw.next.GetKeyAndApiByHash(ctx, hash)
+	if err != nil {
+		span.RecordError(err)
+	} else {
+		span.SetAttributes(
+			attribute.String("workspaceId", key.WorkspaceId),
+			attribute.String("keyAuthId", key.KeyAuthId),
+			attribute.String("keyId", key.Id),
+			attribute.String("apiId", api.Id),
+		)
+	}
+	return key, api, err
+}
 func (mw *tracingMiddleware) GetKeyById(ctx context.Context, keyId string) (entities.Key, error) {
 	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.getKeyByid", mw.pkg), trace.WithAttributes(
 		attribute.String("keyId", keyId),
@@ -124,7 +177,7 @@ func (mw *tracingMiddleware) CountKeys(ctx context.Context, apiId string) (int,
 	}
 	return count, err
 }
-func (mw *tracingMiddleware) ListKeysByKeyAuthId(ctx context.Context, keyAuthId string, limit int, offset int, ownerId string) ([]entities.Key, error) {
+func (mw *tracingMiddleware) ListKeysByKeyAuthId(ctx context.Context, keyAuthId string, limit int, offset int, ownerId string) ([]entities.Key, int, error) {
 	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.listKeysByKeyAuthId", mw.pkg), trace.WithAttributes(
 		attribute.String("keyAuthId", keyAuthId),
 		attribute.Int("limit", limit),
@@ -133,11 +186,11 @@ func (mw *tracingMiddleware) ListKeysByKeyAuthId(ctx context.Context, keyAuthId
 	))
 	defer span.End()
 
-	keys, err := mw.next.ListKeysByKeyAuthId(ctx, keyAuthId, limit, offset, ownerId)
+	keys, total, err := mw.next.ListKeysByKeyAuthId(ctx, keyAuthId, limit, offset, ownerId)
 	if err != nil {
 		span.RecordError(err)
 	}
-	return keys, err
+	return keys, total, err
 }
 func (mw *tracingMiddleware) CreateWorkspace(ctx context.Context, newWorkspace entities.Workspace) error {
 	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.createWorkspace", mw.pkg), trace.WithAttributes(
@@ -164,17 +217,43 @@ func (mw *tracingMiddleware) GetWorkspace(ctx context.Context, workspaceId strin
 	return keys, err
 }
 
-func (mw *tracingMiddleware) DecrementRemainingKeyUsage(ctx context.Context, keyId string) (int64, error) {
+func (mw *tracingMiddleware) DecrementRemainingKeyUsage(ctx context.Context, keyId string, cost int64) (int64, bool, error) {
 	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.decrementRemainingKeyUsage", mw.pkg), trace.WithAttributes(
 		attribute.String("keyId", keyId),
+		attribute.Int64("cost", cost),
 	))
 	defer span.End()
 
-	remaining, err := mw.next.DecrementRemainingKeyUsage(ctx, keyId)
+	remaining, decremented, err := mw.next.DecrementRemainingKeyUsage(ctx, keyId, cost)
 	if err != nil {
 		span.RecordError(err)
+	} else {
+		span.SetAttributes(
+			attribute.Int64("remaining", remaining),
+			attribute.Bool("decremented", decremented),
+		)
 	}
-	return remaining, err
+	return remaining, decremented, err
+}
+
+func (mw *tracingMiddleware) VerifyAndConsume(ctx context.Context, hash string, cost int64) (entities.Key, int64, bool, error) {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.verifyAndConsume", mw.pkg), trace.WithAttributes(
+		attribute.String("hash", hash),
+		attribute.Int64("cost", cost),
+	))
+	defer span.End()
+
+	key, remaining, consumed, err := mw.next.VerifyAndConsume(ctx, hash, cost)
+	if err != nil {
+		span.RecordError(err)
+	} else {
+		span.SetAttributes(
+			attribute.String("keyId", key.Id),
+			attribute.Int64("remaining", remaining),
+			attribute.Bool("consumed", consumed),
+		)
+	}
+	return key, remaining, consumed, err
 }
 
 func (mw *tracingMiddleware) UpdateKey(ctx context.Context, key entities.Key) error {
@@ -190,6 +269,19 @@ func (mw *tracingMiddleware) UpdateKey(ctx context.Context, key entities.Key) er
 	return err
 }
 
+func (mw *tracingMiddleware) UpdateKeySecret(ctx context.Context, key entities.Key) error {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.updateKeySecret", mw.pkg), trace.WithAttributes(
+		attribute.String("keyId", key.Id),
+	))
+	defer span.End()
+
+	err := mw.next.UpdateKeySecret(ctx, key)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
 func (mw *tracingMiddleware) CreateKeyAuth(ctx context.Context, keyAuth entities.KeyAuth) error {
 	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.createKeyAuth", mw.pkg), trace.WithAttributes(
 		attribute.String("keyAuthId", keyAuth.Id),
@@ -228,3 +320,463 @@ func (mw *tracingMiddleware) GetApiByKeyAuthId(ctx context.Context, keyAuthId st
 	}
 	return api, err
 }
+
+// the calls fn makes with tx get spans of their own
+func (mw *tracingMiddleware) WithTx(ctx context.Context, fn func(tx database.Database) error) error {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.withTx", mw.pkg))
+	defer span.End()
+
+	err := mw.next.WithTx(ctx, func(tx database.Database) error {
+		return fn(&tracingMiddleware{next: tx, t: mw.t, pkg: mw.pkg})
+	})
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+func (mw *tracingMiddleware) Ping(ctx context.Context) error {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.ping", mw.pkg))
+	defer span.End()
+
+	err := mw.next.Ping(ctx)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+func (mw *tracingMiddleware) Stats() map[string]sql.DBStats {
+	return mw.next.Stats()
+}
+
+func (mw *tracingMiddleware) Close() error {
+	return mw.next.Close()
+}
+
+func (mw *tracingMiddleware) ListKeysByOwnerId(ctx context.Context, workspaceId string, ownerId string) ([]entities.Key, error) {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.listKeysByOwnerId", mw.pkg), trace.WithAttributes(
+		attribute.String("workspaceId", workspaceId),
+		attribute.String("ownerId", ownerId),
+	))
+	defer span.End()
+
+	res, err := mw.next.ListKeysByOwnerId(ctx, workspaceId, ownerId)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return res, err
+}
+
+func (mw *tracingMiddleware) TransferKeysOwner(ctx context.Context, workspaceId, fromOwnerId, toOwnerId string) ([]entities.Key, error) {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.transferKeysOwner", mw.pkg), trace.WithAttributes(
+		attribute.String("workspaceId", workspaceId),
+		attribute.String("fromOwnerId", fromOwnerId),
+		attribute.String("toOwnerId", toOwnerId),
+	))
+	defer span.End()
+
+	res, err := mw.next.TransferKeysOwner(ctx, workspaceId, fromOwnerId, toOwnerId)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return res, err
+}
+
+func (mw *tracingMiddleware) UpdateKeyMeta(ctx context.Context, keyId string, meta map[string]any) error {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.updateKeyMeta", mw.pkg), trace.WithAttributes(
+		attribute.String("keyId", keyId),
+	))
+	defer span.End()
+
+	err := mw.next.UpdateKeyMeta(ctx, keyId, meta)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+func (mw *tracingMiddleware) CountKeysByWorkspace(ctx context.Context, workspaceId string) (int, error) {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.countKeysByWorkspace", mw.pkg), trace.WithAttributes(
+		attribute.String("workspaceId", workspaceId),
+	))
+	defer span.End()
+
+	count, err := mw.next.CountKeysByWorkspace(ctx, workspaceId)
+	if err != nil {
+		span.RecordError(err)
+	} else {
+		span.SetAttributes(attribute.Int("count", count))
+	}
+	return count, err
+}
+
+func (mw *tracingMiddleware) CountKeysExpiringBetween(ctx context.Context, workspaceId string, from time.Time, to time.Time) (int, error) {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.countKeysExpiringBetween", mw.pkg), trace.WithAttributes(
+		attribute.String("workspaceId", workspaceId),
+	))
+	defer span.End()
+
+	count, err := mw.next.CountKeysExpiringBetween(ctx, workspaceId, from, to)
+	if err != nil {
+		span.RecordError(err)
+	} else {
+		span.SetAttributes(attribute.Int("count", count))
+	}
+	return count, err
+}
+
+func (mw *tracingMiddleware) CountApisByWorkspace(ctx context.Context, workspaceId string) (int, error) {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.countApisByWorkspace", mw.pkg), trace.WithAttributes(
+		attribute.String("workspaceId", workspaceId),
+	))
+	defer span.End()
+
+	count, err := mw.next.CountApisByWorkspace(ctx, workspaceId)
+	if err != nil {
+		span.RecordError(err)
+	} else {
+		span.SetAttributes(attribute.Int("count", count))
+	}
+	return count, err
+}
+
+func (mw *tracingMiddleware) SetKeyEnabled(ctx context.Context, keyId string, enabled bool) error {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.setKeyEnabled", mw.pkg), trace.WithAttributes(
+		attribute.String("keyId", keyId),
+	))
+	defer span.End()
+
+	err := mw.next.SetKeyEnabled(ctx, keyId, enabled)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+func (mw *tracingMiddleware) TouchKeyLastUsed(ctx context.Context, keyId string, ts time.Time) error {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.touchKeyLastUsed", mw.pkg), trace.WithAttributes(
+		attribute.String("keyId", keyId),
+	))
+	defer span.End()
+
+	err := mw.next.TouchKeyLastUsed(ctx, keyId, ts)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+func (mw *tracingMiddleware) SetKeysEnabled(ctx context.Context, keyIds []string, enabled bool) (int, error) {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.setKeysEnabled", mw.pkg), trace.WithAttributes(
+		attribute.Int("keys", len(keyIds)),
+		attribute.Bool("enabled", enabled),
+	))
+	defer span.End()
+
+	res, err := mw.next.SetKeysEnabled(ctx, keyIds, enabled)
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.SetAttributes(attribute.Int("changed", res))
+	return res, err
+}
+
+func (mw *tracingMiddleware) SetApiMetaSchema(ctx context.Context, apiId string, schema string) error {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.setApiMetaSchema", mw.pkg), trace.WithAttributes(
+		attribute.String("apiId", apiId),
+	))
+	defer span.End()
+
+	err := mw.next.SetApiMetaSchema(ctx, apiId, schema)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+func (mw *tracingMiddleware) SetApiAllowedMetaKeys(ctx context.Context, apiId string, keys []string) error {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.setApiAllowedMetaKeys", mw.pkg), trace.WithAttributes(
+		attribute.String("apiId", apiId),
+	))
+	defer span.End()
+
+	err := mw.next.SetApiAllowedMetaKeys(ctx, apiId, keys)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+func (mw *tracingMiddleware) SetWorkspaceEnabled(ctx context.Context, workspaceId string, enabled bool) error {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.setWorkspaceEnabled", mw.pkg), trace.WithAttributes(
+		attribute.String("workspaceId", workspaceId),
+	))
+	defer span.End()
+
+	err := mw.next.SetWorkspaceEnabled(ctx, workspaceId, enabled)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+func (mw *tracingMiddleware) SetWorkspaceHideKeyStart(ctx context.Context, workspaceId string, hide bool) error {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.setWorkspaceHideKeyStart", mw.pkg), trace.WithAttributes(
+		attribute.String("workspaceId", workspaceId),
+		attribute.Bool("hide", hide),
+	))
+	defer span.End()
+
+	err := mw.next.SetWorkspaceHideKeyStart(ctx, workspaceId, hide)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+func (mw *tracingMiddleware) SetWorkspaceOmitKeyStart(ctx context.Context, workspaceId string, omit bool) error {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.setWorkspaceOmitKeyStart", mw.pkg), trace.WithAttributes(
+		attribute.String("workspaceId", workspaceId),
+		attribute.Bool("omit", omit),
+	))
+	defer span.End()
+
+	err := mw.next.SetWorkspaceOmitKeyStart(ctx, workspaceId, omit)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+func (mw *tracingMiddleware) AppendAuditLog(ctx context.Context, entry audit.Entry) error {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.appendAuditLog", mw.pkg), trace.WithAttributes(
+		attribute.String("workspaceId", entry.WorkspaceId),
+		attribute.String("action", string(entry.Action)),
+	))
+	defer span.End()
+
+	err := mw.next.AppendAuditLog(ctx, entry)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+func (mw *tracingMiddleware) ListAuditLogs(ctx context.Context, workspaceId string, filter audit.Filter) ([]audit.Entry, error) {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.listAuditLogs", mw.pkg), trace.WithAttributes(
+		attribute.String("workspaceId", workspaceId),
+	))
+	defer span.End()
+
+	res, err := mw.next.ListAuditLogs(ctx, workspaceId, filter)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return res, err
+}
+
+func (mw *tracingMiddleware) DeleteKeysByPrefix(ctx context.Context, keyAuthId string, prefix string) (int, error) {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.deleteKeysByPrefix", mw.pkg), trace.WithAttributes(
+		attribute.String("keyAuthId", keyAuthId),
+		attribute.String("prefix", prefix),
+	))
+	defer span.End()
+
+	res, err := mw.next.DeleteKeysByPrefix(ctx, keyAuthId, prefix)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return res, err
+}
+
+func (mw *tracingMiddleware) ReEncryptKeys(ctx context.Context, batchSize int) (int, error) {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.reEncryptKeys", mw.pkg), trace.WithAttributes(
+		attribute.Int("batchSize", batchSize),
+	))
+	defer span.End()
+
+	res, err := mw.next.ReEncryptKeys(ctx, batchSize)
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.SetAttributes(attribute.Int("migrated", res))
+	return res, err
+}
+
+func (mw *tracingMiddleware) RecomputeKeyStarts(ctx context.Context, batchSize int) (int, int, error) {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.recomputeKeyStarts", mw.pkg), trace.WithAttributes(
+		attribute.Int("batchSize", batchSize),
+	))
+	defer span.End()
+
+	updated, skipped, err := mw.next.RecomputeKeyStarts(ctx, batchSize)
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.SetAttributes(attribute.Int("updated", updated), attribute.Int("skipped", skipped))
+	return updated, skipped, err
+}
+
+func (mw *tracingMiddleware) MigrateRatelimits(ctx context.Context, batchSize int) (int, error) {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.migrateRatelimits", mw.pkg), trace.WithAttributes(
+		attribute.Int("batchSize", batchSize),
+	))
+	defer span.End()
+
+	res, err := mw.next.MigrateRatelimits(ctx, batchSize)
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.SetAttributes(attribute.Int("migrated", res))
+	return res, err
+}
+
+func (mw *tracingMiddleware) SearchKeys(ctx context.Context, keyAuthId string, query string, limit int) ([]entities.Key, error) {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.searchKeys", mw.pkg), trace.WithAttributes(
+		attribute.String("keyAuthId", keyAuthId),
+		attribute.Int("limit", limit),
+	))
+	defer span.End()
+
+	res, err := mw.next.SearchKeys(ctx, keyAuthId, query, limit)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return res, err
+}
+
+func (mw *tracingMiddleware) ListKeysByWorkspaceId(ctx context.Context, workspaceId string, afterId string, limit int) ([]entities.Key, error) {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.listKeysByWorkspaceId", mw.pkg), trace.WithAttributes(
+		attribute.String("workspaceId", workspaceId),
+		attribute.String("afterId", afterId),
+		attribute.Int("limit", limit),
+	))
+	defer span.End()
+
+	res, err := mw.next.ListKeysByWorkspaceId(ctx, workspaceId, afterId, limit)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return res, err
+}
+
+func (mw *tracingMiddleware) ListKeysByPrefix(ctx context.Context, keyAuthId string, prefix string) ([]entities.Key, error) {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.listKeysByPrefix", mw.pkg), trace.WithAttributes(
+		attribute.String("keyAuthId", keyAuthId),
+		attribute.String("prefix", prefix),
+	))
+	defer span.End()
+
+	res, err := mw.next.ListKeysByPrefix(ctx, keyAuthId, prefix)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return res, err
+}
+
+func (mw *tracingMiddleware) CreateKeys(ctx context.Context, newKeys []entities.Key) error {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.createKeys", mw.pkg))
+	defer span.End()
+
+	err := mw.next.CreateKeys(ctx, newKeys)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+func (mw *tracingMiddleware) ListKeysExpiringBetween(ctx context.Context, keyAuthId string, from time.Time, to time.Time, limit int, offset int) ([]entities.Key, error) {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.listKeysExpiringBetween", mw.pkg), trace.WithAttributes(
+		attribute.String("keyAuthId", keyAuthId),
+		attribute.Int("limit", limit),
+		attribute.Int("offset", offset),
+	))
+	defer span.End()
+
+	res, err := mw.next.ListKeysExpiringBetween(ctx, keyAuthId, from, to, limit, offset)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return res, err
+}
+
+func (mw *tracingMiddleware) CreateWebhook(ctx context.Context, endpoint webhooks.Endpoint) error {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.createWebhook", mw.pkg), trace.WithAttributes(
+		attribute.String("webhookId", endpoint.Id),
+		attribute.String("workspaceId", endpoint.WorkspaceId),
+	))
+	defer span.End()
+
+	err := mw.next.CreateWebhook(ctx, endpoint)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+func (mw *tracingMiddleware) ListWebhooks(ctx context.Context, workspaceId string) ([]webhooks.Endpoint, error) {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.listWebhooks", mw.pkg), trace.WithAttributes(
+		attribute.String("workspaceId", workspaceId),
+	))
+	defer span.End()
+
+	res, err := mw.next.ListWebhooks(ctx, workspaceId)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return res, err
+}
+
+func (mw *tracingMiddleware) DeleteWebhook(ctx context.Context, workspaceId, webhookId string) error {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.deleteWebhook", mw.pkg), trace.WithAttributes(
+		attribute.String("workspaceId", workspaceId),
+		attribute.String("webhookId", webhookId),
+	))
+	defer span.End()
+
+	err := mw.next.DeleteWebhook(ctx, workspaceId, webhookId)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+func (mw *tracingMiddleware) IncrementKeyUsage(ctx context.Context, keyId string, ts time.Time) error {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.incrementKeyUsage", mw.pkg), trace.WithAttributes(
+		attribute.String("keyId", keyId),
+	))
+	defer span.End()
+
+	err := mw.next.IncrementKeyUsage(ctx, keyId, ts)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+func (mw *tracingMiddleware) AddKeyUsage(ctx context.Context, counts []usage.Count) error {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.addKeyUsage", mw.pkg), trace.WithAttributes(
+		attribute.Int("count", len(counts)),
+	))
+	defer span.End()
+
+	err := mw.next.AddKeyUsage(ctx, counts)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+func (mw *tracingMiddleware) GetKeyUsage(ctx context.Context, keyId string, from, to time.Time, granularity usage.Granularity) ([]usage.Bucket, error) {
+	ctx, span := mw.t.Start(ctx, fmt.Sprintf("%s.getKeyUsage", mw.pkg), trace.WithAttributes(
+		attribute.String("keyId", keyId),
+	))
+	defer span.End()
+
+	res, err := mw.next.GetKeyUsage(ctx, keyId, from, to, granularity)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return res, err
+}
@@ -10,12 +10,15 @@ import (
 
 // API represents a row from 'unkey.apis'.
 type API struct {
-	ID          string         `json:"id"`           // id
-	Name        string         `json:"name"`         // name
-	WorkspaceID string         `json:"workspace_id"` // workspace_id
-	IPWhitelist sql.NullString `json:"ip_whitelist"` // ip_whitelist
-	AuthType    NullAuthType   `json:"auth_type"`    // auth_type
-	KeyAuthID   sql.NullString `json:"key_auth_id"`  // key_auth_id
+	ID              string         `json:"id"`                // id
+	Name            string         `json:"name"`              // name
+	WorkspaceID     string         `json:"workspace_id"`      // workspace_id
+	IPWhitelist     sql.NullString `json:"ip_whitelist"`      // ip_whitelist
+	AuthType        NullAuthType   `json:"auth_type"`         // auth_type
+	KeyAuthID       sql.NullString `json:"key_auth_id"`       // key_auth_id
+	MetaSchema      sql.NullString `json:"meta_schema"`       // meta_schema
+	AllowedMetaKeys sql.NullString `json:"allowed_meta_keys"` // allowed_meta_keys
+	Prefix          sql.NullString `json:"prefix"`            // prefix
 	// xo fields
 	_exists, _deleted bool
 }
@@ -41,13 +44,13 @@ func (a *API) Insert(ctx context.Context, db DB) error {
 	}
 	// insert (manual)
 	const sqlstr = `INSERT INTO unkey.apis (` +
-		`id, name, workspace_id, ip_whitelist, auth_type, key_auth_id` +
+		`id, name, workspace_id, ip_whitelist, auth_type, key_auth_id, meta_schema, allowed_meta_keys, prefix` +
 		`) VALUES (` +
-		`?, ?, ?, ?, ?, ?` +
+		`?, ?, ?, ?, ?, ?, ?, ?, ?` +
 		`)`
 	// run
-	logf(sqlstr, a.ID, a.Name, a.WorkspaceID, a.IPWhitelist, a.AuthType, a.KeyAuthID)
-	if _, err := db.ExecContext(ctx, sqlstr, a.ID, a.Name, a.WorkspaceID, a.IPWhitelist, a.AuthType, a.KeyAuthID); err != nil {
+	logf(sqlstr, a.ID, a.Name, a.WorkspaceID, a.IPWhitelist, a.AuthType, a.KeyAuthID, a.MetaSchema, a.AllowedMetaKeys, a.Prefix)
+	if _, err := db.ExecContext(ctx, sqlstr, a.ID, a.Name, a.WorkspaceID, a.IPWhitelist, a.AuthType, a.KeyAuthID, a.MetaSchema, a.AllowedMetaKeys, a.Prefix); err != nil {
 		return logerror(err)
 	}
 	// set exists
@@ -65,11 +68,11 @@ func (a *API) Update(ctx context.Context, db DB) error {
 	}
 	// update with primary key
 	const sqlstr = `UPDATE unkey.apis SET ` +
-		`name = ?, workspace_id = ?, ip_whitelist = ?, auth_type = ?, key_auth_id = ? ` +
+		`name = ?, workspace_id = ?, ip_whitelist = ?, auth_type = ?, key_auth_id = ?, meta_schema = ?, allowed_meta_keys = ?, prefix = ? ` +
 		`WHERE id = ?`
 	// run
-	logf(sqlstr, a.Name, a.WorkspaceID, a.IPWhitelist, a.AuthType, a.KeyAuthID, a.ID)
-	if _, err := db.ExecContext(ctx, sqlstr, a.Name, a.WorkspaceID, a.IPWhitelist, a.AuthType, a.KeyAuthID, a.ID); err != nil {
+	logf(sqlstr, a.Name, a.WorkspaceID, a.IPWhitelist, a.AuthType, a.KeyAuthID, a.MetaSchema, a.AllowedMetaKeys, a.Prefix, a.ID)
+	if _, err := db.ExecContext(ctx, sqlstr, a.Name, a.WorkspaceID, a.IPWhitelist, a.AuthType, a.KeyAuthID, a.MetaSchema, a.AllowedMetaKeys, a.Prefix, a.ID); err != nil {
 		return logerror(err)
 	}
 	return nil
@@ -91,15 +94,15 @@ func (a *API) Upsert(ctx context.Context, db DB) error {
 	}
 	// upsert
 	const sqlstr = `INSERT INTO unkey.apis (` +
-		`id, name, workspace_id, ip_whitelist, auth_type, key_auth_id` +
+		`id, name, workspace_id, ip_whitelist, auth_type, key_auth_id, meta_schema, allowed_meta_keys, prefix` +
 		`) VALUES (` +
-		`?, ?, ?, ?, ?, ?` +
+		`?, ?, ?, ?, ?, ?, ?, ?, ?` +
 		`)` +
 		` ON DUPLICATE KEY UPDATE ` +
-		`id = VALUES(id), name = VALUES(name), workspace_id = VALUES(workspace_id), ip_whitelist = VALUES(ip_whitelist), auth_type = VALUES(auth_type), key_auth_id = VALUES(key_auth_id)`
+		`id = VALUES(id), name = VALUES(name), workspace_id = VALUES(workspace_id), ip_whitelist = VALUES(ip_whitelist), auth_type = VALUES(auth_type), key_auth_id = VALUES(key_auth_id), meta_schema = VALUES(meta_schema), allowed_meta_keys = VALUES(allowed_meta_keys), prefix = VALUES(prefix)`
 	// run
-	logf(sqlstr, a.ID, a.Name, a.WorkspaceID, a.IPWhitelist, a.AuthType, a.KeyAuthID)
-	if _, err := db.ExecContext(ctx, sqlstr, a.ID, a.Name, a.WorkspaceID, a.IPWhitelist, a.AuthType, a.KeyAuthID); err != nil {
+	logf(sqlstr, a.ID, a.Name, a.WorkspaceID, a.IPWhitelist, a.AuthType, a.KeyAuthID, a.MetaSchema, a.AllowedMetaKeys, a.Prefix)
+	if _, err := db.ExecContext(ctx, sqlstr, a.ID, a.Name, a.WorkspaceID, a.IPWhitelist, a.AuthType, a.KeyAuthID, a.MetaSchema, a.AllowedMetaKeys, a.Prefix); err != nil {
 		return logerror(err)
 	}
 	// set exists
@@ -134,7 +137,7 @@ func (a *API) Delete(ctx context.Context, db DB) error {
 func APIByID(ctx context.Context, db DB, id string) (*API, error) {
 	// query
 	const sqlstr = `SELECT ` +
-		`id, name, workspace_id, ip_whitelist, auth_type, key_auth_id ` +
+		`id, name, workspace_id, ip_whitelist, auth_type, key_auth_id, meta_schema, allowed_meta_keys, prefix ` +
 		`FROM unkey.apis ` +
 		`WHERE id = ?`
 	// run
@@ -142,7 +145,7 @@ func APIByID(ctx context.Context, db DB, id string) (*API, error) {
 	a := API{
 		_exists: true,
 	}
-	if err := db.QueryRowContext(ctx, sqlstr, id).Scan(&a.ID, &a.Name, &a.WorkspaceID, &a.IPWhitelist, &a.AuthType, &a.KeyAuthID); err != nil {
+	if err := db.QueryRowContext(ctx, sqlstr, id).Scan(&a.ID, &a.Name, &a.WorkspaceID, &a.IPWhitelist, &a.AuthType, &a.KeyAuthID, &a.MetaSchema, &a.AllowedMetaKeys, a.Prefix); err != nil {
 		return nil, logerror(err)
 	}
 	return &a, nil
@@ -154,7 +157,7 @@ func APIByID(ctx context.Context, db DB, id string) (*API, error) {
 func APIByKeyAuthID(ctx context.Context, db DB, keyAuthID sql.NullString) (*API, error) {
 	// query
 	const sqlstr = `SELECT ` +
-		`id, name, workspace_id, ip_whitelist, auth_type, key_auth_id ` +
+		`id, name, workspace_id, ip_whitelist, auth_type, key_auth_id, meta_schema, allowed_meta_keys, prefix ` +
 		`FROM unkey.apis ` +
 		`WHERE key_auth_id = ?`
 	// run
@@ -162,7 +165,7 @@ func APIByKeyAuthID(ctx context.Context, db DB, keyAuthID sql.NullString) (*API,
 	a := API{
 		_exists: true,
 	}
-	if err := db.QueryRowContext(ctx, sqlstr, keyAuthID).Scan(&a.ID, &a.Name, &a.WorkspaceID, &a.IPWhitelist, &a.AuthType, &a.KeyAuthID); err != nil {
+	if err := db.QueryRowContext(ctx, sqlstr, keyAuthID).Scan(&a.ID, &a.Name, &a.WorkspaceID, &a.IPWhitelist, &a.AuthType, &a.KeyAuthID, &a.MetaSchema, &a.AllowedMetaKeys, a.Prefix); err != nil {
 		return nil, logerror(err)
 	}
 	return &a, nil
@@ -17,6 +17,7 @@ type Key struct {
 	Meta                    sql.NullString `json:"meta"`                      // meta
 	CreatedAt               time.Time      `json:"created_at"`                // created_at
 	Expires                 sql.NullTime   `json:"expires"`                   // expires
+	Ratelimit               sql.NullString `json:"ratelimit"`                 // ratelimit
 	RatelimitType           sql.NullString `json:"ratelimit_type"`            // ratelimit_type
 	RatelimitLimit          sql.NullInt64  `json:"ratelimit_limit"`           // ratelimit_limit
 	RatelimitRefillRate     sql.NullInt64  `json:"ratelimit_refill_rate"`     // ratelimit_refill_rate
@@ -26,6 +27,16 @@ type Key struct {
 	Name                    sql.NullString `json:"name"`                      // name
 	RemainingRequests       sql.NullInt64  `json:"remaining_requests"`        // remaining_requests
 	KeyAuthID               sql.NullString `json:"key_auth_id"`               // key_auth_id
+	SuspendedAt             sql.NullTime   `json:"suspended_at"`              // suspended_at
+	PreviousHash            sql.NullString `json:"previous_hash"`             // previous_hash
+	PreviousHashExpires     sql.NullTime   `json:"previous_hash_expires"`     // previous_hash_expires
+	Scopes                  sql.NullString `json:"scopes"`                    // scopes
+	Encrypted               sql.NullString `json:"encrypted"`                 // encrypted
+	LastUsedAt              sql.NullTime   `json:"last_used_at"`              // last_used_at
+	DisableOnDepletion      bool           `json:"disable_on_depletion"`      // disable_on_depletion
+	ParentKeyID             sql.NullString `json:"parent_key_id"`             // parent_key_id
+	RemainingWarnThreshold  sql.NullInt64  `json:"remaining_warn_threshold"`  // remaining_warn_threshold
+	Format                  sql.NullString `json:"format"`                    // format
 	// xo fields
 	_exists, _deleted bool
 }
@@ -51,13 +62,13 @@ func (k *Key) Insert(ctx context.Context, db DB) error {
 	}
 	// insert (manual)
 	const sqlstr = `INSERT INTO unkey.keys (` +
-		`id, hash, start, owner_id, meta, created_at, expires, ratelimit_type, ratelimit_limit, ratelimit_refill_rate, ratelimit_refill_interval, workspace_id, for_workspace_id, name, remaining_requests, key_auth_id` +
+		`id, hash, start, owner_id, meta, created_at, expires, ratelimit, ratelimit_type, ratelimit_limit, ratelimit_refill_rate, ratelimit_refill_interval, workspace_id, for_workspace_id, name, remaining_requests, key_auth_id, suspended_at, previous_hash, previous_hash_expires, scopes, encrypted, last_used_at, disable_on_depletion, parent_key_id, remaining_warn_threshold, format` +
 		`) VALUES (` +
-		`?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?` +
+		`?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?` +
 		`)`
 	// run
-	logf(sqlstr, k.ID, k.Hash, k.Start, k.OwnerID, k.Meta, k.CreatedAt, k.Expires, k.RatelimitType, k.RatelimitLimit, k.RatelimitRefillRate, k.RatelimitRefillInterval, k.WorkspaceID, k.ForWorkspaceID, k.Name, k.RemainingRequests, k.KeyAuthID)
-	if _, err := db.ExecContext(ctx, sqlstr, k.ID, k.Hash, k.Start, k.OwnerID, k.Meta, k.CreatedAt, k.Expires, k.RatelimitType, k.RatelimitLimit, k.RatelimitRefillRate, k.RatelimitRefillInterval, k.WorkspaceID, k.ForWorkspaceID, k.Name, k.RemainingRequests, k.KeyAuthID); err != nil {
+	logf(sqlstr, k.ID, k.Hash, k.Start, k.OwnerID, k.Meta, k.CreatedAt, k.Expires, k.Ratelimit, k.RatelimitType, k.RatelimitLimit, k.RatelimitRefillRate, k.RatelimitRefillInterval, k.WorkspaceID, k.ForWorkspaceID, k.Name, k.RemainingRequests, k.KeyAuthID, k.SuspendedAt, k.PreviousHash, k.PreviousHashExpires, k.Scopes, k.Encrypted, k.LastUsedAt, k.DisableOnDepletion, k.ParentKeyID, k.RemainingWarnThreshold, k.Format)
+	if _, err := db.ExecContext(ctx, sqlstr, k.ID, k.Hash, k.Start, k.OwnerID, k.Meta, k.CreatedAt, k.Expires, k.Ratelimit, k.RatelimitType, k.RatelimitLimit, k.RatelimitRefillRate, k.RatelimitRefillInterval, k.WorkspaceID, k.ForWorkspaceID, k.Name, k.RemainingRequests, k.KeyAuthID, k.SuspendedAt, k.PreviousHash, k.PreviousHashExpires, k.Scopes, k.Encrypted, k.LastUsedAt, k.DisableOnDepletion, k.ParentKeyID, k.RemainingWarnThreshold, k.Format); err != nil {
 		return logerror(err)
 	}
 	// set exists
@@ -75,11 +86,11 @@ func (k *Key) Update(ctx context.Context, db DB) error {
 	}
 	// update with primary key
 	const sqlstr = `UPDATE unkey.keys SET ` +
-		`hash = ?, start = ?, owner_id = ?, meta = ?, created_at = ?, expires = ?, ratelimit_type = ?, ratelimit_limit = ?, ratelimit_refill_rate = ?, ratelimit_refill_interval = ?, workspace_id = ?, for_workspace_id = ?, name = ?, remaining_requests = ?, key_auth_id = ? ` +
+		`hash = ?, start = ?, owner_id = ?, meta = ?, created_at = ?, expires = ?, ratelimit = ?, ratelimit_type = ?, ratelimit_limit = ?, ratelimit_refill_rate = ?, ratelimit_refill_interval = ?, workspace_id = ?, for_workspace_id = ?, name = ?, remaining_requests = ?, key_auth_id = ?, suspended_at = ?, previous_hash = ?, previous_hash_expires = ?, scopes = ?, encrypted = ?, last_used_at = ?, disable_on_depletion = ?, parent_key_id = ?, remaining_warn_threshold = ?, format = ? ` +
 		`WHERE id = ?`
 	// run
-	logf(sqlstr, k.Hash, k.Start, k.OwnerID, k.Meta, k.CreatedAt, k.Expires, k.RatelimitType, k.RatelimitLimit, k.RatelimitRefillRate, k.RatelimitRefillInterval, k.WorkspaceID, k.ForWorkspaceID, k.Name, k.RemainingRequests, k.KeyAuthID, k.ID)
-	if _, err := db.ExecContext(ctx, sqlstr, k.Hash, k.Start, k.OwnerID, k.Meta, k.CreatedAt, k.Expires, k.RatelimitType, k.RatelimitLimit, k.RatelimitRefillRate, k.RatelimitRefillInterval, k.WorkspaceID, k.ForWorkspaceID, k.Name, k.RemainingRequests, k.KeyAuthID, k.ID); err != nil {
+	logf(sqlstr, k.Hash, k.Start, k.OwnerID, k.Meta, k.CreatedAt, k.Expires, k.Ratelimit, k.RatelimitType, k.RatelimitLimit, k.RatelimitRefillRate, k.RatelimitRefillInterval, k.WorkspaceID, k.ForWorkspaceID, k.Name, k.RemainingRequests, k.KeyAuthID, k.SuspendedAt, k.PreviousHash, k.PreviousHashExpires, k.Scopes, k.Encrypted, k.LastUsedAt, k.DisableOnDepletion, k.ParentKeyID, k.RemainingWarnThreshold, k.Format, k.ID)
+	if _, err := db.ExecContext(ctx, sqlstr, k.Hash, k.Start, k.OwnerID, k.Meta, k.CreatedAt, k.Expires, k.Ratelimit, k.RatelimitType, k.RatelimitLimit, k.RatelimitRefillRate, k.RatelimitRefillInterval, k.WorkspaceID, k.ForWorkspaceID, k.Name, k.RemainingRequests, k.KeyAuthID, k.SuspendedAt, k.PreviousHash, k.PreviousHashExpires, k.Scopes, k.Encrypted, k.LastUsedAt, k.DisableOnDepletion, k.ParentKeyID, k.RemainingWarnThreshold, k.Format, k.ID); err != nil {
 		return logerror(err)
 	}
 	return nil
@@ -101,15 +112,15 @@ func (k *Key) Upsert(ctx context.Context, db DB) error {
 	}
 	// upsert
 	const sqlstr = `INSERT INTO unkey.keys (` +
-		`id, hash, start, owner_id, meta, created_at, expires, ratelimit_type, ratelimit_limit, ratelimit_refill_rate, ratelimit_refill_interval, workspace_id, for_workspace_id, name, remaining_requests, key_auth_id` +
+		`id, hash, start, owner_id, meta, created_at, expires, ratelimit, ratelimit_type, ratelimit_limit, ratelimit_refill_rate, ratelimit_refill_interval, workspace_id, for_workspace_id, name, remaining_requests, key_auth_id, suspended_at, previous_hash, previous_hash_expires, scopes, encrypted, last_used_at, disable_on_depletion, parent_key_id, remaining_warn_threshold, format` +
 		`) VALUES (` +
-		`?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?` +
+		`?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?` +
 		`)` +
 		` ON DUPLICATE KEY UPDATE ` +
-		`id = VALUES(id), hash = VALUES(hash), start = VALUES(start), owner_id = VALUES(owner_id), meta = VALUES(meta), created_at = VALUES(created_at), expires = VALUES(expires), ratelimit_type = VALUES(ratelimit_type), ratelimit_limit = VALUES(ratelimit_limit), ratelimit_refill_rate = VALUES(ratelimit_refill_rate), ratelimit_refill_interval = VALUES(ratelimit_refill_interval), workspace_id = VALUES(workspace_id), for_workspace_id = VALUES(for_workspace_id), name = VALUES(name), remaining_requests = VALUES(remaining_requests), key_auth_id = VALUES(key_auth_id)`
+		`id = VALUES(id), hash = VALUES(hash), start = VALUES(start), owner_id = VALUES(owner_id), meta = VALUES(meta), created_at = VALUES(created_at), expires = VALUES(expires), ratelimit = VALUES(ratelimit), ratelimit_type = VALUES(ratelimit_type), ratelimit_limit = VALUES(ratelimit_limit), ratelimit_refill_rate = VALUES(ratelimit_refill_rate), ratelimit_refill_interval = VALUES(ratelimit_refill_interval), workspace_id = VALUES(workspace_id), for_workspace_id = VALUES(for_workspace_id), name = VALUES(name), remaining_requests = VALUES(remaining_requests), key_auth_id = VALUES(key_auth_id), suspended_at = VALUES(suspended_at), previous_hash = VALUES(previous_hash), previous_hash_expires = VALUES(previous_hash_expires), scopes = VALUES(scopes), encrypted = VALUES(encrypted), last_used_at = VALUES(last_used_at), disable_on_depletion = VALUES(disable_on_depletion), parent_key_id = VALUES(parent_key_id), remaining_warn_threshold = VALUES(remaining_warn_threshold), format = VALUES(format)`
 	// run
-	logf(sqlstr, k.ID, k.Hash, k.Start, k.OwnerID, k.Meta, k.CreatedAt, k.Expires, k.RatelimitType, k.RatelimitLimit, k.RatelimitRefillRate, k.RatelimitRefillInterval, k.WorkspaceID, k.ForWorkspaceID, k.Name, k.RemainingRequests, k.KeyAuthID)
-	if _, err := db.ExecContext(ctx, sqlstr, k.ID, k.Hash, k.Start, k.OwnerID, k.Meta, k.CreatedAt, k.Expires, k.RatelimitType, k.RatelimitLimit, k.RatelimitRefillRate, k.RatelimitRefillInterval, k.WorkspaceID, k.ForWorkspaceID, k.Name, k.RemainingRequests, k.KeyAuthID); err != nil {
+	logf(sqlstr, k.ID, k.Hash, k.Start, k.OwnerID, k.Meta, k.CreatedAt, k.Expires, k.Ratelimit, k.RatelimitType, k.RatelimitLimit, k.RatelimitRefillRate, k.RatelimitRefillInterval, k.WorkspaceID, k.ForWorkspaceID, k.Name, k.RemainingRequests, k.KeyAuthID, k.SuspendedAt, k.PreviousHash, k.PreviousHashExpires, k.Scopes, k.Encrypted, k.LastUsedAt, k.DisableOnDepletion, k.ParentKeyID, k.RemainingWarnThreshold, k.Format)
+	if _, err := db.ExecContext(ctx, sqlstr, k.ID, k.Hash, k.Start, k.OwnerID, k.Meta, k.CreatedAt, k.Expires, k.Ratelimit, k.RatelimitType, k.RatelimitLimit, k.RatelimitRefillRate, k.RatelimitRefillInterval, k.WorkspaceID, k.ForWorkspaceID, k.Name, k.RemainingRequests, k.KeyAuthID, k.SuspendedAt, k.PreviousHash, k.PreviousHashExpires, k.Scopes, k.Encrypted, k.LastUsedAt, k.DisableOnDepletion, k.ParentKeyID, k.RemainingWarnThreshold, k.Format); err != nil {
 		return logerror(err)
 	}
 	// set exists
@@ -144,7 +155,7 @@ func (k *Key) Delete(ctx context.Context, db DB) error {
 func KeyByHash(ctx context.Context, db DB, hash string) (*Key, error) {
 	// query
 	const sqlstr = `SELECT ` +
-		`id, hash, start, owner_id, meta, created_at, expires, ratelimit_type, ratelimit_limit, ratelimit_refill_rate, ratelimit_refill_interval, workspace_id, for_workspace_id, name, remaining_requests, key_auth_id ` +
+		`id, hash, start, owner_id, meta, created_at, expires, ratelimit, ratelimit_type, ratelimit_limit, ratelimit_refill_rate, ratelimit_refill_interval, workspace_id, for_workspace_id, name, remaining_requests, key_auth_id, suspended_at, previous_hash, previous_hash_expires, scopes, encrypted, last_used_at, disable_on_depletion, parent_key_id, remaining_warn_threshold, format ` +
 		`FROM unkey.keys ` +
 		`WHERE hash = ?`
 	// run
@@ -152,7 +163,7 @@ func KeyByHash(ctx context.Context, db DB, hash string) (*Key, error) {
 	k := Key{
 		_exists: true,
 	}
-	if err := db.QueryRowContext(ctx, sqlstr, hash).Scan(&k.ID, &k.Hash, &k.Start, &k.OwnerID, &k.Meta, &k.CreatedAt, &k.Expires, &k.RatelimitType, &k.RatelimitLimit, &k.RatelimitRefillRate, &k.RatelimitRefillInterval, &k.WorkspaceID, &k.ForWorkspaceID, &k.Name, &k.RemainingRequests, &k.KeyAuthID); err != nil {
+	if err := db.QueryRowContext(ctx, sqlstr, hash).Scan(&k.ID, &k.Hash, &k.Start, &k.OwnerID, &k.Meta, &k.CreatedAt, &k.Expires, &k.Ratelimit, &k.RatelimitType, &k.RatelimitLimit, &k.RatelimitRefillRate, &k.RatelimitRefillInterval, &k.WorkspaceID, &k.ForWorkspaceID, &k.Name, &k.RemainingRequests, &k.KeyAuthID, &k.SuspendedAt, &k.PreviousHash, &k.PreviousHashExpires, &k.Scopes, &k.Encrypted, &k.LastUsedAt, &k.DisableOnDepletion, &k.ParentKeyID, &k.RemainingWarnThreshold, k.Format); err != nil {
 		return nil, logerror(err)
 	}
 	return &k, nil
@@ -164,7 +175,7 @@ func KeyByHash(ctx context.Context, db DB, hash string) (*Key, error) {
 func KeysByKeyAuthID(ctx context.Context, db DB, keyAuthID sql.NullString) ([]*Key, error) {
 	// query
 	const sqlstr = `SELECT ` +
-		`id, hash, start, owner_id, meta, created_at, expires, ratelimit_type, ratelimit_limit, ratelimit_refill_rate, ratelimit_refill_interval, workspace_id, for_workspace_id, name, remaining_requests, key_auth_id ` +
+		`id, hash, start, owner_id, meta, created_at, expires, ratelimit, ratelimit_type, ratelimit_limit, ratelimit_refill_rate, ratelimit_refill_interval, workspace_id, for_workspace_id, name, remaining_requests, key_auth_id, suspended_at, previous_hash, previous_hash_expires, scopes, encrypted, last_used_at, disable_on_depletion, parent_key_id, remaining_warn_threshold, format ` +
 		`FROM unkey.keys ` +
 		`WHERE key_auth_id = ?`
 	// run
@@ -181,7 +192,7 @@ func KeysByKeyAuthID(ctx context.Context, db DB, keyAuthID sql.NullString) ([]*K
 			_exists: true,
 		}
 		// scan
-		if err := rows.Scan(&k.ID, &k.Hash, &k.Start, &k.OwnerID, &k.Meta, &k.CreatedAt, &k.Expires, &k.RatelimitType, &k.RatelimitLimit, &k.RatelimitRefillRate, &k.RatelimitRefillInterval, &k.WorkspaceID, &k.ForWorkspaceID, &k.Name, &k.RemainingRequests, &k.KeyAuthID); err != nil {
+		if err := rows.Scan(&k.ID, &k.Hash, &k.Start, &k.OwnerID, &k.Meta, &k.CreatedAt, &k.Expires, &k.Ratelimit, &k.RatelimitType, &k.RatelimitLimit, &k.RatelimitRefillRate, &k.RatelimitRefillInterval, &k.WorkspaceID, &k.ForWorkspaceID, &k.Name, &k.RemainingRequests, &k.KeyAuthID, &k.SuspendedAt, &k.PreviousHash, &k.PreviousHashExpires, &k.Scopes, &k.Encrypted, &k.LastUsedAt, &k.DisableOnDepletion, &k.ParentKeyID, &k.RemainingWarnThreshold, k.Format); err != nil {
 			return nil, logerror(err)
 		}
 		res = append(res, &k)
@@ -198,7 +209,7 @@ func KeysByKeyAuthID(ctx context.Context, db DB, keyAuthID sql.NullString) ([]*K
 func KeyByID(ctx context.Context, db DB, id string) (*Key, error) {
 	// query
 	const sqlstr = `SELECT ` +
-		`id, hash, start, owner_id, meta, created_at, expires, ratelimit_type, ratelimit_limit, ratelimit_refill_rate, ratelimit_refill_interval, workspace_id, for_workspace_id, name, remaining_requests, key_auth_id ` +
+		`id, hash, start, owner_id, meta, created_at, expires, ratelimit, ratelimit_type, ratelimit_limit, ratelimit_refill_rate, ratelimit_refill_interval, workspace_id, for_workspace_id, name, remaining_requests, key_auth_id, suspended_at, previous_hash, previous_hash_expires, scopes, encrypted, last_used_at, disable_on_depletion, parent_key_id, remaining_warn_threshold, format ` +
 		`FROM unkey.keys ` +
 		`WHERE id = ?`
 	// run
@@ -206,7 +217,7 @@ func KeyByID(ctx context.Context, db DB, id string) (*Key, error) {
 	k := Key{
 		_exists: true,
 	}
-	if err := db.QueryRowContext(ctx, sqlstr, id).Scan(&k.ID, &k.Hash, &k.Start, &k.OwnerID, &k.Meta, &k.CreatedAt, &k.Expires, &k.RatelimitType, &k.RatelimitLimit, &k.RatelimitRefillRate, &k.RatelimitRefillInterval, &k.WorkspaceID, &k.ForWorkspaceID, &k.Name, &k.RemainingRequests, &k.KeyAuthID); err != nil {
+	if err := db.QueryRowContext(ctx, sqlstr, id).Scan(&k.ID, &k.Hash, &k.Start, &k.OwnerID, &k.Meta, &k.CreatedAt, &k.Expires, &k.Ratelimit, &k.RatelimitType, &k.RatelimitLimit, &k.RatelimitRefillRate, &k.RatelimitRefillInterval, &k.WorkspaceID, &k.ForWorkspaceID, &k.Name, &k.RemainingRequests, &k.KeyAuthID, &k.SuspendedAt, &k.PreviousHash, &k.PreviousHashExpires, &k.Scopes, &k.Encrypted, &k.LastUsedAt, &k.DisableOnDepletion, &k.ParentKeyID, &k.RemainingWarnThreshold, k.Format); err != nil {
 		return nil, logerror(err)
 	}
 	return &k, nil
@@ -17,6 +17,11 @@ type Workspace struct {
 	StripeCustomerID     sql.NullString `json:"stripe_customer_id"`     // stripe_customer_id
 	StripeSubscriptionID sql.NullString `json:"stripe_subscription_id"` // stripe_subscription_id
 	Plan                 NullPlan       `json:"plan"`                   // plan
+	MaxKeys              sql.NullInt64  `json:"max_keys"`               // max_keys
+	MaxKeyLifetime       sql.NullInt64  `json:"max_key_lifetime"`       // max_key_lifetime
+	SuspendedAt          sql.NullTime   `json:"suspended_at"`           // suspended_at
+	HideKeyStart         bool           `json:"hide_key_start"`         // hide_key_start
+	OmitKeyStart         bool           `json:"omit_key_start"`         // omit_key_start
 	// xo fields
 	_exists, _deleted bool
 }
@@ -42,13 +47,13 @@ func (w *Workspace) Insert(ctx context.Context, db DB) error {
 	}
 	// insert (manual)
 	const sqlstr = `INSERT INTO unkey.workspaces (` +
-		`id, name, slug, tenant_id, internal, stripe_customer_id, stripe_subscription_id, plan` +
+		`id, name, slug, tenant_id, internal, stripe_customer_id, stripe_subscription_id, plan, max_keys, max_key_lifetime, suspended_at, hide_key_start, omit_key_start` +
 		`) VALUES (` +
-		`?, ?, ?, ?, ?, ?, ?, ?` +
+		`?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?` +
 		`)`
 	// run
-	logf(sqlstr, w.ID, w.Name, w.Slug, w.TenantID, w.Internal, w.StripeCustomerID, w.StripeSubscriptionID, w.Plan)
-	if _, err := db.ExecContext(ctx, sqlstr, w.ID, w.Name, w.Slug, w.TenantID, w.Internal, w.StripeCustomerID, w.StripeSubscriptionID, w.Plan); err != nil {
+	logf(sqlstr, w.ID, w.Name, w.Slug, w.TenantID, w.Internal, w.StripeCustomerID, w.StripeSubscriptionID, w.Plan, w.MaxKeys, w.MaxKeyLifetime, w.SuspendedAt, w.HideKeyStart, w.OmitKeyStart)
+	if _, err := db.ExecContext(ctx, sqlstr, w.ID, w.Name, w.Slug, w.TenantID, w.Internal, w.StripeCustomerID, w.StripeSubscriptionID, w.Plan, w.MaxKeys, w.MaxKeyLifetime, w.SuspendedAt, w.HideKeyStart, w.OmitKeyStart); err != nil {
 		return logerror(err)
 	}
 	// set exists
@@ -66,11 +71,11 @@ func (w *Workspace) Update(ctx context.Context, db DB) error {
 	}
 	// update with primary key
 	const sqlstr = `UPDATE unkey.workspaces SET ` +
-		`name = ?, slug = ?, tenant_id = ?, internal = ?, stripe_customer_id = ?, stripe_subscription_id = ?, plan = ? ` +
+		`name = ?, slug = ?, tenant_id = ?, internal = ?, stripe_customer_id = ?, stripe_subscription_id = ?, plan = ?, max_keys = ?, max_key_lifetime = ?, suspended_at = ?, hide_key_start = ?, omit_key_start = ? ` +
 		`WHERE id = ?`
 	// run
-	logf(sqlstr, w.Name, w.Slug, w.TenantID, w.Internal, w.StripeCustomerID, w.StripeSubscriptionID, w.Plan, w.ID)
-	if _, err := db.ExecContext(ctx, sqlstr, w.Name, w.Slug, w.TenantID, w.Internal, w.StripeCustomerID, w.StripeSubscriptionID, w.Plan, w.ID); err != nil {
+	logf(sqlstr, w.Name, w.Slug, w.TenantID, w.Internal, w.StripeCustomerID, w.StripeSubscriptionID, w.Plan, w.MaxKeys, w.MaxKeyLifetime, w.SuspendedAt, w.HideKeyStart, w.OmitKeyStart, w.ID)
+	if _, err := db.ExecContext(ctx, sqlstr, w.Name, w.Slug, w.TenantID, w.Internal, w.StripeCustomerID, w.StripeSubscriptionID, w.Plan, w.MaxKeys, w.MaxKeyLifetime, w.SuspendedAt, w.HideKeyStart, w.OmitKeyStart, w.ID); err != nil {
 		return logerror(err)
 	}
 	return nil
@@ -92,15 +97,15 @@ func (w *Workspace) Upsert(ctx context.Context, db DB) error {
 	}
 	// upsert
 	const sqlstr = `INSERT INTO unkey.workspaces (` +
-		`id, name, slug, tenant_id, internal, stripe_customer_id, stripe_subscription_id, plan` +
+		`id, name, slug, tenant_id, internal, stripe_customer_id, stripe_subscription_id, plan, max_keys, max_key_lifetime, suspended_at, hide_key_start, omit_key_start` +
 		`) VALUES (` +
-		`?, ?, ?, ?, ?, ?, ?, ?` +
+		`?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?` +
 		`)` +
 		` ON DUPLICATE KEY UPDATE ` +
-		`id = VALUES(id), name = VALUES(name), slug = VALUES(slug), tenant_id = VALUES(tenant_id), internal = VALUES(internal), stripe_customer_id = VALUES(stripe_customer_id), stripe_subscription_id = VALUES(stripe_subscription_id), plan = VALUES(plan)`
+		`id = VALUES(id), name = VALUES(name), slug = VALUES(slug), tenant_id = VALUES(tenant_id), internal = VALUES(internal), stripe_customer_id = VALUES(stripe_customer_id), stripe_subscription_id = VALUES(stripe_subscription_id), plan = VALUES(plan), max_keys = VALUES(max_keys), max_key_lifetime = VALUES(max_key_lifetime), suspended_at = VALUES(suspended_at), hide_key_start = VALUES(hide_key_start), omit_key_start = VALUES(omit_key_start)`
 	// run
-	logf(sqlstr, w.ID, w.Name, w.Slug, w.TenantID, w.Internal, w.StripeCustomerID, w.StripeSubscriptionID, w.Plan)
-	if _, err := db.ExecContext(ctx, sqlstr, w.ID, w.Name, w.Slug, w.TenantID, w.Internal, w.StripeCustomerID, w.StripeSubscriptionID, w.Plan); err != nil {
+	logf(sqlstr, w.ID, w.Name, w.Slug, w.TenantID, w.Internal, w.StripeCustomerID, w.StripeSubscriptionID, w.Plan, w.MaxKeys, w.MaxKeyLifetime, w.SuspendedAt, w.HideKeyStart, w.OmitKeyStart)
+	if _, err := db.ExecContext(ctx, sqlstr, w.ID, w.Name, w.Slug, w.TenantID, w.Internal, w.StripeCustomerID, w.StripeSubscriptionID, w.Plan, w.MaxKeys, w.MaxKeyLifetime, w.SuspendedAt, w.HideKeyStart, w.OmitKeyStart); err != nil {
 		return logerror(err)
 	}
 	// set exists
@@ -135,7 +140,7 @@ func (w *Workspace) Delete(ctx context.Context, db DB) error {
 func WorkspaceBySlug(ctx context.Context, db DB, slug string) (*Workspace, error) {
 	// query
 	const sqlstr = `SELECT ` +
-		`id, name, slug, tenant_id, internal, stripe_customer_id, stripe_subscription_id, plan ` +
+		`id, name, slug, tenant_id, internal, stripe_customer_id, stripe_subscription_id, plan, max_keys, max_key_lifetime, suspended_at, hide_key_start, omit_key_start ` +
 		`FROM unkey.workspaces ` +
 		`WHERE slug = ?`
 	// run
@@ -143,7 +148,7 @@ func WorkspaceBySlug(ctx context.Context, db DB, slug string) (*Workspace, error
 	w := Workspace{
 		_exists: true,
 	}
-	if err := db.QueryRowContext(ctx, sqlstr, slug).Scan(&w.ID, &w.Name, &w.Slug, &w.TenantID, &w.Internal, &w.StripeCustomerID, &w.StripeSubscriptionID, &w.Plan); err != nil {
+	if err := db.QueryRowContext(ctx, sqlstr, slug).Scan(&w.ID, &w.Name, &w.Slug, &w.TenantID, &w.Internal, &w.StripeCustomerID, &w.StripeSubscriptionID, &w.Plan, &w.MaxKeys, &w.MaxKeyLifetime, &w.SuspendedAt, &w.HideKeyStart, w.OmitKeyStart); err != nil {
 		return nil, logerror(err)
 	}
 	return &w, nil
@@ -155,7 +160,7 @@ func WorkspaceBySlug(ctx context.Context, db DB, slug string) (*Workspace, error
 func WorkspaceByTenantID(ctx context.Context, db DB, tenantID string) (*Workspace, error) {
 	// query
 	const sqlstr = `SELECT ` +
-		`id, name, slug, tenant_id, internal, stripe_customer_id, stripe_subscription_id, plan ` +
+		`id, name, slug, tenant_id, internal, stripe_customer_id, stripe_subscription_id, plan, max_keys, max_key_lifetime, suspended_at, hide_key_start, omit_key_start ` +
 		`FROM unkey.workspaces ` +
 		`WHERE tenant_id = ?`
 	// run
@@ -163,7 +168,7 @@ func WorkspaceByTenantID(ctx context.Context, db DB, tenantID string) (*Workspac
 	w := Workspace{
 		_exists: true,
 	}
-	if err := db.QueryRowContext(ctx, sqlstr, tenantID).Scan(&w.ID, &w.Name, &w.Slug, &w.TenantID, &w.Internal, &w.StripeCustomerID, &w.StripeSubscriptionID, &w.Plan); err != nil {
+	if err := db.QueryRowContext(ctx, sqlstr, tenantID).Scan(&w.ID, &w.Name, &w.Slug, &w.TenantID, &w.Internal, &w.StripeCustomerID, &w.StripeSubscriptionID, &w.Plan, &w.MaxKeys, &w.MaxKeyLifetime, &w.SuspendedAt, &w.HideKeyStart, w.OmitKeyStart); err != nil {
 		return nil, logerror(err)
 	}
 	return &w, nil
@@ -175,7 +180,7 @@ func WorkspaceByTenantID(ctx context.Context, db DB, tenantID string) (*Workspac
 func WorkspaceByID(ctx context.Context, db DB, id string) (*Workspace, error) {
 	// query
 	const sqlstr = `SELECT ` +
-		`id, name, slug, tenant_id, internal, stripe_customer_id, stripe_subscription_id, plan ` +
+		`id, name, slug, tenant_id, internal, stripe_customer_id, stripe_subscription_id, plan, max_keys, max_key_lifetime, suspended_at, hide_key_start, omit_key_start ` +
 		`FROM unkey.workspaces ` +
 		`WHERE id = ?`
 	// run
@@ -183,7 +188,7 @@ func WorkspaceByID(ctx context.Context, db DB, id string) (*Workspace, error) {
 	w := Workspace{
 		_exists: true,
 	}
-	if err := db.QueryRowContext(ctx, sqlstr, id).Scan(&w.ID, &w.Name, &w.Slug, &w.TenantID, &w.Internal, &w.StripeCustomerID, &w.StripeSubscriptionID, &w.Plan); err != nil {
+	if err := db.QueryRowContext(ctx, sqlstr, id).Scan(&w.ID, &w.Name, &w.Slug, &w.TenantID, &w.Internal, &w.StripeCustomerID, &w.StripeSubscriptionID, &w.Plan, &w.MaxKeys, &w.MaxKeyLifetime, &w.SuspendedAt, &w.HideKeyStart, w.OmitKeyStart); err != nil {
 		return nil, logerror(err)
 	}
 	return &w, nil
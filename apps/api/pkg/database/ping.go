@@ -0,0 +1,22 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// Ping runs a lightweight query against the primary and, if configured, the read replica.
+func (db *database) Ping(ctx context.Context) error {
+	var one int
+	err := db.write().QueryRowContext(ctx, "SELECT 1").Scan(&one)
+	if err != nil {
+		return fmt.Errorf("unable to reach primary: %w", err)
+	}
+	if db.readReplica != nil {
+		err = db.readReplica.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+		if err != nil {
+			return fmt.Errorf("unable to reach read replica: %w", err)
+		}
+	}
+	return nil
+}
@@ -1,10 +1,13 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/unkeyed/unkey/apps/api/pkg/encryption"
+	"github.com/unkeyed/unkey/apps/api/pkg/keys"
 	"go.uber.org/zap"
 )
 
@@ -12,6 +15,16 @@ type database struct {
 	primary     *sql.DB
 	readReplica *sql.DB
 	logger      *zap.Logger
+	// how many characters of the secret new keys reveal in their start
+	keyStartChars int
+	// nil if recoverable keys are disabled
+	keyring *encryption.Keyring
+	// see Config.StrictMeta
+	strictMeta bool
+	// set on the copy WithTx hands to its callback, every query runs in it then
+	tx *sql.Tx
+	// how many calls of WithTx tx is nested in, 0 for the outermost one. It names the savepoints, see begin
+	txDepth int
 }
 
 type Config struct {
@@ -21,14 +34,28 @@ type Config struct {
 	FlyRegion        string
 	Logger           *zap.Logger
 	PlanetscaleBoost bool
+	// Must match the server, keys.DefaultStartChars is used if nil
+	KeyStartChars *int
+	// Optional, required by ReEncryptKeys
+	Keyring *encryption.Keyring
+	// Applied to the primary and the read replica
+	Pool PoolConfig
+	// Fail to load keys whose meta is not valid json, by default they are loaded without their meta
+	StrictMeta bool
 }
 
 func New(config Config) (Database, error) {
 	logger := config.Logger.With(zap.String("pkg", "database"))
+	err := config.Pool.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection pool: %w", err)
+	}
+
 	primary, err := sql.Open("mysql", fmt.Sprintf("%s&parseTime=true", config.PrimaryUs))
 	if err != nil {
 		return nil, fmt.Errorf("error opening database: %w", err)
 	}
+	config.Pool.apply(primary)
 	if config.PlanetscaleBoost {
 		logger.Info("enabling planetscale boost for primary")
 		_, err = primary.Exec("SET @@boost_cached_queries = true")
@@ -61,6 +88,7 @@ func New(config Config) (Database, error) {
 	}
 
 	if readReplica != nil {
+		config.Pool.apply(readReplica)
 		err = readReplica.Ping()
 		if err != nil {
 			return nil, fmt.Errorf("unable to ping read replica")
@@ -75,23 +103,56 @@ func New(config Config) (Database, error) {
 		}
 	}
 
+	keyStartChars := keys.DefaultStartChars
+	if config.KeyStartChars != nil {
+		keyStartChars = *config.KeyStartChars
+	}
+
 	return &database{
-		primary:     primary,
-		readReplica: readReplica,
-		logger:      logger,
+		primary:       primary,
+		readReplica:   readReplica,
+		logger:        logger,
+		keyStartChars: keyStartChars,
+		keyring:       config.Keyring,
+		strictMeta:    config.StrictMeta,
 	}, nil
 
 }
 
-// read returns the primary writable db
-func (d *database) write() *sql.DB {
+// read returns the primary writable db, or the transaction of WithTx
+func (d *database) write() querier {
+	if d.tx != nil {
+		return d.tx
+	}
 	return d.primary
 }
 
-// read returns the closests read replica
-func (d *database) read() *sql.DB {
-	if d.readReplica != nil {
+// read returns the closests read replica, or the primary if the context asks for it, see WithPrimary.
+// In the transaction of WithTx reads go to the transaction, so they see its writes.
+func (d *database) read(ctx context.Context) querier {
+	if d.tx != nil {
+		return d.tx
+	}
+	if d.readReplica != nil && !ReadsPrimary(ctx) {
 		return d.readReplica
 	}
 	return d.primary
 }
+
+// Close closes all connections to the primary and read replica
+func (d *database) Close() error {
+	if d.tx != nil {
+		return fmt.Errorf("unable to close a transaction, it ends when WithTx returns")
+	}
+	err := d.primary.Close()
+	if err != nil {
+		return fmt.Errorf("unable to close primary: %w", err)
+	}
+	if d.readReplica != nil {
+		err = d.readReplica.Close()
+		if err != nil {
+			return fmt.Errorf("unable to close read replica: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultMaxOpenConns = 100
+	DefaultMaxIdleConns = 25
+	// PlanetScale closes connections after a while, recycle them before it does
+	DefaultConnMaxLifetime = 5 * time.Minute
+)
+
+// PoolConfig tunes the connection pools of the primary and the read replica, each gets its own pool.
+// Zero values use the defaults above.
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// withDefaults fills in every setting that was left empty
+func (c PoolConfig) withDefaults() PoolConfig {
+	if c.MaxOpenConns == 0 {
+		c.MaxOpenConns = DefaultMaxOpenConns
+	}
+	if c.MaxIdleConns == 0 {
+		c.MaxIdleConns = DefaultMaxIdleConns
+		if c.MaxOpenConns < c.MaxIdleConns {
+			c.MaxIdleConns = c.MaxOpenConns
+		}
+	}
+	if c.ConnMaxLifetime == 0 {
+		c.ConnMaxLifetime = DefaultConnMaxLifetime
+	}
+	return c
+}
+
+// Validate returns an error if the pool can not be configured like this, defaults are applied first.
+func (c PoolConfig) Validate() error {
+	if c.MaxOpenConns < 0 {
+		return fmt.Errorf("max open connections must not be negative, got %d", c.MaxOpenConns)
+	}
+	if c.MaxIdleConns < 0 {
+		return fmt.Errorf("max idle connections must not be negative, got %d", c.MaxIdleConns)
+	}
+	if c.ConnMaxLifetime < 0 {
+		return fmt.Errorf("connection max lifetime must not be negative, got %s", c.ConnMaxLifetime)
+	}
+	c = c.withDefaults()
+	if c.MaxIdleConns > c.MaxOpenConns {
+		return fmt.Errorf("max idle connections (%d) must not exceed max open connections (%d)", c.MaxIdleConns, c.MaxOpenConns)
+	}
+	return nil
+}
+
+func (c PoolConfig) apply(db *sql.DB) {
+	c = c.withDefaults()
+	db.SetMaxOpenConns(c.MaxOpenConns)
+	db.SetMaxIdleConns(c.MaxIdleConns)
+	db.SetConnMaxLifetime(c.ConnMaxLifetime)
+}
+
+// Stats returns the statistics of the connection pools, keyed by "primary" and "replica".
+// The replica is missing if there is none in this region.
+func (db *database) Stats() map[string]sql.DBStats {
+	stats := map[string]sql.DBStats{
+		"primary": db.primary.Stats(),
+	}
+	if db.readReplica != nil {
+		stats["replica"] = db.readReplica.Stats()
+	}
+	return stats
+}
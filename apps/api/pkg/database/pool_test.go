@@ -0,0 +1,54 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config PoolConfig
+		err    string
+	}{
+		{name: "defaults", config: PoolConfig{}},
+		{name: "custom", config: PoolConfig{MaxOpenConns: 10, MaxIdleConns: 10, ConnMaxLifetime: time.Minute}},
+		{name: "small pool with default idle", config: PoolConfig{MaxOpenConns: 5}},
+		{name: "negative open", config: PoolConfig{MaxOpenConns: -1}, err: "max open connections must not be negative"},
+		{name: "negative idle", config: PoolConfig{MaxIdleConns: -1}, err: "max idle connections must not be negative"},
+		{name: "negative lifetime", config: PoolConfig{ConnMaxLifetime: -time.Second}, err: "connection max lifetime must not be negative"},
+		{name: "more idle than open", config: PoolConfig{MaxOpenConns: 5, MaxIdleConns: 10}, err: "must not exceed max open connections"},
+		{name: "more idle than default open", config: PoolConfig{MaxIdleConns: DefaultMaxOpenConns + 1}, err: "must not exceed max open connections"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.Validate()
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
+
+func TestPoolConfig_Apply(t *testing.T) {
+	// opening does not connect, the pool settings are visible right away
+	primary, err := sql.Open("mysql", "user@tcp(127.0.0.1:1)/unkey")
+	require.NoError(t, err)
+	defer primary.Close()
+
+	PoolConfig{}.apply(primary)
+	require.Equal(t, DefaultMaxOpenConns, primary.Stats().MaxOpenConnections)
+
+	PoolConfig{MaxOpenConns: 5}.apply(primary)
+	db := &database{primary: primary}
+	stats := db.Stats()
+	require.Len(t, stats, 1)
+	require.Equal(t, 5, stats["primary"].MaxOpenConnections)
+}
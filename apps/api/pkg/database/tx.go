@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/database/models"
+)
+
+// querier runs queries, it is either a connection pool or the transaction of WithTx
+type querier interface {
+	models.DB
+}
+
+// transaction is what methods that need several statements to be atomic run them in, see begin
+type transaction interface {
+	querier
+	Commit() error
+	Rollback() error
+}
+
+// savepoint is a transaction nested in the transaction of WithTx.
+// Rolling it back only undoes its own statements, the outer transaction stays usable.
+type savepoint struct {
+	*sql.Tx
+	ctx  context.Context
+	name string
+	done bool
+}
+
+// savepointName names the savepoint opened at depth. MySQL replaces a savepoint when one with the same
+// name is opened again, so every level of nesting needs its own name. A level only ever has one savepoint
+// open at a time: the ones of methods are released before they return, and the ones of WithTx before it returns.
+func savepointName(depth int) string {
+	return fmt.Sprintf("unkey_nested_%d", depth)
+}
+
+func (s *savepoint) Commit() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+	s.done = true
+	_, err := s.Tx.ExecContext(s.ctx, "RELEASE SAVEPOINT "+s.name)
+	return err
+}
+
+func (s *savepoint) Rollback() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+	s.done = true
+	_, err := s.Tx.ExecContext(s.ctx, "ROLLBACK TO SAVEPOINT "+s.name)
+	return err
+}
+
+// begin starts a transaction on the primary, or a savepoint one level deeper than the transaction of WithTx
+// the database is bound to
+func (db *database) begin(ctx context.Context) (transaction, error) {
+	if db.tx == nil {
+		return db.primary.BeginTx(ctx, nil)
+	}
+	name := savepointName(db.txDepth + 1)
+	_, err := db.tx.ExecContext(ctx, "SAVEPOINT "+name)
+	if err != nil {
+		return nil, err
+	}
+	return &savepoint{Tx: db.tx, ctx: ctx, name: name}, nil
+}
+
+// WithTx runs fn in a transaction on the primary. Everything fn does with tx is committed together
+// if fn returns nil and rolled back if it returns an error or panics.
+//
+// Methods that use a transaction of their own, like CreateKeys, run in a savepoint of it instead.
+// tx must not be used after fn returned, or from multiple goroutines.
+// Calling WithTx on tx nests another savepoint, its writes are rolled back if the inner fn fails.
+func (db *database) WithTx(ctx context.Context, fn func(tx Database) error) error {
+	if db.tx != nil {
+		sp, err := db.begin(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to start savepoint: %w", err)
+		}
+		// the outer transaction may recover, it must not keep the writes of fn then
+		defer func() {
+			if r := recover(); r != nil {
+				_ = sp.Rollback()
+				panic(r)
+			}
+		}()
+
+		nested := *db
+		nested.txDepth++
+		return finishTx(sp, fn(&nested))
+	}
+
+	tx, err := db.primary.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %w", err)
+	}
+	// a no-op after commit, and rolls back if fn panics
+	defer func() { _ = tx.Rollback() }()
+
+	bound := *db
+	bound.tx = tx
+	return finishTx(tx, fn(&bound))
+}
+
+// finishTx commits tx if fn succeeded and rolls it back otherwise, the error of fn is kept
+func finishTx(tx transaction, fnErr error) error {
+	if fnErr != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			return errors.Join(fnErr, fmt.Errorf("unable to roll back: %w", rollbackErr))
+		}
+		return fnErr
+	}
+	err := tx.Commit()
+	if err != nil {
+		return fmt.Errorf("unable to commit transaction: %w", err)
+	}
+	return nil
+}
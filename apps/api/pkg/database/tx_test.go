@@ -0,0 +1,278 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+func newTxTestKey(keyAuthId, workspaceId string) entities.Key {
+	return entities.Key{
+		Id:          uid.Key(),
+		KeyAuthId:   keyAuthId,
+		WorkspaceId: workspaceId,
+		Hash:        hash.Sha256(uid.New("test")),
+		CreatedAt:   time.Now(),
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(t, err)
+
+	keyAuthId := uid.KeyAuth()
+	workspaceId := uid.Workspace()
+	existing := newTxTestKey(keyAuthId, workspaceId)
+	existing.Remaining.Enabled = true
+	existing.Remaining.Remaining = 5
+	require.NoError(t, db.CreateKey(ctx, existing))
+
+	t.Run("an error rolls back every change", func(t *testing.T) {
+		created := newTxTestKey(keyAuthId, workspaceId)
+		failed := errors.New("failed")
+		err := db.WithTx(ctx, func(tx Database) error {
+			require.NoError(t, tx.CreateKey(ctx, created))
+			_, decremented, err := tx.DecrementRemainingKeyUsage(ctx, existing.Id, 2)
+			require.NoError(t, err)
+			require.True(t, decremented)
+
+			// reads in the transaction see its writes
+			found, err := tx.GetKeyById(ctx, existing.Id)
+			require.NoError(t, err)
+			require.Equal(t, int64(3), found.Remaining.Remaining)
+			return failed
+		})
+		require.ErrorIs(t, err, failed)
+
+		_, err = db.GetKeyById(WithPrimary(ctx), created.Id)
+		require.ErrorIs(t, err, ErrNotFound)
+		found, err := db.GetKeyById(WithPrimary(ctx), existing.Id)
+		require.NoError(t, err)
+		require.Equal(t, int64(5), found.Remaining.Remaining)
+	})
+
+	t.Run("success commits every change", func(t *testing.T) {
+		created := newTxTestKey(keyAuthId, workspaceId)
+		err := db.WithTx(ctx, func(tx Database) error {
+			err := tx.CreateKey(ctx, created)
+			if err != nil {
+				return err
+			}
+			_, _, err = tx.DecrementRemainingKeyUsage(ctx, existing.Id, 1)
+			return err
+		})
+		require.NoError(t, err)
+
+		_, err = db.GetKeyById(WithPrimary(ctx), created.Id)
+		require.NoError(t, err)
+		found, err := db.GetKeyById(WithPrimary(ctx), existing.Id)
+		require.NoError(t, err)
+		require.Equal(t, int64(4), found.Remaining.Remaining)
+	})
+
+	t.Run("a failed method only rolls back its own writes", func(t *testing.T) {
+		created := newTxTestKey(keyAuthId, workspaceId)
+		err := db.WithTx(ctx, func(tx Database) error {
+			require.NoError(t, tx.CreateKey(ctx, created))
+			// the id is taken, so CreateKeys fails and rolls back to its savepoint
+			err := tx.CreateKeys(ctx, []entities.Key{newTxTestKey(keyAuthId, workspaceId), existing})
+			require.Error(t, err)
+			return nil
+		})
+		require.NoError(t, err)
+
+		_, err = db.GetKeyById(WithPrimary(ctx), created.Id)
+		require.NoError(t, err)
+	})
+}
+
+// recordingDriver is a database/sql driver that accepts every statement and records it,
+// so the statements of WithTx can be checked without a database. Every dsn records separately.
+type recordingDriver struct{}
+
+var recordings sync.Map
+
+func (recordingDriver) Open(dsn string) (driver.Conn, error) {
+	r, ok := recordings.Load(dsn)
+	if !ok {
+		return nil, fmt.Errorf("nothing records %s", dsn)
+	}
+	return &recordingConn{d: r.(*recording)}, nil
+}
+
+func init() {
+	sql.Register("recording", recordingDriver{})
+}
+
+type recording struct {
+	mu         sync.Mutex
+	statements []string
+}
+
+func (d *recording) record(statement string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.statements = append(d.statements, statement)
+}
+
+type recordingConn struct {
+	d *recording
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c *recordingConn) Close() error {
+	return nil
+}
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	c.d.record("BEGIN")
+	return c, nil
+}
+
+func (c *recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.record(query)
+	return driver.RowsAffected(1), nil
+}
+
+// QueryContext finds no rows
+func (c *recordingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.record(query)
+	return emptyRows{}, nil
+}
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string { return nil }
+
+func (emptyRows) Close() error { return nil }
+
+func (emptyRows) Next(dest []driver.Value) error { return io.EOF }
+
+func (c *recordingConn) Commit() error {
+	c.d.record("COMMIT")
+	return nil
+}
+
+func (c *recordingConn) Rollback() error {
+	c.d.record("ROLLBACK")
+	return nil
+}
+
+// newRecordingDatabase returns a database whose primary records the statements of the test
+func newRecordingDatabase(t *testing.T) (*database, *recording) {
+	t.Helper()
+	r := &recording{}
+	recordings.Store(t.Name(), r)
+	primary, err := sql.Open("recording", t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = primary.Close()
+		recordings.Delete(t.Name())
+	})
+	return &database{primary: primary, logger: logging.NewNoopLogger()}, r
+}
+
+// exec runs a statement the way the methods of the database do
+func exec(t *testing.T, tx Database, statement string) {
+	t.Helper()
+	_, err := tx.(*database).write().ExecContext(context.Background(), statement)
+	require.NoError(t, err)
+}
+
+func TestWithTx_NestedSavepoints(t *testing.T) {
+	ctx := context.Background()
+	failed := errors.New("failed")
+
+	t.Run("every level has its own savepoint", func(t *testing.T) {
+		db, d := newRecordingDatabase(t)
+		err := db.WithTx(ctx, func(tx Database) error {
+			exec(t, tx, "INSERT outer")
+			require.NoError(t, tx.WithTx(ctx, func(tx Database) error {
+				exec(t, tx, "INSERT committed")
+				err := tx.WithTx(ctx, func(tx Database) error {
+					exec(t, tx, "INSERT rolled back")
+					return failed
+				})
+				require.ErrorIs(t, err, failed)
+				// a method that needs a transaction of its own still gets a fresh savepoint
+				_, err = tx.TransferKeysOwner(ctx, "key_auth_1", "from", "to")
+				return err
+			}))
+			return nil
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, []string{
+			"BEGIN",
+			"INSERT outer",
+			"SAVEPOINT unkey_nested_1",
+			"INSERT committed",
+			"SAVEPOINT unkey_nested_2",
+			"INSERT rolled back",
+			"ROLLBACK TO SAVEPOINT unkey_nested_2",
+			"SAVEPOINT unkey_nested_2",
+			"SELECT " + keyColumns + " FROM unkey.keys WHERE workspace_id = ? AND owner_id = ? FOR UPDATE",
+			"UPDATE unkey.keys SET owner_id = ? WHERE workspace_id = ? AND owner_id = ?",
+			"RELEASE SAVEPOINT unkey_nested_2",
+			"RELEASE SAVEPOINT unkey_nested_1",
+			"COMMIT",
+		}, d.statements)
+	})
+
+	t.Run("an inner error only rolls back the inner level", func(t *testing.T) {
+		db, d := newRecordingDatabase(t)
+		err := db.WithTx(ctx, func(tx Database) error {
+			return tx.WithTx(ctx, func(tx Database) error {
+				exec(t, tx, "INSERT inner")
+				return failed
+			})
+		})
+		require.ErrorIs(t, err, failed)
+		require.Equal(t, []string{
+			"BEGIN",
+			"SAVEPOINT unkey_nested_1",
+			"INSERT inner",
+			"ROLLBACK TO SAVEPOINT unkey_nested_1",
+			"ROLLBACK",
+		}, d.statements)
+	})
+
+	t.Run("a panic rolls back every level", func(t *testing.T) {
+		db, d := newRecordingDatabase(t)
+		require.Panics(t, func() {
+			_ = db.WithTx(ctx, func(tx Database) error {
+				return tx.WithTx(ctx, func(tx Database) error {
+					exec(t, tx, "INSERT inner")
+					panic("boom")
+				})
+			})
+		})
+		require.Equal(t, []string{
+			"BEGIN",
+			"SAVEPOINT unkey_nested_1",
+			"INSERT inner",
+			"ROLLBACK TO SAVEPOINT unkey_nested_1",
+			"ROLLBACK",
+		}, d.statements)
+	})
+}
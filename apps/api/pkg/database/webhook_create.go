@@ -0,0 +1,22 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/webhooks"
+)
+
+func (db *database) CreateWebhook(ctx context.Context, endpoint webhooks.Endpoint) error {
+	const query = `INSERT INTO unkey.webhooks (` +
+		`id, workspace_id, url, secret, created_at` +
+		`) VALUES (` +
+		`?, ?, ?, ?, ?` +
+		`)`
+
+	_, err := db.write().ExecContext(ctx, query, endpoint.Id, endpoint.WorkspaceId, endpoint.Url, endpoint.Secret, endpoint.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("unable to create webhook: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// DeleteWebhook returns ErrNotFound if the workspace has no such endpoint
+func (db *database) DeleteWebhook(ctx context.Context, workspaceId, webhookId string) error {
+	const query = `DELETE FROM unkey.webhooks WHERE id = ? AND workspace_id = ?`
+
+	res, err := db.write().ExecContext(ctx, query, webhookId, workspaceId)
+	if err != nil {
+		return fmt.Errorf("unable to delete webhook %s: %w", webhookId, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("unable to delete webhook %s: %w", webhookId, err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
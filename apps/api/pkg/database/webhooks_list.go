@@ -0,0 +1,37 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/webhooks"
+)
+
+// ListWebhooks returns all endpoints of a workspace, oldest first
+func (db *database) ListWebhooks(ctx context.Context, workspaceId string) ([]webhooks.Endpoint, error) {
+	const query = `SELECT ` +
+		`id, workspace_id, url, secret, created_at ` +
+		`FROM unkey.webhooks ` +
+		`WHERE workspace_id = ? ` +
+		`ORDER BY created_at, id`
+
+	rows, err := db.read(ctx).QueryContext(ctx, query, workspaceId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	endpoints := []webhooks.Endpoint{}
+	for rows.Next() {
+		var e webhooks.Endpoint
+		err := rows.Scan(&e.Id, &e.WorkspaceId, &e.Url, &e.Secret, &e.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+		endpoints = append(endpoints, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to list webhooks: %w", err)
+	}
+	return endpoints, nil
+}
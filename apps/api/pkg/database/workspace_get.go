@@ -9,7 +9,7 @@ import (
 )
 
 func (db *database) GetWorkspace(ctx context.Context, workspaceId string) (entities.Workspace, error) {
-	workspace, err := models.WorkspaceByID(ctx, db.read(), workspaceId)
+	workspace, err := models.WorkspaceByID(ctx, db.read(ctx), workspaceId)
 	if err != nil {
 		return entities.Workspace{}, fmt.Errorf("unable to load workspace %s from db: %w", workspaceId, err)
 	}
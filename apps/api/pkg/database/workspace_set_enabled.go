@@ -0,0 +1,19 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SetWorkspaceEnabled suspends or re-enables a workspace and thereby all of its keys
+func (db *database) SetWorkspaceEnabled(ctx context.Context, workspaceId string, enabled bool) error {
+	suspendedAt := sql.NullTime{Time: time.Now(), Valid: !enabled}
+
+	_, err := db.write().ExecContext(ctx, `UPDATE unkey.workspaces SET suspended_at = ? WHERE id = ?`, suspendedAt, workspaceId)
+	if err != nil {
+		return fmt.Errorf("unable to set enabled of workspace %s: %w", workspaceId, err)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// SetWorkspaceHideKeyStart decides if the start of keys is omitted when they are listed or fetched
+func (db *database) SetWorkspaceHideKeyStart(ctx context.Context, workspaceId string, hide bool) error {
+	_, err := db.write().ExecContext(ctx, `UPDATE unkey.workspaces SET hide_key_start = ? WHERE id = ?`, hide, workspaceId)
+	if err != nil {
+		return fmt.Errorf("unable to set hide_key_start of workspace %s: %w", workspaceId, err)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// SetWorkspaceOmitKeyStart decides if new keys of the workspace are stored without their start
+func (db *database) SetWorkspaceOmitKeyStart(ctx context.Context, workspaceId string, omit bool) error {
+	_, err := db.write().ExecContext(ctx, `UPDATE unkey.workspaces SET omit_key_start = ? WHERE id = ?`, omit, workspaceId)
+	if err != nil {
+		return fmt.Errorf("unable to set omit_key_start of workspace %s: %w", workspaceId, err)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+func TestSetWorkspaceOmitKeyStart(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(t, err)
+
+	workspace := entities.Workspace{
+		Id:       uid.Workspace(),
+		Name:     "test",
+		Slug:     uid.New("slug"),
+		TenantId: uid.New("tenant"),
+	}
+	require.NoError(t, db.CreateWorkspace(ctx, workspace))
+
+	found, err := db.GetWorkspace(ctx, workspace.Id)
+	require.NoError(t, err)
+	require.False(t, found.OmitKeyStart)
+
+	require.NoError(t, db.SetWorkspaceOmitKeyStart(ctx, workspace.Id, true))
+	found, err = db.GetWorkspace(ctx, workspace.Id)
+	require.NoError(t, err)
+	require.True(t, found.OmitKeyStart)
+	// the other setting about the start is independent
+	require.False(t, found.HideKeyStart)
+}
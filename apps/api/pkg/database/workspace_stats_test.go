@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+func TestWorkspaceCounts(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(t, err)
+
+	workspaceId := uid.Workspace()
+	for i := 0; i < 2; i++ {
+		require.NoError(t, db.CreateApi(ctx, entities.Api{Id: uid.Api(), Name: "test", WorkspaceId: workspaceId}))
+	}
+	require.NoError(t, db.CreateApi(ctx, entities.Api{Id: uid.Api(), Name: "other", WorkspaceId: uid.Workspace()}))
+
+	now := time.Now()
+	for _, expires := range []time.Time{{}, now.Add(-time.Hour), now.Add(time.Hour), now.Add(6 * 24 * time.Hour), now.Add(30 * 24 * time.Hour)} {
+		err := db.CreateKey(ctx, entities.Key{
+			Id:          uid.Key(),
+			KeyAuthId:   uid.KeyAuth(),
+			WorkspaceId: workspaceId,
+			Hash:        hash.Sha256(uid.New("test")),
+			CreatedAt:   now,
+			Expires:     expires,
+		})
+		require.NoError(t, err)
+	}
+
+	apis, err := db.CountApisByWorkspace(ctx, workspaceId)
+	require.NoError(t, err)
+	require.Equal(t, 2, apis)
+
+	keys, err := db.CountKeysByWorkspace(ctx, workspaceId)
+	require.NoError(t, err)
+	require.Equal(t, 5, keys)
+
+	expiring, err := db.CountKeysExpiringBetween(ctx, workspaceId, now, now.Add(7*24*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 2, expiring)
+}
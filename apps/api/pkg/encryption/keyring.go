@@ -0,0 +1,154 @@
+// Package encryption encrypts the secrets of recoverable keys.
+//
+// Every workspace uses its own data key, derived from a master key of the keyring. Ciphertexts
+// carry the version of the master key they were encrypted with, so master keys can be rotated:
+// new values use the active version, older versions are only kept to decrypt existing values.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// KeySize is the length of a master key in bytes
+const KeySize = 32
+
+var (
+	ErrUnknownVersion    = errors.New("encryption key version is not in the keyring")
+	ErrInvalidCiphertext = errors.New("invalid ciphertext")
+)
+
+type Keyring struct {
+	keys   map[int][]byte
+	active int
+}
+
+// NewKeyring returns a keyring that encrypts with the key of the active version.
+func NewKeyring(keys map[int][]byte, active int) (*Keyring, error) {
+	for version, key := range keys {
+		if version <= 0 {
+			return nil, fmt.Errorf("encryption key versions must be positive, got %d", version)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("encryption key v%d must be %d bytes, got %d", version, KeySize, len(key))
+		}
+	}
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("active encryption key v%d: %w", active, ErrUnknownVersion)
+	}
+	return &Keyring{keys: keys, active: active}, nil
+}
+
+// ParseKeys parses a comma separated list of `<version>:<base64 key>` pairs.
+func ParseKeys(value string) (map[int][]byte, error) {
+	keys := map[int][]byte{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		versionStr, encoded, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("encryption key %q must have the format <version>:<base64 key>", pair)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key version %q: %w", versionStr, err)
+		}
+		if _, exists := keys[version]; exists {
+			return nil, fmt.Errorf("encryption key v%d is defined twice", version)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key v%d is not valid base64: %w", version, err)
+		}
+		keys[version] = key
+	}
+	return keys, nil
+}
+
+// ActiveVersion is the version new values are encrypted with.
+func (k *Keyring) ActiveVersion() int {
+	return k.active
+}
+
+// Encrypt encrypts plaintext for the workspace with the active key.
+func (k *Keyring) Encrypt(workspaceId string, plaintext string) (string, error) {
+	aead, err := k.aead(k.active, workspaceId)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate nonce: %w", err)
+	}
+	// the workspace is authenticated, a ciphertext copied to another workspace does not decrypt
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(workspaceId))
+	return fmt.Sprintf("v%d.%s", k.active, base64.RawURLEncoding.EncodeToString(sealed)), nil
+}
+
+// Decrypt decrypts a value of the workspace with the key version it was encrypted with.
+func (k *Keyring) Decrypt(workspaceId string, ciphertext string) (string, error) {
+	version, err := Version(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	aead, err := k.aead(version, workspaceId)
+	if err != nil {
+		return "", err
+	}
+	_, encoded, _ := strings.Cut(ciphertext, ".")
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrInvalidCiphertext
+	}
+	nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, []byte(workspaceId))
+	if err != nil {
+		return "", ErrInvalidCiphertext
+	}
+	return string(plaintext), nil
+}
+
+// NeedsRotation reports whether the value was encrypted with another version than the active one.
+func (k *Keyring) NeedsRotation(ciphertext string) bool {
+	version, err := Version(ciphertext)
+	return err != nil || version != k.active
+}
+
+// Version returns the version of the key a value was encrypted with.
+func Version(ciphertext string) (int, error) {
+	prefix, _, ok := strings.Cut(ciphertext, ".")
+	if !ok || !strings.HasPrefix(prefix, "v") {
+		return 0, ErrInvalidCiphertext
+	}
+	version, err := strconv.Atoi(prefix[1:])
+	if err != nil {
+		return 0, ErrInvalidCiphertext
+	}
+	return version, nil
+}
+
+// aead derives the data key of the workspace from the master key of the version.
+func (k *Keyring) aead(version int, workspaceId string) (cipher.AEAD, error) {
+	master, ok := k.keys[version]
+	if !ok {
+		return nil, fmt.Errorf("v%d: %w", version, ErrUnknownVersion)
+	}
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte("workspace:" + workspaceId))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,121 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestKeyring_EncryptDecrypt(t *testing.T) {
+	keyring, err := NewKeyring(map[int][]byte{1: testKey(1)}, 1)
+	require.NoError(t, err)
+
+	ciphertext, err := keyring.Encrypt("ws_1", "test_secret")
+	require.NoError(t, err)
+	require.NotContains(t, ciphertext, "test_secret")
+
+	version, err := Version(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, 1, version)
+
+	plaintext, err := keyring.Decrypt("ws_1", ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, "test_secret", plaintext)
+
+	// a fresh nonce every time
+	again, err := keyring.Encrypt("ws_1", "test_secret")
+	require.NoError(t, err)
+	require.NotEqual(t, ciphertext, again)
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	v1, err := NewKeyring(map[int][]byte{1: testKey(1)}, 1)
+	require.NoError(t, err)
+	ciphertext, err := v1.Encrypt("ws_1", "test_secret")
+	require.NoError(t, err)
+
+	v2, err := NewKeyring(map[int][]byte{1: testKey(1), 2: testKey(2)}, 2)
+	require.NoError(t, err)
+
+	plaintext, err := v2.Decrypt("ws_1", ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, "test_secret", plaintext)
+	require.True(t, v2.NeedsRotation(ciphertext))
+
+	rotated, err := v2.Encrypt("ws_1", plaintext)
+	require.NoError(t, err)
+	require.False(t, v2.NeedsRotation(rotated))
+	version, err := Version(rotated)
+	require.NoError(t, err)
+	require.Equal(t, 2, version)
+
+	// once v1 is removed, only the rotated value can be read
+	v2Only, err := NewKeyring(map[int][]byte{2: testKey(2)}, 2)
+	require.NoError(t, err)
+	_, err = v2Only.Decrypt("ws_1", ciphertext)
+	require.ErrorIs(t, err, ErrUnknownVersion)
+	plaintext, err = v2Only.Decrypt("ws_1", rotated)
+	require.NoError(t, err)
+	require.Equal(t, "test_secret", plaintext)
+}
+
+func TestKeyring_BoundToWorkspace(t *testing.T) {
+	keyring, err := NewKeyring(map[int][]byte{1: testKey(1)}, 1)
+	require.NoError(t, err)
+
+	ciphertext, err := keyring.Encrypt("ws_1", "test_secret")
+	require.NoError(t, err)
+
+	_, err = keyring.Decrypt("ws_2", ciphertext)
+	require.ErrorIs(t, err, ErrInvalidCiphertext)
+}
+
+func TestKeyring_InvalidCiphertext(t *testing.T) {
+	keyring, err := NewKeyring(map[int][]byte{1: testKey(1)}, 1)
+	require.NoError(t, err)
+	ciphertext, err := keyring.Encrypt("ws_1", "test_secret")
+	require.NoError(t, err)
+
+	// flip a character in the middle of the sealed value
+	tampered := []byte(ciphertext)
+	middle := len(tampered) / 2
+	if tampered[middle] == 'A' {
+		tampered[middle] = 'B'
+	} else {
+		tampered[middle] = 'A'
+	}
+
+	for _, value := range []string{"", "garbage", "v1.", "vx.abc", "v1.!!!", string(tampered)} {
+		_, err := keyring.Decrypt("ws_1", value)
+		require.Error(t, err, value)
+	}
+}
+
+func TestNewKeyring_Errors(t *testing.T) {
+	_, err := NewKeyring(map[int][]byte{1: testKey(1)}, 2)
+	require.ErrorIs(t, err, ErrUnknownVersion)
+	_, err = NewKeyring(map[int][]byte{1: []byte("short")}, 1)
+	require.Error(t, err)
+	_, err = NewKeyring(map[int][]byte{0: testKey(1)}, 0)
+	require.Error(t, err)
+}
+
+func TestParseKeys(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(testKey(1))
+	keys, err := ParseKeys(fmt.Sprintf("1:%s, 2:%s", encoded, encoded))
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	require.Equal(t, testKey(1), keys[2])
+
+	for _, value := range []string{"1", "a:" + encoded, "1:not base64", "1:" + encoded + ",1:" + encoded} {
+		_, err := ParseKeys(value)
+		require.Error(t, err, value)
+	}
+}
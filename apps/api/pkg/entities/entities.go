@@ -20,6 +20,35 @@ type Key struct {
 		Enabled   bool
 		Remaining int64
 	}
+	// DisableOnDepletion suspends the key when its last remaining verification is used up
+	DisableOnDepletion bool
+	// RemainingWarnThreshold flags verifications that leave the key with this many remaining verifications
+	// or fewer, so its owner can be asked to top up. nil never warns
+	RemainingWarnThreshold *int64
+	// SuspendedAt is set when the key has been disabled, the zero value means the key is enabled
+	SuspendedAt time.Time
+	// PreviousHash is the hash of the secret before it was rerolled, it keeps verifying until PreviousHashExpires
+	PreviousHash        string
+	PreviousHashExpires time.Time
+	// Scopes limit what a root key may do, see HasScope
+	Scopes []string
+	// Encrypted holds the secret of a recoverable key, encrypted with the keyring, empty if the key can not be recovered
+	Encrypted string
+	// LastUsedAt is when the key was last verified successfully, it lags behind by up to a minute
+	LastUsedAt time.Time
+	// ParentKeyId is set for child keys. Their verifications also use up the remaining verifications
+	// and ratelimit of the parent, and they are only valid while the parent is.
+	ParentKeyId string
+	// Format is how the secret was generated, rerolling the key generates the new secret the same way.
+	// It is nil for keys created before it was stored and for imported keys
+	Format *KeyFormat
+}
+
+// KeyFormat describes how the secret of a key is generated
+type KeyFormat struct {
+	ByteLength int
+	Encoding   string
+	Checksum   bool
 }
 
 type Ratelimit struct {
@@ -27,8 +56,20 @@ type Ratelimit struct {
 	Limit          int64
 	RefillRate     int64
 	RefillInterval int64
+	// CheckOrder decides whether the ratelimit is taken before or after remaining verifications
+	// are consumed, empty is CheckRemainingFirst
+	CheckOrder string
 }
 
+const (
+	// CheckRemainingFirst consumes remaining verifications first, a key that is out of them
+	// does not take from its ratelimit, but a ratelimited verification still uses one up
+	CheckRemainingFirst = "remainingFirst"
+	// CheckRatelimitFirst takes from the ratelimit first, a ratelimited verification does not use up
+	// a remaining verification, but a key that is out of them still takes from its ratelimit
+	CheckRatelimitFirst = "ratelimitFirst"
+)
+
 type AuthType string
 
 const (
@@ -45,6 +86,12 @@ type Api struct {
 	AuthType AuthType
 	// Only set if AuthType == "key"
 	KeyAuthId string
+	// A JSON Schema the meta of every key must match, empty if the meta is not checked
+	MetaSchema string
+	// The only top level keys the meta of a key may have, empty allows every key
+	AllowedMetaKeys []string
+	// The prefix of keys created without one, empty creates them without a prefix
+	Prefix string
 }
 
 type Workspace struct {
@@ -54,6 +101,17 @@ type Workspace struct {
 	TenantId           string
 	Internal           bool
 	EnableBetaFeatures bool
+	// MaxKeys caps how many keys the workspace may have, 0 means unlimited
+	MaxKeys int
+	// MaxKeyLifetime caps how far in the future keys may expire, 0 falls back to the server default
+	MaxKeyLifetime time.Duration
+	// SuspendedAt is set when the workspace has been disabled, none of its keys verify while suspended
+	SuspendedAt time.Time
+	// HideKeyStart omits the start of keys from list and get responses, so no part of a secret is revealed
+	HideKeyStart bool
+	// OmitKeyStart stores no start for new keys, so the database can not be searched for keys by their prefix.
+	// Recoverable keys still have a start in responses, it is derived from their decrypted secret.
+	OmitKeyStart bool
 }
 
 type KeyAuth struct {
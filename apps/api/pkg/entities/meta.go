@@ -0,0 +1,42 @@
+package entities
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// MetaString returns the meta value for key if it is a string.
+func (k Key) MetaString(key string) (string, bool) {
+	v, ok := k.Meta[key].(string)
+	return v, ok
+}
+
+// MetaBool returns the meta value for key if it is a boolean.
+func (k Key) MetaBool(key string) (bool, bool) {
+	v, ok := k.Meta[key].(bool)
+	return v, ok
+}
+
+// MetaInt returns the meta value for key if it is a whole number.
+//
+// Meta is decoded from json, so numbers usually arrive as float64. Those are accepted as long as
+// they have no fractional part and fit into an int64.
+func (k Key) MetaInt(key string) (int64, bool) {
+	switch v := k.Meta[key].(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		// float64(math.MaxInt64) rounds up to 2^63, which does not fit
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	case json.Number:
+		i, err := v.Int64()
+		return i, err == nil
+	default:
+		return 0, false
+	}
+}
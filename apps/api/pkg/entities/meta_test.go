@@ -0,0 +1,68 @@
+package entities
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetaAccessors(t *testing.T) {
+	key := Key{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"plan": "pro",
+		"seats": 5,
+		"ratio": 0.5,
+		"huge": 1e300,
+		"trial": true,
+		"nested": {"a": 1}
+	}`), &key.Meta))
+
+	plan, ok := key.MetaString("plan")
+	require.True(t, ok)
+	require.Equal(t, "pro", plan)
+
+	_, ok = key.MetaString("seats")
+	require.False(t, ok)
+
+	seats, ok := key.MetaInt("seats")
+	require.True(t, ok)
+	require.Equal(t, int64(5), seats)
+
+	_, ok = key.MetaInt("ratio")
+	require.False(t, ok)
+
+	_, ok = key.MetaInt("huge")
+	require.False(t, ok)
+
+	_, ok = key.MetaInt("plan")
+	require.False(t, ok)
+
+	trial, ok := key.MetaBool("trial")
+	require.True(t, ok)
+	require.True(t, trial)
+
+	_, ok = key.MetaBool("nested")
+	require.False(t, ok)
+
+	_, ok = key.MetaString("missing")
+	require.False(t, ok)
+}
+
+func TestMetaInt_NilMeta(t *testing.T) {
+	_, ok := Key{}.MetaInt("seats")
+	require.False(t, ok)
+}
+
+func TestMetaInt_NativeTypes(t *testing.T) {
+	key := Key{Meta: map[string]any{"int": 3, "int64": int64(4), "number": json.Number("5"), "fraction": json.Number("5.5")}}
+
+	for name, expected := range map[string]int64{"int": 3, "int64": 4, "number": 5} {
+		v, ok := key.MetaInt(name)
+		require.True(t, ok, name)
+		require.Equal(t, expected, v)
+	}
+
+	_, ok := key.MetaInt("fraction")
+	require.False(t, ok)
+}
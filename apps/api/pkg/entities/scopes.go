@@ -0,0 +1,60 @@
+package entities
+
+// Scopes a root key can be limited to.
+const (
+	ScopeKeysCreate     = "keys.create"
+	ScopeKeysRead       = "keys.read"
+	ScopeKeysUpdate     = "keys.update"
+	ScopeKeysDelete     = "keys.delete"
+	ScopeApisRead       = "apis.read"
+	ScopeApisManage     = "apis.manage"
+	ScopeWebhooksManage = "webhooks.manage"
+	ScopeAuditRead      = "audit.read"
+)
+
+// AllScopes lists every scope a root key can be granted.
+var AllScopes = []string{
+	ScopeKeysCreate,
+	ScopeKeysRead,
+	ScopeKeysUpdate,
+	ScopeKeysDelete,
+	ScopeApisRead,
+	ScopeApisManage,
+	ScopeWebhooksManage,
+	ScopeAuditRead,
+}
+
+// impliedScopes are granted by holding the scope they are listed under.
+var impliedScopes = map[string][]string{
+	ScopeApisManage: {ScopeApisRead},
+}
+
+// ValidScope reports whether scope is one of AllScopes.
+func ValidScope(scope string) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the root key may perform actions that require scope.
+//
+// Root keys created before scopes existed have none and keep full access to their workspace.
+func (k Key) HasScope(scope string) bool {
+	if len(k.Scopes) == 0 {
+		return true
+	}
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+		for _, implied := range impliedScopes[s] {
+			if implied == scope {
+				return true
+			}
+		}
+	}
+	return false
+}
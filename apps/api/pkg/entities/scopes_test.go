@@ -0,0 +1,27 @@
+package entities
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHasScope(t *testing.T) {
+	legacy := Key{ForWorkspaceId: "ws_1"}
+	for _, scope := range AllScopes {
+		require.True(t, legacy.HasScope(scope), scope)
+	}
+
+	scoped := Key{ForWorkspaceId: "ws_1", Scopes: []string{ScopeKeysRead, ScopeApisManage}}
+	require.True(t, scoped.HasScope(ScopeKeysRead))
+	require.True(t, scoped.HasScope(ScopeApisManage))
+	require.True(t, scoped.HasScope(ScopeApisRead))
+	require.False(t, scoped.HasScope(ScopeKeysCreate))
+	require.False(t, scoped.HasScope(ScopeWebhooksManage))
+}
+
+func TestValidScope(t *testing.T) {
+	require.True(t, ValidScope(ScopeKeysCreate))
+	require.False(t, ValidScope("keys.*"))
+	require.False(t, ValidScope(""))
+}
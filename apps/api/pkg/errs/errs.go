@@ -0,0 +1,163 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type Code string
+
+const (
+	NOT_FOUND             Code = "NOT_FOUND"
+	BAD_REQUEST           Code = "BAD_REQUEST"
+	UNAUTHORIZED          Code = "UNAUTHORIZED"
+	INTERNAL_SERVER_ERROR Code = "INTERNAL_SERVER_ERROR"
+	RATELIMITED           Code = "RATELIMITED"
+	FORBIDDEN             Code = "FORBIDDEN"
+	USAGE_EXCEEDED        Code = "USAGE_EXCEEDED"
+	LIMIT_EXCEEDED        Code = "LIMIT_EXCEEDED"
+	DISABLED              Code = "DISABLED"
+	EXPIRED               Code = "EXPIRED"
+	OWNER_MISMATCH        Code = "OWNER_MISMATCH"
+	WRONG_API             Code = "WRONG_API"
+	PAYLOAD_TOO_LARGE     Code = "PAYLOAD_TOO_LARGE"
+	TIMEOUT               Code = "TIMEOUT"
+	CONFLICT              Code = "CONFLICT"
+)
+
+const docsBaseUrl = "https://docs.unkey.dev/api-reference/errors"
+
+// Status returns the http status code we respond with for this error code.
+func (c Code) Status() int {
+	switch c {
+	case NOT_FOUND, EXPIRED:
+		return http.StatusNotFound
+	case BAD_REQUEST:
+		return http.StatusBadRequest
+	case UNAUTHORIZED:
+		return http.StatusUnauthorized
+	case FORBIDDEN:
+		return http.StatusForbidden
+	case RATELIMITED:
+		return http.StatusTooManyRequests
+	case USAGE_EXCEEDED:
+		return http.StatusForbidden
+	case LIMIT_EXCEEDED:
+		return http.StatusForbidden
+	case DISABLED:
+		return http.StatusForbidden
+	case OWNER_MISMATCH:
+		return http.StatusForbidden
+	case WRONG_API:
+		return http.StatusForbidden
+	case PAYLOAD_TOO_LARGE:
+		return http.StatusRequestEntityTooLarge
+	case TIMEOUT:
+		return http.StatusGatewayTimeout
+	case CONFLICT:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Docs returns a link to the documentation of this error code.
+func (c Code) Docs() string {
+	return fmt.Sprintf("%s#%s", docsBaseUrl, strings.ToLower(string(c)))
+}
+
+// Error is a typed error that can be returned from a handler.
+// The server translates it into an ErrorResponse.
+type Error struct {
+	Code   Code
+	Status int
+	// Message is returned to the user, do not put any internals in here.
+	Message string
+	Docs    string
+	// FieldErrors lists every invalid field of a request, if the error is about validation
+	FieldErrors []FieldError
+
+	// cause is only used for logging and never returned to the user
+	cause error
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("%s: %s: %s", e.Code, e.Message, e.cause.Error())
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// New creates a new error, the http status is derived from the code.
+func New(code Code, message string) *Error {
+	return &Error{
+		Code:    code,
+		Status:  code.Status(),
+		Message: message,
+		Docs:    code.Docs(),
+	}
+}
+
+// Wrap creates a new error and keeps the cause around for logging.
+// The cause is not exposed to the user.
+func Wrap(cause error, code Code, message string) *Error {
+	e := New(code, message)
+	e.cause = cause
+	return e
+}
+
+// WithStatus overrides the http status derived from the code.
+func (e *Error) WithStatus(status int) *Error {
+	e.Status = status
+	return e
+}
+
+// FieldError describes why a single field of a request is invalid.
+type FieldError struct {
+	// Field is the path of the field in the request, such as `ratelimit.limit`
+	Field string `json:"field"`
+	// Constraint is the rule the field violates, such as `required` or `max=256`
+	Constraint string `json:"constraint"`
+	Message    string `json:"message"`
+}
+
+// WithFieldErrors attaches the invalid fields of a request.
+func (e *Error) WithFieldErrors(fieldErrors []FieldError) *Error {
+	e.FieldErrors = fieldErrors
+	return e
+}
+
+func NewNotFound(message string) *Error {
+	return New(NOT_FOUND, message)
+}
+
+func NewBadRequest(message string) *Error {
+	return New(BAD_REQUEST, message)
+}
+
+func NewUnauthorized(message string) *Error {
+	return New(UNAUTHORIZED, message)
+}
+
+func NewForbidden(message string) *Error {
+	return New(FORBIDDEN, message)
+}
+
+func NewInternal(cause error, message string) *Error {
+	return Wrap(cause, INTERNAL_SERVER_ERROR, message)
+}
+
+// As returns the typed error if err is or wraps an *Error.
+func As(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
@@ -0,0 +1,40 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_DerivesStatusAndDocs(t *testing.T) {
+	e := New(NOT_FOUND, "key not found")
+
+	require.Equal(t, NOT_FOUND, e.Code)
+	require.Equal(t, http.StatusNotFound, e.Status)
+	require.Equal(t, "key not found", e.Message)
+	require.Equal(t, "https://docs.unkey.dev/api-reference/errors#not_found", e.Docs)
+}
+
+func TestWrap_HidesCauseFromMessage(t *testing.T) {
+	cause := errors.New("connection refused")
+	e := NewInternal(cause, "unable to store key")
+
+	require.Equal(t, http.StatusInternalServerError, e.Status)
+	require.Equal(t, "unable to store key", e.Message)
+	require.ErrorIs(t, e, cause)
+	require.Contains(t, e.Error(), "connection refused")
+}
+
+func TestAs_FindsWrappedError(t *testing.T) {
+	err := fmt.Errorf("handler failed: %w", NewBadRequest("wrong apiId"))
+
+	e, ok := As(err)
+	require.True(t, ok)
+	require.Equal(t, BAD_REQUEST, e.Code)
+
+	_, ok = As(errors.New("plain"))
+	require.False(t, ok)
+}
@@ -0,0 +1,147 @@
+package hash
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MinPepperSize is the minimum length of a pepper in bytes
+const MinPepperSize = 32
+
+var ErrUnknownPepper = errors.New("pepper version is not configured")
+
+// Hasher hashes the secrets of keys with a pepper, a server side secret that is never stored in
+// the database. Without the pepper, a leaked hash can not be brute forced, not even for short secrets.
+//
+// Peppered hashes carry the version of their pepper, so peppers can be rotated: new keys are hashed
+// with the active version, older versions are only kept to find existing keys. Hashes without a
+// version were made before a pepper was configured, or were imported, and are still found.
+//
+// A nil *Hasher does not pepper, it hashes like Sha256.
+type Hasher struct {
+	peppers map[int][]byte
+	active  int
+	// every version but the active one, newest first
+	older []int
+}
+
+// NewHasher returns a hasher that peppers new hashes with the pepper of the active version.
+func NewHasher(peppers map[int][]byte, active int) (*Hasher, error) {
+	older := []int{}
+	for version, pepper := range peppers {
+		if version <= 0 {
+			return nil, fmt.Errorf("pepper versions must be positive, got %d", version)
+		}
+		if len(pepper) < MinPepperSize {
+			return nil, fmt.Errorf("pepper v%d must be at least %d bytes, got %d", version, MinPepperSize, len(pepper))
+		}
+		if version != active {
+			older = append(older, version)
+		}
+	}
+	if _, ok := peppers[active]; !ok {
+		return nil, fmt.Errorf("active pepper v%d: %w", active, ErrUnknownPepper)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(older)))
+	return &Hasher{peppers: peppers, active: active, older: older}, nil
+}
+
+// ParsePeppers parses a comma separated list of `<version>:<base64 pepper>` pairs.
+func ParsePeppers(value string) (map[int][]byte, error) {
+	peppers := map[int][]byte{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		versionStr, encoded, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("pepper must have the format <version>:<base64 pepper>")
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pepper version %q: %w", versionStr, err)
+		}
+		if _, exists := peppers[version]; exists {
+			return nil, fmt.Errorf("pepper v%d is defined twice", version)
+		}
+		pepper, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("pepper v%d is not valid base64: %w", version, err)
+		}
+		peppers[version] = pepper
+	}
+	return peppers, nil
+}
+
+// Sha256WithPepper hashes s and mixes in the pepper, the result has the format `v<version>.<base64url hmac>`.
+//
+// The pepper is applied to the digest of Sha256, not to s itself, so hashes made without a pepper,
+// such as imported ones, can be peppered without knowing their secret, see Hasher.Sha256Candidates.
+func Sha256WithPepper(s string, version int, pepper []byte) string {
+	digest := sha256.Sum256([]byte(s))
+	return pepperDigest(digest[:], version, pepper)
+}
+
+func pepperDigest(digest []byte, version int, pepper []byte) string {
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write(digest)
+	return fmt.Sprintf("v%d.%s", version, base64.RawURLEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+// Hash hashes the secret of a new key, with the active pepper.
+func (h *Hasher) Hash(s string) string {
+	if h == nil {
+		return Sha256(s)
+	}
+	return Sha256WithPepper(s, h.active, h.peppers[h.active])
+}
+
+// Candidates returns every hash a key with this secret may be stored under, in the order they
+// should be looked up: the active pepper, older peppers, and finally without a pepper.
+// The first one is what Hash returns.
+func (h *Hasher) Candidates(s string) []string {
+	digest := sha256.Sum256([]byte(s))
+	return h.candidates(digest[:])
+}
+
+// Sha256Candidates is Candidates for a secret that is only known by its hash made with Sha256,
+// such as an imported key. The first one is the hash to store it under.
+func (h *Hasher) Sha256Candidates(sha256Hash string) ([]string, error) {
+	if !IsSha256(sha256Hash) {
+		return nil, fmt.Errorf("not a sha256 hash")
+	}
+	digest, _ := base64.StdEncoding.DecodeString(sha256Hash)
+	return h.candidates(digest), nil
+}
+
+func (h *Hasher) candidates(digest []byte) []string {
+	unpeppered := base64.StdEncoding.EncodeToString(digest)
+	if h == nil {
+		return []string{unpeppered}
+	}
+	candidates := []string{pepperDigest(digest, h.active, h.peppers[h.active])}
+	for _, version := range h.older {
+		candidates = append(candidates, pepperDigest(digest, version, h.peppers[version]))
+	}
+	return append(candidates, unpeppered)
+}
+
+// PepperVersion returns the version of the pepper a hash was made with, 0 if it has none.
+func PepperVersion(h string) int {
+	prefix, _, ok := strings.Cut(h, ".")
+	if !ok || !strings.HasPrefix(prefix, "v") {
+		return 0
+	}
+	version, err := strconv.Atoi(prefix[1:])
+	if err != nil {
+		return 0
+	}
+	return version
+}
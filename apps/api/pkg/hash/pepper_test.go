@@ -0,0 +1,81 @@
+package hash
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func pepper(b byte) []byte {
+	return bytes.Repeat([]byte{b}, MinPepperSize)
+}
+
+func TestSha256WithPepper(t *testing.T) {
+	s := uuid.NewString()
+	peppered := Sha256WithPepper(s, 1, pepper(1))
+
+	require.NotEqual(t, Sha256(s), peppered)
+	require.Equal(t, peppered, Sha256WithPepper(s, 1, pepper(1)))
+	require.NotEqual(t, peppered, Sha256WithPepper(s, 1, pepper(2)))
+	require.Equal(t, 1, PepperVersion(peppered))
+	require.Equal(t, 0, PepperVersion(Sha256(s)))
+	require.False(t, IsSha256(peppered))
+}
+
+func TestHasher(t *testing.T) {
+	s := uuid.NewString()
+	old, err := NewHasher(map[int][]byte{1: pepper(1)}, 1)
+	require.NoError(t, err)
+	rotated, err := NewHasher(map[int][]byte{1: pepper(1), 2: pepper(2), 3: pepper(3)}, 2)
+	require.NoError(t, err)
+
+	hash := rotated.Hash(s)
+	require.Equal(t, 2, PepperVersion(hash))
+
+	// keys hashed before the rotation, and before there was a pepper, are still found
+	candidates := rotated.Candidates(s)
+	require.Equal(t, []string{hash, Sha256WithPepper(s, 3, pepper(3)), old.Hash(s), Sha256(s)}, candidates)
+	require.NotContains(t, rotated.Candidates(uuid.NewString()), hash)
+
+	imported, err := rotated.Sha256Candidates(Sha256(s))
+	require.NoError(t, err)
+	require.Equal(t, candidates, imported)
+	_, err = rotated.Sha256Candidates("not a hash")
+	require.Error(t, err)
+}
+
+func TestHasher_Nil(t *testing.T) {
+	var h *Hasher
+	s := uuid.NewString()
+	require.Equal(t, Sha256(s), h.Hash(s))
+	require.Equal(t, []string{Sha256(s)}, h.Candidates(s))
+
+	imported, err := h.Sha256Candidates(Sha256(s))
+	require.NoError(t, err)
+	require.Equal(t, []string{Sha256(s)}, imported)
+}
+
+func TestNewHasher_Invalid(t *testing.T) {
+	_, err := NewHasher(map[int][]byte{1: pepper(1)}, 2)
+	require.ErrorIs(t, err, ErrUnknownPepper)
+
+	_, err = NewHasher(map[int][]byte{1: []byte("short")}, 1)
+	require.Error(t, err)
+
+	_, err = NewHasher(map[int][]byte{0: pepper(1)}, 0)
+	require.Error(t, err)
+}
+
+func TestParsePeppers(t *testing.T) {
+	peppers, err := ParsePeppers("1:" + base64.StdEncoding.EncodeToString(pepper(1)) + ", 2:" + base64.StdEncoding.EncodeToString(pepper(2)))
+	require.NoError(t, err)
+	require.Equal(t, map[int][]byte{1: pepper(1), 2: pepper(2)}, peppers)
+
+	for _, invalid := range []string{"no-version", "x:AAAA", "1:not base64", "1:AAAA,1:AAAA"} {
+		_, err = ParsePeppers(invalid)
+		require.Error(t, err, invalid)
+	}
+}
@@ -11,3 +11,12 @@ func Sha256(s string) string {
 
 	return base64.StdEncoding.EncodeToString(hash.Sum(nil))
 }
+
+// IsSha256 reports whether s has the format produced by Sha256
+func IsSha256(s string) bool {
+	b, err := base64.StdEncoding.Strict().DecodeString(s)
+	if err != nil {
+		return false
+	}
+	return len(b) == sha256.Size
+}
@@ -16,3 +16,14 @@ func TestSha256(t *testing.T) {
 		require.Equal(t, h, Sha256(s))
 	}
 }
+
+func TestIsSha256(t *testing.T) {
+	require.True(t, IsSha256(Sha256(uuid.NewString())))
+
+	require.False(t, IsSha256(""))
+	require.False(t, IsSha256("not a hash"))
+	// hex encoded
+	require.False(t, IsSha256("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"))
+	// base64 of a shorter digest
+	require.False(t, IsSha256("qUqP5cyxm6YcTAhz05Hph5gvu9M="))
+}
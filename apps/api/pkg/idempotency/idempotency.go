@@ -0,0 +1,116 @@
+// Package idempotency remembers the results of requests for a while, so a retried request
+// returns the original result instead of doing the work twice.
+//
+// Results are only kept in memory of the current node.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrFingerprintMismatch is returned when an idempotency key is reused for a different request.
+var ErrFingerprintMismatch = errors.New("idempotency key was already used for a different request")
+
+var errPanicked = errors.New("the original request did not complete")
+
+type entry[T any] struct {
+	fingerprint string
+	// done is closed once the first request has finished
+	done    chan struct{}
+	value   T
+	err     error
+	expires time.Time
+}
+
+type Store[T any] struct {
+	sync.Mutex
+	ttl       time.Duration
+	entries   map[string]*entry[T]
+	lastSweep time.Time
+}
+
+// New creates a store that remembers successful results for ttl.
+func New[T any](ttl time.Duration) *Store[T] {
+	return &Store[T]{
+		ttl:       ttl,
+		entries:   make(map[string]*entry[T]),
+		lastSweep: time.Now(),
+	}
+}
+
+// Do calls fn once per key and returns its result to every caller with the same key until the ttl expires.
+//
+// Concurrent callers with the same key wait for the first call to finish and share its result.
+// Errors are not remembered, a later call with the same key calls fn again.
+// The fingerprint identifies the request, reusing a key with a different fingerprint returns ErrFingerprintMismatch.
+// replayed is true if the value was produced by an earlier call.
+func (s *Store[T]) Do(ctx context.Context, key, fingerprint string, fn func() (T, error)) (value T, replayed bool, err error) {
+	now := time.Now()
+
+	s.Lock()
+	s.sweep(now)
+	e, ok := s.entries[key]
+	if ok && !e.expires.IsZero() && now.After(e.expires) {
+		delete(s.entries, key)
+		ok = false
+	}
+	if ok {
+		s.Unlock()
+		if e.fingerprint != fingerprint {
+			return value, false, ErrFingerprintMismatch
+		}
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return value, false, ctx.Err()
+		}
+		if e.err != nil {
+			return value, false, e.err
+		}
+		return e.value, true, nil
+	}
+
+	e = &entry[T]{
+		fingerprint: fingerprint,
+		done:        make(chan struct{}),
+	}
+	s.entries[key] = e
+	s.Unlock()
+
+	// finish even if fn panics, otherwise waiting callers would block until their context is done
+	completed := false
+	defer func() {
+		s.Lock()
+		if !completed || e.err != nil {
+			delete(s.entries, key)
+		} else {
+			e.expires = time.Now().Add(s.ttl)
+		}
+		s.Unlock()
+		if !completed {
+			e.err = errPanicked
+		}
+		close(e.done)
+	}()
+
+	e.value, e.err = fn()
+	completed = true
+
+	return e.value, false, e.err
+}
+
+// sweep removes expired entries at most once per ttl, the caller must hold the lock.
+func (s *Store[T]) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.ttl {
+		return
+	}
+	for key, e := range s.entries {
+		if !e.expires.IsZero() && now.After(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+	s.lastSweep = now
+}
@@ -0,0 +1,134 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDo_ReplaysResult(t *testing.T) {
+	s := New[string](time.Minute)
+	calls := 0
+	fn := func() (string, error) {
+		calls++
+		return "value", nil
+	}
+
+	value, replayed, err := s.Do(context.Background(), "key", "a", fn)
+	require.NoError(t, err)
+	require.False(t, replayed)
+	require.Equal(t, "value", value)
+
+	value, replayed, err = s.Do(context.Background(), "key", "a", fn)
+	require.NoError(t, err)
+	require.True(t, replayed)
+	require.Equal(t, "value", value)
+	require.Equal(t, 1, calls)
+}
+
+func TestDo_FingerprintMismatch(t *testing.T) {
+	s := New[string](time.Minute)
+	fn := func() (string, error) { return "value", nil }
+
+	_, _, err := s.Do(context.Background(), "key", "a", fn)
+	require.NoError(t, err)
+
+	_, _, err = s.Do(context.Background(), "key", "b", fn)
+	require.ErrorIs(t, err, ErrFingerprintMismatch)
+}
+
+func TestDo_ErrorsAreNotRemembered(t *testing.T) {
+	s := New[string](time.Minute)
+
+	_, _, err := s.Do(context.Background(), "key", "a", func() (string, error) {
+		return "", errors.New("boom")
+	})
+	require.Error(t, err)
+
+	value, replayed, err := s.Do(context.Background(), "key", "a", func() (string, error) {
+		return "value", nil
+	})
+	require.NoError(t, err)
+	require.False(t, replayed)
+	require.Equal(t, "value", value)
+}
+
+func TestDo_Expires(t *testing.T) {
+	s := New[string](time.Millisecond)
+	calls := 0
+	fn := func() (string, error) {
+		calls++
+		return "value", nil
+	}
+
+	_, _, err := s.Do(context.Background(), "key", "a", fn)
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+
+	_, replayed, err := s.Do(context.Background(), "key", "a", fn)
+	require.NoError(t, err)
+	require.False(t, replayed)
+	require.Equal(t, 2, calls)
+}
+
+func TestDo_ConcurrentCallsShareResult(t *testing.T) {
+	s := New[string](time.Minute)
+	var calls atomic.Int32
+	release := make(chan struct{})
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, _, err := s.Do(context.Background(), "key", "a", func() (string, error) {
+				calls.Add(1)
+				<-release
+				return "value", nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, "value", value)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func TestDo_PanicReleasesWaiters(t *testing.T) {
+	s := New[string](time.Minute)
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	go func() {
+		defer func() { _ = recover() }()
+		_, _, _ = s.Do(context.Background(), "key", "a", func() (string, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+
+	done := make(chan error)
+	go func() {
+		_, _, err := s.Do(context.Background(), "key", "a", func() (string, error) { return "value", nil })
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	select {
+	case err := <-done:
+		require.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("waiter was not released")
+	}
+}
@@ -0,0 +1,54 @@
+package jitter
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Next returns how long to wait until the next run of a periodic task: the interval plus a
+// random offset in [0, window). Replicas that were deployed together drift apart this way,
+// instead of all hitting the database at the same moment.
+// A window of 0 or less returns the interval unchanged.
+func Next(interval time.Duration, window time.Duration, rnd *rand.Rand) time.Duration {
+	if window <= 0 {
+		return interval
+	}
+	return interval + time.Duration(rnd.Int63n(int64(window)))
+}
+
+// Ticker ticks like a time.Ticker, but every tick is delayed by a new random offset within the window.
+type Ticker struct {
+	C <-chan time.Time
+
+	stop chan struct{}
+}
+
+// NewTicker starts a ticker, it must be stopped to release its goroutine.
+func NewTicker(interval time.Duration, window time.Duration) *Ticker {
+	c := make(chan time.Time, 1)
+	t := &Ticker{C: c, stop: make(chan struct{})}
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	go func() {
+		timer := time.NewTimer(Next(interval, window, rnd))
+		defer timer.Stop()
+		for {
+			select {
+			case now := <-timer.C:
+				// like time.Ticker, ticks are dropped if nobody is reading
+				select {
+				case c <- now:
+				default:
+				}
+				timer.Reset(Next(interval, window, rnd))
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// Stop turns off the ticker, like time.Ticker it does not close C.
+func (t *Ticker) Stop() {
+	close(t.stop)
+}
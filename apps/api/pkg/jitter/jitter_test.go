@@ -0,0 +1,46 @@
+package jitter
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNext(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	interval := 10 * time.Second
+	window := 2 * time.Second
+
+	// split the window into buckets, every bucket should get some of the runs
+	buckets := make([]int, 10)
+	for i := 0; i < 1000; i++ {
+		next := Next(interval, window, rnd)
+		require.GreaterOrEqual(t, next, interval)
+		require.Less(t, next, interval+window)
+		buckets[int((next-interval)*10/window)]++
+	}
+	for i, n := range buckets {
+		require.Greater(t, n, 50, "bucket %d", i)
+	}
+}
+
+func TestNext_NoWindow(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	require.Equal(t, time.Second, Next(time.Second, 0, rnd))
+	require.Equal(t, time.Second, Next(time.Second, -time.Second, rnd))
+}
+
+func TestTicker(t *testing.T) {
+	ticker := NewTicker(time.Millisecond, time.Millisecond)
+	defer ticker.Stop()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-ticker.C:
+		case <-time.After(time.Second):
+			t.Fatal("no tick")
+		}
+	}
+}
@@ -0,0 +1,458 @@
+// Package jsonschema validates decoded json values against a subset of JSON Schema.
+//
+// The supported keywords are type, enum, const, properties, required, additionalProperties,
+// minProperties, maxProperties, items, minItems, maxItems, minLength, maxLength, pattern,
+// minimum, maximum, exclusiveMinimum and exclusiveMaximum. Annotations such as title or
+// description are ignored. Keywords that would change the outcome but are not supported,
+// such as $ref or anyOf, are rejected by Compile, so a schema is never enforced partially.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// unsupported keywords change the outcome of a validation, they must not be ignored
+var unsupported = []string{
+	"$ref", "$dynamicRef", "allOf", "anyOf", "oneOf", "not", "if", "then", "else",
+	"dependentRequired", "dependentSchemas", "dependencies", "patternProperties", "propertyNames",
+	"prefixItems", "contains", "uniqueItems", "multipleOf", "unevaluatedProperties", "unevaluatedItems",
+}
+
+var types = map[string]bool{
+	"object":  true,
+	"array":   true,
+	"string":  true,
+	"number":  true,
+	"integer": true,
+	"boolean": true,
+	"null":    true,
+}
+
+// Schema is a compiled schema, it is safe for concurrent use.
+type Schema struct {
+	types      []string
+	enum       []any
+	constant   *any
+	properties map[string]*Schema
+	required   []string
+	// nil allows any additional property
+	additional    *Schema
+	noAdditional  bool
+	minProperties *int
+	maxProperties *int
+	items         *Schema
+	minItems      *int
+	maxItems      *int
+	minLength     *int
+	maxLength     *int
+	pattern       *regexp.Regexp
+	minimum       *float64
+	maximum       *float64
+	exclusiveMin  *float64
+	exclusiveMax  *float64
+}
+
+// Violation is a part of a value that does not match the schema.
+type Violation struct {
+	// Path of the offending value, fields and array indexes are separated by dots. Empty for the value itself.
+	Path string
+	// Keyword of the schema that failed, such as `required` or `type`
+	Keyword string
+	Message string
+}
+
+// Compile parses a json encoded schema.
+func Compile(raw []byte) (*Schema, error) {
+	var doc any
+	err := json.Unmarshal(raw, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("schema is not valid json: %w", err)
+	}
+	return compile(doc, "")
+}
+
+func compile(doc any, path string) (*Schema, error) {
+	switch d := doc.(type) {
+	case bool:
+		// `true` accepts everything, `false` nothing
+		if d {
+			return &Schema{}, nil
+		}
+		return &Schema{types: []string{}}, nil
+	case map[string]any:
+		return compileObject(d, path)
+	default:
+		return nil, fmt.Errorf("%s must be an object or a boolean", describe(path))
+	}
+}
+
+func compileObject(doc map[string]any, path string) (*Schema, error) {
+	for _, keyword := range unsupported {
+		if _, ok := doc[keyword]; ok {
+			return nil, fmt.Errorf("%s: the '%s' keyword is not supported", describe(path), keyword)
+		}
+	}
+
+	s := &Schema{}
+	var err error
+
+	if t, ok := doc["type"]; ok {
+		switch v := t.(type) {
+		case string:
+			s.types = []string{v}
+		case []any:
+			s.types = []string{}
+			for _, item := range v {
+				name, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s must only contain strings", at(path, "type"))
+				}
+				s.types = append(s.types, name)
+			}
+		default:
+			return nil, fmt.Errorf("%s must be a string or an array of strings", at(path, "type"))
+		}
+		for _, name := range s.types {
+			if !types[name] {
+				return nil, fmt.Errorf("%s: unknown type '%s'", at(path, "type"), name)
+			}
+		}
+	}
+
+	if e, ok := doc["enum"]; ok {
+		values, ok := e.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s must be an array", at(path, "enum"))
+		}
+		s.enum = values
+	}
+	if c, ok := doc["const"]; ok {
+		s.constant = &c
+	}
+
+	if p, ok := doc["properties"]; ok {
+		properties, ok := p.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s must be an object", at(path, "properties"))
+		}
+		s.properties = make(map[string]*Schema, len(properties))
+		for name, property := range properties {
+			s.properties[name], err = compile(property, join(join(path, "properties"), name))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if r, ok := doc["required"]; ok {
+		required, ok := r.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s must be an array of strings", at(path, "required"))
+		}
+		for _, item := range required {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be an array of strings", at(path, "required"))
+			}
+			s.required = append(s.required, name)
+		}
+	}
+	if a, ok := doc["additionalProperties"]; ok {
+		if allowed, isBool := a.(bool); isBool {
+			s.noAdditional = !allowed
+		} else {
+			s.additional, err = compile(a, join(path, "additionalProperties"))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if s.minProperties, err = count(doc, path, "minProperties"); err != nil {
+		return nil, err
+	}
+	if s.maxProperties, err = count(doc, path, "maxProperties"); err != nil {
+		return nil, err
+	}
+
+	if i, ok := doc["items"]; ok {
+		s.items, err = compile(i, join(path, "items"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if s.minItems, err = count(doc, path, "minItems"); err != nil {
+		return nil, err
+	}
+	if s.maxItems, err = count(doc, path, "maxItems"); err != nil {
+		return nil, err
+	}
+
+	if s.minLength, err = count(doc, path, "minLength"); err != nil {
+		return nil, err
+	}
+	if s.maxLength, err = count(doc, path, "maxLength"); err != nil {
+		return nil, err
+	}
+	if p, ok := doc["pattern"]; ok {
+		pattern, ok := p.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a string", at(path, "pattern"))
+		}
+		s.pattern, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a valid regular expression: %w", at(path, "pattern"), err)
+		}
+	}
+
+	if s.minimum, err = number(doc, path, "minimum"); err != nil {
+		return nil, err
+	}
+	if s.maximum, err = number(doc, path, "maximum"); err != nil {
+		return nil, err
+	}
+	if s.exclusiveMin, err = number(doc, path, "exclusiveMinimum"); err != nil {
+		return nil, err
+	}
+	if s.exclusiveMax, err = number(doc, path, "exclusiveMaximum"); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Validate returns every violation of the schema, it is empty if the value matches.
+// The value must be decoded from json, objects are map[string]any and numbers float64.
+func (s *Schema) Validate(value any) []Violation {
+	violations := []Violation{}
+	s.validate(value, "", &violations)
+	return violations
+}
+
+func (s *Schema) validate(value any, path string, violations *[]Violation) {
+	report := func(keyword string, format string, args ...any) {
+		*violations = append(*violations, Violation{Path: path, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.types != nil && !matchesType(value, s.types) {
+		if len(s.types) == 0 {
+			report("false", "no value is allowed")
+		} else {
+			report("type", "must be of type %s, got %s", strings.Join(s.types, " or "), typeOf(value))
+		}
+		// the remaining keywords would only repeat the mismatch
+		return
+	}
+
+	if s.enum != nil {
+		found := false
+		for _, allowed := range s.enum {
+			if equal(value, allowed) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report("enum", "must be one of the allowed values")
+		}
+	}
+	if s.constant != nil && !equal(value, *s.constant) {
+		report("const", "must be %s", encode(*s.constant))
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		s.validateObject(v, path, violations, report)
+	case []any:
+		if s.minItems != nil && len(v) < *s.minItems {
+			report("minItems", "must have at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			report("maxItems", "must have at most %d items", *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range v {
+				s.items.validate(item, join(path, strconv.Itoa(i)), violations)
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.minLength != nil && length < *s.minLength {
+			report("minLength", "must be at least %d characters long", *s.minLength)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			report("maxLength", "must be at most %d characters long", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			report("pattern", "must match the pattern %s", s.pattern.String())
+		}
+	default:
+		n, ok := toFloat(value)
+		if !ok {
+			return
+		}
+		if s.minimum != nil && n < *s.minimum {
+			report("minimum", "must be greater than or equal to %v", *s.minimum)
+		}
+		if s.maximum != nil && n > *s.maximum {
+			report("maximum", "must be less than or equal to %v", *s.maximum)
+		}
+		if s.exclusiveMin != nil && n <= *s.exclusiveMin {
+			report("exclusiveMinimum", "must be greater than %v", *s.exclusiveMin)
+		}
+		if s.exclusiveMax != nil && n >= *s.exclusiveMax {
+			report("exclusiveMaximum", "must be less than %v", *s.exclusiveMax)
+		}
+	}
+}
+
+func (s *Schema) validateObject(v map[string]any, path string, violations *[]Violation, report func(string, string, ...any)) {
+	for _, name := range s.required {
+		if _, ok := v[name]; !ok {
+			*violations = append(*violations, Violation{Path: join(path, name), Keyword: "required", Message: "is required"})
+		}
+	}
+	if s.minProperties != nil && len(v) < *s.minProperties {
+		report("minProperties", "must have at least %d properties", *s.minProperties)
+	}
+	if s.maxProperties != nil && len(v) > *s.maxProperties {
+		report("maxProperties", "must have at most %d properties", *s.maxProperties)
+	}
+
+	// sorted, so violations are reported in a stable order
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if property, ok := s.properties[name]; ok {
+			property.validate(v[name], join(path, name), violations)
+			continue
+		}
+		if s.noAdditional {
+			*violations = append(*violations, Violation{Path: join(path, name), Keyword: "additionalProperties", Message: "is not allowed"})
+		} else if s.additional != nil {
+			s.additional.validate(v[name], join(path, name), violations)
+		}
+	}
+}
+
+func matchesType(value any, allowed []string) bool {
+	actual := typeOf(value)
+	for _, t := range allowed {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func typeOf(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	default:
+		n, ok := toFloat(v)
+		if !ok {
+			return fmt.Sprintf("%T", v)
+		}
+		if n == math.Trunc(n) && !math.IsInf(n, 0) {
+			return "integer"
+		}
+		return "number"
+	}
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		n, err := v.Float64()
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// equal compares json values, numbers are equal if they have the same value regardless of their go type
+func equal(a, b any) bool {
+	x, aIsNumber := toFloat(a)
+	y, bIsNumber := toFloat(b)
+	if aIsNumber || bIsNumber {
+		return aIsNumber && bIsNumber && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func encode(value any) string {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(buf)
+}
+
+func count(doc map[string]any, path string, keyword string) (*int, error) {
+	n, err := number(doc, path, keyword)
+	if err != nil || n == nil {
+		return nil, err
+	}
+	if *n < 0 || *n != math.Trunc(*n) {
+		return nil, fmt.Errorf("%s must be a non-negative integer", at(path, keyword))
+	}
+	c := int(*n)
+	return &c, nil
+}
+
+func number(doc map[string]any, path string, keyword string) (*float64, error) {
+	value, ok := doc[keyword]
+	if !ok {
+		return nil, nil
+	}
+	n, ok := toFloat(value)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a number", at(path, keyword))
+	}
+	return &n, nil
+}
+
+func join(path string, segment string) string {
+	if path == "" {
+		return segment
+	}
+	return path + "." + segment
+}
+
+// describe names a (sub)schema in compile errors
+func describe(path string) string {
+	if path == "" {
+		return "the schema"
+	}
+	return fmt.Sprintf("'%s'", path)
+}
+
+// at names a keyword of the schema in compile errors
+func at(path string, keyword string) string {
+	return fmt.Sprintf("'%s'", join(path, keyword))
+}
@@ -0,0 +1,123 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func decode(t *testing.T, raw string) any {
+	t.Helper()
+	var value any
+	require.NoError(t, json.Unmarshal([]byte(raw), &value))
+	return value
+}
+
+func TestValidate(t *testing.T) {
+	schema, err := Compile([]byte(`{
+		"type": "object",
+		"required": ["plan"],
+		"properties": {
+			"plan": {"type": "string", "enum": ["free", "pro"]},
+			"seats": {"type": "integer", "minimum": 1, "maximum": 100},
+			"tags": {"type": "array", "items": {"type": "string", "minLength": 2}, "maxItems": 2},
+			"email": {"type": "string", "pattern": "^[^@]+@[^@]+$"}
+		},
+		"additionalProperties": false
+	}`))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		value      string
+		violations []Violation
+	}{
+		{name: "valid", value: `{"plan":"pro","seats":3,"tags":["ab"],"email":"a@b"}`, violations: []Violation{}},
+		{name: "missing required", value: `{}`, violations: []Violation{
+			{Path: "plan", Keyword: "required", Message: "is required"},
+		}},
+		{name: "wrong root type", value: `[]`, violations: []Violation{
+			{Path: "", Keyword: "type", Message: "must be of type object, got array"},
+		}},
+		{name: "nested violations", value: `{"plan":"enterprise","seats":1.5,"tags":["a","bc","de"],"email":"nope","extra":true}`, violations: []Violation{
+			{Path: "email", Keyword: "pattern", Message: "must match the pattern ^[^@]+@[^@]+$"},
+			{Path: "extra", Keyword: "additionalProperties", Message: "is not allowed"},
+			{Path: "plan", Keyword: "enum", Message: "must be one of the allowed values"},
+			{Path: "seats", Keyword: "type", Message: "must be of type integer, got number"},
+			{Path: "tags", Keyword: "maxItems", Message: "must have at most 2 items"},
+			{Path: "tags.0", Keyword: "minLength", Message: "must be at least 2 characters long"},
+		}},
+		{name: "out of range", value: `{"plan":"free","seats":0}`, violations: []Violation{
+			{Path: "seats", Keyword: "minimum", Message: "must be greater than or equal to 1"},
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.violations, schema.Validate(decode(t, tc.value)))
+		})
+	}
+}
+
+func TestValidate_Keywords(t *testing.T) {
+	testCases := []struct {
+		name    string
+		schema  string
+		value   string
+		keyword string
+	}{
+		{name: "true accepts everything", schema: `true`, value: `{"a":1}`},
+		{name: "false accepts nothing", schema: `false`, value: `{}`, keyword: "false"},
+		{name: "integer is a number", schema: `{"type":"number"}`, value: `1`},
+		{name: "multiple types", schema: `{"type":["string","null"]}`, value: `null`},
+		{name: "const", schema: `{"const":{"a":[1]}}`, value: `{"a":[1.0]}`},
+		{name: "const mismatch", schema: `{"const":"a"}`, value: `"b"`, keyword: "const"},
+		{name: "exclusive minimum", schema: `{"exclusiveMinimum":1}`, value: `1`, keyword: "exclusiveMinimum"},
+		{name: "exclusive maximum", schema: `{"exclusiveMaximum":1}`, value: `0.5`},
+		{name: "max length counts characters", schema: `{"maxLength":2}`, value: `"äö"`},
+		{name: "min properties", schema: `{"minProperties":1}`, value: `{}`, keyword: "minProperties"},
+		{name: "additional properties schema", schema: `{"additionalProperties":{"type":"string"}}`, value: `{"a":1}`, keyword: "type"},
+		{name: "keywords only apply to their type", schema: `{"minLength":5,"minimum":3}`, value: `true`},
+		{name: "annotations are ignored", schema: `{"title":"meta","description":"d","$schema":"https://json-schema.org/draft/2020-12/schema","format":"email"}`, value: `"x"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			schema, err := Compile([]byte(tc.schema))
+			require.NoError(t, err)
+			violations := schema.Validate(decode(t, tc.value))
+			if tc.keyword == "" {
+				require.Empty(t, violations)
+				return
+			}
+			require.Len(t, violations, 1)
+			require.Equal(t, tc.keyword, violations[0].Keyword)
+		})
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		schema string
+		err    string
+	}{
+		{name: "not json", schema: `{`, err: "not valid json"},
+		{name: "not a schema", schema: `"object"`, err: "the schema must be an object or a boolean"},
+		{name: "unknown type", schema: `{"type":"date"}`, err: "unknown type 'date'"},
+		{name: "unsupported keyword", schema: `{"anyOf":[{"type":"string"}]}`, err: "the 'anyOf' keyword is not supported"},
+		{name: "nested unsupported keyword", schema: `{"properties":{"a":{"$ref":"#/"}}}`, err: "'properties.a': the '$ref' keyword is not supported"},
+		{name: "invalid pattern", schema: `{"pattern":"("}`, err: "'pattern' is not a valid regular expression"},
+		{name: "negative count", schema: `{"items":{"minItems":-1}}`, err: "'items.minItems' must be a non-negative integer"},
+		{name: "invalid required", schema: `{"required":"plan"}`, err: "'required' must be an array of strings"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Compile([]byte(tc.schema))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
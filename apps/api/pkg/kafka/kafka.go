@@ -3,31 +3,37 @@ package kafka
 import (
 	"context"
 	"crypto/tls"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/segmentio/kafka-go"
 	"github.com/segmentio/kafka-go/sasl/scram"
 	"go.uber.org/zap"
+	"io"
 	"sync"
 	"time"
 )
 
 const topic = "key.changed"
 
-type keyEventType string
+type KeyEventType string
 
 var (
-	KeyCreated keyEventType = "created"
-	KeyUpdated keyEventType = "updated"
-	KeyDeleted keyEventType = "deleted"
+	KeyCreated KeyEventType = "created"
+	KeyUpdated KeyEventType = "updated"
+	KeyDeleted KeyEventType = "deleted"
+	// Not produced by the api yet, replays already handle it
+	KeyVerified KeyEventType = "verified"
 )
 
 type KeyEvent struct {
-	Type keyEventType `json:"type"`
-	Key  struct {
-		Id   string `json:"id"`
-		Hash string `hson:"hash"`
-	} `json:"key"`
+	Type KeyEventType `json:"type"`
+	Key  keyEventKey  `json:"key"`
+}
+
+type keyEventKey struct {
+	Id string `json:"id"`
+	// Legacy events were written with "Hash", which decodes into this too
+	Hash string `json:"hash"`
 }
 
 type Kafka struct {
@@ -38,41 +44,59 @@ type Kafka struct {
 	callbackLock sync.RWMutex
 	onKeyEvent   []func(ctx context.Context, e KeyEvent) error
 
+	// used for health checks
+	dialer  *kafka.Dialer
+	brokers []string
+
+	// the schema version of produced events
+	schemaVersion int
+
 	logger *zap.Logger
 }
 
 type Config struct {
-	GroupId  string
-	Broker   string
+	GroupId string
+	// At least one broker, the others are discovered from it
+	Brokers  []string
 	Username string
 	Password string
 	Logger   *zap.Logger
+	// The schema version events are produced in, LatestSchemaVersion is used when 0.
+	// Keep producing the old version until every consumer understands the new one.
+	SchemaVersion int
 }
 
 func New(config Config) (*Kafka, error) {
-	logger := config.Logger.With(zap.String("pkg", "kafka"))
-	logger.Info("starting kafka")
-	mechanism, err := scram.Mechanism(scram.SHA256, config.Username, config.Password)
+	if len(config.Brokers) == 0 {
+		return nil, errors.New("no kafka brokers configured")
+	}
+	if config.SchemaVersion == 0 {
+		config.SchemaVersion = LatestSchemaVersion
+	}
+	err := validateSchemaVersion(config.SchemaVersion)
 	if err != nil {
-		return nil, fmt.Errorf("unable to create scram mechanism: %w", err)
+		return nil, err
 	}
-
-	dialer := &kafka.Dialer{
-		Timeout:       10 * time.Second,
-		TLS:           &tls.Config{},
-		SASLMechanism: mechanism,
+	logger := config.Logger.With(zap.String("pkg", "kafka"))
+	logger.Info("starting kafka", zap.Int("schemaVersion", config.SchemaVersion))
+	dialer, err := newDialer(config.Username, config.Password)
+	if err != nil {
+		return nil, err
 	}
 	return &Kafka{
-		logger:       logger,
-		callbackLock: sync.RWMutex{},
+		logger:        logger,
+		dialer:        dialer,
+		brokers:       config.Brokers,
+		callbackLock:  sync.RWMutex{},
+		schemaVersion: config.SchemaVersion,
 		keyChangedReader: kafka.NewReader(kafka.ReaderConfig{
-			Brokers: []string{config.Broker},
+			Brokers: config.Brokers,
 			GroupID: config.GroupId,
 			Topic:   topic,
 			Dialer:  dialer,
 		}),
 		keyChangedWriter: kafka.NewWriter(kafka.WriterConfig{
-			Brokers: []string{config.Broker},
+			Brokers: config.Brokers,
 			Topic:   topic,
 			Dialer:  dialer,
 		}),
@@ -82,26 +106,52 @@ func New(config Config) (*Kafka, error) {
 
 }
 
+func newDialer(username, password string) (*kafka.Dialer, error) {
+	mechanism, err := scram.Mechanism(scram.SHA256, username, password)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create scram mechanism: %w", err)
+	}
+	return &kafka.Dialer{
+		Timeout:       10 * time.Second,
+		TLS:           &tls.Config{},
+		SASLMechanism: mechanism,
+	}, nil
+}
+
 func (k *Kafka) RegisterOnKeyEvent(handler func(ctx context.Context, e KeyEvent) error) {
 	k.callbackLock.Lock()
 	defer k.callbackLock.Unlock()
 	k.onKeyEvent = append(k.onKeyEvent, handler)
 }
 
-func (k *Kafka) ProduceKeyEvent(ctx context.Context, eventType keyEventType, keyId, keyHash string) error {
+func (k *Kafka) ProduceKeyEvent(ctx context.Context, eventType KeyEventType, keyId, keyHash string) error {
 	e := KeyEvent{
 		Type: eventType,
 	}
 	e.Key.Id = keyId
 	e.Key.Hash = keyHash
-	value, err := json.Marshal(e)
+	value, err := encodeKeyEvent(e, k.schemaVersion)
 	if err != nil {
-		return fmt.Errorf("unable to marshal KeyDeltedEvent: %w", err)
+		return fmt.Errorf("unable to marshal %s event: %w", eventType, err)
 	}
 
 	return k.keyChangedWriter.WriteMessages(ctx, kafka.Message{Value: value})
 }
 
+// Ping checks whether any of the brokers accepts connections for our producer.
+func (k *Kafka) Ping(ctx context.Context) error {
+	var err error
+	for _, broker := range k.brokers {
+		var conn *kafka.Conn
+		conn, err = k.dialer.DialContext(ctx, "tcp", broker)
+		if err == nil {
+			return conn.Close()
+		}
+	}
+	return fmt.Errorf("unable to connect to broker: %w", err)
+}
+
+// Close flushes all pending messages and closes the reader and writer.
 func (k *Kafka) Close() error {
 	k.Lock()
 	defer k.Unlock()
@@ -122,6 +172,10 @@ func (k *Kafka) Start() {
 		ctx := context.Background()
 		m, err := k.keyChangedReader.FetchMessage(ctx)
 		if err != nil {
+			if errors.Is(err, io.EOF) {
+				k.logger.Info("reader closed, stopping consumer")
+				return
+			}
 			k.logger.Error("unable to fetch message", zap.Error(err))
 			continue
 		}
@@ -130,8 +184,7 @@ func (k *Kafka) Start() {
 			k.logger.Warn("message is empty", zap.String("topic", m.Topic))
 			continue
 		}
-		e := KeyEvent{}
-		err = json.Unmarshal(m.Value, &e)
+		e, _, err := decodeKeyEvent(m.Value)
 		if err != nil {
 			k.logger.Error("unable to unmarshal message", zap.Error(err), zap.String("value", string(m.Value)))
 			continue
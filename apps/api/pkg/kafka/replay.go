@@ -0,0 +1,190 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// consumer is the part of *kafka.Reader a replay needs
+type consumer interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// OffsetStore remembers which events were applied, per partition.
+// Store the offsets in the same place as the rebuilt data to apply every event exactly once,
+// even if a commit to kafka is lost in a crash.
+type OffsetStore interface {
+	// LastOffset returns the offset of the last applied event of a partition, or -1 if there is none
+	LastOffset(ctx context.Context, partition int) (int64, error)
+	SaveOffset(ctx context.Context, partition int, offset int64) error
+}
+
+type ReplayConfig struct {
+	// A group only used for this replay, a new group starts at the beginning of the topic
+	GroupId string
+	// At least one broker, the others are discovered from it
+	Brokers  []string
+	Username string
+	Password string
+	Logger   *zap.Logger
+	// Optional, offsets are only kept in memory by default
+	Offsets OffsetStore
+}
+
+// Replayer reads all key events from the beginning of the topic, for example to rebuild analytics.
+//
+// Unlike Kafka.Start, a failing handler stops the replay: the event is not committed and is
+// handled again when the replay is restarted. Events that were already applied are skipped.
+type Replayer struct {
+	reader   consumer
+	offsets  OffsetStore
+	handlers map[KeyEventType][]func(ctx context.Context, e KeyEvent) error
+	logger   *zap.Logger
+
+	// the last applied offset of every partition we have seen
+	applied map[int]int64
+}
+
+func NewReplayer(config ReplayConfig) (*Replayer, error) {
+	if len(config.Brokers) == 0 {
+		return nil, errors.New("no kafka brokers configured")
+	}
+	if config.GroupId == "" {
+		return nil, errors.New("a replay needs its own group id")
+	}
+	dialer, err := newDialer(config.Username, config.Password)
+	if err != nil {
+		return nil, err
+	}
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     config.Brokers,
+		GroupID:     config.GroupId,
+		Topic:       topic,
+		Dialer:      dialer,
+		StartOffset: kafka.FirstOffset,
+	})
+	return newReplayer(reader, config.Offsets, config.Logger), nil
+}
+
+func newReplayer(reader consumer, offsets OffsetStore, logger *zap.Logger) *Replayer {
+	if offsets == nil {
+		offsets = &memoryOffsets{offsets: map[int]int64{}}
+	}
+	return &Replayer{
+		reader:   reader,
+		offsets:  offsets,
+		handlers: map[KeyEventType][]func(ctx context.Context, e KeyEvent) error{},
+		logger:   logger.With(zap.String("pkg", "kafka"), zap.String("consumer", "replay")),
+		applied:  map[int]int64{},
+	}
+}
+
+// On registers a handler for one type of event, register all handlers before calling Run.
+func (r *Replayer) On(eventType KeyEventType, handler func(ctx context.Context, e KeyEvent) error) {
+	r.handlers[eventType] = append(r.handlers[eventType], handler)
+}
+
+// Run replays events until ctx is cancelled or the reader is closed, both return nil.
+// Any other error stops the replay, it can be resumed by calling Run again.
+func (r *Replayer) Run(ctx context.Context) error {
+	for {
+		m, err := r.reader.FetchMessage(ctx)
+		if err != nil {
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				r.logger.Info("replay stopped")
+				return nil
+			}
+			return fmt.Errorf("unable to fetch message: %w", err)
+		}
+
+		err = r.apply(ctx, m)
+		if err != nil {
+			return err
+		}
+
+		err = r.reader.CommitMessages(ctx, m)
+		if err != nil {
+			return fmt.Errorf("unable to commit offset %d of partition %d: %w", m.Offset, m.Partition, err)
+		}
+	}
+}
+
+// apply runs the handlers of a message unless it was applied before
+func (r *Replayer) apply(ctx context.Context, m kafka.Message) error {
+	last, ok := r.applied[m.Partition]
+	if !ok {
+		var err error
+		last, err = r.offsets.LastOffset(ctx, m.Partition)
+		if err != nil {
+			return fmt.Errorf("unable to load offset of partition %d: %w", m.Partition, err)
+		}
+		r.applied[m.Partition] = last
+	}
+	if m.Offset <= last {
+		r.logger.Debug("skipping applied event", zap.Int("partition", m.Partition), zap.Int64("offset", m.Offset))
+		return nil
+	}
+
+	if len(m.Value) == 0 {
+		r.logger.Warn("message is empty", zap.Int("partition", m.Partition), zap.Int64("offset", m.Offset))
+	} else {
+		e, _, err := decodeKeyEvent(m.Value)
+		if err != nil {
+			// a broken message would stop every future replay, so it is skipped
+			r.logger.Error("unable to unmarshal message", zap.Error(err), zap.String("value", string(m.Value)))
+		} else {
+			handlers, ok := r.handlers[e.Type]
+			if !ok {
+				r.logger.Warn("no handler for event", zap.String("type", string(e.Type)))
+			}
+			for _, handler := range handlers {
+				err = handler(ctx, e)
+				if err != nil {
+					return fmt.Errorf("unable to handle %s event at offset %d of partition %d: %w", e.Type, m.Offset, m.Partition, err)
+				}
+			}
+		}
+	}
+
+	err := r.offsets.SaveOffset(ctx, m.Partition, m.Offset)
+	if err != nil {
+		return fmt.Errorf("unable to save offset %d of partition %d: %w", m.Offset, m.Partition, err)
+	}
+	r.applied[m.Partition] = m.Offset
+	return nil
+}
+
+// Close stops the replay, Run returns once the reader is closed.
+func (r *Replayer) Close() error {
+	return r.reader.Close()
+}
+
+type memoryOffsets struct {
+	sync.Mutex
+	offsets map[int]int64
+}
+
+func (o *memoryOffsets) LastOffset(ctx context.Context, partition int) (int64, error) {
+	o.Lock()
+	defer o.Unlock()
+	offset, ok := o.offsets[partition]
+	if !ok {
+		return -1, nil
+	}
+	return offset, nil
+}
+
+func (o *memoryOffsets) SaveOffset(ctx context.Context, partition int, offset int64) error {
+	o.Lock()
+	defer o.Unlock()
+	o.offsets[partition] = offset
+	return nil
+}
@@ -0,0 +1,111 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// mockConsumer replays a fixed sequence of messages and then reports that it is closed
+type mockConsumer struct {
+	messages  []kafka.Message
+	committed []int64
+}
+
+func (c *mockConsumer) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if len(c.messages) == 0 {
+		return kafka.Message{}, io.EOF
+	}
+	m := c.messages[0]
+	c.messages = c.messages[1:]
+	return m, nil
+}
+
+func (c *mockConsumer) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	for _, m := range msgs {
+		c.committed = append(c.committed, m.Offset)
+	}
+	return nil
+}
+
+func (c *mockConsumer) Close() error {
+	return nil
+}
+
+func message(t *testing.T, offset int64, eventType KeyEventType, keyId string) kafka.Message {
+	e := KeyEvent{Type: eventType}
+	e.Key.Id = keyId
+	value, err := json.Marshal(e)
+	require.NoError(t, err)
+	return kafka.Message{Topic: topic, Offset: offset, Value: value}
+}
+
+func TestReplayer_Run(t *testing.T) {
+	reader := &mockConsumer{messages: []kafka.Message{
+		message(t, 0, KeyCreated, "key_1"),
+		message(t, 1, KeyVerified, "key_1"),
+		message(t, 2, KeyUpdated, "key_1"),
+		// redelivered after a rebalance
+		message(t, 1, KeyVerified, "key_1"),
+		{Topic: topic, Offset: 3},
+		message(t, 4, KeyEventType("unknown"), "key_1"),
+		message(t, 5, KeyVerified, "key_1"),
+		message(t, 6, KeyDeleted, "key_1"),
+	}}
+	r := newReplayer(reader, nil, zap.NewNop())
+
+	handled := []string{}
+	record := func(ctx context.Context, e KeyEvent) error {
+		handled = append(handled, string(e.Type))
+		return nil
+	}
+	for _, eventType := range []KeyEventType{KeyCreated, KeyUpdated, KeyDeleted, KeyVerified} {
+		r.On(eventType, record)
+	}
+
+	require.NoError(t, r.Run(context.Background()))
+	require.Equal(t, []string{"created", "verified", "updated", "verified", "deleted"}, handled)
+	require.Equal(t, []int64{0, 1, 2, 1, 3, 4, 5, 6}, reader.committed)
+}
+
+func TestReplayer_ResumesAfterFailure(t *testing.T) {
+	sequence := func() []kafka.Message {
+		return []kafka.Message{
+			message(t, 0, KeyCreated, "key_1"),
+			message(t, 1, KeyCreated, "key_2"),
+			message(t, 2, KeyDeleted, "key_1"),
+		}
+	}
+	offsets := &memoryOffsets{offsets: map[int]int64{}}
+
+	failing := &mockConsumer{messages: sequence()}
+	r := newReplayer(failing, offsets, zap.NewNop())
+	r.On(KeyCreated, func(ctx context.Context, e KeyEvent) error {
+		if e.Key.Id == "key_2" {
+			return errors.New("store unavailable")
+		}
+		return nil
+	})
+	err := r.Run(context.Background())
+	require.ErrorContains(t, err, "store unavailable")
+	require.Equal(t, []int64{0}, failing.committed)
+
+	// the commit of the first event got lost, kafka delivers everything again
+	handled := []string{}
+	resumed := &mockConsumer{messages: sequence()}
+	r = newReplayer(resumed, offsets, zap.NewNop())
+	for _, eventType := range []KeyEventType{KeyCreated, KeyDeleted} {
+		r.On(eventType, func(ctx context.Context, e KeyEvent) error {
+			handled = append(handled, string(e.Type)+" "+e.Key.Id)
+			return nil
+		})
+	}
+	require.NoError(t, r.Run(context.Background()))
+	require.Equal(t, []string{"created key_2", "deleted key_1"}, handled)
+}
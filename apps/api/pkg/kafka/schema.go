@@ -0,0 +1,81 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Versions of the key event payload. New fields may be added to a version at any time,
+// consumers ignore fields they don't know. Anything else needs a new version.
+const (
+	// The event itself, without an envelope
+	SchemaVersionLegacy = 1
+	// The event data wrapped in an envelope that names its version
+	SchemaVersionEnvelope = 2
+
+	LatestSchemaVersion = SchemaVersionEnvelope
+)
+
+// envelope wraps every event since SchemaVersionEnvelope
+type envelope struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Type          KeyEventType    `json:"type"`
+	Data          json.RawMessage `json:"data"`
+}
+
+type keyEventData struct {
+	Key keyEventKey `json:"key"`
+}
+
+func validateSchemaVersion(version int) error {
+	if version < SchemaVersionLegacy || version > LatestSchemaVersion {
+		return fmt.Errorf("unknown event schema version %d, must be between %d and %d", version, SchemaVersionLegacy, LatestSchemaVersion)
+	}
+	return nil
+}
+
+// encodeKeyEvent serializes an event in the given schema version.
+// Producing an older version lets consumers that don't know the newer one keep working during a rollout.
+func encodeKeyEvent(e KeyEvent, version int) ([]byte, error) {
+	if version == SchemaVersionLegacy {
+		return json.Marshal(e)
+	}
+	data, err := json.Marshal(keyEventData{Key: e.Key})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope{
+		SchemaVersion: version,
+		Type:          e.Type,
+		Data:          data,
+	})
+}
+
+// decodeKeyEvent reads an event of any schema version and returns the version it was written in.
+// Versions newer than LatestSchemaVersion are read like the latest one, their unknown fields are ignored.
+func decodeKeyEvent(value []byte) (KeyEvent, int, error) {
+	// legacy events have no schemaVersion, so it stays 0
+	env := envelope{}
+	err := json.Unmarshal(value, &env)
+	if err != nil {
+		return KeyEvent{}, 0, err
+	}
+
+	if env.SchemaVersion == 0 {
+		e := KeyEvent{}
+		err = json.Unmarshal(value, &e)
+		if err != nil {
+			return KeyEvent{}, 0, err
+		}
+		return e, SchemaVersionLegacy, nil
+	}
+
+	data := keyEventData{}
+	if len(env.Data) > 0 {
+		err = json.Unmarshal(env.Data, &data)
+		if err != nil {
+			return KeyEvent{}, 0, fmt.Errorf("unable to decode data of %s event with schema version %d: %w", env.Type, env.SchemaVersion, err)
+		}
+	}
+	return KeyEvent{Type: env.Type, Key: data.Key}, env.SchemaVersion, nil
+}
@@ -0,0 +1,73 @@
+package kafka
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeKeyEvent_Legacy(t *testing.T) {
+	// written by producers before the envelope, note the capitalized hash
+	e, version, err := decodeKeyEvent([]byte(`{"type":"created","key":{"id":"key_1","Hash":"hash_1"}}`))
+	require.NoError(t, err)
+	require.Equal(t, SchemaVersionLegacy, version)
+	require.Equal(t, KeyCreated, e.Type)
+	require.Equal(t, "key_1", e.Key.Id)
+	require.Equal(t, "hash_1", e.Key.Hash)
+}
+
+func TestDecodeKeyEvent_UnknownFields(t *testing.T) {
+	// a newer producer added fields and a version we don't know yet
+	e, version, err := decodeKeyEvent([]byte(`{
+		"schemaVersion": 3,
+		"type": "updated",
+		"producedAt": 1700000000000,
+		"data": {"key": {"id": "key_1", "hash": "hash_1", "workspaceId": "ws_1"}, "changes": ["meta"]}
+	}`))
+	require.NoError(t, err)
+	require.Equal(t, 3, version)
+	require.Equal(t, KeyUpdated, e.Type)
+	require.Equal(t, "key_1", e.Key.Id)
+	require.Equal(t, "hash_1", e.Key.Hash)
+}
+
+func TestEncodeKeyEvent_RoundTrip(t *testing.T) {
+	e := KeyEvent{Type: KeyDeleted}
+	e.Key.Id = "key_1"
+	e.Key.Hash = "hash_1"
+
+	for _, version := range []int{SchemaVersionLegacy, SchemaVersionEnvelope} {
+		value, err := encodeKeyEvent(e, version)
+		require.NoError(t, err)
+
+		decoded, decodedVersion, err := decodeKeyEvent(value)
+		require.NoError(t, err)
+		require.Equal(t, version, decodedVersion)
+		require.Equal(t, e, decoded)
+	}
+}
+
+func TestEncodeKeyEvent_Envelope(t *testing.T) {
+	e := KeyEvent{Type: KeyCreated}
+	e.Key.Id = "key_1"
+	e.Key.Hash = "hash_1"
+
+	value, err := encodeKeyEvent(e, SchemaVersionEnvelope)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"schemaVersion":2,"type":"created","data":{"key":{"id":"key_1","hash":"hash_1"}}}`, string(value))
+
+	// consumers from before the envelope still find the type
+	legacy := struct {
+		Type KeyEventType `json:"type"`
+	}{}
+	require.NoError(t, json.Unmarshal(value, &legacy))
+	require.Equal(t, KeyCreated, legacy.Type)
+}
+
+func TestValidateSchemaVersion(t *testing.T) {
+	require.NoError(t, validateSchemaVersion(SchemaVersionLegacy))
+	require.NoError(t, validateSchemaVersion(LatestSchemaVersion))
+	require.Error(t, validateSchemaVersion(0))
+	require.Error(t, validateSchemaVersion(LatestSchemaVersion+1))
+}
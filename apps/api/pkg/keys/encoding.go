@@ -0,0 +1,102 @@
+package keys
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/base58"
+)
+
+// Encoding determines how the binary key is represented as a string.
+// It does not affect the entropy of a key.
+type Encoding string
+
+const (
+	// EncodingBase58 avoids ambiguous characters like 0, O, I and l
+	EncodingBase58 Encoding = "base58"
+	// EncodingBase62 only uses alphanumeric characters
+	EncodingBase62 Encoding = "base62"
+	// EncodingBase64Url is the shortest, but uses `-` and `_`
+	EncodingBase64Url Encoding = "base64url"
+)
+
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+func (e Encoding) encode(buf []byte) (string, error) {
+	switch e {
+	case EncodingBase58, "":
+		return base58.Encode(buf), nil
+	case EncodingBase62:
+		return encodeBase62(buf), nil
+	case EncodingBase64Url:
+		return base64.RawURLEncoding.EncodeToString(buf), nil
+	default:
+		return "", fmt.Errorf("unknown encoding: %s", e)
+	}
+}
+
+func (e Encoding) decode(s string) ([]byte, error) {
+	switch e {
+	case EncodingBase58, "":
+		buf := base58.Decode(s)
+		if len(buf) == 0 {
+			return nil, fmt.Errorf("invalid base58 string")
+		}
+		return buf, nil
+	case EncodingBase62:
+		return decodeBase62(s)
+	case EncodingBase64Url:
+		return base64.RawURLEncoding.DecodeString(s)
+	default:
+		return nil, fmt.Errorf("unknown encoding: %s", e)
+	}
+}
+
+// encodeBase62 treats buf as a big endian number, leading zero bytes are encoded as '0'
+func encodeBase62(buf []byte) string {
+	zeros := 0
+	for zeros < len(buf) && buf[zeros] == 0 {
+		zeros++
+	}
+
+	n := new(big.Int).SetBytes(buf)
+	base := big.NewInt(int64(len(base62Alphabet)))
+	mod := new(big.Int)
+
+	out := []byte{}
+	for n.Sign() > 0 {
+		n.DivMod(n, base, mod)
+		out = append(out, base62Alphabet[mod.Int64()])
+	}
+	for i := 0; i < zeros; i++ {
+		out = append(out, base62Alphabet[0])
+	}
+
+	// reverse, we built the string starting from the least significant digit
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func decodeBase62(s string) ([]byte, error) {
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base62Alphabet[0] {
+		zeros++
+	}
+
+	n := new(big.Int)
+	base := big.NewInt(int64(len(base62Alphabet)))
+	for _, c := range s[zeros:] {
+		i := strings.IndexRune(base62Alphabet, c)
+		if i < 0 {
+			return nil, fmt.Errorf("invalid base62 character: %q", c)
+		}
+		n.Mul(n, base)
+		n.Add(n, big.NewInt(int64(i)))
+	}
+
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
@@ -2,13 +2,14 @@ package keys
 
 import (
 	"github.com/stretchr/testify/require"
+	"strings"
 	"testing"
 )
 
 func TestEncodeDecode(t *testing.T) {
 	for i := 0; i < 100; i++ {
 
-		key, err := NewV1Key("prefix", i)
+		key, _, err := NewV1Key("prefix", i)
 		require.NoError(t, err)
 
 		decodedKey := keyV1{}
@@ -21,3 +22,254 @@ func TestEncodeDecode(t *testing.T) {
 
 	}
 }
+
+func TestMarshal_Golden(t *testing.T) {
+	random := make([]byte, 16)
+	for i := range random {
+		random[i] = byte(i)
+	}
+
+	tests := []struct {
+		encoding Encoding
+		expected string
+	}{
+		{EncodingBase58, "test_3ZFTVMJ69MaQg71pn85SRmbU"},
+		{EncodingBase62, "test_YBFiAkH1TtZQFCGwkihJcDv"},
+		{EncodingBase64Url, "test_ARAAAQIDBAUGBwgJCgsMDQ4P"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.encoding), func(t *testing.T) {
+			key, err := keyV1{prefix: "test", random: random, encoding: tt.encoding}.Marshal()
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, key)
+
+			decodedKey := keyV1{encoding: tt.encoding}
+			err = decodedKey.Unmarshal(key)
+			require.NoError(t, err)
+			require.Equal(t, "test", decodedKey.prefix)
+			require.Equal(t, random, decodedKey.random)
+		})
+	}
+}
+
+func TestNewV1Key_DefaultsToBase58(t *testing.T) {
+	key, _, err := NewV1Key("prefix", 16)
+	require.NoError(t, err)
+
+	decodedKey := keyV1{encoding: EncodingBase58}
+	require.NoError(t, decodedKey.Unmarshal(key))
+	require.Len(t, decodedKey.random, 16)
+}
+
+func TestNewV1Key_EncodingKeepsEntropy(t *testing.T) {
+	for _, encoding := range []Encoding{EncodingBase58, EncodingBase62, EncodingBase64Url} {
+		for i := 0; i < 100; i++ {
+			key, _, err := NewV1Key("prefix", i, WithEncoding(encoding))
+			require.NoError(t, err)
+
+			decodedKey := keyV1{encoding: encoding}
+			err = decodedKey.Unmarshal(key)
+			require.NoError(t, err)
+			require.Equal(t, "prefix", decodedKey.prefix)
+			require.Len(t, decodedKey.random, i)
+		}
+	}
+}
+
+func TestNewV1Key_UnknownEncoding(t *testing.T) {
+	_, _, err := NewV1Key("prefix", 16, WithEncoding("base2"))
+	require.Error(t, err)
+}
+
+func TestValidate_WithChecksum(t *testing.T) {
+	for _, encoding := range []Encoding{EncodingBase58, EncodingBase62, EncodingBase64Url} {
+		for i := 0; i < 100; i++ {
+			key, _, err := NewV1Key("prefix", 16, WithEncoding(encoding), WithChecksum())
+			require.NoError(t, err)
+			require.True(t, Validate(key), "key %s must be valid", key)
+
+			decodedKey := keyV1{encoding: encoding}
+			require.NoError(t, decodedKey.Unmarshal(key))
+			require.True(t, decodedKey.checksum)
+			require.Len(t, decodedKey.random, 16)
+		}
+	}
+}
+
+func TestValidate_DetectsTypos(t *testing.T) {
+	random := make([]byte, 16)
+	for i := range random {
+		random[i] = byte(i)
+	}
+	key, err := keyV1{prefix: "prefix", random: random, encoding: EncodingBase58, checksum: true}.Marshal()
+	require.NoError(t, err)
+	require.True(t, Validate(key))
+
+	// swap two adjacent characters in the random part
+	b := []byte(key)
+	i := len("prefix_") + 5
+	b[i], b[i+1] = b[i+1], b[i]
+	require.NotEqual(t, key, string(b))
+	require.False(t, Validate(string(b)))
+
+	// a typo in the prefix is detected too
+	require.False(t, Validate("prefiz"+key[len("prefix"):]))
+}
+
+func TestValidate_WithoutChecksum(t *testing.T) {
+	key, _, err := NewV1Key("prefix", 16)
+	require.NoError(t, err)
+	require.True(t, Validate(key))
+
+	// keys that we can't parse are not rejected
+	require.True(t, Validate("not_a_v1_key"))
+}
+
+func TestNewV1Key_Start(t *testing.T) {
+	testCases := []struct {
+		prefix string
+		start  string
+	}{
+		{prefix: "", start: ""},
+		{prefix: "sk", start: "sk_"},
+		{prefix: "sk_live", start: "sk_live_"},
+		{prefix: "schlüssel", start: "schlüssel_"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.prefix, func(t *testing.T) {
+			key, start, err := NewV1Key(tc.prefix, 16)
+			require.NoError(t, err)
+			require.Len(t, start, StartLength(tc.prefix, DefaultStartChars))
+			require.True(t, strings.HasPrefix(key, start))
+			require.Equal(t, tc.start, start[:len(start)-DefaultStartChars])
+			require.Equal(t, tc.prefix, PrefixFromStart(start, DefaultStartChars))
+		})
+	}
+}
+
+func TestNewKey_WithStartChars(t *testing.T) {
+	testCases := []struct {
+		name       string
+		prefix     string
+		startChars int
+		start      string
+	}{
+		{name: "zero reveal", prefix: "sk", startChars: 0, start: "sk_"},
+		{name: "zero reveal without prefix", prefix: "", startChars: 0, start: ""},
+		{name: "negative is zero", prefix: "sk", startChars: -1, start: "sk_"},
+		{name: "prefix with separator", prefix: "sk_live", startChars: 0, start: "sk_live_"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, newKey := range []func(string, int, ...Option) (string, string, error){NewV1Key, NewV2Key} {
+				key, start, err := newKey(tc.prefix, 16, WithStartChars(tc.startChars))
+				require.NoError(t, err)
+				require.Equal(t, tc.start, start)
+				require.True(t, strings.HasPrefix(key, start))
+				require.Equal(t, tc.prefix, PrefixFromStart(start, tc.startChars))
+			}
+		})
+	}
+}
+
+func TestNewV1Key_StartNeverExceedsKey(t *testing.T) {
+	_, start, err := NewV1Key("sk", 16, WithStartChars(100))
+	require.NoError(t, err)
+	require.Len(t, start, len("sk_")+MaxStartChars)
+
+	// a single random byte encodes to fewer characters than MaxStartChars
+	key, start, err := NewV1Key("", 1, WithStartChars(MaxStartChars))
+	require.NoError(t, err)
+	require.LessOrEqual(t, len(start), len(key))
+	require.True(t, strings.HasPrefix(key, start))
+}
+
+func TestNewV2Key_AlwaysHasChecksum(t *testing.T) {
+	for _, encoding := range []Encoding{EncodingBase58, EncodingBase62, EncodingBase64Url} {
+		for i := 0; i < 100; i++ {
+			key, start, err := NewV2Key("prefix", 16, WithEncoding(encoding))
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(key, start))
+
+			decodedKey := keyV2{encoding: encoding}
+			require.NoError(t, decodedKey.Unmarshal(key))
+			require.Equal(t, "prefix", decodedKey.prefix)
+			require.Len(t, decodedKey.random, 16)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	v1, _, err := NewV1Key("prefix", 16)
+	require.NoError(t, err)
+	v1WithChecksum, _, err := NewV1Key("prefix", 16, WithChecksum(), WithEncoding(EncodingBase62))
+	require.NoError(t, err)
+	v2, _, err := NewV2Key("prefix", 16)
+	require.NoError(t, err)
+	v2WithoutPrefix, _, err := NewV2Key("", 16, WithEncoding(EncodingBase64Url))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		key     string
+		version Version
+	}{
+		{name: "v1", key: v1, version: Version1},
+		{name: "v1 with checksum", key: v1WithChecksum, version: Version1},
+		{name: "v2", key: v2, version: Version2},
+		{name: "v2 without prefix", key: v2WithoutPrefix, version: Version2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			version, err := ParseVersion(tc.key)
+			require.NoError(t, err)
+			require.Equal(t, tc.version, version)
+			require.True(t, Validate(tc.key))
+		})
+	}
+
+	version, err := ParseVersion("not_a_v1_key")
+	require.Error(t, err)
+	require.Equal(t, VersionUnknown, version)
+}
+
+func TestParseVersion_V2DetectsTypos(t *testing.T) {
+	random := make([]byte, 16)
+	for i := range random {
+		random[i] = byte(i)
+	}
+	key, err := keyV2{prefix: "prefix", random: random, encoding: EncodingBase58}.Marshal()
+	require.NoError(t, err)
+
+	b := []byte(key)
+	i := len("prefix_") + 5
+	b[i], b[i+1] = b[i+1], b[i]
+
+	version, err := ParseVersion(string(b))
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+	require.Equal(t, Version2, version)
+	require.False(t, Validate(string(b)))
+	require.False(t, Validate("prefiz"+key[len("prefix"):]))
+}
+
+func TestStart(t *testing.T) {
+	for _, prefix := range []string{"", "sk", "sk_live"} {
+		v1, start, err := NewV1Key(prefix, 16)
+		require.NoError(t, err)
+		recomputed, err := Start(v1, DefaultStartChars)
+		require.NoError(t, err)
+		require.Equal(t, start, recomputed, prefix)
+
+		v2, _, err := NewV2Key(prefix, 16, WithEncoding(EncodingBase62), WithStartChars(8))
+		require.NoError(t, err)
+		recomputed, err = Start(v2, 2)
+		require.NoError(t, err)
+		require.Equal(t, v2[:StartLength(prefix, 2)], recomputed, prefix)
+	}
+
+	_, err := Start("imported_from_elsewhere", DefaultStartChars)
+	require.Error(t, err)
+}
@@ -0,0 +1,106 @@
+package keys
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Version 2 keys always carry a checksum, so every v2 key can be validated without a database lookup
+// 1. 1 byte for the version
+// 2. 1 byte to let us know the byteLength of the random part
+// 3. X bytes of random data
+// 4. 4 bytes of CRC32 over the prefix and the previous bytes
+// [VERSION, LEN, X,X,X,X,X,X,X,X,X,X,X,X,X,X,X,X, C,C,C,C]
+type keyV2 struct {
+	prefix   string
+	random   []byte
+	encoding Encoding
+}
+
+func (k keyV2) Marshal() (string, error) {
+	if len(k.random) > 255 {
+		return "", fmt.Errorf("v2 keys can only handle 255 bytes of randomness")
+	}
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte(byte(Version2))
+	buf.WriteByte(byte(len(k.random)))
+	buf.Write(k.random)
+	buf.Write(checksum(k.prefix, buf.Bytes()))
+
+	s, err := k.encoding.encode(buf.Bytes())
+	if err != nil {
+		return "", err
+	}
+
+	if k.prefix != "" {
+		return k.prefix + Separator + s, nil
+	}
+	return s, nil
+}
+
+// Unmarshal parses a key that was encoded with k.encoding, see keyV1.Unmarshal for how the prefix is found.
+func (k *keyV2) Unmarshal(key string) error {
+	var lastErr error
+	for _, candidate := range splitCandidates(key) {
+		random, err := k.decodeRandom(candidate[0], candidate[1])
+		if err != nil {
+			// a checksum mismatch is the most helpful error, don't overwrite it
+			if !errors.Is(lastErr, ErrChecksumMismatch) {
+				lastErr = err
+			}
+			continue
+		}
+		k.prefix = candidate[0]
+		k.random = random
+		return nil
+	}
+	return lastErr
+}
+
+func (k *keyV2) decodeRandom(prefix string, s string) ([]byte, error) {
+	buf, err := k.encoding.decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < 2 {
+		return nil, fmt.Errorf("key is too short")
+	}
+	if buf[0] != byte(Version2) {
+		return nil, fmt.Errorf("key has wrong version, expected 2, got %d", buf[0])
+	}
+	byteLength := int(buf[1])
+	if len(buf) != 2+byteLength+checksumLength {
+		return nil, fmt.Errorf("key has wrong length, expected %d bytes, got %d", byteLength, len(buf)-2-checksumLength)
+	}
+	payload := buf[:2+byteLength]
+	if !bytes.Equal(checksum(prefix, payload), buf[2+byteLength:]) {
+		return nil, ErrChecksumMismatch
+	}
+	return payload[2:], nil
+}
+
+// NewV2Key creates a new random key with a checksum.
+// Like NewV1Key it also returns the start of the key. WithChecksum has no effect, v2 keys always carry one.
+func NewV2Key(prefix string, byteLength int, opts ...Option) (key string, start string, err error) {
+	o := newOptions(opts)
+
+	if byteLength > 255 {
+		return "", "", fmt.Errorf("v2 keys can only handle 255 bytes of randomness")
+	}
+	random, err := randomBytes(byteLength)
+	if err != nil {
+		return "", "", err
+	}
+	k := keyV2{
+		prefix:   prefix,
+		random:   random,
+		encoding: o.encoding,
+	}
+
+	key, err = k.Marshal()
+	if err != nil {
+		return "", "", err
+	}
+	return key, startOf(prefix, key, o.startChars), nil
+}
@@ -3,22 +3,45 @@ package keys
 import (
 	"bytes"
 	"crypto/rand"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"strings"
-
-	"github.com/btcsuite/btcd/btcutil/base58"
 )
 
-const separator = "_"
+// Separator is placed between the prefix and the encoded part of a key
+const Separator = "_"
+
+const checksumLength = 4
+
+// DefaultStartChars is how many characters of the encoded part are stored in plaintext, unless WithStartChars is used
+const DefaultStartChars = 4
+
+// MaxStartChars caps WithStartChars, the start must never give away a meaningful part of the secret
+const MaxStartChars = 8
 
-// Version 1 keys are constructed of 3 parts
+// ErrChecksumMismatch means the key was most likely mistyped
+var ErrChecksumMismatch = errors.New("checksum does not match")
+
+// Version 1 keys are constructed of 3 parts and an optional checksum
 // 1. 1 byte for the version
 // 2. 1 byte to let us know the byteLength of the random part
 // 3. X bytes of random data
-// [VERSION, LEN, X,X,X,X,X,X,X,X,X,X,X,X,X,X,X,X]
+// 4. optionally 4 bytes of CRC32 over the prefix and the previous bytes
+// [VERSION, LEN, X,X,X,X,X,X,X,X,X,X,X,X,X,X,X,X, (C,C,C,C)]
 type keyV1 struct {
-	prefix string
-	random []byte
+	prefix   string
+	random   []byte
+	encoding Encoding
+	checksum bool
+}
+
+func checksum(prefix string, buf []byte) []byte {
+	sum := crc32.NewIEEE()
+	_, _ = sum.Write([]byte(prefix))
+	_, _ = sum.Write(buf)
+	return binary.BigEndian.AppendUint32(nil, sum.Sum32())
 }
 
 func (k keyV1) Marshal() (string, error) {
@@ -26,55 +49,217 @@ func (k keyV1) Marshal() (string, error) {
 		return "", fmt.Errorf("v1 keys can only handle 255 bytes of randomness")
 	}
 	buf := bytes.NewBuffer(nil)
-	buf.WriteByte(1)
+	buf.WriteByte(byte(Version1))
 	buf.WriteByte(byte(len(k.random)))
 	buf.Write(k.random)
+	if k.checksum {
+		buf.Write(checksum(k.prefix, buf.Bytes()))
+	}
 
-	s := base58.Encode(buf.Bytes())
+	s, err := k.encoding.encode(buf.Bytes())
+	if err != nil {
+		return "", err
+	}
 
 	if k.prefix != "" {
-		return strings.Join([]string{string(k.prefix), s}, separator), nil
+		return strings.Join([]string{string(k.prefix), s}, Separator), nil
 	} else {
 		return s, nil
 	}
 }
 
+// Unmarshal parses a key that was encoded with k.encoding.
+// Both the prefix and the encoded part may contain the separator, so we try every
+// split and use the first one that decodes into a valid v1 key.
 func (k *keyV1) Unmarshal(key string) error {
-	split := strings.Split(key, separator)
-	if len(split) == 2 {
-		k.prefix = split[0]
+	var lastErr error
+	for _, candidate := range splitCandidates(key) {
+		random, hasChecksum, err := k.decodeRandom(candidate[0], candidate[1])
+		if err != nil {
+			// a checksum mismatch is the most helpful error, don't overwrite it
+			if !errors.Is(lastErr, ErrChecksumMismatch) {
+				lastErr = err
+			}
+			continue
+		}
+		k.prefix = candidate[0]
+		k.random = random
+		k.checksum = hasChecksum
+		return nil
 	}
+	return lastErr
+}
 
-	rest := split[len(split)-1]
+// splitCandidates returns every way of splitting a key into prefix and encoded part,
+// the last candidate has no prefix at all.
+func splitCandidates(key string) [][2]string {
+	candidates := [][2]string{}
+	for i := 0; i < len(key); i++ {
+		if strings.HasPrefix(key[i:], Separator) {
+			candidates = append(candidates, [2]string{key[:i], key[i+len(Separator):]})
+		}
+	}
+	return append(candidates, [2]string{"", key})
+}
 
-	buf := base58.Decode(rest)
-	if buf[0] != 1 {
-		return fmt.Errorf("key has wrong version, expected 1, got %d", buf[0])
+func (k *keyV1) decodeRandom(prefix string, s string) ([]byte, bool, error) {
+	buf, err := k.encoding.decode(s)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(buf) < 2 {
+		return nil, false, fmt.Errorf("key is too short")
 	}
-	byteLength := buf[1]
+	if buf[0] != byte(Version1) {
+		return nil, false, fmt.Errorf("key has wrong version, expected 1, got %d", buf[0])
+	}
+	byteLength := int(buf[1])
+	switch len(buf) {
+	case 2 + byteLength:
+		return buf[2:], false, nil
+	case 2 + byteLength + checksumLength:
+		payload := buf[:2+byteLength]
+		if !bytes.Equal(checksum(prefix, payload), buf[2+byteLength:]) {
+			return nil, true, ErrChecksumMismatch
+		}
+		return payload[2:], true, nil
+	default:
+		return nil, false, fmt.Errorf("key has wrong length, expected %d bytes, got %d", byteLength, len(buf)-2)
+	}
+}
+
+type options struct {
+	encoding   Encoding
+	checksum   bool
+	startChars int
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		encoding:   EncodingBase58,
+		startChars: DefaultStartChars,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
 
-	k.random = buf[2 : 2+byteLength]
-	return nil
+type Option func(*options)
 
+// WithEncoding sets how the key is represented as a string, defaults to base58
+func WithEncoding(encoding Encoding) Option {
+	return func(o *options) {
+		o.encoding = encoding
+	}
 }
 
-func NewV1Key(prefix string, byteLength int) (string, error) {
+// WithStartChars sets how many characters of the encoded part are revealed in the start of the key.
+// 0 reveals nothing but the prefix, values are clamped to [0, MaxStartChars].
+func WithStartChars(n int) Option {
+	return func(o *options) {
+		o.startChars = clampStartChars(n)
+	}
+}
+
+func clampStartChars(n int) int {
+	if n < 0 {
+		return 0
+	}
+	if n > MaxStartChars {
+		return MaxStartChars
+	}
+	return n
+}
+
+// WithChecksum embeds a checksum in the key, so typos can be detected without a database lookup
+func WithChecksum() Option {
+	return func(o *options) {
+		o.checksum = true
+	}
+}
+
+// NewV1Key creates a new random key, see NewV2Key for keys that always carry a checksum.
+// It also returns the start of the key, which is stored in plaintext so users can identify their keys.
+func NewV1Key(prefix string, byteLength int, opts ...Option) (key string, start string, err error) {
+	o := newOptions(opts)
+
 	if byteLength > 255 {
-		return "", fmt.Errorf("v1 keys can only handle 255 bytes of randomness")
+		return "", "", fmt.Errorf("v1 keys can only handle 255 bytes of randomness")
+	}
+	random, err := randomBytes(byteLength)
+	if err != nil {
+		return "", "", err
+	}
+	k := keyV1{
+		prefix:   prefix,
+		random:   random,
+		encoding: o.encoding,
+		checksum: o.checksum,
+	}
+
+	key, err = k.Marshal()
+	if err != nil {
+		return "", "", err
 	}
-	random := make([]byte, byteLength)
+	return key, startOf(prefix, key, o.startChars), nil
+}
+
+func randomBytes(n int) ([]byte, error) {
+	random := make([]byte, n)
 	read, err := rand.Read(random)
 	if err != nil {
-		return "", fmt.Errorf("unable to read random data")
+		return nil, fmt.Errorf("unable to read random data")
 	}
-	if read != byteLength {
-		return "", fmt.Errorf("unable to read enough random data")
+	if read != n {
+		return nil, fmt.Errorf("unable to read enough random data")
+	}
+	return random, nil
+}
+
+// startOf never returns more than the key itself, even if the encoded part is shorter than startChars
+func startOf(prefix string, key string, startChars int) string {
+	end := StartLength(prefix, startChars)
+	if end > len(key) {
+		end = len(key)
+	}
+	return key[:end]
+}
+
+// StartLength returns the length of the start of keys with the given prefix:
+// the prefix, the separator and the first startChars characters of the encoded part.
+// Keys without a prefix have no separator.
+func StartLength(prefix string, startChars int) int {
+	startChars = clampStartChars(startChars)
+	if prefix == "" {
+		return startChars
 	}
-	key := keyV1{
-		prefix: prefix,
-		random: random,
+	return len(prefix) + len(Separator) + startChars
+}
+
+// Start recomputes the start of a key created by this package, as NewV1Key or NewV2Key would with startChars.
+// Keys in an unknown format, for example imported ones, return an error: we can't tell where their prefix ends.
+func Start(key string, startChars int) (string, error) {
+	prefix, err := parsePrefix(key)
+	if err != nil {
+		return "", err
 	}
+	return startOf(prefix, key, startChars), nil
+}
 
-	return key.Marshal()
+// PrefixFromStart returns the prefix of a key, given the start returned by NewV1Key with the same startChars.
+func PrefixFromStart(start string, startChars int) string {
+	end := len(start) - clampStartChars(startChars) - len(Separator)
+	if end <= 0 || !strings.HasPrefix(start[end:], Separator) {
+		return ""
+	}
+	return start[:end]
+}
 
+// Validate returns false if the key carries a checksum that does not match.
+// Keys without a checksum, or keys not created by this package, can not be checked and are
+// always considered valid.
+func Validate(key string) bool {
+	_, err := ParseVersion(key)
+	return !errors.Is(err, ErrChecksumMismatch)
 }
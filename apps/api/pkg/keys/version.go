@@ -0,0 +1,76 @@
+// Package keys generates and parses api keys.
+//
+// A key is an optional prefix, the Separator and an encoded binary part. The first byte of
+// the binary part is the version of its layout, so a key always tells us how to read it,
+// no matter when it was created. Keys are stored as a hash of the whole string, which means
+// keys of every version verify the same way and old and new keys can live side by side.
+//
+// To change the format, add a new version with its own marshalling, make ParseVersion
+// recognise it and switch the callers that create keys. Existing versions must never change
+// their layout, because keys created with them are out there and can not be reissued by us.
+package keys
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Version identifies the layout of the binary part of a key.
+type Version byte
+
+const (
+	// VersionUnknown is returned for keys that were not created by this package,
+	// for example keys imported from another system.
+	VersionUnknown Version = 0
+	Version1       Version = 1
+	Version2       Version = 2
+)
+
+var encodings = []Encoding{EncodingBase58, EncodingBase62, EncodingBase64Url}
+
+// parsePrefix returns the prefix of a key of any version, it fails like ParseVersion does
+func parsePrefix(key string) (string, error) {
+	for _, encoding := range encodings {
+		v1 := keyV1{encoding: encoding}
+		if v1.Unmarshal(key) == nil {
+			return v1.prefix, nil
+		}
+		v2 := keyV2{encoding: encoding}
+		if v2.Unmarshal(key) == nil {
+			return v2.prefix, nil
+		}
+	}
+	_, err := ParseVersion(key)
+	return "", err
+}
+
+// ParseVersion detects the version of a key from the key itself.
+//
+// If the key carries a checksum that does not match, the version is returned together
+// with ErrChecksumMismatch.
+func ParseVersion(key string) (Version, error) {
+	mismatch := VersionUnknown
+	for _, encoding := range encodings {
+		v1 := keyV1{encoding: encoding}
+		err := v1.Unmarshal(key)
+		if err == nil {
+			return Version1, nil
+		}
+		if errors.Is(err, ErrChecksumMismatch) {
+			mismatch = Version1
+		}
+
+		v2 := keyV2{encoding: encoding}
+		err = v2.Unmarshal(key)
+		if err == nil {
+			return Version2, nil
+		}
+		if errors.Is(err, ErrChecksumMismatch) {
+			mismatch = Version2
+		}
+	}
+	if mismatch != VersionUnknown {
+		return mismatch, ErrChecksumMismatch
+	}
+	return VersionUnknown, fmt.Errorf("unknown key format")
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// databaseStatsCollector reads the connection pool statistics on every scrape
+type databaseStatsCollector struct {
+	stats func() map[string]sql.DBStats
+
+	maxOpen      *prometheus.Desc
+	open         *prometheus.Desc
+	inUse        *prometheus.Desc
+	idle         *prometheus.Desc
+	waitCount    *prometheus.Desc
+	waitDuration *prometheus.Desc
+}
+
+// RegisterDatabaseStats exposes the connection pools returned by stats, labeled by pool name.
+// A growing wait count means verifications are queueing for a connection and the pool is too small.
+func (m *Metrics) RegisterDatabaseStats(stats func() map[string]sql.DBStats) {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "database", name), help, []string{"pool"}, nil)
+	}
+	m.registry.MustRegister(&databaseStatsCollector{
+		stats:        stats,
+		maxOpen:      desc("max_open_connections", "Maximum number of open connections"),
+		open:         desc("open_connections", "Number of established connections, in use and idle"),
+		inUse:        desc("in_use_connections", "Number of connections currently in use"),
+		idle:         desc("idle_connections", "Number of idle connections"),
+		waitCount:    desc("wait_count_total", "Number of times a query waited for a connection"),
+		waitDuration: desc("wait_duration_seconds_total", "Total time spent waiting for a connection"),
+	})
+}
+
+func (c *databaseStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpen
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+}
+
+func (c *databaseStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	for pool, s := range c.stats() {
+		ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(s.MaxOpenConnections), pool)
+		ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(s.OpenConnections), pool)
+		ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(s.InUse), pool)
+		ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(s.Idle), pool)
+		ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(s.WaitCount), pool)
+		ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, s.WaitDuration.Seconds(), pool)
+	}
+}
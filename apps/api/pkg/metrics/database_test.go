@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterDatabaseStats(t *testing.T) {
+	m := New()
+	m.RegisterDatabaseStats(func() map[string]sql.DBStats {
+		return map[string]sql.DBStats{
+			"primary": {MaxOpenConnections: 100, OpenConnections: 7, InUse: 5, Idle: 2, WaitCount: 3, WaitDuration: 1500 * time.Millisecond},
+			"replica": {MaxOpenConnections: 100},
+		}
+	})
+
+	expected := `
+# HELP unkey_database_in_use_connections Number of connections currently in use
+# TYPE unkey_database_in_use_connections gauge
+unkey_database_in_use_connections{pool="primary"} 5
+unkey_database_in_use_connections{pool="replica"} 0
+# HELP unkey_database_wait_duration_seconds_total Total time spent waiting for a connection
+# TYPE unkey_database_wait_duration_seconds_total counter
+unkey_database_wait_duration_seconds_total{pool="primary"} 1.5
+unkey_database_wait_duration_seconds_total{pool="replica"} 0
+`
+	err := promtestutil.GatherAndCompare(m.registry, strings.NewReader(expected), "unkey_database_in_use_connections", "unkey_database_wait_duration_seconds_total")
+	require.NoError(t, err)
+
+	count, err := promtestutil.GatherAndCount(m.registry, "unkey_database_max_open_connections", "unkey_database_wait_count_total")
+	require.NoError(t, err)
+	require.Equal(t, 4, count)
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "unkey"
+
+// DefaultMaxApiLabels is how many apis KeyVerificationsByApi counts on their own, see SetMaxApiLabels
+const DefaultMaxApiLabels = 1000
+
+// OtherApis is the apiId label that verifications of apis beyond the cap are counted under
+const OtherApis = "other"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	KeysCreated prometheus.Counter
+	// Labeled by outcome, e.g. "valid", "expired", "ratelimited", "usage_exceeded"
+	KeyVerifications *prometheus.CounterVec
+	// Labeled by the name of the database method
+	DatabaseLatency *prometheus.HistogramVec
+	// Labeled by apiId and outcome, only verifications of keys whose api was found are counted.
+	// Use CountApiVerification, it caps the number of apiId labels
+	KeyVerificationsByApi *prometheus.CounterVec
+
+	apisMu sync.Mutex
+	// the apis that have a label of their own
+	apis    map[string]bool
+	maxApis int
+}
+
+// New creates all collectors and registers them on a fresh registry.
+func New() *Metrics {
+	registry := prometheus.NewRegistry()
+
+	m := &Metrics{
+		registry: registry,
+		KeysCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "keys_created_total",
+			Help:      "Number of keys created",
+		}),
+		KeyVerifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "key_verifications_total",
+			Help:      "Number of key verifications by outcome",
+		}, []string{"outcome"}),
+		DatabaseLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "database_latency_seconds",
+			Help:      "Latency of database calls by method",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"method"}),
+		KeyVerificationsByApi: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "key_verifications_by_api_total",
+			Help:      "Number of key verifications by api and outcome",
+		}, []string{"apiId", "outcome"}),
+		apis:    map[string]bool{},
+		maxApis: DefaultMaxApiLabels,
+	}
+
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.KeysCreated,
+		m.KeyVerifications,
+		m.DatabaseLatency,
+		m.KeyVerificationsByApi,
+	)
+
+	return m
+}
+
+// SetMaxApiLabels changes how many apis are counted on their own in KeyVerificationsByApi.
+// Every api adds a series per outcome, so the first max apis that are verified get a label
+// and all later ones are counted together as OtherApis until the process restarts.
+// A max of 0 or less uses DefaultMaxApiLabels.
+func (m *Metrics) SetMaxApiLabels(max int) {
+	if max <= 0 {
+		max = DefaultMaxApiLabels
+	}
+	m.apisMu.Lock()
+	defer m.apisMu.Unlock()
+	m.maxApis = max
+}
+
+// CountApiVerification counts the outcome of a verification of a key of the api
+func (m *Metrics) CountApiVerification(apiId string, outcome string) {
+	m.KeyVerificationsByApi.WithLabelValues(m.apiLabel(apiId), outcome).Inc()
+}
+
+func (m *Metrics) apiLabel(apiId string) string {
+	m.apisMu.Lock()
+	defer m.apisMu.Unlock()
+	if m.apis[apiId] {
+		return apiId
+	}
+	if len(m.apis) >= m.maxApis {
+		return OtherApis
+	}
+	m.apis[apiId] = true
+	return apiId
+}
+
+// Handler serves all registered metrics in the prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
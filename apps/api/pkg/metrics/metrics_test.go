@@ -0,0 +1,27 @@
+package metrics
+
+import (
+	"testing"
+
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountApiVerification_CapsApis(t *testing.T) {
+	m := New()
+	m.SetMaxApiLabels(2)
+
+	m.CountApiVerification("api_1", "valid")
+	m.CountApiVerification("api_2", "valid")
+	m.CountApiVerification("api_3", "valid")
+	m.CountApiVerification("api_4", "disabled")
+	// apis that already have a label keep it
+	m.CountApiVerification("api_1", "ratelimited")
+
+	require.Equal(t, float64(1), promtestutil.ToFloat64(m.KeyVerificationsByApi.WithLabelValues("api_1", "valid")))
+	require.Equal(t, float64(1), promtestutil.ToFloat64(m.KeyVerificationsByApi.WithLabelValues("api_1", "ratelimited")))
+	require.Equal(t, float64(1), promtestutil.ToFloat64(m.KeyVerificationsByApi.WithLabelValues("api_2", "valid")))
+	require.Equal(t, float64(1), promtestutil.ToFloat64(m.KeyVerificationsByApi.WithLabelValues(OtherApis, "valid")))
+	require.Equal(t, float64(1), promtestutil.ToFloat64(m.KeyVerificationsByApi.WithLabelValues(OtherApis, "disabled")))
+	require.Equal(t, 5, promtestutil.CollectAndCount(m.KeyVerificationsByApi))
+}
@@ -9,6 +9,19 @@ type RatelimitRequest struct {
 	Max            int64
 	RefillRate     int64
 	RefillInterval int64
+	// Cost is how many tokens are taken at once, 0 means 1.
+	// Either all of them are taken or, if there are not enough left, none.
+	Cost int64
+	// Peek only checks whether the tokens are available, without taking them
+	Peek bool
+}
+
+// cost returns how many tokens the request takes
+func (r RatelimitRequest) cost() int64 {
+	if r.Cost <= 0 {
+		return 1
+	}
+	return r.Cost
 }
 
 type RatelimitResponse struct {
@@ -37,7 +37,7 @@ func newBucket(refillRate int64, refillInterval int64, max int64) *bucket {
 	}
 }
 
-func (b *bucket) take() RatelimitResponse {
+func (b *bucket) take(cost int64, peek bool) RatelimitResponse {
 	now := time.Now().UnixMilli()
 
 	// The number of the window since bucket creation
@@ -56,16 +56,18 @@ func (b *bucket) take() RatelimitResponse {
 		b.lastTick = tick
 	}
 
-	if b.remaining <= 0 {
+	if b.remaining < cost {
 		return RatelimitResponse{
 			Pass:      false,
 			Limit:     b.max,
-			Remaining: 0,
+			Remaining: b.remaining,
 			Reset:     reset,
 		}
 	}
 
-	b.remaining -= 1
+	if !peek {
+		b.remaining -= cost
+	}
 	return RatelimitResponse{
 		Pass:      true,
 		Limit:     b.max,
@@ -117,7 +119,7 @@ func (r *inMemory) Take(req RatelimitRequest) RatelimitResponse {
 	b, ok := r.state[req.Identifier]
 	r.stateLock.RUnlock()
 	if ok {
-		return b.take()
+		return b.take(req.cost(), req.Peek)
 	}
 
 	r.stateLock.Lock()
@@ -125,13 +127,13 @@ func (r *inMemory) Take(req RatelimitRequest) RatelimitResponse {
 	b, ok = r.state[req.Identifier]
 	if ok {
 		r.stateLock.Unlock()
-		return b.take()
+		return b.take(req.cost(), req.Peek)
 	}
 
 	b = newBucket(req.RefillRate, req.RefillInterval, req.Max)
 	r.state[req.Identifier] = b
 	r.stateLock.Unlock()
 
-	return b.take()
+	return b.take(req.cost(), req.Peek)
 
 }
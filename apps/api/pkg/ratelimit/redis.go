@@ -35,68 +35,65 @@ func NewRedis(config RedisConfig) (*redisRateLimiter, error) {
 		redis:  r,
 		logger: config.Logger,
 		script: goredis.NewScript(`
-	 local key             = KEYS[1]           -- identifier including prefixes
+    local key             = KEYS[1]           -- identifier including prefixes
     local maxTokens       = tonumber(ARGV[1]) -- maximum number of tokens
     local interval        = tonumber(ARGV[2]) -- size of the window in milliseconds
     local refillRate      = tonumber(ARGV[3]) -- how many tokens are refilled after each interval
     local now             = tonumber(ARGV[4]) -- current timestamp in milliseconds
     local requestedTokens = tonumber(ARGV[5]) -- how many tokens are requested for this operation
-    local remaining   = 0
+    local peek            = tonumber(ARGV[6]) -- 1 to only check whether the tokens are available
 
-    local bucket = redis.call("HMGET", key, "updatedAt", "tokens")
-
-    if bucket[1] == false then
-      -- The bucket does not exist yet, so we create it.
-      remaining = maxTokens - requestedTokens
-
-      redis.call("HMSET", key, "updatedAt", now, "tokens", remaining)
+    local tokens = maxTokens
+    local updatedAt = now
 
-      return {remaining, now + interval}
+    local bucket = redis.call("HMGET", key, "updatedAt", "tokens")
+    if bucket[1] ~= false then
+      updatedAt = tonumber(bucket[1])
+      tokens = tonumber(bucket[2])
+
+      if now >= updatedAt + interval then
+        local numberOfRefills = math.floor((now - updatedAt)/interval)
+        -- buckets written by older versions may be negative
+        tokens = math.min(maxTokens, math.max(tokens, 0) + numberOfRefills * refillRate)
+        updatedAt = updatedAt + numberOfRefills * interval
+      end
     end
 
-    local updatedAt = tonumber(bucket[1])
-    local tokens = tonumber(bucket[2])
-
-    if now >= updatedAt + interval then
-      local numberOfRefills = math.floor((now - updatedAt)/interval)
-
-      if tokens <= 0 then
-        -- No more tokens were left before the refill.
-        remaining = math.min(maxTokens, numberOfRefills * refillRate) - requestedTokens
-      else
-        remaining = math.min(maxTokens, tokens + numberOfRefills * refillRate) - requestedTokens
+    -- all requested tokens or none
+    local pass = 0
+    if tokens >= requestedTokens then
+      pass = 1
+      if peek == 0 then
+        tokens = tokens - requestedTokens
       end
-
-      local lastRefill = updatedAt + numberOfRefills * interval
-
-      redis.call("HMSET", key, "updatedAt", lastRefill, "tokens", remaining)
-      return {remaining, lastRefill + interval}
     end
 
-  remaining = tokens - requestedTokens
-  redis.call("HSET", key, "tokens", remaining)
-  return {remaining, updatedAt + interval}
-
-
+    redis.call("HMSET", key, "updatedAt", updatedAt, "tokens", tokens)
+    return {tokens, updatedAt + interval, pass}
 		`),
 	}, nil
 
 }
 
 func (r *redisRateLimiter) Take(req RatelimitRequest) RatelimitResponse {
+	peek := 0
+	if req.Peek {
+		peek = 1
+	}
 
-	rawResponse, err := r.script.EvalSha(context.Background(), r.redis, []string{
+	rawResponse, err := r.script.Run(context.Background(), r.redis, []string{
 		req.Identifier,
 	},
 		req.Max,
 		req.RefillInterval,
 		req.RefillRate,
-		time.Now(),
-		1,
+		time.Now().UnixMilli(),
+		req.cost(),
+		peek,
 	).Result()
 
 	if err != nil {
-		r.logger.Error("unable to eval sha", zap.Error(err))
+		r.logger.Error("unable to run ratelimit script", zap.Error(err))
 		return RatelimitResponse{
 			Pass:      false,
 			Limit:     -1,
@@ -105,8 +102,8 @@ func (r *redisRateLimiter) Take(req RatelimitRequest) RatelimitResponse {
 		}
 	}
 
-	res, ok := rawResponse.([]int64)
-	if !ok {
+	res, ok := rawResponse.([]interface{})
+	if !ok || len(res) != 3 {
 		return RatelimitResponse{
 			Pass:      false,
 			Limit:     -1,
@@ -115,11 +112,14 @@ func (r *redisRateLimiter) Take(req RatelimitRequest) RatelimitResponse {
 		}
 	}
 
+	remaining, _ := res[0].(int64)
+	reset, _ := res[1].(int64)
+	pass, _ := res[2].(int64)
 	return RatelimitResponse{
-		Pass:      res[0] > 0,
+		Pass:      pass == 1,
 		Limit:     req.Max,
-		Remaining: res[0],
-		Reset:     res[1],
+		Remaining: remaining,
+		Reset:     reset,
 	}
 
 }
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/service"
+)
+
+type CreateApiRequest struct {
+	Name        string   `json:"name" validate:"required,max=256"`
+	IpWhitelist []string `json:"ipWhitelist,omitempty"`
+	// Optional JSON Schema the meta of every key of the api must match
+	MetaSchema json.RawMessage `json:"metaSchema,omitempty"`
+	// Optional top level keys the meta of every key of the api may have, every key is allowed if empty
+	AllowedMetaKeys []string `json:"allowedMetaKeys,omitempty"`
+	// Optional prefix of keys created for the api without one
+	Prefix string `json:"prefix,omitempty" validate:"max=256"`
+}
+
+type CreateApiResponse struct {
+	ApiId     string `json:"apiId"`
+	KeyAuthId string `json:"keyAuthId"`
+}
+
+// createApiWithKeyAuth creates an api that can accept keys immediately, apis created without a
+// keyAuth reject every key creation.
+func (s *Server) createApiWithKeyAuth(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.createApiWithKeyAuth")
+	defer span.End()
+
+	req := CreateApiRequest{}
+	err := c.BodyParser(&req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+	}
+
+	err = s.validator.Struct(req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to validate body: %s", err.Error()))
+	}
+
+	authKey, err := s.authenticateRootKey(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	err = requireScope(authKey, entities.ScopeApisManage)
+	if err != nil {
+		return err
+	}
+
+	err = s.validatePrefix(req.Prefix)
+	if err != nil {
+		return err
+	}
+
+	api, err := s.service.CreateApi(ctx, authKey.ForWorkspaceId, service.CreateApiParams{
+		Name:            req.Name,
+		IpWhitelist:     req.IpWhitelist,
+		MetaSchema:      req.MetaSchema,
+		AllowedMetaKeys: req.AllowedMetaKeys,
+		Prefix:          req.Prefix,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.setConsistencyToken(c)
+	return c.JSON(CreateApiResponse{
+		ApiId:     api.Id,
+		KeyAuthId: api.KeyAuthId,
+	})
+}
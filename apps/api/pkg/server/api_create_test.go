@@ -0,0 +1,68 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+func TestCreateApiWithKeyAuth(t *testing.T) {
+	db := newMemoryDatabase()
+	srv := newTestServer(t, withDatabase(db))
+
+	testCases := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "missing name", body: `{}`, status: 400},
+		{name: "invalid ip", body: `{"name":"my api","ipWhitelist":["localhost"]}`, status: 400},
+		{name: "valid", body: `{"name":"my api","ipWhitelist":["1.1.1.1"]}`, status: 200},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/apis.createWithKeyAuth", bytes.NewBufferString(tc.body))
+			req.Header.Set("Authorization", "Bearer root_key")
+			req.Header.Set("Content-Type", "application/json")
+
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.status, res.StatusCode)
+
+			if tc.status == 200 {
+				body, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+				created := CreateApiResponse{}
+				require.NoError(t, json.Unmarshal(body, &created))
+				api := db.api(created.ApiId)
+				require.Equal(t, "ws_1", api.WorkspaceId)
+				require.Equal(t, created.KeyAuthId, api.KeyAuthId)
+				require.Equal(t, "ws_1", db.keyAuths[created.KeyAuthId].WorkspaceId)
+			}
+		})
+	}
+
+	// the fixture and the created one
+	require.Len(t, db.apis, 2)
+}
+
+func TestCreateApiWithKeyAuth_MissingScope(t *testing.T) {
+	db := newMemoryDatabase()
+	db.addRootKey("scoped_key", testWorkspaceId, entities.ScopeApisRead)
+	srv := newTestServer(t, withDatabase(db))
+
+	req := httptest.NewRequest("POST", "/v1/apis.createWithKeyAuth", bytes.NewBufferString(`{"name":"my api"}`))
+	req.Header.Set("Authorization", "Bearer scoped_key")
+	req.Header.Set("Content-Type", "application/json")
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 403, res.StatusCode)
+	require.Zero(t, db.callsOf("CreateApiWithKeyAuth"))
+}
@@ -1,12 +1,14 @@
 package server
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
 )
 
 type GetApiRequest struct {
@@ -18,6 +20,12 @@ type GetApiResponse struct {
 	Name        string   `json:"name"`
 	WorkspaceId string   `json:"workspaceId"`
 	IpWhitelist []string `json:"ipWhitelist,omitempty"`
+	// The JSON Schema the meta of the api's keys must match
+	MetaSchema json.RawMessage `json:"metaSchema,omitempty"`
+	// The top level keys the meta of the api's keys may have
+	AllowedMetaKeys []string `json:"allowedMetaKeys,omitempty"`
+	// The prefix of keys created for the api without one
+	Prefix string `json:"prefix,omitempty"`
 }
 
 func (s *Server) getApi(c *fiber.Ctx) error {
@@ -31,55 +39,55 @@ func (s *Server) getApi(c *fiber.Ctx) error {
 	err := s.validator.Struct(req)
 	if err != nil {
 		return c.Status(http.StatusBadRequest).JSON(ErrorResponse{
-			Code:  BAD_REQUEST,
-			Error: fmt.Sprintf("unable to validate request: %s", err.Error()),
+			Code:      BAD_REQUEST,
+			Error:     fmt.Sprintf("unable to validate request: %s", err.Error()),
+			RequestId: requestId(c),
 		})
 	}
 
-	authHash, err := getKeyHash(c.Get("Authorization"))
+	authKey, err := s.authenticateRootKey(ctx, c)
 	if err != nil {
 		return err
 	}
 
-	authKey, err := s.db.GetKeyByHash(ctx, authHash)
+	err = requireScope(authKey, entities.ScopeApisRead)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: fmt.Sprintf("unable to find key: %s", err.Error()),
-		})
-	}
-
-	if authKey.ForWorkspaceId == "" {
-		return c.Status(http.StatusBadRequest).JSON(ErrorResponse{
-			Code:  BAD_REQUEST,
-			Error: "wrong key type",
-		})
+		return err
 	}
 
 	api, err := s.db.GetApi(ctx, req.ApiId)
 	if err != nil {
 		if errors.Is(err, database.ErrNotFound) {
 			return c.Status(http.StatusNotFound).JSON(ErrorResponse{
-				Code:  NOT_FOUND,
-				Error: fmt.Sprintf("unable to find api: %s", req.ApiId),
+				Code:      NOT_FOUND,
+				Error:     fmt.Sprintf("unable to find api: %s", req.ApiId),
+				RequestId: requestId(c),
 			})
 		}
 		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: fmt.Sprintf("unable to find api: %s", err.Error()),
+			Code:      INTERNAL_SERVER_ERROR,
+			Error:     fmt.Sprintf("unable to find api: %s", err.Error()),
+			RequestId: requestId(c),
 		})
 	}
 	if api.WorkspaceId != authKey.ForWorkspaceId {
 		return c.Status(http.StatusUnauthorized).JSON(ErrorResponse{
-			Code:  UNAUTHORIZED,
-			Error: "access to workspace denied",
+			Code:      UNAUTHORIZED,
+			Error:     "access to workspace denied",
+			RequestId: requestId(c),
 		})
 	}
 
-	return c.JSON(GetApiResponse{
-		Id:          api.Id,
-		Name:        api.Name,
-		WorkspaceId: api.WorkspaceId,
-		IpWhitelist: api.IpWhitelist,
-	})
+	res := GetApiResponse{
+		Id:              api.Id,
+		Name:            api.Name,
+		WorkspaceId:     api.WorkspaceId,
+		IpWhitelist:     api.IpWhitelist,
+		AllowedMetaKeys: api.AllowedMetaKeys,
+		Prefix:          api.Prefix,
+	}
+	if api.MetaSchema != "" {
+		res.MetaSchema = json.RawMessage(api.MetaSchema)
+	}
+	return c.JSON(res)
 }
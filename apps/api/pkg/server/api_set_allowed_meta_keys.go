@@ -0,0 +1,76 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/service"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type SetApiAllowedMetaKeysRequest struct {
+	ApiId string `json:"apiId" validate:"required"`
+	// Top level keys the meta of new and updated keys may have, empty or `null` allows every key
+	AllowedMetaKeys []string `json:"allowedMetaKeys"`
+}
+
+type SetApiAllowedMetaKeysResponse struct{}
+
+// setApiAllowedMetaKeys replaces the meta keys an api allows. Like the meta schema, existing keys are not
+// checked, their meta is only validated the next time it changes.
+func (s *Server) setApiAllowedMetaKeys(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.setApiAllowedMetaKeys")
+	defer span.End()
+
+	req := SetApiAllowedMetaKeysRequest{}
+	err := c.BodyParser(&req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+	}
+
+	err = s.validator.Struct(req)
+	if err != nil {
+		return validationError(err)
+	}
+
+	allowedMetaKeys, err := service.ParseAllowedMetaKeys(req.AllowedMetaKeys)
+	if err != nil {
+		return err
+	}
+
+	authKey, err := s.authenticateRootKey(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	err = requireScope(authKey, entities.ScopeApisManage)
+	if err != nil {
+		return err
+	}
+
+	api, err := s.db.GetApi(ctx, req.ApiId)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return errs.NewNotFound(fmt.Sprintf("unable to find api: %s", req.ApiId))
+		}
+		return errs.NewInternal(err, "unable to find api")
+	}
+	if api.WorkspaceId != authKey.ForWorkspaceId {
+		return errs.NewUnauthorized("access to workspace denied")
+	}
+	span.SetAttributes(attribute.String("apiId", api.Id))
+
+	err = s.db.SetApiAllowedMetaKeys(ctx, api.Id, allowedMetaKeys)
+	if err != nil {
+		return errs.NewInternal(err, "unable to set allowed meta keys")
+	}
+	if api.KeyAuthId != "" {
+		s.apiCache.Remove(ctx, api.KeyAuthId)
+	}
+
+	return c.JSON(SetApiAllowedMetaKeysResponse{})
+}
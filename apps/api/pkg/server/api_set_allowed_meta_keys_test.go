@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+func TestSetApiAllowedMetaKeys(t *testing.T) {
+	db := newMemoryDatabase()
+	db.addKey("some_key", entities.Key{Id: "key_1", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Meta: map[string]any{"plan": "pro"}})
+	srv := newTestServer(t, withDatabase(db))
+
+	status, _ := postJSON(t, srv, "/v1/apis.setAllowedMetaKeys", `{"apiId":"api_1","allowedMetaKeys":["plan","seats"]}`)
+	require.Equal(t, 200, status)
+	require.Equal(t, []string{"plan", "seats"}, db.api("api_1").AllowedMetaKeys)
+
+	status, errorResponse := postJSON(t, srv, "/v1/apis.setAllowedMetaKeys", `{"apiId":"api_1","allowedMetaKeys":["plan","plan"]}`)
+	require.Equal(t, 400, status)
+	require.Contains(t, errorResponse.Error, "'allowedMetaKeys[1]' is a duplicate of 'plan'")
+	require.Equal(t, []string{"plan", "seats"}, db.api("api_1").AllowedMetaKeys)
+
+	status, _ = postJSON(t, srv, "/v1/apis.setAllowedMetaKeys", `{"apiId":"api_1","allowedMetaKeys":["a,b"]}`)
+	require.Equal(t, 400, status)
+
+	status, _ = postJSON(t, srv, "/v1/apis.setAllowedMetaKeys", `{"apiId":"api_2","allowedMetaKeys":null}`)
+	require.Equal(t, 404, status)
+
+	status, _ = postJSON(t, srv, "/v1/apis.setAllowedMetaKeys", `{"apiId":"api_1","allowedMetaKeys":null}`)
+	require.Equal(t, 200, status)
+	require.Empty(t, db.api("api_1").AllowedMetaKeys)
+}
+
+func TestUpdateKeyMeta_AllowedMetaKeys(t *testing.T) {
+	db := newMemoryDatabase()
+	db.addKey("some_key", entities.Key{Id: "key_1", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Meta: map[string]any{"plan": "pro"}})
+	srv := newTestServer(t, withDatabase(db))
+	require.NoError(t, db.SetApiAllowedMetaKeys(context.Background(), "api_1", []string{"plan", "seats"}))
+
+	status, _ := postJSON(t, srv, "/v1/keys.updateMeta", `{"keyId":"key_1","mode":"merge","meta":{"seats":3}}`)
+	require.Equal(t, 200, status)
+	require.Equal(t, float64(3), db.keys["key_1"].Meta["seats"])
+
+	status, errorResponse := postJSON(t, srv, "/v1/keys.updateMeta", `{"keyId":"key_1","mode":"merge","meta":{"team":"a","email":"b"}}`)
+	require.Equal(t, 400, status)
+	require.Equal(t, BAD_REQUEST, errorResponse.Code)
+	require.Equal(t, []errs.FieldError{
+		{Field: "meta.email", Constraint: "allowedMetaKeys", Message: "'meta.email' is not an allowed meta key"},
+		{Field: "meta.team", Constraint: "allowedMetaKeys", Message: "'meta.team' is not an allowed meta key"},
+	}, errorResponse.Errors)
+	require.NotContains(t, db.keys["key_1"].Meta, "team")
+
+	// removing the restriction allows every key again
+	require.NoError(t, db.SetApiAllowedMetaKeys(context.Background(), "api_1", nil))
+	status, _ = postJSON(t, srv, "/v1/keys.updateMeta", `{"keyId":"key_1","mode":"merge","meta":{"team":"a"}}`)
+	require.Equal(t, 200, status)
+	require.Equal(t, "a", db.keys["key_1"].Meta["team"])
+}
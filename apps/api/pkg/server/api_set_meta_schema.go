@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/service"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type SetApiMetaSchemaRequest struct {
+	ApiId string `json:"apiId" validate:"required"`
+	// JSON Schema the meta of new and updated keys must match, `null` removes it
+	MetaSchema json.RawMessage `json:"metaSchema"`
+}
+
+type SetApiMetaSchemaResponse struct{}
+
+// setApiMetaSchema replaces the meta schema of an api. Existing keys are not checked, their meta is only
+// validated against the schema the next time it changes.
+func (s *Server) setApiMetaSchema(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.setApiMetaSchema")
+	defer span.End()
+
+	req := SetApiMetaSchemaRequest{}
+	err := c.BodyParser(&req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+	}
+
+	err = s.validator.Struct(req)
+	if err != nil {
+		return validationError(err)
+	}
+
+	metaSchema, err := service.ParseMetaSchema(req.MetaSchema)
+	if err != nil {
+		return err
+	}
+
+	authKey, err := s.authenticateRootKey(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	err = requireScope(authKey, entities.ScopeApisManage)
+	if err != nil {
+		return err
+	}
+
+	api, err := s.db.GetApi(ctx, req.ApiId)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return errs.NewNotFound(fmt.Sprintf("unable to find api: %s", req.ApiId))
+		}
+		return errs.NewInternal(err, "unable to find api")
+	}
+	if api.WorkspaceId != authKey.ForWorkspaceId {
+		return errs.NewUnauthorized("access to workspace denied")
+	}
+	span.SetAttributes(attribute.String("apiId", api.Id))
+
+	err = s.db.SetApiMetaSchema(ctx, api.Id, metaSchema)
+	if err != nil {
+		return errs.NewInternal(err, "unable to set meta schema")
+	}
+	if api.KeyAuthId != "" {
+		s.apiCache.Remove(ctx, api.KeyAuthId)
+	}
+
+	return c.JSON(SetApiMetaSchemaResponse{})
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+func postJSON(t *testing.T, srv *Server, path string, body string) (int, ErrorResponse) {
+	t.Helper()
+	req := httptest.NewRequest("POST", path, bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer root_key")
+	req.Header.Set("Content-Type", "application/json")
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	srv.background.Wait()
+
+	errorResponse := ErrorResponse{}
+	if res.StatusCode != 200 {
+		buf, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(buf, &errorResponse))
+	}
+	return res.StatusCode, errorResponse
+}
+
+func TestSetApiMetaSchema(t *testing.T) {
+	db := newMemoryDatabase()
+	db.addKey("some_key", entities.Key{Id: "key_1", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Meta: map[string]any{"plan": "pro"}})
+	srv := newTestServer(t, withDatabase(db))
+
+	status, _ := postJSON(t, srv, "/v1/apis.setMetaSchema", `{"apiId":"api_1","metaSchema":{"type":"object", "required":["plan"]}}`)
+	require.Equal(t, 200, status)
+	require.Equal(t, `{"type":"object","required":["plan"]}`, db.api("api_1").MetaSchema)
+
+	status, errorResponse := postJSON(t, srv, "/v1/apis.setMetaSchema", `{"apiId":"api_1","metaSchema":{"oneOf":[]}}`)
+	require.Equal(t, 400, status)
+	require.Contains(t, errorResponse.Error, "'oneOf' keyword is not supported")
+	require.NotEmpty(t, db.api("api_1").MetaSchema)
+
+	status, _ = postJSON(t, srv, "/v1/apis.setMetaSchema", `{"apiId":"api_2","metaSchema":null}`)
+	require.Equal(t, 404, status)
+
+	status, _ = postJSON(t, srv, "/v1/apis.setMetaSchema", `{"apiId":"api_1","metaSchema":null}`)
+	require.Equal(t, 200, status)
+	require.Equal(t, "", db.api("api_1").MetaSchema)
+}
+
+func TestUpdateKeyMeta_MetaSchema(t *testing.T) {
+	db := newMemoryDatabase()
+	db.addKey("some_key", entities.Key{Id: "key_1", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Meta: map[string]any{"plan": "pro"}})
+	srv := newTestServer(t, withDatabase(db))
+	require.NoError(t, db.SetApiMetaSchema(context.Background(), "api_1", `{"type":"object","required":["plan"],"properties":{"plan":{"type":"string"}}}`))
+
+	status, _ := postJSON(t, srv, "/v1/keys.updateMeta", `{"keyId":"key_1","mode":"merge","meta":{"plan":"enterprise"}}`)
+	require.Equal(t, 200, status)
+	require.Equal(t, "enterprise", db.keys["key_1"].Meta["plan"])
+
+	status, errorResponse := postJSON(t, srv, "/v1/keys.updateMeta", `{"keyId":"key_1","mode":"replace","meta":{"seats":3}}`)
+	require.Equal(t, 400, status)
+	require.Equal(t, BAD_REQUEST, errorResponse.Code)
+	require.Equal(t, []errs.FieldError{
+		{Field: "meta.plan", Constraint: "required", Message: "'meta.plan' is required"},
+	}, errorResponse.Errors)
+	require.Equal(t, "enterprise", db.keys["key_1"].Meta["plan"])
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+	"go.uber.org/zap"
+)
+
+// caller is where a request comes from, each transport fills it from its own metadata
+type caller struct {
+	// ip of the client, forwarding headers are only honoured from trusted proxies
+	ip string
+}
+
+func httpCaller(c *fiber.Ctx) caller {
+	return caller{ip: ClientIpFromContext(c.UserContext())}
+}
+
+// appendAuditLog stores the entry in the background, so handlers don't wait for the write.
+// Shutdown waits for all pending entries before closing the database.
+func (s *Server) appendAuditLog(ctx context.Context, c *fiber.Ctx, entry audit.Entry) {
+	s.appendAuditLogFrom(ctx, httpCaller(c), entry)
+}
+
+// appendAuditLogFrom is appendAuditLog for code that is shared between transports.
+func (s *Server) appendAuditLogFrom(ctx context.Context, from caller, entry audit.Entry) {
+	entry.Id = uid.AuditLog()
+	entry.Time = time.Now()
+	entry.Ip = from.ip
+
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		err := s.db.AppendAuditLog(detach(ctx), entry)
+		if err != nil {
+			s.logger.Error("unable to append audit log", zap.Error(err), zap.String("action", string(entry.Action)), zap.String("targetKeyId", entry.TargetKeyId))
+		}
+	}()
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+type ListAuditLogsRequest struct {
+	// Start and End are unix timestamps in milliseconds, 0 means unbounded
+	Start   int64 `validate:"min=0"`
+	End     int64 `validate:"min=0"`
+	Actions []audit.Action
+	Limit   int `validate:"min=1,max=1000"`
+}
+
+type auditLogResponse struct {
+	Id          string       `json:"id"`
+	ActorKeyId  string       `json:"actorKeyId,omitempty"`
+	Action      audit.Action `json:"action"`
+	TargetKeyId string       `json:"targetKeyId,omitempty"`
+	Time        int64        `json:"time"`
+	Ip          string       `json:"ip,omitempty"`
+	Reason      string       `json:"reason,omitempty"`
+}
+
+type ListAuditLogsResponse struct {
+	Logs []auditLogResponse `json:"logs"`
+}
+
+func (s *Server) listAuditLogs(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.listAuditLogs")
+	defer span.End()
+
+	req := ListAuditLogsRequest{
+		Start: int64(c.QueryInt("start", 0)),
+		End:   int64(c.QueryInt("end", 0)),
+		Limit: c.QueryInt("limit", 100),
+	}
+	// actions can be passed comma separated: ?action=key.created,key.deleted
+	if actions := c.Query("action"); actions != "" {
+		for _, a := range strings.Split(actions, ",") {
+			action := audit.Action(strings.TrimSpace(a))
+			if !action.Valid() {
+				return errs.NewBadRequest(fmt.Sprintf("unknown action: %s", action))
+			}
+			req.Actions = append(req.Actions, action)
+		}
+	}
+
+	err := s.validator.Struct(req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to validate request: %s", err.Error()))
+	}
+	if req.Start > 0 && req.End > 0 && req.End <= req.Start {
+		return errs.NewBadRequest("'end' must be after 'start'")
+	}
+
+	authKey, err := s.authenticateRootKey(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	err = requireScope(authKey, entities.ScopeAuditRead)
+	if err != nil {
+		return err
+	}
+
+	filter := audit.Filter{
+		Actions: req.Actions,
+		Limit:   req.Limit,
+	}
+	if req.Start > 0 {
+		filter.Start = time.UnixMilli(req.Start)
+	}
+	if req.End > 0 {
+		filter.End = time.UnixMilli(req.End)
+	}
+
+	entries, err := s.db.ListAuditLogs(ctx, authKey.ForWorkspaceId, filter)
+	if err != nil {
+		return errs.NewInternal(err, "unable to list audit logs")
+	}
+
+	res := ListAuditLogsResponse{
+		Logs: make([]auditLogResponse, len(entries)),
+	}
+	for i, e := range entries {
+		res.Logs[i] = auditLogResponse{
+			Id:          e.Id,
+			ActorKeyId:  e.ActorKeyId,
+			Action:      e.Action,
+			TargetKeyId: e.TargetKeyId,
+			Time:        e.Time.UnixMilli(),
+			Ip:          e.Ip,
+			Reason:      e.Reason,
+		}
+	}
+	return c.JSON(res)
+}
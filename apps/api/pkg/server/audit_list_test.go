@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
+)
+
+func TestListAuditLogs(t *testing.T) {
+	now := time.UnixMilli(time.Now().UnixMilli())
+	db := newMemoryDatabase()
+	db.auditLogs = []audit.Entry{
+		{Id: "audit_1", WorkspaceId: "ws_1", ActorKeyId: "key_root", Action: audit.KeyDeleted, TargetKeyId: "key_1", Time: now, Ip: "127.0.0.1"},
+		// each is excluded by the filter
+		{Id: "audit_2", WorkspaceId: "ws_1", ActorKeyId: "key_root", Action: audit.KeyUpdated, TargetKeyId: "key_1", Time: now},
+		{Id: "audit_3", WorkspaceId: "ws_1", ActorKeyId: "key_root", Action: audit.KeyCreated, TargetKeyId: "key_1", Time: now.Add(-2 * time.Hour)},
+		{Id: "audit_4", WorkspaceId: "ws_2", ActorKeyId: "key_other", Action: audit.KeyDeleted, TargetKeyId: "key_2", Time: now},
+	}
+	srv := newTestServer(t, withDatabase(db))
+
+	start := now.Add(-time.Hour).UnixMilli()
+	end := now.Add(time.Hour).UnixMilli()
+	req := httptest.NewRequest("GET", fmt.Sprintf("/v1/audit.list?action=key.deleted,key.created&limit=10&start=%d&end=%d", start, end), nil)
+	req.Header.Set("Authorization", "Bearer root_key")
+
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 200, res.StatusCode)
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	listRes := ListAuditLogsResponse{}
+	require.NoError(t, json.Unmarshal(body, &listRes))
+	require.Len(t, listRes.Logs, 1)
+	require.Equal(t, "audit_1", listRes.Logs[0].Id)
+	require.Equal(t, audit.KeyDeleted, listRes.Logs[0].Action)
+	require.Equal(t, now.UnixMilli(), listRes.Logs[0].Time)
+}
+
+func TestListAuditLogs_RejectsInvalidFilters(t *testing.T) {
+	srv := newTestServer(t)
+
+	for _, query := range []string{
+		"action=key.renamed",
+		"start=2000&end=1000",
+		"limit=0",
+		"limit=1001",
+		"start=-1",
+	} {
+		req := httptest.NewRequest("GET", "/v1/audit.list?"+query, nil)
+		req.Header.Set("Authorization", "Bearer root_key")
+
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, 400, res.StatusCode, query)
+	}
+}
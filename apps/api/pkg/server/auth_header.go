@@ -0,0 +1,68 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+// apiKeyHeader carries the key for clients that can not set the Authorization header
+const apiKeyHeader = "X-API-Key"
+
+// requestKey returns the key a request is authenticated with, in this order of precedence:
+//
+//	Authorization: Bearer <key>
+//	Authorization: <key>
+//	X-API-Key: <key>
+func requestKey(c *fiber.Ctx) (string, error) {
+	return parseKeyHeaders(c.Get(fiber.HeaderAuthorization), c.Get(apiKeyHeader))
+}
+
+// verifyRequestKey is requestKey for verifications of keys that are not in the body,
+// its error also names the body if the key is missing everywhere.
+func verifyRequestKey(c *fiber.Ctx) (string, error) {
+	if strings.TrimSpace(c.Get(fiber.HeaderAuthorization)) == "" && strings.TrimSpace(c.Get(apiKeyHeader)) == "" {
+		return "", errs.NewUnauthorized(fmt.Sprintf("missing key, send it as 'key' in the body, as 'Authorization: Bearer <key>' or in the '%s' header", apiKeyHeader))
+	}
+	return requestKey(c)
+}
+
+// requestKeyHashes are the hashes requestKey may be stored under, to look up the key with keyByHashes.
+func (s *Server) requestKeyHashes(c *fiber.Ctx) ([]string, error) {
+	key, err := requestKey(c)
+	if err != nil {
+		return nil, err
+	}
+	return s.hasher.Candidates(key), nil
+}
+
+// parseKeyHeaders is requestKey for transports other than http, apiKey may be empty.
+// Keys never contain whitespace, so a value with a space is a scheme we can name in the error.
+func parseKeyHeaders(authorization string, apiKey string) (string, error) {
+	authorization = strings.TrimSpace(authorization)
+	if authorization == "" {
+		apiKey = strings.TrimSpace(apiKey)
+		if apiKey == "" {
+			return "", errs.NewUnauthorized(fmt.Sprintf("missing key, send it as 'Authorization: Bearer <key>' or in the '%s' header", apiKeyHeader))
+		}
+		return apiKey, nil
+	}
+
+	scheme, key, hasScheme := strings.Cut(authorization, " ")
+	if !hasScheme {
+		if strings.EqualFold(authorization, "Bearer") {
+			return "", errs.NewUnauthorized("malformed Authorization header, the key is missing after 'Bearer'")
+		}
+		return authorization, nil
+	}
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", errs.NewUnauthorized(fmt.Sprintf("unsupported Authorization scheme '%s', expected 'Bearer <key>'", scheme))
+	}
+	key = strings.TrimSpace(key)
+	if key == "" || strings.ContainsAny(key, " \t") {
+		return "", errs.NewUnauthorized("malformed Authorization header, expected 'Bearer <key>'")
+	}
+	return key, nil
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+func TestParseKeyHeaders(t *testing.T) {
+	testCases := []struct {
+		name          string
+		authorization string
+		apiKey        string
+		key           string
+		error         string
+	}{
+		{name: "bearer", authorization: "Bearer key_1", key: "key_1"},
+		{name: "lowercase bearer", authorization: "bearer key_1", key: "key_1"},
+		{name: "without scheme", authorization: "key_1", key: "key_1"},
+		{name: "x-api-key", apiKey: "key_1", key: "key_1"},
+		{name: "authorization takes precedence", authorization: "Bearer key_1", apiKey: "key_2", key: "key_1"},
+		{name: "surrounding whitespace", authorization: "  Bearer   key_1 ", key: "key_1"},
+		{name: "missing", error: "missing key"},
+		{name: "bearer without key", authorization: "Bearer", error: "the key is missing after 'Bearer'"},
+		{name: "bearer with blank key", authorization: "Bearer  ", error: "the key is missing after 'Bearer'"},
+		{name: "other scheme", authorization: "Basic dXNlcjpwYXNz", error: "unsupported Authorization scheme 'Basic'"},
+		{name: "key with spaces", authorization: "Bearer key 1", error: "expected 'Bearer <key>'"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			key, err := parseKeyHeaders(tc.authorization, tc.apiKey)
+			if tc.error == "" {
+				require.NoError(t, err)
+				require.Equal(t, tc.key, key)
+				return
+			}
+			require.Error(t, err)
+			e, ok := errs.As(err)
+			require.True(t, ok)
+			require.Equal(t, errs.UNAUTHORIZED, e.Code)
+			require.Contains(t, e.Message, tc.error)
+		})
+	}
+}
+
+func TestVerifyKey_HeaderForms(t *testing.T) {
+	db := newMemoryDatabase()
+	db.addKey("some_key", entities.Key{Id: "key_1", KeyAuthId: testKeyAuthId, WorkspaceId: testWorkspaceId})
+	srv := newTestServer(t, withDatabase(db))
+
+	for _, headers := range []map[string]string{
+		{"Authorization": "Bearer some_key"},
+		{"Authorization": "some_key"},
+		{"X-API-Key": "some_key"},
+	} {
+		req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		require.NoError(t, err)
+		require.Equal(t, 200, res.StatusCode, headers)
+
+		verifyRes := VerifyKeyResponse{}
+		require.NoError(t, json.Unmarshal(body, &verifyRes))
+		require.True(t, verifyRes.Valid, headers)
+	}
+
+	req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 401, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "unsupported Authorization scheme")
+}
+
+func TestVerifyKey_BodyOrHeader(t *testing.T) {
+	// the owner tells which key was used
+	db := newMemoryDatabase()
+	db.addKey("body_key", entities.Key{Id: "key_body", KeyAuthId: testKeyAuthId, WorkspaceId: testWorkspaceId, OwnerId: "body"})
+	db.addKey("header_key", entities.Key{Id: "key_header", KeyAuthId: testKeyAuthId, WorkspaceId: testWorkspaceId, OwnerId: "header"})
+	srv := newTestServer(t, withDatabase(db))
+
+	testCases := []struct {
+		name   string
+		body   string
+		header string
+		status int
+		owner  string
+		error  string
+	}{
+		{name: "body", body: `{"key":"body_key"}`, status: 200, owner: "body"},
+		{name: "header", body: `{}`, header: "Bearer header_key", status: 200, owner: "header"},
+		{name: "both", body: `{"key":"body_key"}`, header: "Bearer header_key", status: 200, owner: "body"},
+		{name: "neither", body: `{}`, status: 401, error: "missing key, send it as 'key' in the body"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.status, res.StatusCode)
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+
+			if tc.status != 200 {
+				errRes := VerifyKeyErrorResponse{}
+				require.NoError(t, json.Unmarshal(body, &errRes))
+				require.False(t, errRes.Valid)
+				require.Equal(t, UNAUTHORIZED, errRes.Code)
+				require.Contains(t, errRes.Error, tc.error)
+				return
+			}
+			verifyRes := VerifyKeyResponse{}
+			require.NoError(t, json.Unmarshal(body, &verifyRes))
+			require.True(t, verifyRes.Valid)
+			require.Equal(t, tc.owner, verifyRes.OwnerId)
+		})
+	}
+}
+
+func TestCreateKey_HeaderForms(t *testing.T) {
+	db := newMemoryDatabase()
+	srv := newTestServer(t, withDatabase(db))
+
+	for _, headers := range []map[string]string{
+		{"Authorization": "Bearer root_key"},
+		{"Authorization": "root_key"},
+		{"X-API-Key": "root_key"},
+	} {
+		req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(`{"apiId":"api_1"}`))
+		req.Header.Set("Content-Type", "application/json")
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, 200, res.StatusCode, headers)
+	}
+	require.Len(t, db.created, 3)
+
+	req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(`{"apiId":"api_1"}`))
+	req.Header.Set("Content-Type", "application/json")
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 401, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "missing key")
+}
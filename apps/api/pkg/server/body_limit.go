@@ -0,0 +1,47 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+// DefaultMaxBodyBytes limits the body of every request without its own limit in DefaultRouteBodyLimits.
+// It leaves plenty of room for a createKey request with the largest meta allowed by DefaultMaxMetaBytes.
+const DefaultMaxBodyBytes = 1024 * 1024
+
+// DefaultRouteBodyLimits are the limits of routes whose bodies are legitimately larger than
+// DefaultMaxBodyBytes, keyed by path.
+var DefaultRouteBodyLimits = map[string]int{
+	// up to 100 keys, each with its own meta
+	"/v1/keys.import": 8 * 1024 * 1024,
+}
+
+// bodyLimit is the largest body any route accepts. Fiber rejects bigger bodies while reading them,
+// so they are never held in memory.
+func (s *Server) bodyLimit() int {
+	limit := s.maxBodyBytes
+	for _, routeLimit := range s.routeBodyLimits {
+		if routeLimit > limit {
+			limit = routeLimit
+		}
+	}
+	return limit
+}
+
+// limitBody rejects bodies that are too large for the route, before any handler parses them.
+func (s *Server) limitBody(c *fiber.Ctx) error {
+	limit, ok := s.routeBodyLimits[c.Path()]
+	if !ok {
+		limit = s.maxBodyBytes
+	}
+	if len(c.Body()) > limit {
+		return bodyTooLarge(limit)
+	}
+	return c.Next()
+}
+
+func bodyTooLarge(limit int) error {
+	return errs.New(errs.PAYLOAD_TOO_LARGE, fmt.Sprintf("the request body must not be larger than %d bytes", limit))
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBodyLimit(t *testing.T) {
+	db := newMemoryDatabase()
+	srv := newTestServer(t, withDatabase(db), func(c *Config) {
+		c.MaxBodyBytes = 1024
+		c.RouteBodyLimits = map[string]int{"/v1/keys.import": 4096}
+	})
+
+	send := func(path string, metaBytes int) (int, ErrorResponse) {
+		body := fmt.Sprintf(`{"apiId":"api_1","meta":{"blob":%q}}`, strings.Repeat("a", metaBytes))
+		req := httptest.NewRequest("POST", path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer root_key")
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		resBody, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		errorRes := ErrorResponse{}
+		if res.StatusCode != 200 {
+			require.NoError(t, json.Unmarshal(resBody, &errorRes), string(resBody))
+		}
+		return res.StatusCode, errorRes
+	}
+
+	status, _ := send("/v1/keys", 100)
+	require.Equal(t, 200, status)
+
+	// above the limit of the route
+	status, errorRes := send("/v1/keys", 2000)
+	require.Equal(t, 413, status)
+	require.Equal(t, PAYLOAD_TOO_LARGE, errorRes.Code)
+
+	// the route overrides the global limit, the body is rejected for its content instead
+	status, errorRes = send("/v1/keys.import", 2000)
+	require.Equal(t, 400, status)
+	require.Equal(t, BAD_REQUEST, errorRes.Code)
+
+	require.Len(t, db.created, 1)
+}
+
+func TestBodyLimit_AboveEveryRoute(t *testing.T) {
+	srv := newTestServer(t, func(c *Config) {
+		c.MaxBodyBytes = 1024
+	})
+	// app.Test fails when fiber stops reading a body, a real listener shows what clients receive
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = srv.app.Listener(ln)
+	}()
+	defer srv.app.Shutdown()
+
+	body := fmt.Sprintf(`{"apiId":"api_1","meta":{"blob":%q}}`, strings.Repeat("a", 4096))
+	res, err := http.Post(fmt.Sprintf("http://%s/v1/keys", ln.Addr().String()), "application/json", bytes.NewBufferString(body))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 413, res.StatusCode)
+
+	resBody, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	errorRes := ErrorResponse{}
+	require.NoError(t, json.Unmarshal(resBody, &errorRes), string(resBody))
+	require.Equal(t, PAYLOAD_TOO_LARGE, errorRes.Code)
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	forwardedForHeader = "X-Forwarded-For"
+	// flyClientIpHeader is set by the fly.io proxy
+	flyClientIpHeader = "Fly-Client-IP"
+)
+
+type clientIpContextKey struct{}
+
+func withClientIp(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIpContextKey{}, ip)
+}
+
+// ClientIpFromContext returns the ip of the client or an empty string if there is none.
+//
+// Forwarding headers are only honoured when they were set by a trusted proxy, so the ip can be
+// used for access control.
+func ClientIpFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIpContextKey{}).(string)
+	return ip
+}
+
+// clientIp resolves the ip of the client for every request and stores it in the user context.
+func (s *Server) clientIp(c *fiber.Ctx) error {
+	ip := s.resolveClientIp(
+		c.Context().RemoteIP().String(),
+		c.Request().Header.PeekAll(forwardedForHeader),
+		c.Get(flyClientIpHeader),
+	)
+	c.SetUserContext(withClientIp(c.UserContext(), ip))
+	return c.Next()
+}
+
+// resolveClientIp returns the address of the client.
+//
+// Requests from untrusted addresses are taken at face value and their headers are ignored, anyone
+// can set them. When the connection comes from a trusted proxy, X-Forwarded-For is walked from the
+// right, every proxy appends the address it received the request from, so the first address that
+// is not a trusted proxy is the client. Anything left of it may have been sent by the client itself.
+func (s *Server) resolveClientIp(remoteAddr string, forwardedFor [][]byte, flyClientIp string) string {
+	remote, err := netip.ParseAddr(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	remote = remote.Unmap()
+	if !s.isTrustedProxy(remote) {
+		return remote.String()
+	}
+
+	hops := []string{}
+	for _, header := range forwardedFor {
+		for _, hop := range strings.Split(string(header), ",") {
+			hop = strings.TrimSpace(hop)
+			if hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	if len(hops) == 0 {
+		if fly, err := netip.ParseAddr(strings.TrimSpace(flyClientIp)); err == nil {
+			return fly.Unmap().String()
+		}
+		return remote.String()
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			// we can not tell who added the garbage, so stop at the last address we trust
+			break
+		}
+		client = hop.Unmap()
+		if !s.isTrustedProxy(client) {
+			break
+		}
+	}
+	return client.String()
+}
+
+func (s *Server) isTrustedProxy(addr netip.Addr) bool {
+	for _, prefix := range s.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
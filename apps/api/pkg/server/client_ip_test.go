@@ -0,0 +1,80 @@
+package server
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/config"
+)
+
+func TestResolveClientIp(t *testing.T) {
+	trusted, err := config.ParseTrustedProxies([]string{"10.0.0.0/8", "fdaa::/16"})
+	require.NoError(t, err)
+	srv := &Server{trustedProxies: trusted}
+
+	testCases := []struct {
+		name         string
+		remote       string
+		forwardedFor []string
+		flyClientIp  string
+		want         string
+	}{
+		{name: "direct connection", remote: "1.1.1.1", want: "1.1.1.1"},
+		{name: "spoofed forwarded for from untrusted client", remote: "1.1.1.1", forwardedFor: []string{"2.2.2.2"}, want: "1.1.1.1"},
+		{name: "spoofed fly header from untrusted client", remote: "1.1.1.1", flyClientIp: "2.2.2.2", want: "1.1.1.1"},
+		{name: "single trusted proxy", remote: "10.0.0.1", forwardedFor: []string{"1.1.1.1"}, want: "1.1.1.1"},
+		{name: "chained trusted proxies", remote: "10.0.0.1", forwardedFor: []string{"1.1.1.1, 10.0.0.2, 10.0.0.3"}, want: "1.1.1.1"},
+		{name: "chain split across headers", remote: "10.0.0.1", forwardedFor: []string{"1.1.1.1", "10.0.0.2"}, want: "1.1.1.1"},
+		{name: "client prepends a spoofed address", remote: "10.0.0.1", forwardedFor: []string{"2.2.2.2, 1.1.1.1, 10.0.0.2"}, want: "1.1.1.1"},
+		{name: "client pretends to be a trusted proxy", remote: "10.0.0.1", forwardedFor: []string{"1.1.1.1, 10.0.0.9"}, want: "1.1.1.1"},
+		{name: "all hops trusted", remote: "10.0.0.1", forwardedFor: []string{"10.0.0.3, 10.0.0.2"}, want: "10.0.0.3"},
+		{name: "garbage hop stops the walk", remote: "10.0.0.1", forwardedFor: []string{"1.1.1.1, garbage, 10.0.0.2"}, want: "10.0.0.2"},
+		{name: "fly header from trusted proxy", remote: "fdaa::1", flyClientIp: "1.1.1.1", want: "1.1.1.1"},
+		{name: "forwarded for wins over fly header", remote: "fdaa::1", forwardedFor: []string{"1.1.1.1"}, flyClientIp: "2.2.2.2", want: "1.1.1.1"},
+		{name: "invalid fly header", remote: "10.0.0.1", flyClientIp: "garbage", want: "10.0.0.1"},
+		{name: "ipv4 mapped ipv6 proxy", remote: "::ffff:10.0.0.1", forwardedFor: []string{"1.1.1.1"}, want: "1.1.1.1"},
+		{name: "ipv6 client", remote: "10.0.0.1", forwardedFor: []string{"2001:db8::1"}, want: "2001:db8::1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			forwardedFor := [][]byte{}
+			for _, header := range tc.forwardedFor {
+				forwardedFor = append(forwardedFor, []byte(header))
+			}
+			require.Equal(t, tc.want, srv.resolveClientIp(tc.remote, forwardedFor, tc.flyClientIp))
+		})
+	}
+}
+
+func TestClientIp_Context(t *testing.T) {
+	newServer := func(trustedProxies []string) *Server {
+		trusted, err := config.ParseTrustedProxies(trustedProxies)
+		require.NoError(t, err)
+		srv := newTestServer(t, func(c *Config) {
+			c.TrustedProxies = trusted
+		})
+		srv.app.Get("/test/ip", func(c *fiber.Ctx) error {
+			return c.SendString(ClientIpFromContext(c.UserContext()))
+		})
+		return srv
+	}
+
+	get := func(srv *Server) string {
+		req := httptest.NewRequest("GET", "/test/ip", nil)
+		req.Header.Add("X-Forwarded-For", "2.2.2.2")
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	// the test connection comes from 0.0.0.0
+	require.Equal(t, "0.0.0.0", get(newServer(nil)))
+	require.Equal(t, "2.2.2.2", get(newServer([]string{"0.0.0.0"})))
+}
@@ -0,0 +1,19 @@
+package server
+
+import "time"
+
+// DefaultClockSkewTolerance is how far the clocks of our nodes may drift apart before expiries are affected.
+const DefaultClockSkewTolerance = 5 * time.Second
+
+// expired reports if a key with this expiry is expired at now, a zero expiry never expires.
+// Keys only count as expired once the tolerance has passed, so a key is not valid on one node
+// and expired on the next.
+func (s *Server) expired(expires time.Time, now time.Time) bool {
+	return !expires.IsZero() && expires.Add(s.clockSkewTolerance).Before(now)
+}
+
+// expiryInPast reports if a requested expiry in unix milliseconds is already over, 0 means no expiry.
+// It uses the same tolerance as verifications, an expiry we accept is not expired right away.
+func expiryInPast(expires int64, now time.Time, tolerance time.Duration) bool {
+	return expires > 0 && expires < now.Add(-tolerance).UnixMilli()
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+func TestExpired(t *testing.T) {
+	now := time.Now()
+	s := &Server{clockSkewTolerance: 5 * time.Second}
+
+	require.False(t, s.expired(time.Time{}, now))
+	require.False(t, s.expired(now.Add(time.Second), now))
+	require.False(t, s.expired(now.Add(-5*time.Second), now))
+	require.True(t, s.expired(now.Add(-5*time.Second-time.Millisecond), now))
+}
+
+func TestExpiryInPast(t *testing.T) {
+	now := time.UnixMilli(1_700_000_000_000)
+	tolerance := 5 * time.Second
+
+	require.False(t, expiryInPast(0, now, tolerance))
+	require.False(t, expiryInPast(now.UnixMilli(), now, tolerance))
+	require.False(t, expiryInPast(now.Add(-tolerance).UnixMilli(), now, tolerance))
+	require.True(t, expiryInPast(now.Add(-tolerance).UnixMilli()-1, now, tolerance))
+
+	_, err := expiresAt(now, now.Add(-tolerance).UnixMilli(), 0, tolerance)
+	require.NoError(t, err)
+	_, err = expiresAt(now, now.Add(-tolerance).UnixMilli()-1, 0, tolerance)
+	require.ErrorContains(t, err, "must be in the future")
+}
+
+func TestVerifyKey_ClockSkewTolerance(t *testing.T) {
+	// on this node the key expired a moment ago, but it may just have been created on another
+	key := entities.Key{Id: "key_1", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Expires: time.Now().Add(-2 * time.Second)}
+
+	verify := func(tolerance *time.Duration) VerifyKeyResponse {
+		db := newMemoryDatabase()
+		db.addKey("some_key", key)
+		srv := newTestServer(t, withDatabase(db), func(c *Config) {
+			c.ClockSkewTolerance = tolerance
+			c.DetailedVerifyErrors = true
+		})
+		req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(`{"key":"some_key"}`))
+		req.Header.Set("Content-Type", "application/json")
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		srv.background.Wait()
+
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		verifyRes := VerifyKeyResponse{}
+		require.NoError(t, json.Unmarshal(body, &verifyRes))
+		return verifyRes
+	}
+
+	require.True(t, verify(nil).Valid)
+
+	none := time.Duration(0)
+	res := verify(&none)
+	require.False(t, res.Valid)
+	require.Equal(t, EXPIRED, res.Code)
+}
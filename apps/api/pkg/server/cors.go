@@ -0,0 +1,112 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+// CorsConfig allows browsers on other origins to call the api. No origin is allowed by default,
+// so browsers refuse to read any response.
+type CorsConfig struct {
+	// Origins such as `https://app.unkey.dev`, `*` allows every origin
+	AllowOrigins []string
+	// DefaultCorsMethods are used if empty
+	AllowMethods []string
+	// DefaultCorsHeaders are used if empty
+	AllowHeaders []string
+	// How long browsers may cache a preflight response, they decide if it is 0
+	MaxAge time.Duration
+}
+
+var (
+	DefaultCorsMethods = []string{fiber.MethodGet, fiber.MethodPost, fiber.MethodPut, fiber.MethodDelete}
+	DefaultCorsHeaders = []string{fiber.HeaderAuthorization, fiber.HeaderContentType, "Idempotency-Key", secretModeHeader, requestIdHeader, consistencyHeader}
+)
+
+// corsExposedHeaders are the response headers scripts may read
+var corsExposedHeaders = []string{requestIdHeader, "Unkey-Trace-Id", "Unkey-Version", "Idempotent-Replayed", fiber.HeaderRetryAfter, consistencyHeader}
+
+// cors answers preflight requests and allows the configured origins to read responses.
+//
+// Credentials are never allowed, the api authenticates with the Authorization header and
+// does not use cookies.
+func cors(config CorsConfig) fiber.Handler {
+	allowAll := false
+	origins := map[string]bool{}
+	for _, origin := range config.AllowOrigins {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin == "*" {
+			allowAll = true
+		}
+		if origin != "" {
+			origins[strings.ToLower(origin)] = true
+		}
+	}
+	methods := nonEmpty(config.AllowMethods)
+	if len(methods) == 0 {
+		methods = DefaultCorsMethods
+	}
+	headers := nonEmpty(config.AllowHeaders)
+	if len(headers) == 0 {
+		headers = DefaultCorsHeaders
+	}
+	allowMethods := strings.Join(methods, ", ")
+	allowHeaders := strings.Join(headers, ", ")
+	exposeHeaders := strings.Join(corsExposedHeaders, ", ")
+
+	return func(c *fiber.Ctx) error {
+		origin := c.Get(fiber.HeaderOrigin)
+		preflight := c.Method() == fiber.MethodOptions && c.Get(fiber.HeaderAccessControlRequestMethod) != ""
+		if origin == "" {
+			// not a cross origin request from a browser
+			return c.Next()
+		}
+		c.Vary(fiber.HeaderOrigin)
+
+		allowed := allowAll || origins[strings.ToLower(origin)]
+		if !allowed {
+			if preflight {
+				return errs.NewForbidden(fmt.Sprintf("origin %s is not allowed", origin))
+			}
+			// the browser refuses to hand the response to the script
+			return c.Next()
+		}
+
+		if allowAll {
+			c.Set(fiber.HeaderAccessControlAllowOrigin, "*")
+		} else {
+			c.Set(fiber.HeaderAccessControlAllowOrigin, origin)
+		}
+
+		if !preflight {
+			c.Set(fiber.HeaderAccessControlExposeHeaders, exposeHeaders)
+			return c.Next()
+		}
+
+		c.Vary(fiber.HeaderAccessControlRequestMethod)
+		c.Vary(fiber.HeaderAccessControlRequestHeaders)
+		c.Set(fiber.HeaderAccessControlAllowMethods, allowMethods)
+		c.Set(fiber.HeaderAccessControlAllowHeaders, allowHeaders)
+		if config.MaxAge > 0 {
+			c.Set(fiber.HeaderAccessControlMaxAge, strconv.Itoa(int(config.MaxAge.Seconds())))
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// nonEmpty trims every value and drops the empty ones
+func nonEmpty(values []string) []string {
+	out := []string{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			out = append(out, value)
+		}
+	}
+	return out
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newCorsServer(t *testing.T, cors CorsConfig) *Server {
+	return newTestServer(t, func(c *Config) {
+		c.Cors = cors
+	})
+}
+
+func preflight(t *testing.T, srv *Server, path string, origin string) (int, map[string]string) {
+	req := httptest.NewRequest("OPTIONS", path, nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "authorization, content-type, idempotency-key")
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	headers := map[string]string{}
+	for _, name := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Methods", "Access-Control-Allow-Headers", "Access-Control-Max-Age", "Access-Control-Allow-Credentials"} {
+		headers[name] = res.Header.Get(name)
+	}
+	return res.StatusCode, headers
+}
+
+func TestCors_Preflight(t *testing.T) {
+	srv := newCorsServer(t, CorsConfig{AllowOrigins: []string{"https://app.unkey.dev"}, MaxAge: 5 * time.Minute})
+
+	for _, path := range []string{"/v1/keys", "/v1/keys/key_1", "/v1/keys.verify"} {
+		t.Run(path, func(t *testing.T) {
+			status, headers := preflight(t, srv, path, "https://app.unkey.dev")
+			require.Equal(t, 204, status)
+			require.Equal(t, "https://app.unkey.dev", headers["Access-Control-Allow-Origin"])
+			require.Contains(t, headers["Access-Control-Allow-Methods"], "POST")
+			require.Contains(t, headers["Access-Control-Allow-Headers"], "Authorization")
+			require.Contains(t, headers["Access-Control-Allow-Headers"], "Idempotency-Key")
+			require.Equal(t, "300", headers["Access-Control-Max-Age"])
+			require.Empty(t, headers["Access-Control-Allow-Credentials"])
+
+			status, headers = preflight(t, srv, path, "https://evil.com")
+			require.Equal(t, 403, status)
+			require.Empty(t, headers["Access-Control-Allow-Origin"])
+			require.Empty(t, headers["Access-Control-Allow-Methods"])
+		})
+	}
+}
+
+func TestCors_DeniedByDefault(t *testing.T) {
+	srv := newCorsServer(t, CorsConfig{})
+
+	status, headers := preflight(t, srv, "/v1/keys", "https://app.unkey.dev")
+	require.Equal(t, 403, status)
+	require.Empty(t, headers["Access-Control-Allow-Origin"])
+}
+
+func TestCors_Requests(t *testing.T) {
+	srv := newCorsServer(t, CorsConfig{AllowOrigins: []string{"https://app.unkey.dev/"}})
+
+	get := func(origin string) (int, string, string) {
+		req := httptest.NewRequest("GET", "/v1/liveness", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		return res.StatusCode, res.Header.Get("Access-Control-Allow-Origin"), res.Header.Get("Access-Control-Expose-Headers")
+	}
+
+	status, allowOrigin, expose := get("https://APP.unkey.dev")
+	require.Equal(t, 200, status)
+	require.Equal(t, "https://APP.unkey.dev", allowOrigin)
+	require.Contains(t, expose, "Unkey-Request-Id")
+
+	// the response is served, but browsers will not hand it to the script
+	status, allowOrigin, _ = get("https://evil.com")
+	require.Equal(t, 200, status)
+	require.Empty(t, allowOrigin)
+
+	// clients that are not browsers do not send an origin
+	status, allowOrigin, _ = get("")
+	require.Equal(t, 200, status)
+	require.Empty(t, allowOrigin)
+}
+
+func TestCors_AllowAll(t *testing.T) {
+	srv := newCorsServer(t, CorsConfig{AllowOrigins: []string{"*"}, AllowMethods: []string{"GET"}})
+
+	status, headers := preflight(t, srv, "/v1/keys", "https://anywhere.com")
+	require.Equal(t, 204, status)
+	require.Equal(t, "*", headers["Access-Control-Allow-Origin"])
+	require.Equal(t, "GET", headers["Access-Control-Allow-Methods"])
+}
@@ -1,5 +1,10 @@
 package server
 
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
 type ErrorCode = string
 
 const (
@@ -10,9 +15,41 @@ const (
 	RATELIMITED           ErrorCode = "RATELIMITED"
 	FORBIDDEN             ErrorCode = "FORBIDDEN"
 	USAGE_EXCEEDED        ErrorCode = "USAGE_EXCEEDED"
+	LIMIT_EXCEEDED        ErrorCode = "LIMIT_EXCEEDED"
+	DISABLED              ErrorCode = "DISABLED"
+	EXPIRED               ErrorCode = "EXPIRED"
+	OWNER_MISMATCH        ErrorCode = "OWNER_MISMATCH"
+	WRONG_API             ErrorCode = "WRONG_API"
+	PAYLOAD_TOO_LARGE     ErrorCode = "PAYLOAD_TOO_LARGE"
 )
 
 type ErrorResponse struct {
 	Error string    `json:"error,omitempty"`
 	Code  ErrorCode `json:"code"`
+	Docs  string    `json:"docs,omitempty"`
+	// RequestId is used to correlate errors with our logs and traces
+	RequestId string `json:"requestId,omitempty"`
+	// Errors lists every invalid field when the request failed validation
+	Errors []errs.FieldError `json:"errors,omitempty"`
+}
+
+// errorHandler translates errors returned from handlers into our ErrorResponse shape.
+// Errors that are not an *errs.Error are handled by fiber's default handler.
+func (s *Server) errorHandler(c *fiber.Ctx, err error) error {
+	// bodies above the largest limit are rejected by fiber before they reach any handler
+	if err == fiber.ErrRequestEntityTooLarge {
+		err = bodyTooLarge(s.bodyLimit())
+	}
+	e, ok := errs.As(err)
+	if !ok {
+		return fiber.DefaultErrorHandler(c, err)
+	}
+
+	return c.Status(e.Status).JSON(ErrorResponse{
+		Code:      string(e.Code),
+		Error:     e.Message,
+		Docs:      e.Docs,
+		RequestId: requestId(c),
+		Errors:    e.FieldErrors,
+	})
 }
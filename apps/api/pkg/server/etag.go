@@ -0,0 +1,42 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sendWithETag sends body as json with an ETag derived from its content and answers with
+// 304 Not Modified when the client already has it.
+//
+// Only use it for responses that do not change any state, a 304 skips nothing but the body.
+func sendWithETag(c *fiber.Ctx, body any) error {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(buf)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	c.Set(fiber.HeaderETag, etag)
+	if etagMatches(c.Get(fiber.HeaderIfNoneMatch), etag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(buf)
+}
+
+// etagMatches reports whether the If-None-Match header contains etag, using the weak comparison
+// required for If-None-Match.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
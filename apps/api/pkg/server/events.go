@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
+	"github.com/unkeyed/unkey/apps/api/pkg/webhooks"
+	"go.uber.org/zap"
+)
+
+// EventBus is implemented by *kafka.Kafka
+type EventBus interface {
+	ProduceKeyEvent(ctx context.Context, eventType kafka.KeyEventType, keyId, keyHash string) error
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// WebhookDispatcher is implemented by *webhooks.Dispatcher
+type WebhookDispatcher interface {
+	Dispatch(event webhooks.Event)
+	Close(ctx context.Context) error
+}
+
+var webhookEventTypes = map[kafka.KeyEventType]webhooks.EventType{
+	kafka.KeyCreated: webhooks.KeyCreated,
+	kafka.KeyUpdated: webhooks.KeyUpdated,
+	kafka.KeyDeleted: webhooks.KeyDeleted,
+}
+
+// emitKeyEvent produces the event in the background and delivers it to the webhooks of the workspace.
+// Shutdown waits for all pending events before closing the event bus.
+func (s *Server) emitKeyEvent(ctx context.Context, eventType kafka.KeyEventType, key entities.Key) {
+	s.produceKeyEvent(ctx, eventType, key.Id, key.Hash)
+	s.emitWebhook(webhooks.NewEvent(webhookEventTypes[eventType], key.WorkspaceId, webhookKey(key)))
+}
+
+// produceKeyEvent only informs other nodes through kafka, it does not trigger webhooks.
+func (s *Server) produceKeyEvent(ctx context.Context, eventType kafka.KeyEventType, keyId, keyHash string) {
+	if s.kafka == nil {
+		return
+	}
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		err := s.kafka.ProduceKeyEvent(detach(ctx), eventType, keyId, keyHash)
+		if err != nil {
+			s.logger.Error("unable to emit key event to kafka", zap.Error(err), zap.String("type", string(eventType)), zap.String("keyId", keyId))
+		}
+	}()
+}
+
+func (s *Server) emitWebhook(event webhooks.Event) {
+	if s.webhooks == nil {
+		return
+	}
+	s.webhooks.Dispatch(event)
+}
+
+// emitVerifiedWebhook reports the outcome of the verification of an existing key.
+func (s *Server) emitVerifiedWebhook(key entities.Key, valid bool, code ErrorCode) {
+	event := webhooks.NewEvent(webhooks.KeyVerified, key.WorkspaceId, webhookKey(key))
+	event.Verification = &webhooks.Verification{
+		Valid: valid,
+		Code:  code,
+	}
+	s.emitWebhook(event)
+}
+
+func webhookKey(key entities.Key) webhooks.EventKey {
+	return webhooks.EventKey{
+		Id:        key.Id,
+		KeyAuthId: key.KeyAuthId,
+		OwnerId:   key.OwnerId,
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/service"
+)
+
+var expiresInUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+}
+
+// ExpiresIn is a duration relative to the time a key is created.
+//
+// In json it is a string of whole numbers with units, such as "30d", "12h" or "1d12h".
+// Supported units are ms, s, m, h, d and w.
+type ExpiresIn time.Duration
+
+func (e *ExpiresIn) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return fmt.Errorf("expiresIn must be a duration string like \"30d\"")
+	}
+	d, err := parseExpiresIn(s)
+	if err != nil {
+		return err
+	}
+	*e = ExpiresIn(d)
+	return nil
+}
+
+// String formats e in the same notation UnmarshalJSON accepts, using whole units from days down to milliseconds.
+func (e ExpiresIn) String() string {
+	return service.FormatDuration(time.Duration(e))
+}
+
+func parseExpiresIn(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, fmt.Errorf("expiresIn must not be empty")
+	}
+
+	var total time.Duration
+	rest := s
+	for rest != "" {
+		i := 0
+		for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+			i++
+		}
+		if i == 0 {
+			return 0, fmt.Errorf("expiresIn %q is not a valid duration, use whole numbers with a unit of ms, s, m, h, d or w", s)
+		}
+		j := i
+		for j < len(rest) && (rest[j] < '0' || rest[j] > '9') {
+			j++
+		}
+		unit, ok := expiresInUnits[rest[i:j]]
+		if !ok {
+			return 0, fmt.Errorf("expiresIn %q is not a valid duration, use whole numbers with a unit of ms, s, m, h, d or w", s)
+		}
+
+		var n int64
+		for _, c := range rest[:i] {
+			if n > (math.MaxInt64-int64(c-'0'))/10 {
+				return 0, fmt.Errorf("expiresIn %q is too long", s)
+			}
+			n = n*10 + int64(c-'0')
+		}
+		if n > int64(math.MaxInt64/unit) {
+			return 0, fmt.Errorf("expiresIn %q is too long", s)
+		}
+		d := time.Duration(n) * unit
+		if total > math.MaxInt64-d {
+			return 0, fmt.Errorf("expiresIn %q is too long", s)
+		}
+		total += d
+		rest = rest[j:]
+	}
+
+	if total <= 0 {
+		return 0, fmt.Errorf("expiresIn must be positive")
+	}
+	return total, nil
+}
+
+// expiresAt resolves the absolute expiry of a new key, a zero time means the key does not expire.
+// An absolute expiry may be up to tolerance in the past, see DefaultClockSkewTolerance.
+func expiresAt(now time.Time, expires int64, expiresIn ExpiresIn, tolerance time.Duration) (time.Time, error) {
+	if expires != 0 && expiresIn != 0 {
+		return time.Time{}, fmt.Errorf("only one of 'expires' and 'expiresIn' can be set")
+	}
+	if expiresIn != 0 {
+		return now.Add(time.Duration(expiresIn)), nil
+	}
+	if expires > 0 {
+		if expiryInPast(expires, now, tolerance) {
+			return time.Time{}, fmt.Errorf("'expires' must be in the future, did you pass in a timestamp in seconds instead of milliseconds?")
+		}
+		return time.UnixMilli(expires), nil
+	}
+	return time.Time{}, nil
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpiresIn_Unmarshal(t *testing.T) {
+	testCases := []struct {
+		json     string
+		duration time.Duration
+	}{
+		{json: `"500ms"`, duration: 500 * time.Millisecond},
+		{json: `"90s"`, duration: 90 * time.Second},
+		{json: `"12h"`, duration: 12 * time.Hour},
+		{json: `"30d"`, duration: 30 * 24 * time.Hour},
+		{json: `"2w"`, duration: 14 * 24 * time.Hour},
+		{json: `"1d12h"`, duration: 36 * time.Hour},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.json, func(t *testing.T) {
+			var e ExpiresIn
+			require.NoError(t, json.Unmarshal([]byte(tc.json), &e))
+			require.Equal(t, tc.duration, time.Duration(e))
+		})
+	}
+}
+
+func TestExpiresIn_UnmarshalRejects(t *testing.T) {
+	testCases := []struct {
+		name string
+		json string
+	}{
+		{name: "number", json: `3600`},
+		{name: "empty", json: `""`},
+		{name: "missing unit", json: `"30"`},
+		{name: "unknown unit", json: `"1y"`},
+		{name: "fraction", json: `"1.5h"`},
+		{name: "negative", json: `"-1d"`},
+		{name: "zero", json: `"0d"`},
+		{name: "overflowing number", json: `"99999999999999999999ms"`},
+		{name: "overflowing unit", json: `"200000w"`},
+		{name: "overflowing sum", json: `"106751d106751d"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var e ExpiresIn
+			require.Error(t, json.Unmarshal([]byte(tc.json), &e))
+		})
+	}
+}
+
+func TestExpiresIn_String(t *testing.T) {
+	testCases := []struct {
+		duration time.Duration
+		s        string
+	}{
+		{duration: 0, s: "0ms"},
+		{duration: 500 * time.Millisecond, s: "500ms"},
+		{duration: 90 * time.Second, s: "1m30s"},
+		{duration: 30 * 24 * time.Hour, s: "30d"},
+		{duration: 36 * time.Hour, s: "1d12h"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.s, func(t *testing.T) {
+			require.Equal(t, tc.s, ExpiresIn(tc.duration).String())
+			if tc.duration > 0 {
+				d, err := parseExpiresIn(tc.s)
+				require.NoError(t, err)
+				require.Equal(t, tc.duration, d)
+			}
+		})
+	}
+}
+
+func TestExpiresAt(t *testing.T) {
+	now := time.Now()
+
+	t.Run("neither", func(t *testing.T) {
+		expires, err := expiresAt(now, 0, 0, 0)
+		require.NoError(t, err)
+		require.True(t, expires.IsZero())
+	})
+
+	t.Run("absolute", func(t *testing.T) {
+		expires, err := expiresAt(now, now.Add(time.Hour).UnixMilli(), 0, 0)
+		require.NoError(t, err)
+		require.Equal(t, now.Add(time.Hour).UnixMilli(), expires.UnixMilli())
+	})
+
+	t.Run("absolute in seconds", func(t *testing.T) {
+		_, err := expiresAt(now, now.Add(time.Hour).Unix(), 0, 0)
+		require.ErrorContains(t, err, "seconds instead of milliseconds")
+	})
+
+	t.Run("relative", func(t *testing.T) {
+		expires, err := expiresAt(now, 0, ExpiresIn(30*24*time.Hour), 0)
+		require.NoError(t, err)
+		require.Equal(t, now.Add(30*24*time.Hour), expires)
+	})
+
+	t.Run("both", func(t *testing.T) {
+		_, err := expiresAt(now, now.Add(time.Hour).UnixMilli(), ExpiresIn(time.Hour), 0)
+		require.ErrorContains(t, err, "only one of")
+	})
+
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	keysv1 "github.com/unkeyed/unkey/apps/api/gen/proto/keys/v1"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// grpcKeysService exposes the same logic as the http handlers to internal services that prefer grpc.
+type grpcKeysService struct {
+	keysv1.UnimplementedKeysServiceServer
+	s *Server
+}
+
+func newGrpcServer(s *Server) *grpc.Server {
+	g := grpc.NewServer()
+	keysv1.RegisterKeysServiceServer(g, &grpcKeysService{s: s})
+	return g
+}
+
+// StartGRPC serves the grpc api on addr, Shutdown stops it together with the http api.
+func (s *Server) StartGRPC(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %w", addr, err)
+	}
+	s.logger.Info("listening for grpc", zap.String("addr", addr))
+	err = s.grpcServer.Serve(lis)
+	if err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return fmt.Errorf("grpc server error: %s", err.Error())
+	}
+	return nil
+}
+
+func (g *grpcKeysService) CreateKey(ctx context.Context, in *keysv1.CreateKeyRequest) (*keysv1.CreateKeyResponse, error) {
+	ctx, span := g.s.tracer.Start(ctx, "grpc.createKey")
+	defer span.End()
+
+	req, err := createKeyRequestFromProto(in)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	expires, err := g.s.validateCreateKey(req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	authKey, err := g.s.authenticateRootKeyHeader(ctx, firstMetadata(ctx, "authorization"))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	err = requireScope(authKey, entities.ScopeKeysCreate)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	_, err = g.s.takeCreateKeyRatelimit(authKey)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	res, err := g.s.insertKey(ctx, g.s.grpcCaller(ctx), req, authKey, expires)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &keysv1.CreateKeyResponse{
+		Key:   res.Key,
+		KeyId: res.KeyId,
+	}, nil
+}
+
+func (g *grpcKeysService) VerifyKey(ctx context.Context, in *keysv1.VerifyKeyRequest) (*keysv1.VerifyKeyResponse, error) {
+	ctx, span := g.s.tracer.Start(ctx, "grpc.verifyKey")
+	defer span.End()
+
+	res, err := g.s.verify(ctx, VerifyKeyRequest{Key: in.GetKey()}, g.s.grpcCaller(ctx))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	out := &keysv1.VerifyKeyResponse{
+		Valid:     res.Valid,
+		OwnerId:   res.OwnerId,
+		Expires:   res.Expires,
+		Remaining: res.Remaining,
+		Code:      res.Code,
+	}
+	if res.Meta != nil {
+		out.Meta, err = structpb.NewStruct(res.Meta)
+		if err != nil {
+			return nil, grpcError(errs.NewInternal(err, "unable to encode meta"))
+		}
+	}
+	if res.Ratelimit != nil {
+		out.Ratelimit = &keysv1.RatelimitState{
+			Limit:     res.Ratelimit.Limit,
+			Remaining: res.Ratelimit.Remaining,
+			ResetAt:   res.Ratelimit.Reset,
+		}
+	}
+	return out, nil
+}
+
+// createKeyRequestFromProto applies the same defaults as the http handler
+func createKeyRequestFromProto(in *keysv1.CreateKeyRequest) (CreateKeyRequest, error) {
+	req := CreateKeyRequest{
+		ApiId:      in.GetApiId(),
+		Prefix:     in.GetPrefix(),
+		Name:       in.GetName(),
+		ByteLength: int(in.GetByteLength()),
+		Encoding:   in.GetEncoding(),
+		Checksum:   in.GetChecksum(),
+		OwnerId:    in.GetOwnerId(),
+		Expires:    in.GetExpires(),
+		Remaining:  in.GetRemaining(),
+	}
+	if req.ByteLength == 0 {
+		req.ByteLength = 16
+	}
+	if in.GetMeta() != nil {
+		req.Meta = in.GetMeta().AsMap()
+	}
+	if in.GetExpiresIn() != "" {
+		d, err := parseExpiresIn(in.GetExpiresIn())
+		if err != nil {
+			return CreateKeyRequest{}, errs.NewBadRequest(err.Error())
+		}
+		req.ExpiresIn = ExpiresIn(d)
+	}
+	if r := in.GetRatelimit(); r != nil {
+		req.Ratelimit = &NewKeyRatelimit{
+			Type:           r.GetType(),
+			Limit:          r.GetLimit(),
+			RefillRate:     r.GetRefillRate(),
+			RefillInterval: RefillInterval(r.GetRefillInterval()),
+		}
+	}
+	return req, nil
+}
+
+func firstMetadata(ctx context.Context, key string) string {
+	values := metadata.ValueFromIncomingContext(ctx, key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// grpcCaller resolves the client ip from the same headers and trusted proxies as http.
+func (s *Server) grpcCaller(ctx context.Context) caller {
+	remoteAddr := ""
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err == nil {
+			remoteAddr = host
+		}
+	}
+	forwardedFor := [][]byte{}
+	for _, value := range metadata.ValueFromIncomingContext(ctx, strings.ToLower(forwardedForHeader)) {
+		forwardedFor = append(forwardedFor, []byte(value))
+	}
+	return caller{ip: s.resolveClientIp(remoteAddr, forwardedFor, firstMetadata(ctx, strings.ToLower(flyClientIpHeader)))}
+}
+
+// grpcError translates the errors of the shared logic into grpc status errors.
+func grpcError(err error) error {
+	e, ok := errs.As(err)
+	if !ok {
+		var fe *fiber.Error
+		if errors.As(err, &fe) && fe.Code == fiber.StatusUnauthorized {
+			return status.Error(codes.Unauthenticated, "unauthorized")
+		}
+		return status.Error(codes.Internal, "internal server error")
+	}
+
+	code := codes.Internal
+	switch e.Code {
+	case errs.NOT_FOUND, errs.EXPIRED:
+		code = codes.NotFound
+	case errs.BAD_REQUEST:
+		code = codes.InvalidArgument
+	case errs.UNAUTHORIZED:
+		code = codes.Unauthenticated
+	case errs.FORBIDDEN, errs.DISABLED:
+		code = codes.PermissionDenied
+	case errs.RATELIMITED, errs.USAGE_EXCEEDED, errs.LIMIT_EXCEEDED:
+		code = codes.ResourceExhausted
+	}
+	return status.Error(code, e.Message)
+}
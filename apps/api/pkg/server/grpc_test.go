@@ -0,0 +1,205 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	keysv1 "github.com/unkeyed/unkey/apps/api/gen/proto/keys/v1"
+	"github.com/unkeyed/unkey/apps/api/pkg/cache"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/tracing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newGrpcTestClient serves the grpc api of srv in memory
+func newGrpcTestClient(t *testing.T, srv *Server) keysv1.KeysServiceClient {
+	lis := bufconn.Listen(1024 * 1024)
+	go func() {
+		_ = srv.grpcServer.Serve(lis)
+	}()
+	t.Cleanup(srv.grpcServer.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return keysv1.NewKeysServiceClient(conn)
+}
+
+func TestGrpc_CreateKey(t *testing.T) {
+	db := &quotaDatabase{workspace: entities.Workspace{Id: "ws_1"}}
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: db,
+		Tracer:   tracing.NewNoop(),
+	})
+	client := newGrpcTestClient(t, srv)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer root_key")
+	res, err := client.CreateKey(ctx, &keysv1.CreateKeyRequest{
+		ApiId:     "api_1",
+		Prefix:    "test",
+		ExpiresIn: "1d",
+		Ratelimit: &keysv1.Ratelimit{Type: "fast", Limit: 10, RefillRate: 1, RefillInterval: 1000},
+	})
+	require.NoError(t, err)
+	srv.background.Wait()
+
+	require.Len(t, db.created, 1)
+	require.Equal(t, res.KeyId, db.created[0].Id)
+	require.Equal(t, "test", res.Key[:len("test")])
+	require.False(t, db.created[0].Expires.IsZero())
+	require.Equal(t, int64(1000), db.created[0].Ratelimit.RefillInterval)
+}
+
+func TestGrpc_CreateKey_Errors(t *testing.T) {
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: &quotaDatabase{workspace: entities.Workspace{Id: "ws_1"}},
+		Tracer:   tracing.NewNoop(),
+	})
+	client := newGrpcTestClient(t, srv)
+
+	authorized := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer root_key")
+	testCases := []struct {
+		name string
+		ctx  context.Context
+		req  *keysv1.CreateKeyRequest
+		code codes.Code
+	}{
+		{name: "missing root key", ctx: context.Background(), req: &keysv1.CreateKeyRequest{ApiId: "api_1"}, code: codes.Unauthenticated},
+		{name: "missing apiId", ctx: authorized, req: &keysv1.CreateKeyRequest{}, code: codes.InvalidArgument},
+		{name: "invalid expiresIn", ctx: authorized, req: &keysv1.CreateKeyRequest{ApiId: "api_1", ExpiresIn: "1y"}, code: codes.InvalidArgument},
+		{name: "incoherent ratelimit", ctx: authorized, req: &keysv1.CreateKeyRequest{ApiId: "api_1", Ratelimit: &keysv1.Ratelimit{Type: "fast"}}, code: codes.InvalidArgument},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := client.CreateKey(tc.ctx, tc.req)
+			require.Error(t, err)
+			require.Equal(t, tc.code, status.Code(err))
+		})
+	}
+}
+
+func TestGrpc_CreateKey_MissingScope(t *testing.T) {
+	db := &quotaDatabase{workspace: entities.Workspace{Id: "ws_1"}, scopes: []string{entities.ScopeKeysRead}}
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: db,
+		Tracer:   tracing.NewNoop(),
+	})
+	client := newGrpcTestClient(t, srv)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer root_key")
+	_, err := client.CreateKey(ctx, &keysv1.CreateKeyRequest{ApiId: "api_1"})
+	require.Error(t, err)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	require.Len(t, db.created, 0)
+}
+
+func TestGrpc_VerifyKey(t *testing.T) {
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: &missingApiDatabase{key: entities.Key{
+			Id:          "key_1",
+			KeyAuthId:   "key_auth_1",
+			WorkspaceId: "ws_1",
+		}},
+		Tracer: tracing.NewNoop(),
+	})
+	client := newGrpcTestClient(t, srv)
+
+	// the same checks as http apply, the key exists but its api does not
+	_, err := client.VerifyKey(context.Background(), &keysv1.VerifyKeyRequest{Key: "orphaned_key"})
+	require.Error(t, err)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.VerifyKey(context.Background(), &keysv1.VerifyKeyRequest{})
+	require.Error(t, err)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+// validKeyDatabase knows a single valid key in workspace ws_1
+type validKeyDatabase struct {
+	database.Database
+	key entities.Key
+}
+
+func (db *validKeyDatabase) GetKeyByHash(ctx context.Context, hash string) (entities.Key, error) {
+	key := db.key
+	key.Hash = hash
+	return key, nil
+}
+
+func (db *validKeyDatabase) GetKeysByHashes(ctx context.Context, hashes []string) (map[string]entities.Key, error) {
+	return keysByHashes(ctx, hashes, db.GetKeyByHash)
+}
+
+func (db *validKeyDatabase) GetKeyAuth(ctx context.Context, keyAuthId string) (entities.KeyAuth, error) {
+	return entities.KeyAuth{Id: keyAuthId, WorkspaceId: db.key.WorkspaceId}, nil
+}
+
+func (db *validKeyDatabase) GetApiByKeyAuthId(ctx context.Context, keyAuthId string) (entities.Api, error) {
+	return entities.Api{Id: "api_1", WorkspaceId: db.key.WorkspaceId, KeyAuthId: keyAuthId, AuthType: entities.AuthTypeKey}, nil
+}
+
+func (db *validKeyDatabase) GetKeyAndApiByHash(ctx context.Context, hash string) (entities.Key, entities.Api, error) {
+	key, _ := db.GetKeyByHash(ctx, hash)
+	api, _ := db.GetApiByKeyAuthId(ctx, key.KeyAuthId)
+	return key, api, nil
+}
+
+func (db *validKeyDatabase) TouchKeyLastUsed(ctx context.Context, keyId string, ts time.Time) error {
+	return nil
+}
+
+func (db *validKeyDatabase) GetWorkspace(ctx context.Context, workspaceId string) (entities.Workspace, error) {
+	return entities.Workspace{Id: workspaceId}, nil
+}
+
+func TestGrpc_VerifyKey_Valid(t *testing.T) {
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: &validKeyDatabase{key: entities.Key{
+			Id:          "key_1",
+			KeyAuthId:   "key_auth_1",
+			WorkspaceId: "ws_1",
+			OwnerId:     "chronark",
+			Meta:        map[string]any{"plan": "pro"},
+		}},
+		Tracer: tracing.NewNoop(),
+	})
+	client := newGrpcTestClient(t, srv)
+
+	res, err := client.VerifyKey(context.Background(), &keysv1.VerifyKeyRequest{Key: "some_key"})
+	require.NoError(t, err)
+	require.True(t, res.Valid)
+	require.Equal(t, "chronark", res.OwnerId)
+	require.Equal(t, "pro", res.Meta.AsMap()["plan"])
+	require.Nil(t, res.Remaining)
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// How long we wait for each dependency before reporting it as down
+const readinessTimeout = 2 * time.Second
+
+type ReadinessResponse struct {
+	Status string `json:"status"`
+	// Maps the name of a dependency to "ok" or the reason it is down
+	Checks map[string]string `json:"checks"`
+}
+
+func (s *Server) health(c *fiber.Ctx) error {
+	_, span := s.tracer.Start(c.UserContext(), "server.health")
+	defer span.End()
+	return c.SendString("OK")
+}
+
+func (s *Server) ready(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.ready")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	res := ReadinessResponse{
+		Status: "ok",
+		Checks: map[string]string{},
+	}
+
+	checks := map[string]func(context.Context) error{
+		"database": s.db.Ping,
+	}
+	if s.kafka != nil {
+		checks["kafka"] = s.kafka.Ping
+	}
+
+	for name, check := range checks {
+		err := check(ctx)
+		if err != nil {
+			s.logger.Warn("readiness check failed", zap.String("dependency", name), zap.Error(err))
+			res.Status = "unavailable"
+			res.Checks[name] = err.Error()
+			continue
+		}
+		res.Checks[name] = "ok"
+	}
+
+	if res.Status != "ok" {
+		return c.Status(http.StatusServiceUnavailable).JSON(res)
+	}
+	return c.JSON(res)
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealth(t *testing.T) {
+	db := newMemoryDatabase()
+	db.fail("Ping", errors.New("connection refused"))
+	srv := newTestServer(t, withDatabase(db))
+
+	res, err := srv.app.Test(httptest.NewRequest("GET", "/health", nil))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 200, res.StatusCode)
+}
+
+func TestReady(t *testing.T) {
+	srv := newTestServer(t)
+
+	res, err := srv.app.Test(httptest.NewRequest("GET", "/ready", nil))
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, 200, res.StatusCode)
+
+	readinessResponse := ReadinessResponse{}
+	err = json.Unmarshal(body, &readinessResponse)
+	require.NoError(t, err)
+	require.Equal(t, "ok", readinessResponse.Status)
+	require.Equal(t, "ok", readinessResponse.Checks["database"])
+}
+
+func TestReady_DatabaseDown(t *testing.T) {
+	db := newMemoryDatabase()
+	db.fail("Ping", errors.New("connection refused"))
+	srv := newTestServer(t, withDatabase(db))
+
+	res, err := srv.app.Test(httptest.NewRequest("GET", "/ready", nil))
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, 503, res.StatusCode)
+
+	readinessResponse := ReadinessResponse{}
+	err = json.Unmarshal(body, &readinessResponse)
+	require.NoError(t, err)
+	require.Equal(t, "unavailable", readinessResponse.Status)
+	require.Equal(t, "connection refused", readinessResponse.Checks["database"])
+}
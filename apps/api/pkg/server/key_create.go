@@ -1,34 +1,45 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
-	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
 	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
 	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/idempotency"
 	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
 	"github.com/unkeyed/unkey/apps/api/pkg/keys"
-	"github.com/unkeyed/unkey/apps/api/pkg/uid"
-	"go.uber.org/zap"
-	"net/http"
+	"github.com/unkeyed/unkey/apps/api/pkg/service"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"time"
 )
 
+const (
+	// DefaultIdempotencyTTL is how long a createKey response is replayed for retries
+	DefaultIdempotencyTTL   = 24 * time.Hour
+	maxIdempotencyKeyLength = 255
+)
+
 type CreateKeyRequest struct {
-	ApiId      string         `json:"apiId" validate:"required"`
-	Prefix     string         `json:"prefix"`
-	Name       string         `json:"name"`
-	ByteLength int            `json:"byteLength"`
-	OwnerId    string         `json:"ownerId"`
-	Meta       map[string]any `json:"meta"`
-	Expires    int64          `json:"expires"`
-	Ratelimit  *struct {
-		Type           string `json:"type"`
-		Limit          int64  `json:"limit"`
-		RefillRate     int64  `json:"refillRate"`
-		RefillInterval int64  `json:"refillInterval"`
-	} `json:"ratelimit"`
+	ApiId      string `json:"apiId" validate:"required"`
+	Prefix     string `json:"prefix"`
+	Name       string `json:"name"`
+	ByteLength int    `json:"byteLength"`
+	// Encoding of the generated key, defaults to base58
+	Encoding string `json:"encoding" validate:"omitempty,oneof=base58 base62 base64url"`
+	// Checksum embeds a checksum in the key, so typos are rejected without a database lookup
+	Checksum bool           `json:"checksum"`
+	OwnerId  string         `json:"ownerId"`
+	Meta     map[string]any `json:"meta"`
+	Expires  int64          `json:"expires"`
+	// ExpiresIn is an alternative to Expires, relative to the time of creation
+	ExpiresIn ExpiresIn `json:"expiresIn"`
+	// A ratelimit needs all fields, otherwise the bucket never refills
+	Ratelimit *NewKeyRatelimit `json:"ratelimit"`
 	// ForWorkspaceId is used internally when the frontend wants to create a new root key.
 	// Therefore we might not want to add this field to our docs.
 	ForWorkspaceId string `json:"forWorkspaceId"`
@@ -36,6 +47,31 @@ type CreateKeyRequest struct {
 	// How often this key may be used
 	// `undefined`, `0` or negative to disable
 	Remaining int64 `json:"remaining,omitempty"`
+	// DisableOnDepletion disables the key once remaining reaches 0, requires Remaining
+	DisableOnDepletion bool `json:"disableOnDepletion,omitempty"`
+	// RemainingWarnThreshold flags verifications that leave this many remaining or fewer, requires Remaining
+	RemainingWarnThreshold *int64 `json:"remainingWarnThreshold,omitempty" validate:"omitempty,gte=0"`
+
+	// Recoverable stores the secret encrypted, so it can be recovered later
+	Recoverable bool `json:"recoverable,omitempty"`
+
+	// ParentKeyId creates a child key, its usage counts against the remaining verifications
+	// and the ratelimit of the parent
+	ParentKeyId string `json:"parentKeyId,omitempty"`
+
+	// DryRun runs every check of a create, but no key is stored, for example to validate a form
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// NewKeyRatelimit is the ratelimit of a key that is created or imported.
+type NewKeyRatelimit struct {
+	Type           string         `json:"type" validate:"required,oneof=fast consistent"`
+	Limit          int64          `json:"limit" validate:"gt=0"`
+	RefillRate     int64          `json:"refillRate" validate:"gt=0"`
+	RefillInterval RefillInterval `json:"refillInterval" validate:"gt=0"`
+	// CheckOrder decides whether the ratelimit or remaining is checked first in verifications,
+	// defaults to remainingFirst
+	CheckOrder string `json:"checkOrder" validate:"omitempty,oneof=remainingFirst ratelimitFirst"`
 }
 
 type CreateKeyResponse struct {
@@ -43,149 +79,262 @@ type CreateKeyResponse struct {
 	KeyId string `json:"keyId"`
 }
 
-func (s *Server) createKey(c *fiber.Ctx) error {
+// secretModeHeader selects how the secret of a new key is returned, so integrations that log
+// responses do not leak it by accident. The default is secretModeInline.
+const secretModeHeader = "Unkey-Secret-Mode"
+
+const (
+	// secretModeInline returns a CreateKeyResponse
+	secretModeInline = "inline"
+	// secretModeSeparate returns a CreateKeySeparateResponse
+	secretModeSeparate = "separate"
+	// secretModeNone returns a CreateKeyIdResponse, the key must be recoverable as the
+	// secret is never returned
+	secretModeNone = "none"
+)
+
+// CreateKeySeparateResponse returns the secret in a field named for what it is, which log
+// scrubbers redact by default.
+type CreateKeySeparateResponse struct {
+	KeyId  string `json:"keyId"`
+	Secret string `json:"secret"`
+}
+
+type CreateKeyIdResponse struct {
+	KeyId string `json:"keyId"`
+}
+
+// CreateKeyDryRunResponse is returned instead of a key if the request was a dry run and the key
+// could have been created
+type CreateKeyDryRunResponse struct {
+	DryRun bool `json:"dryRun"`
+}
+
+// renderCreateKey shapes the response for the secret mode. Idempotent replays store the
+// CreateKeyResponse, so a retry may ask for a different mode.
+func renderCreateKey(c *fiber.Ctx, mode string, res CreateKeyResponse) error {
+	switch mode {
+	case secretModeSeparate:
+		return c.JSON(CreateKeySeparateResponse{KeyId: res.KeyId, Secret: res.Key})
+	case secretModeNone:
+		return c.JSON(CreateKeyIdResponse{KeyId: res.KeyId})
+	default:
+		return c.JSON(res)
+	}
+}
+
+// parseSecretMode returns the secret mode requested by the client.
+func parseSecretMode(header string, req CreateKeyRequest) (string, error) {
+	switch header {
+	case "", secretModeInline:
+		return secretModeInline, nil
+	case secretModeSeparate:
+		return secretModeSeparate, nil
+	case secretModeNone:
+		if !req.Recoverable {
+			return "", errs.NewBadRequest(fmt.Sprintf("'%s: %s' requires 'recoverable', otherwise the secret is lost", secretModeHeader, secretModeNone))
+		}
+		return secretModeNone, nil
+	default:
+		return "", errs.NewBadRequest(fmt.Sprintf("'%s' must be one of %s, %s or %s", secretModeHeader, secretModeInline, secretModeSeparate, secretModeNone))
+	}
+}
+
+func (s *Server) createKey(c *fiber.Ctx) (err error) {
 	ctx, span := s.tracer.Start(c.UserContext(), "server.createKey")
 	defer span.End()
+	outcome := "created"
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetAttributes(attribute.String("outcome", "error"))
+		} else {
+			span.SetAttributes(attribute.String("outcome", outcome))
+		}
+	}()
 
 	req := CreateKeyRequest{
 		// These act as default
 		ByteLength: 16,
 	}
-	err := c.BodyParser(&req)
+	err = c.BodyParser(&req)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(ErrorResponse{
-			Code:  BAD_REQUEST,
-			Error: fmt.Sprintf("unable to parse body: %s", err.Error()),
-		})
+		if isMetaTypeError(err) {
+			return errs.NewBadRequest("'meta' must be a json object")
+		}
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
 	}
 
-	err = s.validator.Struct(req)
+	expires, err := s.validateCreateKey(req)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(ErrorResponse{
-			Code:  BAD_REQUEST,
-			Error: fmt.Sprintf("unable to validate body: %s", err.Error()),
-		})
+		return err
 	}
 
-	if req.Expires > 0 && req.Expires < time.Now().UnixMilli() {
-		return c.Status(http.StatusBadRequest).JSON(
-			ErrorResponse{
-				Code:  BAD_REQUEST,
-				Error: "'expires' must be in the future, did you pass in a timestamp in seconds instead of milliseconds?",
-			})
+	secretMode, err := parseSecretMode(c.Get(secretModeHeader), req)
+	if err != nil {
+		return err
 	}
+	span.SetAttributes(attribute.String("secretMode", secretMode))
 
-	authHash, err := getKeyHash(c.Get("Authorization"))
+	authKey, err := s.authenticateRootKey(ctx, c)
 	if err != nil {
 		return err
 	}
 
-	authKey, err := s.db.GetKeyByHash(ctx, authHash)
+	err = requireScope(authKey, entities.ScopeKeysCreate)
 	if err != nil {
-		if errors.Is(err, database.ErrNotFound) {
-			return c.Status(http.StatusUnauthorized).JSON(ErrorResponse{
-				Code:  UNAUTHORIZED,
-				Error: "unauthorized",
-			})
-		}
+		return err
+	}
 
-		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: fmt.Sprintf("unable to find key: %s", err.Error()),
-		})
+	span.SetAttributes(attribute.String("workspaceId", authKey.ForWorkspaceId))
+
+	err = s.ratelimitCreateKey(c, authKey)
+	if err != nil {
+		return err
 	}
 
-	if authKey.ForWorkspaceId == "" {
-		return c.Status(http.StatusBadRequest).JSON(ErrorResponse{
-			Code:  BAD_REQUEST,
-			Error: "wrong key type",
-		})
+	// nothing is created, so there is nothing to replay or to read from the primary
+	if req.DryRun {
+		outcome = "dryRun"
+		_, err = s.insertKey(ctx, httpCaller(c), req, authKey, expires)
+		if err != nil {
+			return err
+		}
+		return c.JSON(CreateKeyDryRunResponse{DryRun: true})
 	}
 
-	api, err := s.db.GetApi(ctx, req.ApiId)
+	idempotencyKey := c.Get("Idempotency-Key")
+	if idempotencyKey == "" {
+		res, err := s.insertKey(ctx, httpCaller(c), req, authKey, expires)
+		if err != nil {
+			return err
+		}
+		s.setConsistencyToken(c)
+		return renderCreateKey(c, secretMode, res)
+	}
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		return errs.NewBadRequest(fmt.Sprintf("'Idempotency-Key' must not be longer than %d characters", maxIdempotencyKeyLength))
+	}
+
+	// keys are scoped to the root key, so different workspaces can not see each other's responses
+	res, replayed, err := s.createKeyIdempotency.Do(ctx, authKey.Id+":"+idempotencyKey, hash.Sha256(string(c.Body())), func() (CreateKeyResponse, error) {
+		return s.insertKey(ctx, httpCaller(c), req, authKey, expires)
+	})
 	if err != nil {
-		if errors.Is(err, database.ErrNotFound) {
-			return c.Status(http.StatusBadRequest).JSON(ErrorResponse{
-				Code:  BAD_REQUEST,
-				Error: "wrong apiId",
-			})
+		if errors.Is(err, idempotency.ErrFingerprintMismatch) {
+			return errs.NewBadRequest("'Idempotency-Key' was already used for a request with a different body")
 		}
-		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: fmt.Sprintf("unable to find api: %s", err.Error()),
-		})
+		return err
 	}
-	if api.WorkspaceId != authKey.ForWorkspaceId {
-		return c.Status(http.StatusUnauthorized).JSON(ErrorResponse{
-			Code:  UNAUTHORIZED,
-			Error: "access to workspace denied",
-		})
+	span.SetAttributes(attribute.Bool("idempotentReplayed", replayed))
+	if replayed {
+		c.Set("Idempotent-Replayed", "true")
 	}
+	s.setConsistencyToken(c)
+	return renderCreateKey(c, secretMode, res)
+}
 
-	if api.AuthType != entities.AuthTypeKey || api.KeyAuthId == "" {
-		return c.Status(http.StatusBadRequest).JSON(ErrorResponse{
-			Code:  BAD_REQUEST,
-			Error: fmt.Sprintf("api is not set up to handle key auth: %+v", api),
-		})
+// validateCreateKey checks everything about the request that does not need the database,
+// and resolves when the new key expires.
+func (s *Server) validateCreateKey(req CreateKeyRequest) (time.Time, error) {
+	err := s.validator.Struct(req)
+	if err != nil {
+		return time.Time{}, validationError(err)
 	}
 
-	keyValue, err := keys.NewV1Key(req.Prefix, req.ByteLength)
+	err = s.validatePrefix(req.Prefix)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: err.Error(),
-		})
+		return time.Time{}, err
 	}
-	// how many chars to store, this includes the prefix, delimiter and the first 4 characters of the key
-	startLength := len(req.Prefix) + 5
-	keyHash := hash.Sha256(keyValue)
 
-	newKey := entities.Key{
-		Id:          uid.Key(),
-		KeyAuthId:   api.KeyAuthId,
-		WorkspaceId: authKey.ForWorkspaceId,
-		Name:        req.Name,
-		Hash:        keyHash,
-		Start:       keyValue[:startLength],
-		OwnerId:     req.OwnerId,
-		Meta:        req.Meta,
-		CreatedAt:   time.Now(),
+	err = s.validateOwnerId("ownerId", req.OwnerId)
+	if err != nil {
+		return time.Time{}, err
 	}
-	if req.Expires > 0 {
-		newKey.Expires = time.UnixMilli(req.Expires)
+
+	if req.DisableOnDepletion && req.Remaining <= 0 {
+		return time.Time{}, errs.NewBadRequest("'disableOnDepletion' requires 'remaining'").WithFieldErrors([]errs.FieldError{
+			{Field: "disableOnDepletion", Constraint: "required_with", Message: "'disableOnDepletion' can only be set together with 'remaining'"},
+		})
 	}
-	if req.Remaining > 0 {
-		newKey.Remaining.Enabled = true
-		newKey.Remaining.Remaining = req.Remaining
+	if req.RemainingWarnThreshold != nil && req.Remaining <= 0 {
+		return time.Time{}, errs.NewBadRequest("'remainingWarnThreshold' requires 'remaining'").WithFieldErrors([]errs.FieldError{
+			{Field: "remainingWarnThreshold", Constraint: "required_with", Message: "'remainingWarnThreshold' can only be set together with 'remaining'"},
+		})
 	}
-	if req.Ratelimit != nil {
-		newKey.Ratelimit = &entities.Ratelimit{
-			Type:           req.Ratelimit.Type,
-			Limit:          req.Ratelimit.Limit,
-			RefillRate:     req.Ratelimit.RefillRate,
-			RefillInterval: req.Ratelimit.RefillInterval,
-		}
+
+	err = s.validateMeta(req.Meta)
+	if err != nil {
+		return time.Time{}, err
 	}
 
-	err = s.db.CreateKey(ctx, newKey)
+	expires, err := expiresAt(time.Now(), req.Expires, req.ExpiresIn, s.clockSkewTolerance)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: fmt.Sprintf("unable to store key: %s", err.Error()),
-		})
+		return time.Time{}, errs.NewBadRequest(err.Error())
 	}
-	if s.kafka != nil {
+	return expires, nil
+}
 
-		go func() {
-			err := s.kafka.ProduceKeyEvent(ctx, kafka.KeyCreated, newKey.Id, newKey.Hash)
-			if err != nil {
-				s.logger.Error("unable to emit new key event to kafka", zap.Error(err))
-			}
-		}()
+// insertKey creates a new key in the workspace of the root key, it is shared by all transports.
+func (s *Server) insertKey(ctx context.Context, from caller, req CreateKeyRequest, authKey entities.Key, expires time.Time) (CreateKeyResponse, error) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("apiId", req.ApiId))
+
+	newKey, keyValue, err := s.service.CreateKey(ctx, authKey.ForWorkspaceId, createKeyParams(req, expires))
+	if err != nil {
+		return CreateKeyResponse{}, err
+	}
+	if req.DryRun {
+		return CreateKeyResponse{}, nil
 	}
+	span.SetAttributes(attribute.String("keyId", newKey.Id))
 
-	return c.JSON(CreateKeyResponse{
+	s.announceKeyCreated(ctx, from, authKey, newKey)
+	return CreateKeyResponse{
 		Key:   keyValue,
 		KeyId: newKey.Id,
+	}, nil
+}
+
+// createKeyParams translates a validated request for the service
+func createKeyParams(req CreateKeyRequest, expires time.Time) service.CreateKeyParams {
+	params := service.CreateKeyParams{
+		ApiId:                  req.ApiId,
+		Prefix:                 req.Prefix,
+		Name:                   req.Name,
+		ByteLength:             req.ByteLength,
+		Encoding:               keys.Encoding(req.Encoding),
+		Checksum:               req.Checksum,
+		OwnerId:                req.OwnerId,
+		Meta:                   req.Meta,
+		Expires:                expires,
+		Remaining:              req.Remaining,
+		Recoverable:            req.Recoverable,
+		DisableOnDepletion:     req.DisableOnDepletion,
+		ParentKeyId:            req.ParentKeyId,
+		RemainingWarnThreshold: req.RemainingWarnThreshold,
+		DryRun:                 req.DryRun,
+	}
+	if req.Ratelimit != nil {
+		params.Ratelimit = &entities.Ratelimit{
+			Type:           req.Ratelimit.Type,
+			Limit:          req.Ratelimit.Limit,
+			RefillRate:     req.Ratelimit.RefillRate,
+			RefillInterval: int64(req.Ratelimit.RefillInterval),
+			CheckOrder:     req.Ratelimit.CheckOrder,
+		}
+	}
+	return params
+}
+
+// announceKeyCreated counts, publishes and audits a key that was stored
+func (s *Server) announceKeyCreated(ctx context.Context, from caller, authKey entities.Key, newKey entities.Key) {
+	s.metrics.KeysCreated.Inc()
+	s.emitKeyEvent(ctx, kafka.KeyCreated, newKey)
+	s.appendAuditLogFrom(ctx, from, audit.Entry{
+		WorkspaceId: newKey.WorkspaceId,
+		ActorKeyId:  authKey.Id,
+		Action:      audit.KeyCreated,
+		TargetKeyId: newKey.Id,
 	})
 }
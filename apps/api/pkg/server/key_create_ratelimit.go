@@ -0,0 +1,58 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/ratelimit"
+)
+
+type RatelimitConfig struct {
+	// Limit is the size of the bucket, 0 uses the default and a negative limit disables ratelimiting
+	Limit          int64
+	RefillRate     int64
+	RefillInterval time.Duration
+}
+
+// DefaultCreateKeyRatelimit allows bursts of 100 keys and 10 keys per second afterwards, per root key
+var DefaultCreateKeyRatelimit = RatelimitConfig{
+	Limit:          100,
+	RefillRate:     10,
+	RefillInterval: time.Second,
+}
+
+// ratelimitCreateKey returns an error if the root key has created too many keys recently.
+// The limit is enforced per node, a compromised key can create at most limit*nodes keys per interval.
+func (s *Server) ratelimitCreateKey(c *fiber.Ctx, authKey entities.Key) error {
+	reset, err := s.takeCreateKeyRatelimit(authKey)
+	if err != nil {
+		retryAfter := time.Until(reset)
+		c.Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	return err
+}
+
+// takeCreateKeyRatelimit is ratelimitCreateKey without the http headers, it returns when the caller may retry.
+func (s *Server) takeCreateKeyRatelimit(authKey entities.Key) (time.Time, error) {
+	if s.ratelimit == nil || s.createKeyRatelimit.Limit < 0 {
+		return time.Time{}, nil
+	}
+
+	r := s.ratelimit.Take(ratelimit.RatelimitRequest{
+		Identifier:     fmt.Sprintf("createKey:%s", authKey.Id),
+		Max:            s.createKeyRatelimit.Limit,
+		RefillRate:     s.createKeyRatelimit.RefillRate,
+		RefillInterval: s.createKeyRatelimit.RefillInterval.Milliseconds(),
+	})
+	if r.Pass {
+		return time.Time{}, nil
+	}
+
+	reset := time.UnixMilli(r.Reset)
+	return reset, errs.New(errs.RATELIMITED, fmt.Sprintf("too many keys created, retry after %s", reset.UTC().Format(time.RFC3339)))
+}
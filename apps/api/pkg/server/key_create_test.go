@@ -6,17 +6,26 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"net/http/httptest"
 	"os"
+	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
 	"github.com/unkeyed/unkey/apps/api/pkg/cache"
+	"github.com/unkeyed/unkey/apps/api/pkg/config"
 	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/encryption"
 	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
 	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/ratelimit"
 	"github.com/unkeyed/unkey/apps/api/pkg/testutil"
 	"github.com/unkeyed/unkey/apps/api/pkg/tracing"
 )
@@ -240,3 +249,889 @@ func TestCreateKey_WithRemanining(t *testing.T) {
 	require.Equal(t, int64(4), found.Remaining.Remaining)
 
 }
+
+func TestCreateKey_MissingApiIdReturnsErrorResponse(t *testing.T) {
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Tracer:   tracing.NewNoop(),
+	})
+
+	req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, 400, res.StatusCode)
+
+	errorResponse := ErrorResponse{}
+	err = json.Unmarshal(body, &errorResponse)
+	require.NoError(t, err)
+
+	require.Equal(t, BAD_REQUEST, errorResponse.Code)
+	require.Contains(t, errorResponse.Error, "unable to validate body")
+	require.NotEmpty(t, errorResponse.Docs)
+}
+
+func TestCreateKey_FieldErrors(t *testing.T) {
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Tracer:   tracing.NewNoop(),
+	})
+
+	body := `{"encoding":"hex","ratelimit":{"type":"slow","limit":0,"refillRate":1,"refillInterval":1000}}`
+	req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 400, res.StatusCode)
+
+	buf, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	errorResponse := ErrorResponse{}
+	require.NoError(t, json.Unmarshal(buf, &errorResponse))
+
+	require.Equal(t, BAD_REQUEST, errorResponse.Code)
+	require.Contains(t, errorResponse.Error, "unable to validate body")
+	require.Equal(t, []errs.FieldError{
+		{Field: "apiId", Constraint: "required", Message: "'apiId' is required"},
+		{Field: "encoding", Constraint: "oneof=base58 base62 base64url", Message: "'encoding' must be one of: base58, base62, base64url"},
+		{Field: "ratelimit.type", Constraint: "oneof=fast consistent", Message: "'ratelimit.type' must be one of: fast, consistent"},
+		{Field: "ratelimit.limit", Constraint: "gt=0", Message: "'ratelimit.limit' must be greater than 0"},
+	}, errorResponse.Errors)
+}
+
+func TestCreateKey_ErrorResponseEchoesRequestId(t *testing.T) {
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Tracer:   tracing.NewNoop(),
+	})
+
+	req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Unkey-Request-Id", "req_test")
+
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	errorResponse := ErrorResponse{}
+	err = json.Unmarshal(body, &errorResponse)
+	require.NoError(t, err)
+
+	require.Equal(t, "req_test", errorResponse.RequestId)
+	require.Equal(t, "req_test", res.Header.Get("Unkey-Request-Id"))
+}
+
+// quotaDatabase serves a single api in a workspace that already has `count` keys
+type quotaDatabase struct {
+	database.Database
+	workspace entities.Workspace
+	count     int
+	created   []entities.Key
+	// scopes of the root key
+	scopes []string
+	// prefix of the api
+	prefix string
+}
+
+func (db *quotaDatabase) GetKeyByHash(ctx context.Context, hash string) (entities.Key, error) {
+	return entities.Key{Id: "key_root", ForWorkspaceId: db.workspace.Id, Scopes: db.scopes}, nil
+}
+
+func (db *quotaDatabase) GetKeysByHashes(ctx context.Context, hashes []string) (map[string]entities.Key, error) {
+	return keysByHashes(ctx, hashes, db.GetKeyByHash)
+}
+
+func (db *quotaDatabase) GetApi(ctx context.Context, apiId string) (entities.Api, error) {
+	return entities.Api{
+		Id:          apiId,
+		WorkspaceId: db.workspace.Id,
+		AuthType:    entities.AuthTypeKey,
+		KeyAuthId:   "key_auth_1",
+		Prefix:      db.prefix,
+	}, nil
+}
+
+func (db *quotaDatabase) GetWorkspace(ctx context.Context, workspaceId string) (entities.Workspace, error) {
+	return db.workspace, nil
+}
+
+func (db *quotaDatabase) CountKeysByWorkspace(ctx context.Context, workspaceId string) (int, error) {
+	return db.count, nil
+}
+
+func (db *quotaDatabase) CreateKey(ctx context.Context, newKey entities.Key) error {
+	db.created = append(db.created, newKey)
+	return nil
+}
+
+func (db *quotaDatabase) AppendAuditLog(ctx context.Context, entry audit.Entry) error {
+	return nil
+}
+
+func TestCreateKey_WorkspaceQuota(t *testing.T) {
+	testCases := []struct {
+		name    string
+		maxKeys int
+		count   int
+		status  int
+	}{
+		{name: "unlimited", maxKeys: 0, count: 10000, status: 200},
+		{name: "below limit", maxKeys: 5, count: 4, status: 200},
+		{name: "at limit", maxKeys: 5, count: 5, status: 403},
+		{name: "above limit", maxKeys: 5, count: 6, status: 403},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &quotaDatabase{
+				workspace: entities.Workspace{Id: "ws_1", MaxKeys: tc.maxKeys},
+				count:     tc.count,
+			}
+			srv := New(Config{
+				Logger:   logging.NewNoopLogger(),
+				KeyCache: cache.NewNoopCache[entities.Key](),
+				ApiCache: cache.NewNoopCache[entities.Api](),
+				Database: db,
+				Tracer:   tracing.NewNoop(),
+			})
+
+			req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(`{"apiId":"api_1"}`))
+			req.Header.Set("Authorization", "Bearer root_key")
+			req.Header.Set("Content-Type", "application/json")
+
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.status, res.StatusCode)
+
+			if tc.status != 200 {
+				body, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+				errorRes := ErrorResponse{}
+				require.NoError(t, json.Unmarshal(body, &errorRes))
+				require.Equal(t, LIMIT_EXCEEDED, errorRes.Code)
+				require.Len(t, db.created, 0)
+			} else {
+				require.Len(t, db.created, 1)
+			}
+		})
+	}
+}
+
+func TestCreateKey_DryRun(t *testing.T) {
+	db := &quotaDatabase{workspace: entities.Workspace{Id: "ws_1", MaxKeys: 5}, count: 4}
+	bus := &recordingEventBus{events: map[kafka.KeyEventType][]string{}}
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: db,
+		Tracer:   tracing.NewNoop(),
+		Kafka:    bus,
+	})
+
+	create := func(body string) (int, []byte) {
+		req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer root_key")
+		req.Header.Set("Content-Type", "application/json")
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		resBody, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, resBody
+	}
+
+	status, body := create(`{"apiId":"api_1","prefix":"test","dryRun":true}`)
+	require.Equal(t, 200, status)
+	require.JSONEq(t, `{"dryRun":true}`, string(body))
+
+	// dry runs fail like the real request would
+	status, _ = create(`{"apiId":"api_1","disableOnDepletion":true,"dryRun":true}`)
+	require.Equal(t, 400, status)
+
+	db.count = 5
+	status, body = create(`{"apiId":"api_1","dryRun":true}`)
+	require.Equal(t, 403, status)
+	errorRes := ErrorResponse{}
+	require.NoError(t, json.Unmarshal(body, &errorRes))
+	require.Equal(t, LIMIT_EXCEEDED, errorRes.Code)
+
+	srv.background.Wait()
+	require.Len(t, db.created, 0)
+	require.Empty(t, bus.events)
+}
+
+func TestCreateKey_Scopes(t *testing.T) {
+	testCases := []struct {
+		name   string
+		scopes []string
+		status int
+	}{
+		{name: "unscoped root key", scopes: nil, status: 200},
+		{name: "granted", scopes: []string{entities.ScopeKeysRead, entities.ScopeKeysCreate}, status: 200},
+		{name: "missing scope", scopes: []string{entities.ScopeKeysRead}, status: 403},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &quotaDatabase{workspace: entities.Workspace{Id: "ws_1"}, scopes: tc.scopes}
+			srv := New(Config{
+				Logger:   logging.NewNoopLogger(),
+				KeyCache: cache.NewNoopCache[entities.Key](),
+				ApiCache: cache.NewNoopCache[entities.Api](),
+				Database: db,
+				Tracer:   tracing.NewNoop(),
+			})
+
+			req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(`{"apiId":"api_1"}`))
+			req.Header.Set("Authorization", "Bearer root_key")
+			req.Header.Set("Content-Type", "application/json")
+
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.status, res.StatusCode)
+
+			if tc.status != 200 {
+				body, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+				errorRes := ErrorResponse{}
+				require.NoError(t, json.Unmarshal(body, &errorRes))
+				require.Equal(t, FORBIDDEN, errorRes.Code)
+				require.Contains(t, errorRes.Error, entities.ScopeKeysCreate)
+				require.Len(t, db.created, 0)
+			} else {
+				require.Len(t, db.created, 1)
+			}
+		})
+	}
+}
+
+func TestCreateKey_MaxKeyLifetime(t *testing.T) {
+	day := 24 * time.Hour
+	testCases := []struct {
+		name              string
+		serverLifetime    time.Duration
+		workspaceLifetime time.Duration
+		body              string
+		status            int
+	}{
+		{name: "unlimited", body: `{"apiId":"api_1"}`, status: 200},
+		{name: "never expires", serverLifetime: 30 * day, body: `{"apiId":"api_1"}`, status: 400},
+		{name: "within limit", serverLifetime: 30 * day, body: `{"apiId":"api_1","expiresIn":"30d"}`, status: 200},
+		{name: "beyond limit", serverLifetime: 30 * day, body: `{"apiId":"api_1","expiresIn":"31d"}`, status: 400},
+		{
+			name:           "absolute expiry beyond limit",
+			serverLifetime: 30 * day,
+			body:           fmt.Sprintf(`{"apiId":"api_1","expires":%d}`, time.Now().Add(365*day).UnixMilli()),
+			status:         400,
+		},
+		{name: "workspace overrides server", serverLifetime: 30 * day, workspaceLifetime: 90 * day, body: `{"apiId":"api_1","expiresIn":"60d"}`, status: 200},
+		{name: "workspace limit without server limit", workspaceLifetime: day, body: `{"apiId":"api_1","expiresIn":"2d"}`, status: 400},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &quotaDatabase{
+				workspace: entities.Workspace{Id: "ws_1", MaxKeyLifetime: tc.workspaceLifetime},
+			}
+			srv := New(Config{
+				Logger:         logging.NewNoopLogger(),
+				KeyCache:       cache.NewNoopCache[entities.Key](),
+				ApiCache:       cache.NewNoopCache[entities.Api](),
+				Database:       db,
+				Tracer:         tracing.NewNoop(),
+				MaxKeyLifetime: tc.serverLifetime,
+			})
+
+			req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(tc.body))
+			req.Header.Set("Authorization", "Bearer root_key")
+			req.Header.Set("Content-Type", "application/json")
+
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.status, res.StatusCode)
+
+			if tc.status != 200 {
+				body, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+				errorRes := ErrorResponse{}
+				require.NoError(t, json.Unmarshal(body, &errorRes))
+				require.Equal(t, BAD_REQUEST, errorRes.Code)
+				require.Len(t, db.created, 0)
+			} else {
+				require.Len(t, db.created, 1)
+			}
+		})
+	}
+}
+
+func TestCreateKey_RejectsAmbiguousRefillInterval(t *testing.T) {
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		// the request is rejected before touching the database
+		Database: &quotaDatabase{},
+		Tracer:   tracing.NewNoop(),
+	})
+
+	buf := bytes.NewBufferString(`{"apiId":"api_1","ratelimit":{"type":"fast","limit":10,"refillRate":1,"refillInterval":"60"}}`)
+	req := httptest.NewRequest("POST", "/v1/keys", buf)
+	req.Header.Set("Authorization", "Bearer root_key")
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 400, res.StatusCode)
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	errorRes := ErrorResponse{}
+	require.NoError(t, json.Unmarshal(body, &errorRes))
+	require.Equal(t, BAD_REQUEST, errorRes.Code)
+	require.Contains(t, errorRes.Error, "missing a unit")
+}
+
+func TestCreateKey_Ratelimited(t *testing.T) {
+	db := &quotaDatabase{
+		workspace: entities.Workspace{Id: "ws_1"},
+	}
+	srv := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		KeyCache:  cache.NewNoopCache[entities.Key](),
+		ApiCache:  cache.NewNoopCache[entities.Api](),
+		Database:  db,
+		Tracer:    tracing.NewNoop(),
+		Ratelimit: ratelimit.NewInMemory(),
+		CreateKeyRatelimit: RatelimitConfig{
+			Limit:          2,
+			RefillRate:     1,
+			RefillInterval: time.Minute,
+		},
+	})
+
+	createKey := func() *http.Response {
+		req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(`{"apiId":"api_1"}`))
+		req.Header.Set("Authorization", "Bearer root_key")
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	for i := 0; i < 2; i++ {
+		res := createKey()
+		res.Body.Close()
+		require.Equal(t, 200, res.StatusCode)
+	}
+
+	res := createKey()
+	defer res.Body.Close()
+	require.Equal(t, 429, res.StatusCode)
+	require.NotEmpty(t, res.Header.Get("Retry-After"))
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	errorRes := ErrorResponse{}
+	require.NoError(t, json.Unmarshal(body, &errorRes))
+	require.Equal(t, RATELIMITED, errorRes.Code)
+
+	srv.background.Wait()
+	require.Len(t, db.created, 2)
+}
+
+// lockedQuotaDatabase allows concurrent key creation
+type lockedQuotaDatabase struct {
+	quotaDatabase
+	sync.Mutex
+}
+
+func (db *lockedQuotaDatabase) CreateKey(ctx context.Context, newKey entities.Key) error {
+	db.Lock()
+	defer db.Unlock()
+	return db.quotaDatabase.CreateKey(ctx, newKey)
+}
+
+func TestCreateKey_Idempotency(t *testing.T) {
+	db := &lockedQuotaDatabase{
+		quotaDatabase: quotaDatabase{workspace: entities.Workspace{Id: "ws_1"}},
+	}
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: db,
+		Tracer:   tracing.NewNoop(),
+	})
+
+	createKey := func(idempotencyKey string, body string) (*http.Response, CreateKeyResponse) {
+		req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer root_key")
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		successResponse := CreateKeyResponse{}
+		if res.StatusCode == 200 {
+			buf, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(buf, &successResponse))
+		}
+		return res, successResponse
+	}
+
+	responses := make([]CreateKeyResponse, 5)
+	wg := sync.WaitGroup{}
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, body := createKey("retry_1", `{"apiId":"api_1"}`)
+			require.Equal(t, 200, res.StatusCode)
+			responses[i] = body
+		}(i)
+	}
+	wg.Wait()
+	for _, r := range responses {
+		require.Equal(t, responses[0], r)
+	}
+
+	res, replayed := createKey("retry_1", `{"apiId":"api_1"}`)
+	require.Equal(t, 200, res.StatusCode)
+	require.Equal(t, "true", res.Header.Get("Idempotent-Replayed"))
+	require.Equal(t, responses[0], replayed)
+
+	res, _ = createKey("retry_1", `{"apiId":"api_1","name":"other"}`)
+	require.Equal(t, 400, res.StatusCode)
+
+	res, other := createKey("retry_2", `{"apiId":"api_1"}`)
+	require.Equal(t, 200, res.StatusCode)
+	require.NotEqual(t, responses[0].KeyId, other.KeyId)
+
+	srv.background.Wait()
+	require.Len(t, db.created, 2)
+}
+
+func TestCreateKey_RejectsIncoherentRatelimit(t *testing.T) {
+	testCases := []struct {
+		name      string
+		ratelimit string
+	}{
+		{name: "missing type", ratelimit: `{"limit":10,"refillRate":1,"refillInterval":1000}`},
+		{name: "unknown type", ratelimit: `{"type":"slow","limit":10,"refillRate":1,"refillInterval":1000}`},
+		{name: "missing limit", ratelimit: `{"type":"fast","refillRate":1,"refillInterval":1000}`},
+		{name: "missing refillRate", ratelimit: `{"type":"fast","limit":10,"refillInterval":1000}`},
+		{name: "missing refillInterval", ratelimit: `{"type":"fast","limit":10,"refillRate":1}`},
+		{name: "negative refillRate", ratelimit: `{"type":"fast","limit":10,"refillRate":-1,"refillInterval":1000}`},
+		{name: "unknown checkOrder", ratelimit: `{"type":"fast","limit":10,"refillRate":1,"refillInterval":1000,"checkOrder":"never"}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &quotaDatabase{workspace: entities.Workspace{Id: "ws_1"}}
+			srv := New(Config{
+				Logger:   logging.NewNoopLogger(),
+				KeyCache: cache.NewNoopCache[entities.Key](),
+				ApiCache: cache.NewNoopCache[entities.Api](),
+				Database: db,
+				Tracer:   tracing.NewNoop(),
+			})
+
+			req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(fmt.Sprintf(`{"apiId":"api_1","ratelimit":%s}`, tc.ratelimit)))
+			req.Header.Set("Authorization", "Bearer root_key")
+			req.Header.Set("Content-Type", "application/json")
+
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, 400, res.StatusCode)
+			require.Len(t, db.created, 0)
+		})
+	}
+}
+
+func TestCreateKey_DisableOnDepletion(t *testing.T) {
+	testCases := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "with remaining", body: `{"apiId":"api_1","remaining":3,"disableOnDepletion":true}`, status: 200},
+		{name: "without remaining", body: `{"apiId":"api_1","disableOnDepletion":true}`, status: 400},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &quotaDatabase{workspace: entities.Workspace{Id: "ws_1"}}
+			srv := New(Config{
+				Logger:   logging.NewNoopLogger(),
+				KeyCache: cache.NewNoopCache[entities.Key](),
+				ApiCache: cache.NewNoopCache[entities.Api](),
+				Database: db,
+				Tracer:   tracing.NewNoop(),
+			})
+
+			req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(tc.body))
+			req.Header.Set("Authorization", "Bearer root_key")
+			req.Header.Set("Content-Type", "application/json")
+
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.status, res.StatusCode)
+			if tc.status != 200 {
+				require.Len(t, db.created, 0)
+				return
+			}
+			require.Len(t, db.created, 1)
+			require.True(t, db.created[0].DisableOnDepletion)
+			require.Equal(t, int64(3), db.created[0].Remaining.Remaining)
+		})
+	}
+}
+
+func TestCreateKey_RemainingWarnThreshold(t *testing.T) {
+	testCases := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "with remaining", body: `{"apiId":"api_1","remaining":3,"remainingWarnThreshold":0}`, status: 200},
+		{name: "without remaining", body: `{"apiId":"api_1","remainingWarnThreshold":1}`, status: 400},
+		{name: "negative", body: `{"apiId":"api_1","remaining":3,"remainingWarnThreshold":-1}`, status: 400},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &quotaDatabase{workspace: entities.Workspace{Id: "ws_1"}}
+			srv := New(Config{
+				Logger:   logging.NewNoopLogger(),
+				KeyCache: cache.NewNoopCache[entities.Key](),
+				ApiCache: cache.NewNoopCache[entities.Api](),
+				Database: db,
+				Tracer:   tracing.NewNoop(),
+			})
+
+			req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(tc.body))
+			req.Header.Set("Authorization", "Bearer root_key")
+			req.Header.Set("Content-Type", "application/json")
+
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.status, res.StatusCode)
+			if tc.status != 200 {
+				require.Len(t, db.created, 0)
+				return
+			}
+			require.Len(t, db.created, 1)
+			// 0 is a threshold, not the absence of one
+			require.NotNil(t, db.created[0].RemainingWarnThreshold)
+			require.Equal(t, int64(0), *db.created[0].RemainingWarnThreshold)
+		})
+	}
+}
+
+func TestCreateKey_SecretMode(t *testing.T) {
+	keyring, err := encryption.NewKeyring(map[int][]byte{1: bytes.Repeat([]byte{1}, encryption.KeySize)}, 1)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		mode   string
+		body   string
+		status int
+		fields []string
+	}{
+		{name: "default", body: `{"apiId":"api_1"}`, status: 200, fields: []string{"key", "keyId"}},
+		{name: "inline", mode: "inline", body: `{"apiId":"api_1"}`, status: 200, fields: []string{"key", "keyId"}},
+		{name: "separate", mode: "separate", body: `{"apiId":"api_1"}`, status: 200, fields: []string{"keyId", "secret"}},
+		{name: "none", mode: "none", body: `{"apiId":"api_1","recoverable":true}`, status: 200, fields: []string{"keyId"}},
+		{name: "none without recoverable", mode: "none", body: `{"apiId":"api_1"}`, status: 400},
+		{name: "unknown mode", mode: "hidden", body: `{"apiId":"api_1"}`, status: 400},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &quotaDatabase{workspace: entities.Workspace{Id: "ws_1"}}
+			srv := New(Config{
+				Logger:   logging.NewNoopLogger(),
+				KeyCache: cache.NewNoopCache[entities.Key](),
+				ApiCache: cache.NewNoopCache[entities.Api](),
+				Database: db,
+				Tracer:   tracing.NewNoop(),
+				Keyring:  keyring,
+			})
+
+			req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(tc.body))
+			req.Header.Set("Authorization", "Bearer root_key")
+			req.Header.Set("Content-Type", "application/json")
+			if tc.mode != "" {
+				req.Header.Set("Unkey-Secret-Mode", tc.mode)
+			}
+
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.status, res.StatusCode)
+			if tc.status != 200 {
+				require.Len(t, db.created, 0)
+				return
+			}
+
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			fields := map[string]string{}
+			require.NoError(t, json.Unmarshal(body, &fields))
+			require.Len(t, fields, len(tc.fields))
+			for _, field := range tc.fields {
+				require.NotEmpty(t, fields[field], field)
+			}
+			require.Len(t, db.created, 1)
+			require.Equal(t, db.created[0].Id, fields["keyId"])
+
+			if tc.mode == "none" {
+				// the secret is only delivered through the keyring
+				secret, err := keyring.Decrypt("ws_1", db.created[0].Encrypted)
+				require.NoError(t, err)
+				require.NotEmpty(t, secret)
+				require.NotContains(t, string(body), secret)
+			}
+		})
+	}
+}
+
+func TestCreateKey_OmitKeyStart(t *testing.T) {
+	keyring, err := encryption.NewKeyring(map[int][]byte{1: bytes.Repeat([]byte{1}, encryption.KeySize)}, 1)
+	require.NoError(t, err)
+
+	for _, omit := range []bool{false, true} {
+		t.Run(fmt.Sprintf("omit=%t", omit), func(t *testing.T) {
+			db := &quotaDatabase{workspace: entities.Workspace{Id: "ws_1", OmitKeyStart: omit}}
+			srv := New(Config{
+				Logger:   logging.NewNoopLogger(),
+				KeyCache: cache.NewNoopCache[entities.Key](),
+				ApiCache: cache.NewNoopCache[entities.Api](),
+				Database: db,
+				Tracer:   tracing.NewNoop(),
+				Keyring:  keyring,
+			})
+
+			for _, body := range []string{`{"apiId":"api_1","prefix":"test"}`, `{"apiId":"api_1","prefix":"test","recoverable":true}`} {
+				req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(body))
+				req.Header.Set("Authorization", "Bearer root_key")
+				req.Header.Set("Content-Type", "application/json")
+
+				res, err := srv.app.Test(req)
+				require.NoError(t, err)
+				defer res.Body.Close()
+				require.Equal(t, 200, res.StatusCode, body)
+			}
+
+			require.Len(t, db.created, 2)
+			for _, k := range db.created {
+				if omit {
+					require.Empty(t, k.Start)
+				} else {
+					require.True(t, strings.HasPrefix(k.Start, "test_"), k.Start)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateKey_ApiPrefix(t *testing.T) {
+	db := &quotaDatabase{workspace: entities.Workspace{Id: "ws_1"}, prefix: "api"}
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: db,
+		Tracer:   tracing.NewNoop(),
+	})
+
+	testCases := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "default of the api", body: `{"apiId":"api_1"}`, want: "api_"},
+		{name: "overridden", body: `{"apiId":"api_1","prefix":"req"}`, want: "req_"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(tc.body))
+			req.Header.Set("Authorization", "Bearer root_key")
+			req.Header.Set("Content-Type", "application/json")
+
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, 200, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			created := CreateKeyResponse{}
+			require.NoError(t, json.Unmarshal(body, &created))
+			require.True(t, strings.HasPrefix(created.Key, tc.want), created.Key)
+		})
+	}
+}
+
+func TestCreateKey_ReservedPrefix(t *testing.T) {
+	testCases := []struct {
+		name     string
+		reserved []string
+		prefix   string
+		status   int
+	}{
+		{name: "nothing reserved by default", prefix: "unkey", status: 200},
+		{name: "reserved", reserved: []string{"unkey", "root"}, prefix: "root", status: 400},
+		{name: "case-insensitive", reserved: []string{" Unkey "}, prefix: "UNKEY", status: 400},
+		{name: "only the whole prefix", reserved: []string{"root"}, prefix: "rooted", status: 200},
+		{name: "no prefix", reserved: []string{"root"}, status: 200},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &quotaDatabase{workspace: entities.Workspace{Id: "ws_1"}}
+			srv := New(Config{
+				Logger:           logging.NewNoopLogger(),
+				KeyCache:         cache.NewNoopCache[entities.Key](),
+				ApiCache:         cache.NewNoopCache[entities.Api](),
+				Database:         db,
+				Tracer:           tracing.NewNoop(),
+				ReservedPrefixes: tc.reserved,
+			})
+
+			body := fmt.Sprintf(`{"apiId":"api_1","prefix":%q}`, tc.prefix)
+			req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(body))
+			req.Header.Set("Authorization", "Bearer root_key")
+			req.Header.Set("Content-Type", "application/json")
+
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			srv.background.Wait()
+			require.Equal(t, tc.status, res.StatusCode)
+			if tc.status == 200 {
+				require.Len(t, db.created, 1)
+				return
+			}
+
+			buf, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			errorResponse := ErrorResponse{}
+			require.NoError(t, json.Unmarshal(buf, &errorResponse))
+			require.Equal(t, BAD_REQUEST, errorResponse.Code)
+			require.Len(t, errorResponse.Errors, 1)
+			require.Equal(t, "prefix", errorResponse.Errors[0].Field)
+			require.Len(t, db.created, 0)
+		})
+	}
+}
+
+func TestCreateKey_OwnerIdConstraints(t *testing.T) {
+	pattern, err := config.ParseOwnerIdPattern(`[a-z0-9_]+`)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		maxLength  int
+		pattern    *regexp.Regexp
+		ownerId    string
+		status     int
+		constraint string
+	}{
+		{name: "no owner", pattern: pattern, status: 200},
+		{name: "within the default length", ownerId: strings.Repeat("a", DefaultMaxOwnerIdLength), status: 200},
+		{name: "longer than the default", ownerId: strings.Repeat("a", DefaultMaxOwnerIdLength+1), status: 400, constraint: "max"},
+		{name: "characters, not bytes", maxLength: 3, ownerId: "äöü", status: 200},
+		{name: "longer than configured", maxLength: 3, ownerId: "user", status: 400, constraint: "max"},
+		{name: "matches the pattern", pattern: pattern, ownerId: "user_1", status: 200},
+		{name: "leading space", pattern: pattern, ownerId: " user_1", status: 400, constraint: "pattern"},
+		{name: "whole id must match", pattern: pattern, ownerId: "user_1!", status: 400, constraint: "pattern"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &quotaDatabase{workspace: entities.Workspace{Id: "ws_1"}}
+			srv := New(Config{
+				Logger:           logging.NewNoopLogger(),
+				KeyCache:         cache.NewNoopCache[entities.Key](),
+				ApiCache:         cache.NewNoopCache[entities.Api](),
+				Database:         db,
+				Tracer:           tracing.NewNoop(),
+				MaxOwnerIdLength: tc.maxLength,
+				OwnerIdPattern:   tc.pattern,
+			})
+
+			body := fmt.Sprintf(`{"apiId":"api_1","ownerId":%q}`, tc.ownerId)
+			req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(body))
+			req.Header.Set("Authorization", "Bearer root_key")
+			req.Header.Set("Content-Type", "application/json")
+
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			srv.background.Wait()
+			require.Equal(t, tc.status, res.StatusCode)
+			if tc.status == 200 {
+				require.Len(t, db.created, 1)
+				require.Equal(t, tc.ownerId, db.created[0].OwnerId)
+				return
+			}
+
+			buf, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			errorResponse := ErrorResponse{}
+			require.NoError(t, json.Unmarshal(buf, &errorResponse))
+			require.Equal(t, BAD_REQUEST, errorResponse.Code)
+			require.Len(t, errorResponse.Errors, 1)
+			require.Equal(t, "ownerId", errorResponse.Errors[0].Field)
+			require.Equal(t, tc.constraint, errorResponse.Errors[0].Constraint)
+			require.Len(t, db.created, 0)
+		})
+	}
+}
+
+func TestCreateKey_RejectsSuspendedRootKey(t *testing.T) {
+	db := newMemoryDatabase()
+	db.addKey(testRootKey, entities.Key{Id: testRootKeyId, ForWorkspaceId: testWorkspaceId, SuspendedAt: time.Now()})
+	srv := newTestServer(t, withDatabase(db))
+
+	req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(`{"apiId":"api_1"}`))
+	req.Header.Set("Authorization", "Bearer root_key")
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 401, res.StatusCode)
+	require.Empty(t, db.created)
+}
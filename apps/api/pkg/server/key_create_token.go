@@ -0,0 +1,316 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/keys"
+	"github.com/unkeyed/unkey/apps/api/pkg/service"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultCreateTokenTTL is how long a create token can be used if the request does not say
+	DefaultCreateTokenTTL = time.Hour
+	// MaxCreateTokenTTL limits how long a create token can be used, they are meant to be handed
+	// to a browser right before the user clicks the button
+	MaxCreateTokenTTL = 24 * time.Hour
+)
+
+// Create tokens are keys of our own api, like root keys, but without ForWorkspaceId, so they
+// can never be used as a root key. Their meta holds the workspace and the locked template.
+const (
+	createTokenWorkspaceMeta = "createTokenWorkspaceId"
+	createTokenTemplateMeta  = "createTokenTemplate"
+)
+
+// createWithTokenFields are the fields the holder of a create token may set,
+// everything else is locked by the template.
+var createWithTokenFields = map[string]bool{"name": true}
+
+type CreateKeyTokenRequest struct {
+	// Key is a createKey request, every field it sets is locked. It must set apiId and ownerId
+	Key json.RawMessage `json:"key" validate:"required"`
+	// ExpiresIn is how long the token can be used, defaults to DefaultCreateTokenTTL
+	ExpiresIn ExpiresIn `json:"expiresIn"`
+}
+
+type CreateKeyTokenResponse struct {
+	Token   string `json:"token"`
+	TokenId string `json:"tokenId"`
+	Expires int64  `json:"expires"`
+}
+
+type CreateKeyWithTokenRequest struct {
+	Name string `json:"name"`
+}
+
+// createKeyToken issues a token that can create exactly one key from a template, for example
+// for a "generate your own api key" button in the frontend of a customer.
+// The token is public, so the template is validated now and can not be changed by whoever holds it.
+func (s *Server) createKeyToken(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.createKeyToken")
+	defer span.End()
+
+	authKey, err := s.authenticateRootKey(ctx, c)
+	if err != nil {
+		return err
+	}
+	err = requireScope(authKey, entities.ScopeKeysCreate)
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.String("workspaceId", authKey.ForWorkspaceId))
+	if s.unkeyKeyAuthId == "" {
+		return errs.NewInternal(errors.New("UnkeyKeyAuthId is not configured"), "create tokens are not enabled")
+	}
+
+	req := CreateKeyTokenRequest{}
+	err = c.BodyParser(&req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+	}
+	err = s.validator.Struct(req)
+	if err != nil {
+		return validationError(err)
+	}
+
+	template, err := parseCreateKeyTemplate(req.Key)
+	if err != nil {
+		return err
+	}
+	if template.OwnerId == "" {
+		return errs.NewBadRequest("'key.ownerId' is required, every token creates a key for a specific owner")
+	}
+	_, err = s.validateCreateKey(template)
+	if err != nil {
+		return err
+	}
+
+	api, err := s.db.GetApi(ctx, template.ApiId)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return errs.NewBadRequest("wrong apiId")
+		}
+		return errs.NewInternal(err, "unable to find api")
+	}
+	if api.WorkspaceId != authKey.ForWorkspaceId {
+		return errs.NewUnauthorized("access to workspace denied")
+	}
+
+	ttl := time.Duration(req.ExpiresIn)
+	if ttl == 0 {
+		ttl = DefaultCreateTokenTTL
+	}
+	if ttl < 0 || ttl > MaxCreateTokenTTL {
+		return errs.NewBadRequest(fmt.Sprintf("'expiresIn' must be at most %s", ExpiresIn(MaxCreateTokenTTL)))
+	}
+
+	tokenValue, start, err := keys.NewV1Key("ct", 16, keys.WithStartChars(s.keyStartChars))
+	if err != nil {
+		return errs.NewInternal(err, "unable to generate token")
+	}
+	token := entities.Key{
+		Id:          uid.Key(),
+		KeyAuthId:   s.unkeyKeyAuthId,
+		WorkspaceId: s.unkeyWorkspaceId,
+		Name:        "create token",
+		Hash:        s.hasher.Hash(tokenValue),
+		Start:       start,
+		CreatedAt:   time.Now(),
+		Expires:     time.Now().Add(ttl),
+		Meta: map[string]any{
+			createTokenWorkspaceMeta: authKey.ForWorkspaceId,
+			createTokenTemplateMeta:  string(req.Key),
+		},
+	}
+	// redeeming the token consumes its only verification, so it can not be used twice
+	token.Remaining.Enabled = true
+	token.Remaining.Remaining = 1
+
+	err = s.db.CreateKey(ctx, token)
+	if err != nil {
+		return errs.NewInternal(err, "unable to store token")
+	}
+	span.SetAttributes(attribute.String("tokenId", token.Id))
+
+	return c.JSON(CreateKeyTokenResponse{
+		Token:   tokenValue,
+		TokenId: token.Id,
+		Expires: token.Expires.UnixMilli(),
+	})
+}
+
+// createKeyWithToken creates the key of a create token. It is public: the token is the only
+// authentication, and the body may only set fields the template left open.
+func (s *Server) createKeyWithToken(c *fiber.Ctx) (err error) {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.createKeyWithToken")
+	defer span.End()
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+	}()
+
+	// tokens are keys of our own key auth, without one configured no key is a token
+	if s.unkeyKeyAuthId == "" {
+		return errs.NewUnauthorized("unauthorized")
+	}
+	tokenHashes, err := s.requestKeyHashes(c)
+	if err != nil {
+		return err
+	}
+	token, tokenHash, err := s.keyByHashes(ctx, tokenHashes)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return errs.NewUnauthorized("unauthorized")
+		}
+		return errs.NewInternal(err, "unable to find token")
+	}
+	workspaceId, _ := token.Meta[createTokenWorkspaceMeta].(string)
+	rawTemplate, _ := token.Meta[createTokenTemplateMeta].(string)
+	if !s.isCreateToken(token) || workspaceId == "" || rawTemplate == "" {
+		return errs.NewUnauthorized("unauthorized")
+	}
+	if s.expired(token.Expires, time.Now()) || !token.SuspendedAt.IsZero() {
+		return errs.NewUnauthorized("token is not valid anymore")
+	}
+	span.SetAttributes(attribute.String("tokenId", token.Id), attribute.String("workspaceId", workspaceId))
+
+	req, err := parseCreateKeyTemplate(json.RawMessage(rawTemplate))
+	if err != nil {
+		return err
+	}
+	err = applyCreateWithTokenBody(&req, rawTemplate, c.Body())
+	if err != nil {
+		return err
+	}
+	expires, err := s.validateCreateKey(req)
+	if err != nil {
+		return err
+	}
+	params := createKeyParams(req, expires)
+
+	// the token is only used up by a key that is stored, so a key the workspace can not hold
+	// right now, for example because of its quota, leaves the token for another try
+	dryRun := params
+	dryRun.DryRun = true
+	_, _, err = s.service.CreateKey(ctx, workspaceId, dryRun)
+	if err != nil {
+		return err
+	}
+
+	var newKey entities.Key
+	var keyValue string
+	err = s.service.WithTx(ctx, func(svc *service.Service) error {
+		decremented, err := svc.ConsumeKey(ctx, tokenHash, 1)
+		if err != nil {
+			return err
+		}
+		if !decremented {
+			return errs.NewUnauthorized("token was already used")
+		}
+		newKey, keyValue, err = svc.CreateKey(ctx, workspaceId, params)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.String("keyId", newKey.Id))
+
+	// the key is created as if by a root key of the workspace, audit logs name the token as actor
+	s.announceKeyCreated(ctx, httpCaller(c), entities.Key{Id: token.Id, ForWorkspaceId: workspaceId}, newKey)
+
+	err = s.db.DeleteKey(ctx, token.Id)
+	if err != nil {
+		// it is used up already, deleting it only cleans up
+		s.logger.Warn("unable to delete used create token", zap.String("tokenId", token.Id), zap.Error(err))
+	}
+	s.setConsistencyToken(c)
+	return c.JSON(CreateKeyResponse{
+		Key:   keyValue,
+		KeyId: newKey.Id,
+	})
+}
+
+// isCreateToken reports whether key is a create token, those are keys of our own key auth with a workspace in their meta
+func (s *Server) isCreateToken(key entities.Key) bool {
+	if s.unkeyKeyAuthId == "" || key.KeyAuthId != s.unkeyKeyAuthId {
+		return false
+	}
+	_, ok := key.Meta[createTokenWorkspaceMeta]
+	return ok
+}
+
+// parseCreateKeyTemplate decodes the template of a create token. It never sets ForWorkspaceId,
+// that is always the workspace of the root key that issued the token.
+func parseCreateKeyTemplate(raw json.RawMessage) (CreateKeyRequest, error) {
+	req := CreateKeyRequest{
+		// These act as default
+		ByteLength: 16,
+	}
+	err := json.Unmarshal(raw, &req)
+	if err != nil {
+		if isMetaTypeError(err) {
+			return CreateKeyRequest{}, errs.NewBadRequest("'key.meta' must be a json object")
+		}
+		return CreateKeyRequest{}, errs.NewBadRequest(fmt.Sprintf("unable to parse key: %s", err.Error()))
+	}
+	if req.ForWorkspaceId != "" {
+		return CreateKeyRequest{}, errs.NewBadRequest("'key.forWorkspaceId' can not be set, tokens can not create root keys")
+	}
+	if req.DryRun {
+		return CreateKeyRequest{}, errs.NewBadRequest("'key.dryRun' can not be set, the token would be used up without creating a key")
+	}
+	return req, nil
+}
+
+// applyCreateWithTokenBody sets the fields of the body that the template left open.
+// Fields the template locked or that are never open are rejected, instead of silently ignored,
+// so a client trying to change them finds out.
+func applyCreateWithTokenBody(req *CreateKeyRequest, rawTemplate string, body []byte) error {
+	if len(body) == 0 {
+		return nil
+	}
+	fields := map[string]json.RawMessage{}
+	err := json.Unmarshal(body, &fields)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+	}
+	locked := map[string]json.RawMessage{}
+	err = json.Unmarshal([]byte(rawTemplate), &locked)
+	if err != nil {
+		return errs.NewInternal(err, "unable to parse token template")
+	}
+
+	rejected := []string{}
+	for field := range fields {
+		if _, isLocked := locked[field]; isLocked || !createWithTokenFields[field] {
+			rejected = append(rejected, field)
+		}
+	}
+	if len(rejected) > 0 {
+		sort.Strings(rejected)
+		return errs.NewBadRequest(fmt.Sprintf("fields are locked by the token and can not be set: %s", strings.Join(rejected, ", ")))
+	}
+
+	open := CreateKeyWithTokenRequest{}
+	err = json.Unmarshal(body, &open)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+	}
+	if _, ok := fields["name"]; ok {
+		req.Name = open.Name
+	}
+	return nil
+}
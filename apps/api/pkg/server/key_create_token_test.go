@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+func postWithAuthorization(t *testing.T, srv *Server, path string, authorization string, body string) (int, []byte) {
+	t.Helper()
+	req := httptest.NewRequest("POST", path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", authorization)
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res.StatusCode, resBody
+}
+
+func TestCreateKeyWithToken(t *testing.T) {
+	db := newMemoryDatabase()
+	srv := newTestServer(t, withDatabase(db), func(c *Config) {
+		c.UnkeyKeyAuthId = "key_auth_unkey"
+	})
+
+	status, body := postWithAuthorization(t, srv, "/v1/keys.createToken", "Bearer root_key", `{
+		"key": {
+			"apiId": "api_1",
+			"ownerId": "user_1",
+			"prefix": "acme",
+			"expiresIn": "30d",
+			"ratelimit": {"type": "fast", "limit": 10, "refillRate": 1, "refillInterval": 1000}
+		}
+	}`)
+	require.Equal(t, 200, status, string(body))
+	tokenRes := CreateKeyTokenResponse{}
+	require.NoError(t, json.Unmarshal(body, &tokenRes))
+	require.True(t, strings.HasPrefix(tokenRes.Token, "ct_"))
+	require.Len(t, db.created, 1)
+	// the token is not a root key, it can not create keys the usual way
+	status, _ = postWithAuthorization(t, srv, "/v1/keys", "Bearer "+tokenRes.Token, `{"apiId":"api_1"}`)
+	require.Equal(t, 400, status)
+
+	for _, override := range []string{
+		`{"ownerId":"user_2"}`,
+		`{"prefix":"evil"}`,
+		`{"name":"my key","ratelimit":{"type":"fast","limit":1000,"refillRate":1000,"refillInterval":1000}}`,
+		`{"expires":4102444800000}`,
+		`{"forWorkspaceId":"ws_2"}`,
+	} {
+		status, body := postWithAuthorization(t, srv, "/v1/keys.createWithToken", "Bearer "+tokenRes.Token, override)
+		require.Equal(t, 400, status, override)
+		require.Contains(t, string(body), "locked", override)
+	}
+	require.Len(t, db.created, 1)
+
+	status, body = postWithAuthorization(t, srv, "/v1/keys.createWithToken", "Bearer "+tokenRes.Token, `{"name":"my key"}`)
+	require.Equal(t, 200, status, string(body))
+	createRes := CreateKeyResponse{}
+	require.NoError(t, json.Unmarshal(body, &createRes))
+	require.True(t, strings.HasPrefix(createRes.Key, "acme_"))
+
+	require.Len(t, db.created, 2)
+	key := db.created[1]
+	require.Equal(t, createRes.KeyId, key.Id)
+	require.Equal(t, "ws_1", key.WorkspaceId)
+	require.Equal(t, "user_1", key.OwnerId)
+	require.Equal(t, "my key", key.Name)
+	require.Equal(t, int64(10), key.Ratelimit.Limit)
+	require.False(t, key.Expires.IsZero())
+	// the token was used up
+	_, found := db.key(tokenRes.TokenId)
+	require.False(t, found)
+
+	// exactly one key per token
+	status, _ = postWithAuthorization(t, srv, "/v1/keys.createWithToken", "Bearer "+tokenRes.Token, `{}`)
+	require.Equal(t, 401, status)
+	require.Len(t, db.created, 2)
+}
+
+func TestCreateKeyToken_Validation(t *testing.T) {
+	db := newMemoryDatabase()
+	srv := newTestServer(t, withDatabase(db), func(c *Config) {
+		c.UnkeyKeyAuthId = "key_auth_unkey"
+	})
+
+	for _, body := range []string{
+		`{}`,
+		`{"key":{"apiId":"api_1"}}`,
+		`{"key":{"ownerId":"user_1"}}`,
+		`{"key":{"apiId":"api_1","ownerId":"user_1","forWorkspaceId":"ws_2"}}`,
+		`{"key":{"apiId":"api_1","ownerId":"user_1"},"expiresIn":"30d"}`,
+	} {
+		status, _ := postWithAuthorization(t, srv, "/v1/keys.createToken", "Bearer root_key", body)
+		require.Equal(t, 400, status, body)
+	}
+	require.Empty(t, db.created)
+
+	status, _ := postWithAuthorization(t, srv, "/v1/keys.createWithToken", "Bearer ct_unknown", `{}`)
+	require.Equal(t, 401, status)
+}
+
+// issueCreateToken creates a token for a key of user_1 in api_1
+func issueCreateToken(t *testing.T, srv *Server) CreateKeyTokenResponse {
+	t.Helper()
+	status, body := postWithAuthorization(t, srv, "/v1/keys.createToken", "Bearer root_key", `{"key":{"apiId":"api_1","ownerId":"user_1"}}`)
+	require.Equal(t, 200, status, string(body))
+	tokenRes := CreateKeyTokenResponse{}
+	require.NoError(t, json.Unmarshal(body, &tokenRes))
+	return tokenRes
+}
+
+func TestCreateKeyWithToken_RejectedKeyKeepsToken(t *testing.T) {
+	db := newMemoryDatabase()
+	db.addWorkspace(entities.Workspace{Id: "ws_1", MaxKeys: 1})
+	db.addKeys("ws_1", 1)
+	srv := newTestServer(t, withDatabase(db), func(c *Config) {
+		c.UnkeyKeyAuthId = "key_auth_unkey"
+	})
+	tokenRes := issueCreateToken(t, srv)
+
+	status, body := postWithAuthorization(t, srv, "/v1/keys.createWithToken", "Bearer "+tokenRes.Token, `{}`)
+	require.NotEqual(t, 200, status, string(body))
+	require.Contains(t, string(body), "limit")
+	token, found := db.key(tokenRes.TokenId)
+	require.True(t, found)
+	require.Equal(t, int64(1), token.Remaining.Remaining)
+	require.Zero(t, db.consumed)
+
+	// once the workspace has room the same token still works
+	db.addWorkspace(entities.Workspace{Id: "ws_1", MaxKeys: 2})
+	status, body = postWithAuthorization(t, srv, "/v1/keys.createWithToken", "Bearer "+tokenRes.Token, `{}`)
+	require.Equal(t, 200, status, string(body))
+}
+
+func TestVerifyKey_RefusesCreateToken(t *testing.T) {
+	db := newMemoryDatabase()
+	// the tokens belong to our own api, so they would otherwise verify like any other key
+	db.addWorkspace(entities.Workspace{Id: "ws_unkey"})
+	db.addApi(entities.Api{Id: "api_unkey", WorkspaceId: "ws_unkey", AuthType: entities.AuthTypeKey, KeyAuthId: "key_auth_unkey"})
+	srv := newTestServer(t, withDatabase(db), func(c *Config) {
+		c.UnkeyWorkspaceId = "ws_unkey"
+		c.UnkeyKeyAuthId = "key_auth_unkey"
+	})
+	tokenRes := issueCreateToken(t, srv)
+
+	status, body := postWithAuthorization(t, srv, "/v1/keys/verify", "", `{"key":"`+tokenRes.Token+`"}`)
+	require.Equal(t, 401, status, string(body))
+	token, found := db.key(tokenRes.TokenId)
+	require.True(t, found)
+	require.Equal(t, int64(1), token.Remaining.Remaining)
+
+	status, body = postWithAuthorization(t, srv, "/v1/keys.createWithToken", "Bearer "+tokenRes.Token, `{}`)
+	require.Equal(t, 200, status, string(body))
+}
+
+func TestCreateKeyWithToken_WithoutUnkeyKeyAuth(t *testing.T) {
+	db := newMemoryDatabase()
+	// looks like a token, but without our own key auth configured no key is one
+	forged := db.addKey("ct_forged", entities.Key{
+		Id:          "key_forged",
+		WorkspaceId: "ws_1",
+		Meta: map[string]any{
+			createTokenWorkspaceMeta: "ws_1",
+			createTokenTemplateMeta:  `{"apiId":"api_1","ownerId":"user_1"}`,
+		},
+	})
+	forged.Remaining.Enabled = true
+	forged.Remaining.Remaining = 1
+	db.addKey("ct_forged", forged)
+	srv := newTestServer(t, withDatabase(db))
+
+	status, body := postWithAuthorization(t, srv, "/v1/keys.createToken", "Bearer root_key", `{"key":{"apiId":"api_1","ownerId":"user_1"}}`)
+	require.Equal(t, 500, status, string(body))
+
+	status, body = postWithAuthorization(t, srv, "/v1/keys.createWithToken", "Bearer ct_forged", `{}`)
+	require.Equal(t, 401, status, string(body))
+	require.Empty(t, db.created)
+	require.Zero(t, db.consumed)
+}
@@ -3,7 +3,9 @@ package server
 import (
 	"errors"
 	"fmt"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
 	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
 	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
 	"net/http"
 
@@ -25,71 +27,61 @@ func (s *Server) deleteKey(c *fiber.Ctx) error {
 	err := c.ParamsParser(&req)
 	if err != nil {
 		return c.Status(400).JSON(ErrorResponse{
-			Code:  BAD_REQUEST,
-			Error: err.Error(),
+			Code:      BAD_REQUEST,
+			Error:     err.Error(),
+			RequestId: requestId(c),
 		})
 	}
 
 	err = s.validator.Struct(req)
 	if err != nil {
 		return c.Status(400).JSON(ErrorResponse{
-			Code:  BAD_REQUEST,
-			Error: err.Error(),
+			Code:      BAD_REQUEST,
+			Error:     err.Error(),
+			RequestId: requestId(c),
 		})
 	}
 
-	authHash, err := getKeyHash(c.Get("Authorization"))
+	authKey, err := s.authenticateRootKey(ctx, c)
 	if err != nil {
 		return err
 	}
 
-	authKey, err := s.db.GetKeyByHash(ctx, authHash)
+	err = requireScope(authKey, entities.ScopeKeysDelete)
 	if err != nil {
-		if errors.Is(err, database.ErrNotFound) {
-			return c.Status(http.StatusUnauthorized).JSON(ErrorResponse{
-				Code:  UNAUTHORIZED,
-				Error: "unauthorized",
-			})
-		}
-		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: err.Error(),
-		})
-	}
-
-	if authKey.ForWorkspaceId == "" {
-		return c.Status(400).JSON(ErrorResponse{
-			Code:  BAD_REQUEST,
-			Error: "wrong key type",
-		})
+		return err
 	}
 
 	key, err := s.db.GetKeyById(ctx, req.KeyId)
 	if err != nil {
 		if errors.Is(err, database.ErrNotFound) {
 			return c.Status(http.StatusNotFound).JSON(ErrorResponse{
-				Code:  NOT_FOUND,
-				Error: fmt.Sprintf("key %s does not exist", req.KeyId),
+				Code:      NOT_FOUND,
+				Error:     fmt.Sprintf("key %s does not exist", req.KeyId),
+				RequestId: requestId(c),
 			})
 		}
 		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: err.Error(),
+			Code:      INTERNAL_SERVER_ERROR,
+			Error:     err.Error(),
+			RequestId: requestId(c),
 		})
 	}
 
 	if key.WorkspaceId != authKey.ForWorkspaceId {
 		return c.Status(http.StatusUnauthorized).JSON(ErrorResponse{
-			Code:  UNAUTHORIZED,
-			Error: "access to workspace denied",
+			Code:      UNAUTHORIZED,
+			Error:     "access to workspace denied",
+			RequestId: requestId(c),
 		})
 	}
 
 	err = s.db.DeleteKey(ctx, key.Id)
 	if err != nil {
 		return c.Status(http.StatusUnauthorized).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: fmt.Sprintf("unable to delete key %s", err.Error()),
+			Code:      INTERNAL_SERVER_ERROR,
+			Error:     fmt.Sprintf("unable to delete key %s", err.Error()),
+			RequestId: requestId(c),
 		})
 	}
 	if s.kafka != nil {
@@ -99,5 +91,11 @@ func (s *Server) deleteKey(c *fiber.Ctx) error {
 			s.logger.Error("unable to emit keyDeletedEvent", zap.Error(err))
 		}
 	}
+	s.appendAuditLog(ctx, c, audit.Entry{
+		WorkspaceId: key.WorkspaceId,
+		ActorKeyId:  authKey.Id,
+		Action:      audit.KeyDeleted,
+		TargetKeyId: key.Id,
+	})
 	return c.JSON(DeleteKeyResponse{})
 }
@@ -36,7 +36,7 @@ func TestDeleteKey(t *testing.T) {
 		Id:          uid.Key(),
 		KeyAuthId:   resources.UserKeyAuth.Id,
 		WorkspaceId: resources.UserWorkspace.Id,
-		Hash:        hash.Sha256(uid.New(16, "test")),
+		Hash:        hash.Sha256(uid.New("test")),
 		CreatedAt:   time.Now(),
 	}
 	err = db.CreateKey(ctx, key)
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
 	"net/http"
 )
 
@@ -24,56 +25,60 @@ func (s *Server) getKey(c *fiber.Ctx) error {
 	err := s.validator.Struct(req)
 	if err != nil {
 		return c.Status(http.StatusBadRequest).JSON(ErrorResponse{
-			Code:  BAD_REQUEST,
-			Error: fmt.Sprintf("unable to validate request: %s", err.Error()),
+			Code:      BAD_REQUEST,
+			Error:     fmt.Sprintf("unable to validate request: %s", err.Error()),
+			RequestId: requestId(c),
 		})
 	}
 
-	authHash, err := getKeyHash(c.Get("Authorization"))
+	authKey, err := s.authenticateRootKey(ctx, c)
 	if err != nil {
 		return err
 	}
 
-	authKey, err := s.db.GetKeyByHash(ctx, authHash)
+	err = requireScope(authKey, entities.ScopeKeysRead)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: fmt.Sprintf("unable to find key: %s", err.Error()),
-		})
-	}
-
-	if authKey.ForWorkspaceId == "" {
-		return c.Status(http.StatusBadRequest).JSON(ErrorResponse{
-			Code:  BAD_REQUEST,
-			Error: "wrong key type",
-		})
+		return err
 	}
 
 	key, err := s.db.GetKeyById(ctx, req.KeyId)
 	if err != nil {
 		if errors.Is(err, database.ErrNotFound) {
 			return c.Status(http.StatusNotFound).JSON(ErrorResponse{
-				Code:  NOT_FOUND,
-				Error: fmt.Sprintf("unable to find key: %s", req.KeyId),
+				Code:      NOT_FOUND,
+				Error:     fmt.Sprintf("unable to find key: %s", req.KeyId),
+				RequestId: requestId(c),
 			})
 		}
 		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: fmt.Sprintf("unable to find key: %s", err.Error()),
+			Code:      INTERNAL_SERVER_ERROR,
+			Error:     fmt.Sprintf("unable to find key: %s", err.Error()),
+			RequestId: requestId(c),
 		})
 	}
 	if key.WorkspaceId != authKey.ForWorkspaceId {
 		return c.Status(http.StatusUnauthorized).JSON(ErrorResponse{
-			Code:  UNAUTHORIZED,
-			Error: "access to workspace denied",
+			Code:      UNAUTHORIZED,
+			Error:     "access to workspace denied",
+			RequestId: requestId(c),
 		})
 	}
 
 	api, err := s.db.GetApiByKeyAuthId(ctx, key.KeyAuthId)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: fmt.Sprintf("unable to find api: %s", err.Error()),
+			Code:      INTERNAL_SERVER_ERROR,
+			Error:     fmt.Sprintf("unable to find api: %s", err.Error()),
+			RequestId: requestId(c),
+		})
+	}
+
+	workspace, err := s.cachedWorkspace(ctx, key.WorkspaceId)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
+			Code:      INTERNAL_SERVER_ERROR,
+			Error:     fmt.Sprintf("unable to find workspace: %s", err.Error()),
+			RequestId: requestId(c),
 		})
 	}
 
@@ -81,11 +86,12 @@ func (s *Server) getKey(c *fiber.Ctx) error {
 		Id:             key.Id,
 		ApiId:          api.Id,
 		WorkspaceId:    key.WorkspaceId,
-		Start:          key.Start,
 		OwnerId:        key.OwnerId,
 		Meta:           key.Meta,
 		CreatedAt:      key.CreatedAt.UnixMilli(),
 		ForWorkspaceId: key.ForWorkspaceId,
+		ParentKeyId:    key.ParentKeyId,
+		Start:          s.keyStart(workspace, key),
 	}
 	if !key.Expires.IsZero() {
 		res.Expires = key.Expires.UnixMilli()
@@ -96,11 +102,15 @@ func (s *Server) getKey(c *fiber.Ctx) error {
 			Limit:          key.Ratelimit.Limit,
 			RefillRate:     key.Ratelimit.RefillRate,
 			RefillInterval: key.Ratelimit.RefillInterval,
+			CheckOrder:     ratelimitCheckOrder(key.Ratelimit),
 		}
 	}
 	if key.Remaining.Enabled {
 		res.Remaining = &key.Remaining.Remaining
 	}
+	if !key.LastUsedAt.IsZero() {
+		res.LastUsedAt = key.LastUsedAt.UnixMilli()
+	}
 
 	return c.JSON(res)
 }
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/keys"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type GetSelfKeyRequest struct {
+	Key string `json:"key" validate:"required"`
+}
+
+// GetSelfKeyResponse only contains data the holder of the key may see about it
+type GetSelfKeyResponse struct {
+	Id        string           `json:"id"`
+	Start     string           `json:"start"`
+	Name      string           `json:"name,omitempty"`
+	OwnerId   string           `json:"ownerId,omitempty"`
+	Meta      map[string]any   `json:"meta,omitempty"`
+	CreatedAt int64            `json:"createdAt"`
+	Expires   int64            `json:"expires,omitempty"`
+	Ratelimit *ratelimitSettng `json:"ratelimit,omitempty"`
+	Remaining *int64           `json:"remaining,omitempty"`
+	// Enabled is false if the key or its workspace has been suspended
+	Enabled bool `json:"enabled"`
+}
+
+// getSelfKey lets the holder of a key read its own details without a root key.
+// The key authenticates itself, so there is no way to ask for any other key.
+func (s *Server) getSelfKey(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.getSelfKey")
+	defer span.End()
+
+	req := GetSelfKeyRequest{}
+	err := c.BodyParser(&req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+	}
+
+	err = s.validator.Struct(req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to validate body: %s", err.Error()))
+	}
+
+	hashes, err := s.getKeyHashes(req.Key)
+	if err != nil {
+		return errs.NewUnauthorized("key is not valid")
+	}
+
+	key, hash, isCached := s.cachedKeyByHashes(ctx, hashes)
+	if !isCached {
+		key, hash, err = s.keyByHashes(ctx, hashes)
+		if err != nil {
+			if errors.Is(err, database.ErrNotFound) {
+				return errs.NewUnauthorized("key is not valid")
+			}
+			return errs.NewInternal(err, "unable to find key")
+		}
+		s.keyCache.Set(ctx, hash, key)
+	}
+	if !acceptsHash(key, hash, time.Now()) {
+		s.keyCache.Remove(ctx, hash)
+		return errs.NewUnauthorized("key is not valid")
+	}
+	span.SetAttributes(attribute.String("keyId", key.Id), attribute.String("workspaceId", key.WorkspaceId))
+
+	// expired keys are deleted on their next verification, until then they must look like they don't exist
+	if s.expired(key.Expires, time.Now()) {
+		return errs.NewUnauthorized("key is not valid")
+	}
+
+	workspace, isCached := s.workspaceCache.Get(ctx, key.WorkspaceId)
+	if !isCached {
+		workspace, err = s.db.GetWorkspace(ctx, key.WorkspaceId)
+		if err != nil {
+			return errs.NewInternal(err, "unable to find workspace")
+		}
+		s.workspaceCache.Set(ctx, key.WorkspaceId, workspace)
+	}
+
+	start := key.Start
+	if start == "" {
+		// the key was stored without a start, see entities.Workspace.OmitKeyStart, but the holder sent us the secret
+		start, _ = keys.Start(req.Key, s.keyStartChars)
+	}
+
+	res := GetSelfKeyResponse{
+		Id:        key.Id,
+		Start:     start,
+		Name:      key.Name,
+		OwnerId:   key.OwnerId,
+		Meta:      key.Meta,
+		CreatedAt: key.CreatedAt.UnixMilli(),
+		Enabled:   key.SuspendedAt.IsZero() && workspace.SuspendedAt.IsZero(),
+	}
+	if !key.Expires.IsZero() {
+		res.Expires = key.Expires.UnixMilli()
+	}
+	if key.Ratelimit != nil {
+		res.Ratelimit = &ratelimitSettng{
+			Type:           key.Ratelimit.Type,
+			Limit:          key.Ratelimit.Limit,
+			RefillRate:     key.Ratelimit.RefillRate,
+			RefillInterval: key.Ratelimit.RefillInterval,
+			CheckOrder:     ratelimitCheckOrder(key.Ratelimit),
+		}
+	}
+	if key.Remaining.Enabled {
+		remaining := key.Remaining.Remaining
+		res.Remaining = &remaining
+	}
+
+	return c.JSON(res)
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+func getSelf(t *testing.T, srv *Server, key string) (int, GetSelfKeyResponse) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/v1/keys.getSelf", bytes.NewBufferString(fmt.Sprintf(`{"key":"%s"}`, key)))
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	self := GetSelfKeyResponse{}
+	if res.StatusCode == 200 {
+		require.NoError(t, json.Unmarshal(body, &self))
+	}
+	return res.StatusCode, self
+}
+
+func TestGetSelfKey(t *testing.T) {
+	remaining := int64(7)
+	db := newMemoryDatabase()
+	db.addKey("mine", entities.Key{
+		Id:          "key_mine",
+		WorkspaceId: "ws_1",
+		Start:       "mine",
+		OwnerId:     "chronark",
+		Remaining: struct {
+			Enabled   bool
+			Remaining int64
+		}{Enabled: true, Remaining: remaining},
+	})
+	db.addKey("expired", entities.Key{
+		Id:          "key_expired",
+		WorkspaceId: "ws_1",
+		Expires:     time.Now().Add(-time.Minute),
+	})
+	db.addKey("disabled", entities.Key{
+		Id:          "key_disabled",
+		WorkspaceId: "ws_1",
+		SuspendedAt: time.Now(),
+	})
+	srv := newTestServer(t, withDatabase(db))
+
+	status, self := getSelf(t, srv, "mine")
+	require.Equal(t, 200, status)
+	require.Equal(t, "key_mine", self.Id)
+	require.Equal(t, "chronark", self.OwnerId)
+	require.True(t, self.Enabled)
+	require.NotNil(t, self.Remaining)
+	require.Equal(t, remaining, *self.Remaining)
+
+	status, self = getSelf(t, srv, "disabled")
+	require.Equal(t, 200, status)
+	require.Equal(t, "key_disabled", self.Id)
+	require.False(t, self.Enabled)
+
+	status, _ = getSelf(t, srv, "expired")
+	require.Equal(t, 401, status)
+
+	status, _ = getSelf(t, srv, "does_not_exist")
+	require.Equal(t, 401, status)
+}
+
+func TestGetSelfKey_SuspendedWorkspace(t *testing.T) {
+	db := newMemoryDatabase()
+	db.addWorkspace(entities.Workspace{Id: "ws_1", SuspendedAt: time.Now()})
+	db.addKey("mine", entities.Key{Id: "key_mine", WorkspaceId: "ws_1"})
+	srv := newTestServer(t, withDatabase(db))
+
+	status, self := getSelf(t, srv, "mine")
+	require.Equal(t, 200, status)
+	require.False(t, self.Enabled)
+}
@@ -44,7 +44,7 @@ func KeyGetKey_Simple(t *testing.T) {
 		Id:          uid.Key(),
 		KeyAuthId:   resources.UserKeyAuth.Id,
 		WorkspaceId: resources.UserWorkspace.Id,
-		Hash:        hash.Sha256(uid.New(16, "test")),
+		Hash:        hash.Sha256(uid.New("test")),
 		CreatedAt:   time.Now(),
 	}
 	err = db.CreateKey(ctx, key)
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+// A secret may be stored under more than one hash: with the active pepper, an older one, or none
+// at all, see hash.Hasher.Candidates. Lookups load all of them at once, prefer them in order and
+// use the hash that matched from then on, it is the one the key is stored and cached under.
+
+// keyByHashes loads the key stored under the first of the hashes that exists, and that hash.
+// It returns database.ErrNotFound if there is none. The database is asked once, however many hashes there are.
+func (s *Server) keyByHashes(ctx context.Context, hashes []string) (entities.Key, string, error) {
+	found, err := s.db.GetKeysByHashes(ctx, hashes)
+	if err != nil {
+		return entities.Key{}, "", err
+	}
+	key, h, ok := prefetchedKeyByHashes(found, hashes)
+	if !ok {
+		return entities.Key{}, "", database.ErrNotFound
+	}
+	return key, h, nil
+}
+
+// cachedKeyByHashes returns the first key that is cached under one of the hashes, and that hash.
+func (s *Server) cachedKeyByHashes(ctx context.Context, hashes []string) (entities.Key, string, bool) {
+	for _, h := range hashes {
+		key, isCached := s.keyCache.Get(ctx, h)
+		if isCached {
+			return key, h, true
+		}
+	}
+	return entities.Key{}, "", false
+}
+
+// keyAndApiByHashes is keyByHashes, but also loads the api of the key.
+// Without a pepper there is a single hash, then the api is loaded in the same query as the key.
+// Otherwise the keys of all hashes are loaded in one query, and the api comes from the cache or a second one.
+func (s *Server) keyAndApiByHashes(ctx context.Context, hashes []string) (entities.Key, entities.Api, string, error) {
+	if len(hashes) == 1 {
+		key, api, err := s.db.GetKeyAndApiByHash(ctx, hashes[0])
+		if err != nil {
+			return entities.Key{}, entities.Api{}, "", err
+		}
+		return key, api, hashes[0], nil
+	}
+
+	key, h, err := s.keyByHashes(ctx, hashes)
+	if err != nil {
+		return entities.Key{}, entities.Api{}, "", err
+	}
+	api, isCached := s.apiCache.Get(ctx, key.KeyAuthId)
+	if !isCached {
+		api, err = s.db.GetApiByKeyAuthId(ctx, key.KeyAuthId)
+		if err != nil {
+			return entities.Key{}, entities.Api{}, "", err
+		}
+	}
+	return key, api, h, nil
+}
+
+// prefetchedKeyByHashes is cachedKeyByHashes for keys loaded with GetKeysByHashes.
+func prefetchedKeyByHashes(prefetched map[string]entities.Key, hashes []string) (entities.Key, string, bool) {
+	for _, h := range hashes {
+		key, found := prefetched[h]
+		if found {
+			return key, h, true
+		}
+	}
+	return entities.Key{}, "", false
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/cache"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/tracing"
+)
+
+// pepperDatabase stores keys by their hash, like the unique hash index of the real database
+type pepperDatabase struct {
+	quotaDatabase
+	keys map[string]entities.Key
+}
+
+// storedKeys keys the keys by their hash
+func storedKeys(keys ...entities.Key) map[string]entities.Key {
+	stored := map[string]entities.Key{}
+	for _, k := range keys {
+		stored[k.Hash] = k
+	}
+	return stored
+}
+
+func (db *pepperDatabase) GetKeyByHash(ctx context.Context, h string) (entities.Key, error) {
+	key, ok := db.keys[h]
+	if !ok {
+		return entities.Key{}, database.ErrNotFound
+	}
+	return key, nil
+}
+
+func (db *pepperDatabase) GetKeyAndApiByHash(ctx context.Context, h string) (entities.Key, entities.Api, error) {
+	key, err := db.GetKeyByHash(ctx, h)
+	if err != nil {
+		return entities.Key{}, entities.Api{}, err
+	}
+	api, _ := db.GetApiByKeyAuthId(ctx, key.KeyAuthId)
+	return key, api, nil
+}
+
+func (db *pepperDatabase) GetKeysByHashes(ctx context.Context, hashes []string) (map[string]entities.Key, error) {
+	found := map[string]entities.Key{}
+	for _, h := range hashes {
+		if key, ok := db.keys[h]; ok {
+			found[h] = key
+		}
+	}
+	return found, nil
+}
+
+func (db *pepperDatabase) GetKeyAuth(ctx context.Context, keyAuthId string) (entities.KeyAuth, error) {
+	return entities.KeyAuth{Id: keyAuthId, WorkspaceId: "ws_1"}, nil
+}
+
+func (db *pepperDatabase) GetApiByKeyAuthId(ctx context.Context, keyAuthId string) (entities.Api, error) {
+	return entities.Api{Id: "api_1", WorkspaceId: "ws_1", KeyAuthId: keyAuthId, AuthType: entities.AuthTypeKey}, nil
+}
+
+func (db *pepperDatabase) CreateKey(ctx context.Context, newKey entities.Key) error {
+	db.keys[newKey.Hash] = newKey
+	return db.quotaDatabase.CreateKey(ctx, newKey)
+}
+
+func (db *pepperDatabase) TouchKeyLastUsed(ctx context.Context, keyId string, ts time.Time) error {
+	return nil
+}
+
+func TestPepper(t *testing.T) {
+	peppers := map[int][]byte{1: bytes.Repeat([]byte{1}, hash.MinPepperSize), 2: bytes.Repeat([]byte{2}, hash.MinPepperSize)}
+	hasher, err := hash.NewHasher(peppers, 2)
+	require.NoError(t, err)
+
+	db := &pepperDatabase{
+		quotaDatabase: quotaDatabase{workspace: entities.Workspace{Id: "ws_1"}},
+		keys: storedKeys(
+			entities.Key{Id: "key_root", ForWorkspaceId: "ws_1", Hash: hasher.Hash("root_key")},
+			// created before there was a pepper
+			entities.Key{Id: "key_unpeppered", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Hash: hash.Sha256("unpeppered_key")},
+			// created before the pepper was rotated
+			entities.Key{Id: "key_old", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Hash: hash.Sha256WithPepper("old_key", 1, peppers[1])},
+		),
+	}
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: db,
+		Tracer:   tracing.NewNoop(),
+		Hasher:   hasher,
+	})
+
+	req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(`{"apiId":"api_1"}`))
+	req.Header.Set("Authorization", "Bearer root_key")
+	req.Header.Set("Content-Type", "application/json")
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 200, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	created := CreateKeyResponse{}
+	require.NoError(t, json.Unmarshal(body, &created))
+
+	require.Len(t, db.created, 1)
+	require.Equal(t, 2, hash.PepperVersion(db.created[0].Hash))
+	require.NotEqual(t, hash.Sha256(created.Key), db.created[0].Hash)
+
+	verify := func(key string) bool {
+		req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(fmt.Sprintf(`{"key":%q}`, key)))
+		req.Header.Set("Content-Type", "application/json")
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		if res.StatusCode == 401 {
+			return false
+		}
+		require.Equal(t, 200, res.StatusCode)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		verifyRes := VerifyKeyResponse{}
+		require.NoError(t, json.Unmarshal(body, &verifyRes))
+		return verifyRes.Valid
+	}
+
+	require.True(t, verify(created.Key))
+	require.True(t, verify("unpeppered_key"))
+	require.True(t, verify("old_key"))
+	require.False(t, verify("unknown_key"))
+
+	// a leaked hash of a peppered key is useless without the pepper
+	withoutPepper := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: db,
+		Tracer:   tracing.NewNoop(),
+	})
+	srv = withoutPepper
+	require.False(t, verify(created.Key))
+	require.True(t, verify("unpeppered_key"))
+}
+
+func TestPepper_VerifyBatch(t *testing.T) {
+	peppers := map[int][]byte{1: bytes.Repeat([]byte{1}, hash.MinPepperSize)}
+	hasher, err := hash.NewHasher(peppers, 1)
+	require.NoError(t, err)
+
+	db := &pepperDatabase{
+		quotaDatabase: quotaDatabase{workspace: entities.Workspace{Id: "ws_1"}},
+		keys: storedKeys(
+			entities.Key{Id: "key_peppered", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Hash: hasher.Hash("peppered_key")},
+			entities.Key{Id: "key_unpeppered", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Hash: hash.Sha256("unpeppered_key")},
+		),
+	}
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: db,
+		Tracer:   tracing.NewNoop(),
+		Hasher:   hasher,
+	})
+
+	req := httptest.NewRequest("POST", "/v1/keys.verifyBatch", bytes.NewBufferString(`{"keys":["peppered_key","unpeppered_key","unknown_key"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 200, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	batchRes := VerifyKeysBatchResponse{}
+	require.NoError(t, json.Unmarshal(body, &batchRes))
+	require.Len(t, batchRes.Results, 3)
+	require.True(t, batchRes.Results[0].Valid)
+	require.True(t, batchRes.Results[1].Valid)
+	require.False(t, batchRes.Results[2].Valid)
+}
+
+func TestPepper_LooksUpAllHashesAtOnce(t *testing.T) {
+	peppers := map[int][]byte{1: bytes.Repeat([]byte{1}, hash.MinPepperSize), 2: bytes.Repeat([]byte{2}, hash.MinPepperSize)}
+	hasher, err := hash.NewHasher(peppers, 2)
+	require.NoError(t, err)
+
+	db := newMemoryDatabase()
+	db.addKey(testRootKey, entities.Key{Id: testRootKeyId, ForWorkspaceId: "ws_1", Hash: hash.Sha256WithPepper(testRootKey, 1, peppers[1])})
+	// the same secret under two hashes, the active pepper comes first
+	db.addKey("some_key", entities.Key{Id: "key_unpeppered", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", OwnerId: "unpeppered"})
+	db.addKey("some_key", entities.Key{Id: "key_peppered", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Hash: hasher.Hash("some_key"), OwnerId: "peppered"})
+	srv := newTestServer(t, withDatabase(db), func(c *Config) {
+		c.Hasher = hasher
+	})
+
+	req := httptest.NewRequest("GET", "/v1/keys.whoami", nil)
+	req.Header.Set("Authorization", "Bearer root_key")
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 200, res.StatusCode)
+	require.Equal(t, 1, db.callsOf("GetKeysByHashes"))
+
+	req = httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(`{"key":"some_key"}`))
+	req.Header.Set("Content-Type", "application/json")
+	res, err = srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 200, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	verifyRes := VerifyKeyResponse{}
+	require.NoError(t, json.Unmarshal(body, &verifyRes))
+	require.True(t, verifyRes.Valid)
+	require.Equal(t, "peppered", verifyRes.OwnerId)
+
+	require.Equal(t, 2, db.callsOf("GetKeysByHashes"))
+	require.Zero(t, db.callsOf("GetKeyByHash"))
+	require.Zero(t, db.callsOf("GetKeyAndApiByHash"))
+}
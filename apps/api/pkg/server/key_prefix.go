@@ -0,0 +1,32 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+// newReservedPrefixes normalizes the configured prefixes, so they can be matched case-insensitively
+func newReservedPrefixes(prefixes []string) map[string]bool {
+	reserved := map[string]bool{}
+	for _, prefix := range prefixes {
+		prefix = strings.ToLower(strings.TrimSpace(prefix))
+		if prefix != "" {
+			reserved[prefix] = true
+		}
+	}
+	return reserved
+}
+
+// validatePrefix rejects prefixes that are reserved, for example because they could be mistaken for our own keys.
+// Only the whole prefix is compared, reserving `root` does not reserve `rooted`.
+func (s *Server) validatePrefix(prefix string) error {
+	if !s.reservedPrefixes[strings.ToLower(prefix)] {
+		return nil
+	}
+	message := fmt.Sprintf("the prefix '%s' is reserved", prefix)
+	return errs.NewBadRequest(message).WithFieldErrors([]errs.FieldError{
+		{Field: "prefix", Constraint: "reserved", Message: message},
+	})
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
+	"github.com/unkeyed/unkey/apps/api/pkg/keys"
+	"github.com/unkeyed/unkey/apps/api/pkg/webhooks"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type RerollKeyRequest struct {
+	KeyId string `json:"keyId" validate:"required"`
+	// GracePeriod is how many milliseconds the old secret keeps verifying, at most 7 days.
+	// 0 invalidates the old secret immediately.
+	GracePeriod int64 `json:"gracePeriod" validate:"min=0,max=604800000"`
+}
+
+type RerollKeyResponse struct {
+	KeyId string `json:"keyId"`
+	// Key is the new secret, it is only returned once
+	Key   string `json:"key"`
+	Start string `json:"start"`
+	// PreviousExpires is when the old secret stops verifying, unix milli
+	PreviousExpires int64 `json:"previousExpires,omitempty"`
+}
+
+// rerollKey issues a new secret for a key, everything else about the key stays the same.
+func (s *Server) rerollKey(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.rerollKey")
+	defer span.End()
+
+	req := RerollKeyRequest{}
+	err := c.BodyParser(&req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+	}
+
+	err = s.validator.Struct(req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to validate body: %s", err.Error()))
+	}
+
+	authKey, err := s.authenticateRootKey(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	err = requireScope(authKey, entities.ScopeKeysUpdate)
+	if err != nil {
+		return err
+	}
+
+	// read on the primary, a replica may still serve the secret of a reroll that just happened
+	key, err := s.db.GetKeyById(database.WithPrimary(ctx), req.KeyId)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return errs.NewNotFound(fmt.Sprintf("unable to find key: %s", req.KeyId))
+		}
+		return errs.NewInternal(err, "unable to find key")
+	}
+	if key.WorkspaceId != authKey.ForWorkspaceId {
+		return errs.NewUnauthorized("access to workspace denied")
+	}
+	span.SetAttributes(attribute.String("keyId", key.Id), attribute.Int64("gracePeriod", req.GracePeriod))
+
+	workspace, err := s.cachedWorkspace(ctx, key.WorkspaceId)
+	if err != nil {
+		return errs.NewInternal(err, "unable to find workspace")
+	}
+
+	// keys are generated like the default of createKey unless they stored their format
+	format := entities.KeyFormat{ByteLength: 16, Encoding: string(keys.EncodingBase58)}
+	if key.Format != nil {
+		format = *key.Format
+	}
+	keyOpts := []keys.Option{keys.WithEncoding(keys.Encoding(format.Encoding)), keys.WithStartChars(s.keyStartChars)}
+	if format.Checksum {
+		keyOpts = append(keyOpts, keys.WithChecksum())
+	}
+	// keys stored without a start and without a secret lose their prefix, we can not know it
+	keyValue, start, err := keys.NewV1Key(s.prefixFromStart(s.derivedKeyStart(key)), format.ByteLength, keyOpts...)
+	if err != nil {
+		return errs.NewInternal(err, "unable to generate key")
+	}
+
+	// every hash that may still be cached, on this node or others
+	staleHashes := []string{key.Hash}
+	if key.PreviousHash != "" {
+		staleHashes = append(staleHashes, key.PreviousHash)
+	}
+
+	if req.GracePeriod > 0 {
+		key.PreviousHash = key.Hash
+		key.PreviousHashExpires = time.Now().Add(time.Duration(req.GracePeriod) * time.Millisecond)
+	} else {
+		key.PreviousHash = ""
+		key.PreviousHashExpires = time.Time{}
+	}
+	key.Hash = s.hasher.Hash(keyValue)
+	key.Start = start
+	if workspace.OmitKeyStart {
+		key.Start = ""
+	}
+	if key.Encrypted != "" {
+		if s.keyring == nil {
+			return errs.NewInternal(errors.New("no keyring configured"), "unable to encrypt key")
+		}
+		key.Encrypted, err = s.keyring.Encrypt(key.WorkspaceId, keyValue)
+		if err != nil {
+			return errs.NewInternal(err, "unable to encrypt key")
+		}
+	}
+
+	err = s.db.UpdateKeySecret(ctx, key)
+	if err != nil {
+		return errs.NewInternal(err, "unable to update key")
+	}
+	for _, h := range staleHashes {
+		s.keyCache.Remove(ctx, h)
+		// other nodes evict the hash in the event and load the key again by its id
+		s.produceKeyEvent(ctx, kafka.KeyUpdated, key.Id, h)
+	}
+	s.emitWebhook(webhooks.NewEvent(webhooks.KeyUpdated, key.WorkspaceId, webhookKey(key)))
+	s.appendAuditLog(ctx, c, audit.Entry{
+		WorkspaceId: key.WorkspaceId,
+		ActorKeyId:  authKey.Id,
+		Action:      audit.KeyUpdated,
+		TargetKeyId: key.Id,
+		Reason:      "secret rerolled",
+	})
+
+	res := RerollKeyResponse{
+		KeyId: key.Id,
+		Key:   keyValue,
+		Start: start,
+	}
+	if key.PreviousHash != "" {
+		res.PreviousExpires = key.PreviousHashExpires.UnixMilli()
+	}
+	return c.JSON(res)
+}
+
+// acceptsHash returns whether a key may be used with the secret that hashes to h.
+// The cache and the database also find rerolled keys by their previous hash, so it must be checked
+// again after the grace period expires.
+func acceptsHash(key entities.Key, h string, now time.Time) bool {
+	if key.Hash == h {
+		return true
+	}
+	return key.PreviousHash == h && now.Before(key.PreviousHashExpires)
+}
+
+// prefixFromStart also recognises keys created before the number of revealed characters was configured
+func (s *Server) prefixFromStart(start string) string {
+	prefix := keys.PrefixFromStart(start, s.keyStartChars)
+	if prefix == "" {
+		prefix = keys.PrefixFromStart(start, keys.DefaultStartChars)
+	}
+	return prefix
+}
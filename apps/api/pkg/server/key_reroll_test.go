@@ -0,0 +1,304 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/encryption"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/keys"
+)
+
+// mapCache never expires, so it keeps serving keys under hashes that are no longer valid
+type mapCache[T any] struct {
+	sync.Mutex
+	data map[string]T
+}
+
+func (c *mapCache[T]) Get(ctx context.Context, key string) (T, bool) {
+	c.Lock()
+	defer c.Unlock()
+	v, ok := c.data[key]
+	return v, ok
+}
+
+func (c *mapCache[T]) Set(ctx context.Context, key string, value T) {
+	c.Lock()
+	defer c.Unlock()
+	c.data[key] = value
+}
+
+func (c *mapCache[T]) Remove(ctx context.Context, key string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.data, key)
+}
+
+// rerolledKeyId is the id of the key newRerollServer returns the secret of
+const rerolledKeyId = "key_1"
+
+func newRerollServer(t *testing.T) (*Server, *memoryDatabase, *mapCache[entities.Key], string) {
+	t.Helper()
+	keyValue, start, err := keys.NewV1Key("sk", 16)
+	require.NoError(t, err)
+
+	db := newMemoryDatabase()
+	db.addKey(keyValue, entities.Key{
+		Id:          rerolledKeyId,
+		KeyAuthId:   "key_auth_1",
+		WorkspaceId: "ws_1",
+		Start:       start,
+		OwnerId:     "chronark",
+		Meta:        map[string]any{"plan": "pro"},
+	})
+	keyCache := &mapCache[entities.Key]{data: map[string]entities.Key{}}
+	srv := newTestServer(t, withDatabase(db), func(c *Config) {
+		c.KeyCache = keyCache
+		c.ApiCache = &mapCache[entities.Api]{data: map[string]entities.Api{}}
+	})
+	return srv, db, keyCache, keyValue
+}
+
+func rerollKey(t *testing.T, srv *Server, body string) (int, RerollKeyResponse) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/v1/keys.rerollHash", bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer root_key")
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	buf, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	rerollRes := RerollKeyResponse{}
+	if res.StatusCode == 200 {
+		require.NoError(t, json.Unmarshal(buf, &rerollRes))
+	}
+	return res.StatusCode, rerollRes
+}
+
+func verify(t *testing.T, srv *Server, key string) bool {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(fmt.Sprintf(`{"key":%q}`, key)))
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	buf, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	verifyRes := VerifyKeyResponse{}
+	require.NoError(t, json.Unmarshal(buf, &verifyRes))
+	return verifyRes.Valid
+}
+
+func TestRerollKey_WithoutGracePeriod(t *testing.T) {
+	srv, db, _, oldKey := newRerollServer(t)
+	keyId := rerolledKeyId
+
+	// warm up the cache with the old secret
+	require.True(t, verify(t, srv, oldKey))
+
+	status, res := rerollKey(t, srv, fmt.Sprintf(`{"keyId":%q}`, keyId))
+	require.Equal(t, 200, status)
+	require.Equal(t, keyId, res.KeyId)
+	require.Equal(t, int64(0), res.PreviousExpires)
+	require.Regexp(t, `^sk_`, res.Key)
+	require.Equal(t, res.Key[:len(res.Start)], res.Start)
+
+	require.False(t, verify(t, srv, oldKey))
+	require.True(t, verify(t, srv, res.Key))
+
+	// everything but the secret stays the same
+	key, found := db.key(keyId)
+	require.True(t, found)
+	require.Equal(t, "chronark", key.OwnerId)
+	require.Equal(t, map[string]any{"plan": "pro"}, key.Meta)
+	require.Equal(t, "", key.PreviousHash)
+
+	srv.background.Wait()
+	require.Len(t, db.auditLogs, 1)
+	require.Equal(t, audit.KeyUpdated, db.auditLogs[0].Action)
+}
+
+func TestRerollKey_GracePeriodOverlap(t *testing.T) {
+	srv, _, keyCache, oldKey := newRerollServer(t)
+
+	status, res := rerollKey(t, srv, fmt.Sprintf(`{"keyId":%q,"gracePeriod":100}`, rerolledKeyId))
+	require.Equal(t, 200, status)
+	require.Greater(t, res.PreviousExpires, time.Now().UnixMilli())
+
+	// both secrets verify during the grace period
+	require.True(t, verify(t, srv, oldKey))
+	require.True(t, verify(t, srv, res.Key))
+	_, oldIsCached := keyCache.Get(context.Background(), hash.Sha256(oldKey))
+	require.True(t, oldIsCached)
+
+	time.Sleep(150 * time.Millisecond)
+
+	// the old secret stops verifying even though it is still cached
+	require.False(t, verify(t, srv, oldKey))
+	require.True(t, verify(t, srv, res.Key))
+}
+
+func TestRerollKey_SecondRerollEndsGracePeriod(t *testing.T) {
+	srv, _, _, oldKey := newRerollServer(t)
+
+	status, first := rerollKey(t, srv, fmt.Sprintf(`{"keyId":%q,"gracePeriod":60000}`, rerolledKeyId))
+	require.Equal(t, 200, status)
+	require.True(t, verify(t, srv, oldKey))
+
+	status, second := rerollKey(t, srv, fmt.Sprintf(`{"keyId":%q,"gracePeriod":60000}`, rerolledKeyId))
+	require.Equal(t, 200, status)
+
+	require.False(t, verify(t, srv, oldKey))
+	require.True(t, verify(t, srv, first.Key))
+	require.True(t, verify(t, srv, second.Key))
+}
+
+func TestRerollKey_ZeroStartChars(t *testing.T) {
+	srv, _, _, _ := newRerollServer(t)
+	// the key was created while the default number of characters was revealed
+	srv.keyStartChars = 0
+
+	status, first := rerollKey(t, srv, fmt.Sprintf(`{"keyId":%q}`, rerolledKeyId))
+	require.Equal(t, 200, status)
+	require.Equal(t, "sk_", first.Start)
+	require.Regexp(t, `^sk_`, first.Key)
+
+	status, second := rerollKey(t, srv, fmt.Sprintf(`{"keyId":%q}`, rerolledKeyId))
+	require.Equal(t, 200, status)
+	require.Equal(t, "sk_", second.Start)
+	require.True(t, verify(t, srv, second.Key))
+}
+
+func TestRerollKey_Recoverable(t *testing.T) {
+	srv, db, _, oldKey := newRerollServer(t)
+	keyring, err := encryption.NewKeyring(map[int][]byte{1: bytes.Repeat([]byte{1}, encryption.KeySize)}, 1)
+	require.NoError(t, err)
+	srv.keyring = keyring
+	key, _ := db.key(rerolledKeyId)
+	key.Encrypted, err = keyring.Encrypt(key.WorkspaceId, oldKey)
+	require.NoError(t, err)
+	db.addKey(oldKey, key)
+
+	status, res := rerollKey(t, srv, fmt.Sprintf(`{"keyId":%q}`, rerolledKeyId))
+	require.Equal(t, 200, status)
+
+	// the new secret is recovered, not the one it replaced
+	key, _ = db.key(rerolledKeyId)
+	recovered, err := keyring.Decrypt(key.WorkspaceId, key.Encrypted)
+	require.NoError(t, err)
+	require.Equal(t, res.Key, recovered)
+}
+
+func TestRerollKey_OmittedStartKeepsPrefix(t *testing.T) {
+	srv, db, _, oldKey := newRerollServer(t)
+	keyring, err := encryption.NewKeyring(map[int][]byte{1: bytes.Repeat([]byte{1}, encryption.KeySize)}, 1)
+	require.NoError(t, err)
+	srv.keyring = keyring
+	db.addWorkspace(entities.Workspace{Id: "ws_1", OmitKeyStart: true})
+	key, _ := db.key(rerolledKeyId)
+	key.Start = ""
+	key.Encrypted, err = keyring.Encrypt(key.WorkspaceId, oldKey)
+	require.NoError(t, err)
+	db.addKey(oldKey, key)
+
+	status, res := rerollKey(t, srv, fmt.Sprintf(`{"keyId":%q}`, rerolledKeyId))
+	require.Equal(t, 200, status)
+
+	// the prefix comes from the old secret, and the new start is only returned, not stored
+	require.True(t, strings.HasPrefix(res.Key, "sk_"), res.Key)
+	require.True(t, strings.HasPrefix(res.Start, "sk_"), res.Start)
+	key, _ = db.key(rerolledKeyId)
+	require.Empty(t, key.Start)
+}
+
+func TestRerollKey_Rejects(t *testing.T) {
+	srv, _, _, _ := newRerollServer(t)
+
+	status, _ := rerollKey(t, srv, `{"keyId":"key_unknown"}`)
+	require.Equal(t, 404, status)
+
+	status, _ = rerollKey(t, srv, fmt.Sprintf(`{"keyId":%q,"gracePeriod":-1}`, rerolledKeyId))
+	require.Equal(t, 400, status)
+
+	status, _ = rerollKey(t, srv, fmt.Sprintf(`{"keyId":%q,"gracePeriod":604800001}`, rerolledKeyId))
+	require.Equal(t, 400, status)
+}
+
+// verifyingDatabase uses up a verification of the key right after reroll has read it, like a
+// verification of the old secret that runs concurrently
+type verifyingDatabase struct {
+	*memoryDatabase
+	readsPrimary bool
+}
+
+func (db *verifyingDatabase) GetKeyById(ctx context.Context, keyId string) (entities.Key, error) {
+	key, err := db.memoryDatabase.GetKeyById(ctx, keyId)
+	db.readsPrimary = database.ReadsPrimary(ctx)
+	stored, _ := db.memoryDatabase.key(keyId)
+	stored.Remaining.Remaining--
+	db.memoryDatabase.addKey("", stored)
+	return key, err
+}
+
+func TestRerollKey_KeepsConcurrentChanges(t *testing.T) {
+	srv, db, _, _ := newRerollServer(t)
+	key, _ := db.key(rerolledKeyId)
+	key.Remaining.Enabled = true
+	key.Remaining.Remaining = 10
+	db.addKey("", key)
+	verifying := &verifyingDatabase{memoryDatabase: db}
+	srv.db = verifying
+
+	status, res := rerollKey(t, srv, fmt.Sprintf(`{"keyId":%q}`, rerolledKeyId))
+	require.Equal(t, 200, status)
+	require.True(t, verifying.readsPrimary)
+
+	// only the secret is written, the verification that happened in between is kept
+	require.Equal(t, 0, db.callsOf("UpdateKey"))
+	key, _ = db.key(rerolledKeyId)
+	require.Equal(t, int64(9), key.Remaining.Remaining)
+	require.Equal(t, hash.Sha256(res.Key), key.Hash)
+}
+
+func TestRerollKey_KeepsFormat(t *testing.T) {
+	srv, db, _, _ := newRerollServer(t)
+	format := &entities.KeyFormat{ByteLength: 32, Encoding: string(keys.EncodingBase64Url), Checksum: true}
+	key, _ := db.key(rerolledKeyId)
+	key.Format = format
+	db.addKey("", key)
+
+	status, res := rerollKey(t, srv, fmt.Sprintf(`{"keyId":%q}`, rerolledKeyId))
+	require.Equal(t, 200, status)
+
+	// base64url has a fixed length, which tells the byte length and the checksum apart
+	withChecksum, _, err := keys.NewV1Key("sk", 32, keys.WithEncoding(keys.EncodingBase64Url), keys.WithChecksum())
+	require.NoError(t, err)
+	withoutChecksum, _, err := keys.NewV1Key("sk", 32, keys.WithEncoding(keys.EncodingBase64Url))
+	require.NoError(t, err)
+	require.NotEqual(t, len(withChecksum), len(withoutChecksum))
+	require.Len(t, res.Key, len(withChecksum))
+	require.Regexp(t, `^sk_[A-Za-z0-9_-]+$`, res.Key)
+
+	key, _ = db.key(rerolledKeyId)
+	require.Equal(t, format, key.Format)
+	require.True(t, verify(t, srv, res.Key))
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
+)
+
+type SetKeyEnabledRequest struct {
+	KeyId   string `json:"keyId" validate:"required"`
+	Enabled *bool  `json:"enabled" validate:"required"`
+}
+
+type SetKeyEnabledResponse struct {
+	Enabled bool `json:"enabled"`
+}
+
+func (s *Server) setKeyEnabled(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.setKeyEnabled")
+	defer span.End()
+
+	req := SetKeyEnabledRequest{}
+	err := c.BodyParser(&req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+	}
+
+	err = s.validator.Struct(req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to validate body: %s", err.Error()))
+	}
+
+	authKey, err := s.authenticateRootKey(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	err = requireScope(authKey, entities.ScopeKeysUpdate)
+	if err != nil {
+		return err
+	}
+
+	key, err := s.db.GetKeyById(ctx, req.KeyId)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return errs.NewNotFound(fmt.Sprintf("unable to find key: %s", req.KeyId))
+		}
+		return errs.NewInternal(err, "unable to find key")
+	}
+	if key.WorkspaceId != authKey.ForWorkspaceId {
+		return errs.NewUnauthorized("access to workspace denied")
+	}
+
+	err = s.db.SetKeyEnabled(ctx, key.Id, *req.Enabled)
+	if err != nil {
+		return errs.NewInternal(err, "unable to update key")
+	}
+	s.keyCache.Remove(ctx, key.Hash)
+	s.emitKeyEvent(ctx, kafka.KeyUpdated, key)
+	reason := "key disabled"
+	if *req.Enabled {
+		reason = "key enabled"
+	}
+	s.appendAuditLog(ctx, c, audit.Entry{
+		WorkspaceId: key.WorkspaceId,
+		ActorKeyId:  authKey.Id,
+		Action:      audit.KeyUpdated,
+		TargetKeyId: key.Id,
+		Reason:      reason,
+	})
+
+	return c.JSON(SetKeyEnabledResponse{
+		Enabled: *req.Enabled,
+	})
+}
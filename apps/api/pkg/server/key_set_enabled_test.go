@@ -0,0 +1,71 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+func TestSetKeyEnabled(t *testing.T) {
+	db := newMemoryDatabase()
+	db.addKey("some_key", entities.Key{Id: "key_1", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1"})
+	srv := newTestServer(t, withDatabase(db))
+
+	for _, enabled := range []bool{false, true} {
+		buf := bytes.NewBufferString(fmt.Sprintf(`{"keyId":"key_1","enabled":%t}`, enabled))
+		req := httptest.NewRequest("POST", "/v1/keys.setEnabled", buf)
+		req.Header.Set("Authorization", "Bearer root_key")
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, 200, res.StatusCode)
+
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		res.Body.Close()
+
+		setRes := SetKeyEnabledResponse{}
+		require.NoError(t, json.Unmarshal(body, &setRes))
+		require.Equal(t, enabled, setRes.Enabled)
+		key, _ := db.key("key_1")
+		require.Equal(t, enabled, key.SuspendedAt.IsZero())
+	}
+}
+
+func TestSetKeyEnabled_RequiresEnabled(t *testing.T) {
+	srv := newTestServer(t)
+
+	req := httptest.NewRequest("POST", "/v1/keys.setEnabled", bytes.NewBufferString(`{"keyId":"key_1"}`))
+	req.Header.Set("Authorization", "Bearer root_key")
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 400, res.StatusCode)
+}
+
+func TestSetKeyEnabled_OtherWorkspace(t *testing.T) {
+	db := newMemoryDatabase()
+	db.addWorkspace(entities.Workspace{Id: "ws_2"})
+	db.addRootKey("other_root_key", "ws_2")
+	db.addKey("some_key", entities.Key{Id: "key_1", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1"})
+	srv := newTestServer(t, withDatabase(db))
+
+	req := httptest.NewRequest("POST", "/v1/keys.setEnabled", bytes.NewBufferString(`{"keyId":"key_1","enabled":false}`))
+	req.Header.Set("Authorization", "Bearer other_root_key")
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 401, res.StatusCode)
+	require.Zero(t, db.callsOf("SetKeyEnabled"))
+}
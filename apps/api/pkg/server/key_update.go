@@ -8,8 +8,10 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
 	"github.com/unkeyed/unkey/apps/api/pkg/database"
 	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
 	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
 	"go.uber.org/zap"
 )
@@ -34,12 +36,15 @@ type UpdateKeyRequest struct {
 	Meta      nullish[map[string]any] `json:"meta"`
 	Expires   nullish[int64]          `json:"expires"`
 	Ratelimit nullish[struct {
-		Type           string `json:"type" validate:"required"`
-		Limit          int64  `json:"limit" validate:"required"`
-		RefillRate     int64  `json:"refillRate" validate:"required"`
-		RefillInterval int64  `json:"refillInterval" validate:"required"`
+		Type           string         `json:"type" validate:"required"`
+		Limit          int64          `json:"limit" validate:"required"`
+		RefillRate     int64          `json:"refillRate" validate:"required"`
+		RefillInterval RefillInterval `json:"refillInterval" validate:"required"`
+		CheckOrder     string         `json:"checkOrder" validate:"omitempty,oneof=remainingFirst ratelimitFirst"`
 	}] `json:"ratelimit"`
 	Remaining nullish[int64] `json:"remaining"`
+	// RemainingWarnThreshold requires remaining, null removes the warning
+	RemainingWarnThreshold nullish[int64] `json:"remainingWarnThreshold"`
 }
 
 type UpdateKeyResponse struct{}
@@ -54,9 +59,13 @@ func (s *Server) updateKey(c *fiber.Ctx) error {
 
 	err := c.BodyParser(&req)
 	if err != nil {
+		if isMetaTypeError(err) {
+			return errs.NewBadRequest("'meta' must be a json object")
+		}
 		return c.Status(http.StatusBadRequest).JSON(ErrorResponse{
-			Code:  BAD_REQUEST,
-			Error: fmt.Sprintf("unable to parse body: %s", err.Error()),
+			Code:      BAD_REQUEST,
+			Error:     fmt.Sprintf("unable to parse body: %s", err.Error()),
+			RequestId: requestId(c),
 		})
 	}
 
@@ -65,72 +74,78 @@ func (s *Server) updateKey(c *fiber.Ctx) error {
 	err = c.BodyParser(&req)
 	if err != nil {
 		return c.Status(http.StatusBadRequest).JSON(ErrorResponse{
-			Code:  BAD_REQUEST,
-			Error: fmt.Sprintf("unable to parse body: %s", err.Error()),
+			Code:      BAD_REQUEST,
+			Error:     fmt.Sprintf("unable to parse body: %s", err.Error()),
+			RequestId: requestId(c),
 		})
 	}
 
 	err = s.validator.Struct(req)
 	if err != nil {
 		return c.Status(http.StatusBadRequest).JSON(ErrorResponse{
-			Code:  BAD_REQUEST,
-			Error: fmt.Sprintf("unable to validate body: %s", err.Error()),
+			Code:      BAD_REQUEST,
+			Error:     fmt.Sprintf("unable to validate body: %s", err.Error()),
+			RequestId: requestId(c),
 		})
 	}
 
+	if req.Meta.Defined && req.Meta.Value != nil {
+		err = s.validateMeta(*req.Meta.Value)
+		if err != nil {
+			return err
+		}
+	}
+	if req.OwnerId.Defined && req.OwnerId.Value != nil {
+		err = s.validateOwnerId("ownerId", *req.OwnerId.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	if req.RemainingWarnThreshold.Defined && req.RemainingWarnThreshold.Value != nil && *req.RemainingWarnThreshold.Value < 0 {
+		return errs.NewBadRequest("'remainingWarnThreshold' must not be negative")
+	}
+
 	s.logger.Info("updating key", zap.Any("req", req))
-	if req.Expires.Defined && req.Expires.Value != nil && *req.Expires.Value > 0 && *req.Expires.Value < time.Now().UnixMilli() {
+	if req.Expires.Defined && req.Expires.Value != nil && expiryInPast(*req.Expires.Value, time.Now(), s.clockSkewTolerance) {
 		return c.Status(http.StatusBadRequest).JSON(
 			ErrorResponse{
-				Code:  BAD_REQUEST,
-				Error: "'expires' must be in the future, did you pass in a timestamp in seconds instead of milliseconds?",
+				Code:      BAD_REQUEST,
+				Error:     "'expires' must be in the future, did you pass in a timestamp in seconds instead of milliseconds?",
+				RequestId: requestId(c),
 			})
 	}
 
-	authHash, err := getKeyHash(c.Get("Authorization"))
+	authKey, err := s.authenticateRootKey(ctx, c)
 	if err != nil {
 		return err
 	}
 
-	authKey, err := s.db.GetKeyByHash(ctx, authHash)
+	err = requireScope(authKey, entities.ScopeKeysUpdate)
 	if err != nil {
-		if errors.Is(err, database.ErrNotFound) {
-			return c.Status(http.StatusUnauthorized).JSON(ErrorResponse{
-				Code:  UNAUTHORIZED,
-				Error: "unauthorized",
-			})
-		}
-
-		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: fmt.Sprintf("unable to find key: %s", err.Error()),
-		})
-	}
-
-	if authKey.ForWorkspaceId == "" {
-		return c.Status(http.StatusBadRequest).JSON(ErrorResponse{
-			Code:  BAD_REQUEST,
-			Error: "wrong key type",
-		})
+		return err
 	}
 
 	key, err := s.db.GetKeyById(ctx, req.KeyId)
 	if err != nil {
 		if errors.Is(err, database.ErrNotFound) {
 			return c.Status(http.StatusBadRequest).JSON(ErrorResponse{
-				Code:  BAD_REQUEST,
-				Error: "wrong keyId",
+				Code:      BAD_REQUEST,
+				Error:     "wrong keyId",
+				RequestId: requestId(c),
 			})
 		}
 		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: fmt.Sprintf("unable to find key: %s", err.Error()),
+			Code:      INTERNAL_SERVER_ERROR,
+			Error:     fmt.Sprintf("unable to find key: %s", err.Error()),
+			RequestId: requestId(c),
 		})
 	}
 	if key.WorkspaceId != authKey.ForWorkspaceId {
 		return c.Status(http.StatusUnauthorized).JSON(ErrorResponse{
-			Code:  UNAUTHORIZED,
-			Error: "access to workspace denied",
+			Code:      UNAUTHORIZED,
+			Error:     "access to workspace denied",
+			RequestId: requestId(c),
 		})
 	}
 
@@ -157,6 +172,10 @@ func (s *Server) updateKey(c *fiber.Ctx) error {
 		} else {
 			key.Meta = nil
 		}
+		err = s.validateMetaSchema(ctx, key, key.Meta)
+		if err != nil {
+			return err
+		}
 	}
 	if req.Expires.Defined {
 		if req.Expires.Value != nil {
@@ -171,7 +190,8 @@ func (s *Server) updateKey(c *fiber.Ctx) error {
 				Type:           req.Ratelimit.Value.Type,
 				Limit:          req.Ratelimit.Value.Limit,
 				RefillRate:     req.Ratelimit.Value.RefillRate,
-				RefillInterval: req.Ratelimit.Value.RefillInterval,
+				RefillInterval: int64(req.Ratelimit.Value.RefillInterval),
+				CheckOrder:     req.Ratelimit.Value.CheckOrder,
 			}
 		} else {
 			key.Ratelimit = nil
@@ -184,25 +204,32 @@ func (s *Server) updateKey(c *fiber.Ctx) error {
 		} else {
 			key.Remaining.Enabled = false
 			key.Remaining.Remaining = 0
+			// there is nothing left to warn about
+			key.RemainingWarnThreshold = nil
+		}
+	}
+	if req.RemainingWarnThreshold.Defined {
+		if req.RemainingWarnThreshold.Value != nil && !key.Remaining.Enabled {
+			return errs.NewBadRequest("'remainingWarnThreshold' requires the key to have 'remaining'")
 		}
+		key.RemainingWarnThreshold = req.RemainingWarnThreshold.Value
 	}
 
 	err = s.db.UpdateKey(ctx, key)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: fmt.Sprintf("unable to write key: %s", err.Error()),
+			Code:      INTERNAL_SERVER_ERROR,
+			Error:     fmt.Sprintf("unable to write key: %s", err.Error()),
+			RequestId: requestId(c),
 		})
 	}
-	if s.kafka != nil {
-
-		go func() {
-			err := s.kafka.ProduceKeyEvent(ctx, kafka.KeyUpdated, key.Id, key.Hash)
-			if err != nil {
-				s.logger.Error("unable to emit key event to kafka", zap.Error(err))
-			}
-		}()
-	}
+	s.emitKeyEvent(ctx, kafka.KeyUpdated, key)
+	s.appendAuditLog(ctx, c, audit.Entry{
+		WorkspaceId: key.WorkspaceId,
+		ActorKeyId:  authKey.Id,
+		Action:      audit.KeyUpdated,
+		TargetKeyId: key.Id,
+	})
 
 	return c.JSON(UpdateKeyResponse{})
 }
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
+)
+
+type UpdateMetaMode string
+
+const (
+	// The new meta replaces the existing one, `null` removes all meta
+	UpdateMetaModeReplace UpdateMetaMode = "replace"
+	// Top level fields are merged into the existing meta, fields set to `null` are removed
+	UpdateMetaModeMerge UpdateMetaMode = "merge"
+)
+
+type UpdateKeyMetaRequest struct {
+	KeyId string         `json:"keyId" validate:"required"`
+	Mode  UpdateMetaMode `json:"mode" validate:"required,oneof=replace merge"`
+	Meta  map[string]any `json:"meta"`
+}
+
+type UpdateKeyMetaResponse struct {
+	Meta map[string]any `json:"meta"`
+}
+
+func (s *Server) updateKeyMeta(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.updateKeyMeta")
+	defer span.End()
+
+	req := UpdateKeyMetaRequest{}
+	err := c.BodyParser(&req)
+	if err != nil {
+		if isMetaTypeError(err) {
+			return errs.NewBadRequest("'meta' must be a json object")
+		}
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+	}
+
+	err = s.validator.Struct(req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to validate body: %s", err.Error()))
+	}
+
+	authKey, err := s.authenticateRootKey(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	err = requireScope(authKey, entities.ScopeKeysUpdate)
+	if err != nil {
+		return err
+	}
+
+	key, err := s.db.GetKeyById(ctx, req.KeyId)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return errs.NewNotFound(fmt.Sprintf("unable to find key: %s", req.KeyId))
+		}
+		return errs.NewInternal(err, "unable to find key")
+	}
+	if key.WorkspaceId != authKey.ForWorkspaceId {
+		return errs.NewUnauthorized("access to workspace denied")
+	}
+
+	meta := req.Meta
+	if req.Mode == UpdateMetaModeMerge {
+		meta = mergeMeta(key.Meta, req.Meta)
+	}
+
+	err = s.validateMeta(meta)
+	if err != nil {
+		return err
+	}
+
+	err = s.validateMetaSchema(ctx, key, meta)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.UpdateKeyMeta(ctx, key.Id, meta)
+	if err != nil {
+		return errs.NewInternal(err, "unable to update meta")
+	}
+	s.emitKeyEvent(ctx, kafka.KeyUpdated, key)
+	s.appendAuditLog(ctx, c, audit.Entry{
+		WorkspaceId: key.WorkspaceId,
+		ActorKeyId:  authKey.Id,
+		Action:      audit.KeyUpdated,
+		TargetKeyId: key.Id,
+		Reason:      fmt.Sprintf("meta updated in %s mode", req.Mode),
+	})
+
+	return c.JSON(UpdateKeyMetaResponse{
+		Meta: meta,
+	})
+}
+
+// mergeMeta does a shallow merge of patch into existing without modifying either.
+// Fields that are `nil` in patch are removed.
+// Returns nil if no fields remain.
+func mergeMeta(existing, patch map[string]any) map[string]any {
+	merged := make(map[string]any, len(existing)+len(patch))
+	for k, v := range existing {
+		merged[k] = v
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = v
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/testutil"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+func TestMergeMeta_DeletesNestedKey(t *testing.T) {
+	existing := map[string]any{
+		"plan": "pro",
+		"billing": map[string]any{
+			"customerId": "cus_123",
+		},
+	}
+
+	merged := mergeMeta(existing, map[string]any{"billing": nil, "seats": float64(5)})
+
+	require.Equal(t, map[string]any{"plan": "pro", "seats": float64(5)}, merged)
+	// existing must not be modified
+	require.Contains(t, existing, "billing")
+}
+
+func TestMergeMeta_IntoNilMeta(t *testing.T) {
+	merged := mergeMeta(nil, map[string]any{"plan": "pro"})
+	require.Equal(t, map[string]any{"plan": "pro"}, merged)
+
+	require.Nil(t, mergeMeta(nil, map[string]any{"plan": nil}))
+}
+
+func TestUpdateKeyMeta_Merge(t *testing.T) {
+	ctx := context.Background()
+
+	resources := testutil.SetupResources(t)
+
+	db, err := database.New(database.Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(t, err)
+
+	srv := newTestServer(t, withDatabase(db))
+
+	key := entities.Key{
+		Id:          uid.Key(),
+		KeyAuthId:   resources.UserKeyAuth.Id,
+		WorkspaceId: resources.UserWorkspace.Id,
+		Hash:        hash.Sha256(uid.New("test")),
+		Meta:        map[string]any{"plan": "free", "nested": map[string]any{"a": "b"}},
+		CreatedAt:   time.Now(),
+	}
+	require.NoError(t, db.CreateKey(ctx, key))
+
+	buf := bytes.NewBufferString(fmt.Sprintf(`{
+		"keyId":"%s",
+		"mode":"merge",
+		"meta": {"plan":"pro","nested":null}
+		}`, key.Id))
+
+	req := httptest.NewRequest("POST", "/v1/keys.updateMeta", buf)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", resources.UnkeyKey))
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, 200, res.StatusCode)
+
+	updateResponse := UpdateKeyMetaResponse{}
+	err = json.Unmarshal(body, &updateResponse)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"plan": "pro"}, updateResponse.Meta)
+
+	found, err := db.GetKeyById(ctx, key.Id)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"plan": "pro"}, found.Meta)
+}
+
+func TestUpdateKeyMeta_RejectsUnknownMode(t *testing.T) {
+	srv := newTestServer(t)
+
+	req := httptest.NewRequest("POST", "/v1/keys.updateMeta", bytes.NewBufferString(`{"keyId":"key_123","mode":"append","meta":{}}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 400, res.StatusCode)
+}
@@ -43,7 +43,7 @@ func TestUpdateKey_UpdateAll(t *testing.T) {
 		Id:          uid.Key(),
 		KeyAuthId:   resources.UserKeyAuth.Id,
 		WorkspaceId: resources.UserWorkspace.Id,
-		Hash:        hash.Sha256(uid.New(16, "test")),
+		Hash:        hash.Sha256(uid.New("test")),
 		CreatedAt:   time.Now(),
 	}
 	err = db.CreateKey(ctx, key)
@@ -108,7 +108,7 @@ func TestUpdateKey_UpdateOnlyRatelimit(t *testing.T) {
 		Id:          uid.Key(),
 		KeyAuthId:   resources.UserKeyAuth.Id,
 		WorkspaceId: resources.UserWorkspace.Id,
-		Hash:        hash.Sha256(uid.New(16, "test")),
+		Hash:        hash.Sha256(uid.New("test")),
 		CreatedAt:   time.Now(),
 		Name:        "original",
 	}
@@ -169,7 +169,7 @@ func TestUpdateKey_DeleteExpires(t *testing.T) {
 		Id:          uid.Key(),
 		KeyAuthId:   resources.UserKeyAuth.Id,
 		WorkspaceId: resources.UserWorkspace.Id,
-		Hash:        hash.Sha256(uid.New(16, "test")),
+		Hash:        hash.Sha256(uid.New("test")),
 		CreatedAt:   time.Now(),
 		Expires:     time.Now().Add(time.Hour),
 	}
@@ -222,7 +222,7 @@ func TestUpdateKey_DeleteRemaining(t *testing.T) {
 		Id:          uid.Key(),
 		KeyAuthId:   resources.UserKeyAuth.Id,
 		WorkspaceId: resources.UserWorkspace.Id,
-		Hash:        hash.Sha256(uid.New(16, "test")),
+		Hash:        hash.Sha256(uid.New("test")),
 		CreatedAt:   time.Now(),
 	}
 	key.Remaining.Enabled = true
@@ -277,7 +277,7 @@ func TestUpdateKey_UpdateShouldNotAffectUndefinedFields(t *testing.T) {
 		Id:          uid.Key(),
 		KeyAuthId:   resources.UserKeyAuth.Id,
 		WorkspaceId: resources.UserWorkspace.Id,
-		Hash:        hash.Sha256(uid.New(16, "test")),
+		Hash:        hash.Sha256(uid.New("test")),
 		CreatedAt:   time.Now(),
 		Name:        "name",
 		OwnerId:     "ownerId",
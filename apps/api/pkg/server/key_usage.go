@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/usage"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxUsageBuckets bounds the size of a response, that is a month of hours or about two years of days
+const maxUsageBuckets = 31 * 24
+
+// UsageRecorder is implemented by *usage.Buffer
+type UsageRecorder interface {
+	Record(keyId string, ts time.Time)
+	Close(ctx context.Context) error
+}
+
+type GetKeyUsageRequest struct {
+	KeyId string `validate:"required"`
+	// Start and End are unix timestamps in milliseconds, End defaults to now
+	Start       int64             `validate:"required,min=1"`
+	End         int64             `validate:"min=0"`
+	Granularity usage.Granularity `validate:"required,oneof=hour day"`
+}
+
+type usageBucketResponse struct {
+	// Time is the start of the bucket as unix timestamp in milliseconds
+	Time  int64 `json:"time"`
+	Count int64 `json:"count"`
+}
+
+type GetKeyUsageResponse struct {
+	KeyId       string                `json:"keyId"`
+	Granularity usage.Granularity     `json:"granularity"`
+	Usage       []usageBucketResponse `json:"usage"`
+}
+
+// getKeyUsage returns the successful verifications of a key per hour or day, including empty buckets.
+func (s *Server) getKeyUsage(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.getKeyUsage")
+	defer span.End()
+
+	req := GetKeyUsageRequest{
+		KeyId:       c.Query("keyId"),
+		Start:       int64(c.QueryInt("start", 0)),
+		End:         int64(c.QueryInt("end", 0)),
+		Granularity: usage.Granularity(c.Query("granularity", string(usage.Day))),
+	}
+	err := s.validator.Struct(req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to validate request: %s", err.Error()))
+	}
+
+	from := req.Granularity.Truncate(time.UnixMilli(req.Start))
+	to := time.Now()
+	if req.End > 0 {
+		to = time.UnixMilli(req.End)
+	}
+	if !to.After(from) {
+		return errs.NewBadRequest("'end' must be after 'start'")
+	}
+	if to.Sub(from) > maxUsageBuckets*req.Granularity.Duration() {
+		return errs.NewBadRequest(fmt.Sprintf("at most %d buckets can be requested at once", maxUsageBuckets))
+	}
+
+	authKey, err := s.authenticateRootKey(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	err = requireScope(authKey, entities.ScopeKeysRead)
+	if err != nil {
+		return err
+	}
+
+	key, err := s.db.GetKeyById(ctx, req.KeyId)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return errs.NewNotFound(fmt.Sprintf("unable to find key: %s", req.KeyId))
+		}
+		return errs.NewInternal(err, "unable to find key")
+	}
+	if key.WorkspaceId != authKey.ForWorkspaceId {
+		return errs.NewUnauthorized("access to workspace denied")
+	}
+	span.SetAttributes(attribute.String("keyId", key.Id), attribute.String("granularity", string(req.Granularity)))
+
+	buckets, err := s.db.GetKeyUsage(ctx, key.Id, from, to, req.Granularity)
+	if err != nil {
+		return errs.NewInternal(err, "unable to get key usage")
+	}
+
+	filled := usage.Fill(buckets, from, to, req.Granularity)
+	res := GetKeyUsageResponse{
+		KeyId:       key.Id,
+		Granularity: req.Granularity,
+		Usage:       make([]usageBucketResponse, len(filled)),
+	}
+	for i, b := range filled {
+		res.Usage[i] = usageBucketResponse{
+			Time:  b.Time.UnixMilli(),
+			Count: b.Count,
+		}
+	}
+	return c.JSON(res)
+}
+
+// recordUsage counts a successful verification, if usage analytics are enabled
+func (s *Server) recordUsage(key entities.Key) {
+	if s.usage == nil {
+		return
+	}
+	s.usage.Record(key.Id, time.Now())
+}
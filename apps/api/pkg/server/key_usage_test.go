@@ -0,0 +1,111 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/usage"
+)
+
+func TestGetKeyUsage(t *testing.T) {
+	day := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	db := newMemoryDatabase()
+	db.addKey("some_key", entities.Key{Id: "key_1", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1"})
+	require.NoError(t, db.AddKeyUsage(context.Background(), []usage.Count{{KeyId: "key_1", Hour: day.Add(24 * time.Hour), Count: 42}}))
+	srv := newTestServer(t, withDatabase(db))
+
+	url := fmt.Sprintf("/v1/keys.usage?keyId=key_1&granularity=day&start=%d&end=%d", day.Add(time.Hour).UnixMilli(), day.Add(3*24*time.Hour).UnixMilli())
+	req := httptest.NewRequest("GET", url, nil)
+	req.Header.Set("Authorization", "Bearer root_key")
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, 200, res.StatusCode, string(body))
+
+	usageRes := GetKeyUsageResponse{}
+	require.NoError(t, json.Unmarshal(body, &usageRes))
+	// start is rounded down to the day, empty days are included
+	require.Equal(t, []usageBucketResponse{
+		{Time: day.UnixMilli(), Count: 0},
+		{Time: day.Add(24 * time.Hour).UnixMilli(), Count: 42},
+		{Time: day.Add(48 * time.Hour).UnixMilli(), Count: 0},
+	}, usageRes.Usage)
+}
+
+func TestGetKeyUsage_Errors(t *testing.T) {
+	db := newMemoryDatabase()
+	db.addKey("some_key", entities.Key{Id: "key_1", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1"})
+	srv := newTestServer(t, withDatabase(db))
+
+	now := time.Now()
+	testCases := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{name: "missing start", query: "keyId=key_1", status: 400},
+		{name: "unknown granularity", query: fmt.Sprintf("keyId=key_1&granularity=week&start=%d", now.Add(-time.Hour).UnixMilli()), status: 400},
+		{name: "end before start", query: fmt.Sprintf("keyId=key_1&start=%d&end=%d", now.UnixMilli(), now.Add(-48*time.Hour).UnixMilli()), status: 400},
+		{name: "too many buckets", query: fmt.Sprintf("keyId=key_1&granularity=hour&start=%d", now.Add(-60*24*time.Hour).UnixMilli()), status: 400},
+		{name: "unknown key", query: fmt.Sprintf("keyId=key_2&start=%d", now.Add(-time.Hour).UnixMilli()), status: 404},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/keys.usage?"+tc.query, nil)
+			req.Header.Set("Authorization", "Bearer root_key")
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.status, res.StatusCode)
+		})
+	}
+}
+
+// recordingUsage remembers which keys were verified
+type recordingUsage struct {
+	sync.Mutex
+	keyIds []string
+}
+
+func (u *recordingUsage) Record(keyId string, ts time.Time) {
+	u.Lock()
+	defer u.Unlock()
+	u.keyIds = append(u.keyIds, keyId)
+}
+
+func (u *recordingUsage) Close(ctx context.Context) error {
+	return nil
+}
+
+func TestVerifyKey_RecordsUsage(t *testing.T) {
+	recorder := &recordingUsage{}
+	db := newMemoryDatabase()
+	db.addKey("some_key", entities.Key{
+		Id:          "key_1",
+		KeyAuthId:   "key_auth_1",
+		WorkspaceId: "ws_1",
+	})
+	srv := newTestServer(t, withDatabase(db), func(c *Config) {
+		c.Usage = recorder
+	})
+
+	req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(`{"key":"some_key"}`))
+	req.Header.Set("Content-Type", "application/json")
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 200, res.StatusCode)
+
+	require.Equal(t, []string{"key_1"}, recorder.keyIds)
+}
@@ -1,21 +1,72 @@
 package server
 
 import (
+	"context"
 	"errors"
-	"fmt"
-	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
 	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
+	"github.com/unkeyed/unkey/apps/api/pkg/keys"
 	"github.com/unkeyed/unkey/apps/api/pkg/ratelimit"
 	"github.com/unkeyed/unkey/apps/api/pkg/tinybird"
 	"github.com/unkeyed/unkey/apps/api/pkg/whitelist"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 type VerifyKeyRequest struct {
 	Key string `json:"key"`
+	// DryRun runs all checks without consuming a remaining verification or a ratelimit token
+	DryRun bool `json:"dryRun,omitempty"`
+	// OwnerId binds the verification to an owner, keys of any other owner are denied with OWNER_MISMATCH
+	OwnerId string `json:"ownerId,omitempty"`
+	// ApiId binds the verification to an api, keys of any other api are denied with WRONG_API
+	ApiId string `json:"apiId,omitempty"`
+	// Cost is how many remaining verifications and ratelimit tokens this verification uses up, 0 means 1
+	Cost int64 `json:"cost,omitempty" validate:"omitempty,gte=1"`
+	// Response selects the shape of the response, defaults to verifyResponseFull
+	Response string `json:"response,omitempty" validate:"omitempty,oneof=full minimal"`
+	// EnforceRatelimit can be set to false to skip the ratelimit of the key, defaults to true
+	EnforceRatelimit *bool `json:"enforceRatelimit,omitempty"`
+	// ConsumeRemaining can be set to false to check the remaining verifications without using them up,
+	// for read-only checks that should still count against the ratelimit. Defaults to true
+	ConsumeRemaining *bool `json:"consumeRemaining,omitempty"`
+}
+
+const (
+	// verifyResponseFull returns everything known about the key
+	verifyResponseFull = "full"
+	// verifyResponseMinimal only returns valid and the code of denied verifications, for gateways
+	// that do not need anything else and want the smallest possible response
+	verifyResponseMinimal = "minimal"
+)
+
+func (r VerifyKeyRequest) cost() int64 {
+	if r.Cost <= 0 {
+		return 1
+	}
+	return r.Cost
+}
+
+// enforcesRatelimit reports whether the ratelimit can deny the verification, dry runs only peek at it
+func (r VerifyKeyRequest) enforcesRatelimit() bool {
+	return r.EnforceRatelimit == nil || *r.EnforceRatelimit
+}
+
+// consumesRemaining reports whether the verification uses up remaining verifications
+func (r VerifyKeyRequest) consumesRemaining() bool {
+	return !r.DryRun && (r.ConsumeRemaining == nil || *r.ConsumeRemaining)
+}
+
+func (r VerifyKeyRequest) minimal() bool {
+	return r.Response == verifyResponseMinimal
 }
 
 // part of the response
@@ -33,6 +84,17 @@ type VerifyKeyResponse struct {
 	Remaining *int64             `json:"remaining,omitempty"`
 	Ratelimit *ratelimitResponse `json:"ratelimit,omitempty"`
 	Code      string             `json:"code,omitempty"`
+	// AuthType is how the api of the key authenticates requests, for gateways that serve several apis
+	AuthType entities.AuthType `json:"authType,omitempty"`
+	// DryRun is set when nothing was consumed, Remaining and Ratelimit are the state before the verification
+	DryRun bool `json:"dryRun,omitempty"`
+	// RemainingLow is set when Remaining is at or below the RemainingWarnThreshold of the key
+	RemainingLow bool `json:"remainingLow,omitempty"`
+}
+
+// minimal strips everything but the outcome of the verification
+func (r VerifyKeyResponse) minimal() VerifyKeyResponse {
+	return VerifyKeyResponse{Valid: r.Valid, Code: r.Code}
 }
 
 type VerifyKeyErrorResponse struct {
@@ -48,146 +110,296 @@ func (s *Server) verifyKey(c *fiber.Ctx) error {
 	req := VerifyKeyRequest{}
 	err := c.BodyParser(&req)
 	if err != nil {
+		s.reportVerification(span, "bad_request")
 		return c.Status(400).JSON(VerifyKeyErrorResponse{
 			Valid: false,
 			ErrorResponse: ErrorResponse{
-				Code:  BAD_REQUEST,
-				Error: err.Error(),
+				Code:      BAD_REQUEST,
+				Error:     err.Error(),
+				RequestId: requestId(c),
 			},
 		})
 	}
 
-	err = s.validator.Struct(req)
+	// gateways can forward the headers of their request instead of copying the key into the body.
+	// The body takes precedence, so a caller that sends a header of its own can still verify another key
+	if req.Key == "" {
+		req.Key, err = verifyRequestKey(c)
+	}
+	var res VerifyKeyResponse
+	if err == nil {
+		res, err = s.verify(ctx, req, httpCaller(c))
+	}
 	if err != nil {
-		return c.Status(400).JSON(VerifyKeyErrorResponse{
+		e, ok := errs.As(err)
+		if !ok {
+			return err
+		}
+		return c.Status(e.Status).JSON(VerifyKeyErrorResponse{
 			Valid: false,
 			ErrorResponse: ErrorResponse{
-				Code:  BAD_REQUEST,
-				Error: err.Error(),
+				Code:      string(e.Code),
+				Error:     e.Message,
+				Docs:      e.Docs,
+				RequestId: requestId(c),
 			},
 		})
 	}
+	// dry runs change nothing, so clients polling the state of a key can make conditional requests.
+	// The body contains remaining, ratelimit and the code of disabled keys, so the ETag changes with them
+	if req.DryRun {
+		return sendWithETag(c, res)
+	}
+	return c.JSON(res)
+}
+
+// verify checks a key and is shared by all transports.
+// Verifications of existing keys that are denied, for example because they are ratelimited,
+// are not errors: the response has Valid set to false and a Code explaining why.
+func (s *Server) verify(ctx context.Context, req VerifyKeyRequest, from caller) (VerifyKeyResponse, error) {
+	return s.verifyPrefetched(ctx, req, from, nil)
+}
+
+// verifyPrefetched is verify for keys that were already loaded from the database, keyed by hash.
+// A key missing from prefetched does not exist, unless it is cached. nil loads the key as usual.
+func (s *Server) verifyPrefetched(ctx context.Context, req VerifyKeyRequest, from caller, prefetched map[string]entities.Key) (res VerifyKeyResponse, err error) {
+	span := trace.SpanFromContext(ctx)
+
+	err = s.validator.Struct(req)
+	if err != nil {
+		s.reportVerification(span, "bad_request")
+		return VerifyKeyResponse{}, errs.NewBadRequest(err.Error())
+	}
+	// remaining and ratelimit are still needed to decide whether the key is valid,
+	// they are only left out of the response
+	if req.minimal() {
+		span.SetAttributes(attribute.String("response", verifyResponseMinimal))
+		defer func() {
+			res = res.minimal()
+		}()
+	}
+
+	req.Key, err = normalizeKey(req.Key)
+	if err != nil {
+		s.reportVerification(span, "bad_request")
+		return VerifyKeyResponse{}, err
+	}
+
+	// v1 and v2 keys are hashed the same way, the version is only needed to check the checksum.
+	// Keys with a broken checksum can never exist, no need to ask the database
+	version, err := keys.ParseVersion(req.Key)
+	span.SetAttributes(attribute.Int("keyVersion", int(version)))
+	if errors.Is(err, keys.ErrChecksumMismatch) {
+		s.reportVerification(span, "bad_request")
+		return VerifyKeyResponse{}, errs.NewBadRequest("key checksum does not match, the key may have been mistyped")
+	}
 
 	// ---------------------------------------------------------------------------------------------
 	// Get the key from either cache or db
 	// ---------------------------------------------------------------------------------------------
-	hash, err := getKeyHash(req.Key)
+	hashes, err := s.getKeyHashes(req.Key)
 	if err != nil {
-		return err
+		return VerifyKeyResponse{}, err
 	}
 
-	key, isCached := s.keyCache.Get(ctx, hash)
+	key, hash, isCached := s.cachedKeyByHashes(ctx, hashes)
+	if !isCached && prefetched != nil {
+		var found bool
+		key, hash, found = prefetchedKeyByHashes(prefetched, hashes)
+		if !found {
+			return VerifyKeyResponse{}, s.missingKeyVerification(span, from)
+		}
+		s.keyCache.Set(ctx, hash, key)
+		isCached = true
+	}
 
+	// on a cache miss the api is loaded in the same query as the key
+	var api entities.Api
+	apiLoaded := false
 	if !isCached {
-		key, err = s.db.GetKeyByHash(ctx, hash)
+		key, api, hash, err = s.keyAndApiByHashes(ctx, hashes)
 		if err != nil {
 			if errors.Is(err, database.ErrNotFound) {
-				return c.Status(http.StatusNotFound).JSON(VerifyKeyErrorResponse{
-					Valid: false,
-					ErrorResponse: ErrorResponse{
-						Code:  NOT_FOUND,
-						Error: "key not found",
-					},
-				})
+				return VerifyKeyResponse{}, s.missingKeyVerification(span, from)
 			}
-
-			return c.Status(500).JSON(VerifyKeyErrorResponse{
-				Valid: false,
-				ErrorResponse: ErrorResponse{
-					Code:  INTERNAL_SERVER_ERROR,
-					Error: err.Error(),
-				},
-			})
+			return VerifyKeyResponse{}, s.failedVerification(span, err, "unable to find key")
 		}
 		s.keyCache.Set(ctx, hash, key)
+		s.apiCache.Set(ctx, key.KeyAuthId, api)
+		apiLoaded = true
 	}
-	if !key.Expires.IsZero() && key.Expires.Before(time.Now()) {
+	if !acceptsHash(key, hash, time.Now()) {
 		s.keyCache.Remove(ctx, hash)
-		err := s.db.DeleteKey(ctx, key.Id)
-		if err != nil {
-			return c.Status(500).JSON(VerifyKeyErrorResponse{
-				Valid: false,
-				ErrorResponse: ErrorResponse{
-					Code:  INTERNAL_SERVER_ERROR,
-					Error: "key not found",
-				},
-			})
-		}
-		return c.Status(404).JSON(VerifyKeyErrorResponse{
-			Valid: false,
-			ErrorResponse: ErrorResponse{
-				Code:  NOT_FOUND,
-				Error: "key not found",
-			},
-		})
+		return VerifyKeyResponse{}, s.missingKeyVerification(span, from)
 	}
+	span.SetAttributes(attribute.String("keyId", key.Id), attribute.String("workspaceId", key.WorkspaceId))
 
 	// ---------------------------------------------------------------------------------------------
 	// Get the api from either cache or db
 	// ---------------------------------------------------------------------------------------------
 
-	api, isCached := s.apiCache.Get(ctx, key.KeyAuthId)
-	if !isCached {
+	if !apiLoaded {
+		api, isCached = s.apiCache.Get(ctx, key.KeyAuthId)
+	}
+	if !apiLoaded && !isCached {
 		keyAuth, err := s.db.GetKeyAuth(ctx, key.KeyAuthId)
 		if err != nil {
 			if errors.Is(err, database.ErrNotFound) {
-				return c.Status(http.StatusNotFound).JSON(VerifyKeyErrorResponse{
-					Valid: false,
-					ErrorResponse: ErrorResponse{
-						Code:  NOT_FOUND,
-						Error: fmt.Sprintf("keyAuth not found: %s", key.KeyAuthId),
-					},
-				})
+				return VerifyKeyResponse{}, s.unauthorizedVerification(span, from, key.Id)
 			}
-
-			return c.Status(500).JSON(VerifyKeyErrorResponse{
-				Valid: false,
-				ErrorResponse: ErrorResponse{
-					Code:  INTERNAL_SERVER_ERROR,
-					Error: err.Error(),
-				},
-			})
+			return VerifyKeyResponse{}, s.failedVerification(span, err, "unable to find key auth")
 		}
 
 		api, err = s.db.GetApiByKeyAuthId(ctx, keyAuth.Id)
 		if err != nil {
 			if errors.Is(err, database.ErrNotFound) {
-				return c.Status(http.StatusNotFound).JSON(VerifyKeyErrorResponse{
-					Valid: false,
-					ErrorResponse: ErrorResponse{
-						Code:  NOT_FOUND,
-						Error: fmt.Sprintf("api not found: %s", keyAuth.Id),
-					},
-				})
+				return VerifyKeyResponse{}, s.unauthorizedVerification(span, from, key.Id)
 			}
+			return VerifyKeyResponse{}, s.failedVerification(span, err, "unable to find api")
+		}
+		s.apiCache.Set(ctx, key.KeyAuthId, api)
+	}
+	span.SetAttributes(attribute.String("apiId", api.Id))
+	// counts every outcome from here on. outcome is only set where the response hides it,
+	// expired keys look missing to the caller unless detailed errors are enabled
+	outcome := ""
+	defer func() {
+		if outcome == "" {
+			outcome = verificationOutcome(res, err)
+		}
+		s.metrics.CountApiVerification(api.Id, outcome)
+	}()
+
+	// verifying a create token would use up its only verification, they are only redeemed by createKeyWithToken
+	if s.isCreateToken(key) {
+		return VerifyKeyResponse{}, s.unauthorizedVerification(span, from, key.Id)
+	}
+	if s.expired(key.Expires, time.Now()) {
+		s.keyCache.Remove(ctx, hash)
+		err := s.db.DeleteKey(ctx, key.Id)
+		if err != nil {
+			return VerifyKeyResponse{}, s.failedVerification(span, err, "key not found")
+		}
+		outcome = "expired"
+		s.reportVerification(span, outcome)
+		s.denyVerification(ctx, from, key, api.Id, EXPIRED, "expired")
+		if !s.detailedVerifyErrors {
+			return VerifyKeyResponse{}, errs.NewUnauthorized("key is not valid")
+		}
+		return VerifyKeyResponse{}, errs.New(errs.EXPIRED, "key expired")
+	}
+
+	if !key.SuspendedAt.IsZero() {
+		s.reportVerification(span, "disabled")
+		s.denyVerification(ctx, from, key, api.Id, DISABLED, "key disabled")
+		return VerifyKeyResponse{
+			Valid: false,
+			Code:  DISABLED,
+		}, nil
+	}
+
+	// ---------------------------------------------------------------------------------------------
+	// Child keys are only valid while their parent is.
+	// Deleting the parent leaves the child without a parent to count against, so it is not valid either
+	// ---------------------------------------------------------------------------------------------
 
-			return c.Status(500).JSON(VerifyKeyErrorResponse{
+	var parent *entities.Key
+	if key.ParentKeyId != "" {
+		p, err := s.db.GetKeyById(ctx, key.ParentKeyId)
+		if err != nil {
+			if errors.Is(err, database.ErrNotFound) {
+				return VerifyKeyResponse{}, s.unauthorizedVerification(span, from, key.Id)
+			}
+			return VerifyKeyResponse{}, s.failedVerification(span, err, "unable to find parent key")
+		}
+		// the parent is deleted when it is verified itself, the child is only denied
+		if s.expired(p.Expires, time.Now()) {
+			outcome = "expired"
+			s.reportVerification(span, outcome)
+			s.denyVerification(ctx, from, key, api.Id, EXPIRED, "parent key expired")
+			if !s.detailedVerifyErrors {
+				return VerifyKeyResponse{}, errs.NewUnauthorized("key is not valid")
+			}
+			return VerifyKeyResponse{}, errs.New(errs.EXPIRED, "parent key expired")
+		}
+		if !p.SuspendedAt.IsZero() {
+			s.reportVerification(span, "disabled")
+			s.denyVerification(ctx, from, key, api.Id, DISABLED, "parent key disabled")
+			return VerifyKeyResponse{
 				Valid: false,
-				ErrorResponse: ErrorResponse{
-					Code:  INTERNAL_SERVER_ERROR,
-					Error: err.Error(),
-				},
-			})
+				Code:  DISABLED,
+			}, nil
 		}
-		s.apiCache.Set(ctx, key.KeyAuthId, api)
+		parent = &p
+		span.SetAttributes(attribute.String("parentKeyId", p.Id))
+	}
+
+	// ---------------------------------------------------------------------------------------------
+	// The key must belong to the expected api, if the caller has one, so a gateway in front of
+	// several apis does not accept keys that were issued for another one.
+	// Like the owner, the actual api is not returned
+	// ---------------------------------------------------------------------------------------------
+
+	if req.ApiId != "" && req.ApiId != api.Id {
+		s.reportVerification(span, "wrong_api")
+		s.denyVerification(ctx, from, key, api.Id, WRONG_API, "wrong api")
+		return VerifyKeyResponse{
+			Valid: false,
+			Code:  WRONG_API,
+		}, nil
 	}
 
 	// ---------------------------------------------------------------------------------------------
 	// Preflight checks
 	// ---------------------------------------------------------------------------------------------
 
+	// ---------------------------------------------------------------------------------------------
+	// Keys of a suspended workspace are not valid
+	// ---------------------------------------------------------------------------------------------
+
+	workspace, isCached := s.workspaceCache.Get(ctx, key.WorkspaceId)
+	if !isCached {
+		workspace, err = s.db.GetWorkspace(ctx, key.WorkspaceId)
+		if err != nil {
+			return VerifyKeyResponse{}, s.failedVerification(span, err, "unable to find workspace")
+		}
+		s.workspaceCache.Set(ctx, key.WorkspaceId, workspace)
+	}
+	if !workspace.SuspendedAt.IsZero() {
+		s.reportVerification(span, "disabled")
+		s.denyVerification(ctx, from, key, api.Id, DISABLED, "workspace disabled")
+		return VerifyKeyResponse{
+			Valid: false,
+			Code:  DISABLED,
+		}, nil
+	}
+
 	if len(api.IpWhitelist) > 0 {
-		sourceIp := c.Get("Fly-Client-IP")
+		sourceIp := from.ip
 		s.logger.Info("checking ip whitelist", zap.String("sourceIp", sourceIp), zap.Strings("whitelist", api.IpWhitelist))
 
 		if !whitelist.Ip(sourceIp, api.IpWhitelist) {
 			s.logger.Info("ip denied", zap.String("workspaceId", api.WorkspaceId), zap.String("apiId", api.Id), zap.String("keyId", key.Id), zap.String("sourceIp", sourceIp), zap.Strings("whitelist", api.IpWhitelist))
-			return c.Status(http.StatusForbidden).JSON(ErrorResponse{
-				Code: FORBIDDEN,
-			})
+			s.reportVerification(span, "forbidden")
+			s.denyVerification(ctx, from, key, api.Id, FORBIDDEN, "ip not whitelisted")
+			return VerifyKeyResponse{}, errs.NewForbidden("ip address is not whitelisted")
 		}
 	}
 
+	// ---------------------------------------------------------------------------------------------
+	// The key must belong to the expected owner, if the caller has one.
+	// The actual owner is not returned, the caller may be probing keys of other users
+	// ---------------------------------------------------------------------------------------------
+
+	if req.OwnerId != "" && req.OwnerId != key.OwnerId {
+		s.reportVerification(span, "owner_mismatch")
+		s.denyVerification(ctx, from, key, api.Id, OWNER_MISMATCH, "owner mismatch")
+		return VerifyKeyResponse{
+			Valid: false,
+			Code:  OWNER_MISMATCH,
+		}, nil
+	}
+
 	// ---------------------------------------------------------------------------------------------
 	// Start validation
 	// ---------------------------------------------------------------------------------------------
@@ -199,17 +411,28 @@ func (s *Server) verifyKey(c *fiber.Ctx) error {
 
 	logger.Info("report.key.verifying")
 
-	res := VerifyKeyResponse{
-		Valid:   true,
-		OwnerId: key.OwnerId,
-		Meta:    key.Meta,
+	res = VerifyKeyResponse{
+		Valid:  true,
+		DryRun: req.DryRun,
 	}
+	if !req.minimal() {
+		res.OwnerId = key.OwnerId
+		res.Meta = key.Meta
+		res.AuthType = api.AuthType
+	}
+	// runs before the response is made minimal, once Remaining is final whichever way the verification ends
+	defer func() {
+		if key.RemainingWarnThreshold != nil && res.Remaining != nil && *res.Remaining <= *key.RemainingWarnThreshold {
+			res.RemainingLow = true
+		}
+	}()
 
 	// ---------------------------------------------------------------------------------------------
 	// Send usage to tinybird
 	// ---------------------------------------------------------------------------------------------
 
-	if s.tinybird != nil {
+	// dry runs are not usage, they are neither published nor counted
+	if s.tinybird != nil && !req.DryRun {
 		defer func() {
 			s.tinybird.PublishKeyVerificationEventChannel() <- tinybird.KeyVerificationEvent{
 				WorkspaceId: key.WorkspaceId,
@@ -224,65 +447,315 @@ func (s *Server) verifyKey(c *fiber.Ctx) error {
 	if !key.Expires.IsZero() {
 		res.Expires = key.Expires.UnixMilli()
 	}
+	// a child can not outlive its parent
+	if parent != nil && !parent.Expires.IsZero() && (res.Expires == 0 || parent.Expires.UnixMilli() < res.Expires) {
+		res.Expires = parent.Expires.UnixMilli()
+	}
 
-	if key.Remaining.Enabled {
-		if key.Remaining.Remaining <= 0 {
+	// consumeRemaining uses up remaining verifications of the key and its parent,
+	// done is true if the verification was denied or failed and must not continue
+	consumeRemaining := func() (done bool, err error) {
+		// checked before anything is consumed, so a depleted parent does not use up its children
+		if parent != nil && parent.Remaining.Enabled && parent.Remaining.Remaining < req.cost() {
 			res.Valid = false
 			res.Code = USAGE_EXCEEDED
-			zero := int64(0)
-			res.Remaining = &zero
-			return c.JSON(res)
+			remaining := parent.Remaining.Remaining
+			if remaining < 0 {
+				remaining = 0
+			}
+			res.Remaining = &remaining
+			s.reportVerification(span, "usage_exceeded")
+			s.denyVerification(ctx, from, key, api.Id, USAGE_EXCEEDED, "parent usage exceeded")
+			return true, nil
 		}
 
-		remainingAfter, err := s.db.DecrementRemainingKeyUsage(ctx, key.Id)
-		if err != nil {
-			return c.Status(500).JSON(VerifyKeyErrorResponse{
-				Valid: false,
-				ErrorResponse: ErrorResponse{
-					Code:  INTERNAL_SERVER_ERROR,
-					Error: err.Error(),
-				},
-			})
-		}
-		key.Remaining.Remaining = remainingAfter
-		res.Remaining = &remainingAfter
-		s.keyCache.Set(ctx, key.Hash, key)
-		if remainingAfter < 0 {
-			res.Valid = false
-			res.Code = USAGE_EXCEEDED
-			return c.JSON(res)
+		if key.Remaining.Enabled {
+			if key.Remaining.Remaining < req.cost() {
+				res.Valid = false
+				res.Code = USAGE_EXCEEDED
+				remaining := key.Remaining.Remaining
+				if remaining < 0 {
+					remaining = 0
+				}
+				res.Remaining = &remaining
+				s.reportVerification(span, "usage_exceeded")
+				s.denyVerification(ctx, from, key, api.Id, USAGE_EXCEEDED, "usage exceeded")
+				return true, nil
+			}
+
+			if !req.consumesRemaining() {
+				remaining := key.Remaining.Remaining
+				res.Remaining = &remaining
+			} else {
+				// the cached key may be stale, the database decides whether there is a verification left
+				consumed, remainingAfter, decremented, err := s.db.VerifyAndConsume(ctx, hash, req.cost())
+				if err != nil {
+					if errors.Is(err, database.ErrNotFound) {
+						s.keyCache.Remove(ctx, hash)
+						return true, s.unauthorizedVerification(span, from, key.Id)
+					}
+					return true, s.failedVerification(span, err, "unable to decrement remaining usage")
+				}
+				s.keyCache.Set(ctx, hash, consumed)
+				// the key was enabled when it was loaded, so it was disabled by using up its last verification.
+				// This verification still passes, the next one is denied as disabled
+				if key.SuspendedAt.IsZero() && !consumed.SuspendedAt.IsZero() {
+					s.depletedKey(ctx, from, consumed)
+				}
+				if consumed.Remaining.Enabled && !decremented {
+					res.Remaining = &remainingAfter
+					res.Valid = false
+					res.Code = USAGE_EXCEEDED
+					s.reportVerification(span, "usage_exceeded")
+					s.denyVerification(ctx, from, key, api.Id, USAGE_EXCEEDED, "usage exceeded")
+					return true, nil
+				}
+				if consumed.Remaining.Enabled {
+					res.Remaining = &remainingAfter
+				}
+			}
 		}
 
+		// the usage of a child counts against its parent too, the response shows whichever has less left
+		if parent != nil && parent.Remaining.Enabled {
+			parentRemaining := parent.Remaining.Remaining
+			if req.consumesRemaining() {
+				consumed, remainingAfter, decremented, err := s.db.VerifyAndConsume(ctx, parent.Hash, req.cost())
+				if err != nil {
+					if errors.Is(err, database.ErrNotFound) {
+						return true, s.unauthorizedVerification(span, from, key.Id)
+					}
+					return true, s.failedVerification(span, err, "unable to decrement remaining usage of parent key")
+				}
+				s.keyCache.Set(ctx, parent.Hash, consumed)
+				if parent.SuspendedAt.IsZero() && !consumed.SuspendedAt.IsZero() {
+					s.depletedKey(ctx, from, consumed)
+				}
+				parentRemaining = remainingAfter
+				if consumed.Remaining.Enabled && !decremented {
+					res.Remaining = &parentRemaining
+					res.Valid = false
+					res.Code = USAGE_EXCEEDED
+					s.reportVerification(span, "usage_exceeded")
+					s.denyVerification(ctx, from, key, api.Id, USAGE_EXCEEDED, "parent usage exceeded")
+					return true, nil
+				}
+			}
+			if res.Remaining == nil || parentRemaining < *res.Remaining {
+				res.Remaining = &parentRemaining
+			}
+		}
+		return false, nil
 	}
 
-	if key.Ratelimit != nil {
-		var limiter ratelimit.Ratelimiter
-		switch key.Ratelimit.Type {
-		case "fast":
-			limiter = s.ratelimit
-			break
-		case "consistent":
-			limiter = s.globalRatelimit
-			break
+	takeRatelimits := func() {
+		if !req.enforcesRatelimit() {
+			return
 		}
-		if limiter != nil {
-			r := limiter.Take(ratelimit.RatelimitRequest{
-				Identifier:     key.Hash,
-				Max:            key.Ratelimit.Limit,
-				RefillRate:     key.Ratelimit.RefillRate,
-				RefillInterval: key.Ratelimit.RefillInterval,
-			})
-			res.Ratelimit = &ratelimitResponse{
-				Limit:     r.Limit,
-				Remaining: r.Remaining,
-				Reset:     r.Reset,
+		if key.Ratelimit != nil {
+			if r, ok := s.takeRatelimit(key.Ratelimit, key.Hash, req); ok {
+				res.Ratelimit = &ratelimitResponse{
+					Limit:     r.Limit,
+					Remaining: r.Remaining,
+					Reset:     r.Reset,
+				}
+				res.Valid = r.Pass
+				if !r.Pass {
+					res.Code = RATELIMITED
+				}
 			}
-			res.Valid = r.Pass
-			if !r.Pass {
-				res.Code = RATELIMITED
+		}
+
+		// children share the ratelimit of their parent, a child that was already ratelimited does not take from it
+		if parent != nil && parent.Ratelimit != nil && res.Valid {
+			if r, ok := s.takeRatelimit(parent.Ratelimit, parent.Hash, req); ok {
+				if !r.Pass || res.Ratelimit == nil || r.Remaining < res.Ratelimit.Remaining {
+					res.Ratelimit = &ratelimitResponse{
+						Limit:     r.Limit,
+						Remaining: r.Remaining,
+						Reset:     r.Reset,
+					}
+				}
+				res.Valid = r.Pass
+				if !r.Pass {
+					res.Code = RATELIMITED
+				}
 			}
 		}
 	}
 
-	return c.JSON(res)
+	// whichever check comes first denies without taking from the second one.
+	// The first one is used up even if the second one denies, we can not give it back
+	ratelimitFirst := key.Ratelimit != nil && key.Ratelimit.CheckOrder == entities.CheckRatelimitFirst
+	if ratelimitFirst {
+		takeRatelimits()
+	}
+	if res.Valid {
+		done, err := consumeRemaining()
+		if err != nil {
+			return VerifyKeyResponse{}, err
+		}
+		if done {
+			return res, nil
+		}
+	} else if key.Remaining.Enabled {
+		// ratelimited before anything was consumed
+		remaining := key.Remaining.Remaining
+		res.Remaining = &remaining
+	}
+	if !ratelimitFirst {
+		takeRatelimits()
+	}
+
+	if res.Valid {
+		s.reportVerification(span, "valid")
+	} else {
+		s.reportVerification(span, strings.ToLower(res.Code))
+		s.logDeniedVerification(from, key.Id, api.Id, res.Code)
+	}
+	if !req.DryRun {
+		if res.Valid {
+			s.recordUsage(key)
+			s.touchLastUsed(key)
+		}
+		s.emitVerifiedWebhook(key, res.Valid, res.Code)
+	}
+
+	return res, nil
+}
+
+// takeRatelimit takes from the bucket of a key, ok is false if the type of the ratelimit is not enforced
+func (s *Server) takeRatelimit(rl *entities.Ratelimit, identifier string, req VerifyKeyRequest) (ratelimit.RatelimitResponse, bool) {
+	var limiter ratelimit.Ratelimiter
+	switch rl.Type {
+	case "fast":
+		limiter = s.ratelimit
+	case "consistent":
+		limiter = s.globalRatelimit
+	}
+	if limiter == nil {
+		return ratelimit.RatelimitResponse{}, false
+	}
+	return limiter.Take(ratelimit.RatelimitRequest{
+		Identifier:     identifier,
+		Max:            rl.Limit,
+		RefillRate:     rl.RefillRate,
+		RefillInterval: rl.RefillInterval,
+		Peek:           req.DryRun,
+		Cost:           req.cost(),
+	}), true
+}
+
+// denyVerification records why a verification of an existing key was denied and informs the webhooks.
+// Ratelimited verifications are not audited, they can happen at a very high rate
+// and are already visible in analytics.
+func (s *Server) denyVerification(ctx context.Context, from caller, key entities.Key, apiId string, code ErrorCode, reason string) {
+	s.logDeniedVerification(from, key.Id, apiId, code)
+	s.appendAuditLogFrom(ctx, from, audit.Entry{
+		WorkspaceId: key.WorkspaceId,
+		Action:      audit.KeyVerifyDenied,
+		TargetKeyId: key.Id,
+		Reason:      reason,
+	})
+	s.emitVerifiedWebhook(key, false, code)
+}
+
+// depletedKey informs everyone that a key was disabled because its remaining verifications were used up
+func (s *Server) depletedKey(ctx context.Context, from caller, key entities.Key) {
+	s.emitKeyEvent(ctx, kafka.KeyUpdated, key)
+	s.appendAuditLogFrom(ctx, from, audit.Entry{
+		WorkspaceId: key.WorkspaceId,
+		Action:      audit.KeyUpdated,
+		TargetKeyId: key.Id,
+		Reason:      "key disabled, no remaining verifications",
+	})
+}
+
+// unauthorizedVerification is returned when the key or the api it belongs to can not be found.
+// We don't tell the caller which lookup failed, so they can not probe for existing keys.
+func (s *Server) unauthorizedVerification(span trace.Span, from caller, keyId string) error {
+	s.logDeniedVerification(from, keyId, "", NOT_FOUND)
+	s.reportVerification(span, "not_found")
+	return errs.NewUnauthorized("key is not valid")
+}
+
+// missingKeyVerification is returned when no key matches the secret. Unless detailed errors are
+// enabled it can not be told apart from an expired key.
+func (s *Server) missingKeyVerification(span trace.Span, from caller) error {
+	if !s.detailedVerifyErrors {
+		return s.unauthorizedVerification(span, from, "")
+	}
+	s.logDeniedVerification(from, "", "", NOT_FOUND)
+	s.reportVerification(span, "not_found")
+	return errs.NewNotFound("key not found")
+}
+
+// deniedReasons are the reason codes of denied verifications in the logs
+var deniedReasons = map[ErrorCode]string{
+	NOT_FOUND:      "not_found",
+	EXPIRED:        "expired",
+	DISABLED:       "disabled",
+	FORBIDDEN:      "ip_blocked",
+	USAGE_EXCEEDED: "usage_exceeded",
+	RATELIMITED:    "ratelimited",
+	OWNER_MISMATCH: "owner_mismatch",
+	WRONG_API:      "wrong_api",
+}
+
+// logDeniedVerification logs why a verification was denied at Config.DeniedVerificationLogLevel,
+// so customers can debug failing requests. keyId and apiId are left out when they are not known.
+// Never add the key or its hash here.
+func (s *Server) logDeniedVerification(from caller, keyId, apiId string, code ErrorCode) {
+	entry := s.logger.Check(s.deniedVerificationLogLevel, "report.key.denied")
+	if entry == nil {
+		return
+	}
+	reason, ok := deniedReasons[code]
+	if !ok {
+		reason = strings.ToLower(code)
+	}
+	fields := []zap.Field{zap.String("reason", reason), zap.String("clientIp", from.ip)}
+	if keyId != "" {
+		fields = append(fields, zap.String("keyId", keyId))
+	}
+	if apiId != "" {
+		fields = append(fields, zap.String("apiId", apiId))
+	}
+	entry.Write(fields...)
+}
+
+// failedVerification is returned when we could not finish the verification, the cause is only logged.
+func (s *Server) failedVerification(span trace.Span, err error, message string) error {
+	span.RecordError(err)
+	s.reportVerification(span, "error")
+	return errs.NewInternal(err, message)
+}
+
+// verificationOutcome is the outcome reportVerification counted for the result of a verification
+func verificationOutcome(res VerifyKeyResponse, err error) string {
+	if err == nil {
+		if res.Valid {
+			return "valid"
+		}
+		return strings.ToLower(res.Code)
+	}
+	e, ok := errs.As(err)
+	if !ok {
+		return "error"
+	}
+	switch e.Code {
+	case errs.INTERNAL_SERVER_ERROR:
+		return "error"
+	case errs.UNAUTHORIZED:
+		// see unauthorizedVerification
+		return "not_found"
+	default:
+		return strings.ToLower(string(e.Code))
+	}
+}
+
+// reportVerification annotates the span and counts the outcome of the verification
+func (s *Server) reportVerification(span trace.Span, outcome string) {
+	span.SetAttributes(attribute.String("outcome", outcome))
+	s.metrics.KeyVerifications.WithLabelValues(outcome).Inc()
 }
@@ -7,21 +7,31 @@ import (
 	"fmt"
 	"io"
 	"net/http/httptest"
+	"net/netip"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
 	"github.com/unkeyed/unkey/apps/api/pkg/cache"
 	"github.com/unkeyed/unkey/apps/api/pkg/database"
 	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
+	"github.com/unkeyed/unkey/apps/api/pkg/keys"
+	"github.com/unkeyed/unkey/apps/api/pkg/metrics"
 	"github.com/unkeyed/unkey/apps/api/pkg/ratelimit"
 	"github.com/unkeyed/unkey/apps/api/pkg/tracing"
+	"github.com/unkeyed/unkey/apps/api/pkg/webhooks"
 
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 	"github.com/unkeyed/unkey/apps/api/pkg/hash"
 	"github.com/unkeyed/unkey/apps/api/pkg/logging"
 	"github.com/unkeyed/unkey/apps/api/pkg/testutil"
 	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestVerifyKey_Simple(t *testing.T) {
@@ -36,7 +46,7 @@ func TestVerifyKey_Simple(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	key := uid.New(16, "test")
+	key := uid.New("test")
 	err = db.CreateKey(ctx, entities.Key{
 		Id:          uid.Key(),
 		KeyAuthId:   resources.UserKeyAuth.Id,
@@ -89,7 +99,7 @@ func TestVerifyKey_WithTemporaryKey(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	key := uid.New(16, "test")
+	key := uid.New("test")
 	err = db.CreateKey(ctx, entities.Key{
 		Id:          uid.Key(),
 		KeyAuthId:   resources.UserKeyAuth.Id,
@@ -101,11 +111,12 @@ func TestVerifyKey_WithTemporaryKey(t *testing.T) {
 	require.NoError(t, err)
 
 	srv := New(Config{
-		Logger:   logging.NewNoopLogger(),
-		KeyCache: cache.NewNoopCache[entities.Key](),
-		ApiCache: cache.NewNoopCache[entities.Api](),
-		Database: db,
-		Tracer:   tracing.NewNoop(),
+		Logger:               logging.NewNoopLogger(),
+		KeyCache:             cache.NewNoopCache[entities.Key](),
+		ApiCache:             cache.NewNoopCache[entities.Api](),
+		Database:             db,
+		Tracer:               tracing.NewNoop(),
+		DetailedVerifyErrors: true,
 	})
 
 	buf := bytes.NewBufferString(fmt.Sprintf(`{
@@ -145,6 +156,7 @@ func TestVerifyKey_WithTemporaryKey(t *testing.T) {
 	require.NoError(t, err)
 
 	require.False(t, errorResponse.Valid)
+	require.Equal(t, EXPIRED, errorResponse.Code)
 
 }
 
@@ -160,7 +172,7 @@ func TestVerifyKey_WithRatelimit(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	key := uid.New(16, "test")
+	key := uid.New("test")
 	err = db.CreateKey(ctx, entities.Key{
 		Id:          uid.Key(),
 		KeyAuthId:   resources.UserKeyAuth.Id,
@@ -295,7 +307,7 @@ func TestVerifyKey_WithIpWhitelist_Pass(t *testing.T) {
 	err = db.CreateApi(ctx, api)
 	require.NoError(t, err)
 
-	key := uid.New(16, "test")
+	key := uid.New("test")
 	err = db.CreateKey(ctx, entities.Key{
 		Id:          uid.Key(),
 		KeyAuthId:   resources.UserKeyAuth.Id,
@@ -311,6 +323,8 @@ func TestVerifyKey_WithIpWhitelist_Pass(t *testing.T) {
 		ApiCache: cache.NewNoopCache[entities.Api](),
 		Database: db,
 		Tracer:   tracing.NewNoop(),
+		// test requests come from 0.0.0.0
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("0.0.0.0/32")},
 	})
 
 	buf := bytes.NewBufferString(fmt.Sprintf(`{
@@ -366,7 +380,7 @@ func TestVerifyKey_WithIpWhitelist_Blocked(t *testing.T) {
 	err = db.CreateApi(ctx, api)
 	require.NoError(t, err)
 
-	key := uid.New(16, "test")
+	key := uid.New("test")
 	err = db.CreateKey(ctx, entities.Key{
 		Id:          uid.Key(),
 		KeyAuthId:   keyAuth.Id,
@@ -382,6 +396,8 @@ func TestVerifyKey_WithIpWhitelist_Blocked(t *testing.T) {
 		ApiCache: cache.NewNoopCache[entities.Api](),
 		Database: db,
 		Tracer:   tracing.NewNoop(),
+		// test requests come from 0.0.0.0
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("0.0.0.0/32")},
 	})
 
 	buf := bytes.NewBufferString(fmt.Sprintf(`{
@@ -419,7 +435,7 @@ func TestVerifyKey_WithRemaining(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	key := uid.New(16, "test")
+	key := uid.New("test")
 	err = db.CreateKey(ctx, entities.Key{
 		Id:          uid.Key(),
 		KeyAuthId:   resources.UserKeyAuth.Id,
@@ -486,3 +502,1590 @@ func TestVerifyKey_WithRemaining(t *testing.T) {
 	require.Equal(t, int64(0), *verifyRes2.Remaining)
 
 }
+
+// notFoundDatabase does not know any key, all other methods panic
+type notFoundDatabase struct {
+	database.Database
+}
+
+func (db *notFoundDatabase) GetKeyByHash(ctx context.Context, hash string) (entities.Key, error) {
+	return entities.Key{}, database.ErrNotFound
+}
+
+func (db *notFoundDatabase) GetKeysByHashes(ctx context.Context, hashes []string) (map[string]entities.Key, error) {
+	return keysByHashes(ctx, hashes, db.GetKeyByHash)
+}
+
+func (db *notFoundDatabase) GetKeyAndApiByHash(ctx context.Context, hash string) (entities.Key, entities.Api, error) {
+	return entities.Key{}, entities.Api{}, database.ErrNotFound
+}
+
+func TestVerifyKey_CountsOutcome(t *testing.T) {
+	m := metrics.New()
+
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: &notFoundDatabase{},
+		Tracer:   tracing.NewNoop(),
+		Metrics:  m,
+	})
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(`{"key":"does_not_exist"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, 401, res.StatusCode)
+		res.Body.Close()
+	}
+
+	require.Equal(t, float64(3), promtestutil.ToFloat64(m.KeyVerifications.WithLabelValues("not_found")))
+	require.Equal(t, float64(0), promtestutil.ToFloat64(m.KeyVerifications.WithLabelValues("valid")))
+}
+
+func TestVerifyKey_CountsOutcomeByApi(t *testing.T) {
+	key := entities.Key{
+		Id:          "key_1",
+		KeyAuthId:   "key_auth_1",
+		WorkspaceId: "ws_1",
+	}
+	key.Remaining.Enabled = true
+	key.Remaining.Remaining = 2
+	m := metrics.New()
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: &remainingDatabase{validKeyDatabase: &validKeyDatabase{key: key}},
+		Tracer:   tracing.NewNoop(),
+		Metrics:  m,
+	})
+
+	for _, body := range []string{`{"key":"some_key"}`, `{"key":"some_key"}`, `{"key":"some_key"}`, `{"key":"some_key","apiId":"api_2"}`, `{}`} {
+		req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		res.Body.Close()
+	}
+
+	require.Equal(t, float64(2), promtestutil.ToFloat64(m.KeyVerificationsByApi.WithLabelValues("api_1", "valid")))
+	require.Equal(t, float64(1), promtestutil.ToFloat64(m.KeyVerificationsByApi.WithLabelValues("api_1", "usage_exceeded")))
+	// the api of the key is counted, not the one the caller expected
+	require.Equal(t, float64(1), promtestutil.ToFloat64(m.KeyVerificationsByApi.WithLabelValues("api_1", "wrong_api")))
+	// the bad request never got to the api
+	require.Equal(t, 3, promtestutil.CollectAndCount(m.KeyVerificationsByApi))
+}
+
+func TestVerifyKey_CountsDeniedKeysByApi(t *testing.T) {
+	db := newMemoryDatabase()
+	db.addKey("expired", entities.Key{Id: "key_expired", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Expires: time.Now().Add(-time.Hour)})
+	db.addKey("disabled", entities.Key{Id: "key_disabled", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", SuspendedAt: time.Now()})
+	db.addKey("child_of_disabled", entities.Key{Id: "key_child", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", ParentKeyId: "key_disabled"})
+	db.addKey("orphan", entities.Key{Id: "key_orphan", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", ParentKeyId: "key_deleted"})
+	m := metrics.New()
+	srv := newTestServer(t, withDatabase(db), func(c *Config) {
+		c.Metrics = m
+	})
+
+	for _, secret := range []string{"expired", "disabled", "child_of_disabled", "orphan"} {
+		req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(fmt.Sprintf(`{"key":%q}`, secret)))
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		res.Body.Close()
+	}
+
+	// counted as expired although the caller is only told the key is not valid
+	require.Equal(t, float64(1), promtestutil.ToFloat64(m.KeyVerificationsByApi.WithLabelValues("api_1", "expired")))
+	require.Equal(t, float64(2), promtestutil.ToFloat64(m.KeyVerificationsByApi.WithLabelValues("api_1", "disabled")))
+	require.Equal(t, float64(1), promtestutil.ToFloat64(m.KeyVerificationsByApi.WithLabelValues("api_1", "not_found")))
+	require.Equal(t, 3, promtestutil.CollectAndCount(m.KeyVerificationsByApi))
+}
+
+func TestVerifyKey_RejectsBrokenChecksum(t *testing.T) {
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		// any database call would panic
+		Database: &notFoundDatabase{},
+		Tracer:   tracing.NewNoop(),
+	})
+
+	v1, _, err := keys.NewV1Key("test", 16, keys.WithChecksum())
+	require.NoError(t, err)
+	v2, _, err := keys.NewV2Key("test", 16)
+	require.NoError(t, err)
+
+	for name, key := range map[string]string{"v1": v1, "v2": v2} {
+		t.Run(name, func(t *testing.T) {
+			mistyped := "tset" + key[len("test"):]
+
+			buf := bytes.NewBufferString(fmt.Sprintf(`{"key":"%s"}`, mistyped))
+			req := httptest.NewRequest("POST", "/v1/keys/verify", buf)
+			req.Header.Set("Content-Type", "application/json")
+
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, 400, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+
+			verifyRes := VerifyKeyErrorResponse{}
+			require.NoError(t, json.Unmarshal(body, &verifyRes))
+			require.False(t, verifyRes.Valid)
+			require.Equal(t, BAD_REQUEST, verifyRes.Code)
+		})
+	}
+}
+
+// missingApiDatabase knows the key, but not the api it belongs to
+type missingApiDatabase struct {
+	database.Database
+	key entities.Key
+}
+
+func (db *missingApiDatabase) GetKeyByHash(ctx context.Context, hash string) (entities.Key, error) {
+	key := db.key
+	key.Hash = hash
+	return key, nil
+}
+
+func (db *missingApiDatabase) GetKeysByHashes(ctx context.Context, hashes []string) (map[string]entities.Key, error) {
+	return keysByHashes(ctx, hashes, db.GetKeyByHash)
+}
+
+func (db *missingApiDatabase) GetKeyAuth(ctx context.Context, keyAuthId string) (entities.KeyAuth, error) {
+	return entities.KeyAuth{Id: keyAuthId, WorkspaceId: db.key.WorkspaceId}, nil
+}
+
+func (db *missingApiDatabase) GetApiByKeyAuthId(ctx context.Context, keyAuthId string) (entities.Api, error) {
+	return entities.Api{}, database.ErrNotFound
+}
+
+func (db *missingApiDatabase) GetKeyAndApiByHash(ctx context.Context, hash string) (entities.Key, entities.Api, error) {
+	// without an api the join finds nothing
+	return entities.Key{}, entities.Api{}, database.ErrNotFound
+}
+
+func TestVerifyKey_MissingApiIsUnauthorized(t *testing.T) {
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: &missingApiDatabase{key: entities.Key{
+			Id:          uid.Key(),
+			KeyAuthId:   uid.KeyAuth(),
+			WorkspaceId: uid.Workspace(),
+		}},
+		Tracer: tracing.NewNoop(),
+	})
+
+	req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(`{"key":"orphaned_key"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 401, res.StatusCode)
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	verifyRes := VerifyKeyErrorResponse{}
+	require.NoError(t, json.Unmarshal(body, &verifyRes))
+	require.False(t, verifyRes.Valid)
+	require.Equal(t, UNAUTHORIZED, verifyRes.Code)
+	require.NotContains(t, verifyRes.Error, "api")
+}
+
+// suspensionDatabase serves a single key, its api and its workspace
+type suspensionDatabase struct {
+	database.Database
+	key       entities.Key
+	workspace entities.Workspace
+	audit     []audit.Entry
+}
+
+func (db *suspensionDatabase) AppendAuditLog(ctx context.Context, entry audit.Entry) error {
+	db.audit = append(db.audit, entry)
+	return nil
+}
+
+func (db *suspensionDatabase) GetKeyByHash(ctx context.Context, hash string) (entities.Key, error) {
+	key := db.key
+	key.Hash = hash
+	return key, nil
+}
+
+func (db *suspensionDatabase) GetKeysByHashes(ctx context.Context, hashes []string) (map[string]entities.Key, error) {
+	return keysByHashes(ctx, hashes, db.GetKeyByHash)
+}
+
+func (db *suspensionDatabase) GetKeyAuth(ctx context.Context, keyAuthId string) (entities.KeyAuth, error) {
+	return entities.KeyAuth{Id: keyAuthId, WorkspaceId: db.workspace.Id}, nil
+}
+
+func (db *suspensionDatabase) GetApiByKeyAuthId(ctx context.Context, keyAuthId string) (entities.Api, error) {
+	return entities.Api{Id: uid.Api(), WorkspaceId: db.workspace.Id, KeyAuthId: keyAuthId, AuthType: entities.AuthTypeKey}, nil
+}
+
+func (db *suspensionDatabase) GetKeyAndApiByHash(ctx context.Context, hash string) (entities.Key, entities.Api, error) {
+	key, _ := db.GetKeyByHash(ctx, hash)
+	api, _ := db.GetApiByKeyAuthId(ctx, key.KeyAuthId)
+	return key, api, nil
+}
+
+func (db *suspensionDatabase) TouchKeyLastUsed(ctx context.Context, keyId string, ts time.Time) error {
+	return nil
+}
+
+func (db *suspensionDatabase) GetWorkspace(ctx context.Context, workspaceId string) (entities.Workspace, error) {
+	return db.workspace, nil
+}
+
+func TestVerifyKey_Suspended(t *testing.T) {
+	testCases := []struct {
+		name               string
+		keySuspended       bool
+		workspaceSuspended bool
+		valid              bool
+	}{
+		{name: "enabled", valid: true},
+		{name: "key suspended", keySuspended: true},
+		{name: "workspace suspended", workspaceSuspended: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &suspensionDatabase{
+				key: entities.Key{
+					Id:          uid.Key(),
+					KeyAuthId:   uid.KeyAuth(),
+					WorkspaceId: "ws_1",
+				},
+				workspace: entities.Workspace{Id: "ws_1"},
+			}
+			if tc.keySuspended {
+				db.key.SuspendedAt = time.Now()
+			}
+			if tc.workspaceSuspended {
+				db.workspace.SuspendedAt = time.Now()
+			}
+
+			srv := New(Config{
+				Logger:   logging.NewNoopLogger(),
+				KeyCache: cache.NewNoopCache[entities.Key](),
+				ApiCache: cache.NewNoopCache[entities.Api](),
+				Database: db,
+				Tracer:   tracing.NewNoop(),
+			})
+
+			req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(`{"key":"some_key"}`))
+			req.Header.Set("Content-Type", "application/json")
+
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, 200, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+
+			verifyRes := VerifyKeyResponse{}
+			require.NoError(t, json.Unmarshal(body, &verifyRes))
+			require.Equal(t, tc.valid, verifyRes.Valid)
+
+			srv.background.Wait()
+			if tc.valid {
+				require.Len(t, db.audit, 0)
+			} else {
+				require.Equal(t, DISABLED, verifyRes.Code)
+				require.Len(t, db.audit, 1)
+				require.Equal(t, audit.KeyVerifyDenied, db.audit[0].Action)
+				require.Equal(t, db.key.Id, db.audit[0].TargetKeyId)
+			}
+		})
+	}
+}
+
+func TestVerifyKey_ExpectedOwner(t *testing.T) {
+	testCases := []struct {
+		name     string
+		keyOwner string
+		ownerId  string
+		valid    bool
+	}{
+		{name: "no expected owner", keyOwner: "user_1", valid: true},
+		{name: "match", keyOwner: "user_1", ownerId: "user_1", valid: true},
+		{name: "mismatch", keyOwner: "user_1", ownerId: "user_2"},
+		{name: "key without owner", ownerId: "user_2"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &suspensionDatabase{
+				key: entities.Key{
+					Id:          uid.Key(),
+					KeyAuthId:   uid.KeyAuth(),
+					WorkspaceId: "ws_1",
+					OwnerId:     tc.keyOwner,
+					Meta:        map[string]any{"plan": "pro"},
+				},
+				workspace: entities.Workspace{Id: "ws_1"},
+			}
+			srv := New(Config{
+				Logger:   logging.NewNoopLogger(),
+				KeyCache: cache.NewNoopCache[entities.Key](),
+				ApiCache: cache.NewNoopCache[entities.Api](),
+				Database: db,
+				Tracer:   tracing.NewNoop(),
+			})
+
+			req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(fmt.Sprintf(`{"key":"some_key","ownerId":%q}`, tc.ownerId)))
+			req.Header.Set("Content-Type", "application/json")
+
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, 200, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+
+			verifyRes := VerifyKeyResponse{}
+			require.NoError(t, json.Unmarshal(body, &verifyRes))
+			require.Equal(t, tc.valid, verifyRes.Valid)
+
+			srv.background.Wait()
+			if tc.valid {
+				require.Equal(t, tc.keyOwner, verifyRes.OwnerId)
+				require.Len(t, db.audit, 0)
+				return
+			}
+			require.Equal(t, OWNER_MISMATCH, verifyRes.Code)
+			// neither the owner nor anything else about the key is leaked
+			require.NotContains(t, string(body), "user_1")
+			require.Nil(t, verifyRes.Meta)
+			require.Len(t, db.audit, 1)
+			require.Equal(t, audit.KeyVerifyDenied, db.audit[0].Action)
+		})
+	}
+}
+
+// expectedApiDatabase puts every key into api_1
+type expectedApiDatabase struct {
+	suspensionDatabase
+}
+
+func (db *expectedApiDatabase) GetApiByKeyAuthId(ctx context.Context, keyAuthId string) (entities.Api, error) {
+	return entities.Api{Id: "api_1", WorkspaceId: db.workspace.Id, KeyAuthId: keyAuthId, AuthType: entities.AuthTypeKey}, nil
+}
+
+func (db *expectedApiDatabase) GetKeyAndApiByHash(ctx context.Context, hash string) (entities.Key, entities.Api, error) {
+	key, _ := db.GetKeyByHash(ctx, hash)
+	api, _ := db.GetApiByKeyAuthId(ctx, key.KeyAuthId)
+	return key, api, nil
+}
+
+func TestVerifyKey_ExpectedApi(t *testing.T) {
+	testCases := []struct {
+		name  string
+		apiId string
+		valid bool
+	}{
+		{name: "no expected api", valid: true},
+		{name: "match", apiId: "api_1", valid: true},
+		{name: "mismatch", apiId: "api_2"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &expectedApiDatabase{suspensionDatabase{
+				key: entities.Key{
+					Id:          uid.Key(),
+					KeyAuthId:   uid.KeyAuth(),
+					WorkspaceId: "ws_1",
+					OwnerId:     "user_1",
+				},
+				workspace: entities.Workspace{Id: "ws_1"},
+			}}
+			srv := New(Config{
+				Logger:   logging.NewNoopLogger(),
+				KeyCache: cache.NewNoopCache[entities.Key](),
+				ApiCache: cache.NewNoopCache[entities.Api](),
+				Database: db,
+				Tracer:   tracing.NewNoop(),
+			})
+
+			req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(fmt.Sprintf(`{"key":"some_key","apiId":%q}`, tc.apiId)))
+			req.Header.Set("Content-Type", "application/json")
+
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, 200, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+
+			verifyRes := VerifyKeyResponse{}
+			require.NoError(t, json.Unmarshal(body, &verifyRes))
+			require.Equal(t, tc.valid, verifyRes.Valid)
+
+			srv.background.Wait()
+			if tc.valid {
+				require.Len(t, db.audit, 0)
+				return
+			}
+			require.Equal(t, WRONG_API, verifyRes.Code)
+			// the api the key belongs to is not leaked, nor is anything else about the key
+			require.NotContains(t, string(body), "api_1")
+			require.NotContains(t, string(body), "user_1")
+			require.Len(t, db.audit, 1)
+			require.Equal(t, audit.KeyVerifyDenied, db.audit[0].Action)
+		})
+	}
+}
+
+func TestVerifyKey_DispatchesWebhook(t *testing.T) {
+	dispatcher := &recordingDispatcher{}
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: &validKeyDatabase{key: entities.Key{
+			Id:          "key_1",
+			KeyAuthId:   "key_auth_1",
+			WorkspaceId: "ws_1",
+		}},
+		Tracer:   tracing.NewNoop(),
+		Webhooks: dispatcher,
+	})
+
+	req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(`{"key":"some_key"}`))
+	req.Header.Set("Content-Type", "application/json")
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 200, res.StatusCode)
+
+	require.Len(t, dispatcher.events, 1)
+	e := dispatcher.events[0]
+	require.Equal(t, webhooks.KeyVerified, e.Type)
+	require.Equal(t, "key_1", e.Key.Id)
+	require.True(t, e.Verification.Valid)
+}
+
+// remainingDatabase counts how often a verification was consumed
+type remainingDatabase struct {
+	*validKeyDatabase
+	consumed int
+}
+
+func (db *remainingDatabase) VerifyAndConsume(ctx context.Context, hash string, cost int64) (entities.Key, int64, bool, error) {
+	key := db.key
+	key.Hash = hash
+	if db.key.Remaining.Remaining < cost {
+		return key, key.Remaining.Remaining, false, nil
+	}
+	db.consumed++
+	db.key.Remaining.Remaining -= cost
+	key.Remaining.Remaining -= cost
+	if key.DisableOnDepletion && key.Remaining.Remaining == 0 {
+		db.key.SuspendedAt = time.Now()
+		key.SuspendedAt = db.key.SuspendedAt
+	}
+	return key, key.Remaining.Remaining, true, nil
+}
+
+func (db *remainingDatabase) AppendAuditLog(ctx context.Context, entry audit.Entry) error {
+	return nil
+}
+
+func TestVerifyKey_DryRun(t *testing.T) {
+	key := entities.Key{
+		Id:          "key_1",
+		KeyAuthId:   "key_auth_1",
+		WorkspaceId: "ws_1",
+		Ratelimit:   &entities.Ratelimit{Type: "fast", Limit: 2, RefillRate: 1, RefillInterval: 60000},
+	}
+	key.Remaining.Enabled = true
+	key.Remaining.Remaining = 3
+	db := &remainingDatabase{validKeyDatabase: &validKeyDatabase{key: key}}
+	recorder := &recordingUsage{}
+	srv := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		KeyCache:  cache.NewNoopCache[entities.Key](),
+		ApiCache:  cache.NewNoopCache[entities.Api](),
+		Database:  db,
+		Tracer:    tracing.NewNoop(),
+		Ratelimit: ratelimit.NewInMemory(),
+		Usage:     recorder,
+	})
+
+	verify := func(dryRun bool) VerifyKeyResponse {
+		body := fmt.Sprintf(`{"key":"some_key","dryRun":%t}`, dryRun)
+		req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, 200, res.StatusCode)
+
+		resBody, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		verifyRes := VerifyKeyResponse{}
+		require.NoError(t, json.Unmarshal(resBody, &verifyRes))
+		return verifyRes
+	}
+
+	for i := 0; i < 3; i++ {
+		res := verify(true)
+		require.True(t, res.Valid)
+		require.True(t, res.DryRun)
+		require.Equal(t, int64(3), *res.Remaining)
+		require.Equal(t, int64(2), res.Ratelimit.Remaining)
+	}
+	require.Equal(t, 0, db.consumed)
+	require.Len(t, recorder.keyIds, 0)
+
+	res := verify(false)
+	require.True(t, res.Valid)
+	require.False(t, res.DryRun)
+	require.Equal(t, int64(2), *res.Remaining)
+	require.Equal(t, int64(1), res.Ratelimit.Remaining)
+	require.Equal(t, 1, db.consumed)
+
+	res = verify(true)
+	require.True(t, res.Valid)
+	require.Equal(t, int64(2), *res.Remaining)
+	require.Equal(t, int64(1), res.Ratelimit.Remaining)
+	require.Equal(t, 1, db.consumed)
+	require.Equal(t, []string{"key_1"}, recorder.keyIds)
+}
+
+func TestVerifyKey_Cost(t *testing.T) {
+	key := entities.Key{
+		Id:          "key_1",
+		KeyAuthId:   "key_auth_1",
+		WorkspaceId: "ws_1",
+		Ratelimit:   &entities.Ratelimit{Type: "fast", Limit: 10, RefillRate: 1, RefillInterval: 60000},
+	}
+	key.Remaining.Enabled = true
+	key.Remaining.Remaining = 5
+	db := &remainingDatabase{validKeyDatabase: &validKeyDatabase{key: key}}
+	srv := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		KeyCache:  cache.NewNoopCache[entities.Key](),
+		ApiCache:  cache.NewNoopCache[entities.Api](),
+		Database:  db,
+		Tracer:    tracing.NewNoop(),
+		Ratelimit: ratelimit.NewInMemory(),
+	})
+
+	verify := func(cost int64) (int, VerifyKeyResponse) {
+		body := fmt.Sprintf(`{"key":"some_key","cost":%d}`, cost)
+		req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		resBody, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		verifyRes := VerifyKeyResponse{}
+		require.NoError(t, json.Unmarshal(resBody, &verifyRes))
+		return res.StatusCode, verifyRes
+	}
+
+	status, res := verify(3)
+	require.Equal(t, 200, status)
+	require.True(t, res.Valid)
+	require.Equal(t, int64(2), *res.Remaining)
+	require.Equal(t, int64(7), res.Ratelimit.Remaining)
+
+	// the cost exceeds what is left, nothing is consumed
+	status, res = verify(3)
+	require.Equal(t, 200, status)
+	require.False(t, res.Valid)
+	require.Equal(t, USAGE_EXCEEDED, res.Code)
+	require.Equal(t, int64(2), *res.Remaining)
+	require.Nil(t, res.Ratelimit)
+	require.Equal(t, 1, db.consumed)
+
+	status, res = verify(2)
+	require.Equal(t, 200, status)
+	require.True(t, res.Valid)
+	require.Equal(t, int64(0), *res.Remaining)
+	require.Equal(t, int64(5), res.Ratelimit.Remaining)
+
+	status, _ = verify(-1)
+	require.Equal(t, 400, status)
+}
+
+func TestVerifyKey_EnforceRatelimitConsumeRemaining(t *testing.T) {
+	// the expected code of each verification, empty if it is valid, and what remains afterwards.
+	// The ratelimit is -1 if it is not in the response. Remaining is checked first, so it is used up
+	// even if the ratelimit denies
+	type verification struct {
+		code      string
+		remaining int64
+		ratelimit int64
+	}
+	testCases := []struct {
+		name          string
+		flags         string
+		verifications []verification
+		consumed      int
+	}{
+		{
+			name:          "defaults",
+			flags:         ``,
+			verifications: []verification{{"", 2, 1}, {"", 1, 0}, {RATELIMITED, 0, 0}},
+			consumed:      3,
+		},
+		{
+			name:          "enforce ratelimit and consume remaining",
+			flags:         `,"enforceRatelimit":true,"consumeRemaining":true`,
+			verifications: []verification{{"", 2, 1}, {"", 1, 0}, {RATELIMITED, 0, 0}},
+			consumed:      3,
+		},
+		{
+			name:          "enforce ratelimit only",
+			flags:         `,"enforceRatelimit":true,"consumeRemaining":false`,
+			verifications: []verification{{"", 3, 1}, {"", 3, 0}, {RATELIMITED, 3, 0}},
+			consumed:      0,
+		},
+		{
+			name:          "consume remaining only",
+			flags:         `,"enforceRatelimit":false,"consumeRemaining":true`,
+			verifications: []verification{{"", 2, -1}, {"", 1, -1}, {"", 0, -1}},
+			consumed:      3,
+		},
+		{
+			name:          "neither",
+			flags:         `,"enforceRatelimit":false,"consumeRemaining":false`,
+			verifications: []verification{{"", 3, -1}, {"", 3, -1}, {"", 3, -1}},
+			consumed:      0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			key := entities.Key{
+				Id:          "key_1",
+				KeyAuthId:   "key_auth_1",
+				WorkspaceId: "ws_1",
+				Ratelimit:   &entities.Ratelimit{Type: "fast", Limit: 2, RefillRate: 1, RefillInterval: 60000},
+			}
+			key.Remaining.Enabled = true
+			key.Remaining.Remaining = 3
+			db := &remainingDatabase{validKeyDatabase: &validKeyDatabase{key: key}}
+			srv := New(Config{
+				Logger:    logging.NewNoopLogger(),
+				KeyCache:  cache.NewNoopCache[entities.Key](),
+				ApiCache:  cache.NewNoopCache[entities.Api](),
+				Database:  db,
+				Tracer:    tracing.NewNoop(),
+				Ratelimit: ratelimit.NewInMemory(),
+			})
+
+			for i, expected := range tc.verifications {
+				req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(`{"key":"some_key"`+tc.flags+`}`))
+				req.Header.Set("Content-Type", "application/json")
+				res, err := srv.app.Test(req)
+				require.NoError(t, err)
+				require.Equal(t, 200, res.StatusCode)
+				resBody, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+				res.Body.Close()
+				verifyRes := VerifyKeyResponse{}
+				require.NoError(t, json.Unmarshal(resBody, &verifyRes))
+
+				require.Equal(t, expected.code == "", verifyRes.Valid, "verification %d", i)
+				require.Equal(t, expected.code, verifyRes.Code, "verification %d", i)
+				require.Equal(t, expected.remaining, *verifyRes.Remaining, "verification %d", i)
+				if expected.ratelimit < 0 {
+					require.Nil(t, verifyRes.Ratelimit, "verification %d", i)
+				} else {
+					require.Equal(t, expected.ratelimit, verifyRes.Ratelimit.Remaining, "verification %d", i)
+				}
+			}
+			require.Equal(t, tc.consumed, db.consumed)
+		})
+	}
+}
+
+func TestVerifyKey_ConsumeRemainingFalseStillChecksRemaining(t *testing.T) {
+	key := entities.Key{Id: "key_1", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1"}
+	key.Remaining.Enabled = true
+	key.Remaining.Remaining = 0
+	db := &remainingDatabase{validKeyDatabase: &validKeyDatabase{key: key}}
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: db,
+		Tracer:   tracing.NewNoop(),
+	})
+
+	req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(`{"key":"some_key","consumeRemaining":false}`))
+	req.Header.Set("Content-Type", "application/json")
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	verifyRes := VerifyKeyResponse{}
+	require.NoError(t, json.Unmarshal(resBody, &verifyRes))
+	require.False(t, verifyRes.Valid)
+	require.Equal(t, USAGE_EXCEEDED, verifyRes.Code)
+}
+
+func TestVerifyKey_CostExceedsRatelimit(t *testing.T) {
+	key := entities.Key{
+		Id:          "key_1",
+		KeyAuthId:   "key_auth_1",
+		WorkspaceId: "ws_1",
+		Ratelimit:   &entities.Ratelimit{Type: "fast", Limit: 5, RefillRate: 1, RefillInterval: 60000},
+	}
+	srv := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		KeyCache:  cache.NewNoopCache[entities.Key](),
+		ApiCache:  cache.NewNoopCache[entities.Api](),
+		Database:  &validKeyDatabase{key: key},
+		Tracer:    tracing.NewNoop(),
+		Ratelimit: ratelimit.NewInMemory(),
+	})
+
+	verify := func(cost int64) VerifyKeyResponse {
+		body := fmt.Sprintf(`{"key":"some_key","cost":%d}`, cost)
+		req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, 200, res.StatusCode)
+
+		resBody, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		verifyRes := VerifyKeyResponse{}
+		require.NoError(t, json.Unmarshal(resBody, &verifyRes))
+		return verifyRes
+	}
+
+	res := verify(6)
+	require.False(t, res.Valid)
+	require.Equal(t, RATELIMITED, res.Code)
+	require.Equal(t, int64(5), res.Ratelimit.Remaining)
+
+	res = verify(5)
+	require.True(t, res.Valid)
+	require.Equal(t, int64(0), res.Ratelimit.Remaining)
+
+	res = verify(1)
+	require.False(t, res.Valid)
+	require.Equal(t, RATELIMITED, res.Code)
+}
+
+func TestVerifyKey_Whitespace(t *testing.T) {
+	db := &pepperDatabase{
+		quotaDatabase: quotaDatabase{workspace: entities.Workspace{Id: "ws_1"}},
+		keys:          storedKeys(entities.Key{Id: "key_1", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Hash: hash.Sha256("test_abc")}),
+	}
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: db,
+		Tracer:   tracing.NewNoop(),
+	})
+
+	verify := func(key string) (int, []byte) {
+		body, err := json.Marshal(map[string]string{"key": key})
+		require.NoError(t, err)
+		req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		resBody, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, resBody
+	}
+
+	for _, key := range []string{"test_abc", "  test_abc\n", "\ttest_abc", "Bearer test_abc"} {
+		status, body := verify(key)
+		require.Equal(t, 200, status, key)
+		verifyRes := VerifyKeyResponse{}
+		require.NoError(t, json.Unmarshal(body, &verifyRes))
+		require.True(t, verifyRes.Valid, key)
+	}
+
+	status, body := verify("test_ abc")
+	require.Equal(t, 400, status)
+	errorRes := ErrorResponse{}
+	require.NoError(t, json.Unmarshal(body, &errorRes))
+	require.Contains(t, errorRes.Error, "must not contain whitespace")
+}
+
+func TestVerifyKey_RemainingWarnThreshold(t *testing.T) {
+	threshold := int64(1)
+	key := entities.Key{
+		Id:                     "key_1",
+		KeyAuthId:              "key_auth_1",
+		WorkspaceId:            "ws_1",
+		RemainingWarnThreshold: &threshold,
+	}
+	key.Remaining.Enabled = true
+	key.Remaining.Remaining = 3
+	db := &remainingDatabase{validKeyDatabase: &validKeyDatabase{key: key}}
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: db,
+		Tracer:   tracing.NewNoop(),
+	})
+
+	verify := func(body string) VerifyKeyResponse {
+		req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, 200, res.StatusCode)
+
+		resBody, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		verifyRes := VerifyKeyResponse{}
+		require.NoError(t, json.Unmarshal(resBody, &verifyRes))
+		return verifyRes
+	}
+
+	// the remaining after the verification is compared, not before
+	res := verify(`{"key":"some_key"}`)
+	require.True(t, res.Valid)
+	require.Equal(t, int64(2), *res.Remaining)
+	require.False(t, res.RemainingLow)
+
+	res = verify(`{"key":"some_key"}`)
+	require.True(t, res.Valid)
+	require.Equal(t, int64(1), *res.Remaining)
+	require.True(t, res.RemainingLow)
+
+	res = verify(`{"key":"some_key","response":"minimal"}`)
+	require.True(t, res.Valid)
+	require.False(t, res.RemainingLow)
+
+	res = verify(`{"key":"some_key"}`)
+	require.False(t, res.Valid)
+	require.Equal(t, USAGE_EXCEEDED, res.Code)
+	require.True(t, res.RemainingLow)
+}
+
+func TestVerifyKey_CheckOrder(t *testing.T) {
+	testCases := []struct {
+		name       string
+		checkOrder string
+		limit      int64
+		remaining  int64
+		code       string
+		// what is left after the second verification was denied, -1 if the ratelimit was not taken
+		remainingLeft int64
+		ratelimitLeft int64
+	}{
+		{name: "out of remaining, remaining first", checkOrder: "", limit: 10, remaining: 1, code: USAGE_EXCEEDED, remainingLeft: 0, ratelimitLeft: -1},
+		{name: "out of remaining, ratelimit first", checkOrder: entities.CheckRatelimitFirst, limit: 10, remaining: 1, code: USAGE_EXCEEDED, remainingLeft: 0, ratelimitLeft: 8},
+		{name: "ratelimited, remaining first", checkOrder: entities.CheckRemainingFirst, limit: 1, remaining: 10, code: RATELIMITED, remainingLeft: 8, ratelimitLeft: 0},
+		{name: "ratelimited, ratelimit first", checkOrder: entities.CheckRatelimitFirst, limit: 1, remaining: 10, code: RATELIMITED, remainingLeft: 9, ratelimitLeft: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			key := entities.Key{
+				Id:          "key_1",
+				KeyAuthId:   "key_auth_1",
+				WorkspaceId: "ws_1",
+				Ratelimit:   &entities.Ratelimit{Type: "fast", Limit: tc.limit, RefillRate: 1, RefillInterval: 60000, CheckOrder: tc.checkOrder},
+			}
+			key.Remaining.Enabled = true
+			key.Remaining.Remaining = tc.remaining
+			db := &remainingDatabase{validKeyDatabase: &validKeyDatabase{key: key}}
+			srv := New(Config{
+				Logger:    logging.NewNoopLogger(),
+				KeyCache:  cache.NewNoopCache[entities.Key](),
+				ApiCache:  cache.NewNoopCache[entities.Api](),
+				Database:  db,
+				Tracer:    tracing.NewNoop(),
+				Ratelimit: ratelimit.NewInMemory(),
+			})
+
+			verify := func() VerifyKeyResponse {
+				req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(`{"key":"some_key"}`))
+				req.Header.Set("Content-Type", "application/json")
+				res, err := srv.app.Test(req)
+				require.NoError(t, err)
+				defer res.Body.Close()
+				require.Equal(t, 200, res.StatusCode)
+
+				resBody, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+				verifyRes := VerifyKeyResponse{}
+				require.NoError(t, json.Unmarshal(resBody, &verifyRes))
+				return verifyRes
+			}
+
+			require.True(t, verify().Valid)
+
+			res := verify()
+			require.False(t, res.Valid)
+			require.Equal(t, tc.code, res.Code)
+			require.Equal(t, tc.remainingLeft, *res.Remaining)
+			require.Equal(t, tc.remainingLeft, db.key.Remaining.Remaining)
+			if tc.ratelimitLeft < 0 {
+				require.Nil(t, res.Ratelimit)
+			} else {
+				require.Equal(t, tc.ratelimitLeft, res.Ratelimit.Remaining)
+			}
+		})
+	}
+}
+
+func TestVerifyKey_DryRunETag(t *testing.T) {
+	key := entities.Key{
+		Id:          "key_1",
+		KeyAuthId:   "key_auth_1",
+		WorkspaceId: "ws_1",
+		Ratelimit:   &entities.Ratelimit{Type: "fast", Limit: 5, RefillRate: 1, RefillInterval: 60000},
+	}
+	key.Remaining.Enabled = true
+	key.Remaining.Remaining = 3
+	db := &remainingDatabase{validKeyDatabase: &validKeyDatabase{key: key}}
+	srv := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		KeyCache:  cache.NewNoopCache[entities.Key](),
+		ApiCache:  cache.NewNoopCache[entities.Api](),
+		Database:  db,
+		Tracer:    tracing.NewNoop(),
+		Ratelimit: ratelimit.NewInMemory(),
+	})
+
+	verify := func(dryRun bool, ifNoneMatch string) (int, string, []byte) {
+		body := fmt.Sprintf(`{"key":"some_key","dryRun":%t}`, dryRun)
+		req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		resBody, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, res.Header.Get("ETag"), resBody
+	}
+
+	status, etag, body := verify(true, "")
+	require.Equal(t, 200, status)
+	require.NotEmpty(t, etag)
+	require.Contains(t, string(body), `"remaining":3`)
+
+	status, again, body := verify(true, etag)
+	require.Equal(t, 304, status)
+	require.Equal(t, etag, again)
+	require.Empty(t, body)
+
+	status, _, _ = verify(true, `"other", W/`+etag)
+	require.Equal(t, 304, status)
+
+	// only dry runs are cacheable
+	status, consumedEtag, _ := verify(false, etag)
+	require.Equal(t, 200, status)
+	require.Empty(t, consumedEtag)
+
+	// remaining and ratelimit changed
+	status, afterConsume, body := verify(true, etag)
+	require.Equal(t, 200, status)
+	require.NotEqual(t, etag, afterConsume)
+	require.Contains(t, string(body), `"remaining":2`)
+
+	db.key.SuspendedAt = time.Now()
+	status, afterDisable, body := verify(true, afterConsume)
+	require.Equal(t, 200, status)
+	require.NotEqual(t, afterConsume, afterDisable)
+	require.Contains(t, string(body), DISABLED)
+}
+
+func TestEtagMatches(t *testing.T) {
+	require.True(t, etagMatches(`"a"`, `"a"`))
+	require.True(t, etagMatches(`W/"a"`, `"a"`))
+	require.True(t, etagMatches(`"b", "a"`, `"a"`))
+	require.True(t, etagMatches(`*`, `"a"`))
+	require.False(t, etagMatches(``, `"a"`))
+	require.False(t, etagMatches(`"b"`, `"a"`))
+	require.False(t, etagMatches(`a`, `"a"`))
+}
+
+func TestVerifyKey_DisableOnDepletion(t *testing.T) {
+	key := entities.Key{
+		Id:                 "key_1",
+		KeyAuthId:          "key_auth_1",
+		WorkspaceId:        "ws_1",
+		DisableOnDepletion: true,
+	}
+	key.Remaining.Enabled = true
+	key.Remaining.Remaining = 2
+	db := &remainingDatabase{validKeyDatabase: &validKeyDatabase{key: key}}
+	bus := &recordingEventBus{events: map[kafka.KeyEventType][]string{}}
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: db,
+		Tracer:   tracing.NewNoop(),
+		Kafka:    bus,
+	})
+
+	verify := func() VerifyKeyResponse {
+		req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(`{"key":"some_key"}`))
+		req.Header.Set("Content-Type", "application/json")
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, 200, res.StatusCode)
+		srv.background.Wait()
+
+		resBody, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		verifyRes := VerifyKeyResponse{}
+		require.NoError(t, json.Unmarshal(resBody, &verifyRes))
+		return verifyRes
+	}
+
+	res := verify()
+	require.True(t, res.Valid)
+	require.Equal(t, int64(1), *res.Remaining)
+	require.True(t, db.key.SuspendedAt.IsZero())
+	require.Len(t, bus.events[kafka.KeyUpdated], 0)
+
+	// using up the last verification disables the key, the verification itself still passes
+	res = verify()
+	require.True(t, res.Valid)
+	require.Equal(t, int64(0), *res.Remaining)
+	require.False(t, db.key.SuspendedAt.IsZero())
+	require.Equal(t, []string{"key_1"}, bus.events[kafka.KeyUpdated])
+
+	res = verify()
+	require.False(t, res.Valid)
+	require.Equal(t, DISABLED, res.Code)
+	require.Equal(t, []string{"key_1"}, bus.events[kafka.KeyUpdated])
+	require.Equal(t, 2, db.consumed)
+}
+
+// joinedDatabase only supports loading a key together with its api, so a verification that falls
+// back to separate lookups panics
+type joinedDatabase struct {
+	database.Database
+	calls int
+}
+
+func (db *joinedDatabase) GetKeyAndApiByHash(ctx context.Context, hash string) (entities.Key, entities.Api, error) {
+	db.calls++
+	key := entities.Key{Id: "key_1", Hash: hash, KeyAuthId: "key_auth_1", WorkspaceId: "ws_1"}
+	api := entities.Api{Id: "api_1", WorkspaceId: "ws_1", KeyAuthId: "key_auth_1", AuthType: entities.AuthTypeKey}
+	return key, api, nil
+}
+
+func (db *joinedDatabase) TouchKeyLastUsed(ctx context.Context, keyId string, ts time.Time) error {
+	return nil
+}
+
+func (db *joinedDatabase) GetWorkspace(ctx context.Context, workspaceId string) (entities.Workspace, error) {
+	return entities.Workspace{Id: workspaceId}, nil
+}
+
+func TestVerifyKey_LoadsKeyAndApiTogether(t *testing.T) {
+	db := &joinedDatabase{}
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: db,
+		Tracer:   tracing.NewNoop(),
+	})
+
+	req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(`{"key":"some_key"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 200, res.StatusCode)
+	require.Equal(t, 1, db.calls)
+}
+
+// expiringKeyDatabase serves an expired key and lets it be deleted
+type expiringKeyDatabase struct {
+	suspensionDatabase
+}
+
+func (db *expiringKeyDatabase) DeleteKey(ctx context.Context, keyId string) error {
+	return nil
+}
+
+func TestVerifyKey_DetailedErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		detailed bool
+		database database.Database
+		status   int
+		code     string
+	}{
+		{name: "missing key", detailed: false, database: &notFoundDatabase{}, status: 401, code: UNAUTHORIZED},
+		{name: "expired key", detailed: false, database: &expiringKeyDatabase{}, status: 401, code: UNAUTHORIZED},
+		{name: "detailed missing key", detailed: true, database: &notFoundDatabase{}, status: 404, code: NOT_FOUND},
+		{name: "detailed expired key", detailed: true, database: &expiringKeyDatabase{}, status: 404, code: EXPIRED},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if db, ok := tc.database.(*expiringKeyDatabase); ok {
+				db.key = entities.Key{Id: uid.Key(), KeyAuthId: uid.KeyAuth(), WorkspaceId: "ws_1", Expires: time.Now().Add(-time.Hour)}
+				db.workspace = entities.Workspace{Id: "ws_1"}
+			}
+			srv := New(Config{
+				Logger:               logging.NewNoopLogger(),
+				KeyCache:             cache.NewNoopCache[entities.Key](),
+				ApiCache:             cache.NewNoopCache[entities.Api](),
+				Database:             tc.database,
+				Tracer:               tracing.NewNoop(),
+				DetailedVerifyErrors: tc.detailed,
+			})
+
+			req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(`{"key":"some_key"}`))
+			req.Header.Set("Content-Type", "application/json")
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			srv.background.Wait()
+			require.Equal(t, tc.status, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			verifyRes := VerifyKeyErrorResponse{}
+			require.NoError(t, json.Unmarshal(body, &verifyRes))
+			require.False(t, verifyRes.Valid)
+			require.Equal(t, tc.code, verifyRes.Code)
+		})
+	}
+}
+
+func TestVerifyKey_LogsDenials(t *testing.T) {
+	suspended := func() database.Database {
+		return &suspensionDatabase{
+			key:       entities.Key{Id: "key_1", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", SuspendedAt: time.Now()},
+			workspace: entities.Workspace{Id: "ws_1"},
+		}
+	}
+	ratelimited := func() database.Database {
+		return &suspensionDatabase{
+			key: entities.Key{Id: "key_1", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Ratelimit: &entities.Ratelimit{
+				Type:           "fast",
+				Limit:          0,
+				RefillRate:     1,
+				RefillInterval: 10000,
+			}},
+			workspace: entities.Workspace{Id: "ws_1"},
+		}
+	}
+	expired := func() database.Database {
+		db := &expiringKeyDatabase{}
+		db.key = entities.Key{Id: "key_1", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Expires: time.Now().Add(-time.Hour)}
+		db.workspace = entities.Workspace{Id: "ws_1"}
+		return db
+	}
+
+	testCases := []struct {
+		name     string
+		database func() database.Database
+		level    zapcore.Level
+		reason   string
+		keyId    string
+		logged   bool
+	}{
+		{name: "disabled", database: suspended, reason: "disabled", keyId: "key_1", logged: true},
+		{name: "ratelimited", database: ratelimited, reason: "ratelimited", keyId: "key_1", logged: true},
+		{name: "expired", database: expired, reason: "expired", keyId: "key_1", logged: true},
+		{name: "missing key", database: func() database.Database { return &notFoundDatabase{} }, reason: "not_found", logged: true},
+		{name: "below the configured level", database: suspended, level: zapcore.DebugLevel},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.InfoLevel)
+			srv := New(Config{
+				Logger:                     zap.New(core),
+				KeyCache:                   cache.NewNoopCache[entities.Key](),
+				ApiCache:                   cache.NewNoopCache[entities.Api](),
+				Database:                   tc.database(),
+				Tracer:                     tracing.NewNoop(),
+				Ratelimit:                  ratelimit.NewInMemory(),
+				DeniedVerificationLogLevel: tc.level,
+			})
+
+			req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(`{"key":"some_key"}`))
+			req.Header.Set("Content-Type", "application/json")
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			srv.background.Wait()
+
+			denied := logs.FilterMessage("report.key.denied").All()
+			if !tc.logged {
+				require.Len(t, denied, 0)
+				return
+			}
+			require.Len(t, denied, 1)
+			fields := denied[0].ContextMap()
+			require.Equal(t, tc.reason, fields["reason"])
+			require.Equal(t, "0.0.0.0", fields["clientIp"])
+			if tc.keyId == "" {
+				require.NotContains(t, fields, "keyId")
+			} else {
+				require.Equal(t, tc.keyId, fields["keyId"])
+				require.NotEmpty(t, fields["apiId"])
+			}
+
+			keyHash := hash.Sha256("some_key")
+			for _, value := range fields {
+				require.NotContains(t, fmt.Sprint(value), "some_key")
+				require.NotContains(t, fmt.Sprint(value), keyHash)
+			}
+		})
+	}
+}
+
+// parentDatabase serves a parent key and its children by hash and by id
+type parentDatabase struct {
+	*batchDatabase
+}
+
+func (db *parentDatabase) GetKeyAndApiByHash(ctx context.Context, hash string) (entities.Key, entities.Api, error) {
+	key, ok := db.keys[hash]
+	if !ok {
+		return entities.Key{}, entities.Api{}, database.ErrNotFound
+	}
+	api, _ := db.GetApiByKeyAuthId(ctx, key.KeyAuthId)
+	return key, api, nil
+}
+
+func (db *parentDatabase) GetKeyById(ctx context.Context, keyId string) (entities.Key, error) {
+	for _, key := range db.keys {
+		if key.Id == keyId {
+			return key, nil
+		}
+	}
+	return entities.Key{}, database.ErrNotFound
+}
+
+func newParentDatabase() *parentDatabase {
+	parent := entities.Key{
+		Id:          "key_parent",
+		KeyAuthId:   "key_auth_1",
+		WorkspaceId: "ws_1",
+		Hash:        hash.Sha256("parent_key"),
+		Ratelimit:   &entities.Ratelimit{Type: "fast", Limit: 3, RefillRate: 1, RefillInterval: 60000},
+	}
+	parent.Remaining.Enabled = true
+	parent.Remaining.Remaining = 4
+	child := entities.Key{
+		Id:          "key_child",
+		KeyAuthId:   "key_auth_1",
+		WorkspaceId: "ws_1",
+		Hash:        hash.Sha256("child_key"),
+		ParentKeyId: parent.Id,
+	}
+	return &parentDatabase{batchDatabase: &batchDatabase{keys: map[string]entities.Key{
+		parent.Hash: parent,
+		child.Hash:  child,
+	}}}
+}
+
+func TestVerifyKey_ChildKey(t *testing.T) {
+	db := newParentDatabase()
+	srv := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		KeyCache:  cache.NewNoopCache[entities.Key](),
+		ApiCache:  cache.NewNoopCache[entities.Api](),
+		Database:  db,
+		Tracer:    tracing.NewNoop(),
+		Ratelimit: ratelimit.NewInMemory(),
+	})
+
+	verify := func(key string) VerifyKeyResponse {
+		req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(fmt.Sprintf(`{"key":%q}`, key)))
+		req.Header.Set("Content-Type", "application/json")
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, 200, res.StatusCode)
+
+		resBody, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		verifyRes := VerifyKeyResponse{}
+		require.NoError(t, json.Unmarshal(resBody, &verifyRes))
+		return verifyRes
+	}
+
+	// the child has no limits of its own, it uses up the ones of its parent
+	res := verify("child_key")
+	require.True(t, res.Valid)
+	require.Equal(t, int64(3), *res.Remaining)
+	require.Equal(t, int64(2), res.Ratelimit.Remaining)
+
+	res = verify("parent_key")
+	require.True(t, res.Valid)
+	require.Equal(t, int64(2), *res.Remaining)
+	require.Equal(t, int64(1), res.Ratelimit.Remaining)
+
+	res = verify("child_key")
+	require.True(t, res.Valid)
+	require.Equal(t, int64(0), res.Ratelimit.Remaining)
+
+	res = verify("child_key")
+	require.False(t, res.Valid)
+	require.Equal(t, RATELIMITED, res.Code)
+
+	parentHash := hash.Sha256("parent_key")
+	require.Equal(t, int64(0), db.keys[parentHash].Remaining.Remaining)
+}
+
+func TestVerifyKey_ChildKeyOfInvalidParent(t *testing.T) {
+	parentHash := hash.Sha256("parent_key")
+	testCases := []struct {
+		name    string
+		prepare func(db *parentDatabase)
+		status  int
+		code    string
+	}{
+		{
+			name:    "parent deleted",
+			prepare: func(db *parentDatabase) { delete(db.keys, parentHash) },
+			status:  401,
+			code:    string(UNAUTHORIZED),
+		},
+		{
+			name: "parent disabled",
+			prepare: func(db *parentDatabase) {
+				parent := db.keys[parentHash]
+				parent.SuspendedAt = time.Now()
+				db.keys[parentHash] = parent
+			},
+			status: 200,
+			code:   DISABLED,
+		},
+		{
+			name: "parent expired",
+			prepare: func(db *parentDatabase) {
+				parent := db.keys[parentHash]
+				parent.Expires = time.Now().Add(-time.Hour)
+				db.keys[parentHash] = parent
+			},
+			status: 401,
+			code:   string(UNAUTHORIZED),
+		},
+		{
+			name: "parent depleted",
+			prepare: func(db *parentDatabase) {
+				parent := db.keys[parentHash]
+				parent.Remaining.Remaining = 0
+				db.keys[parentHash] = parent
+			},
+			status: 200,
+			code:   USAGE_EXCEEDED,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newParentDatabase()
+			tc.prepare(db)
+			srv := New(Config{
+				Logger:   logging.NewNoopLogger(),
+				KeyCache: cache.NewNoopCache[entities.Key](),
+				ApiCache: cache.NewNoopCache[entities.Api](),
+				Database: db,
+				Tracer:   tracing.NewNoop(),
+			})
+
+			req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(`{"key":"child_key"}`))
+			req.Header.Set("Content-Type", "application/json")
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.status, res.StatusCode)
+
+			resBody, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			verifyRes := VerifyKeyErrorResponse{}
+			require.NoError(t, json.Unmarshal(resBody, &verifyRes))
+			require.False(t, verifyRes.Valid)
+			require.Equal(t, tc.code, verifyRes.Code)
+
+			// the child itself is not deleted
+			_, ok := db.keys[hash.Sha256("child_key")]
+			require.True(t, ok)
+		})
+	}
+}
+
+func TestVerifyKey_ResponseShape(t *testing.T) {
+	key := entities.Key{
+		Id:          "key_1",
+		KeyAuthId:   "key_auth_1",
+		WorkspaceId: "ws_1",
+		OwnerId:     "chronark",
+		Meta:        map[string]any{"plan": "pro"},
+		Expires:     time.Now().Add(time.Hour),
+		Ratelimit:   &entities.Ratelimit{Type: "fast", Limit: 10, RefillRate: 1, RefillInterval: 60000},
+	}
+	key.Remaining.Enabled = true
+	key.Remaining.Remaining = 1
+	db := &remainingDatabase{validKeyDatabase: &validKeyDatabase{key: key}}
+	srv := New(Config{
+		Logger:    logging.NewNoopLogger(),
+		KeyCache:  cache.NewNoopCache[entities.Key](),
+		ApiCache:  cache.NewNoopCache[entities.Api](),
+		Database:  db,
+		Tracer:    tracing.NewNoop(),
+		Ratelimit: ratelimit.NewInMemory(),
+	})
+
+	verify := func(body string) (int, map[string]any) {
+		req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		resBody, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		verifyRes := map[string]any{}
+		require.NoError(t, json.Unmarshal(resBody, &verifyRes))
+		return res.StatusCode, verifyRes
+	}
+
+	status, res := verify(`{"key":"some_key","dryRun":true}`)
+	require.Equal(t, 200, status)
+	for _, field := range []string{"valid", "ownerId", "meta", "expires", "remaining", "ratelimit"} {
+		require.Contains(t, res, field)
+	}
+
+	status, res = verify(`{"key":"some_key","response":"minimal"}`)
+	require.Equal(t, 200, status)
+	require.Equal(t, map[string]any{"valid": true}, res)
+	// the verification was still consumed
+	require.Equal(t, 1, db.consumed)
+
+	status, res = verify(`{"key":"some_key","response":"minimal"}`)
+	require.Equal(t, 200, status)
+	require.Equal(t, map[string]any{"valid": false, "code": USAGE_EXCEEDED}, res)
+
+	status, _ = verify(`{"key":"some_key","response":"tiny"}`)
+	require.Equal(t, 400, status)
+}
+
+func BenchmarkVerifyKey(b *testing.B) {
+	meta := map[string]any{}
+	for i := 0; i < 50; i++ {
+		meta[fmt.Sprintf("field_%d", i)] = "some value of the field"
+	}
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: &validKeyDatabase{key: entities.Key{
+			Id:          "key_1",
+			KeyAuthId:   "key_auth_1",
+			WorkspaceId: "ws_1",
+			OwnerId:     "chronark",
+			Meta:        meta,
+		}},
+		Tracer: tracing.NewNoop(),
+	})
+
+	for _, shape := range []string{verifyResponseFull, verifyResponseMinimal} {
+		b.Run(shape, func(b *testing.B) {
+			body := fmt.Sprintf(`{"key":"some_key","response":%q}`, shape)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(body))
+				req.Header.Set("Content-Type", "application/json")
+				res, err := srv.app.Test(req)
+				if err != nil {
+					b.Fatal(err)
+				}
+				res.Body.Close()
+			}
+		})
+	}
+}
+
+// authTypeDatabase serves its key from an api with the given auth type
+type authTypeDatabase struct {
+	*validKeyDatabase
+	authType entities.AuthType
+}
+
+func (db *authTypeDatabase) GetApiByKeyAuthId(ctx context.Context, keyAuthId string) (entities.Api, error) {
+	api, err := db.validKeyDatabase.GetApiByKeyAuthId(ctx, keyAuthId)
+	api.AuthType = db.authType
+	return api, err
+}
+
+func (db *authTypeDatabase) GetKeyAndApiByHash(ctx context.Context, hash string) (entities.Key, entities.Api, error) {
+	key, _ := db.GetKeyByHash(ctx, hash)
+	api, _ := db.GetApiByKeyAuthId(ctx, key.KeyAuthId)
+	return key, api, nil
+}
+
+func TestVerifyKey_AuthType(t *testing.T) {
+	for _, authType := range []entities.AuthType{entities.AuthTypeKey, entities.AuthTypeJWT} {
+		t.Run(string(authType), func(t *testing.T) {
+			srv := New(Config{
+				Logger:   logging.NewNoopLogger(),
+				KeyCache: cache.NewNoopCache[entities.Key](),
+				ApiCache: cache.NewNoopCache[entities.Api](),
+				Database: &authTypeDatabase{
+					validKeyDatabase: &validKeyDatabase{key: entities.Key{Id: "key_1", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1"}},
+					authType:         authType,
+				},
+				Tracer: tracing.NewNoop(),
+			})
+
+			req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(`{"key":"some_key"}`))
+			req.Header.Set("Content-Type", "application/json")
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, 200, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			verifyRes := VerifyKeyResponse{}
+			require.NoError(t, json.Unmarshal(body, &verifyRes))
+			require.True(t, verifyRes.Valid)
+			require.Equal(t, authType, verifyRes.AuthType)
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// WhoamiResponse describes the root key of the request, never its secret
+type WhoamiResponse struct {
+	KeyId string `json:"keyId"`
+	Name  string `json:"name,omitempty"`
+	// WorkspaceId is the workspace the root key manages
+	WorkspaceId string `json:"workspaceId"`
+	// Scopes are the scopes the root key was granted, empty means full access to the workspace
+	Scopes    []string `json:"scopes"`
+	CreatedAt int64    `json:"createdAt"`
+	Expires   int64    `json:"expires,omitempty"`
+	// Enabled is false if the root key was suspended, every other endpoint rejects it then
+	Enabled bool `json:"enabled"`
+}
+
+// whoami tells operators which workspace a root key manages and what it may do there.
+// Unlike authenticateRootKey it answers for suspended root keys too, that is what they are debugging.
+func (s *Server) whoami(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.whoami")
+	defer span.End()
+
+	hashes, err := s.requestKeyHashes(c)
+	if err != nil {
+		return err
+	}
+	key, _, err := s.keyByHashes(ctx, hashes)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return errs.NewUnauthorized("unauthorized")
+		}
+		return errs.NewInternal(err, "unable to find key")
+	}
+	if key.ForWorkspaceId == "" {
+		return errs.NewBadRequest("wrong key type, this key belongs to an api and can only be verified. Root keys are created in the settings of your workspace")
+	}
+	span.SetAttributes(attribute.String("keyId", key.Id), attribute.String("workspaceId", key.ForWorkspaceId))
+
+	res := WhoamiResponse{
+		KeyId:       key.Id,
+		Name:        key.Name,
+		WorkspaceId: key.ForWorkspaceId,
+		Scopes:      key.Scopes,
+		CreatedAt:   key.CreatedAt.UnixMilli(),
+		Enabled:     key.SuspendedAt.IsZero(),
+	}
+	if res.Scopes == nil {
+		res.Scopes = []string{}
+	}
+	if !key.Expires.IsZero() {
+		res.Expires = key.Expires.UnixMilli()
+	}
+	return c.JSON(res)
+}
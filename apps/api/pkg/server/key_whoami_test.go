@@ -0,0 +1,78 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+func TestWhoami(t *testing.T) {
+	createdAt := time.Now().Add(-time.Hour)
+	db := newMemoryDatabase()
+	db.addKey("root", entities.Key{
+		Id:             "key_root",
+		Name:           "ci",
+		WorkspaceId:    "ws_unkey",
+		ForWorkspaceId: "ws_1",
+		Scopes:         []string{entities.ScopeKeysRead},
+		CreatedAt:      createdAt,
+	})
+	db.addKey("suspended", entities.Key{
+		Id:             "key_suspended",
+		WorkspaceId:    "ws_unkey",
+		ForWorkspaceId: "ws_1",
+		CreatedAt:      createdAt,
+		SuspendedAt:    time.Now(),
+	})
+	db.addKey("api_key", entities.Key{
+		Id:          "key_api",
+		WorkspaceId: "ws_1",
+		CreatedAt:   createdAt,
+	})
+	srv := newTestServer(t, withDatabase(db))
+
+	whoami := func(key string) (int, string) {
+		req := httptest.NewRequest("GET", "/v1/keys.whoami", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(body)
+	}
+
+	status, body := whoami("root")
+	require.Equal(t, 200, status)
+	res := WhoamiResponse{}
+	require.NoError(t, json.Unmarshal([]byte(body), &res))
+	require.Equal(t, WhoamiResponse{
+		KeyId:       "key_root",
+		Name:        "ci",
+		WorkspaceId: "ws_1",
+		Scopes:      []string{entities.ScopeKeysRead},
+		CreatedAt:   createdAt.UnixMilli(),
+		Enabled:     true,
+	}, res)
+	require.NotContains(t, body, "hash")
+
+	status, body = whoami("suspended")
+	require.Equal(t, 200, status)
+	res = WhoamiResponse{}
+	require.NoError(t, json.Unmarshal([]byte(body), &res))
+	require.False(t, res.Enabled)
+	// no scopes is full access
+	require.Equal(t, []string{}, res.Scopes)
+
+	status, body = whoami("api_key")
+	require.Equal(t, 400, status)
+	require.Contains(t, body, "can only be verified")
+
+	status, _ = whoami("does_not_exist")
+	require.Equal(t, 401, status)
+}
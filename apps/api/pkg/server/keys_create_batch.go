@@ -0,0 +1,231 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/service"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type CreateKeysBatchRequest struct {
+	// Keys are createKey requests, up to 100 keys can be created at once
+	Keys []json.RawMessage `json:"keys" validate:"required,min=1,max=100"`
+	// Partial creates the valid keys even if others are invalid. By default no key is created
+	// unless all of them can be. Internal errors fail the request in both modes.
+	Partial bool `json:"partial"`
+}
+
+type CreateKeysBatchResponse struct {
+	// Keys are in the order of the request, keys that were not created are null
+	Keys []*CreateKeyResponse `json:"keys"`
+	// Errors explains why keys were not created, it is only set in partial mode
+	Errors []CreateKeysBatchError `json:"errors,omitempty"`
+}
+
+// CreateKeysBatchError is why a single key of a batch could not be created
+type CreateKeysBatchError struct {
+	// Index of the key in the request
+	Index int       `json:"index"`
+	Code  ErrorCode `json:"code"`
+	Error string    `json:"error"`
+	// Errors lists every invalid field of the key, if it failed validation
+	Errors []errs.FieldError `json:"errors,omitempty"`
+}
+
+// batchKey is a key of the batch that passed validation
+type batchKey struct {
+	index   int
+	req     CreateKeyRequest
+	expires time.Time
+}
+
+// createKeysBatch creates many keys with one request, for example when onboarding a customer with several
+// environments. Every key is validated like in createKey.
+//
+// By default the batch is all or nothing: if any key is invalid, the request fails with an error listing every
+// invalid key and no key is stored. In partial mode the valid keys are created and the invalid ones are listed
+// in the response.
+func (s *Server) createKeysBatch(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.createKeysBatch")
+	defer span.End()
+
+	req := CreateKeysBatchRequest{}
+	err := c.BodyParser(&req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+	}
+
+	err = s.validator.Struct(req)
+	if err != nil {
+		return validationError(err)
+	}
+
+	authKey, err := s.authenticateRootKey(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	err = requireScope(authKey, entities.ScopeKeysCreate)
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(
+		attribute.String("workspaceId", authKey.ForWorkspaceId),
+		attribute.Int("keys", len(req.Keys)),
+		attribute.Bool("partial", req.Partial),
+	)
+
+	// every key counts against the ratelimit, as if it was created on its own
+	for range req.Keys {
+		err = s.ratelimitCreateKey(c, authKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	valid := []batchKey{}
+	failed := []CreateKeysBatchError{}
+	for i, raw := range req.Keys {
+		keyReq, expires, err := s.parseBatchKey(raw)
+		if err != nil {
+			e, ok := errs.As(err)
+			if !ok {
+				return err
+			}
+			failed = append(failed, batchError(i, e))
+			continue
+		}
+		valid = append(valid, batchKey{index: i, req: keyReq, expires: expires})
+	}
+
+	res := CreateKeysBatchResponse{Keys: make([]*CreateKeyResponse, len(req.Keys))}
+	from := httpCaller(c)
+
+	if req.Partial {
+		for _, k := range valid {
+			created, err := s.insertKey(ctx, from, k.req, authKey, k.expires)
+			if err != nil {
+				// only problems of the key itself are reported per index, keys created before are kept
+				e, ok := errs.As(err)
+				if !ok || e.Code == errs.INTERNAL_SERVER_ERROR {
+					return err
+				}
+				failed = append(failed, batchError(k.index, e))
+				continue
+			}
+			res.Keys[k.index] = &created
+		}
+		// keys are created in order, but invalid ones are found before
+		sortBatchErrors(failed)
+		res.Errors = failed
+		s.setConsistencyToken(c)
+		return c.JSON(res)
+	}
+
+	// keys that are invalid on their own are skipped, the others are still checked against the database,
+	// so the client can fix all of them at once
+	createdKeys := make([]entities.Key, 0, len(valid))
+	err = s.service.WithTx(ctx, func(svc *service.Service) error {
+		for _, k := range valid {
+			newKey, keyValue, err := svc.CreateKey(ctx, authKey.ForWorkspaceId, createKeyParams(k.req, k.expires))
+			if err != nil {
+				e, ok := errs.As(err)
+				if !ok || e.Code == errs.INTERNAL_SERVER_ERROR {
+					return err
+				}
+				failed = append(failed, batchError(k.index, e))
+				continue
+			}
+			createdKeys = append(createdKeys, newKey)
+			res.Keys[k.index] = &CreateKeyResponse{Key: keyValue, KeyId: newKey.Id}
+		}
+		if len(failed) > 0 {
+			return rejectBatch(failed, len(req.Keys))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// only announced once they are committed
+	for _, newKey := range createdKeys {
+		s.announceKeyCreated(ctx, from, authKey, newKey)
+	}
+	s.setConsistencyToken(c)
+	return c.JSON(res)
+}
+
+// parseBatchKey decodes and validates a single key of a batch, with the defaults of createKey
+func (s *Server) parseBatchKey(raw json.RawMessage) (CreateKeyRequest, time.Time, error) {
+	req := CreateKeyRequest{
+		// These act as default
+		ByteLength: 16,
+	}
+	err := json.Unmarshal(raw, &req)
+	if err != nil {
+		if isMetaTypeError(err) {
+			return CreateKeyRequest{}, time.Time{}, errs.NewBadRequest("'meta' must be a json object")
+		}
+		return CreateKeyRequest{}, time.Time{}, errs.NewBadRequest(fmt.Sprintf("unable to parse key: %s", err.Error()))
+	}
+	if req.DryRun {
+		return CreateKeyRequest{}, time.Time{}, errs.NewBadRequest("'dryRun' is not supported in a batch")
+	}
+	if req.ForWorkspaceId != "" {
+		return CreateKeyRequest{}, time.Time{}, errs.NewBadRequest("'forWorkspaceId' is not supported in a batch")
+	}
+
+	expires, err := s.validateCreateKey(req)
+	if err != nil {
+		return CreateKeyRequest{}, time.Time{}, err
+	}
+	return req, expires, nil
+}
+
+func batchError(index int, e *errs.Error) CreateKeysBatchError {
+	return CreateKeysBatchError{
+		Index:  index,
+		Code:   string(e.Code),
+		Error:  e.Message,
+		Errors: e.FieldErrors,
+	}
+}
+
+func sortBatchErrors(failed []CreateKeysBatchError) {
+	sort.Slice(failed, func(i, j int) bool { return failed[i].Index < failed[j].Index })
+}
+
+// rejectBatch fails an all or nothing batch. The fields of every failed key are named by their path in the
+// request, like keys[2].ownerId, keys that failed for another reason are named keys[2].
+func rejectBatch(failed []CreateKeysBatchError, total int) *errs.Error {
+	sortBatchErrors(failed)
+	fieldErrors := []errs.FieldError{}
+	for _, f := range failed {
+		prefix := fmt.Sprintf("keys[%d]", f.Index)
+		if len(f.Errors) == 0 {
+			fieldErrors = append(fieldErrors, errs.FieldError{
+				Field:      prefix,
+				Constraint: string(f.Code),
+				Message:    fmt.Sprintf("%s: %s", prefix, f.Error),
+			})
+			continue
+		}
+		for _, fe := range f.Errors {
+			field := fmt.Sprintf("%s.%s", prefix, fe.Field)
+			fieldErrors = append(fieldErrors, errs.FieldError{
+				Field:      field,
+				Constraint: fe.Constraint,
+				Message:    strings.Replace(fe.Message, fmt.Sprintf("'%s'", fe.Field), fmt.Sprintf("'%s'", field), 1),
+			})
+		}
+	}
+	return errs.NewBadRequest(fmt.Sprintf("%d of %d keys can not be created, no key was created", len(failed), total)).WithFieldErrors(fieldErrors)
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
+	"github.com/unkeyed/unkey/apps/api/pkg/cache"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/tracing"
+)
+
+// createBatchDatabase knows api_1 and rolls back the keys created in a failed transaction
+type createBatchDatabase struct {
+	database.Database
+	workspace entities.Workspace
+	created   []entities.Key
+	audited   int
+	// returned by CreateKey if set
+	createErr error
+}
+
+func (db *createBatchDatabase) GetKeyByHash(ctx context.Context, hash string) (entities.Key, error) {
+	return entities.Key{Id: "key_root", ForWorkspaceId: db.workspace.Id}, nil
+}
+
+func (db *createBatchDatabase) GetKeysByHashes(ctx context.Context, hashes []string) (map[string]entities.Key, error) {
+	return keysByHashes(ctx, hashes, db.GetKeyByHash)
+}
+
+func (db *createBatchDatabase) GetApi(ctx context.Context, apiId string) (entities.Api, error) {
+	if apiId != "api_1" {
+		return entities.Api{}, database.ErrNotFound
+	}
+	return entities.Api{Id: apiId, WorkspaceId: db.workspace.Id, AuthType: entities.AuthTypeKey, KeyAuthId: "key_auth_1"}, nil
+}
+
+func (db *createBatchDatabase) GetWorkspace(ctx context.Context, workspaceId string) (entities.Workspace, error) {
+	return db.workspace, nil
+}
+
+func (db *createBatchDatabase) CountKeysByWorkspace(ctx context.Context, workspaceId string) (int, error) {
+	return len(db.created), nil
+}
+
+func (db *createBatchDatabase) CreateKey(ctx context.Context, newKey entities.Key) error {
+	if db.createErr != nil {
+		return db.createErr
+	}
+	db.created = append(db.created, newKey)
+	return nil
+}
+
+func (db *createBatchDatabase) WithTx(ctx context.Context, fn func(tx database.Database) error) error {
+	before := len(db.created)
+	err := fn(db)
+	if err != nil {
+		db.created = db.created[:before]
+	}
+	return err
+}
+
+func (db *createBatchDatabase) AppendAuditLog(ctx context.Context, entry audit.Entry) error {
+	db.audited++
+	return nil
+}
+
+func newCreateBatchServer(maxKeys int) (*Server, *createBatchDatabase) {
+	db := &createBatchDatabase{workspace: entities.Workspace{Id: "ws_1", MaxKeys: maxKeys}}
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: db,
+		Tracer:   tracing.NewNoop(),
+	})
+	return srv, db
+}
+
+// mixedBatch has valid keys at index 0 and 3, an invalid field at 1 and an unknown api at 2
+const mixedBatch = `[
+	{"apiId":"api_1","name":"first"},
+	{"apiId":"api_1","encoding":"hex"},
+	{"apiId":"api_2"},
+	{"apiId":"api_1","name":"last"}
+]`
+
+func TestCreateKeysBatch_AllOrNothing(t *testing.T) {
+	srv, db := newCreateBatchServer(0)
+
+	status, errorResponse := postJSON(t, srv, "/v1/keys.createBatch", `{"keys":`+mixedBatch+`}`)
+	require.Equal(t, 400, status)
+	require.Equal(t, BAD_REQUEST, errorResponse.Code)
+	require.Equal(t, "2 of 4 keys can not be created, no key was created", errorResponse.Error)
+	require.Equal(t, []errs.FieldError{
+		{Field: "keys[1].encoding", Constraint: "oneof=base58 base62 base64url", Message: "'keys[1].encoding' must be one of: base58, base62, base64url"},
+		{Field: "keys[2]", Constraint: "BAD_REQUEST", Message: "keys[2]: wrong apiId"},
+	}, errorResponse.Errors)
+	require.Empty(t, db.created)
+
+	status, body := postWithAuthorization(t, srv, "/v1/keys.createBatch", "Bearer root_key", `{"keys":[{"apiId":"api_1"},{"apiId":"api_1","prefix":"test"}]}`)
+	require.Equal(t, 200, status)
+	res := CreateKeysBatchResponse{}
+	require.NoError(t, json.Unmarshal(body, &res))
+	require.Len(t, res.Keys, 2)
+	require.Empty(t, res.Errors)
+	require.Len(t, db.created, 2)
+	for i, key := range res.Keys {
+		require.NotNil(t, key)
+		require.Equal(t, db.created[i].Id, key.KeyId)
+	}
+	require.Regexp(t, "^test_", res.Keys[1].Key)
+	srv.background.Wait()
+	require.Equal(t, 2, db.audited)
+}
+
+func TestCreateKeysBatch_AllOrNothingRollsBack(t *testing.T) {
+	// the second key exceeds the quota, which is only known while creating the keys
+	srv, db := newCreateBatchServer(1)
+
+	status, errorResponse := postJSON(t, srv, "/v1/keys.createBatch", `{"keys":[{"apiId":"api_1"},{"apiId":"api_1"}]}`)
+	require.Equal(t, 400, status)
+	require.Equal(t, []errs.FieldError{
+		{Field: "keys[1]", Constraint: "LIMIT_EXCEEDED", Message: "keys[1]: workspace has reached its limit of 1 keys"},
+	}, errorResponse.Errors)
+	require.Empty(t, db.created)
+	require.Equal(t, 0, db.audited)
+}
+
+func TestCreateKeysBatch_Partial(t *testing.T) {
+	srv, db := newCreateBatchServer(0)
+
+	status, body := postWithAuthorization(t, srv, "/v1/keys.createBatch", "Bearer root_key", `{"partial":true,"keys":`+mixedBatch+`}`)
+	require.Equal(t, 200, status)
+	res := CreateKeysBatchResponse{}
+	require.NoError(t, json.Unmarshal(body, &res))
+
+	require.Len(t, res.Keys, 4)
+	require.NotNil(t, res.Keys[0])
+	require.Nil(t, res.Keys[1])
+	require.Nil(t, res.Keys[2])
+	require.NotNil(t, res.Keys[3])
+	require.Equal(t, []CreateKeysBatchError{
+		{Index: 1, Code: BAD_REQUEST, Error: "unable to validate body: Key: 'CreateKeyRequest.encoding' Error:Field validation for 'encoding' failed on the 'oneof' tag", Errors: []errs.FieldError{
+			{Field: "encoding", Constraint: "oneof=base58 base62 base64url", Message: "'encoding' must be one of: base58, base62, base64url"},
+		}},
+		{Index: 2, Code: BAD_REQUEST, Error: "wrong apiId"},
+	}, res.Errors)
+
+	require.Len(t, db.created, 2)
+	require.Equal(t, "first", db.created[0].Name)
+	require.Equal(t, "last", db.created[1].Name)
+	require.Equal(t, db.created[1].Id, res.Keys[3].KeyId)
+}
+
+func TestCreateKeysBatch_PartialFailsOnInternalErrors(t *testing.T) {
+	srv, db := newCreateBatchServer(0)
+	db.createErr = errors.New("connection lost")
+
+	status, errorResponse := postJSON(t, srv, "/v1/keys.createBatch", `{"partial":true,"keys":[{"apiId":"api_1"},{"apiId":"api_1"}]}`)
+	require.Equal(t, 500, status)
+	require.Equal(t, INTERNAL_SERVER_ERROR, errorResponse.Code)
+	require.Empty(t, errorResponse.Errors)
+	require.Empty(t, db.created)
+}
+
+func TestCreateKeysBatch_InvalidBody(t *testing.T) {
+	srv, _ := newCreateBatchServer(0)
+
+	for _, body := range []string{`{"keys":[]}`, `{"keys":[{"apiId":"api_1","dryRun":true}]}`, `{"keys":[{"apiId":"api_1","meta":"plan"}]}`} {
+		status, _ := postJSON(t, srv, "/v1/keys.createBatch", body)
+		require.Equal(t, 400, status, body)
+	}
+}
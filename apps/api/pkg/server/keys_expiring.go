@@ -0,0 +1,98 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type ListExpiringKeysRequest struct {
+	ApiId string `validate:"required"`
+	// Within is how far ahead to look, in the same notation as expiresIn, for example "7d"
+	Within string `validate:"required"`
+	Limit  int    `validate:"min=1,max=100"`
+	Offset int    `validate:"min=0"`
+}
+
+type ListExpiringKeysResponse struct {
+	// Keys are ordered by expiry, soonest first
+	Keys   []keyResponse `json:"keys"`
+	Limit  int           `json:"limit"`
+	Offset int           `json:"offset"`
+}
+
+// listExpiringKeys returns the keys of an api that have not expired yet but will within the given window.
+func (s *Server) listExpiringKeys(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.listExpiringKeys")
+	defer span.End()
+
+	req := ListExpiringKeysRequest{
+		ApiId:  c.Query("apiId"),
+		Within: c.Query("within"),
+		Limit:  c.QueryInt("limit", 100),
+		Offset: c.QueryInt("offset", 0),
+	}
+
+	err := s.validator.Struct(req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to validate request: %s", err.Error()))
+	}
+
+	within, err := parseExpiresIn(req.Within)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("'within' is invalid: %s", err.Error()))
+	}
+
+	authKey, err := s.authenticateRootKey(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	err = requireScope(authKey, entities.ScopeKeysRead)
+	if err != nil {
+		return err
+	}
+
+	api, err := s.db.GetApi(ctx, req.ApiId)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return errs.NewNotFound(fmt.Sprintf("unable to find api: %s", req.ApiId))
+		}
+		return errs.NewInternal(err, "unable to find api")
+	}
+	if api.WorkspaceId != authKey.ForWorkspaceId {
+		return errs.NewUnauthorized("access to workspace denied")
+	}
+	if api.KeyAuthId == "" {
+		return errs.NewBadRequest("api is not set up to handle key auth")
+	}
+	span.SetAttributes(attribute.String("apiId", api.Id), attribute.String("within", req.Within))
+
+	now := time.Now()
+	workspace, err := s.cachedWorkspace(ctx, api.WorkspaceId)
+	if err != nil {
+		return errs.NewInternal(err, "unable to find workspace")
+	}
+
+	keys, err := s.db.ListKeysExpiringBetween(ctx, api.KeyAuthId, now, now.Add(within), req.Limit, req.Offset)
+	if err != nil {
+		return errs.NewInternal(err, "unable to list keys")
+	}
+
+	res := ListExpiringKeysResponse{
+		Keys:   make([]keyResponse, len(keys)),
+		Limit:  req.Limit,
+		Offset: req.Offset,
+	}
+	for i, k := range keys {
+		res.Keys[i] = newKeyResponse(api.Id, k, s.keyStart(workspace, k))
+	}
+
+	return c.JSON(res)
+}
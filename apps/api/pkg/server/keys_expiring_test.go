@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+func TestListExpiringKeys(t *testing.T) {
+	now := time.Now()
+	db := newMemoryDatabase()
+	for _, key := range []entities.Key{
+		{Id: "key_never", KeyAuthId: "key_auth_1"},
+		{Id: "key_expired", KeyAuthId: "key_auth_1", Expires: now.Add(-time.Hour)},
+		{Id: "key_5d", KeyAuthId: "key_auth_1", Expires: now.Add(5 * 24 * time.Hour)},
+		{Id: "key_1d", KeyAuthId: "key_auth_1", Expires: now.Add(24 * time.Hour)},
+		{Id: "key_30d", KeyAuthId: "key_auth_1", Expires: now.Add(30 * 24 * time.Hour)},
+		{Id: "key_other_api", KeyAuthId: "key_auth_2", Expires: now.Add(time.Hour)},
+	} {
+		key.WorkspaceId = "ws_1"
+		db.addKey(key.Id, key)
+	}
+
+	srv := newTestServer(t, withDatabase(db))
+
+	testCases := []struct {
+		query string
+		ids   []string
+	}{
+		{query: "?apiId=api_1&within=7d", ids: []string{"key_1d", "key_5d"}},
+		{query: "?apiId=api_1&within=7d&limit=1&offset=1", ids: []string{"key_5d"}},
+		{query: "?apiId=api_1&within=1h", ids: []string{}},
+		{query: "?apiId=api_1&within=5w", ids: []string{"key_1d", "key_5d", "key_30d"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/keys.expiring"+tc.query, nil)
+			req.Header.Set("Authorization", "Bearer root_key")
+
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, 200, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+
+			listRes := ListExpiringKeysResponse{}
+			require.NoError(t, json.Unmarshal(body, &listRes))
+
+			ids := []string{}
+			for _, k := range listRes.Keys {
+				require.Equal(t, "api_1", k.ApiId)
+				require.NotZero(t, k.Expires)
+				ids = append(ids, k.Id)
+			}
+			require.Equal(t, tc.ids, ids)
+		})
+	}
+}
+
+func TestListExpiringKeys_Rejects(t *testing.T) {
+	db := newMemoryDatabase()
+	db.addWorkspace(entities.Workspace{Id: "ws_2"})
+	db.addApi(entities.Api{Id: "api_other", WorkspaceId: "ws_2", AuthType: entities.AuthTypeKey, KeyAuthId: "key_auth_2"})
+	srv := newTestServer(t, withDatabase(db))
+
+	testCases := []struct {
+		name   string
+		query  string
+		status int
+		code   ErrorCode
+	}{
+		{name: "missing within", query: "?apiId=api_1", status: 400, code: BAD_REQUEST},
+		{name: "invalid within", query: "?apiId=api_1&within=7", status: 400, code: BAD_REQUEST},
+		{name: "missing apiId", query: "?within=7d", status: 400, code: BAD_REQUEST},
+		{name: "limit too large", query: "?apiId=api_1&within=7d&limit=1000", status: 400, code: BAD_REQUEST},
+		{name: "other workspace", query: "?apiId=api_other&within=7d", status: 401, code: UNAUTHORIZED},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/keys.expiring"+tc.query, nil)
+			req.Header.Set("Authorization", "Bearer root_key")
+
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.status, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+
+			errorRes := ErrorResponse{}
+			require.NoError(t, json.Unmarshal(body, &errorRes))
+			require.Equal(t, tc.code, errorRes.Code)
+		})
+	}
+}
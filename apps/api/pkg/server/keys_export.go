@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// DefaultExportPageSize is how many keys an export loads from the database at once
+const DefaultExportPageSize = 1000
+
+// exportError is the last line of an export that failed after the response was started,
+// the status code was sent already.
+type exportError struct {
+	Error string `json:"error"`
+}
+
+// exportKeys streams the non-secret fields of every key of the workspace as newline delimited json,
+// one keyResponse per line. Keys are paged through by id, so only a single page is held in memory,
+// no matter how large the workspace is.
+func (s *Server) exportKeys(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.exportKeys")
+	defer span.End()
+
+	authKey, err := s.authenticateRootKey(ctx, c)
+	if err != nil {
+		return err
+	}
+	err = requireScope(authKey, entities.ScopeKeysRead)
+	if err != nil {
+		return err
+	}
+	workspaceId := authKey.ForWorkspaceId
+	span.SetAttributes(attribute.String("workspaceId", workspaceId))
+
+	workspace, err := s.cachedWorkspace(ctx, workspaceId)
+	if err != nil {
+		return errs.NewInternal(err, "unable to find workspace")
+	}
+
+	// the first page is loaded before the response starts, so errors still get a status code
+	page, err := s.db.ListKeysByWorkspaceId(ctx, workspaceId, "", s.exportPageSize)
+	if err != nil {
+		return errs.NewInternal(err, "unable to list keys")
+	}
+
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	// the writer runs after the handler returned, it must not touch c.
+	// The request deadline has passed or been cancelled by then, every page is loaded without it
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		err := s.writeKeysExport(detach(ctx), w, workspace, page)
+		if err != nil {
+			s.logger.Error("unable to export keys", zap.String("workspaceId", workspaceId), zap.Error(err))
+			line, _ := json.Marshal(exportError{Error: "export aborted, not all keys were written"})
+			_, _ = w.Write(append(line, '\n'))
+		}
+		_ = w.Flush()
+	})
+	return nil
+}
+
+// writeKeysExport writes the first page and all following pages of keys, one json line each
+func (s *Server) writeKeysExport(ctx context.Context, w *bufio.Writer, workspace entities.Workspace, page []entities.Key) error {
+	apiIds := map[string]string{}
+	encoder := json.NewEncoder(w)
+	for {
+		for _, k := range page {
+			apiId, ok := apiIds[k.KeyAuthId]
+			if !ok {
+				api, err := s.db.GetApiByKeyAuthId(ctx, k.KeyAuthId)
+				if err != nil && !errors.Is(err, database.ErrNotFound) {
+					return err
+				}
+				apiId = api.Id
+				apiIds[k.KeyAuthId] = apiId
+			}
+			err := encoder.Encode(newKeyResponse(apiId, k, s.keyStart(workspace, k)))
+			if err != nil {
+				return err
+			}
+		}
+		// every page is sent before the next one is loaded
+		err := w.Flush()
+		if err != nil {
+			return err
+		}
+		if len(page) < s.exportPageSize {
+			return nil
+		}
+
+		page, err = s.db.ListKeysByWorkspaceId(ctx, workspace.Id, page[len(page)-1].Id, s.exportPageSize)
+		if err != nil {
+			return err
+		}
+	}
+}
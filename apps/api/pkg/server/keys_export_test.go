@@ -0,0 +1,75 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+func TestExportKeys_Pages(t *testing.T) {
+	db := newMemoryDatabase()
+	db.addApi(entities.Api{Id: "api_2", WorkspaceId: "ws_1", AuthType: entities.AuthTypeKey, KeyAuthId: "key_auth_2"})
+	for i := 0; i < 7; i++ {
+		keyAuthId := "key_auth_1"
+		if i%2 == 1 {
+			keyAuthId = "key_auth_2"
+		}
+		db.addKey("", entities.Key{
+			Id:          fmt.Sprintf("key_%d", i),
+			KeyAuthId:   keyAuthId,
+			WorkspaceId: "ws_1",
+			Start:       "sk_abc",
+			Hash:        fmt.Sprintf("secret_hash_%d", i),
+		})
+	}
+	db.addKey("other_key", entities.Key{Id: "key_other", KeyAuthId: "key_auth_3", WorkspaceId: "ws_2"})
+
+	srv := newTestServer(t, withDatabase(db), func(c *Config) {
+		c.ExportPageSize = 3
+	})
+
+	req := httptest.NewRequest("GET", "/v1/keys.export", nil)
+	req.Header.Set("Authorization", "Bearer root_key")
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 200, res.StatusCode)
+	require.Equal(t, "application/x-ndjson", res.Header.Get("Content-Type"))
+
+	exported := []keyResponse{}
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		require.NotContains(t, scanner.Text(), "secret_hash")
+		k := keyResponse{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &k))
+		exported = append(exported, k)
+	}
+	require.NoError(t, scanner.Err())
+
+	require.Len(t, exported, 7)
+	for i, k := range exported {
+		require.Equal(t, fmt.Sprintf("key_%d", i), k.Id)
+		require.Equal(t, "sk_abc", k.Start)
+		if i%2 == 1 {
+			require.Equal(t, "api_2", k.ApiId)
+		} else {
+			require.Equal(t, "api_1", k.ApiId)
+		}
+	}
+	// 3 + 3 + 1, the short page ends the export
+	require.Equal(t, 3, db.callsOf("ListKeysByWorkspaceId"))
+}
+
+func TestExportKeys_RequiresRootKey(t *testing.T) {
+	srv := newTestServer(t)
+
+	res, err := srv.app.Test(httptest.NewRequest("GET", "/v1/keys.export", nil))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 401, res.StatusCode)
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type ImportKey struct {
+	// KeyId keeps the id the key had in the other system, a new id is generated if it is empty
+	KeyId string `json:"keyId" validate:"omitempty,max=256"`
+	// Hash is the base64 encoded sha256 hash of the key
+	Hash string `json:"hash" validate:"required"`
+	// Start is shown to users to identify the key, we can not derive it from the hash
+	Start     string         `json:"start" validate:"required,max=256"`
+	Name      string         `json:"name"`
+	OwnerId   string         `json:"ownerId"`
+	Meta      map[string]any `json:"meta"`
+	Expires   int64          `json:"expires"`
+	Remaining int64          `json:"remaining,omitempty"`
+	// A ratelimit needs all fields, otherwise the bucket never refills
+	Ratelimit *NewKeyRatelimit `json:"ratelimit"`
+}
+
+// importKeyIdPattern keeps ids url safe, they are used in paths like /v1/keys/:keyId
+var importKeyIdPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+type ImportKeysRequest struct {
+	ApiId string `json:"apiId" validate:"required"`
+	// Up to 100 keys can be imported at once
+	Keys []ImportKey `json:"keys" validate:"required,min=1,max=100,dive"`
+}
+
+type ImportKeysResponse struct {
+	// KeyIds are in the same order as the imported keys
+	KeyIds []string `json:"keyIds"`
+}
+
+// importKeys stores keys that were created in another system, only their hashes are known.
+// Either all keys are imported or none.
+func (s *Server) importKeys(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.importKeys")
+	defer span.End()
+
+	req := ImportKeysRequest{}
+	err := c.BodyParser(&req)
+	if err != nil {
+		if isMetaTypeError(err) {
+			return errs.NewBadRequest("'meta' must be a json object")
+		}
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+	}
+
+	err = s.validator.Struct(req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to validate body: %s", err.Error()))
+	}
+
+	now := time.Now()
+	hashes := make(map[string]bool, len(req.Keys))
+	keyIds := map[string]bool{}
+	for i, k := range req.Keys {
+		if !hash.IsSha256(k.Hash) {
+			return errs.NewBadRequest(fmt.Sprintf("keys[%d].hash must be a base64 encoded sha256 hash", i))
+		}
+		if hashes[k.Hash] {
+			return errs.NewBadRequest(fmt.Sprintf("keys[%d].hash is a duplicate", i))
+		}
+		hashes[k.Hash] = true
+		if k.KeyId != "" {
+			if !importKeyIdPattern.MatchString(k.KeyId) {
+				return errs.NewBadRequest(fmt.Sprintf("keys[%d].keyId must only contain letters, digits, '_' and '-'", i))
+			}
+			if keyIds[k.KeyId] {
+				return errs.NewBadRequest(fmt.Sprintf("keys[%d].keyId is a duplicate", i))
+			}
+			keyIds[k.KeyId] = true
+		}
+		if expiryInPast(k.Expires, now, s.clockSkewTolerance) {
+			return errs.NewBadRequest(fmt.Sprintf("keys[%d].expires must be in the future, did you pass in a timestamp in seconds instead of milliseconds?", i))
+		}
+		err = s.validateMeta(k.Meta)
+		if err != nil {
+			return err
+		}
+		err = s.validateOwnerId(fmt.Sprintf("keys[%d].ownerId", i), k.OwnerId)
+		if err != nil {
+			return err
+		}
+	}
+
+	authKey, err := s.authenticateRootKey(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	err = requireScope(authKey, entities.ScopeKeysCreate)
+	if err != nil {
+		return err
+	}
+
+	api, err := s.db.GetApi(ctx, req.ApiId)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return errs.NewNotFound(fmt.Sprintf("unable to find api: %s", req.ApiId))
+		}
+		return errs.NewInternal(err, "unable to find api")
+	}
+	if api.WorkspaceId != authKey.ForWorkspaceId {
+		return errs.NewUnauthorized("access to workspace denied")
+	}
+	if api.AuthType != entities.AuthTypeKey || api.KeyAuthId == "" {
+		return errs.NewBadRequest("api is not set up to handle key auth")
+	}
+	span.SetAttributes(attribute.String("apiId", api.Id), attribute.Int("keys", len(req.Keys)))
+
+	workspace, err := s.db.GetWorkspace(ctx, api.WorkspaceId)
+	if err != nil {
+		return errs.NewInternal(err, "unable to load workspace")
+	}
+
+	err = s.service.CheckKeyQuota(ctx, workspace, len(req.Keys))
+	if err != nil {
+		return err
+	}
+
+	newKeys := make([]entities.Key, len(req.Keys))
+	for i, k := range req.Keys {
+		// imported hashes are peppered like the hashes of created keys, the first candidate is the one to store
+		candidates, err := s.hasher.Sha256Candidates(k.Hash)
+		if err != nil {
+			return errs.NewBadRequest(fmt.Sprintf("keys[%d].hash must be a base64 encoded sha256 hash", i))
+		}
+		_, _, err = s.keyByHashes(ctx, candidates)
+		if err == nil {
+			return errs.NewBadRequest(fmt.Sprintf("keys[%d] already exists", i))
+		}
+		if !errors.Is(err, database.ErrNotFound) {
+			return errs.NewInternal(err, "unable to check for existing key")
+		}
+
+		keyId := k.KeyId
+		if keyId == "" {
+			keyId = uid.Key()
+		} else {
+			_, err = s.db.GetKeyById(ctx, keyId)
+			if err == nil {
+				return errs.New(errs.CONFLICT, fmt.Sprintf("keys[%d].keyId is already taken", i))
+			}
+			if !errors.Is(err, database.ErrNotFound) {
+				return errs.NewInternal(err, "unable to check for existing key id")
+			}
+		}
+
+		newKey := entities.Key{
+			Id:          keyId,
+			KeyAuthId:   api.KeyAuthId,
+			WorkspaceId: authKey.ForWorkspaceId,
+			Name:        k.Name,
+			Hash:        candidates[0],
+			Start:       k.Start,
+			OwnerId:     k.OwnerId,
+			Meta:        k.Meta,
+			CreatedAt:   now,
+		}
+		if workspace.OmitKeyStart {
+			// imported keys are never recoverable, they will not have a start at all
+			newKey.Start = ""
+		}
+		if k.Expires > 0 {
+			newKey.Expires = time.UnixMilli(k.Expires)
+		}
+		if k.Remaining > 0 {
+			newKey.Remaining.Enabled = true
+			newKey.Remaining.Remaining = k.Remaining
+		}
+		if k.Ratelimit != nil {
+			newKey.Ratelimit = &entities.Ratelimit{
+				Type:           k.Ratelimit.Type,
+				Limit:          k.Ratelimit.Limit,
+				RefillRate:     k.Ratelimit.RefillRate,
+				RefillInterval: int64(k.Ratelimit.RefillInterval),
+				CheckOrder:     k.Ratelimit.CheckOrder,
+			}
+		}
+		newKeys[i] = newKey
+	}
+
+	err = s.db.CreateKeys(ctx, newKeys)
+	if err != nil {
+		// another request took an id or hash since we checked
+		if errors.Is(err, database.ErrNotUnique) {
+			return errs.New(errs.CONFLICT, "a key with the same id or hash was created in the meantime")
+		}
+		return errs.NewInternal(err, "unable to store keys")
+	}
+
+	res := ImportKeysResponse{KeyIds: make([]string, len(newKeys))}
+	for i, newKey := range newKeys {
+		res.KeyIds[i] = newKey.Id
+		s.metrics.KeysCreated.Inc()
+		s.emitKeyEvent(ctx, kafka.KeyCreated, newKey)
+		s.appendAuditLog(ctx, c, audit.Entry{
+			WorkspaceId: newKey.WorkspaceId,
+			ActorKeyId:  authKey.Id,
+			Action:      audit.KeyCreated,
+			TargetKeyId: newKey.Id,
+			Reason:      "imported",
+		})
+	}
+
+	s.setConsistencyToken(c)
+	return c.JSON(res)
+}
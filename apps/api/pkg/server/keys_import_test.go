@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+)
+
+func importKeys(t *testing.T, srv *Server, body string) (int, ImportKeysResponse) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/v1/keys.import", bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer root_key")
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	buf, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	importRes := ImportKeysResponse{}
+	if res.StatusCode == 200 {
+		require.NoError(t, json.Unmarshal(buf, &importRes))
+	}
+	return res.StatusCode, importRes
+}
+
+func TestImportKeys(t *testing.T) {
+	db := newMemoryDatabase()
+	srv := newTestServer(t, withDatabase(db))
+
+	body := fmt.Sprintf(`{"apiId":"api_1","keys":[
+		{"hash":%q,"start":"sk_live_abcd","ownerId":"chronark","meta":{"plan":"pro"},"remaining":10},
+		{"hash":%q,"start":"sk_live_efgh","ratelimit":{"type":"fast","limit":10,"refillRate":1,"refillInterval":"1s"}}
+	]}`, hash.Sha256("sk_live_abcd1234"), hash.Sha256("sk_live_efgh5678"))
+
+	status, res := importKeys(t, srv, body)
+	require.Equal(t, 200, status)
+	require.Len(t, res.KeyIds, 2)
+
+	first, err := db.GetKeyByHash(context.Background(), hash.Sha256("sk_live_abcd1234"))
+	require.NoError(t, err)
+	require.Equal(t, res.KeyIds[0], first.Id)
+	require.Equal(t, "sk_live_abcd", first.Start)
+	require.Equal(t, "key_auth_1", first.KeyAuthId)
+	require.Equal(t, "ws_1", first.WorkspaceId)
+	require.Equal(t, "chronark", first.OwnerId)
+	require.Equal(t, map[string]any{"plan": "pro"}, first.Meta)
+	require.True(t, first.Remaining.Enabled)
+	require.Equal(t, int64(10), first.Remaining.Remaining)
+
+	second, err := db.GetKeyByHash(context.Background(), hash.Sha256("sk_live_efgh5678"))
+	require.NoError(t, err)
+	require.Equal(t, res.KeyIds[1], second.Id)
+	require.Equal(t, int64(1000), second.Ratelimit.RefillInterval)
+
+	srv.background.Wait()
+	require.Len(t, db.auditLogs, 2)
+	for _, entry := range db.auditLogs {
+		require.Equal(t, audit.KeyCreated, entry.Action)
+		require.Equal(t, "imported", entry.Reason)
+	}
+
+	// importing the same hash again must not create a second key
+	status, _ = importKeys(t, srv, fmt.Sprintf(`{"apiId":"api_1","keys":[{"hash":%q,"start":"sk_live_abcd"}]}`, hash.Sha256("sk_live_abcd1234")))
+	require.Equal(t, 400, status)
+	require.Len(t, db.created, 2)
+}
+
+func TestImportKeys_KeyId(t *testing.T) {
+	db := newMemoryDatabase()
+	srv := newTestServer(t, withDatabase(db))
+
+	status, res := importKeys(t, srv, fmt.Sprintf(`{"apiId":"api_1","keys":[
+		{"hash":%q,"start":"sk_live_abcd","keyId":"legacy_42"},
+		{"hash":%q,"start":"sk_live_efgh"}
+	]}`, hash.Sha256("sk_live_abcd1234"), hash.Sha256("sk_live_efgh5678")))
+	require.Equal(t, 200, status)
+	require.Equal(t, "legacy_42", res.KeyIds[0])
+	require.Equal(t, "legacy_42", db.created[0].Id)
+	require.Equal(t, hash.Sha256("sk_live_abcd1234"), db.created[0].Hash)
+	// without a keyId the id is generated
+	require.NotEmpty(t, res.KeyIds[1])
+	require.NotEqual(t, "legacy_42", res.KeyIds[1])
+
+	// the id is taken now
+	status, _ = importKeys(t, srv, fmt.Sprintf(`{"apiId":"api_1","keys":[{"hash":%q,"start":"sk_live_ijkl","keyId":"legacy_42"}]}`, hash.Sha256("sk_live_ijkl9012")))
+	require.Equal(t, 409, status)
+	require.Len(t, db.created, 2)
+}
+
+func TestImportKeys_Peppered(t *testing.T) {
+	hasher, err := hash.NewHasher(map[int][]byte{1: bytes.Repeat([]byte{1}, hash.MinPepperSize)}, 1)
+	require.NoError(t, err)
+	db := newMemoryDatabase()
+	srv := newTestServer(t, withDatabase(db), func(c *Config) {
+		c.Hasher = hasher
+	})
+
+	body := fmt.Sprintf(`{"apiId":"api_1","keys":[{"hash":%q,"start":"sk_live_abcd"}]}`, hash.Sha256("sk_live_abcd1234"))
+	status, _ := importKeys(t, srv, body)
+	require.Equal(t, 200, status)
+
+	// the imported hash is stored like the hash of a created key
+	require.Len(t, db.created, 1)
+	require.Equal(t, hasher.Hash("sk_live_abcd1234"), db.created[0].Hash)
+
+	status, _ = importKeys(t, srv, body)
+	require.Equal(t, 400, status)
+}
+
+func TestImportKeys_Rejects(t *testing.T) {
+	valid := hash.Sha256("sk_live_abcd1234")
+
+	testCases := []struct {
+		name    string
+		maxKeys int
+		body    string
+		status  int
+	}{
+		{name: "no keys", body: `{"apiId":"api_1","keys":[]}`, status: 400},
+		{name: "missing start", body: fmt.Sprintf(`{"apiId":"api_1","keys":[{"hash":%q}]}`, valid), status: 400},
+		{name: "plaintext instead of hash", body: `{"apiId":"api_1","keys":[{"hash":"sk_live_abcd1234","start":"sk_live_abcd"}]}`, status: 400},
+		{name: "hex hash", body: `{"apiId":"api_1","keys":[{"hash":"2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824","start":"abcd"}]}`, status: 400},
+		{name: "duplicate hash", body: fmt.Sprintf(`{"apiId":"api_1","keys":[{"hash":%q,"start":"a"},{"hash":%q,"start":"b"}]}`, valid, valid), status: 400},
+		{name: "expires in seconds", body: fmt.Sprintf(`{"apiId":"api_1","keys":[{"hash":%q,"start":"a","expires":1686941966}]}`, valid), status: 400},
+		{name: "invalid keyId", body: fmt.Sprintf(`{"apiId":"api_1","keys":[{"hash":%q,"start":"a","keyId":"key/1"}]}`, valid), status: 400},
+		{name: "duplicate keyId", body: fmt.Sprintf(`{"apiId":"api_1","keys":[{"hash":%q,"start":"a","keyId":"key_1"},{"hash":%q,"start":"b","keyId":"key_1"}]}`, valid, hash.Sha256("other")), status: 400},
+		{name: "over quota", maxKeys: 1, body: fmt.Sprintf(`{"apiId":"api_1","keys":[{"hash":%q,"start":"a"},{"hash":%q,"start":"b"}]}`, valid, hash.Sha256("other")), status: 403},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newMemoryDatabase()
+			db.addWorkspace(entities.Workspace{Id: "ws_1", MaxKeys: tc.maxKeys})
+			srv := newTestServer(t, withDatabase(db))
+
+			status, _ := importKeys(t, srv, tc.body)
+			require.Equal(t, tc.status, status)
+			require.Empty(t, db.created)
+		})
+	}
+}
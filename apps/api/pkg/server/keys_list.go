@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
 	"net/http"
 )
 
@@ -20,13 +21,16 @@ type ratelimitSettng struct {
 	Limit          int64  `json:"limit"`
 	RefillRate     int64  `json:"refillRate"`
 	RefillInterval int64  `json:"refillInterval"`
+	CheckOrder     string `json:"checkOrder"`
 }
 
 type keyResponse struct {
-	Id             string           `json:"id"`
-	ApiId          string           `json:"apiId"`
-	WorkspaceId    string           `json:"workspaceId"`
-	Start          string           `json:"start"`
+	Id          string `json:"id"`
+	ApiId       string `json:"apiId"`
+	WorkspaceId string `json:"workspaceId"`
+	// Start is missing if the workspace hides it or the key was stored without one, see Server.keyStart
+	Start          string           `json:"start,omitempty"`
+	Name           string           `json:"name,omitempty"`
 	OwnerId        string           `json:"ownerId,omitempty"`
 	Meta           map[string]any   `json:"meta,omitempty"`
 	CreatedAt      int64            `json:"createdAt,omitempty"`
@@ -34,11 +38,19 @@ type keyResponse struct {
 	Ratelimit      *ratelimitSettng `json:"ratelimit,omitempty"`
 	ForWorkspaceId string           `json:"forWorkspaceId,omitempty"`
 	Remaining      *int64           `json:"remaining"`
+	ParentKeyId    string           `json:"parentKeyId,omitempty"`
+	// RemainingWarnThreshold is only set if the key has one
+	RemainingWarnThreshold *int64 `json:"remainingWarnThreshold,omitempty"`
+	// LastUsedAt is only set for a single key, it lags behind by up to a minute
+	LastUsedAt int64 `json:"lastUsedAt,omitempty"`
 }
 
 type ListKeysResponse struct {
-	Keys  []keyResponse `json:"keys"`
-	Total int           `json:"total"`
+	Keys []keyResponse `json:"keys"`
+	// Total is the number of keys matching the filter, across all pages
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
 }
 
 func (s *Server) listKeys(c *fiber.Ctx) error {
@@ -55,106 +67,124 @@ func (s *Server) listKeys(c *fiber.Ctx) error {
 	err = s.validator.Struct(req)
 	if err != nil {
 		return c.Status(http.StatusBadRequest).JSON(ErrorResponse{
-			Code:  BAD_REQUEST,
-			Error: fmt.Sprintf("unable to validate request: %s", err.Error()),
+			Code:      BAD_REQUEST,
+			Error:     fmt.Sprintf("unable to validate request: %s", err.Error()),
+			RequestId: requestId(c),
 		})
 	}
 
-	authHash, err := getKeyHash(c.Get("Authorization"))
+	authKey, err := s.authenticateRootKey(ctx, c)
 	if err != nil {
 		return err
 	}
 
-	authKey, err := s.db.GetKeyByHash(ctx, authHash)
+	err = requireScope(authKey, entities.ScopeKeysRead)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: fmt.Sprintf("unable to find key: %s", err.Error()),
-		})
-	}
-
-	if authKey.ForWorkspaceId == "" {
-		return c.Status(http.StatusBadRequest).JSON(ErrorResponse{
-			Code:  BAD_REQUEST,
-			Error: "wrong key type",
-		})
+		return err
 	}
 
 	api, err := s.db.GetApi(ctx, req.ApiId)
 	if err != nil {
 		if errors.Is(err, database.ErrNotFound) {
 			return c.Status(http.StatusNotFound).JSON(ErrorResponse{
-				Code:  NOT_FOUND,
-				Error: fmt.Sprintf("unable to find api: %s", req.ApiId),
+				Code:      NOT_FOUND,
+				Error:     fmt.Sprintf("unable to find api: %s", req.ApiId),
+				RequestId: requestId(c),
 			})
 		}
 		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: fmt.Sprintf("unable to find api: %s", err.Error()),
+			Code:      INTERNAL_SERVER_ERROR,
+			Error:     fmt.Sprintf("unable to find api: %s", err.Error()),
+			RequestId: requestId(c),
 		})
 	}
 	if api.WorkspaceId != authKey.ForWorkspaceId {
 		return c.Status(http.StatusUnauthorized).JSON(ErrorResponse{
-			Code:  UNAUTHORIZED,
-			Error: "access to workspace denied",
+			Code:      UNAUTHORIZED,
+			Error:     "access to workspace denied",
+			RequestId: requestId(c),
 		})
 	}
 
 	keyAuth, err := s.db.GetKeyAuth(ctx, api.KeyAuthId)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: err.Error(),
+			Code:      INTERNAL_SERVER_ERROR,
+			Error:     err.Error(),
+			RequestId: requestId(c),
 		})
 	}
 
-	keys, err := s.db.ListKeysByKeyAuthId(ctx, keyAuth.Id, req.Limit, req.Offset, req.OwnerId)
+	workspace, err := s.cachedWorkspace(ctx, api.WorkspaceId)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: err.Error(),
+			Code:      INTERNAL_SERVER_ERROR,
+			Error:     fmt.Sprintf("unable to find workspace: %s", err.Error()),
+			RequestId: requestId(c),
 		})
 	}
 
-	total, err := s.db.CountKeys(ctx, keyAuth.Id)
+	keys, total, err := s.db.ListKeysByKeyAuthId(ctx, keyAuth.Id, req.Limit, req.Offset, req.OwnerId)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: err.Error(),
+			Code:      INTERNAL_SERVER_ERROR,
+			Error:     err.Error(),
+			RequestId: requestId(c),
 		})
 	}
 
 	res := ListKeysResponse{
-		Keys:  make([]keyResponse, len(keys)),
-		Total: total,
+		Keys:   make([]keyResponse, len(keys)),
+		Total:  total,
+		Limit:  req.Limit,
+		Offset: req.Offset,
 	}
 
 	for i, k := range keys {
-		res.Keys[i] = keyResponse{
-			Id:             k.Id,
-			ApiId:          api.Id,
-			WorkspaceId:    k.WorkspaceId,
-			Start:          k.Start,
-			OwnerId:        k.OwnerId,
-			Meta:           k.Meta,
-			CreatedAt:      k.CreatedAt.UnixMilli(),
-			ForWorkspaceId: k.ForWorkspaceId,
-		}
-		if !k.Expires.IsZero() {
-			res.Keys[i].Expires = k.Expires.UnixMilli()
-		}
-		if k.Ratelimit != nil {
-			res.Keys[i].Ratelimit = &ratelimitSettng{
-				Type:           k.Ratelimit.Type,
-				Limit:          k.Ratelimit.Limit,
-				RefillRate:     k.Ratelimit.RefillRate,
-				RefillInterval: k.Ratelimit.RefillInterval,
-			}
-		}
-		if k.Remaining.Enabled {
-			res.Keys[i].Remaining = &k.Remaining.Remaining
-		}
+		res.Keys[i] = newKeyResponse(api.Id, k, s.keyStart(workspace, k))
 	}
 
 	return c.JSON(res)
 }
+
+func newKeyResponse(apiId string, k entities.Key, start string) keyResponse {
+	res := keyResponse{
+		Id:             k.Id,
+		ApiId:          apiId,
+		WorkspaceId:    k.WorkspaceId,
+		Name:           k.Name,
+		OwnerId:        k.OwnerId,
+		Meta:           k.Meta,
+		CreatedAt:      k.CreatedAt.UnixMilli(),
+		ForWorkspaceId: k.ForWorkspaceId,
+		ParentKeyId:    k.ParentKeyId,
+		Start:          start,
+	}
+	if !k.Expires.IsZero() {
+		res.Expires = k.Expires.UnixMilli()
+	}
+	if k.Ratelimit != nil {
+		res.Ratelimit = &ratelimitSettng{
+			Type:           k.Ratelimit.Type,
+			Limit:          k.Ratelimit.Limit,
+			RefillRate:     k.Ratelimit.RefillRate,
+			RefillInterval: k.Ratelimit.RefillInterval,
+			CheckOrder:     ratelimitCheckOrder(k.Ratelimit),
+		}
+	}
+	if k.Remaining.Enabled {
+		remaining := k.Remaining.Remaining
+		res.Remaining = &remaining
+	}
+	res.RemainingWarnThreshold = k.RemainingWarnThreshold
+	return res
+}
+
+// ratelimitCheckOrder is the order a key is verified in, keys that were created before it could
+// be chosen are checked remaining first
+func ratelimitCheckOrder(r *entities.Ratelimit) string {
+	if r.CheckOrder == "" {
+		return entities.CheckRemainingFirst
+	}
+	return r.CheckOrder
+}
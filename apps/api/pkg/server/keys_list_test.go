@@ -1,6 +1,7 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -14,8 +15,10 @@ import (
 	"github.com/unkeyed/unkey/apps/api/pkg/cache"
 	"github.com/unkeyed/unkey/apps/api/pkg/database"
 	databaseMiddleware "github.com/unkeyed/unkey/apps/api/pkg/database/middleware"
+	"github.com/unkeyed/unkey/apps/api/pkg/encryption"
 	"github.com/unkeyed/unkey/apps/api/pkg/entities"
 	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/keys"
 	"github.com/unkeyed/unkey/apps/api/pkg/logging"
 	"github.com/unkeyed/unkey/apps/api/pkg/testutil"
 	"github.com/unkeyed/unkey/apps/api/pkg/tracing"
@@ -48,7 +51,7 @@ func TestListKeys_Simple(t *testing.T) {
 			Id:          uid.Key(),
 			KeyAuthId:   resources.UserKeyAuth.Id,
 			WorkspaceId: resources.UserWorkspace.Id,
-			Hash:        hash.Sha256(uid.New(16, "test")),
+			Hash:        hash.Sha256(uid.New("test")),
 			CreatedAt:   time.Now(),
 		}
 		err := db.CreateKey(ctx, key)
@@ -104,7 +107,7 @@ func TestListKeys_FilterOwnerId(t *testing.T) {
 			Id:          uid.Key(),
 			KeyAuthId:   resources.UserKeyAuth.Id,
 			WorkspaceId: resources.UserWorkspace.Id,
-			Hash:        hash.Sha256(uid.New(16, "test")),
+			Hash:        hash.Sha256(uid.New("test")),
 			CreatedAt:   time.Now(),
 		}
 		// just add an ownerId to half of them
@@ -168,7 +171,7 @@ func TestListKeys_WithLimit(t *testing.T) {
 			Id:          uid.Key(),
 			KeyAuthId:   resources.UserKeyAuth.Id,
 			WorkspaceId: resources.UserWorkspace.Id,
-			Hash:        hash.Sha256(uid.New(16, "test")),
+			Hash:        hash.Sha256(uid.New("test")),
 			CreatedAt:   time.Now(),
 		}
 		err := db.CreateKey(ctx, key)
@@ -222,7 +225,7 @@ func TestListKeys_WithOffset(t *testing.T) {
 			Id:          uid.Key(),
 			KeyAuthId:   resources.UserKeyAuth.Id,
 			WorkspaceId: resources.UserWorkspace.Id,
-			Hash:        hash.Sha256(uid.New(16, "test")),
+			Hash:        hash.Sha256(uid.New("test")),
 			CreatedAt:   time.Now(),
 		}
 		err := db.CreateKey(ctx, key)
@@ -270,3 +273,216 @@ func TestListKeys_WithOffset(t *testing.T) {
 	require.Equal(t, successResponse1.Keys[1].Id, successResponse2.Keys[0].Id)
 
 }
+
+// pagingDatabase pages through keys like the real database
+type pagingDatabase struct {
+	database.Database
+	keys         []entities.Key
+	hideKeyStart bool
+}
+
+func (db *pagingDatabase) GetKeyByHash(ctx context.Context, h string) (entities.Key, error) {
+	return entities.Key{Id: "key_root", ForWorkspaceId: "ws_1"}, nil
+}
+
+func (db *pagingDatabase) GetKeysByHashes(ctx context.Context, hashes []string) (map[string]entities.Key, error) {
+	return keysByHashes(ctx, hashes, db.GetKeyByHash)
+}
+
+func (db *pagingDatabase) GetKeyById(ctx context.Context, keyId string) (entities.Key, error) {
+	for _, k := range db.keys {
+		if k.Id == keyId {
+			return k, nil
+		}
+	}
+	return entities.Key{}, database.ErrNotFound
+}
+
+func (db *pagingDatabase) GetApiByKeyAuthId(ctx context.Context, keyAuthId string) (entities.Api, error) {
+	return entities.Api{Id: "api_1", WorkspaceId: "ws_1", AuthType: entities.AuthTypeKey, KeyAuthId: keyAuthId}, nil
+}
+
+func (db *pagingDatabase) GetWorkspace(ctx context.Context, workspaceId string) (entities.Workspace, error) {
+	return entities.Workspace{Id: workspaceId, HideKeyStart: db.hideKeyStart}, nil
+}
+
+func (db *pagingDatabase) GetApi(ctx context.Context, apiId string) (entities.Api, error) {
+	return entities.Api{Id: apiId, WorkspaceId: "ws_1", AuthType: entities.AuthTypeKey, KeyAuthId: "key_auth_1"}, nil
+}
+
+func (db *pagingDatabase) GetKeyAuth(ctx context.Context, keyAuthId string) (entities.KeyAuth, error) {
+	return entities.KeyAuth{Id: keyAuthId, WorkspaceId: "ws_1"}, nil
+}
+
+func (db *pagingDatabase) ListKeysByKeyAuthId(ctx context.Context, keyAuthId string, limit int, offset int, ownerId string) ([]entities.Key, int, error) {
+	matching := []entities.Key{}
+	for _, k := range db.keys {
+		if ownerId == "" || k.OwnerId == ownerId {
+			matching = append(matching, k)
+		}
+	}
+	if offset > len(matching) {
+		offset = len(matching)
+	}
+	end := offset + limit
+	if end > len(matching) {
+		end = len(matching)
+	}
+	return matching[offset:end], len(matching), nil
+}
+
+func TestListKeys_Pagination(t *testing.T) {
+	db := &pagingDatabase{}
+	for i := 0; i < 5; i++ {
+		db.keys = append(db.keys, entities.Key{Id: fmt.Sprintf("key_%d", i), OwnerId: fmt.Sprintf("owner_%d", i%2)})
+	}
+
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: db,
+		Tracer:   tracing.NewNoop(),
+	})
+
+	testCases := []struct {
+		query  string
+		ids    []string
+		total  int
+		limit  int
+		offset int
+	}{
+		{query: "", ids: []string{"key_0", "key_1", "key_2", "key_3", "key_4"}, total: 5, limit: 100, offset: 0},
+		{query: "?limit=2&offset=2", ids: []string{"key_2", "key_3"}, total: 5, limit: 2, offset: 2},
+		{query: "?limit=2&offset=10", ids: []string{}, total: 5, limit: 2, offset: 10},
+		{query: "?limit=2&ownerId=owner_0", ids: []string{"key_0", "key_2"}, total: 3, limit: 2, offset: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/apis/api_1/keys"+tc.query, nil)
+			req.Header.Set("Authorization", "Bearer root_key")
+
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, 200, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+
+			listRes := ListKeysResponse{}
+			require.NoError(t, json.Unmarshal(body, &listRes))
+
+			ids := []string{}
+			for _, k := range listRes.Keys {
+				ids = append(ids, k.Id)
+			}
+			require.Equal(t, tc.ids, ids)
+			require.Equal(t, tc.total, listRes.Total)
+			require.Equal(t, tc.limit, listRes.Limit)
+			require.Equal(t, tc.offset, listRes.Offset)
+		})
+	}
+}
+
+func TestListKeys_HideKeyStart(t *testing.T) {
+	for _, hide := range []bool{false, true} {
+		t.Run(fmt.Sprintf("hide=%t", hide), func(t *testing.T) {
+			db := &pagingDatabase{
+				keys:         []entities.Key{{Id: "key_1", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Start: "test_abc"}},
+				hideKeyStart: hide,
+			}
+			srv := New(Config{
+				Logger:   logging.NewNoopLogger(),
+				KeyCache: cache.NewNoopCache[entities.Key](),
+				ApiCache: cache.NewNoopCache[entities.Api](),
+				Database: db,
+				Tracer:   tracing.NewNoop(),
+			})
+
+			for _, path := range []string{"/v1/apis/api_1/keys", "/v1/keys/key_1"} {
+				req := httptest.NewRequest("GET", path, nil)
+				req.Header.Set("Authorization", "Bearer root_key")
+
+				res, err := srv.app.Test(req)
+				require.NoError(t, err)
+				defer res.Body.Close()
+				require.Equal(t, 200, res.StatusCode, path)
+
+				body, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+
+				// the field must be missing entirely, not just empty
+				if hide {
+					require.NotContains(t, string(body), `"start"`, path)
+				} else {
+					require.Contains(t, string(body), `"start":"test_abc"`, path)
+				}
+			}
+		})
+	}
+}
+
+func TestListKeys_OmittedKeyStart(t *testing.T) {
+	keyring, err := encryption.NewKeyring(map[int][]byte{1: bytes.Repeat([]byte{1}, encryption.KeySize)}, 1)
+	require.NoError(t, err)
+	secret, start, err := keys.NewV1Key("test", 16)
+	require.NoError(t, err)
+	encrypted, err := keyring.Encrypt("ws_1", secret)
+	require.NoError(t, err)
+
+	for _, hide := range []bool{false, true} {
+		t.Run(fmt.Sprintf("hide=%t", hide), func(t *testing.T) {
+			db := &pagingDatabase{
+				keys: []entities.Key{
+					// stored without a start, the start is derived from the secret
+					{Id: "key_recoverable", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Encrypted: encrypted},
+					// stored without a start, nothing to derive it from
+					{Id: "key_plain", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1"},
+					{Id: "key_stored", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Start: "test_abc"},
+				},
+				hideKeyStart: hide,
+			}
+			srv := New(Config{
+				Logger:   logging.NewNoopLogger(),
+				KeyCache: cache.NewNoopCache[entities.Key](),
+				ApiCache: cache.NewNoopCache[entities.Api](),
+				Database: db,
+				Tracer:   tracing.NewNoop(),
+				Keyring:  keyring,
+			})
+			want := map[string]string{"key_recoverable": start, "key_plain": "", "key_stored": "test_abc"}
+			if hide {
+				want = map[string]string{"key_recoverable": "", "key_plain": "", "key_stored": ""}
+			}
+
+			get := func(path string, v any) {
+				req := httptest.NewRequest("GET", path, nil)
+				req.Header.Set("Authorization", "Bearer root_key")
+
+				res, err := srv.app.Test(req)
+				require.NoError(t, err)
+				defer res.Body.Close()
+				require.Equal(t, 200, res.StatusCode, path)
+
+				body, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+				require.NoError(t, json.Unmarshal(body, v))
+			}
+
+			listRes := ListKeysResponse{}
+			get("/v1/apis/api_1/keys", &listRes)
+			require.Len(t, listRes.Keys, 3)
+			for _, k := range listRes.Keys {
+				require.Equal(t, want[k.Id], k.Start, k.Id)
+			}
+
+			for keyId, wantStart := range want {
+				getRes := GetKeyResponse{}
+				get("/v1/keys/"+keyId, &getRes)
+				require.Equal(t, wantStart, getRes.Start, keyId)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"go.uber.org/zap"
+)
+
+// DefaultRecomputeStartBatchSize is how many keys are loaded at once, unless the request sets it
+const DefaultRecomputeStartBatchSize = 1000
+
+type RecomputeKeyStartsRequest struct {
+	BatchSize int `json:"batchSize" validate:"omitempty,min=1,max=10000"`
+}
+
+type RecomputeKeyStartsResponse struct {
+	Updated int `json:"updated"`
+	// Keys that are not recoverable, whose secret has an unknown format, or whose start was already current
+	Skipped int `json:"skipped"`
+}
+
+// recomputeKeyStarts backfills the start of existing keys after KEY_START_CHARS changed.
+// Only our own operators may call this. The start of a key can't be derived from its hash,
+// so only recoverable keys are updated, all others keep their start.
+//
+// Instances keep serving the old start from their cache until it expires.
+func (s *Server) recomputeKeyStarts(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.recomputeKeyStarts")
+	defer span.End()
+
+	err := s.authenticateApp(c)
+	if err != nil {
+		return err
+	}
+
+	req := RecomputeKeyStartsRequest{}
+	if len(c.Body()) > 0 {
+		err = c.BodyParser(&req)
+		if err != nil {
+			return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+		}
+	}
+
+	err = s.validator.Struct(req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to validate body: %s", err.Error()))
+	}
+	if req.BatchSize == 0 {
+		req.BatchSize = DefaultRecomputeStartBatchSize
+	}
+
+	updated, skipped, err := s.db.RecomputeKeyStarts(ctx, req.BatchSize)
+	if err != nil {
+		s.logger.Error("unable to recompute key starts", zap.Int("updated", updated), zap.Int("skipped", skipped), zap.Error(err))
+		return errs.NewInternal(err, "unable to recompute key starts")
+	}
+	s.logger.Info("recomputed key starts", zap.Int("updated", updated), zap.Int("skipped", skipped))
+
+	return c.JSON(RecomputeKeyStartsResponse{
+		Updated: updated,
+		Skipped: skipped,
+	})
+}
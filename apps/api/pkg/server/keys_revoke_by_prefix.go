@@ -0,0 +1,103 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type RevokeKeysByPrefixRequest struct {
+	ApiId  string `json:"apiId" validate:"required"`
+	Prefix string `json:"prefix" validate:"required"`
+	// DryRun only counts the matching keys without deleting them
+	DryRun bool `json:"dryRun"`
+}
+
+type RevokeKeysByPrefixResponse struct {
+	Matched int  `json:"matched"`
+	Deleted int  `json:"deleted"`
+	DryRun  bool `json:"dryRun"`
+}
+
+// revokeKeysByPrefix deletes all keys of an api that were created with a prefix,
+// for example after the keys of an integration have leaked.
+func (s *Server) revokeKeysByPrefix(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.revokeKeysByPrefix")
+	defer span.End()
+
+	req := RevokeKeysByPrefixRequest{}
+	err := c.BodyParser(&req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+	}
+
+	err = s.validator.Struct(req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to validate body: %s", err.Error()))
+	}
+
+	authKey, err := s.authenticateRootKey(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	err = requireScope(authKey, entities.ScopeKeysDelete)
+	if err != nil {
+		return err
+	}
+
+	api, err := s.db.GetApi(ctx, req.ApiId)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return errs.NewNotFound(fmt.Sprintf("unable to find api: %s", req.ApiId))
+		}
+		return errs.NewInternal(err, "unable to find api")
+	}
+	if api.WorkspaceId != authKey.ForWorkspaceId {
+		return errs.NewUnauthorized("access to workspace denied")
+	}
+	if api.AuthType != entities.AuthTypeKey || api.KeyAuthId == "" {
+		return errs.NewBadRequest("api is not set up to handle key auth")
+	}
+	span.SetAttributes(attribute.String("apiId", api.Id), attribute.String("prefix", req.Prefix), attribute.Bool("dryRun", req.DryRun))
+
+	// We need the hashes to evict the keys from the caches of other nodes after deleting them
+	keys, err := s.db.ListKeysByPrefix(ctx, api.KeyAuthId, req.Prefix)
+	if err != nil {
+		return errs.NewInternal(err, "unable to list keys")
+	}
+
+	res := RevokeKeysByPrefixResponse{
+		Matched: len(keys),
+		DryRun:  req.DryRun,
+	}
+	if req.DryRun {
+		return c.JSON(res)
+	}
+
+	res.Deleted, err = s.db.DeleteKeysByPrefix(ctx, api.KeyAuthId, req.Prefix)
+	if err != nil {
+		return errs.NewInternal(err, "unable to delete keys")
+	}
+
+	for _, key := range keys {
+		s.keyCache.Remove(ctx, key.Hash)
+		s.emitKeyEvent(ctx, kafka.KeyDeleted, key)
+		s.appendAuditLog(ctx, c, audit.Entry{
+			WorkspaceId: key.WorkspaceId,
+			ActorKeyId:  authKey.Id,
+			Action:      audit.KeyDeleted,
+			TargetKeyId: key.Id,
+			Reason:      fmt.Sprintf("revoked by prefix %s", req.Prefix),
+		})
+	}
+
+	return c.JSON(res)
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+func revokeByPrefix(t *testing.T, srv *Server, body string) (int, RevokeKeysByPrefixResponse) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/v1/keys.revokeByPrefix", bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer root_key")
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	buf, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	revokeRes := RevokeKeysByPrefixResponse{}
+	if res.StatusCode == 200 {
+		require.NoError(t, json.Unmarshal(buf, &revokeRes))
+	}
+	return res.StatusCode, revokeRes
+}
+
+func TestRevokeKeysByPrefix(t *testing.T) {
+	db := newMemoryDatabase()
+	db.addKey("leaked_abcd1", entities.Key{Id: "key_1", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Start: "leaked_abcd"})
+	db.addKey("leaked_efgh2", entities.Key{Id: "key_2", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Start: "leaked_efgh"})
+	// created with another prefix
+	db.addKey("leak_ijkl3", entities.Key{Id: "key_3", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Start: "leak_ijkl"})
+	srv := newTestServer(t, withDatabase(db))
+
+	status, res := revokeByPrefix(t, srv, `{"apiId":"api_1","prefix":"leaked","dryRun":true}`)
+	require.Equal(t, 200, status)
+	require.Equal(t, RevokeKeysByPrefixResponse{Matched: 2, Deleted: 0, DryRun: true}, res)
+	require.Len(t, db.keys, 4)
+
+	status, res = revokeByPrefix(t, srv, `{"apiId":"api_1","prefix":"leaked"}`)
+	require.Equal(t, 200, status)
+	require.Equal(t, RevokeKeysByPrefixResponse{Matched: 2, Deleted: 2}, res)
+	_, found := db.key("key_3")
+	require.True(t, found)
+	require.Len(t, db.keys, 2)
+
+	srv.background.Wait()
+	targets := []string{}
+	for _, entry := range db.auditLogs {
+		require.Equal(t, audit.KeyDeleted, entry.Action)
+		targets = append(targets, entry.TargetKeyId)
+	}
+	require.ElementsMatch(t, []string{"key_1", "key_2"}, targets)
+}
+
+func TestRevokeKeysByPrefix_OtherWorkspace(t *testing.T) {
+	db := newMemoryDatabase()
+	db.addWorkspace(entities.Workspace{Id: "ws_2"})
+	db.addApi(entities.Api{Id: "api_2", WorkspaceId: "ws_2", AuthType: entities.AuthTypeKey, KeyAuthId: "key_auth_2"})
+	db.addKey("leaked_abcd1", entities.Key{Id: "key_1", KeyAuthId: "key_auth_2", WorkspaceId: "ws_2", Start: "leaked_abcd"})
+	srv := newTestServer(t, withDatabase(db))
+
+	status, _ := revokeByPrefix(t, srv, `{"apiId":"api_2","prefix":"leaked"}`)
+	require.Equal(t, 401, status)
+	_, found := db.key("key_1")
+	require.True(t, found)
+}
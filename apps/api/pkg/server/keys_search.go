@@ -0,0 +1,87 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxSearchResults caps how many keys a single search returns
+const maxSearchResults = 50
+
+type SearchKeysRequest struct {
+	ApiId string `validate:"required"`
+	// Query is matched against the start of keys by prefix and their name by substring
+	Query string `validate:"required,max=256"`
+	Limit int    `validate:"min=1,max=50"`
+}
+
+type SearchKeysResponse struct {
+	Keys []keyResponse `json:"keys"`
+}
+
+// searchKeys finds the keys of an api by their visible start or their name.
+func (s *Server) searchKeys(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.searchKeys")
+	defer span.End()
+
+	req := SearchKeysRequest{
+		ApiId: c.Query("apiId"),
+		Query: c.Query("q"),
+		Limit: c.QueryInt("limit", maxSearchResults),
+	}
+
+	err := s.validator.Struct(req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to validate request: %s", err.Error()))
+	}
+
+	authKey, err := s.authenticateRootKey(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	err = requireScope(authKey, entities.ScopeKeysRead)
+	if err != nil {
+		return err
+	}
+
+	api, err := s.db.GetApi(ctx, req.ApiId)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return errs.NewNotFound(fmt.Sprintf("unable to find api: %s", req.ApiId))
+		}
+		return errs.NewInternal(err, "unable to find api")
+	}
+	if api.WorkspaceId != authKey.ForWorkspaceId {
+		return errs.NewUnauthorized("access to workspace denied")
+	}
+	if api.KeyAuthId == "" {
+		return errs.NewBadRequest("api is not set up to handle key auth")
+	}
+	span.SetAttributes(attribute.String("apiId", api.Id), attribute.Int("limit", req.Limit))
+
+	workspace, err := s.cachedWorkspace(ctx, api.WorkspaceId)
+	if err != nil {
+		return errs.NewInternal(err, "unable to find workspace")
+	}
+
+	keys, err := s.db.SearchKeys(ctx, api.KeyAuthId, req.Query, req.Limit)
+	if err != nil {
+		return errs.NewInternal(err, "unable to search keys")
+	}
+
+	res := SearchKeysResponse{
+		Keys: make([]keyResponse, len(keys)),
+	}
+	for i, k := range keys {
+		res.Keys[i] = newKeyResponse(api.Id, k, s.keyStart(workspace, k))
+	}
+
+	return c.JSON(res)
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+func TestSearchKeys(t *testing.T) {
+	db := newMemoryDatabase()
+	db.addWorkspace(entities.Workspace{Id: "ws_2"})
+	db.addApi(entities.Api{Id: "api_other", WorkspaceId: "ws_2", AuthType: entities.AuthTypeKey, KeyAuthId: "key_auth_2"})
+	db.addKey("", entities.Key{Id: "key_1", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Start: "sk_abcd", Name: "production", Hash: "secret_hash"})
+	db.addKey("staging_key", entities.Key{Id: "key_2", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Start: "sk_efgh", Name: "staging"})
+	db.addKey("other_key", entities.Key{Id: "key_3", KeyAuthId: "key_auth_2", WorkspaceId: "ws_2", Start: "sk_ijkl", Name: "other workspace"})
+	srv := newTestServer(t, withDatabase(db))
+
+	search := func(query string) (int, SearchKeysResponse) {
+		req := httptest.NewRequest("GET", "/v1/keys.search?"+query, nil)
+		req.Header.Set("Authorization", "Bearer root_key")
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		searchRes := SearchKeysResponse{}
+		if res.StatusCode == 200 {
+			require.NoError(t, json.Unmarshal(body, &searchRes))
+			require.NotContains(t, string(body), "secret_hash")
+		}
+		return res.StatusCode, searchRes
+	}
+
+	status, res := search("apiId=api_1&q=sk_")
+	require.Equal(t, 200, status)
+	require.Len(t, res.Keys, 2)
+
+	status, res = search("apiId=api_1&q=" + url.QueryEscape("stag"))
+	require.Equal(t, 200, status)
+	require.Len(t, res.Keys, 1)
+	require.Equal(t, "staging", res.Keys[0].Name)
+
+	status, res = search("apiId=api_1&q=sk_&limit=1")
+	require.Equal(t, 200, status)
+	require.Len(t, res.Keys, 1)
+
+	status, _ = search("apiId=api_1")
+	require.Equal(t, 400, status)
+	status, _ = search("apiId=api_1&q=sk_&limit=1000")
+	require.Equal(t, 400, status)
+	status, _ = search("apiId=api_other&q=sk_")
+	require.Equal(t, 401, status)
+
+	// without a limit at most maxSearchResults keys are returned
+	for i := 0; i < maxSearchResults; i++ {
+		id := fmt.Sprintf("key_more_%d", i)
+		db.addKey(id, entities.Key{Id: id, KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Start: "sk_more"})
+	}
+	status, res = search("apiId=api_1&q=sk_")
+	require.Equal(t, 200, status)
+	require.Len(t, res.Keys, maxSearchResults)
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type SetKeysEnabledRequest struct {
+	KeyIds  []string `json:"keyIds" validate:"required,min=1,max=100,dive,required"`
+	Enabled *bool    `json:"enabled" validate:"required"`
+}
+
+type SetKeysEnabledResponse struct {
+	// Changed is the number of keys that were not already in the requested state
+	Changed int `json:"changed"`
+}
+
+// setKeysEnabled suspends or re-enables many keys at once, for example during an incident.
+// Nothing is changed unless every key belongs to the workspace of the root key.
+func (s *Server) setKeysEnabled(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.setKeysEnabled")
+	defer span.End()
+
+	req := SetKeysEnabledRequest{}
+	err := c.BodyParser(&req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+	}
+
+	err = s.validator.Struct(req)
+	if err != nil {
+		return validationError(err)
+	}
+
+	authKey, err := s.authenticateRootKey(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	err = requireScope(authKey, entities.ScopeKeysUpdate)
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.Int("keys", len(req.KeyIds)), attribute.Bool("enabled", *req.Enabled))
+
+	seen := map[string]bool{}
+	keys := []entities.Key{}
+	for _, keyId := range req.KeyIds {
+		if seen[keyId] {
+			continue
+		}
+		seen[keyId] = true
+
+		key, err := s.db.GetKeyById(ctx, keyId)
+		if err != nil {
+			if errors.Is(err, database.ErrNotFound) {
+				return errs.NewNotFound(fmt.Sprintf("unable to find key: %s", keyId))
+			}
+			return errs.NewInternal(err, "unable to find key")
+		}
+		if key.WorkspaceId != authKey.ForWorkspaceId {
+			return errs.NewUnauthorized("access to workspace denied")
+		}
+		keys = append(keys, key)
+	}
+
+	keyIds := make([]string, len(keys))
+	for i, key := range keys {
+		keyIds[i] = key.Id
+	}
+	changed, err := s.db.SetKeysEnabled(ctx, keyIds, *req.Enabled)
+	if err != nil {
+		return errs.NewInternal(err, "unable to update keys")
+	}
+	span.SetAttributes(attribute.Int("changed", changed))
+
+	reason := "key disabled"
+	if *req.Enabled {
+		reason = "key enabled"
+	}
+	for _, key := range keys {
+		s.keyCache.Remove(ctx, key.Hash)
+		// keys that were already in the requested state are not affected
+		if key.SuspendedAt.IsZero() == *req.Enabled {
+			continue
+		}
+		s.emitKeyEvent(ctx, kafka.KeyUpdated, key)
+		s.appendAuditLog(ctx, c, audit.Entry{
+			WorkspaceId: key.WorkspaceId,
+			ActorKeyId:  authKey.Id,
+			Action:      audit.KeyUpdated,
+			TargetKeyId: key.Id,
+			Reason:      reason,
+		})
+	}
+
+	return c.JSON(SetKeysEnabledResponse{
+		Changed: changed,
+	})
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
+)
+
+// recordingEventBus remembers the keys it produced events for
+type recordingEventBus struct {
+	sync.Mutex
+	events map[kafka.KeyEventType][]string
+}
+
+func (b *recordingEventBus) ProduceKeyEvent(ctx context.Context, eventType kafka.KeyEventType, keyId, keyHash string) error {
+	b.Lock()
+	defer b.Unlock()
+	b.events[eventType] = append(b.events[eventType], keyId)
+	return nil
+}
+
+func (b *recordingEventBus) Ping(ctx context.Context) error { return nil }
+
+func (b *recordingEventBus) Close() error { return nil }
+
+// newBulkEnabledServer holds the enabled keys key_1 and key_2, the disabled key_3 and key_other of another workspace
+func newBulkEnabledServer(t *testing.T) (*Server, *memoryDatabase, *recordingEventBus) {
+	t.Helper()
+	db := newMemoryDatabase()
+	db.addKey("key_1", entities.Key{Id: "key_1", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1"})
+	db.addKey("key_2", entities.Key{Id: "key_2", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1"})
+	db.addKey("key_3", entities.Key{Id: "key_3", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", SuspendedAt: time.Now()})
+	db.addKey("key_other", entities.Key{Id: "key_other", KeyAuthId: "key_auth_2", WorkspaceId: "ws_2"})
+	bus := &recordingEventBus{events: map[kafka.KeyEventType][]string{}}
+	srv := newTestServer(t, withDatabase(db), func(c *Config) {
+		c.Kafka = bus
+	})
+	return srv, db, bus
+}
+
+func setKeysEnabled(t *testing.T, srv *Server, body string) (int, SetKeysEnabledResponse) {
+	req := httptest.NewRequest("POST", "/v1/keys.setEnabledBulk", bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer root_key")
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	setRes := SetKeysEnabledResponse{}
+	if res.StatusCode == 200 {
+		buf, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(buf, &setRes))
+	}
+	return res.StatusCode, setRes
+}
+
+func TestSetKeysEnabled(t *testing.T) {
+	srv, db, bus := newBulkEnabledServer(t)
+
+	// key_3 is already disabled, key_1 is listed twice
+	status, res := setKeysEnabled(t, srv, `{"keyIds":["key_1","key_2","key_3","key_1"],"enabled":false}`)
+	require.Equal(t, 200, status)
+	require.Equal(t, 2, res.Changed)
+	require.Equal(t, 1, db.callsOf("SetKeysEnabled"))
+	for _, keyId := range []string{"key_1", "key_2", "key_3"} {
+		require.False(t, db.keys[keyId].SuspendedAt.IsZero(), keyId)
+	}
+
+	srv.background.Wait()
+	updated := bus.events[kafka.KeyUpdated]
+	sort.Strings(updated)
+	require.Equal(t, []string{"key_1", "key_2"}, updated)
+
+	status, res = setKeysEnabled(t, srv, `{"keyIds":["key_1","key_3"],"enabled":true}`)
+	require.Equal(t, 200, status)
+	require.Equal(t, 2, res.Changed)
+	require.True(t, db.keys["key_1"].SuspendedAt.IsZero())
+	require.False(t, db.keys["key_2"].SuspendedAt.IsZero())
+}
+
+func TestSetKeysEnabled_Rejects(t *testing.T) {
+	testCases := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "missing enabled", body: `{"keyIds":["key_1"]}`, status: 400},
+		{name: "no keys", body: `{"keyIds":[],"enabled":false}`, status: 400},
+		{name: "empty key id", body: `{"keyIds":["key_1",""],"enabled":false}`, status: 400},
+		{name: "unknown key", body: `{"keyIds":["key_1","key_unknown"],"enabled":false}`, status: 404},
+		{name: "key of another workspace", body: `{"keyIds":["key_1","key_other"],"enabled":false}`, status: 401},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, db, bus := newBulkEnabledServer(t)
+
+			status, _ := setKeysEnabled(t, srv, tc.body)
+			require.Equal(t, tc.status, status)
+
+			// nothing is changed unless every key may be changed
+			srv.background.Wait()
+			require.Zero(t, db.callsOf("SetKeysEnabled"))
+			require.True(t, db.keys["key_1"].SuspendedAt.IsZero())
+			require.Len(t, bus.events, 0)
+		})
+	}
+}
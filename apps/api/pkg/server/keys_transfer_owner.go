@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
+)
+
+type TransferKeysOwnerRequest struct {
+	FromOwnerId string `json:"fromOwnerId" validate:"required"`
+	ToOwnerId   string `json:"toOwnerId" validate:"required"`
+}
+
+type TransferKeysOwnerResponse struct {
+	Transferred int `json:"transferred"`
+}
+
+func (s *Server) transferKeysOwner(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.transferKeysOwner")
+	defer span.End()
+
+	req := TransferKeysOwnerRequest{}
+	err := c.BodyParser(&req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+	}
+
+	err = s.validator.Struct(req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to validate body: %s", err.Error()))
+	}
+
+	if req.FromOwnerId == req.ToOwnerId {
+		return errs.NewBadRequest("'fromOwnerId' and 'toOwnerId' must be different")
+	}
+	err = s.validateOwnerId("toOwnerId", req.ToOwnerId)
+	if err != nil {
+		return err
+	}
+
+	authKey, err := s.authenticateRootKey(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	err = requireScope(authKey, entities.ScopeKeysUpdate)
+	if err != nil {
+		return err
+	}
+
+	// the keys are returned as they are after the transfer, with the hashes to evict them by
+	keys, err := s.db.TransferKeysOwner(ctx, authKey.ForWorkspaceId, req.FromOwnerId, req.ToOwnerId)
+	if err != nil {
+		return errs.NewInternal(err, "unable to transfer keys")
+	}
+
+	for _, key := range keys {
+		s.keyCache.Remove(ctx, key.Hash)
+		s.emitKeyEvent(ctx, kafka.KeyUpdated, key)
+		// rerolled keys are also cached under the secret that is still in its grace period
+		if key.PreviousHash != "" {
+			s.keyCache.Remove(ctx, key.PreviousHash)
+			s.produceKeyEvent(ctx, kafka.KeyUpdated, key.Id, key.PreviousHash)
+		}
+		s.appendAuditLog(ctx, c, audit.Entry{
+			WorkspaceId: key.WorkspaceId,
+			ActorKeyId:  authKey.Id,
+			Action:      audit.KeyUpdated,
+			TargetKeyId: key.Id,
+			Reason:      "owner transferred",
+		})
+	}
+
+	return c.JSON(TransferKeysOwnerResponse{
+		Transferred: len(keys),
+	})
+}
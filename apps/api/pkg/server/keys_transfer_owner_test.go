@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/testutil"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+func TestTransferKeysOwner(t *testing.T) {
+	ctx := context.Background()
+
+	resources := testutil.SetupResources(t)
+
+	db, err := database.New(database.Config{
+		Logger:    logging.NewNoopLogger(),
+		PrimaryUs: os.Getenv("DATABASE_DSN"),
+	})
+	require.NoError(t, err)
+
+	srv := newTestServer(t, withDatabase(db))
+
+	fromOwnerId := uid.New("user")
+	toOwnerId := uid.New("user")
+	otherOwnerId := uid.New("user")
+
+	keyIds := []string{}
+	for _, ownerId := range []string{fromOwnerId, fromOwnerId, otherOwnerId} {
+		key := entities.Key{
+			Id:          uid.Key(),
+			KeyAuthId:   resources.UserKeyAuth.Id,
+			WorkspaceId: resources.UserWorkspace.Id,
+			Hash:        hash.Sha256(uid.New("test")),
+			OwnerId:     ownerId,
+			CreatedAt:   time.Now(),
+		}
+		require.NoError(t, db.CreateKey(ctx, key))
+		keyIds = append(keyIds, key.Id)
+	}
+
+	buf := bytes.NewBufferString(fmt.Sprintf(`{
+		"fromOwnerId":"%s",
+		"toOwnerId":"%s"
+		}`, fromOwnerId, toOwnerId))
+
+	req := httptest.NewRequest("POST", "/v1/keys.transferOwner", buf)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", resources.UnkeyKey))
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, 200, res.StatusCode)
+
+	transferResponse := TransferKeysOwnerResponse{}
+	err = json.Unmarshal(body, &transferResponse)
+	require.NoError(t, err)
+	require.Equal(t, 2, transferResponse.Transferred)
+
+	for i, expectedOwnerId := range []string{toOwnerId, toOwnerId, otherOwnerId} {
+		found, err := db.GetKeyById(ctx, keyIds[i])
+		require.NoError(t, err)
+		require.Equal(t, expectedOwnerId, found.OwnerId)
+	}
+}
+
+func TestTransferKeysOwner_EvictsAndEmitsMovedKeys(t *testing.T) {
+	db := newMemoryDatabase()
+	moved := db.addKey("secret_1", entities.Key{Id: "key_1", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", OwnerId: "user_from"})
+	rerolled := db.addKey("secret_2", entities.Key{Id: "key_2", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", OwnerId: "user_from", PreviousHash: hash.Sha256("secret_2_old"), PreviousHashExpires: time.Now().Add(time.Hour)})
+	other := db.addKey("secret_3", entities.Key{Id: "key_3", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", OwnerId: "user_other"})
+
+	keyCache := &mapCache[entities.Key]{data: map[string]entities.Key{}}
+	for _, key := range []entities.Key{moved, rerolled, other} {
+		keyCache.Set(context.Background(), key.Hash, key)
+	}
+	keyCache.Set(context.Background(), rerolled.PreviousHash, rerolled)
+	bus := &recordingEventBus{events: map[kafka.KeyEventType][]string{}}
+	dispatcher := &recordingDispatcher{}
+	srv := newTestServer(t, withDatabase(db), func(c *Config) {
+		c.KeyCache = keyCache
+		c.Kafka = bus
+		c.Webhooks = dispatcher
+	})
+
+	req := httptest.NewRequest("POST", "/v1/keys.transferOwner", bytes.NewBufferString(`{"fromOwnerId":"user_from","toOwnerId":"user_to"}`))
+	req.Header.Set("Authorization", "Bearer root_key")
+	req.Header.Set("Content-Type", "application/json")
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 200, res.StatusCode)
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	transferResponse := TransferKeysOwnerResponse{}
+	require.NoError(t, json.Unmarshal(body, &transferResponse))
+	require.Equal(t, 2, transferResponse.Transferred)
+	require.Zero(t, db.callsOf("ListKeysByOwnerId"))
+
+	// every hash of the moved keys is evicted, the other key stays cached
+	for _, h := range []string{moved.Hash, rerolled.Hash, rerolled.PreviousHash} {
+		_, cached := keyCache.Get(context.Background(), h)
+		require.False(t, cached, h)
+	}
+	_, cached := keyCache.Get(context.Background(), other.Hash)
+	require.True(t, cached)
+
+	srv.background.Wait()
+	updated := bus.events[kafka.KeyUpdated]
+	sort.Strings(updated)
+	require.Equal(t, []string{"key_1", "key_2", "key_2"}, updated)
+	require.Len(t, dispatcher.events, 2)
+	for _, e := range dispatcher.events {
+		require.Equal(t, "user_to", e.Key.OwnerId)
+	}
+	require.Len(t, db.auditLogs, 2)
+}
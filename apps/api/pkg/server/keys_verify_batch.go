@@ -0,0 +1,77 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type VerifyKeysBatchRequest struct {
+	Keys []string `json:"keys" validate:"required,min=1,max=100,dive,required"`
+	// Response selects the shape of every result, see VerifyKeyRequest.Response
+	Response string `json:"response,omitempty" validate:"omitempty,oneof=full minimal"`
+}
+
+type VerifyKeysBatchResponse struct {
+	// Results are in the order of the requested keys, each key is verified on its own
+	Results []VerifyKeyResponse `json:"results"`
+}
+
+// verifyKeysBatch verifies many keys with one request, for example in a gateway.
+// It does not fail as a whole if some keys are invalid: every key gets its own result, with Valid set
+// to false and a Code explaining why. Keys that are not cached are loaded with a single query.
+func (s *Server) verifyKeysBatch(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.verifyKeysBatch")
+	defer span.End()
+
+	req := VerifyKeysBatchRequest{}
+	err := c.BodyParser(&req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+	}
+
+	err = s.validator.Struct(req)
+	if err != nil {
+		return validationError(err)
+	}
+	span.SetAttributes(attribute.Int("keys", len(req.Keys)))
+
+	missing := []string{}
+	seen := map[string]bool{}
+	for _, key := range req.Keys {
+		hashes, err := s.getKeyHashes(key)
+		if err != nil || seen[hashes[0]] {
+			continue
+		}
+		seen[hashes[0]] = true
+		if _, _, isCached := s.cachedKeyByHashes(ctx, hashes); !isCached {
+			// every hash of the secret in the same query, whichever it is stored under
+			missing = append(missing, hashes...)
+		}
+	}
+	prefetched, err := s.db.GetKeysByHashes(ctx, missing)
+	if err != nil {
+		return errs.NewInternal(err, "unable to load keys")
+	}
+
+	from := httpCaller(c)
+	res := VerifyKeysBatchResponse{Results: make([]VerifyKeyResponse, len(req.Keys))}
+	for i, key := range req.Keys {
+		keyCtx, keySpan := s.tracer.Start(ctx, "server.verifyKeysBatch.key")
+		result, err := s.verifyPrefetched(keyCtx, VerifyKeyRequest{Key: key, Response: req.Response}, from, prefetched)
+		keySpan.End()
+		if err != nil {
+			// the key is invalid, the other keys are still verified
+			e, ok := errs.As(err)
+			if !ok {
+				return err
+			}
+			result = VerifyKeyResponse{Valid: false, Code: string(e.Code)}
+		}
+		res.Results[i] = result
+	}
+
+	return c.JSON(res)
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
+	"github.com/unkeyed/unkey/apps/api/pkg/cache"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/tracing"
+)
+
+// batchDatabase only serves keys through GetKeysByHashes, loading a single key panics
+type batchDatabase struct {
+	database.Database
+	keys    map[string]entities.Key
+	batches int
+}
+
+func (db *batchDatabase) GetKeysByHashes(ctx context.Context, hashes []string) (map[string]entities.Key, error) {
+	db.batches++
+	found := map[string]entities.Key{}
+	for _, h := range hashes {
+		if key, ok := db.keys[h]; ok {
+			found[h] = key
+		}
+	}
+	return found, nil
+}
+
+func (db *batchDatabase) VerifyAndConsume(ctx context.Context, hash string, cost int64) (entities.Key, int64, bool, error) {
+	key := db.keys[hash]
+	if key.Remaining.Remaining < cost {
+		return key, key.Remaining.Remaining, false, nil
+	}
+	key.Remaining.Remaining -= cost
+	db.keys[hash] = key
+	return key, key.Remaining.Remaining, true, nil
+}
+
+func (db *batchDatabase) GetKeyAuth(ctx context.Context, keyAuthId string) (entities.KeyAuth, error) {
+	return entities.KeyAuth{Id: keyAuthId, WorkspaceId: "ws_1"}, nil
+}
+
+func (db *batchDatabase) GetApiByKeyAuthId(ctx context.Context, keyAuthId string) (entities.Api, error) {
+	return entities.Api{Id: "api_1", WorkspaceId: "ws_1", KeyAuthId: keyAuthId, AuthType: entities.AuthTypeKey}, nil
+}
+
+func (db *batchDatabase) GetWorkspace(ctx context.Context, workspaceId string) (entities.Workspace, error) {
+	return entities.Workspace{Id: workspaceId}, nil
+}
+
+func (db *batchDatabase) TouchKeyLastUsed(ctx context.Context, keyId string, ts time.Time) error {
+	return nil
+}
+
+func (db *batchDatabase) AppendAuditLog(ctx context.Context, entry audit.Entry) error {
+	return nil
+}
+
+func TestVerifyKeysBatch(t *testing.T) {
+	limited := entities.Key{Id: "key_limited", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Hash: hash.Sha256("limited_key"), OwnerId: "alice"}
+	limited.Remaining.Enabled = true
+	limited.Remaining.Remaining = 1
+	disabled := entities.Key{Id: "key_disabled", KeyAuthId: "key_auth_1", WorkspaceId: "ws_1", Hash: hash.Sha256("disabled_key"), SuspendedAt: time.Now()}
+
+	db := &batchDatabase{keys: map[string]entities.Key{
+		limited.Hash:  limited,
+		disabled.Hash: disabled,
+	}}
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: db,
+		Tracer:   tracing.NewNoop(),
+	})
+
+	body := `{"keys":["limited_key","unknown_key","disabled_key","limited_key"]}`
+	req := httptest.NewRequest("POST", "/v1/keys.verifyBatch", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 200, res.StatusCode)
+
+	resBody, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	batchRes := VerifyKeysBatchResponse{}
+	require.NoError(t, json.Unmarshal(resBody, &batchRes))
+	require.Len(t, batchRes.Results, 4)
+
+	require.True(t, batchRes.Results[0].Valid)
+	require.Equal(t, "alice", batchRes.Results[0].OwnerId)
+	require.Equal(t, int64(0), *batchRes.Results[0].Remaining)
+
+	require.False(t, batchRes.Results[1].Valid)
+	require.Equal(t, string(UNAUTHORIZED), batchRes.Results[1].Code)
+
+	require.False(t, batchRes.Results[2].Valid)
+	require.Equal(t, DISABLED, batchRes.Results[2].Code)
+
+	// the same key again, its only verification was used up by the first one
+	require.False(t, batchRes.Results[3].Valid)
+	require.Equal(t, USAGE_EXCEEDED, batchRes.Results[3].Code)
+
+	require.Equal(t, 1, db.batches)
+}
+
+func TestVerifyKeysBatch_Validation(t *testing.T) {
+	srv := New(Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: &batchDatabase{},
+		Tracer:   tracing.NewNoop(),
+	})
+
+	for _, body := range []string{`{"keys":[]}`, `{"keys":[""]}`, `{}`} {
+		req := httptest.NewRequest("POST", "/v1/keys.verifyBatch", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, 400, res.StatusCode, body)
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"go.uber.org/zap"
+)
+
+// lastUsedResolution is how far the last used time of a key may lag behind, it bounds the writes
+// to one per key and interval on every node.
+const lastUsedResolution = time.Minute
+
+// maxLastUsedEntries is when the throttle starts forgetting keys it has not touched recently
+const maxLastUsedEntries = 10_000
+
+// lastUsedThrottle remembers when this node last wrote the last used time of a key. The cached
+// key may be stale for a lot longer than lastUsedResolution, so its LastUsedAt is not enough.
+type lastUsedThrottle struct {
+	mu      sync.Mutex
+	touched map[string]time.Time
+}
+
+func newLastUsedThrottle() *lastUsedThrottle {
+	return &lastUsedThrottle{touched: map[string]time.Time{}}
+}
+
+// allow reports whether the last used time of the key should be written, and if so remembers it.
+func (t *lastUsedThrottle) allow(key entities.Key, now time.Time) bool {
+	if now.Sub(key.LastUsedAt) < lastUsedResolution {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if last, ok := t.touched[key.Id]; ok && now.Sub(last) < lastUsedResolution {
+		return false
+	}
+	if len(t.touched) >= maxLastUsedEntries {
+		for keyId, last := range t.touched {
+			if now.Sub(last) >= lastUsedResolution {
+				delete(t.touched, keyId)
+			}
+		}
+	}
+	t.touched[key.Id] = now
+	return true
+}
+
+// touchLastUsed records a successful verification of the key in the background.
+func (s *Server) touchLastUsed(key entities.Key) {
+	now := time.Now()
+	if !s.lastUsed.allow(key, now) {
+		return
+	}
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		// the request may be done before the write is
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err := s.db.TouchKeyLastUsed(ctx, key.Id, now)
+		if err != nil {
+			s.logger.Error("unable to touch last used of key", zap.Error(err), zap.String("keyId", key.Id))
+		}
+	}()
+}
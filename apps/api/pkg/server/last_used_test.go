@@ -0,0 +1,70 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+func TestLastUsedThrottle(t *testing.T) {
+	throttle := newLastUsedThrottle()
+	now := time.Now()
+	key := entities.Key{Id: "key_1"}
+
+	require.True(t, throttle.allow(key, now))
+	require.False(t, throttle.allow(key, now.Add(time.Second)))
+	require.False(t, throttle.allow(key, now.Add(lastUsedResolution-time.Millisecond)))
+	require.True(t, throttle.allow(key, now.Add(lastUsedResolution)))
+
+	// other keys are throttled on their own
+	require.True(t, throttle.allow(entities.Key{Id: "key_2"}, now))
+
+	// another node touched the key recently
+	require.False(t, throttle.allow(entities.Key{Id: "key_3", LastUsedAt: now.Add(-time.Second)}, now))
+}
+
+func TestLastUsedThrottle_ForgetsOldKeys(t *testing.T) {
+	throttle := newLastUsedThrottle()
+	now := time.Now()
+	for i := 0; i < maxLastUsedEntries; i++ {
+		throttle.touched[fmt.Sprintf("key_%d", i)] = now.Add(-lastUsedResolution)
+	}
+
+	require.True(t, throttle.allow(entities.Key{Id: "key_1"}, now))
+	require.Len(t, throttle.touched, 1)
+}
+
+func TestVerifyKey_TouchesLastUsed(t *testing.T) {
+	db := newMemoryDatabase()
+	db.addKey("some_key", entities.Key{
+		Id:          "key_1",
+		KeyAuthId:   "key_auth_1",
+		WorkspaceId: "ws_1",
+	})
+	srv := newTestServer(t, withDatabase(db))
+
+	verify := func(body string) {
+		req := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, 200, res.StatusCode)
+	}
+
+	for i := 0; i < 50; i++ {
+		verify(`{"key":"some_key"}`)
+	}
+	// dry runs are not usage
+	verify(`{"key":"some_key","dryRun":true}`)
+	srv.background.Wait()
+
+	require.Equal(t, 1, db.callsOf("TouchKeyLastUsed"))
+	key, _ := db.key("key_1")
+	require.WithinDuration(t, time.Now(), key.LastUsedAt, time.Minute)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+const (
+	// DefaultMaxMetaBytes is the default limit for the json encoded meta of a key
+	DefaultMaxMetaBytes = 64 * 1024
+	// DefaultMaxMetaDepth is the default limit for how deeply objects and arrays may be nested in meta
+	DefaultMaxMetaDepth = 10
+)
+
+// validateMeta ensures the meta fits into our storage limits
+func (s *Server) validateMeta(meta map[string]any) error {
+	if meta == nil {
+		return nil
+	}
+
+	depth := metaDepth(meta)
+	if depth > s.maxMetaDepth {
+		return errs.NewBadRequest(fmt.Sprintf("'meta' must not be nested deeper than %d levels, got %d", s.maxMetaDepth, depth))
+	}
+
+	buf, err := json.Marshal(meta)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to marshal 'meta': %s", err.Error()))
+	}
+	if len(buf) > s.maxMetaBytes {
+		return errs.NewBadRequest(fmt.Sprintf("'meta' must not exceed %d bytes, got %d", s.maxMetaBytes, len(buf)))
+	}
+	return nil
+}
+
+// validateMetaSchema checks the meta of an existing key against the meta schema of its api.
+// The api is always loaded from the database, the cache may not know about a schema that was just set.
+func (s *Server) validateMetaSchema(ctx context.Context, key entities.Key, meta map[string]any) error {
+	api, err := s.db.GetApiByKeyAuthId(ctx, key.KeyAuthId)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			// without an api there is no schema to match
+			return nil
+		}
+		return errs.NewInternal(err, "unable to find api")
+	}
+	return s.service.ValidateMeta(api, meta)
+}
+
+// metaDepth returns how deeply objects and arrays are nested, a flat object has a depth of 1
+func metaDepth(value any) int {
+	max := 0
+	switch v := value.(type) {
+	case map[string]any:
+		for _, child := range v {
+			if d := metaDepth(child); d > max {
+				max = d
+			}
+		}
+		return max + 1
+	case []any:
+		for _, child := range v {
+			if d := metaDepth(child); d > max {
+				max = d
+			}
+		}
+		return max + 1
+	default:
+		return 0
+	}
+}
+
+// isMetaTypeError reports whether the body could not be parsed because meta was not a json object
+func isMetaTypeError(err error) bool {
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(err, &typeErr) && typeErr.Field == "meta"
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+func newMetaTestServer(t *testing.T, maxBytes, maxDepth int) *Server {
+	return newTestServer(t, func(c *Config) {
+		c.MaxMetaBytes = maxBytes
+		c.MaxMetaDepth = maxDepth
+	})
+}
+
+func TestValidateMeta_SizeBoundary(t *testing.T) {
+	srv := newMetaTestServer(t, 100, 0)
+
+	// `{"a":""}` is 8 bytes
+	atLimit := map[string]any{"a": strings.Repeat("x", 92)}
+	buf, err := json.Marshal(atLimit)
+	require.NoError(t, err)
+	require.Len(t, buf, 100)
+	require.NoError(t, srv.validateMeta(atLimit))
+
+	overLimit := map[string]any{"a": strings.Repeat("x", 93)}
+	err = srv.validateMeta(overLimit)
+	require.Error(t, err)
+	e, ok := errs.As(err)
+	require.True(t, ok)
+	require.Equal(t, errs.BAD_REQUEST, e.Code)
+}
+
+func TestValidateMeta_Depth(t *testing.T) {
+	srv := newMetaTestServer(t, 0, 3)
+
+	require.NoError(t, srv.validateMeta(nil))
+	require.NoError(t, srv.validateMeta(map[string]any{"a": map[string]any{"b": []any{1, 2}}}))
+	require.Error(t, srv.validateMeta(map[string]any{"a": map[string]any{"b": []any{map[string]any{}}}}))
+}
+
+func TestMetaDepth(t *testing.T) {
+	require.Equal(t, 0, metaDepth("string"))
+	require.Equal(t, 1, metaDepth(map[string]any{}))
+	require.Equal(t, 1, metaDepth(map[string]any{"a": 1}))
+	require.Equal(t, 2, metaDepth(map[string]any{"a": []any{1}}))
+	require.Equal(t, 3, metaDepth(map[string]any{"a": 1, "b": map[string]any{"c": map[string]any{}}}))
+}
+
+func TestCreateKey_RejectsNonObjectMeta(t *testing.T) {
+	srv := newMetaTestServer(t, 0, 0)
+
+	req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(`{"apiId":"api_123","meta":[1,2,3]}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, 400, res.StatusCode)
+
+	errorResponse := ErrorResponse{}
+	err = json.Unmarshal(body, &errorResponse)
+	require.NoError(t, err)
+	require.Equal(t, "'meta' must be a json object", errorResponse.Error)
+}
+
+func TestCreateKey_RejectsOversizedMeta(t *testing.T) {
+	srv := newMetaTestServer(t, 16, 0)
+
+	req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(`{"apiId":"api_123","meta":{"a":"this is too long"}}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 400, res.StatusCode)
+}
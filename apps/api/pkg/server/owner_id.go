@@ -0,0 +1,33 @@
+package server
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+// DefaultMaxOwnerIdLength is the size of the owner_id column, so by default only ids that could not be stored are rejected
+const DefaultMaxOwnerIdLength = 256
+
+// validateOwnerId rejects owner ids that are too long or do not match the configured pattern.
+// An empty owner id means the key has no owner and is always allowed.
+func (s *Server) validateOwnerId(field string, ownerId string) error {
+	if ownerId == "" {
+		return nil
+	}
+	var message string
+	var constraint string
+	if length := utf8.RuneCountInString(ownerId); length > s.maxOwnerIdLength {
+		message = fmt.Sprintf("'%s' must not be longer than %d characters, got %d", field, s.maxOwnerIdLength, length)
+		constraint = "max"
+	} else if s.ownerIdPattern != nil && !s.ownerIdPattern.MatchString(ownerId) {
+		message = fmt.Sprintf("'%s' must match the pattern %s", field, s.ownerIdPattern.String())
+		constraint = "pattern"
+	} else {
+		return nil
+	}
+	return errs.NewBadRequest(message).WithFieldErrors([]errs.FieldError{
+		{Field: field, Constraint: constraint, Message: message},
+	})
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+)
+
+// DefaultReadYourWritesWindow is how long reads go to the primary after a create. It is well
+// above the usual lag of our read replicas.
+const DefaultReadYourWritesWindow = 5 * time.Second
+
+// consistencyHeader carries the read-your-writes hint. Responses of creates set it, clients
+// send it back on their following requests to read from the primary until it expires.
+//
+// The hint is `<expires unix milli>.<base64 hmac-sha256>`. It is signed, so clients can not keep all
+// of their reads on the primary by making up hints, and it is stateless, so it is accepted by every
+// instance, in every region. There is nothing secret in it, the signature only protects the expiry.
+const consistencyHeader = "Unkey-Consistency-Token"
+
+// consistencyKey signs hints. It is derived from the app auth token, which every instance shares,
+// so no separate secret needs to be configured and the token itself is never used as a key.
+func consistencyKey(appAuthToken string) []byte {
+	mac := hmac.New(sha256.New, []byte(appAuthToken))
+	mac.Write([]byte("read-your-writes"))
+	return mac.Sum(nil)
+}
+
+func (s *Server) signConsistency(expires string) string {
+	mac := hmac.New(sha256.New, s.consistencyKey)
+	mac.Write([]byte(expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// setConsistencyToken tells the client to send its reads to the primary for the window,
+// call it after anything was created. A window of 0 disables it.
+func (s *Server) setConsistencyToken(c *fiber.Ctx) {
+	if s.readYourWritesWindow <= 0 {
+		return
+	}
+	expires := strconv.FormatInt(time.Now().Add(s.readYourWritesWindow).UnixMilli(), 10)
+	c.Set(consistencyHeader, expires+"."+s.signConsistency(expires))
+}
+
+// validConsistencyToken reports whether the token was signed by us and has not expired
+func (s *Server) validConsistencyToken(token string, now time.Time) bool {
+	expires, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.signConsistency(expires))) {
+		return false
+	}
+	expiresMilli, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return false
+	}
+	return now.Before(time.UnixMilli(expiresMilli))
+}
+
+// readYourWrites routes the reads of requests with a valid hint to the primary, so a client
+// finds what it just created even if the read replica has not caught up.
+// Invalid and expired hints are ignored, the request reads from the replica as usual.
+func (s *Server) readYourWrites(c *fiber.Ctx) error {
+	token := c.Get(consistencyHeader)
+	if token != "" && s.readYourWritesWindow > 0 && s.validConsistencyToken(token, time.Now()) {
+		c.SetUserContext(database.WithPrimary(c.UserContext()))
+	}
+	return c.Next()
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+// laggingDatabase has a read replica that never catches up, keys are only listed when reading
+// from the primary
+type laggingDatabase struct {
+	*memoryDatabase
+}
+
+func (db *laggingDatabase) ListKeysByKeyAuthId(ctx context.Context, keyAuthId string, limit int, offset int, ownerId string) ([]entities.Key, int, error) {
+	if !database.ReadsPrimary(ctx) {
+		return []entities.Key{}, 0, nil
+	}
+	return db.memoryDatabase.ListKeysByKeyAuthId(ctx, keyAuthId, limit, offset, ownerId)
+}
+
+func TestReadYourWrites(t *testing.T) {
+	db := &laggingDatabase{newMemoryDatabase()}
+	srv := newTestServer(t, withDatabase(db), func(c *Config) {
+		c.UnkeyAppAuthToken = "app_token"
+	})
+
+	req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(`{"apiId":"api_1"}`))
+	req.Header.Set("Authorization", "Bearer root_key")
+	req.Header.Set("Content-Type", "application/json")
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 200, res.StatusCode)
+	token := res.Header.Get(consistencyHeader)
+	require.NotEmpty(t, token)
+
+	list := func(token string) int {
+		req := httptest.NewRequest("GET", "/v1/apis/api_1/keys", nil)
+		req.Header.Set("Authorization", "Bearer root_key")
+		if token != "" {
+			req.Header.Set(consistencyHeader, token)
+		}
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, 200, res.StatusCode)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		listRes := ListKeysResponse{}
+		require.NoError(t, json.Unmarshal(body, &listRes))
+		return len(listRes.Keys)
+	}
+
+	// the replica lags behind
+	require.Equal(t, 0, list(""))
+	// the token sends the read to the primary
+	require.Equal(t, 1, list(token))
+
+	expired := strconv.FormatInt(time.Now().Add(-time.Second).UnixMilli(), 10)
+	require.Equal(t, 0, list(expired+"."+srv.signConsistency(expired)))
+
+	future := strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10)
+	require.Equal(t, 0, list(future+".forged"), "unsigned tokens must be ignored")
+	require.Equal(t, 0, list("not a token"))
+}
+
+func TestReadYourWrites_Disabled(t *testing.T) {
+	window := time.Duration(0)
+	srv := newTestServer(t, withDatabase(&laggingDatabase{newMemoryDatabase()}), func(c *Config) {
+		c.ReadYourWritesWindow = &window
+	})
+
+	req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(`{"apiId":"api_1"}`))
+	req.Header.Set("Authorization", "Bearer root_key")
+	req.Header.Set("Content-Type", "application/json")
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 200, res.StatusCode)
+	require.Empty(t, res.Header.Get(consistencyHeader))
+}
+
+func TestValidConsistencyToken_OtherSecret(t *testing.T) {
+	signer := newTestServer(t, func(c *Config) {
+		c.UnkeyAppAuthToken = "token_a"
+	})
+	verifier := newTestServer(t, func(c *Config) {
+		c.UnkeyAppAuthToken = "token_b"
+	})
+
+	expires := strconv.FormatInt(time.Now().Add(time.Minute).UnixMilli(), 10)
+	token := expires + "." + signer.signConsistency(expires)
+	require.True(t, signer.validConsistencyToken(token, time.Now()))
+	require.False(t, verifier.validConsistencyToken(token, time.Now()))
+}
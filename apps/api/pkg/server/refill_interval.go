@@ -0,0 +1,63 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// maxRefillInterval is the largest interval we can store, the column is a signed 32 bit int of milliseconds.
+const maxRefillInterval = time.Duration(math.MaxInt32) * time.Millisecond
+
+// RefillInterval is the refill interval of a ratelimit in milliseconds.
+//
+// In json it can either be a number of milliseconds, or a duration string with a unit such as "1m" or "24h".
+// Strings without a unit, such as "60", are ambiguous and rejected.
+type RefillInterval int64
+
+func (r *RefillInterval) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+
+	var d time.Duration
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		err := json.Unmarshal(b, &s)
+		if err != nil {
+			return err
+		}
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			return fmt.Errorf("refillInterval %q is missing a unit, use a number of milliseconds or a duration like \"1m\"", s)
+		}
+		d, err = time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("refillInterval %q is not a valid duration, use a unit of ms, s, m or h", s)
+		}
+		if d%time.Millisecond != 0 {
+			return fmt.Errorf("refillInterval %q must be a whole number of milliseconds", s)
+		}
+	} else {
+		ms, err := strconv.ParseInt(string(b), 10, 64)
+		if err != nil {
+			return fmt.Errorf("refillInterval must be a whole number of milliseconds or a duration string, got %s", string(b))
+		}
+		if ms > int64(maxRefillInterval/time.Millisecond) {
+			return fmt.Errorf("refillInterval must not be longer than %s", maxRefillInterval)
+		}
+		d = time.Duration(ms) * time.Millisecond
+	}
+
+	if d <= 0 {
+		return fmt.Errorf("refillInterval must be positive")
+	}
+	if d > maxRefillInterval {
+		return fmt.Errorf("refillInterval must not be longer than %s", maxRefillInterval)
+	}
+
+	*r = RefillInterval(d / time.Millisecond)
+	return nil
+}
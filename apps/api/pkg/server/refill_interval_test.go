@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefillInterval_Unmarshal(t *testing.T) {
+	testCases := []struct {
+		json string
+		ms   int64
+	}{
+		{json: `1000`, ms: 1000},
+		{json: `"250ms"`, ms: 250},
+		{json: `"1s"`, ms: 1000},
+		{json: `"1m"`, ms: 60_000},
+		{json: `"24h"`, ms: 86_400_000},
+		{json: `"1h30m"`, ms: 5_400_000},
+		{json: `"596h31m23.647s"`, ms: 2147483647},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.json, func(t *testing.T) {
+			var r RefillInterval
+			require.NoError(t, json.Unmarshal([]byte(tc.json), &r))
+			require.Equal(t, tc.ms, int64(r))
+		})
+	}
+}
+
+func TestRefillInterval_UnmarshalRejects(t *testing.T) {
+	testCases := []struct {
+		name string
+		json string
+	}{
+		{name: "missing unit", json: `"60"`},
+		{name: "unknown unit", json: `"1d"`},
+		{name: "garbage", json: `"soon"`},
+		{name: "empty", json: `""`},
+		{name: "zero", json: `0`},
+		{name: "zero duration", json: `"0s"`},
+		{name: "negative", json: `-1000`},
+		{name: "negative duration", json: `"-1m"`},
+		{name: "fraction of a millisecond", json: `"1500us"`},
+		{name: "fractional number", json: `1.5`},
+		{name: "too long", json: `"600h"`},
+		{name: "too many milliseconds", json: `2147483648`},
+		{name: "overflows int64", json: `99999999999999999999`},
+		{name: "overflows duration", json: `"9999999999h"`},
+		{name: "boolean", json: `true`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var r RefillInterval
+			require.Error(t, json.Unmarshal([]byte(tc.json), &r))
+		})
+	}
+}
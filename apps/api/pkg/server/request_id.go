@@ -0,0 +1,39 @@
+package server
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+const requestIdHeader = "Unkey-Request-Id"
+
+// Incoming request ids longer than this are ignored and we generate our own.
+const maxRequestIdLength = 128
+
+type requestIdContextKey struct{}
+
+// getOrCreateRequestId reuses the request id set by the caller or generates a new one.
+func getOrCreateRequestId(c *fiber.Ctx) string {
+	requestId := c.Get(requestIdHeader)
+	if requestId == "" || len(requestId) > maxRequestIdLength {
+		requestId = uid.Request()
+	}
+	return requestId
+}
+
+func withRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdContextKey{}, requestId)
+}
+
+// RequestIdFromContext returns the request id or an empty string if there is none.
+func RequestIdFromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdContextKey{}).(string)
+	return requestId
+}
+
+// requestId returns the id of the current request.
+func requestId(c *fiber.Ctx) string {
+	return RequestIdFromContext(c.UserContext())
+}
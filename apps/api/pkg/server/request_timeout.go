@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+// DefaultRequestTimeout is how long a handler may take before its database calls are cancelled.
+// Healthy requests finish in milliseconds, this only cuts off requests stuck on the database.
+const DefaultRequestTimeout = 10 * time.Second
+
+// timeout gives every request a deadline. Database calls take the context of the request,
+// so a stuck database makes them fail instead of holding the request and its connection forever.
+// A request that failed after its deadline gets a TIMEOUT error, whatever the handler made of it.
+func (s *Server) timeout(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), s.requestTimeout)
+	defer cancel()
+	c.SetUserContext(ctx)
+
+	err := c.Next()
+	// some handlers write their errors themselves, like verifyKey
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && (err != nil || c.Response().StatusCode() >= 500) {
+		return errs.New(errs.TIMEOUT, fmt.Sprintf("the request did not finish within %s, please try again", s.requestTimeout))
+	}
+	return err
+}
+
+// detachedContext keeps the values of a request, like its trace, but not its deadline
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// detach is for work that outlives the request, such as audit logs written in the background.
+// It must not be cancelled together with the request.
+func detach(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+// stuckDatabase never answers, like a database that stopped responding, until the context is done
+type stuckDatabase struct {
+	*memoryDatabase
+}
+
+func (db *stuckDatabase) GetKeysByHashes(ctx context.Context, hashes []string) (map[string]entities.Key, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (db *stuckDatabase) GetKeyAndApiByHash(ctx context.Context, hash string) (entities.Key, entities.Api, error) {
+	<-ctx.Done()
+	return entities.Key{}, entities.Api{}, ctx.Err()
+}
+
+func TestRequestTimeout(t *testing.T) {
+	srv := newTestServer(t, withDatabase(&stuckDatabase{newMemoryDatabase()}), func(c *Config) {
+		c.RequestTimeout = 50 * time.Millisecond
+	})
+
+	whoami := httptest.NewRequest("GET", "/v1/keys.whoami", nil)
+	whoami.Header.Set("Authorization", "Bearer root_key")
+	// verifyKey writes its errors itself
+	verify := httptest.NewRequest("POST", "/v1/keys/verify", bytes.NewBufferString(`{"key":"some_key"}`))
+	verify.Header.Set("Content-Type", "application/json")
+
+	for name, req := range map[string]*http.Request{"whoami": whoami, "verify": verify} {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now()
+			// no timeout of the test client, the server must answer by itself
+			res, err := srv.app.Test(req, -1)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Less(t, time.Since(start), time.Second)
+
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			require.Equal(t, 504, res.StatusCode)
+			require.Contains(t, string(body), `"code":"TIMEOUT"`)
+		})
+	}
+}
@@ -3,19 +3,22 @@ package server
 import (
 	"crypto/subtle"
 	"fmt"
-	"go.uber.org/zap"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
 	"github.com/unkeyed/unkey/apps/api/pkg/entities"
-	"github.com/unkeyed/unkey/apps/api/pkg/hash"
 	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
 	"github.com/unkeyed/unkey/apps/api/pkg/keys"
 	"github.com/unkeyed/unkey/apps/api/pkg/uid"
 )
 
+// DefaultMaxScopesPerKey is the default limit for the scopes of a root key. Every scope is stored with
+// the key and checked when it is used, there are far fewer scopes than this
+const DefaultMaxScopesPerKey = 100
+
 type CreateRootKeyRequest struct {
 	Name    string `json:"name"`
 	Expires int64  `json:"expires"`
@@ -23,6 +26,9 @@ type CreateRootKeyRequest struct {
 	// ForWorkspaceId is used internally when the frontend wants to create a new root key.
 	// Therefore we might not want to add this field to our docs.
 	ForWorkspaceId string `json:"forWorkspaceId" validate:"required"`
+
+	// Scopes limit what the root key may do, a root key without scopes has full access.
+	Scopes []string `json:"scopes,omitempty"`
 }
 
 type CreateRootKeyResponse struct {
@@ -38,8 +44,9 @@ func (s *Server) createRootKey(c *fiber.Ctx) error {
 	if subtle.ConstantTimeCompare([]byte(s.unkeyAppAuthToken), []byte(appToken)) == 0 {
 		return c.Status(http.StatusUnauthorized).JSON(
 			ErrorResponse{
-				Code:  UNAUTHORIZED,
-				Error: "unauthorized",
+				Code:      UNAUTHORIZED,
+				Error:     "unauthorized",
+				RequestId: requestId(c),
 			})
 	}
 
@@ -47,36 +54,59 @@ func (s *Server) createRootKey(c *fiber.Ctx) error {
 	err := c.BodyParser(&req)
 	if err != nil {
 		return c.Status(http.StatusBadRequest).JSON(ErrorResponse{
-			Code:  BAD_REQUEST,
-			Error: fmt.Sprintf("unable to parse body: %s", err.Error()),
+			Code:      BAD_REQUEST,
+			Error:     fmt.Sprintf("unable to parse body: %s", err.Error()),
+			RequestId: requestId(c),
 		})
 	}
 
 	err = s.validator.Struct(req)
 	if err != nil {
 		return c.Status(http.StatusBadRequest).JSON(ErrorResponse{
-			Code:  BAD_REQUEST,
-			Error: fmt.Sprintf("unable to validate body: %s", err.Error()),
+			Code:      BAD_REQUEST,
+			Error:     fmt.Sprintf("unable to validate body: %s", err.Error()),
+			RequestId: requestId(c),
 		})
 	}
 
-	if req.Expires > 0 && req.Expires < time.Now().UnixMilli() {
+	if expiryInPast(req.Expires, time.Now(), s.clockSkewTolerance) {
 		return c.Status(http.StatusBadRequest).JSON(
 			ErrorResponse{
-				Code:  BAD_REQUEST,
-				Error: "'expires' must be in the future, did you pass in a timestamp in seconds instead of milliseconds?",
+				Code:      BAD_REQUEST,
+				Error:     "'expires' must be in the future, did you pass in a timestamp in seconds instead of milliseconds?",
+				RequestId: requestId(c),
 			})
 	}
 
-	keyValue, err := keys.NewV1Key("unkey", 16)
+	if len(req.Scopes) > s.maxScopesPerKey {
+		return c.Status(http.StatusBadRequest).JSON(
+			ErrorResponse{
+				Code:      BAD_REQUEST,
+				Error:     fmt.Sprintf("'scopes' must not have more than %d entries, got %d", s.maxScopesPerKey, len(req.Scopes)),
+				RequestId: requestId(c),
+			})
+	}
+
+	for _, scope := range req.Scopes {
+		if !entities.ValidScope(scope) {
+			return c.Status(http.StatusBadRequest).JSON(
+				ErrorResponse{
+					Code:      BAD_REQUEST,
+					Error:     fmt.Sprintf("unknown scope '%s', must be one of: %s", scope, strings.Join(entities.AllScopes, ", ")),
+					RequestId: requestId(c),
+				})
+		}
+	}
+
+	keyValue, start, err := keys.NewV1Key("unkey", 16, keys.WithStartChars(s.keyStartChars))
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: err.Error(),
+			Code:      INTERNAL_SERVER_ERROR,
+			Error:     err.Error(),
+			RequestId: requestId(c),
 		})
 	}
-	separatorIndex := strings.Index(keyValue, "_")
-	keyHash := hash.Sha256(keyValue)
+	keyHash := s.hasher.Hash(keyValue)
 
 	newKey := entities.Key{
 		Id:          uid.Key(),
@@ -84,7 +114,7 @@ func (s *Server) createRootKey(c *fiber.Ctx) error {
 		WorkspaceId: s.unkeyWorkspaceId,
 		Name:        req.Name,
 		Hash:        keyHash,
-		Start:       keyValue[0 : separatorIndex+4],
+		Start:       start,
 		CreatedAt:   time.Now(),
 		Ratelimit: &entities.Ratelimit{
 			Type:           "fast",
@@ -93,6 +123,7 @@ func (s *Server) createRootKey(c *fiber.Ctx) error {
 			RefillInterval: 1000,
 		},
 		ForWorkspaceId: req.ForWorkspaceId,
+		Scopes:         req.Scopes,
 	}
 	if req.Expires > 0 {
 		newKey.Expires = time.UnixMilli(req.Expires)
@@ -101,19 +132,19 @@ func (s *Server) createRootKey(c *fiber.Ctx) error {
 	err = s.db.CreateKey(ctx, newKey)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(ErrorResponse{
-			Code:  INTERNAL_SERVER_ERROR,
-			Error: fmt.Sprintf("unable to store key: %s", err.Error()),
+			Code:      INTERNAL_SERVER_ERROR,
+			Error:     fmt.Sprintf("unable to store key: %s", err.Error()),
+			RequestId: requestId(c),
 		})
 	}
-	if s.kafka != nil {
-
-		go func() {
-			err := s.kafka.ProduceKeyEvent(ctx, kafka.KeyCreated, newKey.Id, newKey.Hash)
-			if err != nil {
-				s.logger.Error("unable to emit new key event to kafka", zap.Error(err))
-			}
-		}()
-	}
+	s.emitKeyEvent(ctx, kafka.KeyCreated, newKey)
+	s.appendAuditLog(ctx, c, audit.Entry{
+		WorkspaceId: newKey.ForWorkspaceId,
+		Action:      audit.KeyCreated,
+		TargetKeyId: newKey.Id,
+		Reason:      "root key created by unkey",
+	})
+	s.setConsistencyToken(c)
 	return c.JSON(CreateRootKeyResponse{
 		Key:   keyValue,
 		KeyId: newKey.Id,
@@ -120,3 +120,36 @@ func TestRootCreateKey_WithExpiry(t *testing.T) {
 	require.Equal(t, int64(1000), found.Ratelimit.RefillInterval)
 
 }
+
+func TestRootCreateKey_MaxScopes(t *testing.T) {
+	db := &quotaDatabase{workspace: entities.Workspace{Id: "ws_1"}}
+	srv := New(Config{
+		Logger:            logging.NewNoopLogger(),
+		KeyCache:          cache.NewNoopCache[entities.Key](),
+		ApiCache:          cache.NewNoopCache[entities.Api](),
+		Database:          db,
+		Tracer:            tracing.NewNoop(),
+		UnkeyAppAuthToken: "supersecret",
+		MaxScopesPerKey:   3,
+	})
+
+	create := func(n int) int {
+		scopes := make([]string, n)
+		for i := range scopes {
+			scopes[i] = entities.ScopeKeysRead
+		}
+		body, err := json.Marshal(CreateRootKeyRequest{ForWorkspaceId: "ws_1", Scopes: scopes})
+		require.NoError(t, err)
+		req := httptest.NewRequest("POST", "/v1/internal/rootkeys", bytes.NewBuffer(body))
+		req.Header.Set("Authorization", "Bearer supersecret")
+		req.Header.Set("Content-Type", "application/json")
+		res, err := srv.app.Test(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		return res.StatusCode
+	}
+
+	require.Equal(t, 200, create(3))
+	require.Equal(t, 400, create(4))
+	require.Len(t, db.created, 1)
+}
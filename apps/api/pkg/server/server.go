@@ -1,34 +1,49 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/netip"
+	"regexp"
 	"runtime"
+	"sync"
 	"time"
 
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
 	"github.com/gofiber/fiber/v2"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/unkeyed/unkey/apps/api/pkg/cache"
+	"github.com/unkeyed/unkey/apps/api/pkg/config"
 	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/encryption"
 	"github.com/unkeyed/unkey/apps/api/pkg/entities"
-	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
+	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/idempotency"
+	"github.com/unkeyed/unkey/apps/api/pkg/keys"
 	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/metrics"
 	"github.com/unkeyed/unkey/apps/api/pkg/ratelimit"
+	"github.com/unkeyed/unkey/apps/api/pkg/service"
 	"github.com/unkeyed/unkey/apps/api/pkg/tinybird"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
 )
 
 type Config struct {
 	Logger   logging.Logger
 	KeyCache cache.Cache[entities.Key]
 	// The ApiCache uses the KeyAuthId as cache key, not an apiId
-	ApiCache        cache.Cache[entities.Api]
+	ApiCache cache.Cache[entities.Api]
+	// Optional, caches workspaces by their id, a noop cache is used if nil
+	WorkspaceCache  cache.Cache[entities.Workspace]
 	Database        database.Database
 	Ratelimit       ratelimit.Ratelimiter
 	GlobalRatelimit ratelimit.Ratelimiter
@@ -41,8 +56,60 @@ type Config struct {
 	UnkeyApiId        string
 	UnkeyKeyAuthId    string
 	Region            string
-	Kafka             *kafka.Kafka
-	Version           string
+	Kafka             EventBus
+	// Optional, delivers key events to the webhooks of a workspace
+	Webhooks WebhookDispatcher
+	// Optional, counts successful verifications for usage analytics
+	Usage   UsageRecorder
+	Version string
+	// Optional, a new set of metrics is created if nil
+	Metrics *metrics.Metrics
+	// Limits for the meta of keys, defaults are used when 0
+	MaxMetaBytes int
+	MaxMetaDepth int
+	// Limits how many scopes a root key may have, DefaultMaxScopesPerKey is used when 0
+	MaxScopesPerKey int
+	// Limits the size of request bodies, DefaultMaxBodyBytes is used when 0
+	MaxBodyBytes int
+	// Overrides MaxBodyBytes for single routes, keyed by path, on top of DefaultRouteBodyLimits
+	RouteBodyLimits map[string]int
+	// How many keys an export loads at once, DefaultExportPageSize is used when 0
+	ExportPageSize int
+	// How long a request may take, DefaultRequestTimeout is used when 0. Exports stream past it
+	RequestTimeout time.Duration
+	// Limits how fast a single root key can create keys, DefaultCreateKeyRatelimit is used when the limit is 0
+	CreateKeyRatelimit RatelimitConfig
+	// How long createKey responses are remembered for retries with the same Idempotency-Key, defaults to DefaultIdempotencyTTL
+	IdempotencyTTL time.Duration
+	// How far in the future keys may expire, workspaces can override it, 0 means unlimited
+	MaxKeyLifetime time.Duration
+	// Proxies whose forwarding headers are trusted to resolve the client ip, see config.ParseTrustedProxies
+	TrustedProxies []netip.Prefix
+	// How many characters of the secret are stored in plaintext in the start of new keys.
+	// keys.DefaultStartChars is used if nil, 0 only stores the prefix.
+	KeyStartChars *int
+	// DetailedVerifyErrors tells missing and expired keys apart in verifications.
+	// Only enable it if every caller is trusted, otherwise it tells them which keys exist.
+	DetailedVerifyErrors bool
+	// The level denied verifications are logged at, with the reason and client ip. Defaults to info.
+	DeniedVerificationLogLevel zapcore.Level
+	// Optional, encrypts the secrets of recoverable keys, they can only be created if it is set
+	Keyring *encryption.Keyring
+	// Optional, peppers the hashes of new keys, keys are hashed with plain sha256 if it is nil
+	Hasher *hash.Hasher
+	// Browsers on other origins are denied unless they are allowed here
+	Cors CorsConfig
+	// Prefixes new keys may not use, compared case-insensitively. Empty by default.
+	ReservedPrefixes []string
+	// Limits the owner ids of keys, DefaultMaxOwnerIdLength is used when 0
+	MaxOwnerIdLength int
+	// Optional, owner ids must match it as a whole, see config.ParseOwnerIdPattern
+	OwnerIdPattern *regexp.Regexp
+	// Expiries are this much more lenient to allow for drifting clocks, DefaultClockSkewTolerance is used when nil
+	ClockSkewTolerance *time.Duration
+	// How long a client reads from the primary after it created something, so it finds it despite
+	// the lag of read replicas. DefaultReadYourWritesWindow is used when nil, 0 disables it.
+	ReadYourWritesWindow *time.Duration
 }
 
 type Server struct {
@@ -52,49 +119,234 @@ type Server struct {
 	db              database.Database
 	keyCache        cache.Cache[entities.Key]
 	apiCache        cache.Cache[entities.Api]
+	workspaceCache  cache.Cache[entities.Workspace]
 	ratelimit       ratelimit.Ratelimiter
 	globalRatelimit ratelimit.Ratelimiter
 	tracer          trace.Tracer
 	// potentially nil, always do a check first
 	tinybird *tinybird.Tinybird
-	closeC   chan struct{}
+	// tracks work that outlives a request, such as emitting events
+	background sync.WaitGroup
 	// Used to authenticate our frontend when creating new unkey keys.
-	unkeyAppAuthToken string
-	unkeyWorkspaceId  string
-	unkeyApiId        string
-	unkeyKeyAuthId    string
-	region            string
-	kafka             *kafka.Kafka
-	version           string
+	unkeyAppAuthToken  string
+	unkeyWorkspaceId   string
+	unkeyApiId         string
+	unkeyKeyAuthId     string
+	region             string
+	kafka              EventBus
+	webhooks           WebhookDispatcher
+	usage              UsageRecorder
+	version            string
+	metrics            *metrics.Metrics
+	maxMetaBytes       int
+	maxMetaDepth       int
+	maxBodyBytes       int
+	routeBodyLimits    map[string]int
+	exportPageSize     int
+	requestTimeout     time.Duration
+	reservedPrefixes   map[string]bool
+	maxOwnerIdLength   int
+	ownerIdPattern     *regexp.Regexp
+	clockSkewTolerance time.Duration
+	createKeyRatelimit RatelimitConfig
+	trustedProxies     []netip.Prefix
+	keyStartChars      int
+	keyring            *encryption.Keyring
+	hasher             *hash.Hasher
+	// see Config.DetailedVerifyErrors
+	detailedVerifyErrors bool
+	// see Config.DeniedVerificationLogLevel
+	deniedVerificationLogLevel zapcore.Level
+	service                    *service.Service
+	// createKeyIdempotency holds plaintext keys, it must never be persisted
+	createKeyIdempotency *idempotency.Store[CreateKeyResponse]
+	lastUsed             *lastUsedThrottle
+	// see setConsistencyToken
+	readYourWritesWindow time.Duration
+	consistencyKey       []byte
+	maxScopesPerKey      int
+	// only serving if StartGRPC is called
+	grpcServer *grpc.Server
 }
 
-func New(config Config) *Server {
+// NewFromConfig creates a server with the settings of the validated startup config.
+// deps provides everything else, settings that are part of cfg are overwritten.
+func NewFromConfig(cfg config.Config, deps Config) (*Server, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	keyring, err := cfg.Encryption.Keyring()
+	if err != nil {
+		return nil, err
+	}
+	hasher, err := cfg.Hashing.Hasher()
+	if err != nil {
+		return nil, err
+	}
+	deps.Region = cfg.Region
+	deps.Keyring = keyring
+	deps.Hasher = hasher
+	deps.UnkeyAppAuthToken = cfg.Unkey.AppAuthToken
+	deps.UnkeyWorkspaceId = cfg.Unkey.WorkspaceId
+	deps.UnkeyApiId = cfg.Unkey.ApiId
+	deps.UnkeyKeyAuthId = cfg.Unkey.KeyAuthId
+	deps.KeyStartChars = cfg.Server.KeyStartChars
+	deps.MaxMetaBytes = cfg.Server.MaxMetaBytes
+	deps.MaxMetaDepth = cfg.Server.MaxMetaDepth
+	deps.MaxScopesPerKey = cfg.Server.MaxScopesPerKey
+	deps.MaxBodyBytes = cfg.Server.MaxBodyBytes
+	deps.RequestTimeout = cfg.Server.RequestTimeout
+	deps.CreateKeyRatelimit = createKeyRatelimitFromConfig(cfg.Server.CreateKeyRatelimit)
+	deps.IdempotencyTTL = cfg.Server.IdempotencyTTL
+	deps.MaxKeyLifetime = cfg.Server.MaxKeyLifetime
+	deps.TrustedProxies = cfg.Server.TrustedProxies
+	deps.DetailedVerifyErrors = cfg.Server.DetailedVerifyErrors
+	deps.DeniedVerificationLogLevel = cfg.Server.DeniedVerificationLogLevel
+	deps.ReservedPrefixes = cfg.Server.ReservedKeyPrefixes
+	deps.MaxOwnerIdLength = cfg.Server.MaxOwnerIdLength
+	deps.OwnerIdPattern = cfg.Server.OwnerIdPattern
+	deps.ClockSkewTolerance = cfg.Server.ClockSkewTolerance
+	deps.ReadYourWritesWindow = cfg.Server.ReadYourWritesWindow
+	deps.Cors = CorsConfig{
+		AllowOrigins: cfg.Server.Cors.AllowOrigins,
+		AllowMethods: cfg.Server.Cors.AllowMethods,
+		AllowHeaders: cfg.Server.Cors.AllowHeaders,
+		MaxAge:       cfg.Server.Cors.MaxAge,
+	}
+	return New(deps), nil
+}
 
-	appConfig := fiber.Config{
-		DisableStartupMessage: true,
-		Immutable:             true,
+// createKeyRatelimitFromConfig defaults every setting on its own, raising only the limit keeps the default refill
+func createKeyRatelimitFromConfig(c config.CreateKeyRatelimit) RatelimitConfig {
+	r := RatelimitConfig{
+		Limit:          c.Limit,
+		RefillRate:     c.RefillRate,
+		RefillInterval: c.RefillInterval,
 	}
+	if r.Limit == 0 {
+		r.Limit = DefaultCreateKeyRatelimit.Limit
+	}
+	if r.RefillRate == 0 {
+		r.RefillRate = DefaultCreateKeyRatelimit.RefillRate
+	}
+	if r.RefillInterval == 0 {
+		r.RefillInterval = DefaultCreateKeyRatelimit.RefillInterval
+	}
+	return r
+}
+
+func New(config Config) *Server {
 
 	s := &Server{
-		app:               fiber.New(appConfig),
-		kafka:             config.Kafka,
-		logger:            config.Logger,
-		validator:         validator.New(),
-		db:                config.Database,
-		keyCache:          config.KeyCache,
-		apiCache:          config.ApiCache,
-		ratelimit:         config.Ratelimit,
-		tracer:            config.Tracer,
-		tinybird:          config.Tinybird,
-		closeC:            make(chan struct{}),
-		unkeyAppAuthToken: config.UnkeyAppAuthToken,
-		unkeyWorkspaceId:  config.UnkeyWorkspaceId,
-		unkeyApiId:        config.UnkeyApiId,
-		unkeyKeyAuthId:    config.UnkeyKeyAuthId,
-		region:            config.Region,
-		version:           config.Version,
+		kafka:                      config.Kafka,
+		webhooks:                   config.Webhooks,
+		usage:                      config.Usage,
+		logger:                     config.Logger,
+		validator:                  newValidator(),
+		db:                         config.Database,
+		keyCache:                   config.KeyCache,
+		apiCache:                   config.ApiCache,
+		workspaceCache:             config.WorkspaceCache,
+		ratelimit:                  config.Ratelimit,
+		tracer:                     config.Tracer,
+		tinybird:                   config.Tinybird,
+		unkeyAppAuthToken:          config.UnkeyAppAuthToken,
+		unkeyWorkspaceId:           config.UnkeyWorkspaceId,
+		unkeyApiId:                 config.UnkeyApiId,
+		unkeyKeyAuthId:             config.UnkeyKeyAuthId,
+		region:                     config.Region,
+		version:                    config.Version,
+		metrics:                    config.Metrics,
+		maxMetaBytes:               config.MaxMetaBytes,
+		maxMetaDepth:               config.MaxMetaDepth,
+		createKeyRatelimit:         config.CreateKeyRatelimit,
+		trustedProxies:             config.TrustedProxies,
+		keyStartChars:              keys.DefaultStartChars,
+		keyring:                    config.Keyring,
+		hasher:                     config.Hasher,
+		detailedVerifyErrors:       config.DetailedVerifyErrors,
+		deniedVerificationLogLevel: config.DeniedVerificationLogLevel,
+		lastUsed:                   newLastUsedThrottle(),
+		reservedPrefixes:           newReservedPrefixes(config.ReservedPrefixes),
+		maxOwnerIdLength:           config.MaxOwnerIdLength,
+		ownerIdPattern:             config.OwnerIdPattern,
+		maxScopesPerKey:            config.MaxScopesPerKey,
+	}
+	if config.KeyStartChars != nil {
+		s.keyStartChars = *config.KeyStartChars
+	}
+	s.clockSkewTolerance = DefaultClockSkewTolerance
+	if config.ClockSkewTolerance != nil {
+		s.clockSkewTolerance = *config.ClockSkewTolerance
+	}
+	s.readYourWritesWindow = DefaultReadYourWritesWindow
+	if config.ReadYourWritesWindow != nil {
+		s.readYourWritesWindow = *config.ReadYourWritesWindow
+	}
+	s.consistencyKey = consistencyKey(config.UnkeyAppAuthToken)
+	s.service = service.New(service.Config{
+		Database:       config.Database,
+		MaxKeyLifetime: config.MaxKeyLifetime,
+		KeyStartChars:  s.keyStartChars,
+		Keyring:        config.Keyring,
+		Hasher:         config.Hasher,
+	})
+	if s.metrics == nil {
+		s.metrics = metrics.New()
+	}
+	if s.workspaceCache == nil {
+		s.workspaceCache = cache.NewNoopCache[entities.Workspace]()
+	}
+	if s.maxMetaBytes <= 0 {
+		s.maxMetaBytes = DefaultMaxMetaBytes
+	}
+	if s.maxMetaDepth <= 0 {
+		s.maxMetaDepth = DefaultMaxMetaDepth
+	}
+	if s.maxScopesPerKey <= 0 {
+		s.maxScopesPerKey = DefaultMaxScopesPerKey
+	}
+	if s.maxOwnerIdLength <= 0 {
+		s.maxOwnerIdLength = DefaultMaxOwnerIdLength
+	}
+	if config.IdempotencyTTL <= 0 {
+		config.IdempotencyTTL = DefaultIdempotencyTTL
+	}
+	s.createKeyIdempotency = idempotency.New[CreateKeyResponse](config.IdempotencyTTL)
+	if s.createKeyRatelimit.Limit == 0 {
+		s.createKeyRatelimit = DefaultCreateKeyRatelimit
 	}
 
+	s.grpcServer = newGrpcServer(s)
+
+	s.maxBodyBytes = config.MaxBodyBytes
+	if s.maxBodyBytes <= 0 {
+		s.maxBodyBytes = DefaultMaxBodyBytes
+	}
+	s.routeBodyLimits = map[string]int{}
+	for path, limit := range DefaultRouteBodyLimits {
+		s.routeBodyLimits[path] = limit
+	}
+	for path, limit := range config.RouteBodyLimits {
+		s.routeBodyLimits[path] = limit
+	}
+	s.exportPageSize = config.ExportPageSize
+	if s.exportPageSize <= 0 {
+		s.exportPageSize = DefaultExportPageSize
+	}
+	s.requestTimeout = config.RequestTimeout
+	if s.requestTimeout <= 0 {
+		s.requestTimeout = DefaultRequestTimeout
+	}
+
+	s.app = fiber.New(fiber.Config{
+		DisableStartupMessage: true,
+		Immutable:             true,
+		ErrorHandler:          s.errorHandler,
+		BodyLimit:             s.bodyLimit(),
+	})
+
 	s.app.Use(recover.New(recover.Config{EnableStackTrace: true, StackTraceHandler: func(c *fiber.Ctx, err interface{}) {
 		buf := make([]byte, 2048)
 		buf = buf[:runtime.Stack(buf, false)]
@@ -105,19 +357,28 @@ func New(config Config) *Server {
 
 		// This header is a three letter region code which represents the region that the connection was accepted in and routed from.
 		edgeRegion := c.Get("Fly-Region")
+		requestId := getOrCreateRequestId(c)
 
-		ctx, span := s.tracer.Start(c.UserContext(), "request", trace.WithAttributes(
+		ctx, span := s.tracer.Start(withRequestId(c.UserContext(), requestId), "request", trace.WithAttributes(
 			attribute.String("method", c.Route().Method),
 			attribute.String("path", c.Path()),
 			attribute.String("edgeRegion", edgeRegion),
+			attribute.String("requestId", requestId),
 		))
 		defer span.End()
 		c.SetUserContext(ctx)
 
 		c.Set("Unkey-Trace-Id", fmt.Sprintf("%s:%s::%s", s.region, edgeRegion, span.SpanContext().TraceID().String()))
 		c.Set("Unkey-Version", s.version)
+		c.Set(requestIdHeader, requestId)
 		start := time.Now()
 		err := c.Next()
+		if err != nil {
+			// Handle the error here so the logged status matches what we send to the client
+			if handlerErr := s.app.ErrorHandler(c, err); handlerErr != nil {
+				_ = c.SendStatus(http.StatusInternalServerError)
+			}
+		}
 		latency := time.Since(start)
 
 		log := config.Logger.With(
@@ -128,6 +389,7 @@ func New(config Config) *Server {
 			zap.Duration("ms", latency),
 			zap.String("edgeRegion", edgeRegion),
 			zap.Int("status", c.Response().StatusCode()),
+			zap.String("requestId", requestId),
 		)
 
 		if err != nil || c.Response().StatusCode() >= 500 {
@@ -137,20 +399,60 @@ func New(config Config) *Server {
 			log.Info("request completed")
 		}
 
-		return err
+		return nil
 	})
+	s.app.Use(cors(config.Cors))
+	s.app.Use(s.clientIp)
+	s.app.Use(s.limitBody)
+	s.app.Use(s.readYourWrites)
+	s.app.Use(s.timeout)
 
 	s.app.Get("/v1/liveness", s.liveness)
+	s.app.Get("/health", s.health)
+	s.app.Get("/ready", s.ready)
+	s.app.Get("/metrics", adaptor.HTTPHandler(s.metrics.Handler()))
 
 	// Used internally only, not covered by versioning
 	s.app.Post("/v1/internal/rootkeys", s.createRootKey)
+	s.app.Post("/v1/internal/workspaces.setEnabled", s.setWorkspaceEnabled)
+	s.app.Post("/v1/internal/workspaces.setHideKeyStart", s.setWorkspaceHideKeyStart)
+	s.app.Post("/v1/internal/workspaces.setOmitKeyStart", s.setWorkspaceOmitKeyStart)
+	s.app.Post("/v1/internal/keys.recomputeStart", s.recomputeKeyStarts)
+
+	s.app.Get("/v1/workspace.stats", s.getWorkspaceStats)
 
 	s.app.Post("/v1/keys", s.createKey)
+	s.app.Post("/v1/keys.createBatch", s.createKeysBatch)
+	s.app.Post("/v1/keys.createToken", s.createKeyToken)
+	s.app.Post("/v1/keys.createWithToken", s.createKeyWithToken)
 	s.app.Get("/v1/keys/:keyId", s.getKey)
 	s.app.Put("/v1/keys/:keyId", s.updateKey)
 	s.app.Delete("/v1/keys/:keyId", s.deleteKey)
 	s.app.Post("/v1/keys/verify", s.verifyKey)
+	s.app.Post("/v1/keys.verifyBatch", s.verifyKeysBatch)
+	s.app.Post("/v1/keys.getSelf", s.getSelfKey)
+	s.app.Post("/v1/keys.transferOwner", s.transferKeysOwner)
+	s.app.Post("/v1/keys.updateMeta", s.updateKeyMeta)
+	s.app.Post("/v1/keys.setEnabled", s.setKeyEnabled)
+	s.app.Post("/v1/keys.setEnabledBulk", s.setKeysEnabled)
+	s.app.Post("/v1/keys.revokeByPrefix", s.revokeKeysByPrefix)
+	s.app.Post("/v1/keys.import", s.importKeys)
+	s.app.Post("/v1/keys.rerollHash", s.rerollKey)
+	s.app.Get("/v1/keys.expiring", s.listExpiringKeys)
+	s.app.Get("/v1/keys.search", s.searchKeys)
+	s.app.Get("/v1/keys.export", s.exportKeys)
+	s.app.Get("/v1/keys.usage", s.getKeyUsage)
+	s.app.Get("/v1/keys.whoami", s.whoami)
 
+	s.app.Get("/v1/audit.list", s.listAuditLogs)
+
+	s.app.Post("/v1/webhooks.create", s.createWebhook)
+	s.app.Get("/v1/webhooks.list", s.listWebhooks)
+	s.app.Post("/v1/webhooks.delete", s.deleteWebhook)
+
+	s.app.Post("/v1/apis.createWithKeyAuth", s.createApiWithKeyAuth)
+	s.app.Post("/v1/apis.setMetaSchema", s.setApiMetaSchema)
+	s.app.Post("/v1/apis.setAllowedMetaKeys", s.setApiAllowedMetaKeys)
 	s.app.Get("/v1/apis/:apiId", s.getApi)
 	s.app.Get("/v1/apis/:apiId/keys", s.listKeys)
 
@@ -166,7 +468,68 @@ func (s *Server) Start(addr string) error {
 	return nil
 }
 
+// Shutdown stops accepting new connections and waits for in-flight requests and
+// background events to finish before closing kafka and the database.
+// If ctx expires first, the remaining work is dropped and an error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.app.ShutdownWithContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to shut down http server: %w", err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+		return fmt.Errorf("unable to shut down grpc server: %w", ctx.Err())
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("background tasks did not finish in time: %w", ctx.Err())
+	}
+
+	if s.usage != nil {
+		err = s.usage.Close(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to flush key usage: %w", err)
+		}
+	}
+
+	if s.webhooks != nil {
+		err = s.webhooks.Close(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to close webhooks: %w", err)
+		}
+	}
+
+	if s.kafka != nil {
+		err = s.kafka.Close()
+		if err != nil {
+			return fmt.Errorf("unable to close kafka: %w", err)
+		}
+	}
+
+	if s.db != nil {
+		err = s.db.Close()
+		if err != nil {
+			return fmt.Errorf("unable to close database: %w", err)
+		}
+	}
+	return nil
+}
+
 func (s *Server) Close() error {
-	s.closeC <- struct{}{}
-	return s.app.Server().Shutdown()
+	return s.Shutdown(context.Background())
 }
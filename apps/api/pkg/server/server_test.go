@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/cache"
+	"github.com/unkeyed/unkey/apps/api/pkg/config"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/kafka"
+	"github.com/unkeyed/unkey/apps/api/pkg/keys"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/tracing"
+)
+
+// slowEventBus takes a while to produce each event
+type slowEventBus struct {
+	sync.Mutex
+	produced []string
+	closed   bool
+}
+
+func (b *slowEventBus) ProduceKeyEvent(ctx context.Context, eventType kafka.KeyEventType, keyId, keyHash string) error {
+	time.Sleep(100 * time.Millisecond)
+	b.Lock()
+	defer b.Unlock()
+	b.produced = append(b.produced, keyId)
+	return nil
+}
+
+func (b *slowEventBus) Ping(ctx context.Context) error { return nil }
+
+func (b *slowEventBus) Close() error {
+	b.Lock()
+	defer b.Unlock()
+	b.closed = true
+	return nil
+}
+
+func TestShutdown_FlushesPendingKeyEvents(t *testing.T) {
+	bus := &slowEventBus{}
+	db := newMemoryDatabase()
+
+	srv := newTestServer(t, withDatabase(db), func(c *Config) {
+		c.Kafka = bus
+	})
+
+	srv.emitKeyEvent(context.Background(), kafka.KeyCreated, entities.Key{Id: "key_1"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, srv.Shutdown(ctx))
+
+	require.Equal(t, []string{"key_1"}, bus.produced)
+	require.True(t, bus.closed)
+	require.Equal(t, 1, db.callsOf("Close"))
+}
+
+func TestShutdown_TimesOut(t *testing.T) {
+	bus := &slowEventBus{}
+
+	srv := newTestServer(t, func(c *Config) {
+		c.Kafka = bus
+	})
+
+	srv.emitKeyEvent(context.Background(), kafka.KeyCreated, entities.Key{Id: "key_1"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.Error(t, srv.Shutdown(ctx))
+	require.False(t, bus.closed)
+}
+
+func TestNewFromConfig(t *testing.T) {
+	deps := Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: newMemoryDatabase(),
+		Tracer:   tracing.NewNoop(),
+		Region:   "ignored",
+	}
+
+	_, err := NewFromConfig(config.Config{Port: "8080"}, deps)
+	var configErr *config.Error
+	require.ErrorAs(t, err, &configErr)
+	require.Contains(t, configErr.Missing, "DATABASE_DSN")
+
+	cfg := config.Config{
+		Port:      "8080",
+		Region:    "fra",
+		Database:  config.Database{Primary: "dsn"},
+		Kafka:     config.Kafka{Brokers: []string{"kafka:9092"}, Username: "user", Password: "pass"},
+		Ratelimit: config.Ratelimit{Backend: config.RatelimitBackendNone},
+		Unkey:     config.Unkey{AppAuthToken: "token", WorkspaceId: "ws_1", ApiId: "api_1", KeyAuthId: "key_auth_1"},
+	}
+	srv, err := NewFromConfig(cfg, deps)
+	require.NoError(t, err)
+	require.Equal(t, "fra", srv.region)
+	require.Equal(t, "ws_1", srv.unkeyWorkspaceId)
+	require.Nil(t, srv.keyring)
+	// unset settings use the defaults of the server
+	require.Equal(t, keys.DefaultStartChars, srv.keyStartChars)
+	require.Equal(t, DefaultMaxMetaBytes, srv.maxMetaBytes)
+	require.Equal(t, DefaultCreateKeyRatelimit, srv.createKeyRatelimit)
+	require.Equal(t, DefaultClockSkewTolerance, srv.clockSkewTolerance)
+
+	startChars := 0
+	noSkew := time.Duration(0)
+	cfg.Server = config.Server{
+		KeyStartChars:      &startChars,
+		MaxMetaBytes:       512,
+		CreateKeyRatelimit: config.CreateKeyRatelimit{Limit: 5},
+		ClockSkewTolerance: &noSkew,
+	}
+	srv, err = NewFromConfig(cfg, deps)
+	require.NoError(t, err)
+	require.Equal(t, 0, srv.keyStartChars)
+	require.Equal(t, 512, srv.maxMetaBytes)
+	require.Equal(t, RatelimitConfig{Limit: 5, RefillRate: DefaultCreateKeyRatelimit.RefillRate, RefillInterval: DefaultCreateKeyRatelimit.RefillInterval}, srv.createKeyRatelimit)
+	require.Equal(t, time.Duration(0), srv.clockSkewTolerance)
+}
@@ -0,0 +1,1042 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/audit"
+	"github.com/unkeyed/unkey/apps/api/pkg/cache"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/keys"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+	"github.com/unkeyed/unkey/apps/api/pkg/tracing"
+	"github.com/unkeyed/unkey/apps/api/pkg/usage"
+	"github.com/unkeyed/unkey/apps/api/pkg/webhooks"
+)
+
+// The fixture of newMemoryDatabase
+const (
+	testWorkspaceId = "ws_1"
+	testKeyAuthId   = "key_auth_1"
+	testApiId       = "api_1"
+	// testRootKey is the secret of a root key for testWorkspaceId without scopes
+	testRootKey   = "root_key"
+	testRootKeyId = "key_root"
+)
+
+// memoryDatabase keeps everything in memory, so handlers can be tested without DATABASE_DSN.
+// It behaves like the real database as far as the handlers can tell, failures are injected with fail.
+type memoryDatabase struct {
+	sync.Mutex
+	workspaces map[string]entities.Workspace
+	apis       map[string]entities.Api
+	keyAuths   map[string]entities.KeyAuth
+	// keys by id
+	keys     map[string]entities.Key
+	webhooks []webhooks.Endpoint
+	usage    map[keyHour]int64
+	// created holds the keys inserted with CreateKey or CreateKeys, in order
+	created   []entities.Key
+	auditLogs []audit.Entry
+	// consumed counts the verifications that used up some of the remaining of a key
+	consumed int
+
+	// calls counts how often each method was called
+	calls    map[string]int
+	failures map[string]error
+}
+
+// newMemoryDatabase holds the workspace testWorkspaceId with the api testApiId and the root key testRootKey
+func newMemoryDatabase() *memoryDatabase {
+	db := &memoryDatabase{
+		workspaces: map[string]entities.Workspace{},
+		apis:       map[string]entities.Api{},
+		keyAuths:   map[string]entities.KeyAuth{},
+		keys:       map[string]entities.Key{},
+		usage:      map[keyHour]int64{},
+		calls:      map[string]int{},
+		failures:   map[string]error{},
+	}
+	db.addWorkspace(entities.Workspace{Id: testWorkspaceId})
+	db.addApi(entities.Api{Id: testApiId, WorkspaceId: testWorkspaceId, AuthType: entities.AuthTypeKey, KeyAuthId: testKeyAuthId})
+	db.addKey(testRootKey, entities.Key{Id: testRootKeyId, ForWorkspaceId: testWorkspaceId})
+	return db
+}
+
+func (db *memoryDatabase) addWorkspace(workspace entities.Workspace) {
+	db.Lock()
+	defer db.Unlock()
+	db.workspaces[workspace.Id] = workspace
+}
+
+// addApi also adds the keyAuth of apis with AuthTypeKey
+func (db *memoryDatabase) addApi(api entities.Api) {
+	db.Lock()
+	defer db.Unlock()
+	db.apis[api.Id] = api
+	if api.KeyAuthId != "" {
+		db.keyAuths[api.KeyAuthId] = entities.KeyAuth{Id: api.KeyAuthId, WorkspaceId: api.WorkspaceId}
+	}
+}
+
+// addKey stores the key under the sha256 of secret, unless it already has a hash
+func (db *memoryDatabase) addKey(secret string, key entities.Key) entities.Key {
+	db.Lock()
+	defer db.Unlock()
+	if key.Hash == "" {
+		key.Hash = hash.Sha256(secret)
+	}
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+	db.keys[key.Id] = key
+	return key
+}
+
+// addKeys adds n keys to the workspace, for tests that only care how many there are
+func (db *memoryDatabase) addKeys(workspaceId string, n int) {
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("key_%s_%d", workspaceId, len(db.keys))
+		db.addKey(id, entities.Key{Id: id, WorkspaceId: workspaceId})
+	}
+}
+
+// addRootKey adds a root key for the workspace that is limited to scopes
+func (db *memoryDatabase) addRootKey(secret string, workspaceId string, scopes ...string) entities.Key {
+	return db.addKey(secret, entities.Key{Id: "key_root_" + secret, ForWorkspaceId: workspaceId, Scopes: scopes})
+}
+
+// key returns the stored key with the id
+func (db *memoryDatabase) key(id string) (entities.Key, bool) {
+	db.Lock()
+	defer db.Unlock()
+	key, found := db.keys[id]
+	return key, found
+}
+
+func (db *memoryDatabase) workspace(id string) entities.Workspace {
+	db.Lock()
+	defer db.Unlock()
+	return db.workspaces[id]
+}
+
+func (db *memoryDatabase) api(id string) entities.Api {
+	db.Lock()
+	defer db.Unlock()
+	return db.apis[id]
+}
+
+func (db *memoryDatabase) callsOf(method string) int {
+	db.Lock()
+	defer db.Unlock()
+	return db.calls[method]
+}
+
+// fail makes every call of the method return err, nil makes it succeed again
+func (db *memoryDatabase) fail(method string, err error) {
+	db.Lock()
+	defer db.Unlock()
+	db.failures[method] = err
+}
+
+// enter counts a call of the method and returns the failure injected for it, the lock is held on success
+func (db *memoryDatabase) enter(method string) error {
+	db.Lock()
+	db.calls[method]++
+	err := db.failures[method]
+	if err != nil {
+		db.Unlock()
+	}
+	return err
+}
+
+// sortedKeys returns the keys matching the filter ordered by id
+func (db *memoryDatabase) sortedKeys(match func(k entities.Key) bool) []entities.Key {
+	found := []entities.Key{}
+	for _, k := range db.keys {
+		if match(k) {
+			found = append(found, k)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Id < found[j].Id })
+	return found
+}
+
+// keyByHash also finds rerolled keys by their previous hash, like the real database
+func (db *memoryDatabase) keyByHash(h string) (entities.Key, bool) {
+	for _, k := range db.keys {
+		if k.Hash == h {
+			return k, true
+		}
+	}
+	for _, k := range db.keys {
+		if k.PreviousHash == h && k.PreviousHashExpires.After(time.Now()) {
+			return k, true
+		}
+	}
+	return entities.Key{}, false
+}
+
+func (db *memoryDatabase) apiByKeyAuthId(keyAuthId string) (entities.Api, bool) {
+	for _, api := range db.apis {
+		if api.KeyAuthId != "" && api.KeyAuthId == keyAuthId {
+			return api, true
+		}
+	}
+	return entities.Api{}, false
+}
+
+func (db *memoryDatabase) insertKey(newKey entities.Key) error {
+	if _, taken := db.keys[newKey.Id]; taken {
+		return fmt.Errorf("unable to insert key %s: %w", newKey.Id, database.ErrNotUnique)
+	}
+	if _, taken := db.keyByHash(newKey.Hash); taken {
+		return fmt.Errorf("unable to insert key %s: %w", newKey.Id, database.ErrNotUnique)
+	}
+	db.keys[newKey.Id] = newKey
+	db.created = append(db.created, newKey)
+	return nil
+}
+
+func (db *memoryDatabase) CreateApi(ctx context.Context, newApi entities.Api) error {
+	if err := db.enter("CreateApi"); err != nil {
+		return err
+	}
+	defer db.Unlock()
+	db.apis[newApi.Id] = newApi
+	return nil
+}
+
+func (db *memoryDatabase) CreateApiWithKeyAuth(ctx context.Context, newApi entities.Api, newKeyAuth entities.KeyAuth) error {
+	if err := db.enter("CreateApiWithKeyAuth"); err != nil {
+		return err
+	}
+	defer db.Unlock()
+	if newApi.KeyAuthId != newKeyAuth.Id {
+		return fmt.Errorf("api %s does not reference keyAuth %s", newApi.Id, newKeyAuth.Id)
+	}
+	db.keyAuths[newKeyAuth.Id] = newKeyAuth
+	db.apis[newApi.Id] = newApi
+	return nil
+}
+
+func (db *memoryDatabase) GetApi(ctx context.Context, apiId string) (entities.Api, error) {
+	if err := db.enter("GetApi"); err != nil {
+		return entities.Api{}, err
+	}
+	defer db.Unlock()
+	api, found := db.apis[apiId]
+	if !found {
+		return entities.Api{}, database.ErrNotFound
+	}
+	return api, nil
+}
+
+func (db *memoryDatabase) SetApiMetaSchema(ctx context.Context, apiId string, schema string) error {
+	if err := db.enter("SetApiMetaSchema"); err != nil {
+		return err
+	}
+	defer db.Unlock()
+	if api, found := db.apis[apiId]; found {
+		api.MetaSchema = schema
+		db.apis[apiId] = api
+	}
+	return nil
+}
+
+func (db *memoryDatabase) SetApiAllowedMetaKeys(ctx context.Context, apiId string, keys []string) error {
+	if err := db.enter("SetApiAllowedMetaKeys"); err != nil {
+		return err
+	}
+	defer db.Unlock()
+	if api, found := db.apis[apiId]; found {
+		api.AllowedMetaKeys = keys
+		db.apis[apiId] = api
+	}
+	return nil
+}
+
+func (db *memoryDatabase) GetApiByKeyAuthId(ctx context.Context, keyAuthId string) (entities.Api, error) {
+	if err := db.enter("GetApiByKeyAuthId"); err != nil {
+		return entities.Api{}, err
+	}
+	defer db.Unlock()
+	api, found := db.apiByKeyAuthId(keyAuthId)
+	if !found {
+		return entities.Api{}, database.ErrNotFound
+	}
+	return api, nil
+}
+
+func (db *memoryDatabase) CreateKey(ctx context.Context, newKey entities.Key) error {
+	if err := db.enter("CreateKey"); err != nil {
+		return err
+	}
+	defer db.Unlock()
+	return db.insertKey(newKey)
+}
+
+func (db *memoryDatabase) CreateKeys(ctx context.Context, newKeys []entities.Key) error {
+	if err := db.enter("CreateKeys"); err != nil {
+		return err
+	}
+	defer db.Unlock()
+	keys, created := cloneMap(db.keys), len(db.created)
+	for _, newKey := range newKeys {
+		err := db.insertKey(newKey)
+		if err != nil {
+			db.keys, db.created = keys, db.created[:created]
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *memoryDatabase) UpdateKey(ctx context.Context, key entities.Key) error {
+	if err := db.enter("UpdateKey"); err != nil {
+		return err
+	}
+	defer db.Unlock()
+	stored, found := db.keys[key.Id]
+	if !found {
+		return nil
+	}
+	// like the real UPDATE, these columns are left alone
+	key.SuspendedAt = stored.SuspendedAt
+	key.Scopes = stored.Scopes
+	key.LastUsedAt = stored.LastUsedAt
+	key.DisableOnDepletion = stored.DisableOnDepletion
+	key.ParentKeyId = stored.ParentKeyId
+	key.Format = stored.Format
+	db.keys[key.Id] = key
+	return nil
+}
+
+func (db *memoryDatabase) UpdateKeySecret(ctx context.Context, key entities.Key) error {
+	if err := db.enter("UpdateKeySecret"); err != nil {
+		return err
+	}
+	defer db.Unlock()
+	stored, found := db.keys[key.Id]
+	if !found {
+		return nil
+	}
+	stored.Hash = key.Hash
+	stored.Start = key.Start
+	stored.PreviousHash = key.PreviousHash
+	stored.PreviousHashExpires = key.PreviousHashExpires
+	stored.Encrypted = key.Encrypted
+	db.keys[key.Id] = stored
+	return nil
+}
+
+func (db *memoryDatabase) UpdateKeyMeta(ctx context.Context, keyId string, meta map[string]any) error {
+	if err := db.enter("UpdateKeyMeta"); err != nil {
+		return err
+	}
+	defer db.Unlock()
+	if key, found := db.keys[keyId]; found {
+		key.Meta = meta
+		db.keys[keyId] = key
+	}
+	return nil
+}
+
+func (db *memoryDatabase) SetKeyEnabled(ctx context.Context, keyId string, enabled bool) error {
+	if err := db.enter("SetKeyEnabled"); err != nil {
+		return err
+	}
+	defer db.Unlock()
+	if key, found := db.keys[keyId]; found {
+		key.SuspendedAt = time.Time{}
+		if !enabled {
+			key.SuspendedAt = time.Now()
+		}
+		db.keys[keyId] = key
+	}
+	return nil
+}
+
+func (db *memoryDatabase) TouchKeyLastUsed(ctx context.Context, keyId string, ts time.Time) error {
+	if err := db.enter("TouchKeyLastUsed"); err != nil {
+		return err
+	}
+	defer db.Unlock()
+	if key, found := db.keys[keyId]; found && key.LastUsedAt.Before(ts) {
+		key.LastUsedAt = ts
+		db.keys[keyId] = key
+	}
+	return nil
+}
+
+func (db *memoryDatabase) SetKeysEnabled(ctx context.Context, keyIds []string, enabled bool) (int, error) {
+	if err := db.enter("SetKeysEnabled"); err != nil {
+		return 0, err
+	}
+	defer db.Unlock()
+	changed := 0
+	for _, keyId := range keyIds {
+		key, found := db.keys[keyId]
+		// only keys in the other state change
+		if !found || key.SuspendedAt.IsZero() == enabled {
+			continue
+		}
+		key.SuspendedAt = time.Time{}
+		if !enabled {
+			key.SuspendedAt = time.Now()
+		}
+		db.keys[keyId] = key
+		changed++
+	}
+	return changed, nil
+}
+
+func (db *memoryDatabase) DeleteKey(ctx context.Context, keyId string) error {
+	if err := db.enter("DeleteKey"); err != nil {
+		return err
+	}
+	defer db.Unlock()
+	delete(db.keys, keyId)
+	return nil
+}
+
+// hasPrefix matches keys created with the prefix and the default number of start characters
+func hasPrefix(k entities.Key, prefix string) bool {
+	return strings.HasPrefix(k.Start, prefix+keys.Separator) && len(k.Start) == keys.StartLength(prefix, keys.DefaultStartChars)
+}
+
+func (db *memoryDatabase) DeleteKeysByPrefix(ctx context.Context, keyAuthId string, prefix string) (int, error) {
+	if err := db.enter("DeleteKeysByPrefix"); err != nil {
+		return 0, err
+	}
+	defer db.Unlock()
+	deleted := 0
+	for id, k := range db.keys {
+		if k.KeyAuthId == keyAuthId && hasPrefix(k, prefix) {
+			delete(db.keys, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (db *memoryDatabase) ReEncryptKeys(ctx context.Context, batchSize int) (int, error) {
+	return 0, errors.New("no keyring configured")
+}
+
+func (db *memoryDatabase) RecomputeKeyStarts(ctx context.Context, batchSize int) (int, int, error) {
+	return 0, 0, errors.New("no keyring configured")
+}
+
+// MigrateRatelimits has nothing to migrate, there are no old ratelimit columns in memory
+func (db *memoryDatabase) MigrateRatelimits(ctx context.Context, batchSize int) (int, error) {
+	return 0, nil
+}
+
+func (db *memoryDatabase) GetKeyByHash(ctx context.Context, h string) (entities.Key, error) {
+	if err := db.enter("GetKeyByHash"); err != nil {
+		return entities.Key{}, err
+	}
+	defer db.Unlock()
+	key, found := db.keyByHash(h)
+	if !found {
+		return entities.Key{}, database.ErrNotFound
+	}
+	return key, nil
+}
+
+func (db *memoryDatabase) GetKeysByHashes(ctx context.Context, hashes []string) (map[string]entities.Key, error) {
+	if err := db.enter("GetKeysByHashes"); err != nil {
+		return nil, err
+	}
+	defer db.Unlock()
+	found := map[string]entities.Key{}
+	for _, h := range hashes {
+		if key, ok := db.keyByHash(h); ok {
+			found[h] = key
+		}
+	}
+	return found, nil
+}
+
+func (db *memoryDatabase) GetKeyAndApiByHash(ctx context.Context, h string) (entities.Key, entities.Api, error) {
+	if err := db.enter("GetKeyAndApiByHash"); err != nil {
+		return entities.Key{}, entities.Api{}, err
+	}
+	defer db.Unlock()
+	key, found := db.keyByHash(h)
+	if !found {
+		return entities.Key{}, entities.Api{}, database.ErrNotFound
+	}
+	api, found := db.apiByKeyAuthId(key.KeyAuthId)
+	if !found {
+		return entities.Key{}, entities.Api{}, database.ErrNotFound
+	}
+	return key, api, nil
+}
+
+func (db *memoryDatabase) GetKeyById(ctx context.Context, keyId string) (entities.Key, error) {
+	if err := db.enter("GetKeyById"); err != nil {
+		return entities.Key{}, err
+	}
+	defer db.Unlock()
+	key, found := db.keys[keyId]
+	if !found {
+		return entities.Key{}, database.ErrNotFound
+	}
+	return key, nil
+}
+
+func (db *memoryDatabase) CountKeys(ctx context.Context, keyAuthId string) (int, error) {
+	if err := db.enter("CountKeys"); err != nil {
+		return 0, err
+	}
+	defer db.Unlock()
+	return len(db.sortedKeys(func(k entities.Key) bool { return k.KeyAuthId == keyAuthId })), nil
+}
+
+func (db *memoryDatabase) CountKeysByWorkspace(ctx context.Context, workspaceId string) (int, error) {
+	if err := db.enter("CountKeysByWorkspace"); err != nil {
+		return 0, err
+	}
+	defer db.Unlock()
+	return len(db.sortedKeys(func(k entities.Key) bool { return k.WorkspaceId == workspaceId })), nil
+}
+
+func expiresBetween(k entities.Key, from time.Time, to time.Time) bool {
+	return !k.Expires.IsZero() && k.Expires.After(from) && !k.Expires.After(to)
+}
+
+func (db *memoryDatabase) CountKeysExpiringBetween(ctx context.Context, workspaceId string, from time.Time, to time.Time) (int, error) {
+	if err := db.enter("CountKeysExpiringBetween"); err != nil {
+		return 0, err
+	}
+	defer db.Unlock()
+	return len(db.sortedKeys(func(k entities.Key) bool {
+		return k.WorkspaceId == workspaceId && expiresBetween(k, from, to)
+	})), nil
+}
+
+func (db *memoryDatabase) CountApisByWorkspace(ctx context.Context, workspaceId string) (int, error) {
+	if err := db.enter("CountApisByWorkspace"); err != nil {
+		return 0, err
+	}
+	defer db.Unlock()
+	count := 0
+	for _, api := range db.apis {
+		if api.WorkspaceId == workspaceId {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// page returns keys[offset:offset+limit], or less at the end
+func page(keys []entities.Key, limit int, offset int) []entities.Key {
+	if offset >= len(keys) {
+		return []entities.Key{}
+	}
+	keys = keys[offset:]
+	if limit < len(keys) {
+		keys = keys[:limit]
+	}
+	return keys
+}
+
+func (db *memoryDatabase) ListKeysByKeyAuthId(ctx context.Context, keyAuthId string, limit int, offset int, ownerId string) ([]entities.Key, int, error) {
+	if err := db.enter("ListKeysByKeyAuthId"); err != nil {
+		return nil, 0, err
+	}
+	defer db.Unlock()
+	found := db.sortedKeys(func(k entities.Key) bool {
+		return k.KeyAuthId == keyAuthId && (ownerId == "" || k.OwnerId == ownerId)
+	})
+	sort.SliceStable(found, func(i, j int) bool { return found[i].CreatedAt.Before(found[j].CreatedAt) })
+	return page(found, limit, offset), len(found), nil
+}
+
+func (db *memoryDatabase) ListKeysByOwnerId(ctx context.Context, workspaceId string, ownerId string) ([]entities.Key, error) {
+	if err := db.enter("ListKeysByOwnerId"); err != nil {
+		return nil, err
+	}
+	defer db.Unlock()
+	found := db.sortedKeys(func(k entities.Key) bool { return k.WorkspaceId == workspaceId && k.OwnerId == ownerId })
+	sort.SliceStable(found, func(i, j int) bool { return found[i].CreatedAt.Before(found[j].CreatedAt) })
+	return found, nil
+}
+
+// withoutHash clears the secrets, like queries that never select them
+func withoutHash(keys []entities.Key) []entities.Key {
+	for i := range keys {
+		keys[i].Hash = ""
+		keys[i].PreviousHash = ""
+		keys[i].Encrypted = ""
+	}
+	return keys
+}
+
+func (db *memoryDatabase) SearchKeys(ctx context.Context, keyAuthId string, query string, limit int) ([]entities.Key, error) {
+	if err := db.enter("SearchKeys"); err != nil {
+		return nil, err
+	}
+	defer db.Unlock()
+	found := db.sortedKeys(func(k entities.Key) bool {
+		return k.KeyAuthId == keyAuthId && (strings.HasPrefix(k.Start, query) || strings.Contains(k.Name, query))
+	})
+	return withoutHash(page(found, limit, 0)), nil
+}
+
+func (db *memoryDatabase) ListKeysByWorkspaceId(ctx context.Context, workspaceId string, afterId string, limit int) ([]entities.Key, error) {
+	if err := db.enter("ListKeysByWorkspaceId"); err != nil {
+		return nil, err
+	}
+	defer db.Unlock()
+	found := db.sortedKeys(func(k entities.Key) bool { return k.WorkspaceId == workspaceId && k.Id > afterId })
+	return withoutHash(page(found, limit, 0)), nil
+}
+
+func (db *memoryDatabase) ListKeysExpiringBetween(ctx context.Context, keyAuthId string, from time.Time, to time.Time, limit int, offset int) ([]entities.Key, error) {
+	if err := db.enter("ListKeysExpiringBetween"); err != nil {
+		return nil, err
+	}
+	defer db.Unlock()
+	found := db.sortedKeys(func(k entities.Key) bool { return k.KeyAuthId == keyAuthId && expiresBetween(k, from, to) })
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Expires.Before(found[j].Expires) })
+	return page(found, limit, offset), nil
+}
+
+func (db *memoryDatabase) ListKeysByPrefix(ctx context.Context, keyAuthId string, prefix string) ([]entities.Key, error) {
+	if err := db.enter("ListKeysByPrefix"); err != nil {
+		return nil, err
+	}
+	defer db.Unlock()
+	return db.sortedKeys(func(k entities.Key) bool { return k.KeyAuthId == keyAuthId && hasPrefix(k, prefix) }), nil
+}
+
+func (db *memoryDatabase) TransferKeysOwner(ctx context.Context, workspaceId, fromOwnerId, toOwnerId string) ([]entities.Key, error) {
+	if err := db.enter("TransferKeysOwner"); err != nil {
+		return nil, err
+	}
+	defer db.Unlock()
+	moved := db.sortedKeys(func(k entities.Key) bool { return k.WorkspaceId == workspaceId && k.OwnerId == fromOwnerId })
+	for i := range moved {
+		moved[i].OwnerId = toOwnerId
+		db.keys[moved[i].Id] = moved[i]
+	}
+	return moved, nil
+}
+
+func (db *memoryDatabase) CreateWorkspace(ctx context.Context, newWorkspace entities.Workspace) error {
+	if err := db.enter("CreateWorkspace"); err != nil {
+		return err
+	}
+	defer db.Unlock()
+	db.workspaces[newWorkspace.Id] = newWorkspace
+	return nil
+}
+
+func (db *memoryDatabase) CreateKeyAuth(ctx context.Context, newKeyAuth entities.KeyAuth) error {
+	if err := db.enter("CreateKeyAuth"); err != nil {
+		return err
+	}
+	defer db.Unlock()
+	db.keyAuths[newKeyAuth.Id] = newKeyAuth
+	return nil
+}
+
+func (db *memoryDatabase) GetKeyAuth(ctx context.Context, keyAuthId string) (entities.KeyAuth, error) {
+	if err := db.enter("GetKeyAuth"); err != nil {
+		return entities.KeyAuth{}, err
+	}
+	defer db.Unlock()
+	keyAuth, found := db.keyAuths[keyAuthId]
+	if !found {
+		return entities.KeyAuth{}, database.ErrNotFound
+	}
+	return keyAuth, nil
+}
+
+// GetWorkspace does not return ErrNotFound for missing workspaces, neither does the real database
+func (db *memoryDatabase) GetWorkspace(ctx context.Context, workspaceId string) (entities.Workspace, error) {
+	if err := db.enter("GetWorkspace"); err != nil {
+		return entities.Workspace{}, err
+	}
+	defer db.Unlock()
+	workspace, found := db.workspaces[workspaceId]
+	if !found {
+		return entities.Workspace{}, fmt.Errorf("unable to find workspace %s in db", workspaceId)
+	}
+	return workspace, nil
+}
+
+// updateWorkspace changes a stored workspace, missing ones are ignored like by an UPDATE
+func (db *memoryDatabase) updateWorkspace(method string, workspaceId string, update func(w *entities.Workspace)) error {
+	if err := db.enter(method); err != nil {
+		return err
+	}
+	defer db.Unlock()
+	if workspace, found := db.workspaces[workspaceId]; found {
+		update(&workspace)
+		db.workspaces[workspaceId] = workspace
+	}
+	return nil
+}
+
+func (db *memoryDatabase) SetWorkspaceEnabled(ctx context.Context, workspaceId string, enabled bool) error {
+	return db.updateWorkspace("SetWorkspaceEnabled", workspaceId, func(w *entities.Workspace) {
+		w.SuspendedAt = time.Time{}
+		if !enabled {
+			w.SuspendedAt = time.Now()
+		}
+	})
+}
+
+func (db *memoryDatabase) SetWorkspaceHideKeyStart(ctx context.Context, workspaceId string, hide bool) error {
+	return db.updateWorkspace("SetWorkspaceHideKeyStart", workspaceId, func(w *entities.Workspace) { w.HideKeyStart = hide })
+}
+
+func (db *memoryDatabase) SetWorkspaceOmitKeyStart(ctx context.Context, workspaceId string, omit bool) error {
+	return db.updateWorkspace("SetWorkspaceOmitKeyStart", workspaceId, func(w *entities.Workspace) { w.OmitKeyStart = omit })
+}
+
+// consume takes cost verifications from a stored key with a remaining limit, all of them or none
+func (db *memoryDatabase) consume(key entities.Key, cost int64) (entities.Key, bool) {
+	if !key.Remaining.Enabled || key.Remaining.Remaining < cost {
+		return key, false
+	}
+	key.Remaining.Remaining -= cost
+	db.consumed++
+	if key.Remaining.Remaining == 0 && key.DisableOnDepletion && key.SuspendedAt.IsZero() {
+		key.SuspendedAt = time.Now()
+	}
+	db.keys[key.Id] = key
+	return key, true
+}
+
+func (db *memoryDatabase) DecrementRemainingKeyUsage(ctx context.Context, keyId string, cost int64) (int64, bool, error) {
+	if err := db.enter("DecrementRemainingKeyUsage"); err != nil {
+		return 0, false, err
+	}
+	defer db.Unlock()
+	if cost < 1 {
+		return 0, false, fmt.Errorf("cost must be at least 1, got %d", cost)
+	}
+	key, found := db.keys[keyId]
+	if !found {
+		return 0, false, database.ErrNotFound
+	}
+	if !key.Remaining.Enabled {
+		return 0, false, fmt.Errorf("key %s does not have a remaining config", keyId)
+	}
+	key, consumed := db.consume(key, cost)
+	return key.Remaining.Remaining, consumed, nil
+}
+
+func (db *memoryDatabase) VerifyAndConsume(ctx context.Context, h string, cost int64) (entities.Key, int64, bool, error) {
+	if err := db.enter("VerifyAndConsume"); err != nil {
+		return entities.Key{}, 0, false, err
+	}
+	defer db.Unlock()
+	if cost < 1 {
+		return entities.Key{}, 0, false, fmt.Errorf("cost must be at least 1, got %d", cost)
+	}
+	key, found := db.keyByHash(h)
+	if !found {
+		return entities.Key{}, 0, false, database.ErrNotFound
+	}
+	if !key.Remaining.Enabled {
+		return key, 0, false, nil
+	}
+	key, consumed := db.consume(key, cost)
+	return key, key.Remaining.Remaining, consumed, nil
+}
+
+func (db *memoryDatabase) AppendAuditLog(ctx context.Context, entry audit.Entry) error {
+	if err := db.enter("AppendAuditLog"); err != nil {
+		return err
+	}
+	defer db.Unlock()
+	db.auditLogs = append(db.auditLogs, entry)
+	return nil
+}
+
+func hasAction(actions []audit.Action, action audit.Action) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *memoryDatabase) ListAuditLogs(ctx context.Context, workspaceId string, filter audit.Filter) ([]audit.Entry, error) {
+	if err := db.enter("ListAuditLogs"); err != nil {
+		return nil, err
+	}
+	defer db.Unlock()
+	entries := []audit.Entry{}
+	for _, e := range db.auditLogs {
+		if e.WorkspaceId != workspaceId ||
+			(!filter.Start.IsZero() && e.Time.Before(filter.Start)) ||
+			(!filter.End.IsZero() && !e.Time.Before(filter.End)) ||
+			(len(filter.Actions) > 0 && !hasAction(filter.Actions, e.Action)) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.After(entries[j].Time) })
+	if filter.Limit > 0 && filter.Limit < len(entries) {
+		entries = entries[:filter.Limit]
+	}
+	return entries, nil
+}
+
+// keyHour is the hourly usage bucket of a key, the hour is in unix seconds
+type keyHour struct {
+	keyId string
+	hour  int64
+}
+
+func (db *memoryDatabase) IncrementKeyUsage(ctx context.Context, keyId string, ts time.Time) error {
+	return db.AddKeyUsage(ctx, []usage.Count{{KeyId: keyId, Hour: ts, Count: 1}})
+}
+
+func (db *memoryDatabase) AddKeyUsage(ctx context.Context, counts []usage.Count) error {
+	if err := db.enter("AddKeyUsage"); err != nil {
+		return err
+	}
+	defer db.Unlock()
+	for _, c := range counts {
+		db.usage[keyHour{keyId: c.KeyId, hour: usage.Hour.Truncate(c.Hour).Unix()}] += c.Count
+	}
+	return nil
+}
+
+func (db *memoryDatabase) GetKeyUsage(ctx context.Context, keyId string, from, to time.Time, granularity usage.Granularity) ([]usage.Bucket, error) {
+	if err := db.enter("GetKeyUsage"); err != nil {
+		return nil, err
+	}
+	defer db.Unlock()
+	if granularity != usage.Hour && granularity != usage.Day {
+		return nil, fmt.Errorf("unknown granularity: %s", granularity)
+	}
+	counts := map[time.Time]int64{}
+	for c, count := range db.usage {
+		hour := time.Unix(c.hour, 0).UTC()
+		if c.keyId != keyId || hour.Before(from) || !hour.Before(to) {
+			continue
+		}
+		counts[granularity.Truncate(hour)] += count
+	}
+	buckets := []usage.Bucket{}
+	for ts, count := range counts {
+		buckets = append(buckets, usage.Bucket{Time: ts, Count: count})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Time.Before(buckets[j].Time) })
+	return buckets, nil
+}
+
+func (db *memoryDatabase) CreateWebhook(ctx context.Context, endpoint webhooks.Endpoint) error {
+	if err := db.enter("CreateWebhook"); err != nil {
+		return err
+	}
+	defer db.Unlock()
+	db.webhooks = append(db.webhooks, endpoint)
+	return nil
+}
+
+func (db *memoryDatabase) ListWebhooks(ctx context.Context, workspaceId string) ([]webhooks.Endpoint, error) {
+	if err := db.enter("ListWebhooks"); err != nil {
+		return nil, err
+	}
+	defer db.Unlock()
+	endpoints := []webhooks.Endpoint{}
+	for _, e := range db.webhooks {
+		if e.WorkspaceId == workspaceId {
+			endpoints = append(endpoints, e)
+		}
+	}
+	return endpoints, nil
+}
+
+func (db *memoryDatabase) DeleteWebhook(ctx context.Context, workspaceId, webhookId string) error {
+	if err := db.enter("DeleteWebhook"); err != nil {
+		return err
+	}
+	defer db.Unlock()
+	for i, e := range db.webhooks {
+		if e.Id == webhookId && e.WorkspaceId == workspaceId {
+			db.webhooks = append(db.webhooks[:i], db.webhooks[i+1:]...)
+			return nil
+		}
+	}
+	return database.ErrNotFound
+}
+
+// memorySnapshot is everything WithTx restores on a rollback
+type memorySnapshot struct {
+	workspaces map[string]entities.Workspace
+	apis       map[string]entities.Api
+	keyAuths   map[string]entities.KeyAuth
+	keys       map[string]entities.Key
+	webhooks   []webhooks.Endpoint
+	created    []entities.Key
+	auditLogs  []audit.Entry
+}
+
+// keysByHashes is GetKeysByHashes for fakes that only implement GetKeyByHash
+func keysByHashes(ctx context.Context, hashes []string, getKeyByHash func(ctx context.Context, hash string) (entities.Key, error)) (map[string]entities.Key, error) {
+	found := map[string]entities.Key{}
+	for _, h := range hashes {
+		key, err := getKeyByHash(ctx, h)
+		if errors.Is(err, database.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found[h] = key
+	}
+	return found, nil
+}
+
+func cloneMap[V any](m map[string]V) map[string]V {
+	cloned := make(map[string]V, len(m))
+	for k, v := range m {
+		cloned[k] = v
+	}
+	return cloned
+}
+
+func (db *memoryDatabase) snapshot() memorySnapshot {
+	db.Lock()
+	defer db.Unlock()
+	return memorySnapshot{
+		workspaces: cloneMap(db.workspaces),
+		apis:       cloneMap(db.apis),
+		keyAuths:   cloneMap(db.keyAuths),
+		keys:       cloneMap(db.keys),
+		webhooks:   append([]webhooks.Endpoint{}, db.webhooks...),
+		created:    append([]entities.Key{}, db.created...),
+		auditLogs:  append([]audit.Entry{}, db.auditLogs...),
+	}
+}
+
+func (db *memoryDatabase) restore(s memorySnapshot) {
+	db.Lock()
+	defer db.Unlock()
+	db.workspaces, db.apis, db.keyAuths, db.keys = s.workspaces, s.apis, s.keyAuths, s.keys
+	db.webhooks, db.created, db.auditLogs = s.webhooks, s.created, s.auditLogs
+}
+
+// WithTx restores everything fn changed if it returns an error or panics. Nothing is isolated
+// from concurrent calls, the tests that run transactions do not need it.
+func (db *memoryDatabase) WithTx(ctx context.Context, fn func(tx database.Database) error) (err error) {
+	if err := db.enter("WithTx"); err != nil {
+		return err
+	}
+	db.Unlock()
+	before := db.snapshot()
+	defer func() {
+		if r := recover(); r != nil {
+			db.restore(before)
+			panic(r)
+		}
+	}()
+	err = fn(db)
+	if err != nil {
+		db.restore(before)
+	}
+	return err
+}
+
+func (db *memoryDatabase) Ping(ctx context.Context) error {
+	if err := db.enter("Ping"); err != nil {
+		return err
+	}
+	defer db.Unlock()
+	return nil
+}
+
+func (db *memoryDatabase) Stats() map[string]sql.DBStats {
+	return map[string]sql.DBStats{}
+}
+
+func (db *memoryDatabase) Close() error {
+	if err := db.enter("Close"); err != nil {
+		return err
+	}
+	defer db.Unlock()
+	return nil
+}
+
+var _ database.Database = (*memoryDatabase)(nil)
+
+// withDatabase makes newTestServer use db instead of a newMemoryDatabase
+func withDatabase(db database.Database) func(config *Config) {
+	return func(config *Config) {
+		config.Database = db
+	}
+}
+
+// newTestServer returns a server with noop caches, logger and tracer on a newMemoryDatabase,
+// opts change the config before the server is created
+func newTestServer(t testing.TB, opts ...func(config *Config)) *Server {
+	t.Helper()
+	config := Config{
+		Logger:   logging.NewNoopLogger(),
+		KeyCache: cache.NewNoopCache[entities.Key](),
+		ApiCache: cache.NewNoopCache[entities.Api](),
+		Database: newMemoryDatabase(),
+		Tracer:   tracing.NewNoop(),
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return New(config)
+}
+
+func TestMemoryDatabase_WithTxRollsBack(t *testing.T) {
+	ctx := context.Background()
+	db := newMemoryDatabase()
+	failed := errors.New("failed")
+
+	err := db.WithTx(ctx, func(tx database.Database) error {
+		require.NoError(t, tx.CreateKey(ctx, entities.Key{Id: "key_1", KeyAuthId: testKeyAuthId, WorkspaceId: testWorkspaceId}))
+		require.NoError(t, tx.DeleteKey(ctx, testRootKeyId))
+		require.NoError(t, tx.AppendAuditLog(ctx, audit.Entry{WorkspaceId: testWorkspaceId, Action: audit.KeyCreated}))
+		return failed
+	})
+	require.ErrorIs(t, err, failed)
+	_, found := db.key("key_1")
+	require.False(t, found)
+	_, found = db.key(testRootKeyId)
+	require.True(t, found)
+	require.Empty(t, db.created)
+	require.Empty(t, db.auditLogs)
+
+	require.Panics(t, func() {
+		_ = db.WithTx(ctx, func(tx database.Database) error {
+			require.NoError(t, tx.CreateKey(ctx, entities.Key{Id: "key_1", KeyAuthId: testKeyAuthId, WorkspaceId: testWorkspaceId}))
+			panic("failed")
+		})
+	})
+	require.Empty(t, db.created)
+
+	err = db.WithTx(ctx, func(tx database.Database) error {
+		return tx.CreateKey(ctx, entities.Key{Id: "key_1", KeyAuthId: testKeyAuthId, WorkspaceId: testWorkspaceId})
+	})
+	require.NoError(t, err)
+	_, found = db.key("key_1")
+	require.True(t, found)
+}
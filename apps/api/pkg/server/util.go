@@ -1,22 +1,141 @@
 package server
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
 	"strings"
+	"unicode"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/keys"
+	"go.uber.org/zap"
 )
 
-// Return the hash of the key used for authentication
-func getKeyHash(header string) (string, error) {
-	if header == "" {
-		return "", fiber.NewError(fiber.StatusUnauthorized)
+// Return the hashes the key used for authentication may be stored under, see keyByHashes
+func (s *Server) getKeyHashes(key string) ([]string, error) {
+	key, err := normalizeKey(key)
+	if err != nil {
+		return nil, err
 	}
+	return s.hasher.Candidates(key), nil
+}
+
+// normalizeKey undoes what happens to keys when they are copied around: surrounding whitespace
+// and a "Bearer " in front are removed, otherwise the hash would not match and the key is just not found.
+// Keys never contain whitespace, a key that still does was mangled and is rejected with a message saying so.
+// A blank key is a missing key, unauthorized like a request without one.
+func normalizeKey(key string) (string, error) {
+	key = strings.TrimSpace(key)
+	if scheme, rest, hasScheme := strings.Cut(key, " "); hasScheme && strings.EqualFold(scheme, "Bearer") {
+		key = strings.TrimSpace(rest)
+	}
+	if key == "" || strings.EqualFold(key, "Bearer") {
+		return "", errs.NewUnauthorized("missing key")
+	}
+	if strings.IndexFunc(key, unicode.IsSpace) >= 0 {
+		return "", errs.NewBadRequest("key must not contain whitespace, it may have been copied incorrectly")
+	}
+	return key, nil
+}
+
+// authenticateRootKey loads the root key from the Authorization header.
+// The returned key's ForWorkspaceId is the workspace the caller acts on.
+func (s *Server) authenticateRootKey(ctx context.Context, c *fiber.Ctx) (entities.Key, error) {
+	authHashes, err := s.requestKeyHashes(c)
+	if err != nil {
+		return entities.Key{}, err
+	}
+	return s.authenticateRootKeyHashes(ctx, authHashes)
+}
 
-	key := strings.TrimPrefix(header, "Bearer ")
-	if key == "" {
-		return "", fiber.NewError(fiber.StatusUnauthorized)
+// authenticateRootKeyHeader is authenticateRootKey for transports other than http.
+// The header has the same format as the Authorization header: "Bearer <key>".
+func (s *Server) authenticateRootKeyHeader(ctx context.Context, header string) (entities.Key, error) {
+	key, err := parseKeyHeaders(header, "")
+	if err != nil {
+		return entities.Key{}, err
 	}
-	return hash.Sha256(key), nil
+	return s.authenticateRootKeyHashes(ctx, s.hasher.Candidates(key))
+}
+
+func (s *Server) authenticateRootKeyHashes(ctx context.Context, authHashes []string) (entities.Key, error) {
+
+	authKey, _, err := s.keyByHashes(ctx, authHashes)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return entities.Key{}, errs.NewUnauthorized("unauthorized")
+		}
+		return entities.Key{}, errs.NewInternal(err, "unable to find key")
+	}
+
+	if authKey.ForWorkspaceId == "" {
+		return entities.Key{}, errs.NewBadRequest("wrong key type")
+	}
+	if !authKey.SuspendedAt.IsZero() {
+		return entities.Key{}, errs.NewUnauthorized("unauthorized")
+	}
+	return authKey, nil
+}
 
+// requireScope rejects root keys that were not granted scope.
+func requireScope(authKey entities.Key, scope string) error {
+	if !authKey.HasScope(scope) {
+		return errs.NewForbidden(fmt.Sprintf("root key is missing the '%s' scope", scope))
+	}
+	return nil
+}
+
+// authenticateApp checks that the request comes from our own frontend.
+func (s *Server) authenticateApp(c *fiber.Ctx) error {
+	appToken := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+	if s.unkeyAppAuthToken == "" || subtle.ConstantTimeCompare([]byte(s.unkeyAppAuthToken), []byte(appToken)) == 0 {
+		return errs.NewUnauthorized("unauthorized")
+	}
+	return nil
+}
+
+// cachedWorkspace loads a workspace from the cache, or from the database on a miss
+func (s *Server) cachedWorkspace(ctx context.Context, workspaceId string) (entities.Workspace, error) {
+	workspace, isCached := s.workspaceCache.Get(ctx, workspaceId)
+	if isCached {
+		return workspace, nil
+	}
+	workspace, err := s.db.GetWorkspace(ctx, workspaceId)
+	if err != nil {
+		return entities.Workspace{}, err
+	}
+	s.workspaceCache.Set(ctx, workspaceId, workspace)
+	return workspace, nil
+}
+
+// keyStart returns the start shown for a key, nothing if the workspace hides it, see derivedKeyStart
+func (s *Server) keyStart(workspace entities.Workspace, key entities.Key) string {
+	if workspace.HideKeyStart {
+		return ""
+	}
+	return s.derivedKeyStart(key)
+}
+
+// derivedKeyStart returns the stored start of a key. Keys stored without a start, see entities.Workspace.OmitKeyStart,
+// derive it from their secret if they are recoverable. Other keys without a start, or secrets we can not decrypt, have none.
+func (s *Server) derivedKeyStart(key entities.Key) string {
+	if key.Start != "" || key.Encrypted == "" || s.keyring == nil {
+		return key.Start
+	}
+	plaintext, err := s.keyring.Decrypt(key.WorkspaceId, key.Encrypted)
+	if err != nil {
+		s.logger.Warn("unable to decrypt key to derive its start", zap.String("keyId", key.Id), zap.Error(err))
+		return ""
+	}
+	start, err := keys.Start(plaintext, s.keyStartChars)
+	if err != nil {
+		// not created by us, we can not tell where its prefix ends
+		return ""
+	}
+	return start
 }
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+func TestNormalizeKey(t *testing.T) {
+	testCases := []struct {
+		name  string
+		key   string
+		want  string
+		error string
+		code  errs.Code
+	}{
+		{name: "unchanged", key: "test_abc", want: "test_abc"},
+		{name: "leading and trailing whitespace", key: " \ttest_abc\n", want: "test_abc"},
+		{name: "bearer", key: "Bearer test_abc", want: "test_abc"},
+		{name: "lowercase bearer with whitespace", key: "  bearer   test_abc ", want: "test_abc"},
+		{name: "bearer is only a scheme in front", key: "Bearertest_abc", want: "Bearertest_abc"},
+		{name: "blank", key: " \n ", error: "missing key", code: errs.UNAUTHORIZED},
+		{name: "bearer without key", key: "Bearer  ", error: "missing key", code: errs.UNAUTHORIZED},
+		{name: "embedded space", key: "test_ abc", error: "must not contain whitespace", code: errs.BAD_REQUEST},
+		{name: "embedded newline", key: "test_\nabc", error: "must not contain whitespace", code: errs.BAD_REQUEST},
+		{name: "other scheme", key: "Basic test_abc", error: "must not contain whitespace", code: errs.BAD_REQUEST},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			key, err := normalizeKey(tc.key)
+			if tc.error == "" {
+				require.NoError(t, err)
+				require.Equal(t, tc.want, key)
+				return
+			}
+			e, ok := errs.As(err)
+			require.True(t, ok)
+			require.Equal(t, tc.code, e.Code)
+			require.Contains(t, e.Message, tc.error)
+		})
+	}
+}
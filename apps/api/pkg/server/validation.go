@@ -0,0 +1,93 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+// newValidator reports fields by their json name, which is what clients send.
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		switch name {
+		case "-":
+			return ""
+		case "":
+			return field.Name
+		default:
+			return name
+		}
+	})
+	return v
+}
+
+// validationError turns a failed validation into a bad request that lists every invalid field.
+func validationError(err error) *errs.Error {
+	e := errs.NewBadRequest(fmt.Sprintf("unable to validate body: %s", err.Error()))
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return e
+	}
+	fieldErrors := make([]errs.FieldError, len(validationErrors))
+	for i, fe := range validationErrors {
+		fieldErrors[i] = fieldError(fe)
+	}
+	return e.WithFieldErrors(fieldErrors)
+}
+
+func fieldError(fe validator.FieldError) errs.FieldError {
+	// the namespace starts with the name of the request struct
+	field := fe.Namespace()
+	if i := strings.Index(field, "."); i >= 0 {
+		field = field[i+1:]
+	}
+
+	constraint := fe.Tag()
+	if fe.Param() != "" {
+		constraint = fmt.Sprintf("%s=%s", fe.Tag(), fe.Param())
+	}
+
+	var message string
+	switch fe.Tag() {
+	case "required":
+		message = fmt.Sprintf("'%s' is required", field)
+	case "oneof":
+		message = fmt.Sprintf("'%s' must be one of: %s", field, strings.Join(strings.Fields(fe.Param()), ", "))
+	case "gt":
+		message = fmt.Sprintf("'%s' must be greater than %s", field, fe.Param())
+	case "gte":
+		message = fmt.Sprintf("'%s' must be at least %s", field, fe.Param())
+	case "lt":
+		message = fmt.Sprintf("'%s' must be less than %s", field, fe.Param())
+	case "lte":
+		message = fmt.Sprintf("'%s' must be at most %s", field, fe.Param())
+	case "min", "max":
+		bound := "at least"
+		if fe.Tag() == "max" {
+			bound = "at most"
+		}
+		switch fe.Kind() {
+		case reflect.String:
+			message = fmt.Sprintf("'%s' must be %s %s characters long", field, bound, fe.Param())
+		case reflect.Slice, reflect.Map:
+			message = fmt.Sprintf("'%s' must contain %s %s items", field, bound, fe.Param())
+		default:
+			message = fmt.Sprintf("'%s' must be %s %s", field, bound, fe.Param())
+		}
+	default:
+		message = fmt.Sprintf("'%s' violates the '%s' constraint", field, constraint)
+	}
+
+	return errs.FieldError{
+		Field:      field,
+		Constraint: constraint,
+		Message:    message,
+	}
+}
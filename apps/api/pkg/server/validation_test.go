@@ -0,0 +1,36 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+func TestValidationError(t *testing.T) {
+	type nested struct {
+		Tags []string `json:"tags" validate:"max=1"`
+	}
+	type request struct {
+		Name   string `json:"name,omitempty" validate:"max=3"`
+		Limit  int    `validate:"min=1"`
+		Nested nested `json:"nested"`
+	}
+
+	err := newValidator().Struct(request{Name: "toolong", Nested: nested{Tags: []string{"a", "b"}}})
+	require.Error(t, err)
+
+	e := validationError(err)
+	require.Equal(t, errs.BAD_REQUEST, e.Code)
+	require.Equal(t, []errs.FieldError{
+		{Field: "name", Constraint: "max=3", Message: "'name' must be at most 3 characters long"},
+		{Field: "Limit", Constraint: "min=1", Message: "'Limit' must be at least 1"},
+		{Field: "nested.tags", Constraint: "max=1", Message: "'nested.tags' must contain at most 1 items"},
+	}, e.FieldErrors)
+
+	// anything else is still a bad request, without field errors
+	e = validationError(errors.New("boom"))
+	require.Equal(t, errs.BAD_REQUEST, e.Code)
+	require.Empty(t, e.FieldErrors)
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+	"github.com/unkeyed/unkey/apps/api/pkg/webhooks"
+)
+
+// maxWebhooksPerWorkspace bounds how many requests a single event can cause
+const maxWebhooksPerWorkspace = 10
+
+type CreateWebhookRequest struct {
+	Url string `json:"url" validate:"required,url"`
+}
+
+type CreateWebhookResponse struct {
+	WebhookId string `json:"webhookId"`
+	// Secret verifies the signature of deliveries, it is only returned once
+	Secret string `json:"secret"`
+}
+
+func (s *Server) createWebhook(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.createWebhook")
+	defer span.End()
+
+	req := CreateWebhookRequest{}
+	err := c.BodyParser(&req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+	}
+
+	err = s.validator.Struct(req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to validate body: %s", err.Error()))
+	}
+	u, err := url.Parse(req.Url)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return errs.NewBadRequest("'url' must be an https url")
+	}
+
+	authKey, err := s.authenticateRootKey(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	err = requireScope(authKey, entities.ScopeWebhooksManage)
+	if err != nil {
+		return err
+	}
+
+	existing, err := s.db.ListWebhooks(ctx, authKey.ForWorkspaceId)
+	if err != nil {
+		return errs.NewInternal(err, "unable to list webhooks")
+	}
+	if len(existing) >= maxWebhooksPerWorkspace {
+		return errs.New(errs.LIMIT_EXCEEDED, fmt.Sprintf("workspace has reached its limit of %d webhooks", maxWebhooksPerWorkspace))
+	}
+
+	endpoint := webhooks.Endpoint{
+		Id:          uid.Webhook(),
+		WorkspaceId: authKey.ForWorkspaceId,
+		Url:         req.Url,
+		Secret:      webhooks.NewSecret(),
+		CreatedAt:   time.Now(),
+	}
+	err = s.db.CreateWebhook(ctx, endpoint)
+	if err != nil {
+		return errs.NewInternal(err, "unable to create webhook")
+	}
+
+	return c.JSON(CreateWebhookResponse{
+		WebhookId: endpoint.Id,
+		Secret:    endpoint.Secret,
+	})
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/webhooks"
+)
+
+// recordingDispatcher remembers all dispatched events
+type recordingDispatcher struct {
+	sync.Mutex
+	events []webhooks.Event
+}
+
+func (d *recordingDispatcher) Dispatch(event webhooks.Event) {
+	d.Lock()
+	defer d.Unlock()
+	d.events = append(d.events, event)
+}
+
+func (d *recordingDispatcher) Close(ctx context.Context) error {
+	return nil
+}
+
+func TestCreateWebhook(t *testing.T) {
+	db := newMemoryDatabase()
+	srv := newTestServer(t, withDatabase(db))
+
+	testCases := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "missing url", body: `{}`, status: 400},
+		{name: "not a url", body: `{"url":"webhooks"}`, status: 400},
+		{name: "plain http", body: `{"url":"http://example.com/hook"}`, status: 400},
+		{name: "https", body: `{"url":"https://example.com/hook"}`, status: 200},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/webhooks.create", bytes.NewBufferString(tc.body))
+			req.Header.Set("Authorization", "Bearer root_key")
+			req.Header.Set("Content-Type", "application/json")
+
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.status, res.StatusCode)
+		})
+	}
+
+	require.Len(t, db.webhooks, 1)
+	require.Equal(t, "ws_1", db.webhooks[0].WorkspaceId)
+	require.NotEmpty(t, db.webhooks[0].Secret)
+
+	// the secret is never listed
+	req := httptest.NewRequest("GET", "/v1/webhooks.list", nil)
+	req.Header.Set("Authorization", "Bearer root_key")
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.NotContains(t, string(body), db.webhooks[0].Secret)
+
+	listRes := ListWebhooksResponse{}
+	require.NoError(t, json.Unmarshal(body, &listRes))
+	require.Len(t, listRes.Webhooks, 1)
+	require.Equal(t, db.webhooks[0].Id, listRes.Webhooks[0].Id)
+}
+
+func TestCreateWebhook_Limit(t *testing.T) {
+	db := newMemoryDatabase()
+	for i := 0; i < maxWebhooksPerWorkspace; i++ {
+		db.webhooks = append(db.webhooks, webhooks.Endpoint{WorkspaceId: "ws_1"})
+	}
+	srv := newTestServer(t, withDatabase(db))
+
+	req := httptest.NewRequest("POST", "/v1/webhooks.create", bytes.NewBufferString(`{"url":"https://example.com/hook"}`))
+	req.Header.Set("Authorization", "Bearer root_key")
+	req.Header.Set("Content-Type", "application/json")
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 403, res.StatusCode)
+	require.Len(t, db.webhooks, maxWebhooksPerWorkspace)
+}
+
+func TestCreateKey_DispatchesWebhook(t *testing.T) {
+	dispatcher := &recordingDispatcher{}
+	srv := newTestServer(t, func(c *Config) {
+		c.Webhooks = dispatcher
+	})
+
+	req := httptest.NewRequest("POST", "/v1/keys", bytes.NewBufferString(`{"apiId":"api_1","ownerId":"chronark"}`))
+	req.Header.Set("Authorization", "Bearer root_key")
+	req.Header.Set("Content-Type", "application/json")
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 200, res.StatusCode)
+
+	createRes := CreateKeyResponse{}
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &createRes))
+
+	require.Len(t, dispatcher.events, 1)
+	e := dispatcher.events[0]
+	require.Equal(t, webhooks.KeyCreated, e.Type)
+	require.Equal(t, "ws_1", e.WorkspaceId)
+	require.Equal(t, createRes.KeyId, e.Key.Id)
+	require.Equal(t, "chronark", e.Key.OwnerId)
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+type DeleteWebhookRequest struct {
+	WebhookId string `json:"webhookId" validate:"required"`
+}
+
+type DeleteWebhookResponse struct{}
+
+func (s *Server) deleteWebhook(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.deleteWebhook")
+	defer span.End()
+
+	req := DeleteWebhookRequest{}
+	err := c.BodyParser(&req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+	}
+
+	err = s.validator.Struct(req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to validate body: %s", err.Error()))
+	}
+
+	authKey, err := s.authenticateRootKey(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	err = requireScope(authKey, entities.ScopeWebhooksManage)
+	if err != nil {
+		return err
+	}
+
+	// scoped to the workspace, so other workspaces' webhooks are indistinguishable from missing ones
+	err = s.db.DeleteWebhook(ctx, authKey.ForWorkspaceId, req.WebhookId)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return errs.NewNotFound(fmt.Sprintf("unable to find webhook: %s", req.WebhookId))
+		}
+		return errs.NewInternal(err, "unable to delete webhook")
+	}
+
+	return c.JSON(DeleteWebhookResponse{})
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+type webhookResponse struct {
+	Id        string `json:"id"`
+	Url       string `json:"url"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+type ListWebhooksResponse struct {
+	Webhooks []webhookResponse `json:"webhooks"`
+}
+
+func (s *Server) listWebhooks(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.listWebhooks")
+	defer span.End()
+
+	authKey, err := s.authenticateRootKey(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	err = requireScope(authKey, entities.ScopeWebhooksManage)
+	if err != nil {
+		return err
+	}
+
+	endpoints, err := s.db.ListWebhooks(ctx, authKey.ForWorkspaceId)
+	if err != nil {
+		return errs.NewInternal(err, "unable to list webhooks")
+	}
+
+	// secrets are never returned after creation
+	res := ListWebhooksResponse{
+		Webhooks: make([]webhookResponse, len(endpoints)),
+	}
+	for i, e := range endpoints {
+		res.Webhooks[i] = webhookResponse{
+			Id:        e.Id,
+			Url:       e.Url,
+			CreatedAt: e.CreatedAt.UnixMilli(),
+		}
+	}
+	return c.JSON(res)
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+type SetWorkspaceEnabledRequest struct {
+	WorkspaceId string `json:"workspaceId" validate:"required"`
+	Enabled     *bool  `json:"enabled" validate:"required"`
+}
+
+type SetWorkspaceEnabledResponse struct {
+	Enabled bool `json:"enabled"`
+}
+
+// setWorkspaceEnabled suspends or re-enables all keys of a workspace.
+// Only our own frontend may call this, for example when a subscription is cancelled.
+//
+// Other instances keep serving the workspace from their cache until it expires.
+func (s *Server) setWorkspaceEnabled(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.setWorkspaceEnabled")
+	defer span.End()
+
+	err := s.authenticateApp(c)
+	if err != nil {
+		return err
+	}
+
+	req := SetWorkspaceEnabledRequest{}
+	err = c.BodyParser(&req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+	}
+
+	err = s.validator.Struct(req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to validate body: %s", err.Error()))
+	}
+
+	err = s.db.SetWorkspaceEnabled(ctx, req.WorkspaceId, *req.Enabled)
+	if err != nil {
+		return errs.NewInternal(err, "unable to update workspace")
+	}
+	s.workspaceCache.Remove(ctx, req.WorkspaceId)
+
+	return c.JSON(SetWorkspaceEnabledResponse{
+		Enabled: *req.Enabled,
+	})
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+type SetWorkspaceHideKeyStartRequest struct {
+	WorkspaceId  string `json:"workspaceId" validate:"required"`
+	HideKeyStart *bool  `json:"hideKeyStart" validate:"required"`
+}
+
+type SetWorkspaceHideKeyStartResponse struct {
+	HideKeyStart bool `json:"hideKeyStart"`
+}
+
+// setWorkspaceHideKeyStart decides if keys of a workspace are listed and fetched without their start.
+// Only our own frontend may call this, it is a setting of the workspace.
+//
+// Other instances keep serving the workspace from their cache until it expires.
+func (s *Server) setWorkspaceHideKeyStart(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.setWorkspaceHideKeyStart")
+	defer span.End()
+
+	err := s.authenticateApp(c)
+	if err != nil {
+		return err
+	}
+
+	req := SetWorkspaceHideKeyStartRequest{}
+	err = c.BodyParser(&req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+	}
+
+	err = s.validator.Struct(req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to validate body: %s", err.Error()))
+	}
+
+	err = s.db.SetWorkspaceHideKeyStart(ctx, req.WorkspaceId, *req.HideKeyStart)
+	if err != nil {
+		return errs.NewInternal(err, "unable to update workspace")
+	}
+	s.workspaceCache.Remove(ctx, req.WorkspaceId)
+
+	return c.JSON(SetWorkspaceHideKeyStartResponse{
+		HideKeyStart: *req.HideKeyStart,
+	})
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+type SetWorkspaceOmitKeyStartRequest struct {
+	WorkspaceId  string `json:"workspaceId" validate:"required"`
+	OmitKeyStart *bool  `json:"omitKeyStart" validate:"required"`
+}
+
+type SetWorkspaceOmitKeyStartResponse struct {
+	OmitKeyStart bool `json:"omitKeyStart"`
+}
+
+// setWorkspaceOmitKeyStart decides if new keys of a workspace are stored without their start.
+// Only our own frontend may call this, it is a setting of the workspace.
+//
+// Keys that exist already keep their start, turning it off again does not restore the start of
+// keys created while it was on.
+func (s *Server) setWorkspaceOmitKeyStart(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.setWorkspaceOmitKeyStart")
+	defer span.End()
+
+	err := s.authenticateApp(c)
+	if err != nil {
+		return err
+	}
+
+	req := SetWorkspaceOmitKeyStartRequest{}
+	err = c.BodyParser(&req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to parse body: %s", err.Error()))
+	}
+
+	err = s.validator.Struct(req)
+	if err != nil {
+		return errs.NewBadRequest(fmt.Sprintf("unable to validate body: %s", err.Error()))
+	}
+
+	err = s.db.SetWorkspaceOmitKeyStart(ctx, req.WorkspaceId, *req.OmitKeyStart)
+	if err != nil {
+		return errs.NewInternal(err, "unable to update workspace")
+	}
+	s.workspaceCache.Remove(ctx, req.WorkspaceId)
+
+	return c.JSON(SetWorkspaceOmitKeyStartResponse{
+		OmitKeyStart: *req.OmitKeyStart,
+	})
+}
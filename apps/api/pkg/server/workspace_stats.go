@@ -0,0 +1,68 @@
+package server
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// expiringSoonWindow is how far ahead workspace stats look for expiring keys
+const expiringSoonWindow = 7 * 24 * time.Hour
+
+type WorkspaceStatsResponse struct {
+	WorkspaceId string `json:"workspaceId"`
+	Apis        int    `json:"apis"`
+	Keys        int    `json:"keys"`
+	// keys that have not expired yet but will within the next 7 days
+	KeysExpiringThisWeek int `json:"keysExpiringThisWeek"`
+}
+
+// getWorkspaceStats returns totals for dashboards of the workspace the root key belongs to.
+// Everything is counted in the database, no keys are loaded.
+func (s *Server) getWorkspaceStats(c *fiber.Ctx) error {
+	ctx, span := s.tracer.Start(c.UserContext(), "server.getWorkspaceStats")
+	defer span.End()
+
+	authKey, err := s.authenticateRootKey(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	err = requireScope(authKey, entities.ScopeApisRead)
+	if err != nil {
+		return err
+	}
+	err = requireScope(authKey, entities.ScopeKeysRead)
+	if err != nil {
+		return err
+	}
+
+	workspaceId := authKey.ForWorkspaceId
+	span.SetAttributes(attribute.String("workspaceId", workspaceId))
+
+	apis, err := s.db.CountApisByWorkspace(ctx, workspaceId)
+	if err != nil {
+		return errs.NewInternal(err, "unable to count apis")
+	}
+
+	keys, err := s.db.CountKeysByWorkspace(ctx, workspaceId)
+	if err != nil {
+		return errs.NewInternal(err, "unable to count keys")
+	}
+
+	now := time.Now()
+	expiring, err := s.db.CountKeysExpiringBetween(ctx, workspaceId, now, now.Add(expiringSoonWindow))
+	if err != nil {
+		return errs.NewInternal(err, "unable to count expiring keys")
+	}
+
+	return c.JSON(WorkspaceStatsResponse{
+		WorkspaceId:          workspaceId,
+		Apis:                 apis,
+		Keys:                 keys,
+		KeysExpiringThisWeek: expiring,
+	})
+}
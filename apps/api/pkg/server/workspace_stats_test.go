@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+)
+
+func TestGetWorkspaceStats(t *testing.T) {
+	now := time.Now()
+	db := newMemoryDatabase()
+	db.addWorkspace(entities.Workspace{Id: "ws_2"})
+	db.addApi(entities.Api{Id: "api_2", WorkspaceId: "ws_1", AuthType: entities.AuthTypeKey, KeyAuthId: "key_auth_2"})
+	db.addApi(entities.Api{Id: "api_other", WorkspaceId: "ws_2", AuthType: entities.AuthTypeKey, KeyAuthId: "key_auth_other"})
+	for _, key := range []entities.Key{
+		{Id: "key_never", WorkspaceId: "ws_1"},
+		{Id: "key_expired", WorkspaceId: "ws_1", Expires: now.Add(-time.Hour)},
+		{Id: "key_1d", WorkspaceId: "ws_1", Expires: now.Add(24 * time.Hour)},
+		{Id: "key_6d", WorkspaceId: "ws_1", Expires: now.Add(6 * 24 * time.Hour)},
+		{Id: "key_30d", WorkspaceId: "ws_1", Expires: now.Add(30 * 24 * time.Hour)},
+		{Id: "key_other", WorkspaceId: "ws_2", Expires: now.Add(time.Hour)},
+	} {
+		db.addKey(key.Id, key)
+	}
+	srv := newTestServer(t, withDatabase(db))
+
+	req := httptest.NewRequest("GET", "/v1/workspace.stats", nil)
+	req.Header.Set("Authorization", "Bearer root_key")
+	res, err := srv.app.Test(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 200, res.StatusCode)
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	stats := WorkspaceStatsResponse{}
+	require.NoError(t, json.Unmarshal(body, &stats))
+	require.Equal(t, WorkspaceStatsResponse{
+		WorkspaceId:          "ws_1",
+		Apis:                 2,
+		Keys:                 5,
+		KeysExpiringThisWeek: 2,
+	}, stats)
+	// the keys are only counted, never loaded
+	require.Zero(t, db.callsOf("ListKeysByWorkspaceId"))
+	require.Zero(t, db.callsOf("ListKeysExpiringBetween"))
+}
+
+func TestGetWorkspaceStats_Errors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		authorization string
+		scopes        []string
+		status        int
+	}{
+		{name: "missing root key", status: 401},
+		{name: "missing keys scope", authorization: "Bearer scoped_key", scopes: []string{entities.ScopeApisRead}, status: 403},
+		{name: "missing apis scope", authorization: "Bearer scoped_key", scopes: []string{entities.ScopeKeysRead}, status: 403},
+		{name: "implied apis scope", authorization: "Bearer scoped_key", scopes: []string{entities.ScopeApisManage, entities.ScopeKeysRead}, status: 200},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newMemoryDatabase()
+			db.addRootKey("scoped_key", "ws_1", tc.scopes...)
+			srv := newTestServer(t, withDatabase(db))
+
+			req := httptest.NewRequest("GET", "/v1/workspace.stats", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			res, err := srv.app.Test(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.status, res.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+type CreateApiParams struct {
+	Name string
+	// Empty allows requests from every ip
+	IpWhitelist []string
+	// Optional JSON Schema for the meta of the api's keys, see ParseMetaSchema
+	MetaSchema json.RawMessage
+	// Optional top level keys the meta of the api's keys may have, see ParseAllowedMetaKeys
+	AllowedMetaKeys []string
+	// Optional prefix of keys created without one
+	Prefix string
+}
+
+// CreateApi creates an api of the workspace together with its keyAuth, so keys can be created
+// for it right away.
+func (s *Service) CreateApi(ctx context.Context, workspaceId string, params CreateApiParams) (entities.Api, error) {
+	for _, ip := range params.IpWhitelist {
+		if net.ParseIP(ip) == nil {
+			return entities.Api{}, errs.NewBadRequest(fmt.Sprintf("'%s' is not a valid ip address", ip))
+		}
+	}
+
+	metaSchema, err := ParseMetaSchema(params.MetaSchema)
+	if err != nil {
+		return entities.Api{}, err
+	}
+	allowedMetaKeys, err := ParseAllowedMetaKeys(params.AllowedMetaKeys)
+	if err != nil {
+		return entities.Api{}, err
+	}
+
+	_, err = s.db.GetWorkspace(ctx, workspaceId)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return entities.Api{}, errs.NewNotFound(fmt.Sprintf("workspace %s does not exist", workspaceId))
+		}
+		return entities.Api{}, errs.NewInternal(err, "unable to load workspace")
+	}
+
+	keyAuth := entities.KeyAuth{
+		Id:          uid.KeyAuth(),
+		WorkspaceId: workspaceId,
+	}
+	api := entities.Api{
+		Id:              uid.Api(),
+		Name:            params.Name,
+		WorkspaceId:     workspaceId,
+		IpWhitelist:     params.IpWhitelist,
+		AuthType:        entities.AuthTypeKey,
+		KeyAuthId:       keyAuth.Id,
+		MetaSchema:      metaSchema,
+		AllowedMetaKeys: allowedMetaKeys,
+		Prefix:          params.Prefix,
+	}
+
+	err = s.db.CreateApiWithKeyAuth(ctx, api, keyAuth)
+	if err != nil {
+		return entities.Api{}, errs.NewInternal(err, "unable to create api")
+	}
+	return api, nil
+}
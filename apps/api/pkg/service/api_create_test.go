@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+// apiDatabase knows workspace ws_1 and records the apis created in it
+type apiDatabase struct {
+	database.Database
+	apis     []entities.Api
+	keyAuths []entities.KeyAuth
+}
+
+func (db *apiDatabase) GetWorkspace(ctx context.Context, workspaceId string) (entities.Workspace, error) {
+	if workspaceId != "ws_1" {
+		return entities.Workspace{}, database.ErrNotFound
+	}
+	return entities.Workspace{Id: workspaceId}, nil
+}
+
+func (db *apiDatabase) CreateApiWithKeyAuth(ctx context.Context, newApi entities.Api, newKeyAuth entities.KeyAuth) error {
+	db.apis = append(db.apis, newApi)
+	db.keyAuths = append(db.keyAuths, newKeyAuth)
+	return nil
+}
+
+func TestCreateApi(t *testing.T) {
+	db := &apiDatabase{}
+	svc := New(Config{Database: db})
+
+	api, err := svc.CreateApi(context.Background(), "ws_1", CreateApiParams{Name: "my api", IpWhitelist: []string{"1.1.1.1"}})
+	require.NoError(t, err)
+
+	require.Len(t, db.apis, 1)
+	require.Equal(t, api, db.apis[0])
+	require.Equal(t, "ws_1", api.WorkspaceId)
+	require.Equal(t, entities.AuthTypeKey, api.AuthType)
+	require.Equal(t, db.keyAuths[0].Id, api.KeyAuthId)
+	require.Equal(t, "ws_1", db.keyAuths[0].WorkspaceId)
+}
+
+func TestCreateApi_Errors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		workspaceId string
+		params      CreateApiParams
+		code        errs.Code
+	}{
+		{name: "unknown workspace", workspaceId: "ws_2", params: CreateApiParams{Name: "my api"}, code: errs.NOT_FOUND},
+		{name: "invalid ip", workspaceId: "ws_1", params: CreateApiParams{Name: "my api", IpWhitelist: []string{"10.0.0.0/8"}}, code: errs.BAD_REQUEST},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &apiDatabase{}
+			svc := New(Config{Database: db})
+
+			_, err := svc.CreateApi(context.Background(), tc.workspaceId, tc.params)
+			require.Error(t, err)
+			e, ok := errs.As(err)
+			require.True(t, ok)
+			require.Equal(t, tc.code, e.Code)
+			require.Empty(t, db.apis)
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+// ConsumeKey uses up cost of the remaining verifications of the key with the hash.
+// It reports false if fewer were left, or if the key does not limit its verifications.
+func (s *Service) ConsumeKey(ctx context.Context, hash string, cost int64) (bool, error) {
+	_, _, decremented, err := s.db.VerifyAndConsume(ctx, hash, cost)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return false, errs.NewUnauthorized("unauthorized")
+		}
+		return false, errs.NewInternal(err, "unable to use key")
+	}
+	return decremented, nil
+}
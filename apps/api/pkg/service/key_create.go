@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/keys"
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+type CreateKeyParams struct {
+	ApiId      string
+	Prefix     string
+	Name       string
+	ByteLength int
+	Encoding   keys.Encoding
+	Checksum   bool
+	OwnerId    string
+	Meta       map[string]any
+	// Zero means the key never expires
+	Expires time.Time
+	// 0 or negative for unlimited usage
+	Remaining int64
+	// Disable the key when Remaining is used up
+	DisableOnDepletion bool
+	// Optional, see entities.Key.RemainingWarnThreshold
+	RemainingWarnThreshold *int64
+	Ratelimit              *entities.Ratelimit
+	// Stores the secret encrypted, so the key can be recovered
+	Recoverable bool
+	// Optional, the key becomes a child of this key
+	ParentKeyId string
+	// Only run the checks, no key is generated or stored
+	DryRun bool
+}
+
+// CreateKey creates a new key for an api of the workspace.
+// It returns the stored key and the plaintext key, which is never stored and can only be returned once.
+// Dry runs return an empty key and no error if the key could be created.
+func (s *Service) CreateKey(ctx context.Context, workspaceId string, params CreateKeyParams) (entities.Key, string, error) {
+	api, err := s.db.GetApi(ctx, params.ApiId)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return entities.Key{}, "", errs.NewBadRequest("wrong apiId")
+		}
+		return entities.Key{}, "", errs.NewInternal(err, "unable to find api")
+	}
+	if api.WorkspaceId != workspaceId {
+		return entities.Key{}, "", errs.NewUnauthorized("access to workspace denied")
+	}
+
+	if api.AuthType != entities.AuthTypeKey || api.KeyAuthId == "" {
+		return entities.Key{}, "", errs.NewBadRequest("api is not set up to handle key auth")
+	}
+
+	err = s.ValidateMeta(api, params.Meta)
+	if err != nil {
+		return entities.Key{}, "", err
+	}
+
+	err = s.validateParentKey(ctx, api, params.ParentKeyId)
+	if err != nil {
+		return entities.Key{}, "", err
+	}
+
+	workspace, err := s.db.GetWorkspace(ctx, api.WorkspaceId)
+	if err != nil {
+		return entities.Key{}, "", errs.NewInternal(err, "unable to load workspace")
+	}
+
+	if params.Recoverable && s.keyring == nil {
+		return entities.Key{}, "", errs.NewBadRequest("recoverable keys are not enabled")
+	}
+
+	err = s.checkKeyLifetime(workspace, params.Expires, time.Now())
+	if err != nil {
+		return entities.Key{}, "", err
+	}
+
+	err = s.CheckKeyQuota(ctx, workspace, 1)
+	if err != nil {
+		return entities.Key{}, "", err
+	}
+
+	if params.DryRun {
+		return entities.Key{}, "", nil
+	}
+
+	format := &entities.KeyFormat{ByteLength: params.ByteLength, Encoding: string(params.Encoding), Checksum: params.Checksum}
+	if format.Encoding == "" {
+		format.Encoding = string(keys.EncodingBase58)
+	}
+	keyOpts := []keys.Option{keys.WithEncoding(params.Encoding), keys.WithStartChars(s.keyStartChars)}
+	if params.Checksum {
+		keyOpts = append(keyOpts, keys.WithChecksum())
+	}
+	prefix := params.Prefix
+	if prefix == "" {
+		prefix = api.Prefix
+	}
+	keyValue, start, err := keys.NewV1Key(prefix, params.ByteLength, keyOpts...)
+	if err != nil {
+		return entities.Key{}, "", errs.NewInternal(err, "unable to generate key")
+	}
+
+	newKey := entities.Key{
+		Id:          uid.Key(),
+		KeyAuthId:   api.KeyAuthId,
+		WorkspaceId: workspaceId,
+		Name:        params.Name,
+		Hash:        s.hasher.Hash(keyValue),
+		Start:       start,
+		OwnerId:     params.OwnerId,
+		Meta:        params.Meta,
+		CreatedAt:   time.Now(),
+		Expires:     params.Expires,
+		Ratelimit:   params.Ratelimit,
+		ParentKeyId: params.ParentKeyId,
+		Format:      format,
+	}
+	if workspace.OmitKeyStart {
+		// recoverable keys get their start back from their secret when they are read
+		newKey.Start = ""
+	}
+	if params.Remaining > 0 {
+		newKey.Remaining.Enabled = true
+		newKey.Remaining.Remaining = params.Remaining
+		newKey.DisableOnDepletion = params.DisableOnDepletion
+		newKey.RemainingWarnThreshold = params.RemainingWarnThreshold
+	}
+	if params.Recoverable {
+		newKey.Encrypted, err = s.keyring.Encrypt(workspaceId, keyValue)
+		if err != nil {
+			return entities.Key{}, "", errs.NewInternal(err, "unable to encrypt key")
+		}
+	}
+
+	err = s.db.CreateKey(ctx, newKey)
+	if err != nil {
+		return entities.Key{}, "", errs.NewInternal(err, "unable to store key")
+	}
+	return newKey, keyValue, nil
+}
+
+// validateParentKey checks that a new child key may belong to the parent. The parent must be a key of
+// the same api and can not be a child itself, so a verification only ever counts against one parent.
+func (s *Service) validateParentKey(ctx context.Context, api entities.Api, parentKeyId string) error {
+	if parentKeyId == "" {
+		return nil
+	}
+	parent, err := s.db.GetKeyById(ctx, parentKeyId)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return errs.NewBadRequest("wrong parentKeyId")
+		}
+		return errs.NewInternal(err, "unable to find parent key")
+	}
+	if parent.WorkspaceId != api.WorkspaceId || parent.KeyAuthId != api.KeyAuthId {
+		return errs.NewBadRequest("the parent key must belong to the same api")
+	}
+	if parent.ParentKeyId != "" {
+		return errs.NewBadRequest("the parent key is a child key itself, keys can only be nested once")
+	}
+	return nil
+}
+
+// CheckKeyQuota returns an error if creating n more keys would exceed the number of keys the workspace's plan allows
+func (s *Service) CheckKeyQuota(ctx context.Context, workspace entities.Workspace, n int) error {
+	if workspace.MaxKeys <= 0 {
+		return nil
+	}
+
+	count, err := s.db.CountKeysByWorkspace(ctx, workspace.Id)
+	if err != nil {
+		return errs.NewInternal(err, "unable to count keys")
+	}
+	if count+n > workspace.MaxKeys {
+		return errs.New(errs.LIMIT_EXCEEDED, fmt.Sprintf("workspace has reached its limit of %d keys", workspace.MaxKeys))
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/encryption"
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+	"github.com/unkeyed/unkey/apps/api/pkg/keys"
+)
+
+type fakeDatabase struct {
+	database.Database
+	api       entities.Api
+	workspace entities.Workspace
+	count     int
+	created   []entities.Key
+	keys      map[string]entities.Key
+}
+
+func (db *fakeDatabase) GetKeyById(ctx context.Context, keyId string) (entities.Key, error) {
+	key, ok := db.keys[keyId]
+	if !ok {
+		return entities.Key{}, database.ErrNotFound
+	}
+	return key, nil
+}
+
+func (db *fakeDatabase) GetApi(ctx context.Context, apiId string) (entities.Api, error) {
+	if apiId != db.api.Id {
+		return entities.Api{}, database.ErrNotFound
+	}
+	return db.api, nil
+}
+
+func (db *fakeDatabase) GetWorkspace(ctx context.Context, workspaceId string) (entities.Workspace, error) {
+	return db.workspace, nil
+}
+
+func (db *fakeDatabase) CountKeysByWorkspace(ctx context.Context, workspaceId string) (int, error) {
+	return db.count, nil
+}
+
+func (db *fakeDatabase) CreateKey(ctx context.Context, newKey entities.Key) error {
+	db.created = append(db.created, newKey)
+	return nil
+}
+
+func newFakeDatabase() *fakeDatabase {
+	return &fakeDatabase{
+		api:       entities.Api{Id: "api_1", WorkspaceId: "ws_1", AuthType: entities.AuthTypeKey, KeyAuthId: "key_auth_1"},
+		workspace: entities.Workspace{Id: "ws_1"},
+		keys: map[string]entities.Key{
+			"key_parent": {Id: "key_parent", WorkspaceId: "ws_1", KeyAuthId: "key_auth_1"},
+			"key_child":  {Id: "key_child", WorkspaceId: "ws_1", KeyAuthId: "key_auth_1", ParentKeyId: "key_parent"},
+			"key_other":  {Id: "key_other", WorkspaceId: "ws_1", KeyAuthId: "key_auth_2"},
+		},
+	}
+}
+
+func TestCreateKey(t *testing.T) {
+	db := newFakeDatabase()
+	svc := New(Config{Database: db})
+
+	expires := time.Now().Add(time.Hour)
+	key, plaintext, err := svc.CreateKey(context.Background(), "ws_1", CreateKeyParams{
+		ApiId:      "api_1",
+		Prefix:     "test",
+		Name:       "my key",
+		ByteLength: 16,
+		OwnerId:    "chronark",
+		Meta:       map[string]any{"plan": "pro"},
+		Expires:    expires,
+		Remaining:  10,
+		Ratelimit:  &entities.Ratelimit{Type: "fast", Limit: 10, RefillRate: 1, RefillInterval: 1000},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, db.created, 1)
+	require.Equal(t, db.created[0], key)
+	require.Equal(t, hash.Sha256(plaintext), key.Hash)
+	require.Equal(t, "test_", plaintext[:len("test_")])
+	require.Equal(t, "key_auth_1", key.KeyAuthId)
+	require.Equal(t, "ws_1", key.WorkspaceId)
+	require.Equal(t, "chronark", key.OwnerId)
+	require.Equal(t, expires, key.Expires)
+	require.True(t, key.Remaining.Enabled)
+	require.Equal(t, int64(10), key.Remaining.Remaining)
+	require.Equal(t, int64(1000), key.Ratelimit.RefillInterval)
+}
+
+func TestCreateKey_Recoverable(t *testing.T) {
+	keyring, err := encryption.NewKeyring(map[int][]byte{1: bytes.Repeat([]byte{1}, encryption.KeySize)}, 1)
+	require.NoError(t, err)
+	db := newFakeDatabase()
+	svc := New(Config{Database: db, Keyring: keyring})
+
+	key, plaintext, err := svc.CreateKey(context.Background(), "ws_1", CreateKeyParams{ApiId: "api_1", Recoverable: true})
+	require.NoError(t, err)
+	require.NotEmpty(t, key.Encrypted)
+	require.NotContains(t, key.Encrypted, plaintext)
+
+	recovered, err := keyring.Decrypt("ws_1", key.Encrypted)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, recovered)
+
+	// keys are not recoverable unless asked for
+	key, _, err = svc.CreateKey(context.Background(), "ws_1", CreateKeyParams{ApiId: "api_1"})
+	require.NoError(t, err)
+	require.Empty(t, key.Encrypted)
+}
+
+func TestCreateKey_ApiPrefix(t *testing.T) {
+	testCases := []struct {
+		name      string
+		apiPrefix string
+		prefix    string
+		want      string
+	}{
+		{name: "no prefix", want: ""},
+		{name: "default of the api", apiPrefix: "api", want: "api_"},
+		{name: "request overrides the api", apiPrefix: "api", prefix: "req", want: "req_"},
+		{name: "request without api default", prefix: "req", want: "req_"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newFakeDatabase()
+			db.api.Prefix = tc.apiPrefix
+			svc := New(Config{Database: db})
+
+			key, plaintext, err := svc.CreateKey(context.Background(), "ws_1", CreateKeyParams{ApiId: "api_1", Prefix: tc.prefix, ByteLength: 16})
+			require.NoError(t, err)
+			if tc.want == "" {
+				require.NotContains(t, plaintext, "_")
+				return
+			}
+			require.True(t, strings.HasPrefix(plaintext, tc.want), plaintext)
+			require.True(t, strings.HasPrefix(key.Start, tc.want), key.Start)
+		})
+	}
+}
+
+func TestCreateKey_StartChars(t *testing.T) {
+	testCases := []struct {
+		name       string
+		startChars int
+	}{
+		{name: "zero reveal", startChars: 0},
+		{name: "default", startChars: keys.DefaultStartChars},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newFakeDatabase()
+			svc := New(Config{Database: db, KeyStartChars: tc.startChars})
+
+			key, plaintext, err := svc.CreateKey(context.Background(), "ws_1", CreateKeyParams{ApiId: "api_1", Prefix: "test", ByteLength: 16})
+			require.NoError(t, err)
+			require.Len(t, key.Start, len("test_")+tc.startChars)
+			require.Equal(t, plaintext[:len(key.Start)], key.Start)
+		})
+	}
+}
+
+func TestCreateKey_Errors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		workspaceId string
+		params      CreateKeyParams
+		prepare     func(db *fakeDatabase, svc *Service)
+		code        errs.Code
+	}{
+		{name: "unknown api", workspaceId: "ws_1", params: CreateKeyParams{ApiId: "api_2"}, code: errs.BAD_REQUEST},
+		{name: "recoverable without keyring", workspaceId: "ws_1", params: CreateKeyParams{ApiId: "api_1", Recoverable: true}, code: errs.BAD_REQUEST},
+		{name: "other workspace", workspaceId: "ws_2", params: CreateKeyParams{ApiId: "api_1"}, code: errs.UNAUTHORIZED},
+		{
+			name:        "no key auth",
+			workspaceId: "ws_1",
+			params:      CreateKeyParams{ApiId: "api_1"},
+			prepare:     func(db *fakeDatabase, _ *Service) { db.api.KeyAuthId = "" },
+			code:        errs.BAD_REQUEST,
+		},
+		{
+			name:        "quota exceeded",
+			workspaceId: "ws_1",
+			params:      CreateKeyParams{ApiId: "api_1"},
+			prepare: func(db *fakeDatabase, _ *Service) {
+				db.workspace.MaxKeys = 5
+				db.count = 5
+			},
+			code: errs.LIMIT_EXCEEDED,
+		},
+		{
+			name:        "never expires with a lifetime limit",
+			workspaceId: "ws_1",
+			params:      CreateKeyParams{ApiId: "api_1"},
+			prepare:     func(_ *fakeDatabase, svc *Service) { svc.maxKeyLifetime = time.Hour },
+			code:        errs.BAD_REQUEST,
+		},
+		{
+			name:        "outlives the workspace limit",
+			workspaceId: "ws_1",
+			params:      CreateKeyParams{ApiId: "api_1", Expires: time.Now().Add(2 * time.Hour)},
+			prepare:     func(db *fakeDatabase, _ *Service) { db.workspace.MaxKeyLifetime = time.Hour },
+			code:        errs.BAD_REQUEST,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newFakeDatabase()
+			svc := New(Config{Database: db})
+			if tc.prepare != nil {
+				tc.prepare(db, svc)
+			}
+
+			_, _, err := svc.CreateKey(context.Background(), tc.workspaceId, tc.params)
+			require.Error(t, err)
+			e, ok := errs.As(err)
+			require.True(t, ok)
+			require.Equal(t, tc.code, e.Code)
+			require.Empty(t, db.created)
+		})
+	}
+}
+
+func TestCreateKey_ParentKey(t *testing.T) {
+	db := newFakeDatabase()
+	svc := New(Config{Database: db})
+
+	key, _, err := svc.CreateKey(context.Background(), "ws_1", CreateKeyParams{ApiId: "api_1", ByteLength: 16, ParentKeyId: "key_parent"})
+	require.NoError(t, err)
+	require.Equal(t, "key_parent", key.ParentKeyId)
+
+	for _, parentKeyId := range []string{"key_missing", "key_child", "key_other"} {
+		_, _, err := svc.CreateKey(context.Background(), "ws_1", CreateKeyParams{ApiId: "api_1", ByteLength: 16, ParentKeyId: parentKeyId})
+		require.Error(t, err, parentKeyId)
+		e, ok := errs.As(err)
+		require.True(t, ok)
+		require.Equal(t, errs.BAD_REQUEST, e.Code, parentKeyId)
+	}
+	require.Len(t, db.created, 1)
+}
+
+func TestFormatDuration(t *testing.T) {
+	require.Equal(t, "30d", FormatDuration(30*24*time.Hour))
+	require.Equal(t, "1d12h", FormatDuration(36*time.Hour))
+	require.Equal(t, "1s500ms", FormatDuration(1500*time.Millisecond))
+	require.Equal(t, "0ms", FormatDuration(0))
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+// checkKeyLifetime returns an error if a key expiring at `expires` would outlive what the workspace allows.
+// A zero `expires` means the key never expires, which is not allowed as soon as there is a limit.
+func (s *Service) checkKeyLifetime(workspace entities.Workspace, expires time.Time, now time.Time) error {
+	maxLifetime := s.maxKeyLifetime
+	if workspace.MaxKeyLifetime > 0 {
+		maxLifetime = workspace.MaxKeyLifetime
+	}
+	if maxLifetime <= 0 {
+		return nil
+	}
+
+	if expires.IsZero() {
+		return errs.NewBadRequest(fmt.Sprintf("keys in this workspace must expire within %s, set 'expires' or 'expiresIn'", FormatDuration(maxLifetime)))
+	}
+	if expires.After(now.Add(maxLifetime)) {
+		return errs.NewBadRequest(fmt.Sprintf("'expires' must not be more than %s in the future", FormatDuration(maxLifetime)))
+	}
+	return nil
+}
+
+var durationUnits = []struct {
+	name string
+	d    time.Duration
+}{
+	{"d", 24 * time.Hour},
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+	{"ms", time.Millisecond},
+}
+
+// FormatDuration formats d in the notation of `expiresIn`, using whole units from days down to milliseconds.
+func FormatDuration(d time.Duration) string {
+	if d <= 0 {
+		return "0ms"
+	}
+	var b strings.Builder
+	for _, unit := range durationUnits {
+		if d >= unit.d {
+			fmt.Fprintf(&b, "%d%s", d/unit.d, unit.name)
+			d %= unit.d
+		}
+	}
+	if b.Len() == 0 {
+		// below a millisecond
+		return "0ms"
+	}
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+const (
+	// MaxAllowedMetaKeys limits how many meta keys an api can allow
+	MaxAllowedMetaKeys = 100
+	// MaxAllowedMetaKeyLength limits the length of a single allowed meta key
+	MaxAllowedMetaKeyLength = 256
+)
+
+// ParseAllowedMetaKeys checks the meta keys an api allows, no keys remove the restriction.
+// Keys are stored comma separated, so they can not contain a comma.
+func ParseAllowedMetaKeys(keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	if len(keys) > MaxAllowedMetaKeys {
+		return nil, errs.NewBadRequest(fmt.Sprintf("'allowedMetaKeys' must not contain more than %d keys, got %d", MaxAllowedMetaKeys, len(keys)))
+	}
+	seen := map[string]bool{}
+	for i, key := range keys {
+		switch {
+		case key == "":
+			return nil, errs.NewBadRequest(fmt.Sprintf("'allowedMetaKeys[%d]' must not be empty", i))
+		case len(key) > MaxAllowedMetaKeyLength:
+			return nil, errs.NewBadRequest(fmt.Sprintf("'allowedMetaKeys[%d]' must not be longer than %d characters", i, MaxAllowedMetaKeyLength))
+		case strings.Contains(key, ","):
+			return nil, errs.NewBadRequest(fmt.Sprintf("'allowedMetaKeys[%d]' must not contain a comma", i))
+		case seen[key]:
+			return nil, errs.NewBadRequest(fmt.Sprintf("'allowedMetaKeys[%d]' is a duplicate of '%s'", i, key))
+		}
+		seen[key] = true
+	}
+	return keys, nil
+}
+
+// validateMetaKeys rejects top level meta keys the api does not allow, it does nothing if the api allows every key
+func validateMetaKeys(api entities.Api, meta map[string]any) error {
+	if len(api.AllowedMetaKeys) == 0 {
+		return nil
+	}
+	allowed := map[string]bool{}
+	for _, key := range api.AllowedMetaKeys {
+		allowed[key] = true
+	}
+
+	rejected := []string{}
+	for key := range meta {
+		if !allowed[key] {
+			rejected = append(rejected, key)
+		}
+	}
+	if len(rejected) == 0 {
+		return nil
+	}
+	sort.Strings(rejected)
+
+	fieldErrors := make([]errs.FieldError, len(rejected))
+	for i, key := range rejected {
+		field := fmt.Sprintf("meta.%s", key)
+		fieldErrors[i] = errs.FieldError{
+			Field:      field,
+			Constraint: "allowedMetaKeys",
+			Message:    fmt.Sprintf("'%s' is not an allowed meta key", field),
+		}
+	}
+	return errs.NewBadRequest(fmt.Sprintf("'meta' may only contain the keys allowed by the api: %s", strings.Join(api.AllowedMetaKeys, ", "))).WithFieldErrors(fieldErrors)
+}
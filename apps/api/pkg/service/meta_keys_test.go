@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+func TestParseAllowedMetaKeys(t *testing.T) {
+	keys, err := ParseAllowedMetaKeys([]string{"plan", "seats"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"plan", "seats"}, keys)
+
+	keys, err = ParseAllowedMetaKeys([]string{})
+	require.NoError(t, err)
+	require.Nil(t, keys)
+
+	tooMany := make([]string, MaxAllowedMetaKeys+1)
+	for i := range tooMany {
+		tooMany[i] = strings.Repeat("a", i+1)
+	}
+	for _, invalid := range [][]string{{""}, {"a,b"}, {"plan", "plan"}, {strings.Repeat("a", MaxAllowedMetaKeyLength+1)}, tooMany} {
+		_, err = ParseAllowedMetaKeys(invalid)
+		require.Error(t, err)
+		e, ok := errs.As(err)
+		require.True(t, ok)
+		require.Equal(t, errs.BAD_REQUEST, e.Code)
+	}
+}
+
+func TestCreateKey_AllowedMetaKeys(t *testing.T) {
+	testCases := []struct {
+		name        string
+		meta        map[string]any
+		fieldErrors []errs.FieldError
+	}{
+		{name: "allowed keys", meta: map[string]any{"plan": "pro", "seats": float64(3)}},
+		{name: "no meta"},
+		{name: "disallowed key", meta: map[string]any{"plan": "pro", "owner": "me"}, fieldErrors: []errs.FieldError{
+			{Field: "meta.owner", Constraint: "allowedMetaKeys", Message: "'meta.owner' is not an allowed meta key"},
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newFakeDatabase()
+			db.api.AllowedMetaKeys = []string{"plan", "seats"}
+			svc := New(Config{Database: db})
+
+			_, _, err := svc.CreateKey(context.Background(), "ws_1", CreateKeyParams{ApiId: "api_1", Meta: tc.meta})
+			if tc.fieldErrors == nil {
+				require.NoError(t, err)
+				require.Len(t, db.created, 1)
+				return
+			}
+			require.Error(t, err)
+			e, ok := errs.As(err)
+			require.True(t, ok)
+			require.Equal(t, errs.BAD_REQUEST, e.Code)
+			require.Equal(t, tc.fieldErrors, e.FieldErrors)
+			require.Len(t, db.created, 0)
+		})
+	}
+}
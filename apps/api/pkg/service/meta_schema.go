@@ -0,0 +1,74 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/entities"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+	"github.com/unkeyed/unkey/apps/api/pkg/jsonschema"
+)
+
+// MaxMetaSchemaBytes limits the size of the meta schema of an api
+const MaxMetaSchemaBytes = 16 * 1024
+
+// ParseMetaSchema checks that schema can be enforced on the meta of keys, it returns the compact form to store.
+// An empty or `null` schema removes it.
+func ParseMetaSchema(schema json.RawMessage) (string, error) {
+	if len(schema) == 0 || string(schema) == "null" {
+		return "", nil
+	}
+	if len(schema) > MaxMetaSchemaBytes {
+		return "", errs.NewBadRequest(fmt.Sprintf("'metaSchema' must not exceed %d bytes, got %d", MaxMetaSchemaBytes, len(schema)))
+	}
+	_, err := jsonschema.Compile(schema)
+	if err != nil {
+		return "", errs.NewBadRequest(fmt.Sprintf("'metaSchema' is invalid: %s", err.Error()))
+	}
+	compact := bytes.Buffer{}
+	err = json.Compact(&compact, schema)
+	if err != nil {
+		return "", errs.NewBadRequest(fmt.Sprintf("'metaSchema' is invalid: %s", err.Error()))
+	}
+	return compact.String(), nil
+}
+
+// ValidateMeta checks the meta of a key against the allowed meta keys and the meta schema of its api,
+// it does nothing if the api has neither. A key without meta is validated as an empty object.
+func (s *Service) ValidateMeta(api entities.Api, meta map[string]any) error {
+	err := validateMetaKeys(api, meta)
+	if err != nil {
+		return err
+	}
+	if api.MetaSchema == "" {
+		return nil
+	}
+	schema, err := jsonschema.Compile([]byte(api.MetaSchema))
+	if err != nil {
+		return errs.NewInternal(err, "unable to compile the meta schema of the api")
+	}
+
+	var value any = map[string]any{}
+	if meta != nil {
+		value = meta
+	}
+	violations := schema.Validate(value)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	fieldErrors := make([]errs.FieldError, len(violations))
+	for i, v := range violations {
+		field := "meta"
+		if v.Path != "" {
+			field = fmt.Sprintf("meta.%s", v.Path)
+		}
+		fieldErrors[i] = errs.FieldError{
+			Field:      field,
+			Constraint: v.Keyword,
+			Message:    fmt.Sprintf("'%s' %s", field, v.Message),
+		}
+	}
+	return errs.NewBadRequest("'meta' does not match the meta schema of the api").WithFieldErrors(fieldErrors)
+}
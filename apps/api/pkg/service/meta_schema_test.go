@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/errs"
+)
+
+func TestParseMetaSchema(t *testing.T) {
+	schema, err := ParseMetaSchema(json.RawMessage(`{ "type": "object",
+		"required": ["plan"] }`))
+	require.NoError(t, err)
+	require.Equal(t, `{"type":"object","required":["plan"]}`, schema)
+
+	for _, empty := range []string{"", "null"} {
+		schema, err = ParseMetaSchema(json.RawMessage(empty))
+		require.NoError(t, err)
+		require.Equal(t, "", schema)
+	}
+
+	_, err = ParseMetaSchema(json.RawMessage(`{"anyOf":[]}`))
+	require.Error(t, err)
+	e, ok := errs.As(err)
+	require.True(t, ok)
+	require.Equal(t, errs.BAD_REQUEST, e.Code)
+
+	_, err = ParseMetaSchema(json.RawMessage(`{"description":"` + strings.Repeat("a", MaxMetaSchemaBytes) + `"}`))
+	require.Error(t, err)
+}
+
+func TestCreateKey_MetaSchema(t *testing.T) {
+	testCases := []struct {
+		name        string
+		meta        map[string]any
+		fieldErrors []errs.FieldError
+	}{
+		{name: "matching meta", meta: map[string]any{"plan": "pro", "seats": float64(3)}},
+		{name: "missing meta", fieldErrors: []errs.FieldError{
+			{Field: "meta.plan", Constraint: "required", Message: "'meta.plan' is required"},
+		}},
+		{name: "mismatching meta", meta: map[string]any{"plan": 1, "seats": float64(0)}, fieldErrors: []errs.FieldError{
+			{Field: "meta.plan", Constraint: "type", Message: "'meta.plan' must be of type string, got integer"},
+			{Field: "meta.seats", Constraint: "minimum", Message: "'meta.seats' must be greater than or equal to 1"},
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newFakeDatabase()
+			db.api.MetaSchema = `{"type":"object","required":["plan"],"properties":{"plan":{"type":"string"},"seats":{"type":"integer","minimum":1}}}`
+			svc := New(Config{Database: db})
+
+			_, _, err := svc.CreateKey(context.Background(), "ws_1", CreateKeyParams{ApiId: "api_1", Meta: tc.meta})
+			if tc.fieldErrors == nil {
+				require.NoError(t, err)
+				require.Len(t, db.created, 1)
+				return
+			}
+			require.Error(t, err)
+			e, ok := errs.As(err)
+			require.True(t, ok)
+			require.Equal(t, errs.BAD_REQUEST, e.Code)
+			require.Equal(t, tc.fieldErrors, e.FieldErrors)
+			require.Len(t, db.created, 0)
+		})
+	}
+}
@@ -0,0 +1,42 @@
+// Package service holds the business logic behind the api, independent of the transport.
+// Handlers parse and authenticate requests, then call the service with plain values.
+// Errors are *errs.Error, so every transport can translate them the same way.
+package service
+
+import (
+	"time"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+	"github.com/unkeyed/unkey/apps/api/pkg/encryption"
+	"github.com/unkeyed/unkey/apps/api/pkg/hash"
+)
+
+type Config struct {
+	Database database.Database
+	// How far in the future keys may expire, workspaces can override it, 0 means unlimited
+	MaxKeyLifetime time.Duration
+	// How many characters of the secret are stored in plaintext in the start of new keys, 0 only stores the prefix
+	KeyStartChars int
+	// Optional, recoverable keys can only be created if it is set
+	Keyring *encryption.Keyring
+	// Optional, peppers the hashes of new keys
+	Hasher *hash.Hasher
+}
+
+type Service struct {
+	db             database.Database
+	maxKeyLifetime time.Duration
+	keyStartChars  int
+	keyring        *encryption.Keyring
+	hasher         *hash.Hasher
+}
+
+func New(config Config) *Service {
+	return &Service{
+		db:             config.Database,
+		maxKeyLifetime: config.MaxKeyLifetime,
+		keyStartChars:  config.KeyStartChars,
+		keyring:        config.Keyring,
+		hasher:         config.Hasher,
+	}
+}
@@ -0,0 +1,17 @@
+package service
+
+import (
+	"context"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/database"
+)
+
+// WithTx runs fn with a service whose database calls all run in one transaction, see database.Database.WithTx.
+// Everything fn stores is rolled back if it returns an error.
+func (s *Service) WithTx(ctx context.Context, fn func(svc *Service) error) error {
+	return s.db.WithTx(ctx, func(tx database.Database) error {
+		bound := *s
+		bound.db = tx
+		return fn(&bound)
+	})
+}
@@ -85,7 +85,7 @@ func SetupResources(t *testing.T) resources {
 	require.NoError(t, db.CreateKeyAuth(ctx, r.UserKeyAuth))
 	require.NoError(t, db.CreateApi(ctx, r.UserApi))
 
-	r.UnkeyKey = uid.New(16, string(uid.UnkeyPrefix))
+	r.UnkeyKey = uid.New(string(uid.UnkeyPrefix))
 
 	rootKeyEntity := entities.Key{
 		Id:             uid.Key(),
@@ -2,10 +2,18 @@ package uid
 
 import (
 	"crypto/rand"
-	"github.com/btcsuite/btcd/btcutil/base58"
+	"fmt"
+	"regexp"
 	"strings"
+	"sync/atomic"
+
+	"github.com/btcsuite/btcd/btcutil/base58"
 )
 
+// Ids have the format `<prefix>_<base58 of random bytes>`, or only the random part without a prefix.
+// With the default of 16 random bytes, ids carry 128 bits of entropy, so collisions are not a concern
+// no matter how many ids are generated.
+
 type Prefix string
 
 const (
@@ -14,32 +22,155 @@ const (
 	ApiPrefix       Prefix = "api"
 	UnkeyPrefix     Prefix = "unkey"
 	KeyAuthPrefix   Prefix = "key_auth"
+	RequestPrefix   Prefix = "req"
+	AuditLogPrefix  Prefix = "audit"
+	WebhookPrefix   Prefix = "wh"
+	EventPrefix     Prefix = "evt"
 )
 
-// New Returns a new random base58 encoded uuid.
-func New(byteLength int, prefix string) string {
+const (
+	DefaultByteLength = 16
+	// MinByteLength keeps shorter configured ids collision resistant
+	MinByteLength = 12
+)
+
+// Config changes the ids of the typed helpers, see Configure
+type Config struct {
+	// ByteLength is the number of random bytes, DefaultByteLength if 0
+	ByteLength int
+	// Prefixes replaces the default prefix of an entity, for example KeyPrefix: "k"
+	Prefixes map[Prefix]string
+}
+
+var validPrefix = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+
+var current atomic.Pointer[Config]
+
+func init() {
+	current.Store(&Config{ByteLength: DefaultByteLength})
+}
+
+// Validate returns an error if Configure would reject the config
+func (c Config) Validate() error {
+	if c.ByteLength != 0 && c.ByteLength < MinByteLength {
+		return fmt.Errorf("ids need at least %d random bytes, got %d", MinByteLength, c.ByteLength)
+	}
+	for entity, prefix := range c.Prefixes {
+		if !validPrefix.MatchString(prefix) {
+			return fmt.Errorf("invalid prefix %q for %s, use lowercase letters and digits separated by single underscores", prefix, entity)
+		}
+	}
+	return nil
+}
+
+// Configure validates config and applies it to every id generated afterwards.
+// Call it once at startup, existing ids keep their format.
+func Configure(config Config) error {
+	err := config.Validate()
+	if err != nil {
+		return err
+	}
+	if config.ByteLength == 0 {
+		config.ByteLength = DefaultByteLength
+	}
+	prefixes := make(map[Prefix]string, len(config.Prefixes))
+	for entity, prefix := range config.Prefixes {
+		prefixes[entity] = prefix
+	}
+	config.Prefixes = prefixes
+	current.Store(&config)
+	return nil
+}
+
+// ParsePrefixes parses prefix overrides in the form `<entity>=<prefix>`, for example `key=k`.
+// The entities are the default prefixes, so `key_auth=ka` changes the prefix of key auths.
+func ParsePrefixes(values []string) (map[Prefix]string, error) {
+	prefixes := map[Prefix]string{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		entity, prefix, ok := strings.Cut(value, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid prefix override %q, expected <entity>=<prefix>", value)
+		}
+		entity = strings.TrimSpace(entity)
+		if !knownPrefixes[Prefix(entity)] {
+			return nil, fmt.Errorf("unknown entity %q in prefix override %q", entity, value)
+		}
+		prefixes[Prefix(entity)] = strings.TrimSpace(prefix)
+	}
+	return prefixes, nil
+}
+
+var knownPrefixes = map[Prefix]bool{
+	WorkspacePrefix: true,
+	KeyPrefix:       true,
+	ApiPrefix:       true,
+	UnkeyPrefix:     true,
+	KeyAuthPrefix:   true,
+	RequestPrefix:   true,
+	AuditLogPrefix:  true,
+	WebhookPrefix:   true,
+	EventPrefix:     true,
+}
+
+// New returns a new random id with the configured byte length, prefix may be empty.
+func New(prefix string) string {
+	return NewWithByteLength(prefix, current.Load().ByteLength)
+}
+
+// NewWithByteLength returns a new random id ignoring the configured byte length,
+// for values that need a fixed amount of entropy such as secrets.
+func NewWithByteLength(prefix string, byteLength int) string {
 	buf := make([]byte, byteLength)
 	_, _ = rand.Read(buf)
 	r := base58.Encode(buf)
 
-	if prefix != "" {
-		return strings.Join([]string{string(prefix), r}, "_")
-	} else {
+	if prefix == "" {
 		return r
 	}
+	return prefix + "_" + r
+}
+
+// prefixed returns a new id for an entity, with its configured prefix
+func prefixed(entity Prefix) string {
+	prefix, ok := current.Load().Prefixes[entity]
+	if !ok {
+		prefix = string(entity)
+	}
+	return New(prefix)
 }
+
 func Workspace() string {
-	return New(16, string(WorkspacePrefix))
+	return prefixed(WorkspacePrefix)
 }
 
 func Key() string {
-	return New(16, string(KeyPrefix))
+	return prefixed(KeyPrefix)
 }
 
 func Api() string {
-	return New(16, string(ApiPrefix))
+	return prefixed(ApiPrefix)
 }
 
 func KeyAuth() string {
-	return New(16, string(KeyAuthPrefix))
+	return prefixed(KeyAuthPrefix)
+}
+
+func Request() string {
+	return prefixed(RequestPrefix)
+}
+
+func AuditLog() string {
+	return prefixed(AuditLogPrefix)
+}
+
+func Webhook() string {
+	return prefixed(WebhookPrefix)
+}
+
+func Event() string {
+	return prefixed(EventPrefix)
 }
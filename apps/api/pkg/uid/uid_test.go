@@ -1,15 +1,19 @@
 package uid
 
 import (
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/btcsuite/btcd/btcutil/base58"
 	"github.com/stretchr/testify/require"
 )
 
 func TestNew(t *testing.T) {
 	ids := map[string]bool{}
 	for i := 0; i < 1000; i++ {
-		id := New(16, "")
+		id := New("")
 		require.True(t, len(id) > 0)
 		_, ok := ids[id]
 		require.False(t, ok, "generated id must be unique")
@@ -27,7 +31,7 @@ func TestNewWithPrefix(t *testing.T) {
 	ids := map[string]bool{}
 	for _, prefix := range prefixes {
 		for i := 0; i < 1000; i++ {
-			id := New(16, string(prefix))
+			id := New(string(prefix))
 			require.True(t, len(id) > 0)
 			_, ok := ids[id]
 			require.False(t, ok, "generated id must be unique")
@@ -35,3 +39,88 @@ func TestNewWithPrefix(t *testing.T) {
 		}
 	}
 }
+
+func TestNew_UniqueAcrossGoroutines(t *testing.T) {
+	const goroutines = 8
+	const perGoroutine = 20000
+
+	var mu sync.Mutex
+	ids := make(map[string]bool, goroutines*perGoroutine)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			generated := make([]string, perGoroutine)
+			for i := range generated {
+				generated[i] = Key()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, id := range generated {
+				ids[id] = true
+			}
+		}()
+	}
+	wg.Wait()
+	require.Len(t, ids, goroutines*perGoroutine)
+}
+
+func TestFormat(t *testing.T) {
+	format := regexp.MustCompile(`^key_auth_[1-9A-HJ-NP-Za-km-z]+$`)
+	for i := 0; i < 100; i++ {
+		id := KeyAuth()
+		require.Regexp(t, format, id)
+		require.Len(t, base58.Decode(strings.TrimPrefix(id, "key_auth_")), DefaultByteLength)
+	}
+
+	require.NotContains(t, New(""), "_")
+	require.Len(t, base58.Decode(strings.TrimPrefix(NewWithByteLength("whsec", 32), "whsec_")), 32)
+}
+
+func TestConfigure(t *testing.T) {
+	t.Cleanup(func() {
+		require.NoError(t, Configure(Config{}))
+	})
+
+	require.NoError(t, Configure(Config{ByteLength: 24, Prefixes: map[Prefix]string{KeyPrefix: "k", ApiPrefix: "my_api"}}))
+
+	key := Key()
+	require.True(t, strings.HasPrefix(key, "k_"), key)
+	require.Len(t, base58.Decode(strings.TrimPrefix(key, "k_")), 24)
+	require.True(t, strings.HasPrefix(Api(), "my_api_"))
+	// entities without an override keep their default prefix
+	require.True(t, strings.HasPrefix(Workspace(), "ws_"))
+
+	testCases := []struct {
+		name   string
+		config Config
+		err    string
+	}{
+		{name: "too short", config: Config{ByteLength: 8}, err: "at least 12 random bytes"},
+		{name: "empty prefix", config: Config{Prefixes: map[Prefix]string{KeyPrefix: ""}}, err: "invalid prefix"},
+		{name: "uppercase prefix", config: Config{Prefixes: map[Prefix]string{KeyPrefix: "Key"}}, err: "invalid prefix"},
+		{name: "trailing underscore", config: Config{Prefixes: map[Prefix]string{KeyPrefix: "key_"}}, err: "invalid prefix"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Configure(tc.config)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
+
+	// a rejected config does not change anything
+	require.True(t, strings.HasPrefix(Key(), "k_"))
+}
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes([]string{"key=k", " key_auth = ka ", ""})
+	require.NoError(t, err)
+	require.Equal(t, map[Prefix]string{KeyPrefix: "k", KeyAuthPrefix: "ka"}, prefixes)
+
+	_, err = ParsePrefixes([]string{"key"})
+	require.Error(t, err)
+	_, err = ParsePrefixes([]string{"user=u"})
+	require.Error(t, err)
+}
@@ -0,0 +1,129 @@
+package usage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/jitter"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultFlushInterval = 10 * time.Second
+	DefaultFlushJitter   = 2 * time.Second
+)
+
+// Store is implemented by database.Database
+type Store interface {
+	AddKeyUsage(ctx context.Context, counts []Count) error
+}
+
+type BufferConfig struct {
+	Store  Store
+	Logger *zap.Logger
+	// How often the collected counts are written, defaults to DefaultFlushInterval
+	FlushInterval time.Duration
+	// Every flush is delayed by up to this much, so replicas do not write at the same time.
+	// nil uses DefaultFlushJitter, 0 flushes exactly every FlushInterval
+	FlushJitter *time.Duration
+}
+
+// Buffer collects verifications in memory and writes them in batches,
+// so a verification does not cost a database write.
+//
+// Counts that could not be written are kept for the next flush. Counts are lost
+// if the process dies before a flush, which is acceptable for analytics.
+type Buffer struct {
+	sync.Mutex
+	store  Store
+	logger *zap.Logger
+	counts map[hourOfKey]int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewBuffer(config BufferConfig) *Buffer {
+	b := &Buffer{
+		store:  config.Store,
+		logger: config.Logger.With(zap.String("pkg", "usage")),
+		counts: make(map[hourOfKey]int64),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	interval := config.FlushInterval
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	window := DefaultFlushJitter
+	if config.FlushJitter != nil {
+		window = *config.FlushJitter
+	}
+	go b.run(interval, window)
+	return b
+}
+
+type hourOfKey struct {
+	keyId string
+	// unix seconds of the start of the hour
+	hour int64
+}
+
+// Record counts one verification of the key at ts
+func (b *Buffer) Record(keyId string, ts time.Time) {
+	b.Lock()
+	defer b.Unlock()
+	b.counts[hourOfKey{keyId: keyId, hour: Hour.Truncate(ts).Unix()}]++
+}
+
+// Flush writes all collected counts
+func (b *Buffer) Flush(ctx context.Context) error {
+	b.Lock()
+	pending := b.counts
+	b.counts = make(map[hourOfKey]int64)
+	b.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	counts := make([]Count, 0, len(pending))
+	for k, n := range pending {
+		counts = append(counts, Count{KeyId: k.keyId, Hour: time.Unix(k.hour, 0).UTC(), Count: n})
+	}
+	err := b.store.AddKeyUsage(ctx, counts)
+	if err != nil {
+		// put them back, they are merged with everything recorded in the meantime
+		b.Lock()
+		for k, n := range pending {
+			b.counts[k] += n
+		}
+		b.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Close stops flushing periodically and writes what is left
+func (b *Buffer) Close(ctx context.Context) error {
+	close(b.stop)
+	<-b.done
+	return b.Flush(ctx)
+}
+
+func (b *Buffer) run(interval time.Duration, window time.Duration) {
+	defer close(b.done)
+	t := jitter.NewTicker(interval, window)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			err := b.Flush(context.Background())
+			if err != nil {
+				b.logger.Error("unable to flush key usage", zap.Error(err))
+			}
+		case <-b.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	fail   bool
+	counts []Count
+}
+
+func (s *memoryStore) AddKeyUsage(ctx context.Context, counts []Count) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.fail {
+		return errors.New("unavailable")
+	}
+	s.counts = append(s.counts, counts...)
+	return nil
+}
+
+func TestBuffer_AggregatesByHour(t *testing.T) {
+	store := &memoryStore{}
+	b := NewBuffer(BufferConfig{Store: store, Logger: logging.NewNoopLogger(), FlushInterval: time.Hour})
+
+	hour := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	b.Record("key_1", hour.Add(time.Minute))
+	b.Record("key_1", hour.Add(59*time.Minute))
+	b.Record("key_1", hour.Add(time.Hour))
+	b.Record("key_2", hour)
+	require.NoError(t, b.Close(context.Background()))
+
+	sort.Slice(store.counts, func(i, j int) bool {
+		if store.counts[i].KeyId != store.counts[j].KeyId {
+			return store.counts[i].KeyId < store.counts[j].KeyId
+		}
+		return store.counts[i].Hour.Before(store.counts[j].Hour)
+	})
+	require.Equal(t, []Count{
+		{KeyId: "key_1", Hour: hour, Count: 2},
+		{KeyId: "key_1", Hour: hour.Add(time.Hour), Count: 1},
+		{KeyId: "key_2", Hour: hour, Count: 1},
+	}, store.counts)
+}
+
+func TestBuffer_KeepsCountsWhenFlushFails(t *testing.T) {
+	store := &memoryStore{fail: true}
+	b := NewBuffer(BufferConfig{Store: store, Logger: logging.NewNoopLogger(), FlushInterval: time.Hour})
+
+	now := time.Now()
+	b.Record("key_1", now)
+	require.Error(t, b.Flush(context.Background()))
+
+	b.Record("key_1", now)
+	store.fail = false
+	require.NoError(t, b.Flush(context.Background()))
+	require.Len(t, store.counts, 1)
+	require.Equal(t, int64(2), store.counts[0].Count)
+
+	// nothing left to flush
+	require.NoError(t, b.Close(context.Background()))
+	require.Len(t, store.counts, 1)
+}
+
+func TestBuffer_FlushesPeriodically(t *testing.T) {
+	store := &memoryStore{}
+	b := NewBuffer(BufferConfig{Store: store, Logger: logging.NewNoopLogger(), FlushInterval: time.Millisecond})
+	defer b.Close(context.Background())
+
+	b.Record("key_1", time.Now())
+	require.Eventually(t, func() bool {
+		store.Lock()
+		defer store.Unlock()
+		return len(store.counts) == 1
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,61 @@
+// Package usage counts successful verifications of keys in hourly buckets.
+// Daily numbers are the sum of the hours of a day, all buckets are in UTC.
+package usage
+
+import (
+	"time"
+)
+
+type Granularity string
+
+const (
+	Hour Granularity = "hour"
+	Day  Granularity = "day"
+)
+
+func (g Granularity) Valid() bool {
+	return g == Hour || g == Day
+}
+
+// Duration is the length of a bucket
+func (g Granularity) Duration() time.Duration {
+	if g == Day {
+		return 24 * time.Hour
+	}
+	return time.Hour
+}
+
+// Truncate returns the start of the bucket that contains t
+func (g Granularity) Truncate(t time.Time) time.Time {
+	return t.UTC().Truncate(g.Duration())
+}
+
+// Bucket is one point of a time series
+type Bucket struct {
+	// Time is the start of the bucket
+	Time  time.Time
+	Count int64
+}
+
+// Count is a number of verifications of a key within an hour
+type Count struct {
+	KeyId string
+	// Hour is the start of the hour
+	Hour  time.Time
+	Count int64
+}
+
+// Fill returns a bucket for every step in [from, to), using the counts of buckets where available.
+// The database only stores buckets that have been used, a chart wants all of them.
+func Fill(buckets []Bucket, from, to time.Time, granularity Granularity) []Bucket {
+	counts := make(map[int64]int64, len(buckets))
+	for _, b := range buckets {
+		counts[b.Time.Unix()] += b.Count
+	}
+
+	filled := []Bucket{}
+	for t := granularity.Truncate(from); t.Before(to); t = t.Add(granularity.Duration()) {
+		filled = append(filled, Bucket{Time: t, Count: counts[t.Unix()]})
+	}
+	return filled
+}
@@ -0,0 +1,28 @@
+package usage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGranularity_Truncate(t *testing.T) {
+	ts := time.Date(2023, 7, 1, 12, 34, 56, 0, time.FixedZone("CEST", 2*60*60))
+	require.Equal(t, time.Date(2023, 7, 1, 10, 0, 0, 0, time.UTC), Hour.Truncate(ts))
+	require.Equal(t, time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC), Day.Truncate(ts))
+}
+
+func TestFill(t *testing.T) {
+	from := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(3 * 24 * time.Hour)
+
+	filled := Fill([]Bucket{{Time: from.Add(24 * time.Hour), Count: 5}}, from, to, Day)
+	require.Equal(t, []Bucket{
+		{Time: from, Count: 0},
+		{Time: from.Add(24 * time.Hour), Count: 5},
+		{Time: from.Add(48 * time.Hour), Count: 0},
+	}, filled)
+
+	require.Empty(t, Fill(nil, from, from, Hour))
+}
@@ -0,0 +1,187 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/cache"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultMaxAttempts    = 5
+	DefaultInitialBackoff = time.Second
+	DefaultTimeout        = 10 * time.Second
+)
+
+// EndpointStore is implemented by database.Database
+type EndpointStore interface {
+	ListWebhooks(ctx context.Context, workspaceId string) ([]Endpoint, error)
+}
+
+type Config struct {
+	Database EndpointStore
+	// Optional, caches the endpoints of a workspace by its id, a noop cache is used if nil
+	Cache  cache.Cache[[]Endpoint]
+	Logger *zap.Logger
+	// Optional, defaults to a client with DefaultTimeout
+	Client *http.Client
+	// How often a delivery is attempted before it is dropped, defaults to DefaultMaxAttempts
+	MaxAttempts int
+	// The wait before the first retry, it doubles after every failed attempt
+	InitialBackoff time.Duration
+}
+
+// Dispatcher delivers events in the background, with retries and exponential backoff.
+type Dispatcher struct {
+	db             EndpointStore
+	cache          cache.Cache[[]Endpoint]
+	logger         *zap.Logger
+	client         *http.Client
+	maxAttempts    int
+	initialBackoff time.Duration
+
+	inflight sync.WaitGroup
+	// closed when pending retries should be given up
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func New(config Config) *Dispatcher {
+	d := &Dispatcher{
+		db:             config.Database,
+		cache:          config.Cache,
+		logger:         config.Logger.With(zap.String("pkg", "webhooks")),
+		client:         config.Client,
+		maxAttempts:    config.MaxAttempts,
+		initialBackoff: config.InitialBackoff,
+		stop:           make(chan struct{}),
+	}
+	if d.cache == nil {
+		d.cache = cache.NewNoopCache[[]Endpoint]()
+	}
+	if d.client == nil {
+		d.client = &http.Client{Timeout: DefaultTimeout}
+	}
+	if d.maxAttempts <= 0 {
+		d.maxAttempts = DefaultMaxAttempts
+	}
+	if d.initialBackoff <= 0 {
+		d.initialBackoff = DefaultInitialBackoff
+	}
+	return d
+}
+
+// Dispatch delivers the event to every endpoint of its workspace without blocking the caller.
+func (d *Dispatcher) Dispatch(event Event) {
+	d.inflight.Add(1)
+	go func() {
+		defer d.inflight.Done()
+		ctx := context.Background()
+
+		endpoints, err := d.endpoints(ctx, event.WorkspaceId)
+		if err != nil {
+			d.logger.Error("unable to load webhook endpoints", zap.Error(err), zap.String("workspaceId", event.WorkspaceId))
+			return
+		}
+		if len(endpoints) == 0 {
+			return
+		}
+
+		body, err := json.Marshal(event)
+		if err != nil {
+			d.logger.Error("unable to marshal webhook event", zap.Error(err), zap.String("eventId", event.Id))
+			return
+		}
+		for _, endpoint := range endpoints {
+			d.inflight.Add(1)
+			go func(endpoint Endpoint) {
+				defer d.inflight.Done()
+				d.deliver(ctx, endpoint, event, body)
+			}(endpoint)
+		}
+	}()
+}
+
+// Close gives up pending retries and waits for running deliveries to finish.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.stopOnce.Do(func() { close(d.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		d.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("webhook deliveries did not finish in time: %w", ctx.Err())
+	}
+}
+
+func (d *Dispatcher) endpoints(ctx context.Context, workspaceId string) ([]Endpoint, error) {
+	endpoints, found := d.cache.Get(ctx, workspaceId)
+	if found {
+		return endpoints, nil
+	}
+	endpoints, err := d.db.ListWebhooks(ctx, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	d.cache.Set(ctx, workspaceId, endpoints)
+	return endpoints, nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, endpoint Endpoint, event Event, body []byte) {
+	logger := d.logger.With(zap.String("webhookId", endpoint.Id), zap.String("eventId", event.Id), zap.String("type", string(event.Type)))
+
+	backoff := d.initialBackoff
+	for attempt := 1; ; attempt++ {
+		retry, err := d.attempt(ctx, endpoint, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= d.maxAttempts {
+			logger.Warn("dropping webhook delivery", zap.Error(err), zap.Int("attempts", attempt))
+			return
+		}
+		logger.Info("retrying webhook delivery", zap.Error(err), zap.Int("attempt", attempt), zap.Duration("backoff", backoff))
+
+		select {
+		case <-time.After(backoff):
+		case <-d.stop:
+			logger.Warn("dropping webhook delivery, shutting down", zap.Int("attempts", attempt))
+			return
+		}
+		backoff *= 2
+	}
+}
+
+// attempt sends the body once and reports whether a failure is worth retrying
+func (d *Dispatcher) attempt(ctx context.Context, endpoint Endpoint, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.Url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("unable to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(endpoint.Secret, time.Now(), body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("unable to send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	// other client errors will not go away by trying again
+	retry := res.StatusCode >= 500 || res.StatusCode == http.StatusRequestTimeout || res.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("endpoint responded with %d", res.StatusCode)
+}
@@ -0,0 +1,133 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unkeyed/unkey/apps/api/pkg/logging"
+)
+
+type staticEndpoints map[string][]Endpoint
+
+func (s staticEndpoints) ListWebhooks(ctx context.Context, workspaceId string) ([]Endpoint, error) {
+	return s[workspaceId], nil
+}
+
+func TestDispatch_SignsAndDelivers(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []Event
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, Verify("whsec_1", r.Header.Get(SignatureHeader), body, time.Now(), time.Minute))
+
+		var e Event
+		require.NoError(t, json.Unmarshal(body, &e))
+		mu.Lock()
+		received = append(received, e)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	d := New(Config{
+		Database: staticEndpoints{"ws_1": {{Id: "wh_1", WorkspaceId: "ws_1", Url: srv.URL, Secret: "whsec_1"}}},
+		Logger:   logging.NewNoopLogger(),
+	})
+
+	d.Dispatch(NewEvent(KeyCreated, "ws_1", EventKey{Id: "key_1"}))
+	// no endpoints, nothing is sent
+	d.Dispatch(NewEvent(KeyCreated, "ws_2", EventKey{Id: "key_2"}))
+	require.NoError(t, d.Close(context.Background()))
+
+	require.Len(t, received, 1)
+	require.Equal(t, KeyCreated, received[0].Type)
+	require.Equal(t, "key_1", received[0].Key.Id)
+}
+
+func TestDispatch_Retries(t *testing.T) {
+	testCases := []struct {
+		name     string
+		status   int
+		attempts int32
+	}{
+		{name: "server error", status: http.StatusInternalServerError, attempts: 3},
+		{name: "too many requests", status: http.StatusTooManyRequests, attempts: 3},
+		{name: "client error", status: http.StatusBadRequest, attempts: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				w.WriteHeader(tc.status)
+			}))
+			defer srv.Close()
+
+			d := New(Config{
+				Database:       staticEndpoints{"ws_1": {{Id: "wh_1", WorkspaceId: "ws_1", Url: srv.URL, Secret: "whsec_1"}}},
+				Logger:         logging.NewNoopLogger(),
+				MaxAttempts:    3,
+				InitialBackoff: time.Millisecond,
+			})
+			d.Dispatch(NewEvent(KeyDeleted, "ws_1", EventKey{Id: "key_1"}))
+
+			require.Eventually(t, func() bool { return attempts.Load() == tc.attempts }, time.Second, time.Millisecond)
+			require.NoError(t, d.Close(context.Background()))
+			require.Equal(t, tc.attempts, attempts.Load())
+		})
+	}
+}
+
+func TestDispatch_RecoversAfterFailure(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	d := New(Config{
+		Database:       staticEndpoints{"ws_1": {{Id: "wh_1", WorkspaceId: "ws_1", Url: srv.URL, Secret: "whsec_1"}}},
+		Logger:         logging.NewNoopLogger(),
+		InitialBackoff: time.Millisecond,
+	})
+	d.Dispatch(NewEvent(KeyUpdated, "ws_1", EventKey{Id: "key_1"}))
+
+	require.Eventually(t, func() bool { return attempts.Load() == 2 }, time.Second, time.Millisecond)
+	require.NoError(t, d.Close(context.Background()))
+	require.Equal(t, int32(2), attempts.Load())
+}
+
+func TestClose_GivesUpPendingRetries(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	d := New(Config{
+		Database:       staticEndpoints{"ws_1": {{Id: "wh_1", WorkspaceId: "ws_1", Url: srv.URL, Secret: "whsec_1"}}},
+		Logger:         logging.NewNoopLogger(),
+		InitialBackoff: time.Hour,
+	})
+	d.Dispatch(NewEvent(KeyUpdated, "ws_1", EventKey{Id: "key_1"}))
+	require.Eventually(t, func() bool { return attempts.Load() == 1 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, d.Close(ctx))
+	require.Equal(t, int32(1), attempts.Load())
+}
@@ -0,0 +1,77 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries the signature of a delivery
+const SignatureHeader = "Unkey-Signature"
+
+// DefaultTolerance is how far the signed timestamp may be from the time of verification in VerifySignature
+const DefaultTolerance = 5 * time.Minute
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Sign returns the value of the SignatureHeader for a body sent at t.
+//
+// The format is `t=<unix seconds>,v1=<hex hmac-sha256>`, where the hmac is computed with the
+// secret over `<unix seconds>.<body>`. The timestamp is signed as well, so a captured request
+// can not be replayed later with a new timestamp.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", ts, hex.EncodeToString(mac(secret, ts, body)))
+}
+
+// VerifySignature reports whether header is a valid SignatureHeader value for body, signed with secret
+// within DefaultTolerance of now. Consumers should pass the raw body, before parsing it.
+func VerifySignature(secret, body, header string) bool {
+	return Verify(secret, header, []byte(body), time.Now(), DefaultTolerance) == nil
+}
+
+// Verify checks a SignatureHeader value the way receivers should.
+// Timestamps further than tolerance from now are rejected to prevent replays, 0 disables the check.
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	if ts == "" || sig == "" {
+		return ErrInvalidSignature
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(unix, 0)); tolerance > 0 && (age > tolerance || age < -tolerance) {
+		return fmt.Errorf("%w: timestamp is outside of the tolerance", ErrInvalidSignature)
+	}
+	decoded, err := hex.DecodeString(sig)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal(decoded, mac(secret, ts, body)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func mac(secret, ts string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
@@ -0,0 +1,63 @@
+package webhooks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSign_KnownVectors(t *testing.T) {
+	signedAt := time.Unix(1690000000, 0)
+	testCases := []struct {
+		body   string
+		header string
+	}{
+		{body: `{"id":"evt_1"}`, header: "t=1690000000,v1=52559a9bc602c25dd9fd4e7eaf18d7ecb4dfc0473c32c4b32dd298931a95cc06"},
+		{body: ``, header: "t=1690000000,v1=18230a2d2030c8356f80d713b6e2ebb3e660b4f8c306d488e01880247f048306"},
+	}
+	for _, tc := range testCases {
+		require.Equal(t, tc.header, Sign("whsec_test", signedAt, []byte(tc.body)))
+		require.NoError(t, Verify("whsec_test", tc.header, []byte(tc.body), signedAt.Add(time.Minute), DefaultTolerance))
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"type":"key.created"}`)
+	header := Sign("whsec_secret", now, body)
+
+	require.NoError(t, Verify("whsec_secret", header, body, now, time.Minute))
+
+	require.ErrorIs(t, Verify("whsec_other", header, body, now, time.Minute), ErrInvalidSignature)
+	require.ErrorIs(t, Verify("whsec_secret", header, []byte(`{"type":"key.deleted"}`), now, time.Minute), ErrInvalidSignature)
+	require.ErrorIs(t, Verify("whsec_secret", "v1=abc", body, now, time.Minute), ErrInvalidSignature)
+	require.ErrorIs(t, Verify("whsec_secret", "t=abc,v1=abc", body, now, time.Minute), ErrInvalidSignature)
+	require.ErrorIs(t, Verify("whsec_secret", "", body, now, time.Minute), ErrInvalidSignature)
+
+	// the timestamp is part of the signature
+	replayed := Sign("whsec_secret", now.Add(time.Hour), body)
+	require.NotEqual(t, header, replayed)
+}
+
+func TestVerify_Replay(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"id":"evt_1"}`)
+
+	old := Sign("whsec_secret", now.Add(-time.Hour), body)
+	require.ErrorIs(t, Verify("whsec_secret", old, body, now, time.Minute), ErrInvalidSignature)
+	// 0 disables the check
+	require.NoError(t, Verify("whsec_secret", old, body, now, 0))
+
+	future := Sign("whsec_secret", now.Add(time.Hour), body)
+	require.ErrorIs(t, Verify("whsec_secret", future, body, now, time.Minute), ErrInvalidSignature)
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := `{"id":"evt_1"}`
+	require.True(t, VerifySignature("whsec_secret", body, Sign("whsec_secret", time.Now(), []byte(body))))
+	require.False(t, VerifySignature("whsec_secret", body, Sign("whsec_other", time.Now(), []byte(body))))
+	require.False(t, VerifySignature("whsec_secret", body, Sign("whsec_secret", time.Now().Add(-time.Hour), []byte(body))))
+	// the known vector was signed long ago
+	require.False(t, VerifySignature("whsec_test", body, "t=1690000000,v1=52559a9bc602c25dd9fd4e7eaf18d7ecb4dfc0473c32c4b32dd298931a95cc06"))
+}
@@ -0,0 +1,82 @@
+// Package webhooks delivers key lifecycle events to http endpoints configured by a workspace.
+// It is the http counterpart of the kafka events, for customers that do not consume kafka.
+//
+// Every delivery is a POST with the json encoded Event as body, signed with the secret of
+// the endpoint.
+//
+// # Signatures
+//
+// The SignatureHeader of a delivery looks like `t=1690000000,v1=5255...cc06`. t is the unix
+// timestamp in seconds at which the delivery was signed and v1 is the hex encoded HMAC-SHA256
+// of `<t>.<raw body>`, keyed with the secret of the endpoint. Signing the timestamp together
+// with the body means a captured delivery can not be replayed with a fresh timestamp, and
+// receivers reject timestamps that are too far from their own clock.
+//
+// Go consumers can use VerifySignature, or Verify for a custom tolerance.
+package webhooks
+
+import (
+	"time"
+
+	"github.com/unkeyed/unkey/apps/api/pkg/uid"
+)
+
+type EventType string
+
+const (
+	KeyCreated  EventType = "key.created"
+	KeyUpdated  EventType = "key.updated"
+	KeyDeleted  EventType = "key.deleted"
+	KeyVerified EventType = "key.verified"
+)
+
+// Endpoint receives the events of all keys in its workspace.
+type Endpoint struct {
+	Id          string
+	WorkspaceId string
+	Url         string
+	// Secret signs every delivery, it is only shown once when the endpoint is created
+	Secret    string
+	CreatedAt time.Time
+}
+
+// NewSecret returns a random signing secret for a new endpoint
+func NewSecret() string {
+	return uid.NewWithByteLength("whsec", 32)
+}
+
+type Event struct {
+	// Id is the same for all attempts of a delivery, receivers can use it to deduplicate
+	Id          string    `json:"id"`
+	Type        EventType `json:"type"`
+	WorkspaceId string    `json:"workspaceId"`
+	// Time is a unix timestamp in milliseconds
+	Time int64    `json:"time"`
+	Key  EventKey `json:"key"`
+	// Verification is only set for key.verified events
+	Verification *Verification `json:"verification,omitempty"`
+}
+
+// EventKey never contains the hash of the key
+type EventKey struct {
+	Id        string `json:"id"`
+	KeyAuthId string `json:"keyAuthId,omitempty"`
+	OwnerId   string `json:"ownerId,omitempty"`
+}
+
+type Verification struct {
+	Valid bool `json:"valid"`
+	// Code is set if the key is not valid, such as RATELIMITED
+	Code string `json:"code,omitempty"`
+}
+
+// NewEvent returns an event that happened now
+func NewEvent(eventType EventType, workspaceId string, key EventKey) Event {
+	return Event{
+		Id:          uid.Event(),
+		Type:        eventType,
+		WorkspaceId: workspaceId,
+		Time:        time.Now().UnixMilli(),
+		Key:         key,
+	}
+}
@@ -34,10 +34,12 @@ type Column = {
   createdAt: Date;
   expires: Date | null;
   ownerId: string | null;
-  ratelimitType: string | null;
-  ratelimitLimit: number | null;
-  ratelimitRefillRate: number | null;
-  ratelimitRefillInterval: number | null;
+  ratelimit: {
+    type: string;
+    limit: number;
+    refillRate: number;
+    refillInterval: number;
+  } | null;
 };
 
 type Props = {
@@ -131,13 +133,12 @@ export const ApiKeyTable: React.FC<Props> = ({ data, apiId }) => {
       accessorKey: "ratelimit",
       header: "Ratelimit",
       cell: ({ row }) =>
-        row.original.ratelimitType &&
-        row.original.ratelimitLimit &&
-        row.original.ratelimitRefillInterval &&
-        row.original.ratelimitRefillRate ? (
+        row.original.ratelimit?.limit &&
+        row.original.ratelimit.refillInterval &&
+        row.original.ratelimit.refillRate ? (
           <div>
-            <span>{row.original.ratelimitRefillRate}</span> /{" "}
-            <span>{ms(row.original.ratelimitRefillInterval)}</span>
+            <span>{row.original.ratelimit.refillRate}</span> /{" "}
+            <span>{ms(row.original.ratelimit.refillInterval)}</span>
           </div>
         ) : (
           <Minus className="w-4 h-4 text-gray-300" />
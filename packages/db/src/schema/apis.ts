@@ -1,4 +1,4 @@
-import { mysqlEnum, mysqlTable, uniqueIndex, varchar } from "drizzle-orm/mysql-core";
+import { index, json, mysqlEnum, mysqlTable, text, uniqueIndex, varchar } from "drizzle-orm/mysql-core";
 import { relations } from "drizzle-orm";
 import { workspaces } from "./workspaces";
 
@@ -13,9 +13,16 @@ export const apis = mysqlTable(
 
     authType: mysqlEnum("auth_type", ["key", "jwt"]),
     keyAuthId: varchar("key_auth_id", { length: 256 }),
+    // json schema that the meta of every key must match
+    metaSchema: json("meta_schema"),
+    // comma separated top level keys the meta of every key may have, null allows every key
+    allowedMetaKeys: text("allowed_meta_keys"),
+    // prefix of keys that are created without one, null creates them without a prefix
+    prefix: varchar("prefix", { length: 256 }),
   },
   (table) => ({
     keyAuthIdIndex: uniqueIndex("key_auth_id_idx").on(table.keyAuthId),
+    workspaceIdIndex: index("workspace_id_idx").on(table.workspaceId),
   }),
 );
 
@@ -0,0 +1,29 @@
+import { mysqlTable, varchar, datetime, text, index } from "drizzle-orm/mysql-core";
+import { relations } from "drizzle-orm";
+import { workspaces } from "./workspaces";
+
+// Append only, rows are never updated or deleted
+export const auditLogs = mysqlTable(
+  "audit_logs",
+  {
+    id: varchar("id", { length: 256 }).primaryKey(),
+    workspaceId: varchar("workspace_id", { length: 256 }).notNull(),
+    // the root key that performed the action, null for verifications
+    actorKeyId: varchar("actor_key_id", { length: 256 }),
+    action: varchar("action", { length: 256 }).notNull(),
+    targetKeyId: varchar("target_key_id", { length: 256 }),
+    time: datetime("time", { fsp: 3 }).notNull(),
+    ip: varchar("ip", { length: 256 }),
+    reason: text("reason"),
+  },
+  (table) => ({
+    workspaceIdTimeIdx: index("workspace_id_time_idx").on(table.workspaceId, table.time),
+  }),
+);
+
+export const auditLogsRelations = relations(auditLogs, ({ one }) => ({
+  workspace: one(workspaces, {
+    fields: [auditLogs.workspaceId],
+    references: [workspaces.id],
+  }),
+}));
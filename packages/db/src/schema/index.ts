@@ -2,3 +2,6 @@ export * from "./keys";
 export * from "./workspaces";
 export * from "./apis";
 export * from "./keyAuth";
+export * from "./auditLogs";
+export * from "./webhooks";
+export * from "./keyUsage";
@@ -0,0 +1,24 @@
+import { mysqlTable, varchar, datetime, bigint, primaryKey } from "drizzle-orm/mysql-core";
+import { relations } from "drizzle-orm";
+import { keys } from "./keys";
+
+// Successful verifications per key and hour, days are summed up when queried
+export const keyUsage = mysqlTable(
+  "key_usage",
+  {
+    keyId: varchar("key_id", { length: 256 }).notNull(),
+    // start of the hour in UTC
+    time: datetime("time").notNull(),
+    count: bigint("count", { mode: "number" }).notNull(),
+  },
+  (table) => ({
+    pk: primaryKey(table.keyId, table.time),
+  }),
+);
+
+export const keyUsageRelations = relations(keyUsage, ({ one }) => ({
+  key: one(keys, {
+    fields: [keyUsage.keyId],
+    references: [keys.id],
+  }),
+}));
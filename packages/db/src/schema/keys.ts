@@ -6,6 +6,8 @@ import {
   int,
   uniqueIndex,
   index,
+  json,
+  boolean,
 } from "drizzle-orm/mysql-core";
 import { relations } from "drizzle-orm";
 import { workspaces } from "./workspaces";
@@ -42,7 +44,59 @@ export const keys = mysqlTable(
      * You can limit the amount of times a key can be verified before it becomes invalid
      */
     remainingRequests: int("remaining_requests"),
+    /**
+     * Disable the key once remainingRequests reaches 0, so it shows up as disabled
+     */
+    disableOnDepletion: boolean("disable_on_depletion").notNull().default(false),
+    /**
+     * Verifications that leave the key with remainingRequests at or below this are flagged as low, null never warns
+     */
+    remainingWarnThreshold: int("remaining_warn_threshold"),
+    // set when the key has been disabled, null means enabled
+    suspendedAt: datetime("suspended_at", { fsp: 3 }),
+    /**
+     * After rerolling a key, the old secret keeps working until previousHashExpires
+     */
+    previousHash: varchar("previous_hash", { length: 256 }),
+    previousHashExpires: datetime("previous_hash_expires", { fsp: 3 }),
+    /**
+     * json array of scopes a root key is limited to, null means the root key has full access
+     */
+    scopes: text("scopes"),
+    /**
+     * The secret of a recoverable key, encrypted with a versioned key of the api's keyring.
+     * null means the key can not be recovered
+     */
+    encrypted: text("encrypted"),
+    /**
+     * When the key was last verified successfully, the api writes it at most once a minute per key
+     */
+    lastUsedAt: datetime("last_used_at", { fsp: 3 }),
+    /**
+     * Set for child keys, their verifications count against the parent and they are only valid while the parent is
+     */
+    parentKeyId: varchar("parent_key_id", { length: 256 }),
+    /**
+     * How the secret was generated, rerolling the key generates the new secret the same way.
+     * null for keys created before it was stored and for imported keys
+     */
+    format: json("format").$type<{
+      byteLength: number;
+      encoding: "base58" | "base62" | "base64url";
+      checksum?: boolean;
+    }>(),
+
+    ratelimit: json("ratelimit").$type<{
+      type: "consistent" | "fast";
+      limit: number; // max size of the bucket
+      refillRate: number; // tokens per interval
+      refillInterval: number; // milliseconds
+    }>(),
 
+    /**
+     * @deprecated replaced by `ratelimit`, drop these once the api has started with MIGRATE_RATELIMITS=true
+     * and no longer reads them. Until then the api falls back to them for keys whose `ratelimit` is null
+     */
     ratelimitType: text("ratelimit_type", { enum: ["consistent", "fast"] }),
     ratelimitLimit: int("ratelimit_limit"), // max size of the bucket
     ratelimitRefillRate: int("ratelimit_refill_rate"), // tokens per interval
@@ -50,7 +104,13 @@ export const keys = mysqlTable(
   },
   (table) => ({
     hashIndex: uniqueIndex("hash_idx").on(table.hash),
+    previousHashIndex: index("previous_hash_idx").on(table.previousHash),
     keyAuthIdIndex: index("key_auth_id_idx").on(table.keyAuthId),
+    keyAuthIdExpiresIndex: index("key_auth_id_expires_idx").on(table.keyAuthId, table.expires),
+    keyAuthIdStartIndex: index("key_auth_id_start_idx").on(table.keyAuthId, table.start),
+    workspaceIdExpiresIndex: index("workspace_id_expires_idx").on(table.workspaceId, table.expires),
+    workspaceIdIdIndex: index("workspace_id_id_idx").on(table.workspaceId, table.id),
+    parentKeyIdIndex: index("parent_key_id_idx").on(table.parentKeyId),
   }),
 );
 
@@ -67,4 +127,9 @@ export const keysRelations = relations(keys, ({ one }) => ({
     fields: [keys.forWorkspaceId],
     references: [workspaces.id],
   }),
+  parentKey: one(keys, {
+    fields: [keys.parentKeyId],
+    references: [keys.id],
+    relationName: "parent",
+  }),
 }));
@@ -0,0 +1,26 @@
+import { mysqlTable, varchar, datetime, text, index } from "drizzle-orm/mysql-core";
+import { relations } from "drizzle-orm";
+import { workspaces } from "./workspaces";
+
+// Endpoints that receive the key events of a workspace
+export const webhooks = mysqlTable(
+  "webhooks",
+  {
+    id: varchar("id", { length: 256 }).primaryKey(),
+    workspaceId: varchar("workspace_id", { length: 256 }).notNull(),
+    url: text("url").notNull(),
+    // signs every delivery, only shown once when the endpoint is created
+    secret: varchar("secret", { length: 256 }).notNull(),
+    createdAt: datetime("created_at", { fsp: 3 }).notNull(),
+  },
+  (table) => ({
+    workspaceIdIdx: index("workspace_id_idx").on(table.workspaceId),
+  }),
+);
+
+export const webhooksRelations = relations(webhooks, ({ one }) => ({
+  workspace: one(workspaces, {
+    fields: [webhooks.workspaceId],
+    references: [workspaces.id],
+  }),
+}));
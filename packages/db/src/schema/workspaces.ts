@@ -1,5 +1,5 @@
 // db.ts
-import { boolean, mysqlTable, uniqueIndex, varchar, mysqlEnum } from "drizzle-orm/mysql-core";
+import { bigint, boolean, datetime, int, mysqlTable, uniqueIndex, varchar, mysqlEnum } from "drizzle-orm/mysql-core";
 import { relations } from "drizzle-orm";
 import { apis } from "./apis";
 import { keys } from "./keys";
@@ -23,6 +23,16 @@ export const workspaces = mysqlTable(
     plan: mysqlEnum("plan", ["free", "pro", "enterprise"]).default("free"),
     stripeCustomerId: varchar("stripe_customer_id", { length: 256 }),
     stripeSubscriptionId: varchar("stripe_subscription_id", { length: 256 }),
+    // how many keys this workspace may create, null means unlimited
+    maxKeys: int("max_keys"),
+    // how far in the future keys may expire in milliseconds, null falls back to the server default
+    maxKeyLifetime: bigint("max_key_lifetime", { mode: "number" }),
+    // set when the workspace has been disabled, none of its keys are valid while suspended
+    suspendedAt: datetime("suspended_at", { fsp: 3 }),
+    // omit the start of keys from list and get responses
+    hideKeyStart: boolean("hide_key_start").notNull().default(false),
+    // store no start for new keys, recoverable keys derive it from their secret
+    omitKeyStart: boolean("omit_key_start").notNull().default(false),
   },
   (table) => ({
     tenantIdIdx: uniqueIndex("tenant_id_idx").on(table.tenantId),